@@ -68,8 +68,9 @@ func runAgent(ctx context.Context, cfg *config.Config, log *zerolog.Logger) {
 	metricsStream := make(chan []db.Metric, domain.ChannelLength)
 	var wg sync.WaitGroup
 
-	collector := watcher.NewMetricCollector(metricsStream, cfg, log)
-	reporter := watcher.NewMetricReporter(metricsStream, cfg, log)
+	latencies := watcher.NewLatencyRecorder()
+	collector := watcher.NewMetricCollector(metricsStream, cfg, log).WithLatencies(latencies)
+	reporter := watcher.NewMetricReporter(metricsStream, cfg, log).WithLatencies(latencies)
 
 	log.Info().
 		Int64("polling_time", cfg.PollInterval).
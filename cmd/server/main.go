@@ -12,13 +12,21 @@ import (
 
 	"github.com/npavlov/go-metrics-service/internal/logger"
 	"github.com/npavlov/go-metrics-service/internal/model"
+	"github.com/npavlov/go-metrics-service/internal/server/apikey"
 	"github.com/npavlov/go-metrics-service/internal/server/buildinfo"
 	"github.com/npavlov/go-metrics-service/internal/server/config"
 	"github.com/npavlov/go-metrics-service/internal/server/dbmanager"
+	"github.com/npavlov/go-metrics-service/internal/server/expiry"
 	"github.com/npavlov/go-metrics-service/internal/server/grpc"
 	"github.com/npavlov/go-metrics-service/internal/server/handlers"
+	"github.com/npavlov/go-metrics-service/internal/server/hub"
+	"github.com/npavlov/go-metrics-service/internal/server/ingest"
+	"github.com/npavlov/go-metrics-service/internal/server/policy"
+	"github.com/npavlov/go-metrics-service/internal/server/replay"
 	"github.com/npavlov/go-metrics-service/internal/server/router"
+	"github.com/npavlov/go-metrics-service/internal/server/statsd"
 	"github.com/npavlov/go-metrics-service/internal/server/storage"
+	"github.com/npavlov/go-metrics-service/internal/tlsconfig"
 	"github.com/npavlov/go-metrics-service/internal/utils"
 )
 
@@ -37,16 +45,57 @@ func main() {
 	dbManager := dbmanager.NewDBManager(cfg.Database, &log).Connect(ctx).ApplyMigrations()
 	defer dbManager.Close()
 
+	changeHub := hub.NewHub(&log)
+
 	var metricStorage model.Repository
-	if dbManager.IsConnected {
-		metricStorage = storage.NewDBStorage(dbManager.DB, &log)
-	} else {
-		metricStorage = storage.NewMemStorage(&log).WithBackup(ctx, cfg)
+
+	switch {
+	case dbManager.IsConnected && dbManager.IsSQLite():
+		metricStorage = storage.NewSQLiteStorage(dbManager.SQLite, &log).WithHub(changeHub)
+	case dbManager.IsConnected:
+		metricStorage = storage.NewDBStorage(dbManager.DB, &log).WithHub(changeHub)
+	default:
+		memStorage := storage.NewMemStorage(&log).WithHub(changeHub).WithBackup(ctx, cfg)
+		defer func() {
+			if err := memStorage.Close(); err != nil {
+				log.Error().Err(err).Msg("Error closing storage")
+			}
+		}()
+		metricStorage = memStorage
+	}
+
+	seriesPolicy, err := policy.NewPolicy(cfg, &log)
+	if err != nil {
+		log.Fatal().Err(err).Msg("invalid series policy")
+	}
+
+	metricStorage, err = policy.NewRepository(ctx, metricStorage, seriesPolicy)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to register stored series")
+	}
+
+	if cfg.EvictTTLDur > 0 {
+		expiry.NewEvictor(metricStorage, cfg.EvictTTLDur, &log).Start(ctx)
+	}
+
+	if cfg.StaleTTLDur > 0 {
+		metricStorage = expiry.NewRepository(metricStorage, cfg.StaleTTLDur)
+	}
+
+	// the gRPC server and the HTTP routers share the keys and the replay guard, a nonce is accepted once
+	keys, err := apikey.NewRegistry(cfg.KeyFile, cfg.KeyReloadDur, &log)
+	if err != nil {
+		log.Fatal().Err(err).Msg("invalid key file")
 	}
+	guard := replay.NewGuard(cfg.SignatureSkewDur, cfg.NonceCacheSize)
+
+	startGrpcServer(ctx, cfg, metricStorage, changeHub, keys, guard, &log)
+
+	startStatsdServer(ctx, cfg, metricStorage, &log)
 
-	startGrpcServer(ctx, cfg, metricStorage, &log)
+	startOTLPServer(ctx, cfg, metricStorage, seriesPolicy, keys, guard, &log)
 
-	startServer(ctx, cfg, metricStorage, dbManager, &log)
+	startServer(ctx, cfg, metricStorage, changeHub, seriesPolicy, dbManager, keys, guard, &log)
 }
 
 func loadConfig(log *zerolog.Logger) *config.Config {
@@ -68,17 +117,27 @@ func startServer(
 	ctx context.Context,
 	cfg *config.Config,
 	metricStorage model.Repository,
+	changeHub *hub.Hub,
+	seriesPolicy *policy.Policy,
 	dbManager *dbmanager.DBManager,
+	keys *apikey.Registry,
+	guard *replay.Guard,
 	log *zerolog.Logger,
 ) {
-	mHandlers := handlers.NewMetricsHandler(metricStorage, log)
+	mHandlers := handlers.NewMetricsHandler(metricStorage, log).WithHub(changeHub).WithPolicy(seriesPolicy)
 	hHandlers := handlers.NewHealthHandler(dbManager, log)
 
-	cRouter := router.NewCustomRouter(cfg, log)
+	cRouter := router.NewCustomRouterWithKeys(cfg, keys, guard, log)
 	cRouter.SetRouter(mHandlers, hHandlers)
 
+	tlsConfig, err := tlsconfig.NewServer(cfg.TLSCert, cfg.TLSKey, cfg.TLSClientCA, cfg.TLSClientNames)
+	if err != nil {
+		log.Fatal().Err(err).Msg("invalid tls config")
+	}
+
 	log.Info().
 		Str("server_address", cfg.Address).
+		Bool("tls", tlsConfig != nil).
 		Msg("Server started")
 
 	//nolint:exhaustruct
@@ -87,6 +146,12 @@ func startServer(
 		ReadTimeout:  1 * time.Second,
 		WriteTimeout: 1 * time.Second,
 		Handler:      cRouter.GetRouter(),
+		TLSConfig:    tlsConfig,
+	}
+
+	listen := server.ListenAndServe
+	if tlsConfig != nil {
+		listen = func() error { return server.ListenAndServeTLS("", "") } //nolint:wrapcheck
 	}
 
 	go func() {
@@ -96,19 +161,107 @@ func startServer(
 		}
 	}()
 
-	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+	if err := listen(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 		log.Error().Err(err).Msg("Error starting server")
 	}
 	log.Info().Msg("Server shut down")
 }
 
-func startGrpcServer(ctx context.Context, cfg *config.Config, metricStorage model.Repository, log *zerolog.Logger) {
+func startGrpcServer(
+	ctx context.Context,
+	cfg *config.Config,
+	metricStorage model.Repository,
+	changeHub *hub.Hub,
+	keys *apikey.Registry,
+	guard *replay.Guard,
+	log *zerolog.Logger,
+) {
 	if !cfg.UseGRPC {
 		log.Info().Msg("Skipping gRPC server")
 
 		return
 	}
 
-	grpcServer := grpc.NewGRPCServer(metricStorage, cfg, log)
+	grpcServer := grpc.NewGRPCServerWithKeys(metricStorage, cfg, keys, guard, log).WithHub(changeHub)
 	grpcServer.Start(ctx)
 }
+
+func startStatsdServer(
+	ctx context.Context,
+	cfg *config.Config,
+	metricStorage model.Repository,
+	log *zerolog.Logger,
+) {
+	if cfg.StatsDAddress == "" {
+		log.Info().Msg("Skipping StatsD server")
+
+		return
+	}
+
+	if cfg.StatsDFlushDur <= 0 {
+		log.Fatal().Int64("statsd_flush_interval", cfg.StatsDFlush).Msg("invalid statsd flush interval")
+	}
+
+	statsdServer := statsd.NewServer(cfg.StatsDAddress, cfg.StatsDFlushDur, metricStorage, log)
+	if err := statsdServer.Start(ctx); err != nil {
+		log.Fatal().Err(err).Msg("failed to start statsd server")
+	}
+}
+
+func startOTLPServer(
+	ctx context.Context,
+	cfg *config.Config,
+	metricStorage model.Repository,
+	seriesPolicy *policy.Policy,
+	keys *apikey.Registry,
+	guard *replay.Guard,
+	log *zerolog.Logger,
+) {
+	if cfg.OTLPAddress == "" {
+		log.Info().Msg("Skipping OTLP server")
+
+		return
+	}
+
+	mHandlers := handlers.NewMetricsHandler(metricStorage, log).WithPolicy(seriesPolicy).WithOTLP(ingest.OTLPOptions{
+		ResourceLabels: cfg.OTLPResourceLabels,
+		ServicePrefix:  cfg.OTLPServicePrefix,
+	})
+
+	cRouter := router.NewCustomRouterWithKeys(cfg, keys, guard, log)
+	cRouter.SetOTLPRouter(mHandlers)
+
+	tlsConfig, err := tlsconfig.NewServer(cfg.TLSCert, cfg.TLSKey, cfg.TLSClientCA, cfg.TLSClientNames)
+	if err != nil {
+		log.Fatal().Err(err).Msg("invalid tls config")
+	}
+
+	//nolint:exhaustruct
+	server := &http.Server{
+		Addr:         cfg.OTLPAddress,
+		ReadTimeout:  1 * time.Second,
+		WriteTimeout: 1 * time.Second,
+		Handler:      cRouter.GetRouter(),
+		TLSConfig:    tlsConfig,
+	}
+
+	listen := server.ListenAndServe
+	if tlsConfig != nil {
+		listen = func() error { return server.ListenAndServeTLS("", "") } //nolint:wrapcheck
+	}
+
+	go func() {
+		<-ctx.Done()
+		if err := server.Shutdown(ctx); err != nil {
+			log.Error().Err(err).Msg("Error shutting down OTLP server")
+		}
+	}()
+
+	go func() {
+		log.Info().Str("otlp_address", cfg.OTLPAddress).Bool("tls", tlsConfig != nil).Msg("OTLP server started")
+
+		if err := listen(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Error().Err(err).Msg("Error starting OTLP server")
+		}
+	}()
+}
@@ -13,6 +13,7 @@ import (
 	"github.com/npavlov/go-metrics-service/internal/domain"
 	"github.com/npavlov/go-metrics-service/internal/server/config"
 	"github.com/npavlov/go-metrics-service/internal/server/dbmanager"
+	"github.com/npavlov/go-metrics-service/internal/server/hub"
 	testutils "github.com/npavlov/go-metrics-service/internal/test_utils"
 )
 
@@ -35,10 +36,11 @@ func TestStartServer(t *testing.T) {
 
 	cfg := &config.Config{Address: "localhost:63777"}
 	dbManager := &dbmanager.DBManager{IsConnected: false}
-	memStorage := storage.NewMemStorage(log).WithBackup(ctx, cfg)
+	changeHub := hub.NewHub(log)
+	memStorage := storage.NewMemStorage(log).WithHub(changeHub).WithBackup(ctx, cfg)
 
 	go func() {
-		startServer(ctx, cfg, memStorage, dbManager, log)
+		startServer(ctx, cfg, memStorage, changeHub, nil, dbManager, nil, nil, log)
 	}()
 
 	testutils.SendServerRequest(t, "http://"+cfg.Address, "/update/gauge/MSpanInuse/23360.000000", http.StatusOK)
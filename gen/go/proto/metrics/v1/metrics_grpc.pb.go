@@ -19,8 +19,14 @@ import (
 const _ = grpc.SupportPackageIsVersion9
 
 const (
-	MetricService_SetMetrics_FullMethodName = "/proto.metrics.v1.MetricService/SetMetrics"
-	MetricService_SetMetric_FullMethodName  = "/proto.metrics.v1.MetricService/SetMetric"
+	MetricService_SetMetrics_FullMethodName    = "/proto.metrics.v1.MetricService/SetMetrics"
+	MetricService_SetMetric_FullMethodName     = "/proto.metrics.v1.MetricService/SetMetric"
+	MetricService_StreamMetrics_FullMethodName = "/proto.metrics.v1.MetricService/StreamMetrics"
+	MetricService_GetMetric_FullMethodName     = "/proto.metrics.v1.MetricService/GetMetric"
+	MetricService_GetMetrics_FullMethodName    = "/proto.metrics.v1.MetricService/GetMetrics"
+	MetricService_ListMetrics_FullMethodName   = "/proto.metrics.v1.MetricService/ListMetrics"
+	MetricService_WatchMetrics_FullMethodName  = "/proto.metrics.v1.MetricService/WatchMetrics"
+	MetricService_DeleteMetrics_FullMethodName = "/proto.metrics.v1.MetricService/DeleteMetrics"
 )
 
 // MetricServiceClient is the client API for MetricService service.
@@ -29,6 +35,14 @@ const (
 type MetricServiceClient interface {
 	SetMetrics(ctx context.Context, in *SetMetricsRequest, opts ...grpc.CallOption) (*SetMetricsResponse, error)
 	SetMetric(ctx context.Context, in *SetMetricRequest, opts ...grpc.CallOption) (*SetMetricResponse, error)
+	// StreamMetrics keeps one stream open for many batches, the response is sent when the client closes it.
+	StreamMetrics(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[SetMetricsRequest, SetMetricsResponse], error)
+	GetMetric(ctx context.Context, in *GetMetricRequest, opts ...grpc.CallOption) (*GetMetricResponse, error)
+	GetMetrics(ctx context.Context, in *GetMetricsRequest, opts ...grpc.CallOption) (*GetMetricsResponse, error)
+	ListMetrics(ctx context.Context, in *ListMetricsRequest, opts ...grpc.CallOption) (*ListMetricsResponse, error)
+	// WatchMetrics streams metric changes until the client cancels the call.
+	WatchMetrics(ctx context.Context, in *WatchMetricsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[WatchMetricsResponse], error)
+	DeleteMetrics(ctx context.Context, in *DeleteMetricsRequest, opts ...grpc.CallOption) (*DeleteMetricsResponse, error)
 }
 
 type metricServiceClient struct {
@@ -59,12 +73,92 @@ func (c *metricServiceClient) SetMetric(ctx context.Context, in *SetMetricReques
 	return out, nil
 }
 
+func (c *metricServiceClient) StreamMetrics(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[SetMetricsRequest, SetMetricsResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &MetricService_ServiceDesc.Streams[0], MetricService_StreamMetrics_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[SetMetricsRequest, SetMetricsResponse]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type MetricService_StreamMetricsClient = grpc.ClientStreamingClient[SetMetricsRequest, SetMetricsResponse]
+
+func (c *metricServiceClient) GetMetric(ctx context.Context, in *GetMetricRequest, opts ...grpc.CallOption) (*GetMetricResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetMetricResponse)
+	err := c.cc.Invoke(ctx, MetricService_GetMetric_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *metricServiceClient) GetMetrics(ctx context.Context, in *GetMetricsRequest, opts ...grpc.CallOption) (*GetMetricsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetMetricsResponse)
+	err := c.cc.Invoke(ctx, MetricService_GetMetrics_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *metricServiceClient) ListMetrics(ctx context.Context, in *ListMetricsRequest, opts ...grpc.CallOption) (*ListMetricsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListMetricsResponse)
+	err := c.cc.Invoke(ctx, MetricService_ListMetrics_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *metricServiceClient) WatchMetrics(ctx context.Context, in *WatchMetricsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[WatchMetricsResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &MetricService_ServiceDesc.Streams[1], MetricService_WatchMetrics_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[WatchMetricsRequest, WatchMetricsResponse]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type MetricService_WatchMetricsClient = grpc.ServerStreamingClient[WatchMetricsResponse]
+
+func (c *metricServiceClient) DeleteMetrics(ctx context.Context, in *DeleteMetricsRequest, opts ...grpc.CallOption) (*DeleteMetricsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DeleteMetricsResponse)
+	err := c.cc.Invoke(ctx, MetricService_DeleteMetrics_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // MetricServiceServer is the server API for MetricService service.
 // All implementations must embed UnimplementedMetricServiceServer
 // for forward compatibility.
 type MetricServiceServer interface {
 	SetMetrics(context.Context, *SetMetricsRequest) (*SetMetricsResponse, error)
 	SetMetric(context.Context, *SetMetricRequest) (*SetMetricResponse, error)
+	// StreamMetrics keeps one stream open for many batches, the response is sent when the client closes it.
+	StreamMetrics(grpc.ClientStreamingServer[SetMetricsRequest, SetMetricsResponse]) error
+	GetMetric(context.Context, *GetMetricRequest) (*GetMetricResponse, error)
+	GetMetrics(context.Context, *GetMetricsRequest) (*GetMetricsResponse, error)
+	ListMetrics(context.Context, *ListMetricsRequest) (*ListMetricsResponse, error)
+	// WatchMetrics streams metric changes until the client cancels the call.
+	WatchMetrics(*WatchMetricsRequest, grpc.ServerStreamingServer[WatchMetricsResponse]) error
+	DeleteMetrics(context.Context, *DeleteMetricsRequest) (*DeleteMetricsResponse, error)
 	mustEmbedUnimplementedMetricServiceServer()
 }
 
@@ -81,6 +175,24 @@ func (UnimplementedMetricServiceServer) SetMetrics(context.Context, *SetMetricsR
 func (UnimplementedMetricServiceServer) SetMetric(context.Context, *SetMetricRequest) (*SetMetricResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method SetMetric not implemented")
 }
+func (UnimplementedMetricServiceServer) StreamMetrics(grpc.ClientStreamingServer[SetMetricsRequest, SetMetricsResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method StreamMetrics not implemented")
+}
+func (UnimplementedMetricServiceServer) GetMetric(context.Context, *GetMetricRequest) (*GetMetricResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetMetric not implemented")
+}
+func (UnimplementedMetricServiceServer) GetMetrics(context.Context, *GetMetricsRequest) (*GetMetricsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetMetrics not implemented")
+}
+func (UnimplementedMetricServiceServer) ListMetrics(context.Context, *ListMetricsRequest) (*ListMetricsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListMetrics not implemented")
+}
+func (UnimplementedMetricServiceServer) WatchMetrics(*WatchMetricsRequest, grpc.ServerStreamingServer[WatchMetricsResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method WatchMetrics not implemented")
+}
+func (UnimplementedMetricServiceServer) DeleteMetrics(context.Context, *DeleteMetricsRequest) (*DeleteMetricsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteMetrics not implemented")
+}
 func (UnimplementedMetricServiceServer) mustEmbedUnimplementedMetricServiceServer() {}
 func (UnimplementedMetricServiceServer) testEmbeddedByValue()                       {}
 
@@ -138,6 +250,96 @@ func _MetricService_SetMetric_Handler(srv interface{}, ctx context.Context, dec
 	return interceptor(ctx, in, info, handler)
 }
 
+func _MetricService_StreamMetrics_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(MetricServiceServer).StreamMetrics(&grpc.GenericServerStream[SetMetricsRequest, SetMetricsResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type MetricService_StreamMetricsServer = grpc.ClientStreamingServer[SetMetricsRequest, SetMetricsResponse]
+
+func _MetricService_GetMetric_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetMetricRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MetricServiceServer).GetMetric(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MetricService_GetMetric_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MetricServiceServer).GetMetric(ctx, req.(*GetMetricRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MetricService_GetMetrics_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetMetricsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MetricServiceServer).GetMetrics(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MetricService_GetMetrics_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MetricServiceServer).GetMetrics(ctx, req.(*GetMetricsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MetricService_ListMetrics_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListMetricsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MetricServiceServer).ListMetrics(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MetricService_ListMetrics_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MetricServiceServer).ListMetrics(ctx, req.(*ListMetricsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MetricService_WatchMetrics_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchMetricsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(MetricServiceServer).WatchMetrics(m, &grpc.GenericServerStream[WatchMetricsRequest, WatchMetricsResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type MetricService_WatchMetricsServer = grpc.ServerStreamingServer[WatchMetricsResponse]
+
+func _MetricService_DeleteMetrics_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteMetricsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MetricServiceServer).DeleteMetrics(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MetricService_DeleteMetrics_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MetricServiceServer).DeleteMetrics(ctx, req.(*DeleteMetricsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // MetricService_ServiceDesc is the grpc.ServiceDesc for MetricService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -153,7 +355,34 @@ var MetricService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "SetMetric",
 			Handler:    _MetricService_SetMetric_Handler,
 		},
+		{
+			MethodName: "GetMetric",
+			Handler:    _MetricService_GetMetric_Handler,
+		},
+		{
+			MethodName: "GetMetrics",
+			Handler:    _MetricService_GetMetrics_Handler,
+		},
+		{
+			MethodName: "ListMetrics",
+			Handler:    _MetricService_ListMetrics_Handler,
+		},
+		{
+			MethodName: "DeleteMetrics",
+			Handler:    _MetricService_DeleteMetrics_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamMetrics",
+			Handler:       _MetricService_StreamMetrics_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "WatchMetrics",
+			Handler:       _MetricService_WatchMetrics_Handler,
+			ServerStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "proto/metrics/v1/metrics.proto",
 }
@@ -3,10 +3,13 @@ package config
 
 import (
 	"flag"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/caarlos0/env/v6"
+	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
 
 	"github.com/npavlov/go-metrics-service/internal/utils"
@@ -21,10 +24,29 @@ type Config struct {
 	PollInterval      int64  `env:"POLL_INTERVAL"   envDefault:"2"              json:"poll_interval"`
 	UseBatch          bool   `env:"USE_BATCH"       envDefault:"false"          json:"use_batch"`
 	UseGRPC           bool   `env:"USE_GRPC"        envDefault:"false"          json:"use_grpc"`
+	UseStream         bool   `env:"USE_STREAM"      envDefault:"false"          json:"use_stream"`
 	RateLimit         int    `env:"RATE_LIMIT"      envDefault:"10"             json:"rate_limit"`
 	Config            string `env:"CONFIG_AGENT"    envDefault:""`
 	ReportIntervalDur time.Duration
 	PollIntervalDur   time.Duration
+	// GCPauseBuckets are the upper bounds in nanoseconds of the GC pause histogram.
+	GCPauseBuckets []float64 `env:"GC_PAUSE_BUCKETS" envDefault:"10000,50000,100000,250000,500000,1000000,5000000,10000000" json:"gc_pause_buckets"` //nolint:lll
+	// SummaryQuantiles are the quantiles reported by summaries, e.g. of the report latency.
+	SummaryQuantiles []float64 `env:"SUMMARY_QUANTILES" envDefault:"0.5,0.9,0.99" json:"summary_quantiles"`
+	// Tenant - the tenant the metrics are reported to, empty for the default tenant of the server.
+	// A tenant that has a key on the server requires Key to be set to that key.
+	Tenant string `env:"TENANT" envDefault:"" json:"tenant"`
+	// KeyID - the ID of Key in the key registry of the server, empty when Key is the shared key of the server.
+	KeyID string `env:"KEY_ID" envDefault:"" json:"key_id"`
+	// UseTLS - reach the server over https and TLS gRPC credentials, an https Address enables it too.
+	UseTLS bool `env:"USE_TLS" envDefault:"false" json:"use_tls"`
+	// TLSCA - the CA of the server certificate, the system roots are used when empty.
+	TLSCA string `env:"TLS_CA" envDefault:"" json:"tls_ca"`
+	// TLSCert and TLSKey - the PEM client certificate and key presented to a server requiring mutual TLS.
+	TLSCert string `env:"TLS_CERT" envDefault:"" json:"tls_cert"`
+	TLSKey  string `env:"TLS_KEY"  envDefault:"" json:"tls_key"`
+	// TLSServerName - the name the server certificate is verified for, the host of the address when empty.
+	TLSServerName string `env:"TLS_SERVER_NAME" envDefault:"" json:"tls_server_name"`
 }
 
 // Builder defines the builder for the Config struct.
@@ -49,6 +71,16 @@ func NewConfigBuilder(log *zerolog.Logger) *Builder {
 			CryptoKey:         "",
 			Config:            "",
 			UseGRPC:           false,
+			UseStream:         false,
+			GCPauseBuckets:    nil,
+			SummaryQuantiles:  nil,
+			Tenant:            "",
+			KeyID:             "",
+			UseTLS:            false,
+			TLSCA:             "",
+			TLSCert:           "",
+			TLSKey:            "",
+			TLSServerName:     "",
 		},
 		logger: log,
 	}
@@ -74,6 +106,17 @@ func (b *Builder) FromFlags() *Builder {
 	flag.IntVar(&b.cfg.RateLimit, "l", b.cfg.RateLimit, "rate limit for workers")
 	flag.StringVar(&b.cfg.Config, "config", b.cfg.Config, "path to config file")
 	flag.BoolVar(&b.cfg.UseGRPC, "use-grpc", b.cfg.UseGRPC, "use gRPC for workers")
+	flag.BoolVar(&b.cfg.UseStream, "use-stream", b.cfg.UseStream, "keep one gRPC stream open for sending metrics")
+	flag.Func("gc-pause-buckets", "comma separated GC pause histogram bounds (in nanoseconds)",
+		floatsFlag(&b.cfg.GCPauseBuckets))
+	flag.Func("summary-quantiles", "comma separated quantiles reported by summaries", floatsFlag(&b.cfg.SummaryQuantiles))
+	flag.StringVar(&b.cfg.Tenant, "tenant", b.cfg.Tenant, "tenant the metrics are reported to")
+	flag.StringVar(&b.cfg.KeyID, "key-id", b.cfg.KeyID, "ID of the key in the key registry of the server")
+	flag.BoolVar(&b.cfg.UseTLS, "use-tls", b.cfg.UseTLS, "reach the server over TLS")
+	flag.StringVar(&b.cfg.TLSCA, "tls-ca", b.cfg.TLSCA, "CA of the server certificate")
+	flag.StringVar(&b.cfg.TLSCert, "tls-cert", b.cfg.TLSCert, "PEM client certificate for mutual TLS")
+	flag.StringVar(&b.cfg.TLSKey, "tls-key", b.cfg.TLSKey, "PEM client key for mutual TLS")
+	flag.StringVar(&b.cfg.TLSServerName, "tls-server-name", b.cfg.TLSServerName, "name of the server certificate")
 	flag.Parse()
 
 	return b
@@ -102,11 +145,41 @@ func (b *Builder) FromFile() *Builder {
 
 // Build returns the final configuration.
 func (b *Builder) Build() *Config {
-	if !strings.HasPrefix(b.cfg.Address, "http://") && !strings.HasPrefix(b.cfg.Address, "https://") {
-		b.cfg.Address = "http://" + b.cfg.Address
+	if strings.HasPrefix(b.cfg.Address, "https://") {
+		b.cfg.UseTLS = true
+	}
+	host := strings.TrimPrefix(strings.TrimPrefix(b.cfg.Address, "https://"), "http://")
+	if b.cfg.UseTLS {
+		b.cfg.Address = "https://" + host
+	} else {
+		b.cfg.Address = "http://" + host
 	}
 	b.cfg.PollIntervalDur = time.Duration(b.cfg.PollInterval) * time.Second
 	b.cfg.ReportIntervalDur = time.Duration(b.cfg.ReportInterval) * time.Second
+	// histogram bounds must be strictly ascending
+	slices.Sort(b.cfg.GCPauseBuckets)
+	b.cfg.GCPauseBuckets = slices.Compact(b.cfg.GCPauseBuckets)
 
 	return b.cfg
 }
+
+// floatsFlag parses a comma separated list of numbers into the target.
+func floatsFlag(target *[]float64) func(string) error {
+	return func(value string) error {
+		parts := strings.Split(value, ",")
+		values := make([]float64, 0, len(parts))
+
+		for _, part := range parts {
+			number, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+			if err != nil {
+				return errors.Wrapf(err, "invalid number %q", part)
+			}
+
+			values = append(values, number)
+		}
+
+		*target = values
+
+		return nil
+	}
+}
@@ -79,3 +79,23 @@ func TestFromFile(t *testing.T) {
 	assert.Equal(t, int64(30), cfg.ReportInterval, "ReportInterval should be set by config file")
 	assert.Equal(t, int64(15), cfg.PollInterval, "PollInterval should be set by config file")
 }
+
+// TestBuildTLS checks that the TLS agents reach the server over https.
+func TestBuildTLS(t *testing.T) {
+	t.Parallel()
+
+	l := testutils.GetTLogger()
+
+	//nolint:exhaustruct
+	cfg := config.NewConfigBuilder(l).FromObj(&config.Config{Address: "localhost:8080", UseTLS: true}).Build()
+	assert.Equal(t, "https://localhost:8080", cfg.Address)
+
+	//nolint:exhaustruct
+	cfg = config.NewConfigBuilder(l).FromObj(&config.Config{Address: "http://localhost:8080", UseTLS: true}).Build()
+	assert.Equal(t, "https://localhost:8080", cfg.Address)
+
+	//nolint:exhaustruct
+	cfg = config.NewConfigBuilder(l).FromObj(&config.Config{Address: "https://localhost:8080"}).Build()
+	assert.Equal(t, "https://localhost:8080", cfg.Address)
+	assert.True(t, cfg.UseTLS)
+}
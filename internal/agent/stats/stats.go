@@ -42,6 +42,8 @@ type Stats struct {
 	TotalMemory    float64   `metricAlias:"Total"    metricSource:"gopsutil/mem" metricType:"gauge"`
 	FreeMemory     float64   `metricAlias:"Free"     metricSource:"gopsutil/mem" metricType:"gauge"`
 	CPUutilization []float64 `metricAlias:"System"   metricSource:"gopsutil/cpu" metricType:"gauge"`
+	PauseNs        []float64 `metricSource:"runtime" metricType:"histogram"`
+	ReportLatency  []float64 `metricSource:"custom"  metricType:"summary"`
 }
 
 func NewStats() *Stats {
@@ -57,6 +59,15 @@ func (s *Stats) getMetricAliases() []domain.MetricAlias {
 	}
 }
 
+func (s *Stats) getMetricTypes() []domain.MetricType {
+	return []domain.MetricType{
+		domain.Gauge,
+		domain.Counter,
+		domain.Histogram,
+		domain.Summary,
+	}
+}
+
 func (s *Stats) getMetricSources() []domain.MetricSource {
 	return []domain.MetricSource{
 		domain.Custom,
@@ -83,7 +94,7 @@ func (s *Stats) StatsToMetrics() []model.Metric {
 			MAlias:  domain.MetricAlias(fieldType.Tag.Get("metricAlias")),
 		}
 
-		if metric.MType != domain.Gauge && metric.MType != domain.Counter {
+		if !slices.Contains(s.getMetricTypes(), metric.MType) {
 			panic("unhandled metric type")
 		}
 		if !slices.Contains(s.getMetricSources(), metric.MSource) {
@@ -2,10 +2,11 @@ package watcher
 
 import (
 	"context"
-	"fmt"
 	"math/rand"
+	"os"
 	"reflect"
 	"runtime"
+	"strconv"
 	"sync"
 	"time"
 
@@ -21,6 +22,11 @@ import (
 	"github.com/npavlov/go-metrics-service/internal/server/db"
 )
 
+// defaultPauseBuckets are the GC pause histogram bounds in nanoseconds used when none are configured.
+//
+//nolint:gochecknoglobals
+var defaultPauseBuckets = []float64{1e4, 5e4, 1e5, 2.5e5, 5e5, 1e6, 5e6, 1e7}
+
 const (
 	errNoSuchField     = "no such field in memStats"
 	errUnsupportedKind = "cannot convert field to float64, unsupported kind: %s"
@@ -38,18 +44,37 @@ type MetricCollector struct {
 	cfg           *config.Config
 	log           *zerolog.Logger
 	metricsStream chan []db.Metric
+	host          string
+	latencies     *LatencyRecorder
+	// lastNumGC is the number of GC cycles seen by the previous poll
+	lastNumGC uint32
 }
 
 // NewMetricCollector creates a new instance of MetricCollector.
 func NewMetricCollector(metricStream chan []db.Metric, cfg *config.Config, l *zerolog.Logger) *MetricCollector {
+	host, err := os.Hostname()
+	if err != nil {
+		l.Warn().Err(err).Msg("Failed to retrieve hostname, metrics are sent without host label")
+	}
+
 	return &MetricCollector{
 		stats:         stats.NewStats().StatsToMetrics(),
 		cfg:           cfg,
 		log:           l,
 		metricsStream: metricStream,
+		host:          host,
+		latencies:     nil,
+		lastNumGC:     0,
 	}
 }
 
+// WithLatencies reports the latencies recorded by the reporter as a summary.
+func (mc *MetricCollector) WithLatencies(latencies *LatencyRecorder) *MetricCollector {
+	mc.latencies = latencies
+
+	return mc
+}
+
 func (mc *MetricCollector) StartCollector(ctx context.Context, wg *sync.WaitGroup) {
 	defer wg.Done()
 	ticker := time.NewTicker(mc.cfg.PollIntervalDur)
@@ -97,7 +122,11 @@ func (mc *MetricCollector) UpdateMetrics() {
 		var newMetric []db.Metric
 		switch metric.MSource {
 		case domain.Runtime:
-			newMetric = mc.processRuntimeMetric(metric, rMemStats)
+			if metric.MType == domain.Histogram {
+				newMetric = mc.processPauseMetric(metric, &memStats)
+			} else {
+				newMetric = mc.processRuntimeMetric(metric, rMemStats)
+			}
 		case domain.Custom:
 			newMetric = mc.processCustomMetric(metric)
 		case domain.GopsMem:
@@ -111,6 +140,10 @@ func (mc *MetricCollector) UpdateMetrics() {
 		updatedMetrics = append(updatedMetrics, newMetric...)
 	}
 
+	for i := range updatedMetrics {
+		mc.withHostLabel(&updatedMetrics[i])
+	}
+
 	mc.sendMetrics(updatedMetrics)
 }
 
@@ -140,11 +173,34 @@ func (mc *MetricCollector) processCustomMetric(metric model.Metric) []db.Metric
 		//nolint:gosec
 		val := rand.Float64()
 		newMetric.SetValue(nil, &val)
+	case domain.ReportLatency:
+		newMetric.Summary = domain.NewSummary(mc.cfg.SummaryQuantiles, mc.latencies.Drain())
 	}
 
 	return []db.Metric{*newMetric}
 }
 
+// processPauseMetric builds the histogram of the GC pauses since the previous poll,
+// the runtime keeps the most recent 256 pauses only.
+func (mc *MetricCollector) processPauseMetric(metric model.Metric, memStats *runtime.MemStats) []db.Metric {
+	buckets := mc.cfg.GCPauseBuckets
+	if len(buckets) == 0 {
+		buckets = defaultPauseBuckets
+	}
+
+	histogram := domain.NewHistogram(buckets)
+	pauses := min(memStats.NumGC-mc.lastNumGC, uint32(len(memStats.PauseNs)))
+
+	for i := range pauses {
+		// the most recent pause is at PauseNs[(NumGC+255)%256]
+		histogram.Observe(float64(memStats.PauseNs[(memStats.NumGC+255-i)%256]))
+	}
+
+	mc.lastNumGC = memStats.NumGC
+
+	return []db.Metric{*db.NewHistogramMetric(metric.ID, histogram)}
+}
+
 func (mc *MetricCollector) processGopsMemMetric(metric model.Metric, rGopMemStats reflect.Value) []db.Metric {
 	rValue := rGopMemStats.FieldByName(string(metric.MAlias))
 	value, err := mc.getFieldAsFloat64(rValue)
@@ -162,8 +218,8 @@ func (mc *MetricCollector) processGopsMemMetric(metric model.Metric, rGopMemStat
 func (mc *MetricCollector) processGopsCPUMetric(metric model.Metric, timesStat []cpu.TimesStat) []db.Metric {
 	metrics := make([]db.Metric, 0)
 	for i, cpuStat := range timesStat {
-		newID := fmt.Sprintf("%s%d", string(metric.ID), i)
-		newMetric := db.NewMetric(domain.MetricName(newID), metric.MType, nil, nil)
+		newMetric := db.NewMetric(metric.ID, metric.MType, nil, nil).
+			WithLabels(domain.Labels{"cpu": strconv.Itoa(i)})
 
 		rGopTimeStats := reflect.ValueOf(cpuStat)
 		rValue := rGopTimeStats.FieldByName(string(metric.MAlias))
@@ -181,6 +237,21 @@ func (mc *MetricCollector) processGopsCPUMetric(metric model.Metric, timesStat [
 	return metrics
 }
 
+// withHostLabel adds the host label to the metric, the metric is left as is when the hostname is unknown.
+func (mc *MetricCollector) withHostLabel(metric *db.Metric) {
+	if mc.host == "" {
+		return
+	}
+
+	labels := make(domain.Labels, len(metric.Labels)+1)
+	for name, value := range metric.Labels {
+		labels[name] = value
+	}
+	labels["host"] = mc.host
+
+	metric.Labels = labels
+}
+
 func (mc *MetricCollector) sendMetrics(metrics []db.Metric) {
 	go func() {
 		mc.metricsStream <- metrics
@@ -2,11 +2,15 @@ package watcher_test
 
 import (
 	"context"
+	"os"
+	"runtime"
+	"strconv"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/npavlov/go-metrics-service/internal/server/db"
 
@@ -34,13 +38,26 @@ func TestCollector_UpdateMetrics(t *testing.T) {
 
 	metrics := <-metricsStream
 
+	host, _ := os.Hostname()
+	cpus := 0
+
 	for _, metric := range metrics {
 		if metric.ID == domain.PollCount {
 			delta := *metric.Delta
 			assert.Equal(t, int64(1), delta)
 		}
+
+		// cores are reported as labeled series of one metric
+		if metric.ID == "CPUutilization" {
+			assert.Equal(t, strconv.Itoa(cpus), metric.Labels["cpu"])
+			cpus++
+		}
+
+		assert.Equal(t, host, metric.Labels["host"])
 	}
 
+	assert.Positive(t, cpus)
+
 	collector.UpdateMetrics()
 
 	metrics = <-metricsStream
@@ -53,6 +70,51 @@ func TestCollector_UpdateMetrics(t *testing.T) {
 	}
 }
 
+func TestCollector_Distributions(t *testing.T) {
+	t.Parallel()
+
+	l := testutils.GetTLogger()
+	//nolint:exhaustruct
+	cfg := config.NewConfigBuilder(l).FromObj(&config.Config{
+		PollInterval:     10,
+		GCPauseBuckets:   []float64{1e5, 1e6},
+		SummaryQuantiles: []float64{0.5},
+	}).Build()
+	metricsStream := make(chan []db.Metric, 1)
+	latencies := watcher.NewLatencyRecorder()
+	collector := watcher.NewMetricCollector(metricsStream, cfg, l).WithLatencies(latencies)
+
+	runtime.GC()
+	latencies.Observe(2 * time.Second)
+	collector.UpdateMetrics()
+
+	metrics := <-metricsStream
+
+	var pauses, latency *db.Metric
+	for _, metric := range metrics {
+		switch metric.ID {
+		case domain.PauseNs:
+			pauses = &metric
+		case domain.ReportLatency:
+			latency = &metric
+		}
+	}
+
+	require.NotNil(t, pauses)
+	assert.Equal(t, domain.Histogram, pauses.MType)
+	assert.Equal(t, []float64{1e5, 1e6}, pauses.Histogram.Bounds)
+	assert.Positive(t, pauses.Histogram.Count)
+	require.NoError(t, pauses.Histogram.Validate())
+
+	require.NotNil(t, latency)
+	assert.Equal(t, domain.Summary, latency.MType)
+	assert.Equal(t, []domain.Quantile{{Quantile: 0.5, Value: 2}}, latency.Summary.Quantiles)
+	assert.Equal(t, uint64(1), latency.Summary.Count)
+
+	// Latencies are drained by the poll
+	assert.Empty(t, latencies.Drain())
+}
+
 // TestStartCollector tests the StartCollector method of MetricCollector.
 func TestStartCollector(t *testing.T) {
 	t.Parallel()
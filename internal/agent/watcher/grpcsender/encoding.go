@@ -27,48 +27,85 @@ func EncodingInterceptor(encryption *crypto.Encryption, logger *zerolog.Logger)
 			return invoker(ctx, method, req, reply, cc, opts...)
 		}
 
-		// Convert request to bytes
-		reqProto, ok := req.(proto.Message)
-		if !ok {
-			logger.Error().Msg("Failed to convert request to proto.Message")
-
-			return errors.New("failed to convert request to proto.Message")
+		if err := encryptRequest(encryption, req, method, logger); err != nil {
+			return err
 		}
 
-		reqBytes, err := proto.Marshal(reqProto)
-		if err != nil {
-			logger.Error().Err(err).Msg("Failed to marshal request")
+		// Append the metadata to the context
+		newCtx := metadata.AppendToOutgoingContext(ctx, "x-encrypted", "true")
+
+		return invoker(newCtx, method, req, reply, cc, opts...)
+	}
+}
 
-			return errors.Wrap(err, "Failed to marshal request")
+// EncodingStreamInterceptor crypts every message sent on a stream.
+func EncodingStreamInterceptor(encryption *crypto.Encryption, logger *zerolog.Logger) grpc.StreamClientInterceptor {
+	return func(
+		ctx context.Context,
+		desc *grpc.StreamDesc,
+		cc *grpc.ClientConn,
+		method string,
+		streamer grpc.Streamer,
+		opts ...grpc.CallOption,
+	) (grpc.ClientStream, error) {
+		if encryption == nil {
+			return streamer(ctx, desc, cc, method, opts...)
 		}
 
-		encryptedPayload, err := encryption.Encrypt(reqBytes)
-		if err != nil {
-			logger.Error().Err(err).Msg("Failed to encrypt payload")
+		newCtx := metadata.AppendToOutgoingContext(ctx, "x-encrypted", "true")
 
-			return errors.Wrap(err, "failed to encrypt payload")
+		stream, err := streamer(newCtx, desc, cc, method, opts...)
+		if err != nil {
+			//nolint:wrapcheck
+			return nil, err
 		}
 
-		// Define the metadata key-value pairs
-		kv := []string{"x-encrypted", "true"}
+		return &sendStream{
+			ClientStream: stream,
+			beforeSend: func(msg interface{}) error {
+				return encryptRequest(encryption, msg, method, logger)
+			},
+		}, nil
+	}
+}
 
-		// Append the metadata to the context
-		newCtx := metadata.AppendToOutgoingContext(ctx, kv...)
+// encryptRequest moves the request content into the encrypted_message field.
+func encryptRequest(encryption *crypto.Encryption, req interface{}, method string, logger *zerolog.Logger) error {
+	// Convert request to bytes
+	reqProto, ok := req.(proto.Message)
+	if !ok {
+		logger.Error().Msg("Failed to convert request to proto.Message")
 
-		if request, ok := req.(*pb.SetMetricRequest); ok {
-			request.EncryptedMessage = encryptedPayload
-			request.Metric = nil
+		return errors.New("failed to convert request to proto.Message")
+	}
 
-			return invoker(newCtx, method, request, reply, cc, opts...)
-		}
+	reqBytes, err := proto.Marshal(reqProto)
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to marshal request")
 
-		if request, ok := req.(*pb.SetMetricsRequest); ok {
-			request.EncryptedMessage = encryptedPayload
-			request.Items = nil
+		return errors.Wrap(err, "Failed to marshal request")
+	}
 
-			return invoker(newCtx, method, request, reply, cc, opts...)
-		}
+	encryptedPayload, err := encryption.Encrypt(reqBytes, method)
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to encrypt payload")
 
-		return invoker(newCtx, method, req, reply, cc, opts...)
+		return errors.Wrap(err, "failed to encrypt payload")
 	}
+
+	switch request := req.(type) {
+	case *pb.SetMetricRequest:
+		request.EncryptedMessage = encryptedPayload
+		request.Metric = nil
+	case *pb.SetMetricsRequest:
+		request.EncryptedMessage = encryptedPayload
+		request.Items = nil
+		request.Signature = ""
+	case *pb.WatchMetricsRequest:
+		request.EncryptedMessage = encryptedPayload
+		request.Ids = nil
+		request.Signature = ""
+	}
+
+	return nil
 }
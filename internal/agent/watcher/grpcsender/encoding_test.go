@@ -75,7 +75,7 @@ func TestEncodingInterceptor_WithEncryption(t *testing.T) {
 	decryption, err := crypto.NewDecryption("testdata/test_private.key")
 	require.NoError(t, err)
 
-	decrypted, err := decryption.Decrypt(req.GetEncryptedMessage())
+	decrypted, err := decryption.Decrypt(req.GetEncryptedMessage(), method)
 	require.NoError(t, err)
 
 	assert.Equal(t, marshaledData, decrypted)
@@ -2,6 +2,7 @@ package grpcsender
 
 import (
 	"context"
+	"sync"
 
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
@@ -13,28 +14,95 @@ import (
 )
 
 type GRPCSender struct {
-	conn   *grpc.ClientConn
-	client pb.MetricServiceClient
-	logger *zerolog.Logger
+	conn      *grpc.ClientConn
+	client    pb.MetricServiceClient
+	logger    *zerolog.Logger
+	useStream bool
+	mx        sync.Mutex
+	stream    grpc.ClientStreamingClient[pb.SetMetricsRequest, pb.SetMetricsResponse]
 }
 
 func NewGRPCSender(conn *grpc.ClientConn, logger *zerolog.Logger) *GRPCSender {
 	client := pb.NewMetricServiceClient(conn)
 
 	return &GRPCSender{
-		conn:   conn,
-		client: client,
-		logger: logger,
+		conn:      conn,
+		client:    client,
+		logger:    logger,
+		useStream: false,
+		mx:        sync.Mutex{},
+		stream:    nil,
 	}
 }
 
+// NewGRPCStreamSender creates a sender that keeps one StreamMetrics stream open across report intervals.
+// The stream is reopened on the next send after a failure.
+func NewGRPCStreamSender(conn *grpc.ClientConn, logger *zerolog.Logger) *GRPCSender {
+	sender := NewGRPCSender(conn, logger)
+	sender.useStream = true
+
+	return sender
+}
+
 func (gc *GRPCSender) Close() {
+	gc.mx.Lock()
+	if gc.stream != nil {
+		if _, err := gc.stream.CloseAndRecv(); err != nil {
+			gc.logger.Error().Err(err).Msg("failed to close metrics stream")
+		}
+		gc.stream = nil
+	}
+	gc.mx.Unlock()
+
 	if err := gc.conn.Close(); err != nil {
 		gc.logger.Error().Err(err).Msg("failed to close grpc connection")
 	}
 }
 
+// sendToStream sends metrics over the shared stream, opening it if needed.
+// The server responds only when the stream is closed, so the sent metrics are returned as is.
+func (gc *GRPCSender) sendToStream(ctx context.Context, metrics []db.Metric) ([]db.Metric, error) {
+	//nolint:exhaustruct
+	request := pb.SetMetricsRequest{
+		Items: make([]*pb.Metric, len(metrics)),
+	}
+	for idx, m := range metrics {
+		request.Items[idx] = utils.FromDBModelToGModel(&m)
+	}
+
+	gc.mx.Lock()
+	defer gc.mx.Unlock()
+
+	if gc.stream == nil {
+		stream, err := gc.client.StreamMetrics(ctx)
+		if err != nil {
+			gc.logger.Error().Err(err).Msg("failed to open metrics stream")
+
+			return nil, errors.Wrap(err, "failed to open metrics stream")
+		}
+		gc.stream = stream
+	}
+
+	if err := gc.stream.Send(&request); err != nil {
+		gc.logger.Error().Err(err).Msg("failed to send metrics to stream")
+
+		// The actual error is returned by CloseAndRecv, the stream is reopened on the next send
+		if _, closeErr := gc.stream.CloseAndRecv(); closeErr != nil {
+			err = closeErr
+		}
+		gc.stream = nil
+
+		return nil, errors.Wrap(err, "failed to send metrics using GRPC stream")
+	}
+
+	return metrics, nil
+}
+
 func (gc *GRPCSender) SendMetricsBatch(ctx context.Context, metrics []db.Metric) ([]db.Metric, error) {
+	if gc.useStream {
+		return gc.sendToStream(ctx, metrics)
+	}
+
 	//nolint:exhaustruct
 	request := pb.SetMetricsRequest{
 		Items: make([]*pb.Metric, len(metrics)),
@@ -60,6 +128,14 @@ func (gc *GRPCSender) SendMetricsBatch(ctx context.Context, metrics []db.Metric)
 }
 
 func (gc *GRPCSender) SendMetric(ctx context.Context, metric db.Metric) (*db.Metric, error) {
+	if gc.useStream {
+		if _, err := gc.sendToStream(ctx, []db.Metric{metric}); err != nil {
+			return nil, err
+		}
+
+		return &metric, nil
+	}
+
 	//nolint:exhaustruct
 	request := pb.SetMetricRequest{
 		Metric: utils.FromDBModelToGModel(&metric),
@@ -3,6 +3,7 @@ package grpcsender_test
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -14,9 +15,14 @@ import (
 	"github.com/npavlov/go-metrics-service/internal/agent/config"
 	"github.com/npavlov/go-metrics-service/internal/agent/watcher/grpcsender"
 	"github.com/npavlov/go-metrics-service/internal/domain"
+	sconfig "github.com/npavlov/go-metrics-service/internal/server/config"
 	"github.com/npavlov/go-metrics-service/internal/server/db"
+	sgrpc "github.com/npavlov/go-metrics-service/internal/server/grpc"
+	"github.com/npavlov/go-metrics-service/internal/server/replay"
+	"github.com/npavlov/go-metrics-service/internal/server/storage"
 	testutils "github.com/npavlov/go-metrics-service/internal/test_utils"
 	"github.com/npavlov/go-metrics-service/internal/utils"
+	"github.com/npavlov/go-metrics-service/pkg/crypto"
 )
 
 type MockMetricServiceServer struct {
@@ -166,3 +172,58 @@ func TestSendMetricsBatchNoCrypto(t *testing.T) {
 	assert.Equal(t, metrics[0].ID, resp[0].ID)
 	assert.Equal(t, metrics[1].ID, resp[1].ID)
 }
+
+func TestSendMetricsStream(t *testing.T) {
+	t.Parallel()
+
+	listener := bufconn.Listen(1024 * 1024)
+	logger := testutils.GetTLogger()
+
+	serverCfg := &sconfig.Config{
+		Key:       "test-stream-key",
+		CryptoKey: "testdata/test_private.key",
+	}
+	decryption, err := crypto.NewDecryption(serverCfg.CryptoKey)
+	require.NoError(t, err)
+
+	memStorage := storage.NewMemStorage(logger)
+	server := grpc.NewServer(grpc.ChainStreamInterceptor(
+		sgrpc.DecryptStreamInterceptor(decryption, logger),
+		sgrpc.SigStreamInterceptor(serverCfg.Key, nil, replay.NewGuard(time.Minute, 100), logger),
+	))
+	pb.RegisterMetricServiceServer(server, sgrpc.NewGRPCServer(memStorage, serverCfg, logger))
+
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	t.Cleanup(server.Stop)
+
+	cfg := &config.Config{
+		Key:       "test-stream-key",
+		CryptoKey: "testdata/test_public.key",
+	}
+
+	conn := grpcsender.MakeInMemoryConnection(cfg, listener, logger)
+	grpcSender := grpcsender.NewGRPCStreamSender(conn, logger)
+
+	metrics := []db.Metric{
+		*db.NewMetric("test_metric", domain.Gauge, nil, float64Ptr(42.0)),
+		*db.NewMetric("test_counter", domain.Counter, int64Ptr(1), nil),
+	}
+
+	for range 3 {
+		resp, err := grpcSender.SendMetricsBatch(context.Background(), metrics)
+		require.NoError(t, err)
+		assert.Len(t, resp, len(metrics))
+	}
+
+	_, err = grpcSender.SendMetric(context.Background(), metrics[1])
+	require.NoError(t, err)
+
+	// Closing the sender closes the stream, the server has applied every batch by then
+	grpcSender.Close()
+
+	counter, found := memStorage.Get(context.Background(), "test_counter")
+	require.True(t, found)
+	assert.Equal(t, int64(4), *counter.Delta)
+}
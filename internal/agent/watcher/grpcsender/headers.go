@@ -2,16 +2,27 @@ package grpcsender
 
 import (
 	"context"
+	"net/http"
+	"strconv"
+	"time"
 
+	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
 
 	"github.com/npavlov/go-metrics-service/internal/agent/config"
+	"github.com/npavlov/go-metrics-service/internal/server/apikey"
+	"github.com/npavlov/go-metrics-service/internal/server/tenant"
 	"github.com/npavlov/go-metrics-service/internal/utils"
 )
 
-// HeadersInterceptor adds X-Real-IP and HashSHA256 metadata.
+// signatureField is the field of streamed request messages that carries their signature.
+const signatureField = "signature"
+
+// HeadersInterceptor adds X-Real-IP, X-Tenant, X-Key-ID and HashSHA256 metadata.
 func HeadersInterceptor(cfg *config.Config, ip string, logger *zerolog.Logger) grpc.UnaryClientInterceptor {
 	return func(
 		ctx context.Context,
@@ -24,14 +35,16 @@ func HeadersInterceptor(cfg *config.Config, ip string, logger *zerolog.Logger) g
 		md := metadata.New(map[string]string{
 			"X-Real-IP": ip,
 		})
+		withTenant(cfg, md)
 
-		// Serialize request and calculate hash if key is set
+		// Serialize request and calculate hash if key is set, the hash covers the method, the time and a nonce
 		if cfg.Key != "" {
 			payload, err := utils.MarshalProtoMessage(req)
 			if err != nil {
 				logger.Error().Err(err).Msg("failed to marshal request for hashing")
 			} else {
-				hash := utils.CalculateHash(cfg.Key, payload)
+				timestamp, nonce := withNonce(md)
+				hash := utils.CalculateHash(cfg.Key, utils.SignedPayload(http.MethodPost, method, timestamp, nonce, payload))
 				md.Append("HashSHA256", hash)
 			}
 		}
@@ -41,3 +54,92 @@ func HeadersInterceptor(cfg *config.Config, ip string, logger *zerolog.Logger) g
 		return invoker(ctx, method, req, reply, cc, opts...)
 	}
 }
+
+// HeadersStreamInterceptor adds X-Real-IP, X-Tenant and X-Key-ID metadata to the stream and signs every sent message.
+// Stream metadata is sent once, so the signature is carried in the message itself. The timestamp and the nonce
+// of the stream are sent in the metadata, every message is signed with the nonce followed by its sequence number.
+func HeadersStreamInterceptor(cfg *config.Config, ip string, logger *zerolog.Logger) grpc.StreamClientInterceptor {
+	return func(
+		ctx context.Context,
+		desc *grpc.StreamDesc,
+		cc *grpc.ClientConn,
+		method string,
+		streamer grpc.Streamer,
+		opts ...grpc.CallOption,
+	) (grpc.ClientStream, error) {
+		md := metadata.New(map[string]string{
+			"X-Real-IP": ip,
+		})
+		withTenant(cfg, md)
+
+		var timestamp, nonce string
+		if cfg.Key != "" {
+			timestamp, nonce = withNonce(md)
+		}
+		ctx = metadata.NewOutgoingContext(ctx, md)
+
+		stream, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			//nolint:wrapcheck
+			return nil, err
+		}
+
+		if cfg.Key == "" {
+			return stream, nil
+		}
+
+		sent := uint64(0)
+
+		return &sendStream{
+			ClientStream: stream,
+			beforeSend: func(msg interface{}) error {
+				request, ok := msg.(proto.Message)
+				if !ok {
+					return errors.New("unsupported stream message")
+				}
+
+				field := request.ProtoReflect().Descriptor().Fields().ByName(signatureField)
+				if field == nil {
+					return errors.New("unsupported stream message")
+				}
+
+				request.ProtoReflect().Clear(field)
+
+				payload, err := utils.MarshalProtoMessage(request)
+				if err != nil {
+					logger.Error().Err(err).Msg("failed to marshal request for hashing")
+
+					return errors.Wrap(err, "failed to marshal request for hashing")
+				}
+
+				signed := utils.SignedPayload(http.MethodPost, method, timestamp, utils.StreamNonce(nonce, sent), payload)
+				request.ProtoReflect().Set(field, protoreflect.ValueOfString(utils.CalculateHash(cfg.Key, signed)))
+				sent++
+
+				return nil
+			},
+		}, nil
+	}
+}
+
+// withTenant names the tenant of the agent and the ID of its key in the metadata,
+// the default tenant of the server is not named.
+func withTenant(cfg *config.Config, md metadata.MD) {
+	if cfg.Tenant != "" {
+		md.Set(tenant.Header, cfg.Tenant)
+	}
+
+	if cfg.KeyID != "" {
+		md.Set(apikey.Header, cfg.KeyID)
+	}
+}
+
+// withNonce adds the timestamp and a new nonce of a signed request to the metadata and returns them.
+func withNonce(md metadata.MD) (string, string) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	nonce := utils.NewNonce()
+	md.Set(utils.TimestampHeader, timestamp)
+	md.Set(utils.NonceHeader, nonce)
+
+	return timestamp, nonce
+}
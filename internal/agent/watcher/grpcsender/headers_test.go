@@ -3,6 +3,7 @@ package grpcsender_test
 import (
 	"context"
 	"errors"
+	"net/http"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -48,7 +49,6 @@ func TestHeadersInterceptor(t *testing.T) {
 		req := &pb.SetMetricRequest{Metric: &pb.Metric{Id: "test", Mtype: pb.Metric_TYPE_GAUGE, Value: float64Ptr(1)}}
 		payload, err := utils.MarshalProtoMessage(req)
 		require.NoError(t, err)
-		hash := utils.CalculateHash(cfg.Key, payload)
 
 		invoker := &MockUnaryInvoker{}
 		invoker.On("Invoke", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).
@@ -57,6 +57,14 @@ func TestHeadersInterceptor(t *testing.T) {
 			require.True(t, ok)
 			md, ok := metadata.FromOutgoingContext(ctx)
 			require.True(t, ok)
+
+			// the hash covers the method, the timestamp and the nonce sent with the request
+			timestamps, nonces := md.Get(utils.TimestampHeader), md.Get(utils.NonceHeader)
+			require.Len(t, timestamps, 1)
+			require.Len(t, nonces, 1)
+			hash := utils.CalculateHash(cfg.Key,
+				utils.SignedPayload(http.MethodPost, "testMethod", timestamps[0], nonces[0], payload))
+
 			hashes := md.Get("HashSHA256")
 			assert.Contains(t, hashes[0], hash)
 		})
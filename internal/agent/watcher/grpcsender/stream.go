@@ -0,0 +1,21 @@
+package grpcsender
+
+import (
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+)
+
+// sendStream wraps a client stream and processes every message before it is sent.
+type sendStream struct {
+	grpc.ClientStream
+	beforeSend func(msg interface{}) error
+}
+
+func (s *sendStream) SendMsg(msg interface{}) error {
+	if err := s.beforeSend(msg); err != nil {
+		return errors.Wrap(err, "failed to process message")
+	}
+
+	//nolint:wrapcheck
+	return s.ClientStream.SendMsg(msg)
+}
@@ -6,11 +6,13 @@ import (
 
 	"github.com/rs/zerolog"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/test/bufconn"
 
 	"github.com/npavlov/go-metrics-service/internal/agent/config"
 	au "github.com/npavlov/go-metrics-service/internal/agent/utils"
+	"github.com/npavlov/go-metrics-service/internal/tlsconfig"
 	"github.com/npavlov/go-metrics-service/pkg/crypto"
 )
 
@@ -30,8 +32,13 @@ func MakeConnection(cfg *config.Config, logger *zerolog.Logger) *grpc.ClientConn
 		HeadersInterceptor(cfg, ip, logger),
 		EncodingInterceptor(encryption, logger),
 	)
+	streamInterceptors := grpc.WithChainStreamInterceptor(
+		HeadersStreamInterceptor(cfg, ip, logger),
+		EncodingStreamInterceptor(encryption, logger),
+	)
 
-	conn, err := grpc.NewClient(cfg.GRPCAddress, grpc.WithTransportCredentials(insecure.NewCredentials()), interceptors)
+	conn, err := grpc.NewClient(cfg.GRPCAddress, grpc.WithTransportCredentials(transportCredentials(cfg, logger)),
+		interceptors, streamInterceptors)
 	if err != nil {
 		logger.Fatal().Err(err).Msg("failed to create grpc connection")
 	}
@@ -55,6 +62,10 @@ func MakeInMemoryConnection(cfg *config.Config, listener *bufconn.Listener, logg
 		HeadersInterceptor(cfg, ip, logger),
 		EncodingInterceptor(encryption, logger),
 	)
+	streamInterceptors := grpc.WithChainStreamInterceptor(
+		HeadersStreamInterceptor(cfg, ip, logger),
+		EncodingStreamInterceptor(encryption, logger),
+	)
 
 	dialer := func(_ context.Context, _ string) (net.Conn, error) {
 		return listener.Dial()
@@ -64,10 +75,24 @@ func MakeInMemoryConnection(cfg *config.Config, listener *bufconn.Listener, logg
 	conn, err := grpc.NewClient("passthrough:///bufnet",
 		grpc.WithContextDialer(dialer),
 		grpc.WithTransportCredentials(insecure.NewCredentials()),
-		interceptors)
+		interceptors, streamInterceptors)
 	if err != nil {
 		logger.Fatal().Err(err).Msg("failed to create grpc connection")
 	}
 
 	return conn
 }
+
+// transportCredentials returns the TLS credentials when the agent uses TLS, the insecure ones otherwise.
+func transportCredentials(cfg *config.Config, logger *zerolog.Logger) credentials.TransportCredentials {
+	if !cfg.UseTLS {
+		return insecure.NewCredentials()
+	}
+
+	tlsConfig, err := tlsconfig.NewClient(cfg.TLSCA, cfg.TLSCert, cfg.TLSKey, cfg.TLSServerName)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("failed to create tls config")
+	}
+
+	return credentials.NewTLS(tlsConfig)
+}
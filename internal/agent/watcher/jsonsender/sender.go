@@ -2,7 +2,10 @@ package jsonsender
 
 import (
 	"context"
+	"crypto/tls"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/go-resty/resty/v2"
 	jsoniter "github.com/json-iterator/go"
@@ -11,7 +14,10 @@ import (
 
 	"github.com/npavlov/go-metrics-service/internal/agent/config"
 	au "github.com/npavlov/go-metrics-service/internal/agent/utils"
+	"github.com/npavlov/go-metrics-service/internal/server/apikey"
 	"github.com/npavlov/go-metrics-service/internal/server/db"
+	"github.com/npavlov/go-metrics-service/internal/server/tenant"
+	"github.com/npavlov/go-metrics-service/internal/tlsconfig"
 	"github.com/npavlov/go-metrics-service/internal/utils"
 	"github.com/npavlov/go-metrics-service/pkg/crypto"
 )
@@ -23,6 +29,7 @@ type JSONSender struct {
 	l          *zerolog.Logger
 	json       jsoniter.API
 	encryption *crypto.Encryption
+	tls        *tls.Config
 	ip         string
 }
 
@@ -32,9 +39,18 @@ func NewSender(cfg *config.Config, logger *zerolog.Logger) *JSONSender {
 		l:          logger,
 		json:       jsoniter.ConfigCompatibleWithStandardLibrary,
 		encryption: nil,
+		tls:        nil,
 		ip:         au.GetLocalIP(logger),
 	}
 
+	if cfg.UseTLS {
+		tlsConfig, err := tlsconfig.NewClient(cfg.TLSCA, cfg.TLSCert, cfg.TLSKey, cfg.TLSServerName)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("failed to create tls config")
+		}
+		sender.tls = tlsConfig
+	}
+
 	if cfg.CryptoKey == "" {
 		return sender
 	}
@@ -54,9 +70,7 @@ func (rh *JSONSender) Close() {
 }
 
 func (rh *JSONSender) SendMetric(ctx context.Context, metric db.Metric) (*db.Metric, error) {
-	url := rh.cfg.Address + "/update/"
-
-	data, err := rh.sendPostRequest(ctx, url, metric)
+	data, err := rh.sendPostRequest(ctx, "/update/", metric)
 	if err != nil {
 		return nil, err
 	}
@@ -65,9 +79,7 @@ func (rh *JSONSender) SendMetric(ctx context.Context, metric db.Metric) (*db.Met
 }
 
 func (rh *JSONSender) SendMetricsBatch(ctx context.Context, metrics []db.Metric) ([]db.Metric, error) {
-	url := rh.cfg.Address + "/updates/"
-
-	data, err := rh.sendPostRequest(ctx, url, metrics)
+	data, err := rh.sendPostRequest(ctx, "/updates/", metrics)
 	if err != nil {
 		return nil, err
 	}
@@ -75,7 +87,7 @@ func (rh *JSONSender) SendMetricsBatch(ctx context.Context, metrics []db.Metric)
 	return rh.readMany(data)
 }
 
-func (rh *JSONSender) sendPostRequest(ctx context.Context, url string, data interface{}) ([]byte, error) {
+func (rh *JSONSender) sendPostRequest(ctx context.Context, path string, data interface{}) ([]byte, error) {
 	payload, err := rh.json.Marshal(data)
 	if err != nil {
 		rh.l.Error().Err(err).Msg("Failed to marshal metric")
@@ -91,6 +103,9 @@ func (rh *JSONSender) sendPostRequest(ctx context.Context, url string, data inte
 	}
 
 	client := resty.New()
+	if rh.tls != nil {
+		client.SetTLSClientConfig(rh.tls)
+	}
 	request := client.R().
 		SetContext(ctx).
 		SetHeader("Content-Type", "application/json").
@@ -100,13 +115,26 @@ func (rh *JSONSender) sendPostRequest(ctx context.Context, url string, data inte
 		SetBody(compressed.Bytes()).
 		SetDoNotParseResponse(true)
 
+	// the signature covers the route, the time and a nonce of the request, so it cannot be replayed
 	if rh.cfg.Key != "" {
-		hash := utils.CalculateHash(rh.cfg.Key, payload)
-		request.SetHeader("HashSHA256", hash)
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		nonce := utils.NewNonce()
+		hash := utils.CalculateHash(rh.cfg.Key, utils.SignedPayload(http.MethodPost, path, timestamp, nonce, payload))
+		request.SetHeader("HashSHA256", hash).
+			SetHeader(utils.TimestampHeader, timestamp).
+			SetHeader(utils.NonceHeader, nonce)
+	}
+
+	if rh.cfg.KeyID != "" {
+		request.SetHeader(apikey.Header, rh.cfg.KeyID)
+	}
+
+	if rh.cfg.Tenant != "" {
+		request.SetHeader(tenant.Header, rh.cfg.Tenant)
 	}
 
 	if rh.encryption != nil {
-		encryptedPayload, err := rh.encryption.Encrypt(compressed.Bytes())
+		encryptedPayload, err := rh.encryption.Encrypt(compressed.Bytes(), path)
 		if err != nil {
 			return nil, errors.Wrap(err, "failed to encrypt metric")
 		}
@@ -114,7 +142,7 @@ func (rh *JSONSender) sendPostRequest(ctx context.Context, url string, data inte
 		request.SetHeader("X-Encrypted", "true")
 	}
 
-	resp, err := request.Post(url)
+	resp, err := request.Post(rh.cfg.Address + path)
 	if err != nil {
 		rh.l.Error().Err(err).Msg("Failed to send post request")
 
@@ -177,7 +177,7 @@ func TestSendEncryptedMetric(t *testing.T) {
 
 		// Read and decrypt payload
 		encryptedBody, _ := io.ReadAll(request.Body)
-		decryptedBody, err := decryption.Decrypt(encryptedBody)
+		decryptedBody, err := decryption.Decrypt(encryptedBody, request.URL.Path)
 		assert.NoError(t, err)
 		reader := io.NopCloser(bytes.NewBuffer(decryptedBody))
 		body, err := utils.DecompressResult(reader)
@@ -0,0 +1,47 @@
+package watcher
+
+import (
+	"sync"
+	"time"
+)
+
+// LatencyRecorder collects the durations of sent reports until the collector drains them, a nil recorder drops them.
+type LatencyRecorder struct {
+	mu           *sync.Mutex
+	observations []float64
+}
+
+// NewLatencyRecorder - constructor for LatencyRecorder.
+func NewLatencyRecorder() *LatencyRecorder {
+	return &LatencyRecorder{
+		mu:           &sync.Mutex{},
+		observations: make([]float64, 0),
+	}
+}
+
+// Observe records the duration in seconds.
+func (lr *LatencyRecorder) Observe(duration time.Duration) {
+	if lr == nil {
+		return
+	}
+
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+
+	lr.observations = append(lr.observations, duration.Seconds())
+}
+
+// Drain returns the durations recorded since the previous call.
+func (lr *LatencyRecorder) Drain() []float64 {
+	if lr == nil {
+		return nil
+	}
+
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+
+	observations := lr.observations
+	lr.observations = make([]float64, 0)
+
+	return observations
+}
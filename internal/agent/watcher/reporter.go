@@ -30,6 +30,7 @@ type MetricReporter struct {
 	batchStream   chan []db.Metric
 	resultStream  chan Result
 	sender        model.Sender
+	latencies     *LatencyRecorder
 }
 
 func NewMetricReporter(inputStream chan []db.Metric, cfg *config.Config, logger *zerolog.Logger) *MetricReporter {
@@ -42,19 +43,31 @@ func NewMetricReporter(inputStream chan []db.Metric, cfg *config.Config, logger
 		resultStream:  make(chan Result),
 		inputStream:   inputStream,
 		sender:        nil,
+		latencies:     nil,
 	}
 
 	// choose type of communication
-	if cfg.UseGRPC {
+	switch {
+	case cfg.UseGRPC && cfg.UseStream:
+		conn := grpcsender.MakeConnection(cfg, logger)
+		reporter.sender = grpcsender.NewGRPCStreamSender(conn, logger)
+	case cfg.UseGRPC:
 		conn := grpcsender.MakeConnection(cfg, logger)
 		reporter.sender = grpcsender.NewGRPCSender(conn, logger)
-	} else {
+	default:
 		reporter.sender = jsonsender.NewSender(cfg, logger)
 	}
 
 	return reporter
 }
 
+// WithLatencies records the duration of every sent report.
+func (mr *MetricReporter) WithLatencies(latencies *LatencyRecorder) *MetricReporter {
+	mr.latencies = latencies
+
+	return mr
+}
+
 func (mr *MetricReporter) StartReporter(ctx context.Context, wg *sync.WaitGroup) {
 	// Start generator and worker pool
 	go mr.metricGenerator(ctx, wg)
@@ -149,7 +162,9 @@ func (mr *MetricReporter) worker(ctx context.Context, wg *sync.WaitGroup, worker
 }
 
 func (mr *MetricReporter) handleMetric(ctx context.Context, metric db.Metric) Result {
+	start := time.Now()
 	data, err := mr.sender.SendMetric(ctx, metric)
+	mr.latencies.Observe(time.Since(start))
 
 	return Result{
 		Metric:  data,
@@ -159,7 +174,9 @@ func (mr *MetricReporter) handleMetric(ctx context.Context, metric db.Metric) Re
 }
 
 func (mr *MetricReporter) handleBatch(ctx context.Context, metrics []db.Metric) Result {
+	start := time.Now()
 	data, err := mr.sender.SendMetricsBatch(ctx, metrics)
+	mr.latencies.Observe(time.Since(start))
 
 	return Result{
 		Metrics: data,
@@ -0,0 +1,256 @@
+package domain
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultBuckets are the histogram upper bounds used when none are configured, they suit durations in seconds.
+//
+//nolint:gochecknoglobals
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// HistogramData - observations counted into buckets, the bucket i holds the values in (Bounds[i-1], Bounds[i]].
+// Counts has one more bucket than Bounds for the values above the last bound (+Inf).
+//
+//nolint:recvcheck
+type HistogramData struct {
+	Bounds []float64 `json:"bounds"`
+	Counts []uint64  `json:"counts"`
+	Sum    float64   `json:"sum"`
+	Count  uint64    `json:"count"`
+}
+
+// NewHistogram creates an empty histogram with the given ascending upper bounds.
+func NewHistogram(bounds []float64) *HistogramData {
+	return &HistogramData{
+		Bounds: slices.Clone(bounds),
+		Counts: make([]uint64, len(bounds)+1),
+		Sum:    0,
+		Count:  0,
+	}
+}
+
+// Observe counts the value into its bucket.
+func (h *HistogramData) Observe(value float64) {
+	h.Counts[sort.SearchFloat64s(h.Bounds, value)]++
+	h.Sum += value
+	h.Count++
+}
+
+// Merge adds the observations of the other histogram, the other histogram replaces this one when the buckets differ.
+func (h *HistogramData) Merge(other *HistogramData) {
+	if !slices.Equal(h.Bounds, other.Bounds) || len(h.Counts) != len(other.Counts) {
+		*h = *other.Clone()
+
+		return
+	}
+
+	for i, count := range other.Counts {
+		h.Counts[i] += count
+	}
+
+	h.Sum += other.Sum
+	h.Count += other.Count
+}
+
+// Clone returns a deep copy of the histogram.
+func (h *HistogramData) Clone() *HistogramData {
+	return &HistogramData{
+		Bounds: slices.Clone(h.Bounds),
+		Counts: slices.Clone(h.Counts),
+		Sum:    h.Sum,
+		Count:  h.Count,
+	}
+}
+
+// Cumulative returns the number of observations less than or equal to each bound, followed by the total count.
+func (h *HistogramData) Cumulative() []uint64 {
+	cumulative := make([]uint64, len(h.Counts))
+
+	var total uint64
+	for i, count := range h.Counts {
+		total += count
+		cumulative[i] = total
+	}
+
+	return cumulative
+}
+
+// Validate checks that the bounds are strictly ascending and the buckets add up to the count.
+func (h *HistogramData) Validate() error {
+	if len(h.Counts) != len(h.Bounds)+1 {
+		return fmt.Errorf("histogram should have %d buckets, got %d", len(h.Bounds)+1, len(h.Counts))
+	}
+
+	for i, bound := range h.Bounds {
+		if math.IsNaN(bound) || math.IsInf(bound, 0) || (i > 0 && bound <= h.Bounds[i-1]) {
+			return fmt.Errorf("histogram bounds should be finite and strictly ascending, got %v", h.Bounds)
+		}
+	}
+
+	var total uint64
+	for _, count := range h.Counts {
+		total += count
+	}
+
+	if total != h.Count {
+		return fmt.Errorf("histogram buckets add up to %d, count is %d", total, h.Count)
+	}
+
+	return nil
+}
+
+// String - the compact form of the histogram, e.g. count=3 sum=1.2 [0.1:1 1:2 +Inf:0].
+func (h *HistogramData) String() string {
+	buckets := make([]string, len(h.Counts))
+	for i, count := range h.Counts {
+		bound := "+Inf"
+		if i < len(h.Bounds) {
+			bound = strconv.FormatFloat(h.Bounds[i], 'g', -1, 64)
+		}
+
+		buckets[i] = bound + ":" + strconv.FormatUint(count, 10)
+	}
+
+	return "count=" + strconv.FormatUint(h.Count, 10) +
+		" sum=" + strconv.FormatFloat(h.Sum, 'g', -1, 64) +
+		" [" + strings.Join(buckets, " ") + "]"
+}
+
+// Scan reads a histogram stored as a JSON object.
+func (h *HistogramData) Scan(value interface{}) error {
+	return scanJSON(value, h)
+}
+
+// Value stores the histogram as a JSON object.
+func (h HistogramData) Value() (driver.Value, error) {
+	return valueJSON(h)
+}
+
+// Quantile - the value below which the given fraction of observations falls.
+type Quantile struct {
+	Quantile float64 `json:"quantile"`
+	Value    float64 `json:"value"`
+}
+
+// SummaryData - quantiles of the observations of a reporting window together with the total sum and count.
+//
+//nolint:recvcheck
+type SummaryData struct {
+	Quantiles []Quantile `json:"quantiles"`
+	Sum       float64    `json:"sum"`
+	Count     uint64     `json:"count"`
+}
+
+// NewSummary computes the requested quantiles, each in [0, 1], of the observations with the nearest-rank method.
+func NewSummary(quantiles []float64, observations []float64) *SummaryData {
+	sorted := slices.Clone(observations)
+	slices.Sort(sorted)
+
+	summary := &SummaryData{
+		Quantiles: make([]Quantile, 0, len(quantiles)),
+		Sum:       0,
+		Count:     uint64(len(sorted)),
+	}
+
+	for _, value := range sorted {
+		summary.Sum += value
+	}
+
+	// quantiles of a window without observations are reported as zero, JSON has no NaN
+	for _, quantile := range quantiles {
+		value := 0.0
+		if len(sorted) > 0 {
+			rank := int(math.Ceil(quantile*float64(len(sorted)))) - 1
+			value = sorted[max(rank, 0)]
+		}
+
+		summary.Quantiles = append(summary.Quantiles, Quantile{Quantile: quantile, Value: value})
+	}
+
+	return summary
+}
+
+// Merge takes the quantiles of the other summary, quantiles of distinct windows cannot be combined,
+// the sum and the count keep accumulating.
+func (s *SummaryData) Merge(other *SummaryData) {
+	s.Quantiles = slices.Clone(other.Quantiles)
+	s.Sum += other.Sum
+	s.Count += other.Count
+}
+
+// Clone returns a deep copy of the summary.
+func (s *SummaryData) Clone() *SummaryData {
+	return &SummaryData{
+		Quantiles: slices.Clone(s.Quantiles),
+		Sum:       s.Sum,
+		Count:     s.Count,
+	}
+}
+
+// Validate checks that every quantile lies in [0, 1].
+func (s *SummaryData) Validate() error {
+	for _, quantile := range s.Quantiles {
+		if quantile.Quantile < 0 || quantile.Quantile > 1 || math.IsNaN(quantile.Quantile) {
+			return fmt.Errorf("summary quantile should be in [0, 1], got %v", quantile.Quantile)
+		}
+	}
+
+	return nil
+}
+
+// String - the compact form of the summary, e.g. count=3 sum=1.2 [0.5:0.3 0.99:0.8].
+func (s *SummaryData) String() string {
+	quantiles := make([]string, len(s.Quantiles))
+	for i, quantile := range s.Quantiles {
+		quantiles[i] = strconv.FormatFloat(quantile.Quantile, 'g', -1, 64) + ":" +
+			strconv.FormatFloat(quantile.Value, 'g', -1, 64)
+	}
+
+	return "count=" + strconv.FormatUint(s.Count, 10) +
+		" sum=" + strconv.FormatFloat(s.Sum, 'g', -1, 64) +
+		" [" + strings.Join(quantiles, " ") + "]"
+}
+
+// Scan reads a summary stored as a JSON object.
+func (s *SummaryData) Scan(value interface{}) error {
+	return scanJSON(value, s)
+}
+
+// Value stores the summary as a JSON object.
+func (s SummaryData) Value() (driver.Value, error) {
+	return valueJSON(s)
+}
+
+func scanJSON(value interface{}, dest interface{}) error {
+	var data []byte
+
+	switch v := value.(type) {
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return ErrInvalidStr
+	}
+
+	//nolint:wrapcheck
+	return json.Unmarshal(data, dest)
+}
+
+func valueJSON(value interface{}) (driver.Value, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		//nolint:wrapcheck
+		return nil, err
+	}
+
+	return string(data), nil
+}
@@ -0,0 +1,91 @@
+package domain_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/npavlov/go-metrics-service/internal/domain"
+)
+
+func TestHistogram_ObserveAndMerge(t *testing.T) {
+	t.Parallel()
+
+	histogram := domain.NewHistogram([]float64{1, 5})
+	for _, value := range []float64{0.5, 1, 3, 10} {
+		histogram.Observe(value)
+	}
+
+	assert.Equal(t, []uint64{2, 1, 1}, histogram.Counts)
+	assert.Equal(t, []uint64{2, 3, 4}, histogram.Cumulative())
+	assert.InDelta(t, 14.5, histogram.Sum, 0.0001)
+	require.NoError(t, histogram.Validate())
+	assert.Equal(t, "count=4 sum=14.5 [1:2 5:1 +Inf:1]", histogram.String())
+
+	// Histograms with the same buckets are added up
+	other := domain.NewHistogram([]float64{1, 5})
+	other.Observe(2)
+	histogram.Merge(other)
+	assert.Equal(t, []uint64{2, 2, 1}, histogram.Counts)
+	assert.Equal(t, uint64(5), histogram.Count)
+
+	// Changed buckets replace the histogram
+	changed := domain.NewHistogram([]float64{10})
+	changed.Observe(2)
+	histogram.Merge(changed)
+	assert.Equal(t, changed, histogram)
+}
+
+func TestHistogram_Validate(t *testing.T) {
+	t.Parallel()
+
+	require.Error(t, (&domain.HistogramData{Bounds: []float64{1}, Counts: []uint64{1}, Sum: 0, Count: 1}).Validate())
+	require.Error(t, (&domain.HistogramData{Bounds: []float64{2, 1}, Counts: []uint64{0, 0, 0}, Sum: 0, Count: 0}).Validate())
+	require.Error(t, (&domain.HistogramData{Bounds: []float64{1}, Counts: []uint64{1, 1}, Sum: 0, Count: 1}).Validate())
+}
+
+func TestSummary(t *testing.T) {
+	t.Parallel()
+
+	summary := domain.NewSummary([]float64{0.5, 0.9, 1}, []float64{5, 1, 4, 2, 3})
+	assert.Equal(t, []domain.Quantile{{Quantile: 0.5, Value: 3}, {Quantile: 0.9, Value: 5}, {Quantile: 1, Value: 5}},
+		summary.Quantiles)
+	assert.InDelta(t, 15, summary.Sum, 0.0001)
+	assert.Equal(t, uint64(5), summary.Count)
+	require.NoError(t, summary.Validate())
+
+	// The latest quantiles win, sum and count accumulate
+	summary.Merge(domain.NewSummary([]float64{0.5}, []float64{10}))
+	assert.Equal(t, []domain.Quantile{{Quantile: 0.5, Value: 10}}, summary.Quantiles)
+	assert.InDelta(t, 25, summary.Sum, 0.0001)
+	assert.Equal(t, uint64(6), summary.Count)
+
+	empty := domain.NewSummary([]float64{0.5}, nil)
+	assert.Equal(t, "count=0 sum=0 [0.5:0]", empty.String())
+
+	require.Error(t, domain.NewSummary([]float64{1.5}, nil).Validate())
+}
+
+func TestDistribution_ScanValue(t *testing.T) {
+	t.Parallel()
+
+	histogram := domain.NewHistogram([]float64{1})
+	histogram.Observe(0.5)
+
+	val, err := histogram.Value()
+	require.NoError(t, err)
+
+	var scanned domain.HistogramData
+	require.NoError(t, scanned.Scan(val))
+	assert.Equal(t, histogram, &scanned)
+
+	summary := domain.NewSummary([]float64{0.5}, []float64{1})
+	val, err = summary.Value()
+	require.NoError(t, err)
+
+	var scannedSummary domain.SummaryData
+	require.NoError(t, scannedSummary.Scan([]byte(val.(string))))
+	assert.Equal(t, summary, &scannedSummary)
+	assert.ErrorIs(t, scannedSummary.Scan(1), domain.ErrInvalidStr)
+}
@@ -0,0 +1,199 @@
+package domain
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// labelNamePattern is the allowed syntax of label names, the same as in Prometheus.
+var labelNamePattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// MaxLabelsLength - the longest canonical form of the labels of a series in bytes,
+// it keeps the series IDs within the index entry size of the databases.
+const MaxLabelsLength = 2048
+
+// Labels - the set of dimensions of a metric series.
+//
+//nolint:recvcheck
+type Labels map[string]string
+
+// String returns the canonical form of the labels: {a="1",b="2"} with names sorted, empty for no labels.
+func (l Labels) String() string {
+	if len(l) == 0 {
+		return ""
+	}
+
+	names := make([]string, 0, len(l))
+	for name := range l {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	var builder strings.Builder
+
+	builder.WriteByte('{')
+
+	for i, name := range names {
+		if i > 0 {
+			builder.WriteByte(',')
+		}
+
+		builder.WriteString(name)
+		builder.WriteString(`="`)
+		builder.WriteString(EscapeLabelValue(l[name]))
+		builder.WriteByte('"')
+	}
+
+	builder.WriteByte('}')
+
+	return builder.String()
+}
+
+// Validate checks that every label name has the allowed syntax and the labels are not longer than MaxLabelsLength.
+func (l Labels) Validate() error {
+	for name := range l {
+		if !labelNamePattern.MatchString(name) {
+			return fmt.Errorf("invalid label name: %q", name)
+		}
+	}
+
+	if length := len(l.String()); length > MaxLabelsLength {
+		return fmt.Errorf("labels are %d bytes long, at most %d are allowed", length, MaxLabelsLength)
+	}
+
+	return nil
+}
+
+// Scan reads labels stored as a JSON object.
+func (l *Labels) Scan(value interface{}) error {
+	var data []byte
+
+	switch v := value.(type) {
+	case nil:
+		*l = nil
+
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return ErrInvalidStr
+	}
+
+	//nolint:wrapcheck
+	return json.Unmarshal(data, l)
+}
+
+// Value stores labels as a JSON object, no labels are stored as an empty object.
+func (l Labels) Value() (driver.Value, error) {
+	if l == nil {
+		return "{}", nil
+	}
+
+	data, err := json.Marshal(map[string]string(l))
+	if err != nil {
+		//nolint:wrapcheck
+		return nil, err
+	}
+
+	return string(data), nil
+}
+
+// EscapeLabelValue escapes backslashes, double quotes and line feeds of a label value.
+func EscapeLabelValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+// SeriesID identifies a series by the metric name followed by its canonical labels, e.g. CPUutilization{cpu="0"}.
+// The series ID of a metric without labels is its name.
+func SeriesID(name MetricName, labels Labels) MetricName {
+	return name + MetricName(labels.String())
+}
+
+// ParseSeriesID splits the series ID into the metric name and the labels, see SeriesID.
+// An ID not ending with canonical labels is the name of a metric without labels.
+func ParseSeriesID(id MetricName) (MetricName, Labels) {
+	value := string(id)
+
+	for start := strings.IndexByte(value, '{'); start > 0; {
+		name := MetricName(value[:start])
+		if labels, ok := parseLabels(value[start:]); ok && SeriesID(name, labels) == id {
+			return name, labels
+		}
+
+		next := strings.IndexByte(value[start+1:], '{')
+		if next < 0 {
+			break
+		}
+		start += next + 1
+	}
+
+	return id, nil
+}
+
+// parseLabels parses the canonical form of the labels, see Labels.String.
+func parseLabels(value string) (Labels, bool) {
+	if len(value) < 2 || value[0] != '{' || value[len(value)-1] != '}' {
+		return nil, false
+	}
+
+	labels := make(Labels)
+	rest := value[1:]
+
+	for {
+		name, after, found := strings.Cut(rest, `="`)
+		if !found || !labelNamePattern.MatchString(name) {
+			return nil, false
+		}
+
+		var builder strings.Builder
+
+		end := -1
+		for i := 0; i < len(after); i++ {
+			if after[i] == '"' {
+				end = i
+
+				break
+			}
+
+			if after[i] != '\\' {
+				builder.WriteByte(after[i])
+
+				continue
+			}
+
+			if i++; i == len(after) {
+				return nil, false
+			}
+
+			switch after[i] {
+			case 'n':
+				builder.WriteByte('\n')
+			case '\\', '"':
+				builder.WriteByte(after[i])
+			default:
+				return nil, false
+			}
+		}
+
+		if end < 0 || end+1 == len(after) {
+			return nil, false
+		}
+
+		labels[name] = builder.String()
+
+		switch rest = after[end+2:]; after[end+1] {
+		case '}':
+			return labels, rest == ""
+		case ',':
+		default:
+			return nil, false
+		}
+	}
+}
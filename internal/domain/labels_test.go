@@ -0,0 +1,82 @@
+package domain_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/npavlov/go-metrics-service/internal/domain"
+)
+
+func TestLabels_String(t *testing.T) {
+	t.Parallel()
+
+	assert.Empty(t, domain.Labels(nil).String())
+	assert.Equal(t, `{cpu="0",host="a\"b"}`, domain.Labels{"host": `a"b`, "cpu": "0"}.String())
+}
+
+func TestLabels_Validate(t *testing.T) {
+	t.Parallel()
+
+	require.NoError(t, domain.Labels{"cpu": "0", "_host": "a"}.Validate())
+	require.Error(t, domain.Labels{"0cpu": "0"}.Validate())
+	require.Error(t, domain.Labels{"host-name": "a"}.Validate())
+
+	// the series ID of the labels has to fit the ID columns and indexes of the databases
+	require.NoError(t, domain.Labels{"path": strings.Repeat("a", domain.MaxLabelsLength-len(`{path=""}`))}.Validate())
+	require.Error(t, domain.Labels{"path": strings.Repeat("a", domain.MaxLabelsLength)}.Validate())
+}
+
+func TestLabels_ScanValue(t *testing.T) {
+	t.Parallel()
+
+	labels := domain.Labels{"cpu": "1"}
+	val, err := labels.Value()
+	require.NoError(t, err)
+
+	var scanned domain.Labels
+	require.NoError(t, scanned.Scan(val))
+	assert.Equal(t, labels, scanned)
+
+	require.NoError(t, scanned.Scan(nil))
+	assert.Nil(t, scanned)
+	assert.ErrorIs(t, scanned.Scan(1), domain.ErrInvalidStr)
+
+	val, err = domain.Labels(nil).Value()
+	require.NoError(t, err)
+	assert.Equal(t, "{}", val)
+}
+
+func TestSeriesID(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, domain.MetricName("CPUutilization"), domain.SeriesID("CPUutilization", nil))
+	assert.Equal(t, domain.MetricName(`CPUutilization{cpu="0"}`),
+		domain.SeriesID("CPUutilization", domain.Labels{"cpu": "0"}))
+}
+
+func TestParseSeriesID(t *testing.T) {
+	t.Parallel()
+
+	for _, labels := range []domain.Labels{
+		nil,
+		{"cpu": "0"},
+		{"path": `/a,b="c"`, "msg": "line\nbreak \\ end", "empty": ""},
+	} {
+		name, parsed := domain.ParseSeriesID(domain.SeriesID("requests", labels))
+		assert.Equal(t, domain.MetricName("requests"), name)
+		assert.Equal(t, labels, parsed)
+	}
+
+	name, parsed := domain.ParseSeriesID(domain.SeriesID("odd{name", domain.Labels{"a": "1"}))
+	assert.Equal(t, domain.MetricName("odd{name"), name)
+	assert.Equal(t, domain.Labels{"a": "1"}, parsed)
+
+	for _, id := range []domain.MetricName{`odd{name`, `cpu{}`, `cpu{a="1"`, `cpu{a="1",}`, `cpu{1a="1"}`} {
+		name, parsed := domain.ParseSeriesID(id)
+		assert.Equal(t, id, name)
+		assert.Nil(t, parsed)
+	}
+}
@@ -9,10 +9,17 @@ var ErrInvalidStr = errors.New("invalid string type")
 type MetricType string
 
 const (
-	Gauge   MetricType = "gauge"
-	Counter MetricType = "counter"
+	Gauge     MetricType = "gauge"
+	Counter   MetricType = "counter"
+	Histogram MetricType = "histogram"
+	Summary   MetricType = "summary"
 )
 
+// IsDistribution reports whether metrics of the type carry a distribution instead of a single value.
+func (e MetricType) IsDistribution() bool {
+	return e == Histogram || e == Summary
+}
+
 func (e *MetricType) Scan(value interface{}) error {
 	str, ok := value.(string)
 	if !ok {
@@ -46,6 +53,9 @@ const (
 
 type MetricName string
 
+// MaxNameLength - the longest metric name in bytes, together with MaxLabelsLength it bounds the series IDs.
+const MaxNameLength = 255
+
 // Implement the Stringer interface.
 func (m MetricName) String() string {
 	return string(m)
@@ -81,4 +91,6 @@ const (
 	TotalAlloc    MetricName = "TotalAlloc"
 	RandomValue   MetricName = "RandomValue"
 	PollCount     MetricName = "PollCount"
+	PauseNs       MetricName = "PauseNs"
+	ReportLatency MetricName = "ReportLatency"
 )
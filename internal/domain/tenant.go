@@ -0,0 +1,32 @@
+package domain
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// DefaultTenant owns the metrics of the requests that do not name a tenant.
+const DefaultTenant Tenant = "default"
+
+// tenantPattern is the allowed syntax of tenant names.
+var tenantPattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]{0,63}$`)
+
+// ErrInvalidTenant is returned for a tenant name that does not match the allowed syntax.
+var ErrInvalidTenant = fmt.Errorf("invalid tenant, expected %s", tenantPattern)
+
+// Tenant - the namespace of metrics, every tenant reads and writes its own series only.
+type Tenant string
+
+// Implement the Stringer interface.
+func (t Tenant) String() string {
+	return string(t)
+}
+
+// Validate checks the syntax of the tenant name.
+func (t Tenant) Validate() error {
+	if !tenantPattern.MatchString(string(t)) {
+		return fmt.Errorf("%w: %q", ErrInvalidTenant, string(t))
+	}
+
+	return nil
+}
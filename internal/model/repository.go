@@ -2,11 +2,28 @@ package model
 
 import (
 	"context"
+	"time"
 
 	"github.com/npavlov/go-metrics-service/internal/domain"
 	"github.com/npavlov/go-metrics-service/internal/server/db"
 )
 
+// Batch - the metrics of a write grouped by the way they are merged into their stored series.
+type Batch struct {
+	// Values replace the stored series, see Repository.UpdateMany.
+	Values []db.Metric
+	// Deltas are merged into the stored series, see Repository.ApplyDeltas.
+	Deltas []db.Metric
+	// Changes are gauges added to the stored values.
+	Changes []db.Metric
+}
+
+// Size returns the number of metrics of the batch.
+func (b *Batch) Size() int {
+	return len(b.Values) + len(b.Deltas) + len(b.Changes)
+}
+
+// Repository stores metrics addressed by their series ID, see domain.SeriesID.
 type Repository interface {
 	Get(context context.Context, name domain.MetricName) (*db.Metric, bool)
 	GetMany(context context.Context, names []domain.MetricName) (map[domain.MetricName]db.Metric, error)
@@ -14,4 +31,25 @@ type Repository interface {
 	GetAll(context context.Context) map[domain.MetricName]*db.Metric
 	Update(context context.Context, metric *db.Metric) error
 	UpdateMany(context context.Context, metrics *[]db.Metric) error
+	// ApplyDeltas atomically merges received metrics into their stored series and returns the resulting series,
+	// counters are incremented, gauges are replaced, histograms and summaries are merged, see db.Metric.Merge.
+	ApplyDeltas(context context.Context, metrics []db.Metric) ([]db.Metric, error)
+	// ApplyBatch atomically writes the values, merges the deltas and adds the changes of the batch,
+	// in this order, to their stored series.
+	ApplyBatch(context context.Context, batch *Batch) error
+	// GetRange returns the samples of the series accepted within [from, to], oldest first,
+	// it returns none when the series does not have the given type.
+	GetRange(
+		context context.Context,
+		name domain.MetricName,
+		mType domain.MetricType,
+		from, to time.Time,
+	) ([]db.Sample, error)
+	// Delete removes the series when it has the given type, reports whether it was removed.
+	Delete(context context.Context, name domain.MetricName, mType domain.MetricType) (bool, error)
+	DeleteMany(context context.Context, names []domain.MetricName) ([]domain.MetricName, error)
+	// DeleteStale removes the series last updated before the given time and returns their IDs.
+	DeleteStale(context context.Context, before time.Time) ([]domain.MetricName, error)
+	// Tenants returns the tenants that have metrics, every other method works on the tenant of the context.
+	Tenants(context context.Context) ([]domain.Tenant, error)
 }
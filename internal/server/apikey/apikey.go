@@ -0,0 +1,342 @@
+// Package apikey keeps the registry of the API keys the clients sign their requests with.
+//
+// Every key has an ID sent by the clients in the X-Key-ID header or gRPC metadata, a secret used for the HMAC
+// of the requests, the scopes it grants, an optional subnet its clients must come from and a validity window.
+// Keys are rotated by adding the new key with a validity window overlapping the one of the old key,
+// the registry reloads the key file when it changes.
+//
+// Only the tenants named by the keys of the file are isolated: a request to such a tenant must be signed
+// with a key of the tenant or with an admin key. A request that is not signed with a key may still name
+// any tenant without a key, so every tenant that must be isolated needs a key of its own.
+package apikey
+
+import (
+	"context"
+	"crypto/hmac"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/npavlov/go-metrics-service/internal/domain"
+	"github.com/npavlov/go-metrics-service/internal/server/tenant"
+	"github.com/npavlov/go-metrics-service/internal/utils"
+)
+
+// Header - the HTTP header and the gRPC metadata key naming the key a request is signed with.
+const Header = "X-Key-ID"
+
+// Scope - the operations a key grants.
+type Scope string
+
+const (
+	// ScopeRead grants reading metrics.
+	ScopeRead Scope = "read"
+	// ScopeWrite grants updating metrics.
+	ScopeWrite Scope = "write"
+	// ScopeAdmin grants every operation including deleting metrics.
+	ScopeAdmin Scope = "admin"
+)
+
+var (
+	// ErrInvalidKey is returned for a key file entry without an ID, a secret or with an unknown scope or subnet.
+	ErrInvalidKey = errors.New("invalid key")
+	// ErrUnknownKey is returned for a key ID not in the registry.
+	ErrUnknownKey = errors.New("unknown key")
+	// ErrInactiveKey is returned for a key used outside of its validity window.
+	ErrInactiveKey = errors.New("key is not valid at this time")
+	// ErrInvalidSignature is returned for a request not signed with the secret of its key.
+	ErrInvalidSignature = errors.New("invalid signature")
+	// ErrSourceDenied is returned for a request from outside of the subnet of its key.
+	ErrSourceDenied = errors.New("key is not allowed from this address")
+	// ErrScopeDenied is returned for a request the scopes of its key do not grant.
+	ErrScopeDenied = errors.New("key scope does not allow the request")
+)
+
+// Key - an API key of the registry.
+type Key struct {
+	ID     string  `json:"id"`
+	Secret string  `json:"secret"`
+	Scopes []Scope `json:"scopes"`
+	// Subnet - the CIDR the clients of the key must come from, empty allows any address.
+	Subnet string `json:"subnet,omitempty"`
+	// Tenant - the tenant the requests signed with the key belong to. A key without a tenant belongs to
+	// domain.DefaultTenant, only a key with the admin scope may then name any tenant.
+	Tenant domain.Tenant `json:"tenant,omitempty"`
+	// NotBefore and ExpiresAt bound the validity window of the key, zero values leave it open.
+	NotBefore time.Time `json:"not_before,omitempty"`
+	ExpiresAt time.Time `json:"expires_at,omitempty"`
+
+	network *net.IPNet
+}
+
+// File - the content of the key file.
+type File struct {
+	Keys []Key `json:"keys"`
+}
+
+// Allows reports whether the key grants the scope, the admin scope grants every scope.
+func (k *Key) Allows(scope Scope) bool {
+	for _, granted := range k.Scopes {
+		if granted == scope || granted == ScopeAdmin {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Active reports whether the time is within the validity window of the key.
+func (k *Key) Active(now time.Time) bool {
+	return !now.Before(k.NotBefore) && (k.ExpiresAt.IsZero() || now.Before(k.ExpiresAt))
+}
+
+// Resolve checks the tenant named by the request against the tenant of the key and returns the context
+// carrying the tenant of the request.
+func (k *Key) Resolve(ctx context.Context) (context.Context, error) {
+	if k.Tenant == "" {
+		if named := tenant.FromContext(ctx); named != domain.DefaultTenant && !k.Allows(ScopeAdmin) {
+			return nil, errors.Wrapf(tenant.ErrForbidden, "%s signed by the unbound key %s", named, k.ID)
+		}
+
+		return ctx, nil
+	}
+
+	if named, ok := tenant.Lookup(ctx); ok && named != k.Tenant {
+		return nil, errors.Wrapf(tenant.ErrForbidden, "%s signed by a key of %s", named, k.Tenant)
+	}
+
+	return tenant.WithTenant(ctx, k.Tenant), nil
+}
+
+// Verify checks the signature of the payload made with the secret of the key and returns the expected signature.
+func (k *Key) Verify(payload []byte, signature string) (string, error) {
+	expected := utils.CalculateHash(k.Secret, payload)
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return "", errors.Wrap(ErrInvalidSignature, k.ID)
+	}
+
+	return expected, nil
+}
+
+func (k *Key) validate() error {
+	if k.ID == "" || k.Secret == "" {
+		return errors.Wrap(ErrInvalidKey, "id and secret are required")
+	}
+
+	if len(k.Scopes) == 0 {
+		return errors.Wrapf(ErrInvalidKey, "%s has no scopes", k.ID)
+	}
+
+	for _, scope := range k.Scopes {
+		if scope != ScopeRead && scope != ScopeWrite && scope != ScopeAdmin {
+			return errors.Wrapf(ErrInvalidKey, "%s has unknown scope %q", k.ID, scope)
+		}
+	}
+
+	if k.Tenant != "" {
+		if err := k.Tenant.Validate(); err != nil {
+			return errors.Wrap(err, k.ID)
+		}
+	}
+
+	if k.Subnet != "" {
+		_, network, err := net.ParseCIDR(k.Subnet)
+		if err != nil {
+			return errors.Wrapf(ErrInvalidKey, "%s has invalid subnet: %v", k.ID, err)
+		}
+		k.network = network
+	}
+
+	return nil
+}
+
+type keyContext struct{}
+
+// WithKey returns a context carrying the key the request is authenticated with.
+func WithKey(ctx context.Context, key *Key) context.Context {
+	return context.WithValue(ctx, keyContext{}, key)
+}
+
+// FromContext returns the key the request is authenticated with, false for requests without a key ID.
+func FromContext(ctx context.Context) (*Key, bool) {
+	key, ok := ctx.Value(keyContext{}).(*Key)
+
+	return key, ok
+}
+
+// Registry - the keys of the key file, the file is reloaded on access when it changed since the last check.
+type Registry struct {
+	path     string
+	interval time.Duration
+	log      *zerolog.Logger
+
+	mu        sync.RWMutex
+	keys      map[string]*Key
+	modTime   time.Time
+	checkedAt time.Time
+}
+
+// NewRegistry loads the key file, the file is checked for changes once per interval.
+// The registry is nil for an empty path, the server then uses the shared key only.
+func NewRegistry(path string, interval time.Duration, log *zerolog.Logger) (*Registry, error) {
+	if path == "" {
+		return nil, nil //nolint:nilnil
+	}
+
+	registry := &Registry{
+		path:      path,
+		interval:  interval,
+		log:       log,
+		mu:        sync.RWMutex{},
+		keys:      nil,
+		modTime:   time.Time{},
+		checkedAt: time.Time{},
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to stat key file")
+	}
+
+	if err := registry.load(info.ModTime(), time.Now()); err != nil {
+		return nil, err
+	}
+
+	return registry, nil
+}
+
+// Authenticate verifies the signature of the payload with the key of the ID, see Lookup.
+// It returns the key and the signature of the payload.
+func (r *Registry) Authenticate(id string, payload []byte, signature, source string) (*Key, string, error) {
+	key, err := r.Lookup(id, source)
+	if err != nil {
+		return nil, "", err
+	}
+
+	expected, err := key.Verify(payload, signature)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return key, expected, nil
+}
+
+// Lookup returns the key of the ID after checking its validity window and its subnet against the client address.
+func (r *Registry) Lookup(id, source string) (*Key, error) {
+	now := time.Now()
+	r.refresh(now)
+
+	r.mu.RLock()
+	key, found := r.keys[id]
+	r.mu.RUnlock()
+
+	if !found {
+		return nil, errors.Wrap(ErrUnknownKey, id)
+	}
+
+	if !key.Active(now) {
+		return nil, errors.Wrap(ErrInactiveKey, id)
+	}
+
+	if key.network != nil && !key.network.Contains(net.ParseIP(source)) {
+		return nil, errors.Wrapf(ErrSourceDenied, "%s from %s", id, source)
+	}
+
+	return key, nil
+}
+
+// Protects reports whether keys of the registry are bound to the tenant, its requests must then be authenticated
+// as the tenant. The requests to a tenant without a key are not authenticated, see the package documentation.
+func (r *Registry) Protects(owner domain.Tenant) bool {
+	r.refresh(time.Now())
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, key := range r.keys {
+		if key.Tenant == owner {
+			return true
+		}
+	}
+
+	return false
+}
+
+// refresh reloads the key file when its modification time changed, the current keys are kept on failure.
+func (r *Registry) refresh(now time.Time) {
+	r.mu.RLock()
+	due := now.Sub(r.checkedAt) >= r.interval
+	r.mu.RUnlock()
+
+	if !due {
+		return
+	}
+
+	info, err := os.Stat(r.path)
+	if err != nil {
+		r.log.Error().Err(err).Str("path", r.path).Msg("failed to stat key file, keeping the loaded keys")
+		r.touch(now)
+
+		return
+	}
+
+	r.mu.RLock()
+	changed := !info.ModTime().Equal(r.modTime)
+	r.mu.RUnlock()
+
+	if !changed {
+		r.touch(now)
+
+		return
+	}
+
+	if err := r.load(info.ModTime(), now); err != nil {
+		r.log.Error().Err(err).Str("path", r.path).Msg("failed to reload key file, keeping the loaded keys")
+		r.touch(now)
+
+		return
+	}
+
+	r.log.Info().Str("path", r.path).Msg("key file reloaded")
+}
+
+func (r *Registry) touch(now time.Time) {
+	r.mu.Lock()
+	r.checkedAt = now
+	r.mu.Unlock()
+}
+
+func (r *Registry) load(modTime, now time.Time) error {
+	//nolint:exhaustruct
+	file := &File{}
+	if err := utils.ReadFromFile(r.path, file, r.log); err != nil {
+		return errors.Wrap(err, "failed to read key file")
+	}
+
+	keys := make(map[string]*Key, len(file.Keys))
+	for i := range file.Keys {
+		key := &file.Keys[i]
+		if err := key.validate(); err != nil {
+			return err
+		}
+
+		if _, duplicate := keys[key.ID]; duplicate {
+			return errors.Wrapf(ErrInvalidKey, "duplicate key id %s", key.ID)
+		}
+
+		keys[key.ID] = key
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.keys = keys
+	r.modTime = modTime
+	r.checkedAt = now
+
+	return nil
+}
@@ -0,0 +1,133 @@
+package apikey_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/npavlov/go-metrics-service/internal/domain"
+	"github.com/npavlov/go-metrics-service/internal/server/apikey"
+	testutils "github.com/npavlov/go-metrics-service/internal/test_utils"
+	"github.com/npavlov/go-metrics-service/internal/utils"
+)
+
+func writeKeys(t *testing.T, path, content string, modTime time.Time) {
+	t.Helper()
+
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	require.NoError(t, os.Chtimes(path, modTime, modTime))
+}
+
+func TestRegistry_Authenticate(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "keys.json")
+	past := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	future := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	writeKeys(t, path, `{"keys": [
+		{"id": "old", "secret": "old-secret", "scopes": ["write"], "expires_at": "`+future+`"},
+		{"id": "new", "secret": "new-secret", "scopes": ["write"], "not_before": "`+past+`"},
+		{"id": "expired", "secret": "expired-secret", "scopes": ["read"], "expires_at": "`+past+`"},
+		{"id": "office", "secret": "office-secret", "scopes": ["admin"], "subnet": "10.0.0.0/8"}
+	]}`, time.Now())
+
+	registry, err := apikey.NewRegistry(path, time.Hour, testutils.GetTLogger())
+	require.NoError(t, err)
+
+	payload := []byte(`{"id":"metric"}`)
+
+	// both keys of an overlapping rotation are accepted
+	for id, secret := range map[string]string{"old": "old-secret", "new": "new-secret"} {
+		key, signature, err := registry.Authenticate(id, payload, utils.CalculateHash(secret, payload), "")
+		require.NoError(t, err)
+		assert.Equal(t, id, key.ID)
+		assert.Equal(t, utils.CalculateHash(secret, payload), signature)
+		assert.True(t, key.Allows(apikey.ScopeWrite))
+		assert.False(t, key.Allows(apikey.ScopeAdmin))
+	}
+
+	_, _, err = registry.Authenticate("old", payload, utils.CalculateHash("new-secret", payload), "")
+	require.ErrorIs(t, err, apikey.ErrInvalidSignature)
+
+	_, _, err = registry.Authenticate("missing", payload, "", "")
+	require.ErrorIs(t, err, apikey.ErrUnknownKey)
+
+	_, _, err = registry.Authenticate("expired", payload, utils.CalculateHash("expired-secret", payload), "")
+	require.ErrorIs(t, err, apikey.ErrInactiveKey)
+
+	_, _, err = registry.Authenticate("office", payload, utils.CalculateHash("office-secret", payload), "192.168.1.1")
+	require.ErrorIs(t, err, apikey.ErrSourceDenied)
+
+	key, _, err := registry.Authenticate("office", payload, utils.CalculateHash("office-secret", payload), "10.1.2.3")
+	require.NoError(t, err)
+	assert.True(t, key.Allows(apikey.ScopeRead))
+}
+
+func TestRegistry_Protects(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "keys.json")
+	writeKeys(t, path, `{"keys": [
+		{"id": "team-a", "secret": "team-secret", "scopes": ["read"], "tenant": "team-a"},
+		{"id": "global", "secret": "global-secret", "scopes": ["admin"]}
+	]}`, time.Now())
+
+	registry, err := apikey.NewRegistry(path, time.Hour, testutils.GetTLogger())
+	require.NoError(t, err)
+
+	assert.True(t, registry.Protects("team-a"))
+	assert.False(t, registry.Protects("team-b"))
+	assert.False(t, registry.Protects(domain.DefaultTenant))
+}
+
+func TestRegistry_Reload(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "keys.json")
+	loaded := time.Now().Add(-time.Minute)
+	writeKeys(t, path, `{"keys": [{"id": "first", "secret": "first-secret", "scopes": ["read"]}]}`, loaded)
+
+	registry, err := apikey.NewRegistry(path, 0, testutils.GetTLogger())
+	require.NoError(t, err)
+
+	_, err = registry.Lookup("first", "")
+	require.NoError(t, err)
+
+	writeKeys(t, path, `{"keys": [{"id": "second", "secret": "second-secret", "scopes": ["read"]}]}`, time.Now())
+
+	_, err = registry.Lookup("first", "")
+	require.ErrorIs(t, err, apikey.ErrUnknownKey)
+	_, err = registry.Lookup("second", "")
+	require.NoError(t, err)
+
+	// a broken file keeps the loaded keys
+	writeKeys(t, path, `{"keys": [{"id": "third"}]}`, time.Now().Add(time.Minute))
+
+	_, err = registry.Lookup("second", "")
+	require.NoError(t, err)
+}
+
+func TestNewRegistry_Invalid(t *testing.T) {
+	t.Parallel()
+
+	registry, err := apikey.NewRegistry("", time.Second, testutils.GetTLogger())
+	require.NoError(t, err)
+	assert.Nil(t, registry)
+
+	path := filepath.Join(t.TempDir(), "keys.json")
+	for _, content := range []string{
+		`{"keys": [{"id": "key", "secret": "secret", "scopes": ["delete"]}]}`,
+		`{"keys": [{"id": "key", "secret": "secret", "scopes": ["read"], "subnet": "10.0.0.0"}]}`,
+		`{"keys": [{"id": "key", "secret": "secret", "scopes": []}]}`,
+		`{"keys": [{"id": "key", "secret": "a", "scopes": ["read"]}, {"id": "key", "secret": "b", "scopes": ["read"]}]}`,
+	} {
+		writeKeys(t, path, content, time.Now())
+
+		_, err := apikey.NewRegistry(path, time.Second, testutils.GetTLogger())
+		require.ErrorIs(t, err, apikey.ErrInvalidKey, content)
+	}
+}
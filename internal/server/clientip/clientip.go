@@ -0,0 +1,171 @@
+// Package clientip resolves the address of the clients and filters them by subnets.
+//
+// The address of a client is the peer address of its connection. The X-Forwarded-For and X-Real-IP headers
+// are honored only when the peer is one of the trusted proxies, so the clients cannot spoof their address.
+package clientip
+
+import (
+	"net"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// ForwardedForHeader - the header and the gRPC metadata key the proxies append the client addresses to.
+	ForwardedForHeader = "X-Forwarded-For"
+	// RealIPHeader - the header and the gRPC metadata key the proxies set to the client address.
+	RealIPHeader = "X-Real-IP"
+)
+
+// ErrInvalidSubnet is returned for a subnet that is neither a CIDR nor an IP address.
+var ErrInvalidSubnet = errors.New("invalid subnet")
+
+// Subnets - a list of IPv4 and IPv6 networks.
+type Subnets []*net.IPNet
+
+// ParseSubnets parses the CIDRs, a bare IP address is a network of its own address.
+func ParseSubnets(values []string) (Subnets, error) {
+	subnets := make(Subnets, 0, len(values))
+
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+
+		if !strings.Contains(value, "/") {
+			ip := net.ParseIP(value)
+			if ip == nil {
+				return nil, errors.Wrap(ErrInvalidSubnet, value)
+			}
+
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			subnets = append(subnets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, errors.Wrapf(ErrInvalidSubnet, "%s: %v", value, err)
+		}
+		subnets = append(subnets, network)
+	}
+
+	return subnets, nil
+}
+
+// Contains reports whether the address belongs to one of the networks.
+func (s Subnets) Contains(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+
+	for _, network := range s {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Resolver resolves the client address of the requests.
+type Resolver struct {
+	proxies Subnets
+}
+
+// NewResolver returns the resolver honoring the forwarded headers of the proxies in the subnets.
+func NewResolver(proxies []string) (*Resolver, error) {
+	subnets, err := ParseSubnets(proxies)
+	if err != nil {
+		return nil, errors.Wrap(err, "trusted proxies")
+	}
+
+	return &Resolver{proxies: subnets}, nil
+}
+
+// Resolve returns the client address of a request from the peer address of the connection and the forwarded
+// headers. The X-Forwarded-For addresses are walked from the nearest one, the first address that is not a trusted
+// proxy is the client. A nil resolver trusts no proxy. Peer addresses that are not IP addresses are returned as is.
+func (r *Resolver) Resolve(remoteAddr string, forwardedFor []string, realIP string) string {
+	host := remoteAddr
+	if h, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		host = h
+	}
+
+	peer := net.ParseIP(host)
+	if r == nil || !r.proxies.Contains(peer) {
+		return host
+	}
+
+	hops := make([]net.IP, 0)
+	for _, value := range forwardedFor {
+		for _, hop := range strings.Split(value, ",") {
+			if ip := net.ParseIP(strings.TrimSpace(hop)); ip != nil {
+				hops = append(hops, ip)
+			}
+		}
+	}
+
+	for i := len(hops) - 1; i >= 0; i-- {
+		if !r.proxies.Contains(hops[i]) {
+			return hops[i].String()
+		}
+	}
+
+	// every forwarded address is a proxy, the farthest one is the client
+	if len(hops) > 0 {
+		return hops[0].String()
+	}
+
+	if ip := net.ParseIP(strings.TrimSpace(realIP)); ip != nil {
+		return ip.String()
+	}
+
+	return host
+}
+
+// Filter allows the addresses of its allowed subnets that are not in its denied subnets.
+type Filter struct {
+	allow Subnets
+	deny  Subnets
+}
+
+// NewFilter returns the filter of the subnets, an empty allow list allows every address not denied.
+// The filter is nil when both lists are empty.
+func NewFilter(allow, deny []string) (*Filter, error) {
+	allowed, err := ParseSubnets(allow)
+	if err != nil {
+		return nil, errors.Wrap(err, "trusted subnets")
+	}
+
+	denied, err := ParseSubnets(deny)
+	if err != nil {
+		return nil, errors.Wrap(err, "denied subnets")
+	}
+
+	if len(allowed) == 0 && len(denied) == 0 {
+		return nil, nil //nolint:nilnil
+	}
+
+	return &Filter{allow: allowed, deny: denied}, nil
+}
+
+// Allows reports whether the address passes the filter, a nil filter allows every address.
+func (f *Filter) Allows(address string) bool {
+	if f == nil {
+		return true
+	}
+
+	ip := net.ParseIP(address)
+	if ip == nil || f.deny.Contains(ip) {
+		return false
+	}
+
+	return len(f.allow) == 0 || f.allow.Contains(ip)
+}
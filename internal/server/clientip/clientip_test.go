@@ -0,0 +1,67 @@
+package clientip_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/npavlov/go-metrics-service/internal/server/clientip"
+)
+
+func TestResolver_Resolve(t *testing.T) {
+	t.Parallel()
+
+	resolver, err := clientip.NewResolver([]string{"10.0.0.0/8", "fd00::/8"})
+	require.NoError(t, err)
+
+	// the headers of clients are ignored
+	assert.Equal(t, "203.0.113.7", resolver.Resolve("203.0.113.7:4000", []string{"192.168.1.1"}, "192.168.1.1"))
+
+	// the nearest address that is not a proxy is the client
+	assert.Equal(t, "203.0.113.7", resolver.Resolve("10.0.0.1:4000",
+		[]string{"198.51.100.1, 203.0.113.7", "10.0.0.2"}, "198.51.100.1"))
+	assert.Equal(t, "2001:db8::7", resolver.Resolve("[fd00::1]:4000", []string{"2001:db8::7"}, ""))
+
+	// a chain of proxies only names the farthest one
+	assert.Equal(t, "10.0.0.3", resolver.Resolve("10.0.0.1:4000", []string{"10.0.0.3, 10.0.0.2"}, ""))
+
+	assert.Equal(t, "203.0.113.7", resolver.Resolve("10.0.0.1:4000", nil, "203.0.113.7"))
+	assert.Equal(t, "10.0.0.1", resolver.Resolve("10.0.0.1:4000", []string{"unknown"}, ""))
+	assert.Equal(t, "bufconn", resolver.Resolve("bufconn", nil, "203.0.113.7"))
+
+	var none *clientip.Resolver
+	assert.Equal(t, "10.0.0.1", none.Resolve("10.0.0.1:4000", nil, "203.0.113.7"))
+
+	_, err = clientip.NewResolver([]string{"10.0.0.0/33"})
+	require.ErrorIs(t, err, clientip.ErrInvalidSubnet)
+}
+
+func TestFilter_Allows(t *testing.T) {
+	t.Parallel()
+
+	filter, err := clientip.NewFilter([]string{"192.168.0.0/16", " 2001:db8::/32", ""},
+		[]string{"192.168.6.0/24", "2001:db8::6"})
+	require.NoError(t, err)
+
+	assert.True(t, filter.Allows("192.168.1.1"))
+	assert.True(t, filter.Allows("::ffff:192.168.1.1"))
+	assert.True(t, filter.Allows("2001:db8::1"))
+	assert.False(t, filter.Allows("192.168.6.1"))
+	assert.False(t, filter.Allows("2001:db8::6"))
+	assert.False(t, filter.Allows("10.0.0.1"))
+	assert.False(t, filter.Allows("bufconn"))
+
+	denyOnly, err := clientip.NewFilter(nil, []string{"10.0.0.0/8"})
+	require.NoError(t, err)
+	assert.True(t, denyOnly.Allows("192.168.1.1"))
+	assert.False(t, denyOnly.Allows("10.1.1.1"))
+
+	none, err := clientip.NewFilter([]string{""}, nil)
+	require.NoError(t, err)
+	assert.Nil(t, none)
+	assert.True(t, none.Allows("10.1.1.1"))
+
+	_, err = clientip.NewFilter([]string{"111"}, nil)
+	require.ErrorIs(t, err, clientip.ErrInvalidSubnet)
+}
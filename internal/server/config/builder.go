@@ -3,6 +3,7 @@ package config
 
 import (
 	"flag"
+	"strings"
 	"time"
 
 	"github.com/caarlos0/env/v6"
@@ -27,6 +28,80 @@ type Config struct {
 	TrustedSubnet    string `env:"TRUSTED_SUBNET"        envDefault:""         json:"trusted_subnet"`
 	Config           string `env:"CONFIG_SERVER"         envDefault:""`
 	HealthCheckDur   time.Duration
+	// UseWAL logs every write ahead of the snapshot, the snapshot is then rewritten on the store interval only.
+	UseWAL bool `env:"USE_WAL" envDefault:"true" json:"use_wal"`
+	// WALMaxSize - the size of the WAL in bytes that triggers a snapshot in synchronous mode.
+	WALMaxSize int64 `env:"WAL_MAX_SIZE" envDefault:"67108864" json:"wal_max_size"`
+	// SnapshotCompression - none, gzip or zstd.
+	SnapshotCompression string `env:"SNAPSHOT_COMPRESSION" envDefault:"gzip" json:"snapshot_compression"`
+	// SnapshotKeep - the number of previous snapshots kept to fall back to when the newest one is corrupt.
+	SnapshotKeep int `env:"SNAPSHOT_KEEP" envDefault:"3" json:"snapshot_keep"`
+	// MaxSeries - the limit of stored series, 0 disables the limit.
+	MaxSeries int `env:"MAX_SERIES" envDefault:"0" json:"max_series"`
+	// MaxSeriesPerSource - the limit of series created by one client address, 0 disables the limit.
+	MaxSeriesPerSource int `env:"MAX_SERIES_PER_SOURCE" envDefault:"0" json:"max_series_per_source"`
+	// MetricNamePattern - the regular expression every metric name must match, empty allows any name.
+	MetricNamePattern string `env:"METRIC_NAME_PATTERN" envDefault:"" json:"metric_name_pattern"`
+	// MetricAllow - globs of the allowed metric names, empty allows any name.
+	MetricAllow []string `env:"METRIC_ALLOW" envSeparator:"," json:"metric_allow"`
+	// MetricDeny - globs of the denied metric names.
+	MetricDeny []string `env:"METRIC_DENY" envSeparator:"," json:"metric_deny"`
+	// StaleTTL - seconds without an update after which a series is reported stale, 0 disables staleness.
+	StaleTTL    int64 `env:"STALE_TTL" envDefault:"0" json:"stale_ttl"`
+	StaleTTLDur time.Duration
+	// EvictTTL - seconds without an update after which a series is removed, 0 disables eviction.
+	EvictTTL    int64 `env:"EVICT_TTL" envDefault:"0" json:"evict_ttl"`
+	EvictTTLDur time.Duration
+	// TenantKeys - signing keys of the tenants in the tenant:key form, a request signed with one belongs to its tenant.
+	// Unsigned requests may name any tenant without a key, every tenant to isolate needs a key.
+	TenantKeys []string `env:"TENANT_KEYS" envSeparator:"," json:"tenant_keys"`
+	// KeyFile - the JSON file of the API keys with their IDs, scopes, subnets, tenants and validity windows.
+	// Unsigned requests may name any tenant no key is bound to, every tenant to isolate needs a key.
+	KeyFile string `env:"KEY_FILE" envDefault:"" json:"key_file"`
+	// KeyReload - seconds between the checks of the key file for changes.
+	KeyReload    int64 `env:"KEY_RELOAD_INTERVAL" envDefault:"10" json:"key_reload_interval"`
+	KeyReloadDur time.Duration
+	// SignatureSkew - seconds a signed request may be older or newer than the server clock,
+	// 0 disables the replay protection and accepts the body only signatures of older agents.
+	SignatureSkew    int64 `env:"SIGNATURE_SKEW" envDefault:"300" json:"signature_skew"`
+	SignatureSkewDur time.Duration
+	// NonceCacheSize - the number of nonces of signed requests remembered within the skew window.
+	NonceCacheSize int `env:"NONCE_CACHE_SIZE" envDefault:"100000" json:"nonce_cache_size"`
+	// CryptoLegacy - accept the messages of agents encrypting with the legacy format next to the envelopes.
+	CryptoLegacy bool `env:"CRYPTO_LEGACY" envDefault:"true" json:"crypto_legacy"`
+	// TLSCert and TLSKey - the PEM certificate and key the HTTP, gRPC and gateway servers use, empty for plain text.
+	TLSCert string `env:"TLS_CERT" envDefault:"" json:"tls_cert"`
+	TLSKey  string `env:"TLS_KEY"  envDefault:"" json:"tls_key"`
+	// TLSClientCA - the CA of the client certificates, set to require mutual TLS.
+	// A verified client certificate replaces the trusted subnet check.
+	TLSClientCA string `env:"TLS_CLIENT_CA" envDefault:"" json:"tls_client_ca"`
+	// TLSClientNames - the common or DNS names of the allowed client certificates, empty allows any of the CA.
+	TLSClientNames []string `env:"TLS_CLIENT_NAMES" envSeparator:"," json:"tls_client_names"`
+	// TLSCA - the CA of the server certificate the gateway verifies when dialing the gRPC server,
+	// the system roots are used when empty.
+	TLSCA string `env:"TLS_CA" envDefault:"" json:"tls_ca"`
+	// GatewayTLSCert and GatewayTLSKey - the PEM client certificate and key the gateway presents to the gRPC server,
+	// required with mutual TLS. Its name must be allowed by TLSClientNames and not be used by other clients,
+	// the server trusts the caller address and identity the gateway forwards.
+	GatewayTLSCert string `env:"GATEWAY_TLS_CERT" envDefault:"" json:"gateway_tls_cert"`
+	GatewayTLSKey  string `env:"GATEWAY_TLS_KEY"  envDefault:"" json:"gateway_tls_key"`
+	// DeniedSubnets - the IPv4 and IPv6 CIDRs the clients are rejected from, they take precedence over TrustedSubnet
+	// that accepts a comma separated list of CIDRs too.
+	DeniedSubnets []string `env:"DENIED_SUBNETS" envSeparator:"," json:"denied_subnets"`
+	// TrustedProxies - the CIDRs of the proxies whose X-Forwarded-For and X-Real-IP headers name the client,
+	// the client address is the peer address of the connection otherwise.
+	TrustedProxies []string `env:"TRUSTED_PROXIES" envSeparator:"," json:"trusted_proxies"`
+	// StatsDAddress - the UDP and TCP address of the StatsD listener, empty disables it.
+	StatsDAddress string `env:"STATSD_ADDRESS" envDefault:"" json:"statsd_address"`
+	// StatsDFlush - seconds the StatsD samples are aggregated for before they are written.
+	StatsDFlush    int64 `env:"STATSD_FLUSH_INTERVAL" envDefault:"10" json:"statsd_flush_interval"`
+	StatsDFlushDur time.Duration
+	// OTLPAddress - the address of the OTLP/HTTP receiver serving POST /v1/metrics, e.g. :4318, empty disables it.
+	OTLPAddress string `env:"OTLP_ADDRESS" envDefault:"" json:"otlp_address"`
+	// OTLPResourceLabels - the OTLP resource attributes kept as labels, every attribute is kept when empty.
+	OTLPResourceLabels []string `env:"OTLP_RESOURCE_LABELS" envDefault:"service.name,service.namespace,service.instance.id,host.name" envSeparator:"," json:"otlp_resource_labels"` //nolint:lll
+	// OTLPServicePrefix - prefix the OTLP metric names with the service namespace and name instead of labeling them.
+	OTLPServicePrefix bool `env:"OTLP_SERVICE_PREFIX" envDefault:"false" json:"otlp_service_prefix"`
 }
 
 // Builder defines the builder for the Config struct.
@@ -39,21 +114,57 @@ type Builder struct {
 func NewConfigBuilder(log *zerolog.Logger) *Builder {
 	return &Builder{
 		cfg: &Config{
-			Address:          "",
-			GRPCAddress:      "",
-			GRPCGateway:      "",
-			StoreInterval:    0,
-			File:             "",
-			RestoreStorage:   false,
-			StoreIntervalDur: 0,
-			Database:         "",
-			HealthCheck:      0,
-			HealthCheckDur:   0,
-			Key:              "",
-			CryptoKey:        "",
-			Config:           "",
-			TrustedSubnet:    "",
-			UseGRPC:          false,
+			Address:             "",
+			GRPCAddress:         "",
+			GRPCGateway:         "",
+			StoreInterval:       0,
+			File:                "",
+			RestoreStorage:      false,
+			StoreIntervalDur:    0,
+			Database:            "",
+			HealthCheck:         0,
+			HealthCheckDur:      0,
+			Key:                 "",
+			CryptoKey:           "",
+			Config:              "",
+			TrustedSubnet:       "",
+			UseGRPC:             false,
+			UseWAL:              false,
+			WALMaxSize:          0,
+			SnapshotCompression: "",
+			SnapshotKeep:        0,
+			MaxSeries:           0,
+			MaxSeriesPerSource:  0,
+			MetricNamePattern:   "",
+			MetricAllow:         nil,
+			MetricDeny:          nil,
+			StaleTTL:            0,
+			StaleTTLDur:         0,
+			EvictTTL:            0,
+			EvictTTLDur:         0,
+			TenantKeys:          nil,
+			KeyFile:             "",
+			KeyReload:           0,
+			KeyReloadDur:        0,
+			SignatureSkew:       0,
+			SignatureSkewDur:    0,
+			NonceCacheSize:      0,
+			CryptoLegacy:        false,
+			TLSCert:             "",
+			TLSKey:              "",
+			TLSClientCA:         "",
+			TLSClientNames:      nil,
+			TLSCA:               "",
+			GatewayTLSCert:      "",
+			GatewayTLSKey:       "",
+			DeniedSubnets:       nil,
+			TrustedProxies:      nil,
+			StatsDAddress:       "",
+			StatsDFlush:         0,
+			StatsDFlushDur:      0,
+			OTLPAddress:         "",
+			OTLPResourceLabels:  nil,
+			OTLPServicePrefix:   false,
 		},
 		logger: log,
 	}
@@ -75,13 +186,89 @@ func (b *Builder) FromFlags() *Builder {
 	flag.StringVar(&b.cfg.GRPCGateway, "grpcgw", b.cfg.GRPCGateway, "address and port to run GRPC Gateway")
 	flag.BoolVar(&b.cfg.RestoreStorage, "r", b.cfg.RestoreStorage, "restore previous session")
 	flag.StringVar(&b.cfg.File, "f", b.cfg.File, "file where to store mem storage")
-	flag.StringVar(&b.cfg.Database, "d", b.cfg.Database, "database DSN")
+	flag.StringVar(&b.cfg.Database, "d", b.cfg.Database, "database DSN, sqlite://path.db selects the embedded SQLite")
 	flag.Int64Var(&b.cfg.StoreInterval, "i", b.cfg.StoreInterval, "time flushing mem storage to file (in seconds)")
 	flag.StringVar(&b.cfg.Key, "k", b.cfg.Key, "key to sign request")
 	flag.StringVar(&b.cfg.CryptoKey, "crypto-key", b.cfg.CryptoKey, "crypto key to sign request")
-	flag.StringVar(&b.cfg.TrustedSubnet, "t", b.cfg.TrustedSubnet, "trusted subnet")
+	flag.StringVar(&b.cfg.TrustedSubnet, "t", b.cfg.TrustedSubnet, "comma separated trusted subnets")
 	flag.StringVar(&b.cfg.Config, "config", b.cfg.Config, "path to config file")
 	flag.BoolVar(&b.cfg.UseGRPC, "use-grpc", b.cfg.UseGRPC, "use gRPC for workers")
+	flag.BoolVar(&b.cfg.UseWAL, "wal", b.cfg.UseWAL, "log writes ahead of the file snapshot")
+	flag.Int64Var(&b.cfg.WALMaxSize, "wal-max-size", b.cfg.WALMaxSize, "WAL size in bytes triggering a snapshot")
+	flag.StringVar(&b.cfg.SnapshotCompression, "snapshot-compression", b.cfg.SnapshotCompression,
+		"snapshot compression: none, gzip or zstd")
+	flag.IntVar(&b.cfg.SnapshotKeep, "snapshot-keep", b.cfg.SnapshotKeep, "number of previous snapshots to keep")
+	flag.IntVar(&b.cfg.MaxSeries, "max-series", b.cfg.MaxSeries, "limit of stored series, 0 for no limit")
+	flag.IntVar(&b.cfg.MaxSeriesPerSource, "max-series-per-source", b.cfg.MaxSeriesPerSource,
+		"limit of series created by one client address, 0 for no limit")
+	flag.StringVar(&b.cfg.MetricNamePattern, "metric-name-pattern", b.cfg.MetricNamePattern,
+		"regular expression metric names must match")
+	flag.Func("metric-allow", "comma separated globs of allowed metric names", func(value string) error {
+		b.cfg.MetricAllow = splitList(value)
+
+		return nil
+	})
+	flag.Func("metric-deny", "comma separated globs of denied metric names", func(value string) error {
+		b.cfg.MetricDeny = splitList(value)
+
+		return nil
+	})
+	flag.Int64Var(&b.cfg.StaleTTL, "stale-ttl", b.cfg.StaleTTL,
+		"seconds without an update after which a series is stale, 0 to disable")
+	flag.Int64Var(&b.cfg.EvictTTL, "evict-ttl", b.cfg.EvictTTL,
+		"seconds without an update after which a series is removed, 0 to disable")
+	flag.Func("tenant-keys", "comma separated signing keys of the tenants in the tenant:key form, "+
+		"unsigned requests may name any tenant without a key", func(value string) error {
+		b.cfg.TenantKeys = splitList(value)
+
+		return nil
+	})
+	flag.StringVar(&b.cfg.KeyFile, "key-file", b.cfg.KeyFile,
+		"JSON file of the API keys, unsigned requests may name any tenant no key is bound to")
+	flag.Int64Var(&b.cfg.KeyReload, "key-reload-interval", b.cfg.KeyReload,
+		"seconds between the checks of the key file for changes")
+	flag.Int64Var(&b.cfg.SignatureSkew, "signature-skew", b.cfg.SignatureSkew,
+		"seconds a signed request may differ from the server clock, 0 disables the replay protection")
+	flag.IntVar(&b.cfg.NonceCacheSize, "nonce-cache-size", b.cfg.NonceCacheSize,
+		"number of nonces of signed requests remembered")
+	flag.BoolVar(&b.cfg.CryptoLegacy, "crypto-legacy", b.cfg.CryptoLegacy,
+		"accept the messages encrypted with the legacy format")
+	flag.StringVar(&b.cfg.TLSCert, "tls-cert", b.cfg.TLSCert, "PEM certificate of the servers")
+	flag.StringVar(&b.cfg.TLSKey, "tls-key", b.cfg.TLSKey, "PEM key of the servers")
+	flag.StringVar(&b.cfg.TLSClientCA, "tls-client-ca", b.cfg.TLSClientCA, "CA of the client certificates for mutual TLS")
+	flag.Func("tls-client-names", "comma separated names of the allowed client certificates", func(value string) error {
+		b.cfg.TLSClientNames = splitList(value)
+
+		return nil
+	})
+	flag.StringVar(&b.cfg.TLSCA, "tls-ca", b.cfg.TLSCA, "CA of the server certificate for the gateway")
+	flag.StringVar(&b.cfg.GatewayTLSCert, "gateway-tls-cert", b.cfg.GatewayTLSCert,
+		"PEM client certificate of the gateway for mutual TLS")
+	flag.StringVar(&b.cfg.GatewayTLSKey, "gateway-tls-key", b.cfg.GatewayTLSKey,
+		"PEM client key of the gateway for mutual TLS")
+	flag.Func("denied-subnets", "comma separated subnets the clients are rejected from", func(value string) error {
+		b.cfg.DeniedSubnets = splitList(value)
+
+		return nil
+	})
+	flag.Func("trusted-proxies", "comma separated subnets of the proxies naming the client", func(value string) error {
+		b.cfg.TrustedProxies = splitList(value)
+
+		return nil
+	})
+	flag.StringVar(&b.cfg.StatsDAddress, "statsd-address", b.cfg.StatsDAddress,
+		"UDP and TCP address of the StatsD listener, empty to disable")
+	flag.Int64Var(&b.cfg.StatsDFlush, "statsd-flush-interval", b.cfg.StatsDFlush,
+		"seconds the StatsD samples are aggregated for")
+	flag.StringVar(&b.cfg.OTLPAddress, "otlp-address", b.cfg.OTLPAddress,
+		"address of the OTLP/HTTP receiver, empty to disable")
+	flag.Func("otlp-resource-labels", "comma separated OTLP resource attributes kept as labels", func(value string) error {
+		b.cfg.OTLPResourceLabels = splitList(value)
+
+		return nil
+	})
+	flag.BoolVar(&b.cfg.OTLPServicePrefix, "otlp-service-prefix", b.cfg.OTLPServicePrefix,
+		"prefix the OTLP metric names with the service name")
 	flag.Parse()
 
 	return b
@@ -112,6 +299,23 @@ func (b *Builder) FromFile() *Builder {
 func (b *Builder) Build() *Config {
 	b.cfg.StoreIntervalDur = time.Duration(b.cfg.StoreInterval) * time.Second
 	b.cfg.HealthCheckDur = time.Duration(b.cfg.HealthCheck) * time.Second
+	b.cfg.StaleTTLDur = time.Duration(b.cfg.StaleTTL) * time.Second
+	b.cfg.EvictTTLDur = time.Duration(b.cfg.EvictTTL) * time.Second
+	b.cfg.KeyReloadDur = time.Duration(b.cfg.KeyReload) * time.Second
+	b.cfg.SignatureSkewDur = time.Duration(b.cfg.SignatureSkew) * time.Second
+	b.cfg.StatsDFlushDur = time.Duration(b.cfg.StatsDFlush) * time.Second
 
 	return b.cfg
 }
+
+// splitList splits a comma separated flag value, empty items are skipped.
+func splitList(value string) []string {
+	items := make([]string, 0)
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
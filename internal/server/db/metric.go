@@ -2,6 +2,9 @@ package db
 
 import (
 	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
 
 	"github.com/npavlov/go-metrics-service/internal/domain"
 )
@@ -9,7 +12,19 @@ import (
 type Metric struct {
 	CounterMetric
 	GaugeMetric
+	HistogramMetric
+	SummaryMetric
 	MtrMetric
+	Labels domain.Labels `json:"labels,omitempty"`
+	// Stale is set on read for a series not updated within the staleness TTL
+	Stale bool `json:"stale,omitempty"`
+}
+
+// Sample - a single timestamped value accepted for a metric.
+type Sample struct {
+	Delta     *int64    `json:"delta,omitempty"`
+	Value     *float64  `json:"value,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
 }
 
 func NewMetric(id domain.MetricName, mType domain.MetricType, delta *int64, value *float64) *Metric {
@@ -17,18 +32,88 @@ func NewMetric(id domain.MetricName, mType domain.MetricType, delta *int64, valu
 		CounterMetric: CounterMetric{
 			Delta:    delta,
 			MetricID: "",
+			Tenant:   "",
 		},
 		GaugeMetric: GaugeMetric{
 			Value:    value,
 			MetricID: "",
+			Tenant:   "",
+		},
+		HistogramMetric: HistogramMetric{
+			Histogram: nil,
+			MetricID:  "",
+			Tenant:    "",
+		},
+		SummaryMetric: SummaryMetric{
+			Summary:  nil,
+			MetricID: "",
+			Tenant:   "",
 		},
 		MtrMetric: MtrMetric{
-			ID:    id,
-			MType: mType,
+			ID:        id,
+			MType:     mType,
+			UpdatedAt: nil,
+			Tenant:    "",
 		},
+		Labels: nil,
+		Stale:  false,
 	}
 }
 
+// NewHistogramMetric - constructor for a histogram metric.
+func NewHistogramMetric(id domain.MetricName, histogram *domain.HistogramData) *Metric {
+	metric := NewMetric(id, domain.Histogram, nil, nil)
+	metric.Histogram = histogram
+
+	return metric
+}
+
+// NewSummaryMetric - constructor for a summary metric.
+func NewSummaryMetric(id domain.MetricName, summary *domain.SummaryData) *Metric {
+	metric := NewMetric(id, domain.Summary, nil, nil)
+	metric.Summary = summary
+
+	return metric
+}
+
+// WithLabels sets the labels of the metric.
+func (m *Metric) WithLabels(labels domain.Labels) *Metric {
+	m.Labels = labels
+
+	return m
+}
+
+// Clone - returns a copy of the metric that shares no distribution with the original.
+func (m *Metric) Clone() *Metric {
+	clone := *m
+
+	if m.Histogram != nil {
+		clone.Histogram = m.Histogram.Clone()
+	}
+
+	if m.Summary != nil {
+		clone.Summary = m.Summary.Clone()
+	}
+
+	return &clone
+}
+
+// Touch - records the time of the write of the metric, a written metric is not stale.
+func (m *Metric) Touch(now time.Time) {
+	m.UpdatedAt = &now
+	m.Stale = false
+}
+
+// IsStale - reports whether the metric was last updated before the given time, a metric never written is not.
+func (m *Metric) IsStale(before time.Time) bool {
+	return m.UpdatedAt != nil && m.UpdatedAt.Before(before)
+}
+
+// SeriesID - the identifier of the series of the metric, its name followed by its labels.
+func (m *Metric) SeriesID() domain.MetricName {
+	return domain.SeriesID(m.ID, m.Labels)
+}
+
 func (m *Metric) FromFields(id domain.MetricName, mType domain.MetricType, delta *int64, value *float64) {
 	m.MtrMetric.ID = id
 	m.MType = mType
@@ -63,6 +148,72 @@ func (m *Metric) SetValue(delta *int64, value *float64) {
 	}
 }
 
+// Merge - applies a newly received metric of the same series, see SetValue for counters and gauges.
+// Histograms with the same buckets are added up, a summary takes the latest quantiles and accumulates sum and count.
+func (m *Metric) Merge(newMetric *Metric) {
+	switch m.MType {
+	case domain.Histogram:
+		if newMetric.Histogram == nil {
+			return
+		}
+
+		if m.Histogram == nil {
+			m.Histogram = newMetric.Histogram.Clone()
+
+			return
+		}
+
+		m.Histogram.Merge(newMetric.Histogram)
+	case domain.Summary:
+		if newMetric.Summary == nil {
+			return
+		}
+
+		if m.Summary == nil {
+			m.Summary = newMetric.Summary.Clone()
+
+			return
+		}
+
+		m.Summary.Merge(newMetric.Summary)
+	case domain.Counter, domain.Gauge:
+		m.SetValue(newMetric.Delta, newMetric.Value)
+	}
+}
+
+// ValidateDistribution - checks the histogram or summary of a distribution metric.
+func (m *Metric) ValidateDistribution() error {
+	if m.Histogram != nil {
+		if err := m.Histogram.Validate(); err != nil {
+			return errors.Wrap(err, "invalid histogram")
+		}
+	}
+
+	if m.Summary != nil {
+		if err := m.Summary.Validate(); err != nil {
+			return errors.Wrap(err, "invalid summary")
+		}
+	}
+
+	return nil
+}
+
+// HasValue - reports whether the metric carries the value of its type.
+func (m *Metric) HasValue() bool {
+	switch m.MType {
+	case domain.Histogram:
+		return m.Histogram != nil
+	case domain.Summary:
+		return m.Summary != nil
+	case domain.Counter:
+		return m.Delta != nil
+	case domain.Gauge:
+		return m.Value != nil
+	}
+
+	return false
+}
+
 // GetValue - the method that gets value for dedicated type.
 func (m *Metric) GetValue() string {
 	if m.MType == domain.Gauge {
@@ -73,5 +224,13 @@ func (m *Metric) GetValue() string {
 		return strconv.FormatInt(*m.Delta, 10)
 	}
 
+	if m.MType == domain.Histogram && m.Histogram != nil {
+		return m.Histogram.String()
+	}
+
+	if m.MType == domain.Summary && m.Summary != nil {
+		return m.Summary.String()
+	}
+
 	return ""
 }
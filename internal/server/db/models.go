@@ -7,6 +7,7 @@ package db
 import (
 	"database/sql/driver"
 	"fmt"
+	"time"
 
 	domain "github.com/npavlov/go-metrics-service/internal/domain"
 )
@@ -14,8 +15,10 @@ import (
 type MetricType string
 
 const (
-	MetricTypeGauge   MetricType = "gauge"
-	MetricTypeCounter MetricType = "counter"
+	MetricTypeGauge     MetricType = "gauge"
+	MetricTypeCounter   MetricType = "counter"
+	MetricTypeHistogram MetricType = "histogram"
+	MetricTypeSummary   MetricType = "summary"
 )
 
 func (e *MetricType) Scan(src interface{}) error {
@@ -56,14 +59,51 @@ func (ns NullMetricType) Value() (driver.Value, error) {
 type CounterMetric struct {
 	MetricID domain.MetricName `db:"metric_id" json:"-"`
 	Delta    *int64            `db:"delta" json:"delta"`
+	Tenant   domain.Tenant     `db:"tenant" json:"-"`
+}
+
+type CounterSample struct {
+	MetricID  domain.MetricName `db:"metric_id" json:"-"`
+	Delta     *int64            `db:"delta" json:"delta"`
+	CreatedAt time.Time         `db:"created_at"`
+	Tenant    domain.Tenant     `db:"tenant" json:"-"`
 }
 
 type GaugeMetric struct {
 	MetricID domain.MetricName `db:"metric_id" json:"-"`
 	Value    *float64          `db:"value" json:"value"`
+	Tenant   domain.Tenant     `db:"tenant" json:"-"`
+}
+
+type GaugeSample struct {
+	MetricID  domain.MetricName `db:"metric_id" json:"-"`
+	Value     *float64          `db:"value" json:"value"`
+	CreatedAt time.Time         `db:"created_at"`
+	Tenant    domain.Tenant     `db:"tenant" json:"-"`
+}
+
+type HistogramMetric struct {
+	MetricID  domain.MetricName     `db:"metric_id" json:"-"`
+	Histogram *domain.HistogramData `db:"histogram" json:"histogram,omitempty"`
+	Tenant    domain.Tenant         `db:"tenant" json:"-"`
+}
+
+type MetricLabel struct {
+	MetricID domain.MetricName  `db:"metric_id" json:"-"`
+	Name     *domain.MetricName `db:"name" json:"name"`
+	Labels   domain.Labels      `db:"labels" json:"labels"`
+	Tenant   domain.Tenant      `db:"tenant" json:"-"`
 }
 
 type MtrMetric struct {
-	ID    domain.MetricName `db:"id" json:"id" validate:"required"`
-	MType domain.MetricType `db:"type" json:"type" validate:"required,oneof=counter gauge"`
+	ID        domain.MetricName `db:"id" json:"id" validate:"required"`
+	MType     domain.MetricType `db:"type" json:"type" validate:"required,oneof=counter gauge histogram summary"`
+	UpdatedAt *time.Time        `db:"updated_at" json:"updated_at,omitempty"`
+	Tenant    domain.Tenant     `db:"tenant" json:"-"`
+}
+
+type SummaryMetric struct {
+	MetricID domain.MetricName   `db:"metric_id" json:"-"`
+	Summary  *domain.SummaryData `db:"summary" json:"summary,omitempty"`
+	Tenant   domain.Tenant       `db:"tenant" json:"-"`
 }
@@ -7,29 +7,376 @@ package db
 
 import (
 	"context"
+	"time"
 
 	domain "github.com/npavlov/go-metrics-service/internal/domain"
 )
 
+const BulkIncrementCounterMetrics = `-- name: BulkIncrementCounterMetrics :exec
+INSERT INTO counter_metrics (tenant, metric_id, delta)
+SELECT $1::text,
+       unnest($2::text[]),
+       unnest($3::bigint[])
+ON CONFLICT (tenant, metric_id) DO UPDATE
+    SET delta = counter_metrics.delta + EXCLUDED.delta
+`
+
+type BulkIncrementCounterMetricsParams struct {
+	Tenant string   `db:"tenant"`
+	Ids    []string `db:"ids"`
+	Deltas []int64  `db:"deltas"`
+}
+
+// Adds the deltas to the stored counters, concurrent increments of a counter never overwrite each other
+func (q *Queries) BulkIncrementCounterMetrics(ctx context.Context, arg BulkIncrementCounterMetricsParams) error {
+	_, err := q.db.Exec(ctx, BulkIncrementCounterMetrics, arg.Tenant, arg.Ids, arg.Deltas)
+	return err
+}
+
+const BulkIncrementGaugeMetrics = `-- name: BulkIncrementGaugeMetrics :exec
+INSERT INTO gauge_metrics (tenant, metric_id, value)
+SELECT $1::text,
+       unnest($2::text[]),
+       unnest($3::double precision[])
+ON CONFLICT (tenant, metric_id) DO UPDATE
+    SET value = gauge_metrics.value + EXCLUDED.value
+`
+
+type BulkIncrementGaugeMetricsParams struct {
+	Tenant string    `db:"tenant"`
+	Ids    []string  `db:"ids"`
+	Vals   []float64 `db:"vals"`
+}
+
+// Adds the changes to the stored gauges, concurrent changes of a gauge never overwrite each other
+func (q *Queries) BulkIncrementGaugeMetrics(ctx context.Context, arg BulkIncrementGaugeMetricsParams) error {
+	_, err := q.db.Exec(ctx, BulkIncrementGaugeMetrics, arg.Tenant, arg.Ids, arg.Vals)
+	return err
+}
+
+const BulkInsertCounterSamples = `-- name: BulkInsertCounterSamples :exec
+INSERT INTO counter_samples (tenant, metric_id, delta)
+SELECT $1::text,
+       unnest($2::text[]),
+       unnest($3::bigint[])
+`
+
+type BulkInsertCounterSamplesParams struct {
+	Tenant string   `db:"tenant"`
+	Ids    []string `db:"ids"`
+	Deltas []int64  `db:"deltas"`
+}
+
+func (q *Queries) BulkInsertCounterSamples(ctx context.Context, arg BulkInsertCounterSamplesParams) error {
+	_, err := q.db.Exec(ctx, BulkInsertCounterSamples, arg.Tenant, arg.Ids, arg.Deltas)
+	return err
+}
+
+const BulkInsertCounterTotals = `-- name: BulkInsertCounterTotals :exec
+INSERT INTO counter_samples (tenant, metric_id, delta)
+SELECT c.tenant, c.metric_id, c.delta
+FROM counter_metrics AS c
+WHERE c.tenant = $1
+  AND c.metric_id = ANY($2::text[])
+`
+
+type BulkInsertCounterTotalsParams struct {
+	Tenant domain.Tenant `db:"tenant" json:"-"`
+	Ids    []string      `db:"ids"`
+}
+
+// Records the incremented totals of the counters as their samples
+func (q *Queries) BulkInsertCounterTotals(ctx context.Context, arg BulkInsertCounterTotalsParams) error {
+	_, err := q.db.Exec(ctx, BulkInsertCounterTotals, arg.Tenant, arg.Ids)
+	return err
+}
+
+const BulkInsertGaugeSamples = `-- name: BulkInsertGaugeSamples :exec
+INSERT INTO gauge_samples (tenant, metric_id, value)
+SELECT $1::text,
+       unnest($2::text[]),
+       unnest($3::double precision[])
+`
+
+type BulkInsertGaugeSamplesParams struct {
+	Tenant string    `db:"tenant"`
+	Ids    []string  `db:"ids"`
+	Vals   []float64 `db:"vals"`
+}
+
+func (q *Queries) BulkInsertGaugeSamples(ctx context.Context, arg BulkInsertGaugeSamplesParams) error {
+	_, err := q.db.Exec(ctx, BulkInsertGaugeSamples, arg.Tenant, arg.Ids, arg.Vals)
+	return err
+}
+
+const BulkInsertGaugeTotals = `-- name: BulkInsertGaugeTotals :exec
+INSERT INTO gauge_samples (tenant, metric_id, value)
+SELECT g.tenant, g.metric_id, g.value
+FROM gauge_metrics AS g
+WHERE g.tenant = $1
+  AND g.metric_id = ANY($2::text[])
+`
+
+type BulkInsertGaugeTotalsParams struct {
+	Tenant domain.Tenant `db:"tenant" json:"-"`
+	Ids    []string      `db:"ids"`
+}
+
+// Records the changed values of the gauges as their samples
+func (q *Queries) BulkInsertGaugeTotals(ctx context.Context, arg BulkInsertGaugeTotalsParams) error {
+	_, err := q.db.Exec(ctx, BulkInsertGaugeTotals, arg.Tenant, arg.Ids)
+	return err
+}
+
+const BulkInsertMetricLabels = `-- name: BulkInsertMetricLabels :exec
+INSERT INTO metric_labels (tenant, metric_id, name, labels)
+SELECT $1::text,
+       unnest($2::text[]),
+       unnest($3::text[]),
+       unnest($4::text[]::jsonb[])
+ON CONFLICT (tenant, metric_id) DO NOTHING
+`
+
+type BulkInsertMetricLabelsParams struct {
+	Tenant string   `db:"tenant"`
+	Ids    []string `db:"ids"`
+	Names  []string `db:"names"`
+	Labels []string `db:"labels"`
+}
+
+func (q *Queries) BulkInsertMetricLabels(ctx context.Context, arg BulkInsertMetricLabelsParams) error {
+	_, err := q.db.Exec(ctx, BulkInsertMetricLabels,
+		arg.Tenant,
+		arg.Ids,
+		arg.Names,
+		arg.Labels,
+	)
+	return err
+}
+
+const BulkInsertMtrMetrics = `-- name: BulkInsertMtrMetrics :exec
+INSERT INTO mtr_metrics (tenant, id, type)
+SELECT $1::text,
+       unnest($2::text[]),
+       unnest($3::text[]::metric_type[])
+ON CONFLICT (tenant, id, type) DO UPDATE
+    SET updated_at = now()
+`
+
+type BulkInsertMtrMetricsParams struct {
+	Tenant string   `db:"tenant"`
+	Ids    []string `db:"ids"`
+	Types  []string `db:"types"`
+}
+
+// The bulk queries take one array element per series and are sent together in a single batch,
+// the series IDs are unique and sorted, so concurrent batches lock the rows in the same order.
+// All series of a batch belong to the tenant given as a scalar
+func (q *Queries) BulkInsertMtrMetrics(ctx context.Context, arg BulkInsertMtrMetricsParams) error {
+	_, err := q.db.Exec(ctx, BulkInsertMtrMetrics, arg.Tenant, arg.Ids, arg.Types)
+	return err
+}
+
+const BulkUpsertCounterMetrics = `-- name: BulkUpsertCounterMetrics :exec
+INSERT INTO counter_metrics (tenant, metric_id, delta)
+SELECT $1::text,
+       unnest($2::text[]),
+       unnest($3::bigint[])
+ON CONFLICT (tenant, metric_id) DO UPDATE
+    SET delta = EXCLUDED.delta
+`
+
+type BulkUpsertCounterMetricsParams struct {
+	Tenant string   `db:"tenant"`
+	Ids    []string `db:"ids"`
+	Deltas []int64  `db:"deltas"`
+}
+
+func (q *Queries) BulkUpsertCounterMetrics(ctx context.Context, arg BulkUpsertCounterMetricsParams) error {
+	_, err := q.db.Exec(ctx, BulkUpsertCounterMetrics, arg.Tenant, arg.Ids, arg.Deltas)
+	return err
+}
+
+const BulkUpsertGaugeMetrics = `-- name: BulkUpsertGaugeMetrics :exec
+INSERT INTO gauge_metrics (tenant, metric_id, value)
+SELECT $1::text,
+       unnest($2::text[]),
+       unnest($3::double precision[])
+ON CONFLICT (tenant, metric_id) DO UPDATE
+    SET value = EXCLUDED.value
+`
+
+type BulkUpsertGaugeMetricsParams struct {
+	Tenant string    `db:"tenant"`
+	Ids    []string  `db:"ids"`
+	Vals   []float64 `db:"vals"`
+}
+
+func (q *Queries) BulkUpsertGaugeMetrics(ctx context.Context, arg BulkUpsertGaugeMetricsParams) error {
+	_, err := q.db.Exec(ctx, BulkUpsertGaugeMetrics, arg.Tenant, arg.Ids, arg.Vals)
+	return err
+}
+
+const BulkUpsertHistogramMetrics = `-- name: BulkUpsertHistogramMetrics :exec
+INSERT INTO histogram_metrics (tenant, metric_id, histogram)
+SELECT $1::text,
+       unnest($2::text[]),
+       unnest($3::text[]::jsonb[])
+ON CONFLICT (tenant, metric_id) DO UPDATE
+    SET histogram = EXCLUDED.histogram
+`
+
+type BulkUpsertHistogramMetricsParams struct {
+	Tenant     string   `db:"tenant"`
+	Ids        []string `db:"ids"`
+	Histograms []string `db:"histograms"`
+}
+
+func (q *Queries) BulkUpsertHistogramMetrics(ctx context.Context, arg BulkUpsertHistogramMetricsParams) error {
+	_, err := q.db.Exec(ctx, BulkUpsertHistogramMetrics, arg.Tenant, arg.Ids, arg.Histograms)
+	return err
+}
+
+const BulkUpsertSummaryMetrics = `-- name: BulkUpsertSummaryMetrics :exec
+INSERT INTO summary_metrics (tenant, metric_id, summary)
+SELECT $1::text,
+       unnest($2::text[]),
+       unnest($3::text[]::jsonb[])
+ON CONFLICT (tenant, metric_id) DO UPDATE
+    SET summary = EXCLUDED.summary
+`
+
+type BulkUpsertSummaryMetricsParams struct {
+	Tenant    string   `db:"tenant"`
+	Ids       []string `db:"ids"`
+	Summaries []string `db:"summaries"`
+}
+
+func (q *Queries) BulkUpsertSummaryMetrics(ctx context.Context, arg BulkUpsertSummaryMetricsParams) error {
+	_, err := q.db.Exec(ctx, BulkUpsertSummaryMetrics, arg.Tenant, arg.Ids, arg.Summaries)
+	return err
+}
+
+const DeleteManyMetrics = `-- name: DeleteManyMetrics :many
+DELETE FROM mtr_metrics
+WHERE tenant = $1
+  AND id = ANY($2::text[])
+RETURNING id
+`
+
+type DeleteManyMetricsParams struct {
+	Tenant domain.Tenant `db:"tenant" json:"-"`
+	Ids    []string      `db:"ids"`
+}
+
+func (q *Queries) DeleteManyMetrics(ctx context.Context, arg DeleteManyMetricsParams) ([]domain.MetricName, error) {
+	rows, err := q.db.Query(ctx, DeleteManyMetrics, arg.Tenant, arg.Ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []domain.MetricName
+	for rows.Next() {
+		var id domain.MetricName
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const DeleteMetric = `-- name: DeleteMetric :execrows
+DELETE FROM mtr_metrics
+WHERE tenant = $1
+  AND id = $2
+  AND type = $3
+`
+
+type DeleteMetricParams struct {
+	Tenant domain.Tenant     `db:"tenant" json:"-"`
+	ID     domain.MetricName `db:"id" json:"id" validate:"required"`
+	MType  domain.MetricType `db:"type" json:"type" validate:"required,oneof=counter gauge histogram summary"`
+}
+
+// Child rows in the value and sample tables are removed by ON DELETE CASCADE
+func (q *Queries) DeleteMetric(ctx context.Context, arg DeleteMetricParams) (int64, error) {
+	result, err := q.db.Exec(ctx, DeleteMetric, arg.Tenant, arg.ID, arg.MType)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const DeleteStaleMetrics = `-- name: DeleteStaleMetrics :many
+DELETE FROM mtr_metrics
+WHERE tenant = $1
+  AND updated_at < $2
+RETURNING id
+`
+
+type DeleteStaleMetricsParams struct {
+	Tenant domain.Tenant `db:"tenant" json:"-"`
+	Before *time.Time    `db:"before" json:"updated_at,omitempty"`
+}
+
+// Child rows in the value and sample tables are removed by ON DELETE CASCADE
+func (q *Queries) DeleteStaleMetrics(ctx context.Context, arg DeleteStaleMetricsParams) ([]domain.MetricName, error) {
+	rows, err := q.db.Query(ctx, DeleteStaleMetrics, arg.Tenant, arg.Before)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []domain.MetricName
+	for rows.Next() {
+		var id domain.MetricName
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const GetAllMetrics = `-- name: GetAllMetrics :many
 SELECT m.id,
        m.type,
+       m.updated_at,
        c.delta,
-       g.value
+       g.value,
+       h.histogram,
+       s.summary,
+       l.name,
+       l.labels
 FROM mtr_metrics AS m
-         LEFT JOIN counter_metrics AS c ON m.id = c.metric_id
-         LEFT JOIN gauge_metrics AS g ON m.id = g.metric_id
+         LEFT JOIN counter_metrics AS c ON m.tenant = c.tenant AND m.id = c.metric_id
+         LEFT JOIN gauge_metrics AS g ON m.tenant = g.tenant AND m.id = g.metric_id
+         LEFT JOIN histogram_metrics AS h ON m.tenant = h.tenant AND m.id = h.metric_id
+         LEFT JOIN summary_metrics AS s ON m.tenant = s.tenant AND m.id = s.metric_id
+         LEFT JOIN metric_labels AS l ON m.tenant = l.tenant AND m.id = l.metric_id
+WHERE m.tenant = $1
 `
 
 type GetAllMetricsRow struct {
-	ID    domain.MetricName `db:"id" json:"id" validate:"required"`
-	MType domain.MetricType `db:"type" json:"type" validate:"required,oneof=counter gauge"`
-	Delta *int64            `db:"delta" json:"delta"`
-	Value *float64          `db:"value" json:"value"`
+	ID        domain.MetricName     `db:"id" json:"id" validate:"required"`
+	MType     domain.MetricType     `db:"type" json:"type" validate:"required,oneof=counter gauge histogram summary"`
+	UpdatedAt *time.Time            `db:"updated_at" json:"updated_at,omitempty"`
+	Delta     *int64                `db:"delta" json:"delta"`
+	Value     *float64              `db:"value" json:"value"`
+	Histogram *domain.HistogramData `db:"histogram" json:"histogram,omitempty"`
+	Summary   *domain.SummaryData   `db:"summary" json:"summary,omitempty"`
+	Name      *domain.MetricName    `db:"name" json:"name"`
+	Labels    domain.Labels         `db:"labels" json:"labels"`
 }
 
-func (q *Queries) GetAllMetrics(ctx context.Context) ([]GetAllMetricsRow, error) {
-	rows, err := q.db.Query(ctx, GetAllMetrics)
+func (q *Queries) GetAllMetrics(ctx context.Context, tenant domain.Tenant) ([]GetAllMetricsRow, error) {
+	rows, err := q.db.Query(ctx, GetAllMetrics, tenant)
 	if err != nil {
 		return nil, err
 	}
@@ -40,8 +387,13 @@ func (q *Queries) GetAllMetrics(ctx context.Context) ([]GetAllMetricsRow, error)
 		if err := rows.Scan(
 			&i.ID,
 			&i.MType,
+			&i.UpdatedAt,
 			&i.Delta,
 			&i.Value,
+			&i.Histogram,
+			&i.Summary,
+			&i.Name,
+			&i.Labels,
 		); err != nil {
 			return nil, err
 		}
@@ -53,26 +405,139 @@ func (q *Queries) GetAllMetrics(ctx context.Context) ([]GetAllMetricsRow, error)
 	return items, nil
 }
 
+const GetCounterRange = `-- name: GetCounterRange :many
+SELECT metric_id, delta, created_at
+FROM counter_samples
+WHERE tenant = $1
+  AND metric_id = $2
+  AND created_at BETWEEN $3 AND $4
+ORDER BY created_at
+`
+
+type GetCounterRangeParams struct {
+	Tenant   domain.Tenant     `db:"tenant" json:"-"`
+	MetricID domain.MetricName `db:"metric_id" json:"-"`
+	FromTime time.Time         `db:"from_time"`
+	ToTime   time.Time         `db:"to_time"`
+}
+
+type GetCounterRangeRow struct {
+	MetricID  domain.MetricName `db:"metric_id" json:"-"`
+	Delta     *int64            `db:"delta" json:"delta"`
+	CreatedAt time.Time         `db:"created_at"`
+}
+
+func (q *Queries) GetCounterRange(ctx context.Context, arg GetCounterRangeParams) ([]GetCounterRangeRow, error) {
+	rows, err := q.db.Query(ctx, GetCounterRange,
+		arg.Tenant,
+		arg.MetricID,
+		arg.FromTime,
+		arg.ToTime,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetCounterRangeRow
+	for rows.Next() {
+		var i GetCounterRangeRow
+		if err := rows.Scan(&i.MetricID, &i.Delta, &i.CreatedAt); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const GetGaugeRange = `-- name: GetGaugeRange :many
+SELECT metric_id, value, created_at
+FROM gauge_samples
+WHERE tenant = $1
+  AND metric_id = $2
+  AND created_at BETWEEN $3 AND $4
+ORDER BY created_at
+`
+
+type GetGaugeRangeParams struct {
+	Tenant   domain.Tenant     `db:"tenant" json:"-"`
+	MetricID domain.MetricName `db:"metric_id" json:"-"`
+	FromTime time.Time         `db:"from_time"`
+	ToTime   time.Time         `db:"to_time"`
+}
+
+type GetGaugeRangeRow struct {
+	MetricID  domain.MetricName `db:"metric_id" json:"-"`
+	Value     *float64          `db:"value" json:"value"`
+	CreatedAt time.Time         `db:"created_at"`
+}
+
+func (q *Queries) GetGaugeRange(ctx context.Context, arg GetGaugeRangeParams) ([]GetGaugeRangeRow, error) {
+	rows, err := q.db.Query(ctx, GetGaugeRange,
+		arg.Tenant,
+		arg.MetricID,
+		arg.FromTime,
+		arg.ToTime,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetGaugeRangeRow
+	for rows.Next() {
+		var i GetGaugeRangeRow
+		if err := rows.Scan(&i.MetricID, &i.Value, &i.CreatedAt); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const GetManyMetrics = `-- name: GetManyMetrics :many
 SELECT m.id,
        m.type,
+       m.updated_at,
        c.delta,
-       g.value
+       g.value,
+       h.histogram,
+       s.summary,
+       l.name,
+       l.labels
 FROM mtr_metrics AS m
-         LEFT JOIN counter_metrics AS c ON m.id = c.metric_id
-         LEFT JOIN gauge_metrics AS g ON m.id = g.metric_id
-WHERE m.id = ANY($1::text[])
+         LEFT JOIN counter_metrics AS c ON m.tenant = c.tenant AND m.id = c.metric_id
+         LEFT JOIN gauge_metrics AS g ON m.tenant = g.tenant AND m.id = g.metric_id
+         LEFT JOIN histogram_metrics AS h ON m.tenant = h.tenant AND m.id = h.metric_id
+         LEFT JOIN summary_metrics AS s ON m.tenant = s.tenant AND m.id = s.metric_id
+         LEFT JOIN metric_labels AS l ON m.tenant = l.tenant AND m.id = l.metric_id
+WHERE m.tenant = $1
+  AND m.id = ANY($2::text[])
 `
 
+type GetManyMetricsParams struct {
+	Tenant domain.Tenant `db:"tenant" json:"-"`
+	Ids    []string      `db:"ids"`
+}
+
 type GetManyMetricsRow struct {
-	ID    domain.MetricName `db:"id" json:"id" validate:"required"`
-	MType domain.MetricType `db:"type" json:"type" validate:"required,oneof=counter gauge"`
-	Delta *int64            `db:"delta" json:"delta"`
-	Value *float64          `db:"value" json:"value"`
+	ID        domain.MetricName     `db:"id" json:"id" validate:"required"`
+	MType     domain.MetricType     `db:"type" json:"type" validate:"required,oneof=counter gauge histogram summary"`
+	UpdatedAt *time.Time            `db:"updated_at" json:"updated_at,omitempty"`
+	Delta     *int64                `db:"delta" json:"delta"`
+	Value     *float64              `db:"value" json:"value"`
+	Histogram *domain.HistogramData `db:"histogram" json:"histogram,omitempty"`
+	Summary   *domain.SummaryData   `db:"summary" json:"summary,omitempty"`
+	Name      *domain.MetricName    `db:"name" json:"name"`
+	Labels    domain.Labels         `db:"labels" json:"labels"`
 }
 
-func (q *Queries) GetManyMetrics(ctx context.Context, dollar_1 []string) ([]GetManyMetricsRow, error) {
-	rows, err := q.db.Query(ctx, GetManyMetrics, dollar_1)
+func (q *Queries) GetManyMetrics(ctx context.Context, arg GetManyMetricsParams) ([]GetManyMetricsRow, error) {
+	rows, err := q.db.Query(ctx, GetManyMetrics, arg.Tenant, arg.Ids)
 	if err != nil {
 		return nil, err
 	}
@@ -83,8 +548,13 @@ func (q *Queries) GetManyMetrics(ctx context.Context, dollar_1 []string) ([]GetM
 		if err := rows.Scan(
 			&i.ID,
 			&i.MType,
+			&i.UpdatedAt,
 			&i.Delta,
 			&i.Value,
+			&i.Histogram,
+			&i.Summary,
+			&i.Name,
+			&i.Labels,
 		); err != nil {
 			return nil, err
 		}
@@ -96,166 +566,507 @@ func (q *Queries) GetManyMetrics(ctx context.Context, dollar_1 []string) ([]GetM
 	return items, nil
 }
 
+const GetTenants = `-- name: GetTenants :many
+SELECT DISTINCT tenant
+FROM mtr_metrics
+ORDER BY tenant
+`
+
+func (q *Queries) GetTenants(ctx context.Context) ([]domain.Tenant, error) {
+	rows, err := q.db.Query(ctx, GetTenants)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []domain.Tenant
+	for rows.Next() {
+		var tenant domain.Tenant
+		if err := rows.Scan(&tenant); err != nil {
+			return nil, err
+		}
+		items = append(items, tenant)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const GetUnifiedMetric = `-- name: GetUnifiedMetric :one
 SELECT m.id,
        m.type,
+       m.updated_at,
        c.delta,
-       g.value
+       g.value,
+       h.histogram,
+       s.summary,
+       l.name,
+       l.labels
 FROM mtr_metrics AS m
-         LEFT JOIN counter_metrics AS c ON m.id = c.metric_id
-         LEFT JOIN gauge_metrics AS g ON m.id = g.metric_id
-WHERE m.id = $1
+         LEFT JOIN counter_metrics AS c ON m.tenant = c.tenant AND m.id = c.metric_id
+         LEFT JOIN gauge_metrics AS g ON m.tenant = g.tenant AND m.id = g.metric_id
+         LEFT JOIN histogram_metrics AS h ON m.tenant = h.tenant AND m.id = h.metric_id
+         LEFT JOIN summary_metrics AS s ON m.tenant = s.tenant AND m.id = s.metric_id
+         LEFT JOIN metric_labels AS l ON m.tenant = l.tenant AND m.id = l.metric_id
+WHERE m.tenant = $1
+  AND m.id = $2
 `
 
+type GetUnifiedMetricParams struct {
+	Tenant domain.Tenant     `db:"tenant" json:"-"`
+	ID     domain.MetricName `db:"id" json:"id" validate:"required"`
+}
+
 type GetUnifiedMetricRow struct {
-	ID    domain.MetricName `db:"id" json:"id" validate:"required"`
-	MType domain.MetricType `db:"type" json:"type" validate:"required,oneof=counter gauge"`
-	Delta *int64            `db:"delta" json:"delta"`
-	Value *float64          `db:"value" json:"value"`
+	ID        domain.MetricName     `db:"id" json:"id" validate:"required"`
+	MType     domain.MetricType     `db:"type" json:"type" validate:"required,oneof=counter gauge histogram summary"`
+	UpdatedAt *time.Time            `db:"updated_at" json:"updated_at,omitempty"`
+	Delta     *int64                `db:"delta" json:"delta"`
+	Value     *float64              `db:"value" json:"value"`
+	Histogram *domain.HistogramData `db:"histogram" json:"histogram,omitempty"`
+	Summary   *domain.SummaryData   `db:"summary" json:"summary,omitempty"`
+	Name      *domain.MetricName    `db:"name" json:"name"`
+	Labels    domain.Labels         `db:"labels" json:"labels"`
 }
 
-func (q *Queries) GetUnifiedMetric(ctx context.Context, id domain.MetricName) (GetUnifiedMetricRow, error) {
-	row := q.db.QueryRow(ctx, GetUnifiedMetric, id)
+func (q *Queries) GetUnifiedMetric(ctx context.Context, arg GetUnifiedMetricParams) (GetUnifiedMetricRow, error) {
+	row := q.db.QueryRow(ctx, GetUnifiedMetric, arg.Tenant, arg.ID)
 	var i GetUnifiedMetricRow
 	err := row.Scan(
 		&i.ID,
 		&i.MType,
+		&i.UpdatedAt,
 		&i.Delta,
 		&i.Value,
+		&i.Histogram,
+		&i.Summary,
+		&i.Name,
+		&i.Labels,
 	)
 	return i, err
 }
 
 const InsertCounterMetric = `-- name: InsertCounterMetric :exec
-INSERT INTO counter_metrics (metric_id, delta)
-VALUES ($1, $2)
-ON CONFLICT (metric_id) DO NOTHING
+INSERT INTO counter_metrics (tenant, metric_id, delta)
+VALUES ($1, $2, $3)
+ON CONFLICT (tenant, metric_id) DO NOTHING
 `
 
 type InsertCounterMetricParams struct {
+	Tenant   domain.Tenant     `db:"tenant" json:"-"`
 	MetricID domain.MetricName `db:"metric_id" json:"-"`
 	Delta    *int64            `db:"delta" json:"delta"`
 }
 
 func (q *Queries) InsertCounterMetric(ctx context.Context, arg InsertCounterMetricParams) error {
-	_, err := q.db.Exec(ctx, InsertCounterMetric, arg.MetricID, arg.Delta)
+	_, err := q.db.Exec(ctx, InsertCounterMetric, arg.Tenant, arg.MetricID, arg.Delta)
+	return err
+}
+
+const InsertCounterSample = `-- name: InsertCounterSample :exec
+INSERT INTO counter_samples (tenant, metric_id, delta)
+VALUES ($1, $2, $3)
+`
+
+type InsertCounterSampleParams struct {
+	Tenant   domain.Tenant     `db:"tenant" json:"-"`
+	MetricID domain.MetricName `db:"metric_id" json:"-"`
+	Delta    *int64            `db:"delta" json:"delta"`
+}
+
+func (q *Queries) InsertCounterSample(ctx context.Context, arg InsertCounterSampleParams) error {
+	_, err := q.db.Exec(ctx, InsertCounterSample, arg.Tenant, arg.MetricID, arg.Delta)
 	return err
 }
 
 const InsertGaugeMetric = `-- name: InsertGaugeMetric :exec
-INSERT INTO gauge_metrics (metric_id, value)
-VALUES ($1, $2)
-ON CONFLICT (metric_id) DO NOTHING
+INSERT INTO gauge_metrics (tenant, metric_id, value)
+VALUES ($1, $2, $3)
+ON CONFLICT (tenant, metric_id) DO NOTHING
 `
 
 type InsertGaugeMetricParams struct {
+	Tenant   domain.Tenant     `db:"tenant" json:"-"`
 	MetricID domain.MetricName `db:"metric_id" json:"-"`
 	Value    *float64          `db:"value" json:"value"`
 }
 
 func (q *Queries) InsertGaugeMetric(ctx context.Context, arg InsertGaugeMetricParams) error {
-	_, err := q.db.Exec(ctx, InsertGaugeMetric, arg.MetricID, arg.Value)
+	_, err := q.db.Exec(ctx, InsertGaugeMetric, arg.Tenant, arg.MetricID, arg.Value)
+	return err
+}
+
+const InsertGaugeSample = `-- name: InsertGaugeSample :exec
+INSERT INTO gauge_samples (tenant, metric_id, value)
+VALUES ($1, $2, $3)
+`
+
+type InsertGaugeSampleParams struct {
+	Tenant   domain.Tenant     `db:"tenant" json:"-"`
+	MetricID domain.MetricName `db:"metric_id" json:"-"`
+	Value    *float64          `db:"value" json:"value"`
+}
+
+func (q *Queries) InsertGaugeSample(ctx context.Context, arg InsertGaugeSampleParams) error {
+	_, err := q.db.Exec(ctx, InsertGaugeSample, arg.Tenant, arg.MetricID, arg.Value)
+	return err
+}
+
+const InsertHistogramMetric = `-- name: InsertHistogramMetric :exec
+INSERT INTO histogram_metrics (tenant, metric_id, histogram)
+VALUES ($1, $2, $3)
+ON CONFLICT (tenant, metric_id) DO NOTHING
+`
+
+type InsertHistogramMetricParams struct {
+	Tenant    domain.Tenant         `db:"tenant" json:"-"`
+	MetricID  domain.MetricName     `db:"metric_id" json:"-"`
+	Histogram *domain.HistogramData `db:"histogram" json:"histogram,omitempty"`
+}
+
+func (q *Queries) InsertHistogramMetric(ctx context.Context, arg InsertHistogramMetricParams) error {
+	_, err := q.db.Exec(ctx, InsertHistogramMetric, arg.Tenant, arg.MetricID, arg.Histogram)
+	return err
+}
+
+const InsertMetricLabels = `-- name: InsertMetricLabels :exec
+INSERT INTO metric_labels (tenant, metric_id, name, labels)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (tenant, metric_id) DO NOTHING
+`
+
+type InsertMetricLabelsParams struct {
+	Tenant   domain.Tenant      `db:"tenant" json:"-"`
+	MetricID domain.MetricName  `db:"metric_id" json:"-"`
+	Name     *domain.MetricName `db:"name" json:"name"`
+	Labels   domain.Labels      `db:"labels" json:"labels"`
+}
+
+// The labels of a series never change, they are part of its ID
+func (q *Queries) InsertMetricLabels(ctx context.Context, arg InsertMetricLabelsParams) error {
+	_, err := q.db.Exec(ctx, InsertMetricLabels,
+		arg.Tenant,
+		arg.MetricID,
+		arg.Name,
+		arg.Labels,
+	)
 	return err
 }
 
 const InsertMtrMetric = `-- name: InsertMtrMetric :exec
-INSERT INTO mtr_metrics (id, type)
-VALUES ($1, $2)
-ON CONFLICT (id, type) DO NOTHING
+INSERT INTO mtr_metrics (tenant, id, type)
+VALUES ($1, $2, $3)
+ON CONFLICT (tenant, id, type) DO UPDATE
+    SET updated_at = now()
 `
 
 type InsertMtrMetricParams struct {
-	ID    domain.MetricName `db:"id" json:"id" validate:"required"`
-	MType domain.MetricType `db:"type" json:"type" validate:"required,oneof=counter gauge"`
+	Tenant domain.Tenant     `db:"tenant" json:"-"`
+	ID     domain.MetricName `db:"id" json:"id" validate:"required"`
+	MType  domain.MetricType `db:"type" json:"type" validate:"required,oneof=counter gauge histogram summary"`
 }
 
 func (q *Queries) InsertMtrMetric(ctx context.Context, arg InsertMtrMetricParams) error {
-	_, err := q.db.Exec(ctx, InsertMtrMetric, arg.ID, arg.MType)
+	_, err := q.db.Exec(ctx, InsertMtrMetric, arg.Tenant, arg.ID, arg.MType)
+	return err
+}
+
+const InsertSummaryMetric = `-- name: InsertSummaryMetric :exec
+INSERT INTO summary_metrics (tenant, metric_id, summary)
+VALUES ($1, $2, $3)
+ON CONFLICT (tenant, metric_id) DO NOTHING
+`
+
+type InsertSummaryMetricParams struct {
+	Tenant   domain.Tenant       `db:"tenant" json:"-"`
+	MetricID domain.MetricName   `db:"metric_id" json:"-"`
+	Summary  *domain.SummaryData `db:"summary" json:"summary,omitempty"`
+}
+
+func (q *Queries) InsertSummaryMetric(ctx context.Context, arg InsertSummaryMetricParams) error {
+	_, err := q.db.Exec(ctx, InsertSummaryMetric, arg.Tenant, arg.MetricID, arg.Summary)
+	return err
+}
+
+const LockDistributions = `-- name: LockDistributions :many
+SELECT m.id,
+       h.histogram,
+       s.summary
+FROM mtr_metrics AS m
+         LEFT JOIN histogram_metrics AS h ON m.tenant = h.tenant AND m.id = h.metric_id
+         LEFT JOIN summary_metrics AS s ON m.tenant = s.tenant AND m.id = s.metric_id
+WHERE m.tenant = $1
+  AND m.id = ANY($2::text[])
+ORDER BY m.id
+FOR UPDATE OF m
+`
+
+type LockDistributionsParams struct {
+	Tenant domain.Tenant `db:"tenant" json:"-"`
+	Ids    []string      `db:"ids"`
+}
+
+type LockDistributionsRow struct {
+	ID        domain.MetricName     `db:"id" json:"id" validate:"required"`
+	Histogram *domain.HistogramData `db:"histogram" json:"histogram,omitempty"`
+	Summary   *domain.SummaryData   `db:"summary" json:"summary,omitempty"`
+}
+
+// Locks the series, so concurrent writers merge their histograms and summaries one after another
+func (q *Queries) LockDistributions(ctx context.Context, arg LockDistributionsParams) ([]LockDistributionsRow, error) {
+	rows, err := q.db.Query(ctx, LockDistributions, arg.Tenant, arg.Ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []LockDistributionsRow
+	for rows.Next() {
+		var i LockDistributionsRow
+		if err := rows.Scan(&i.ID, &i.Histogram, &i.Summary); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const TouchMtrMetric = `-- name: TouchMtrMetric :exec
+UPDATE mtr_metrics
+SET updated_at = now()
+WHERE tenant = $1
+  AND id = $2
+`
+
+type TouchMtrMetricParams struct {
+	Tenant domain.Tenant     `db:"tenant" json:"-"`
+	ID     domain.MetricName `db:"id" json:"id" validate:"required"`
+}
+
+func (q *Queries) TouchMtrMetric(ctx context.Context, arg TouchMtrMetricParams) error {
+	_, err := q.db.Exec(ctx, TouchMtrMetric, arg.Tenant, arg.ID)
+	return err
+}
+
+const TrimCounterSamples = `-- name: TrimCounterSamples :exec
+DELETE FROM counter_samples AS s
+USING (SELECT ids.metric_id,
+              (SELECT c.created_at
+               FROM counter_samples AS c
+               WHERE c.tenant = $1
+                 AND c.metric_id = ids.metric_id
+               ORDER BY c.created_at DESC
+               OFFSET $2::int - 1 LIMIT 1) AS oldest
+       FROM unnest($3::text[]) AS ids(metric_id)) AS cut
+WHERE s.tenant = $1
+  AND s.metric_id = cut.metric_id
+  AND s.created_at < cut.oldest
+`
+
+type TrimCounterSamplesParams struct {
+	Tenant domain.Tenant `db:"tenant" json:"-"`
+	Keep   int32         `db:"keep"`
+	Ids    []string      `db:"ids"`
+}
+
+// Keeps the newest samples of the counters up to the limit, the older ones are removed
+func (q *Queries) TrimCounterSamples(ctx context.Context, arg TrimCounterSamplesParams) error {
+	_, err := q.db.Exec(ctx, TrimCounterSamples, arg.Tenant, arg.Keep, arg.Ids)
+	return err
+}
+
+const TrimGaugeSamples = `-- name: TrimGaugeSamples :exec
+DELETE FROM gauge_samples AS s
+USING (SELECT ids.metric_id,
+              (SELECT g.created_at
+               FROM gauge_samples AS g
+               WHERE g.tenant = $1
+                 AND g.metric_id = ids.metric_id
+               ORDER BY g.created_at DESC
+               OFFSET $2::int - 1 LIMIT 1) AS oldest
+       FROM unnest($3::text[]) AS ids(metric_id)) AS cut
+WHERE s.tenant = $1
+  AND s.metric_id = cut.metric_id
+  AND s.created_at < cut.oldest
+`
+
+type TrimGaugeSamplesParams struct {
+	Tenant domain.Tenant `db:"tenant" json:"-"`
+	Keep   int32         `db:"keep"`
+	Ids    []string      `db:"ids"`
+}
+
+// Keeps the newest samples of the gauges up to the limit, the older ones are removed
+func (q *Queries) TrimGaugeSamples(ctx context.Context, arg TrimGaugeSamplesParams) error {
+	_, err := q.db.Exec(ctx, TrimGaugeSamples, arg.Tenant, arg.Keep, arg.Ids)
 	return err
 }
 
 const UpdateCounterMetric = `-- name: UpdateCounterMetric :exec
 UPDATE counter_metrics
-SET delta = $2
-WHERE metric_id = $1
+SET delta = $3
+WHERE tenant = $1
+  AND metric_id = $2
 `
 
 type UpdateCounterMetricParams struct {
+	Tenant   domain.Tenant     `db:"tenant" json:"-"`
 	MetricID domain.MetricName `db:"metric_id" json:"-"`
 	Delta    *int64            `db:"delta" json:"delta"`
 }
 
 func (q *Queries) UpdateCounterMetric(ctx context.Context, arg UpdateCounterMetricParams) error {
-	_, err := q.db.Exec(ctx, UpdateCounterMetric, arg.MetricID, arg.Delta)
+	_, err := q.db.Exec(ctx, UpdateCounterMetric, arg.Tenant, arg.MetricID, arg.Delta)
 	return err
 }
 
 const UpdateGaugeMetric = `-- name: UpdateGaugeMetric :exec
 UPDATE gauge_metrics
-SET value = $2
-WHERE metric_id = $1
+SET value = $3
+WHERE tenant = $1
+  AND metric_id = $2
 `
 
 type UpdateGaugeMetricParams struct {
+	Tenant   domain.Tenant     `db:"tenant" json:"-"`
 	MetricID domain.MetricName `db:"metric_id" json:"-"`
 	Value    *float64          `db:"value" json:"value"`
 }
 
 func (q *Queries) UpdateGaugeMetric(ctx context.Context, arg UpdateGaugeMetricParams) error {
-	_, err := q.db.Exec(ctx, UpdateGaugeMetric, arg.MetricID, arg.Value)
+	_, err := q.db.Exec(ctx, UpdateGaugeMetric, arg.Tenant, arg.MetricID, arg.Value)
+	return err
+}
+
+const UpdateHistogramMetric = `-- name: UpdateHistogramMetric :exec
+UPDATE histogram_metrics
+SET histogram = $3
+WHERE tenant = $1
+  AND metric_id = $2
+`
+
+type UpdateHistogramMetricParams struct {
+	Tenant    domain.Tenant         `db:"tenant" json:"-"`
+	MetricID  domain.MetricName     `db:"metric_id" json:"-"`
+	Histogram *domain.HistogramData `db:"histogram" json:"histogram,omitempty"`
+}
+
+func (q *Queries) UpdateHistogramMetric(ctx context.Context, arg UpdateHistogramMetricParams) error {
+	_, err := q.db.Exec(ctx, UpdateHistogramMetric, arg.Tenant, arg.MetricID, arg.Histogram)
+	return err
+}
+
+const UpdateSummaryMetric = `-- name: UpdateSummaryMetric :exec
+UPDATE summary_metrics
+SET summary = $3
+WHERE tenant = $1
+  AND metric_id = $2
+`
+
+type UpdateSummaryMetricParams struct {
+	Tenant   domain.Tenant       `db:"tenant" json:"-"`
+	MetricID domain.MetricName   `db:"metric_id" json:"-"`
+	Summary  *domain.SummaryData `db:"summary" json:"summary,omitempty"`
+}
+
+func (q *Queries) UpdateSummaryMetric(ctx context.Context, arg UpdateSummaryMetricParams) error {
+	_, err := q.db.Exec(ctx, UpdateSummaryMetric, arg.Tenant, arg.MetricID, arg.Summary)
 	return err
 }
 
 const UpsertCounterMetric = `-- name: UpsertCounterMetric :exec
-INSERT INTO counter_metrics (metric_id, delta)
-VALUES ($1, $2)
-ON CONFLICT (metric_id) DO UPDATE
+INSERT INTO counter_metrics (tenant, metric_id, delta)
+VALUES ($1, $2, $3)
+ON CONFLICT (tenant, metric_id) DO UPDATE
     SET delta = EXCLUDED.delta
 `
 
 type UpsertCounterMetricParams struct {
+	Tenant   domain.Tenant     `db:"tenant" json:"-"`
 	MetricID domain.MetricName `db:"metric_id" json:"-"`
 	Delta    *int64            `db:"delta" json:"delta"`
 }
 
-// Insert into counter_metrics or update if conflict on (metric_id)
+// Insert into counter_metrics or update if conflict on (tenant, metric_id)
 func (q *Queries) UpsertCounterMetric(ctx context.Context, arg UpsertCounterMetricParams) error {
-	_, err := q.db.Exec(ctx, UpsertCounterMetric, arg.MetricID, arg.Delta)
+	_, err := q.db.Exec(ctx, UpsertCounterMetric, arg.Tenant, arg.MetricID, arg.Delta)
 	return err
 }
 
 const UpsertGaugeMetric = `-- name: UpsertGaugeMetric :exec
-INSERT INTO gauge_metrics (metric_id, value)
-VALUES ($1, $2)
-ON CONFLICT (metric_id) DO UPDATE
+INSERT INTO gauge_metrics (tenant, metric_id, value)
+VALUES ($1, $2, $3)
+ON CONFLICT (tenant, metric_id) DO UPDATE
     SET value = EXCLUDED.value
 `
 
 type UpsertGaugeMetricParams struct {
+	Tenant   domain.Tenant     `db:"tenant" json:"-"`
 	MetricID domain.MetricName `db:"metric_id" json:"-"`
 	Value    *float64          `db:"value" json:"value"`
 }
 
-// Insert into gauge_metrics or update if conflict on (metric_id)
+// Insert into gauge_metrics or update if conflict on (tenant, metric_id)
 func (q *Queries) UpsertGaugeMetric(ctx context.Context, arg UpsertGaugeMetricParams) error {
-	_, err := q.db.Exec(ctx, UpsertGaugeMetric, arg.MetricID, arg.Value)
+	_, err := q.db.Exec(ctx, UpsertGaugeMetric, arg.Tenant, arg.MetricID, arg.Value)
+	return err
+}
+
+const UpsertHistogramMetric = `-- name: UpsertHistogramMetric :exec
+INSERT INTO histogram_metrics (tenant, metric_id, histogram)
+VALUES ($1, $2, $3)
+ON CONFLICT (tenant, metric_id) DO UPDATE
+    SET histogram = EXCLUDED.histogram
+`
+
+type UpsertHistogramMetricParams struct {
+	Tenant    domain.Tenant         `db:"tenant" json:"-"`
+	MetricID  domain.MetricName     `db:"metric_id" json:"-"`
+	Histogram *domain.HistogramData `db:"histogram" json:"histogram,omitempty"`
+}
+
+// Insert into histogram_metrics or update if conflict on (tenant, metric_id)
+func (q *Queries) UpsertHistogramMetric(ctx context.Context, arg UpsertHistogramMetricParams) error {
+	_, err := q.db.Exec(ctx, UpsertHistogramMetric, arg.Tenant, arg.MetricID, arg.Histogram)
 	return err
 }
 
 const UpsertMtrMetric = `-- name: UpsertMtrMetric :exec
-INSERT INTO mtr_metrics (id, type)
-VALUES ($1, $2)
-ON CONFLICT (id, type) DO UPDATE
+INSERT INTO mtr_metrics (tenant, id, type)
+VALUES ($1, $2, $3)
+ON CONFLICT (tenant, id, type) DO UPDATE
     SET id = EXCLUDED.id, type = EXCLUDED.type
 `
 
 type UpsertMtrMetricParams struct {
-	ID    domain.MetricName `db:"id" json:"id" validate:"required"`
-	MType domain.MetricType `db:"type" json:"type" validate:"required,oneof=counter gauge"`
+	Tenant domain.Tenant     `db:"tenant" json:"-"`
+	ID     domain.MetricName `db:"id" json:"id" validate:"required"`
+	MType  domain.MetricType `db:"type" json:"type" validate:"required,oneof=counter gauge histogram summary"`
 }
 
-// Insert into mtr_metrics or update if conflict on (id, type)
+// Insert into mtr_metrics or update if conflict on (tenant, id, type)
 func (q *Queries) UpsertMtrMetric(ctx context.Context, arg UpsertMtrMetricParams) error {
-	_, err := q.db.Exec(ctx, UpsertMtrMetric, arg.ID, arg.MType)
+	_, err := q.db.Exec(ctx, UpsertMtrMetric, arg.Tenant, arg.ID, arg.MType)
+	return err
+}
+
+const UpsertSummaryMetric = `-- name: UpsertSummaryMetric :exec
+INSERT INTO summary_metrics (tenant, metric_id, summary)
+VALUES ($1, $2, $3)
+ON CONFLICT (tenant, metric_id) DO UPDATE
+    SET summary = EXCLUDED.summary
+`
+
+type UpsertSummaryMetricParams struct {
+	Tenant   domain.Tenant       `db:"tenant" json:"-"`
+	MetricID domain.MetricName   `db:"metric_id" json:"-"`
+	Summary  *domain.SummaryData `db:"summary" json:"summary,omitempty"`
+}
+
+// Insert into summary_metrics or update if conflict on (tenant, metric_id)
+func (q *Queries) UpsertSummaryMetric(ctx context.Context, arg UpsertSummaryMetricParams) error {
+	_, err := q.db.Exec(ctx, UpsertSummaryMetric, arg.Tenant, arg.MetricID, arg.Summary)
 	return err
 }
@@ -0,0 +1,61 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.27.0
+
+package sqlitedb
+
+import (
+	domain "github.com/npavlov/go-metrics-service/internal/domain"
+)
+
+type CounterMetric struct {
+	Tenant   domain.Tenant     `db:"tenant"`
+	MetricID domain.MetricName `db:"metric_id"`
+	Delta    *int64            `db:"delta"`
+}
+
+type CounterSample struct {
+	Tenant    domain.Tenant     `db:"tenant"`
+	MetricID  domain.MetricName `db:"metric_id"`
+	Delta     *int64            `db:"delta"`
+	CreatedAt int64             `db:"created_at"`
+}
+
+type GaugeMetric struct {
+	Tenant   domain.Tenant     `db:"tenant"`
+	MetricID domain.MetricName `db:"metric_id"`
+	Value    *float64          `db:"value"`
+}
+
+type GaugeSample struct {
+	Tenant    domain.Tenant     `db:"tenant"`
+	MetricID  domain.MetricName `db:"metric_id"`
+	Value     *float64          `db:"value"`
+	CreatedAt int64             `db:"created_at"`
+}
+
+type HistogramMetric struct {
+	Tenant    domain.Tenant         `db:"tenant"`
+	MetricID  domain.MetricName     `db:"metric_id"`
+	Histogram *domain.HistogramData `db:"histogram"`
+}
+
+type MetricLabel struct {
+	Tenant   domain.Tenant      `db:"tenant"`
+	MetricID domain.MetricName  `db:"metric_id"`
+	Name     *domain.MetricName `db:"name"`
+	Labels   domain.Labels      `db:"labels"`
+}
+
+type MtrMetric struct {
+	Tenant    domain.Tenant     `db:"tenant"`
+	ID        domain.MetricName `db:"id"`
+	MType     domain.MetricType `db:"type"`
+	UpdatedAt int64             `db:"updated_at"`
+}
+
+type SummaryMetric struct {
+	Tenant   domain.Tenant       `db:"tenant"`
+	MetricID domain.MetricName   `db:"metric_id"`
+	Summary  *domain.SummaryData `db:"summary"`
+}
@@ -0,0 +1,660 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.27.0
+// source: query.sql
+
+package sqlitedb
+
+import (
+	"context"
+	"strings"
+
+	domain "github.com/npavlov/go-metrics-service/internal/domain"
+)
+
+const DeleteManyMetrics = `-- name: DeleteManyMetrics :many
+DELETE FROM mtr_metrics
+WHERE tenant = ?1
+  AND id IN (/*SLICE:ids*/?)
+RETURNING id
+`
+
+type DeleteManyMetricsParams struct {
+	Tenant domain.Tenant       `db:"tenant"`
+	Ids    []domain.MetricName `db:"ids"`
+}
+
+func (q *Queries) DeleteManyMetrics(ctx context.Context, arg DeleteManyMetricsParams) ([]domain.MetricName, error) {
+	query := DeleteManyMetrics
+	var queryParams []interface{}
+	queryParams = append(queryParams, arg.Tenant)
+	if len(arg.Ids) > 0 {
+		for _, v := range arg.Ids {
+			queryParams = append(queryParams, v)
+		}
+		query = strings.Replace(query, "/*SLICE:ids*/?", strings.Repeat(",?", len(arg.Ids))[1:], 1)
+	} else {
+		query = strings.Replace(query, "/*SLICE:ids*/?", "NULL", 1)
+	}
+	rows, err := q.db.QueryContext(ctx, query, queryParams...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []domain.MetricName
+	for rows.Next() {
+		var id domain.MetricName
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const DeleteMetric = `-- name: DeleteMetric :execrows
+DELETE FROM mtr_metrics
+WHERE tenant = ?1
+  AND id = ?2
+  AND type = ?3
+`
+
+type DeleteMetricParams struct {
+	Tenant domain.Tenant     `db:"tenant"`
+	ID     domain.MetricName `db:"id"`
+	MType  domain.MetricType `db:"type"`
+}
+
+// Child rows in the value and sample tables are removed by ON DELETE CASCADE
+func (q *Queries) DeleteMetric(ctx context.Context, arg DeleteMetricParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, DeleteMetric, arg.Tenant, arg.ID, arg.MType)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const DeleteStaleMetrics = `-- name: DeleteStaleMetrics :many
+DELETE FROM mtr_metrics
+WHERE tenant = ?1
+  AND updated_at < ?2
+RETURNING id
+`
+
+type DeleteStaleMetricsParams struct {
+	Tenant domain.Tenant `db:"tenant"`
+	Before int64         `db:"before"`
+}
+
+// Child rows in the value and sample tables are removed by ON DELETE CASCADE
+func (q *Queries) DeleteStaleMetrics(ctx context.Context, arg DeleteStaleMetricsParams) ([]domain.MetricName, error) {
+	rows, err := q.db.QueryContext(ctx, DeleteStaleMetrics, arg.Tenant, arg.Before)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []domain.MetricName
+	for rows.Next() {
+		var id domain.MetricName
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const GetAllMetrics = `-- name: GetAllMetrics :many
+SELECT m.id,
+       m.type,
+       m.updated_at,
+       c.delta,
+       g.value,
+       h.histogram,
+       s.summary,
+       l.name,
+       l.labels
+FROM mtr_metrics AS m
+         LEFT JOIN counter_metrics AS c ON m.tenant = c.tenant AND m.id = c.metric_id
+         LEFT JOIN gauge_metrics AS g ON m.tenant = g.tenant AND m.id = g.metric_id
+         LEFT JOIN histogram_metrics AS h ON m.tenant = h.tenant AND m.id = h.metric_id
+         LEFT JOIN summary_metrics AS s ON m.tenant = s.tenant AND m.id = s.metric_id
+         LEFT JOIN metric_labels AS l ON m.tenant = l.tenant AND m.id = l.metric_id
+WHERE m.tenant = ?1
+`
+
+type GetAllMetricsRow struct {
+	ID        domain.MetricName     `db:"id"`
+	MType     domain.MetricType     `db:"type"`
+	UpdatedAt int64                 `db:"updated_at"`
+	Delta     *int64                `db:"delta"`
+	Value     *float64              `db:"value"`
+	Histogram *domain.HistogramData `db:"histogram"`
+	Summary   *domain.SummaryData   `db:"summary"`
+	Name      *domain.MetricName    `db:"name"`
+	Labels    domain.Labels         `db:"labels"`
+}
+
+func (q *Queries) GetAllMetrics(ctx context.Context, tenant domain.Tenant) ([]GetAllMetricsRow, error) {
+	rows, err := q.db.QueryContext(ctx, GetAllMetrics, tenant)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetAllMetricsRow
+	for rows.Next() {
+		var i GetAllMetricsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.MType,
+			&i.UpdatedAt,
+			&i.Delta,
+			&i.Value,
+			&i.Histogram,
+			&i.Summary,
+			&i.Name,
+			&i.Labels,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const GetCounterRange = `-- name: GetCounterRange :many
+SELECT metric_id, delta, created_at
+FROM counter_samples
+WHERE tenant = ?1
+  AND metric_id = ?2
+  AND created_at >= ?3
+  AND created_at <= ?4
+ORDER BY created_at
+`
+
+type GetCounterRangeParams struct {
+	Tenant   domain.Tenant     `db:"tenant"`
+	MetricID domain.MetricName `db:"metric_id"`
+	FromTime int64             `db:"from_time"`
+	ToTime   int64             `db:"to_time"`
+}
+
+type GetCounterRangeRow struct {
+	MetricID  domain.MetricName `db:"metric_id"`
+	Delta     *int64            `db:"delta"`
+	CreatedAt int64             `db:"created_at"`
+}
+
+func (q *Queries) GetCounterRange(ctx context.Context, arg GetCounterRangeParams) ([]GetCounterRangeRow, error) {
+	rows, err := q.db.QueryContext(ctx, GetCounterRange,
+		arg.Tenant,
+		arg.MetricID,
+		arg.FromTime,
+		arg.ToTime,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetCounterRangeRow
+	for rows.Next() {
+		var i GetCounterRangeRow
+		if err := rows.Scan(&i.MetricID, &i.Delta, &i.CreatedAt); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const GetGaugeRange = `-- name: GetGaugeRange :many
+SELECT metric_id, value, created_at
+FROM gauge_samples
+WHERE tenant = ?1
+  AND metric_id = ?2
+  AND created_at >= ?3
+  AND created_at <= ?4
+ORDER BY created_at
+`
+
+type GetGaugeRangeParams struct {
+	Tenant   domain.Tenant     `db:"tenant"`
+	MetricID domain.MetricName `db:"metric_id"`
+	FromTime int64             `db:"from_time"`
+	ToTime   int64             `db:"to_time"`
+}
+
+type GetGaugeRangeRow struct {
+	MetricID  domain.MetricName `db:"metric_id"`
+	Value     *float64          `db:"value"`
+	CreatedAt int64             `db:"created_at"`
+}
+
+func (q *Queries) GetGaugeRange(ctx context.Context, arg GetGaugeRangeParams) ([]GetGaugeRangeRow, error) {
+	rows, err := q.db.QueryContext(ctx, GetGaugeRange,
+		arg.Tenant,
+		arg.MetricID,
+		arg.FromTime,
+		arg.ToTime,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetGaugeRangeRow
+	for rows.Next() {
+		var i GetGaugeRangeRow
+		if err := rows.Scan(&i.MetricID, &i.Value, &i.CreatedAt); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const GetManyMetrics = `-- name: GetManyMetrics :many
+SELECT m.id,
+       m.type,
+       m.updated_at,
+       c.delta,
+       g.value,
+       h.histogram,
+       s.summary,
+       l.name,
+       l.labels
+FROM mtr_metrics AS m
+         LEFT JOIN counter_metrics AS c ON m.tenant = c.tenant AND m.id = c.metric_id
+         LEFT JOIN gauge_metrics AS g ON m.tenant = g.tenant AND m.id = g.metric_id
+         LEFT JOIN histogram_metrics AS h ON m.tenant = h.tenant AND m.id = h.metric_id
+         LEFT JOIN summary_metrics AS s ON m.tenant = s.tenant AND m.id = s.metric_id
+         LEFT JOIN metric_labels AS l ON m.tenant = l.tenant AND m.id = l.metric_id
+WHERE m.tenant = ?1
+  AND m.id IN (/*SLICE:ids*/?)
+`
+
+type GetManyMetricsParams struct {
+	Tenant domain.Tenant       `db:"tenant"`
+	Ids    []domain.MetricName `db:"ids"`
+}
+
+type GetManyMetricsRow struct {
+	ID        domain.MetricName     `db:"id"`
+	MType     domain.MetricType     `db:"type"`
+	UpdatedAt int64                 `db:"updated_at"`
+	Delta     *int64                `db:"delta"`
+	Value     *float64              `db:"value"`
+	Histogram *domain.HistogramData `db:"histogram"`
+	Summary   *domain.SummaryData   `db:"summary"`
+	Name      *domain.MetricName    `db:"name"`
+	Labels    domain.Labels         `db:"labels"`
+}
+
+func (q *Queries) GetManyMetrics(ctx context.Context, arg GetManyMetricsParams) ([]GetManyMetricsRow, error) {
+	query := GetManyMetrics
+	var queryParams []interface{}
+	queryParams = append(queryParams, arg.Tenant)
+	if len(arg.Ids) > 0 {
+		for _, v := range arg.Ids {
+			queryParams = append(queryParams, v)
+		}
+		query = strings.Replace(query, "/*SLICE:ids*/?", strings.Repeat(",?", len(arg.Ids))[1:], 1)
+	} else {
+		query = strings.Replace(query, "/*SLICE:ids*/?", "NULL", 1)
+	}
+	rows, err := q.db.QueryContext(ctx, query, queryParams...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetManyMetricsRow
+	for rows.Next() {
+		var i GetManyMetricsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.MType,
+			&i.UpdatedAt,
+			&i.Delta,
+			&i.Value,
+			&i.Histogram,
+			&i.Summary,
+			&i.Name,
+			&i.Labels,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const GetTenants = `-- name: GetTenants :many
+SELECT DISTINCT tenant
+FROM mtr_metrics
+ORDER BY tenant
+`
+
+func (q *Queries) GetTenants(ctx context.Context) ([]domain.Tenant, error) {
+	rows, err := q.db.QueryContext(ctx, GetTenants)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []domain.Tenant
+	for rows.Next() {
+		var tenant domain.Tenant
+		if err := rows.Scan(&tenant); err != nil {
+			return nil, err
+		}
+		items = append(items, tenant)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const GetUnifiedMetric = `-- name: GetUnifiedMetric :one
+SELECT m.id,
+       m.type,
+       m.updated_at,
+       c.delta,
+       g.value,
+       h.histogram,
+       s.summary,
+       l.name,
+       l.labels
+FROM mtr_metrics AS m
+         LEFT JOIN counter_metrics AS c ON m.tenant = c.tenant AND m.id = c.metric_id
+         LEFT JOIN gauge_metrics AS g ON m.tenant = g.tenant AND m.id = g.metric_id
+         LEFT JOIN histogram_metrics AS h ON m.tenant = h.tenant AND m.id = h.metric_id
+         LEFT JOIN summary_metrics AS s ON m.tenant = s.tenant AND m.id = s.metric_id
+         LEFT JOIN metric_labels AS l ON m.tenant = l.tenant AND m.id = l.metric_id
+WHERE m.tenant = ?1
+  AND m.id = ?2
+`
+
+type GetUnifiedMetricParams struct {
+	Tenant domain.Tenant     `db:"tenant"`
+	ID     domain.MetricName `db:"id"`
+}
+
+type GetUnifiedMetricRow struct {
+	ID        domain.MetricName     `db:"id"`
+	MType     domain.MetricType     `db:"type"`
+	UpdatedAt int64                 `db:"updated_at"`
+	Delta     *int64                `db:"delta"`
+	Value     *float64              `db:"value"`
+	Histogram *domain.HistogramData `db:"histogram"`
+	Summary   *domain.SummaryData   `db:"summary"`
+	Name      *domain.MetricName    `db:"name"`
+	Labels    domain.Labels         `db:"labels"`
+}
+
+func (q *Queries) GetUnifiedMetric(ctx context.Context, arg GetUnifiedMetricParams) (GetUnifiedMetricRow, error) {
+	row := q.db.QueryRowContext(ctx, GetUnifiedMetric, arg.Tenant, arg.ID)
+	var i GetUnifiedMetricRow
+	err := row.Scan(
+		&i.ID,
+		&i.MType,
+		&i.UpdatedAt,
+		&i.Delta,
+		&i.Value,
+		&i.Histogram,
+		&i.Summary,
+		&i.Name,
+		&i.Labels,
+	)
+	return i, err
+}
+
+const InsertCounterSample = `-- name: InsertCounterSample :exec
+INSERT INTO counter_samples (tenant, metric_id, delta, created_at)
+VALUES (?1, ?2, ?3, ?4)
+`
+
+type InsertCounterSampleParams struct {
+	Tenant    domain.Tenant     `db:"tenant"`
+	MetricID  domain.MetricName `db:"metric_id"`
+	Delta     *int64            `db:"delta"`
+	CreatedAt int64             `db:"created_at"`
+}
+
+func (q *Queries) InsertCounterSample(ctx context.Context, arg InsertCounterSampleParams) error {
+	_, err := q.db.ExecContext(ctx, InsertCounterSample,
+		arg.Tenant,
+		arg.MetricID,
+		arg.Delta,
+		arg.CreatedAt,
+	)
+	return err
+}
+
+const InsertGaugeSample = `-- name: InsertGaugeSample :exec
+INSERT INTO gauge_samples (tenant, metric_id, value, created_at)
+VALUES (?1, ?2, ?3, ?4)
+`
+
+type InsertGaugeSampleParams struct {
+	Tenant    domain.Tenant     `db:"tenant"`
+	MetricID  domain.MetricName `db:"metric_id"`
+	Value     *float64          `db:"value"`
+	CreatedAt int64             `db:"created_at"`
+}
+
+func (q *Queries) InsertGaugeSample(ctx context.Context, arg InsertGaugeSampleParams) error {
+	_, err := q.db.ExecContext(ctx, InsertGaugeSample,
+		arg.Tenant,
+		arg.MetricID,
+		arg.Value,
+		arg.CreatedAt,
+	)
+	return err
+}
+
+const InsertMetricLabels = `-- name: InsertMetricLabels :exec
+INSERT INTO metric_labels (tenant, metric_id, name, labels)
+VALUES (?1, ?2, ?3, ?4)
+ON CONFLICT (tenant, metric_id) DO NOTHING
+`
+
+type InsertMetricLabelsParams struct {
+	Tenant   domain.Tenant      `db:"tenant"`
+	MetricID domain.MetricName  `db:"metric_id"`
+	Name     *domain.MetricName `db:"name"`
+	Labels   domain.Labels      `db:"labels"`
+}
+
+// The labels of a series never change, they are part of its ID
+func (q *Queries) InsertMetricLabels(ctx context.Context, arg InsertMetricLabelsParams) error {
+	_, err := q.db.ExecContext(ctx, InsertMetricLabels,
+		arg.Tenant,
+		arg.MetricID,
+		arg.Name,
+		arg.Labels,
+	)
+	return err
+}
+
+const InsertMtrMetric = `-- name: InsertMtrMetric :exec
+INSERT INTO mtr_metrics (tenant, id, type, updated_at)
+VALUES (?1, ?2, ?3, ?4)
+ON CONFLICT (tenant, id, type) DO UPDATE
+    SET updated_at = excluded.updated_at
+`
+
+type InsertMtrMetricParams struct {
+	Tenant    domain.Tenant     `db:"tenant"`
+	ID        domain.MetricName `db:"id"`
+	MType     domain.MetricType `db:"type"`
+	UpdatedAt int64             `db:"updated_at"`
+}
+
+// The type of a series is fixed, another type under the same ID violates mtr_metrics_tenant_id_key
+func (q *Queries) InsertMtrMetric(ctx context.Context, arg InsertMtrMetricParams) error {
+	_, err := q.db.ExecContext(ctx, InsertMtrMetric,
+		arg.Tenant,
+		arg.ID,
+		arg.MType,
+		arg.UpdatedAt,
+	)
+	return err
+}
+
+const TrimCounterSamples = `-- name: TrimCounterSamples :exec
+DELETE FROM counter_samples
+WHERE counter_samples.tenant = ?1
+  AND counter_samples.metric_id = ?2
+  AND counter_samples.created_at < (SELECT c.created_at
+                    FROM counter_samples AS c
+                    WHERE c.tenant = ?1
+                      AND c.metric_id = ?2
+                    ORDER BY c.created_at DESC
+                    LIMIT 1 OFFSET CAST(?3 AS INTEGER) - 1)
+`
+
+type TrimCounterSamplesParams struct {
+	Tenant   domain.Tenant     `db:"tenant"`
+	MetricID domain.MetricName `db:"metric_id"`
+	Keep     int64             `db:"keep"`
+}
+
+// Keeps the newest samples of the counter up to the limit, the older ones are removed
+func (q *Queries) TrimCounterSamples(ctx context.Context, arg TrimCounterSamplesParams) error {
+	_, err := q.db.ExecContext(ctx, TrimCounterSamples, arg.Tenant, arg.MetricID, arg.Keep)
+	return err
+}
+
+const TrimGaugeSamples = `-- name: TrimGaugeSamples :exec
+DELETE FROM gauge_samples
+WHERE gauge_samples.tenant = ?1
+  AND gauge_samples.metric_id = ?2
+  AND gauge_samples.created_at < (SELECT g.created_at
+                    FROM gauge_samples AS g
+                    WHERE g.tenant = ?1
+                      AND g.metric_id = ?2
+                    ORDER BY g.created_at DESC
+                    LIMIT 1 OFFSET CAST(?3 AS INTEGER) - 1)
+`
+
+type TrimGaugeSamplesParams struct {
+	Tenant   domain.Tenant     `db:"tenant"`
+	MetricID domain.MetricName `db:"metric_id"`
+	Keep     int64             `db:"keep"`
+}
+
+// Keeps the newest samples of the gauge up to the limit, the older ones are removed
+func (q *Queries) TrimGaugeSamples(ctx context.Context, arg TrimGaugeSamplesParams) error {
+	_, err := q.db.ExecContext(ctx, TrimGaugeSamples, arg.Tenant, arg.MetricID, arg.Keep)
+	return err
+}
+
+const UpsertCounterMetric = `-- name: UpsertCounterMetric :exec
+INSERT INTO counter_metrics (tenant, metric_id, delta)
+VALUES (?1, ?2, ?3)
+ON CONFLICT (tenant, metric_id) DO UPDATE
+    SET delta = excluded.delta
+`
+
+type UpsertCounterMetricParams struct {
+	Tenant   domain.Tenant     `db:"tenant"`
+	MetricID domain.MetricName `db:"metric_id"`
+	Delta    *int64            `db:"delta"`
+}
+
+func (q *Queries) UpsertCounterMetric(ctx context.Context, arg UpsertCounterMetricParams) error {
+	_, err := q.db.ExecContext(ctx, UpsertCounterMetric, arg.Tenant, arg.MetricID, arg.Delta)
+	return err
+}
+
+const UpsertGaugeMetric = `-- name: UpsertGaugeMetric :exec
+INSERT INTO gauge_metrics (tenant, metric_id, value)
+VALUES (?1, ?2, ?3)
+ON CONFLICT (tenant, metric_id) DO UPDATE
+    SET value = excluded.value
+`
+
+type UpsertGaugeMetricParams struct {
+	Tenant   domain.Tenant     `db:"tenant"`
+	MetricID domain.MetricName `db:"metric_id"`
+	Value    *float64          `db:"value"`
+}
+
+func (q *Queries) UpsertGaugeMetric(ctx context.Context, arg UpsertGaugeMetricParams) error {
+	_, err := q.db.ExecContext(ctx, UpsertGaugeMetric, arg.Tenant, arg.MetricID, arg.Value)
+	return err
+}
+
+const UpsertHistogramMetric = `-- name: UpsertHistogramMetric :exec
+INSERT INTO histogram_metrics (tenant, metric_id, histogram)
+VALUES (?1, ?2, ?3)
+ON CONFLICT (tenant, metric_id) DO UPDATE
+    SET histogram = excluded.histogram
+`
+
+type UpsertHistogramMetricParams struct {
+	Tenant    domain.Tenant         `db:"tenant"`
+	MetricID  domain.MetricName     `db:"metric_id"`
+	Histogram *domain.HistogramData `db:"histogram"`
+}
+
+func (q *Queries) UpsertHistogramMetric(ctx context.Context, arg UpsertHistogramMetricParams) error {
+	_, err := q.db.ExecContext(ctx, UpsertHistogramMetric, arg.Tenant, arg.MetricID, arg.Histogram)
+	return err
+}
+
+const UpsertSummaryMetric = `-- name: UpsertSummaryMetric :exec
+INSERT INTO summary_metrics (tenant, metric_id, summary)
+VALUES (?1, ?2, ?3)
+ON CONFLICT (tenant, metric_id) DO UPDATE
+    SET summary = excluded.summary
+`
+
+type UpsertSummaryMetricParams struct {
+	Tenant   domain.Tenant       `db:"tenant"`
+	MetricID domain.MetricName   `db:"metric_id"`
+	Summary  *domain.SummaryData `db:"summary"`
+}
+
+func (q *Queries) UpsertSummaryMetric(ctx context.Context, arg UpsertSummaryMetricParams) error {
+	_, err := q.db.ExecContext(ctx, UpsertSummaryMetric, arg.Tenant, arg.MetricID, arg.Summary)
+	return err
+}
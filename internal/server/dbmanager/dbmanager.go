@@ -3,13 +3,27 @@ package dbmanager
 import (
 	"context"
 	"database/sql"
+	"strings"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/pkg/errors"
 	"github.com/pressly/goose"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
+	// registers the CGO-free "sqlite" driver.
+	_ "modernc.org/sqlite"
+)
+
+const (
+	// SQLiteScheme selects the embedded SQLite backend in the DSN, e.g. sqlite://metrics.db.
+	SQLiteScheme = "sqlite://"
+	// sqlitePragmas enforce foreign keys for the cascades and wait for the lock instead of failing with SQLITE_BUSY.
+	sqlitePragmas = "_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"
+
+	postgresMigrations = "migrations"
+	sqliteMigrations   = "migrations/sqlite"
 )
 
 type PgxPool interface {
@@ -23,10 +37,13 @@ type PgxPool interface {
 }
 
 // DBManager manages the database connection and its lifecycle.
+// A DSN with the sqlite:// scheme opens an SQLite database instead of a PostgreSQL pool.
 type DBManager struct {
 	DB               PgxPool
+	SQLite           *sql.DB
 	Log              *zerolog.Logger
 	connectionString string
+	migrations       string
 	IsConnected      bool
 }
 
@@ -37,11 +54,29 @@ func NewDBManager(connectionString string, log *zerolog.Logger) *DBManager {
 		Log:              log,
 		IsConnected:      false,
 		DB:               nil,
+		SQLite:           nil,
+		migrations:       "",
 	}
 }
 
-// Connect initializes a new pgx connection pool.
+// WithMigrations overrides the directory of the migrations of the selected backend.
+func (m *DBManager) WithMigrations(dir string) *DBManager {
+	m.migrations = dir
+
+	return m
+}
+
+// IsSQLite reports whether the DSN selects the SQLite backend.
+func (m *DBManager) IsSQLite() bool {
+	return strings.HasPrefix(m.connectionString, SQLiteScheme)
+}
+
+// Connect initializes a new pgx connection pool or opens the SQLite database.
 func (m *DBManager) Connect(ctx context.Context) *DBManager {
+	if m.IsSQLite() {
+		return m.connectSQLite(ctx)
+	}
+
 	config, err := pgxpool.ParseConfig(m.connectionString)
 	if err != nil {
 		log.Error().Err(err).Msg("failed to parse database configuration")
@@ -66,12 +101,50 @@ func (m *DBManager) Connect(ctx context.Context) *DBManager {
 	return m
 }
 
+// connectSQLite opens the database file of the DSN, the file is created when missing.
+func (m *DBManager) connectSQLite(ctx context.Context) *DBManager {
+	path := strings.TrimPrefix(m.connectionString, SQLiteScheme)
+
+	separator := "?"
+	if strings.Contains(path, "?") {
+		separator = "&"
+	}
+
+	sqlDB, err := sql.Open("sqlite", path+separator+sqlitePragmas)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to open sqlite database")
+
+		return m
+	}
+
+	// SQLite has a single writer, one connection avoids busy errors between the pool connections
+	sqlDB.SetMaxOpenConns(1)
+
+	if err := sqlDB.PingContext(ctx); err != nil {
+		log.Error().Err(err).Msg("failed to open sqlite database")
+		_ = sqlDB.Close()
+
+		return m
+	}
+
+	m.SQLite = sqlDB
+	m.IsConnected = true
+
+	return m
+}
+
 // ApplyMigrations applies migrations using goose.
 func (m *DBManager) ApplyMigrations() *DBManager {
 	if !m.IsConnected {
 		return m
 	}
 
+	if m.SQLite != nil {
+		m.applySQLiteMigrations()
+
+		return m
+	}
+
 	sqlDB, err := sql.Open("pgx", m.connectionString)
 	if err != nil {
 		log.Error().Err(err).Msg("failed to connect to database")
@@ -80,7 +153,7 @@ func (m *DBManager) ApplyMigrations() *DBManager {
 	}
 
 	// Run migrations
-	if err := goose.Up(sqlDB, "migrations"); err != nil {
+	if err := goose.Up(sqlDB, m.migrationsDir(postgresMigrations)); err != nil {
 		log.Error().Err(err).Msg("Failed to apply migrations")
 	}
 
@@ -89,8 +162,46 @@ func (m *DBManager) ApplyMigrations() *DBManager {
 	return m
 }
 
-// Close closes the underlying pgxpool.Pool connection.
+func (m *DBManager) applySQLiteMigrations() {
+	if err := goose.SetDialect("sqlite3"); err != nil {
+		log.Error().Err(err).Msg("Failed to set migrations dialect")
+
+		return
+	}
+
+	if err := goose.Up(m.SQLite, m.migrationsDir(sqliteMigrations)); err != nil {
+		log.Error().Err(err).Msg("Failed to apply migrations")
+	}
+
+	log.Info().Msg("Migrations completed")
+}
+
+func (m *DBManager) migrationsDir(defaultDir string) string {
+	if m.migrations != "" {
+		return m.migrations
+	}
+
+	return defaultDir
+}
+
+// Ping checks the connection to the selected database.
+func (m *DBManager) Ping(ctx context.Context) error {
+	if m.SQLite != nil {
+		return errors.Wrap(m.SQLite.PingContext(ctx), "failed to ping sqlite")
+	}
+
+	return errors.Wrap(m.DB.Ping(ctx), "failed to ping db")
+}
+
+// Close closes the underlying pgxpool.Pool connection or the SQLite database.
 func (m *DBManager) Close() {
+	if m.SQLite != nil {
+		_ = m.SQLite.Close()
+		m.Log.Info().Msg("Database connection closed")
+
+		return
+	}
+
 	if m.DB == nil {
 		return
 	}
@@ -0,0 +1,143 @@
+// Package expiry reports the series that were not updated for a while and removes them.
+//
+// A series not updated within the staleness TTL is marked stale when it is read,
+// a series not updated within the eviction TTL is removed by the evictor.
+package expiry
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/npavlov/go-metrics-service/internal/domain"
+	"github.com/npavlov/go-metrics-service/internal/model"
+	"github.com/npavlov/go-metrics-service/internal/server/db"
+	"github.com/npavlov/go-metrics-service/internal/server/tenant"
+)
+
+const (
+	// evictChecks - the number of eviction passes within the eviction TTL.
+	evictChecks = 10
+	// minEvictInterval - the shortest interval between the eviction passes.
+	minEvictInterval = time.Second
+)
+
+// Repository marks the metrics read from the wrapped repository that are stale.
+type Repository struct {
+	model.Repository
+	staleTTL time.Duration
+}
+
+// NewRepository wraps the repository, a metric not updated within the TTL is read as stale.
+func NewRepository(repo model.Repository, staleTTL time.Duration) *Repository {
+	return &Repository{
+		Repository: repo,
+		staleTTL:   staleTTL,
+	}
+}
+
+// Get retrieves the metric and marks it when it is stale.
+func (r *Repository) Get(ctx context.Context, name domain.MetricName) (*db.Metric, bool) {
+	metric, found := r.Repository.Get(ctx, name)
+	if found {
+		metric.Stale = metric.IsStale(r.staleBefore())
+	}
+
+	return metric, found
+}
+
+// GetMany retrieves the metrics and marks the stale ones.
+func (r *Repository) GetMany(ctx context.Context, names []domain.MetricName) (map[domain.MetricName]db.Metric, error) {
+	metrics, err := r.Repository.GetMany(ctx, names)
+
+	before := r.staleBefore()
+	for name, metric := range metrics {
+		metric.Stale = metric.IsStale(before)
+		metrics[name] = metric
+	}
+
+	return metrics, err
+}
+
+// GetAll retrieves all metrics and marks the stale ones.
+func (r *Repository) GetAll(ctx context.Context) map[domain.MetricName]*db.Metric {
+	metrics := r.Repository.GetAll(ctx)
+
+	before := r.staleBefore()
+	for _, metric := range metrics {
+		metric.Stale = metric.IsStale(before)
+	}
+
+	return metrics
+}
+
+// staleBefore returns the time a metric must have been updated after not to be stale.
+func (r *Repository) staleBefore() time.Time {
+	return time.Now().Add(-r.staleTTL)
+}
+
+// Evictor periodically removes the metrics not updated within the eviction TTL.
+type Evictor struct {
+	repo     model.Repository
+	ttl      time.Duration
+	interval time.Duration
+	log      *zerolog.Logger
+}
+
+// NewEvictor creates the evictor of the repository, it checks the metrics a few times within the TTL.
+func NewEvictor(repo model.Repository, ttl time.Duration, log *zerolog.Logger) *Evictor {
+	return &Evictor{
+		repo:     repo,
+		ttl:      ttl,
+		interval: max(ttl/evictChecks, minEvictInterval),
+		log:      log,
+	}
+}
+
+// Start runs the eviction passes until the context is canceled.
+func (e *Evictor) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(e.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				e.log.Info().Msg("Stopping eviction of stale metrics")
+
+				return
+			case <-ticker.C:
+				if _, err := e.Evict(ctx); err != nil {
+					e.log.Error().Err(err).Msg("failed to evict stale metrics")
+				}
+			}
+		}
+	}()
+}
+
+// Evict removes the metrics of every tenant not updated within the TTL and returns their names by tenant.
+func (e *Evictor) Evict(ctx context.Context) (map[domain.Tenant][]domain.MetricName, error) {
+	tenants, err := e.repo.Tenants(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list tenants")
+	}
+
+	before := time.Now().Add(-e.ttl)
+	evicted := make(map[domain.Tenant][]domain.MetricName)
+
+	for _, owner := range tenants {
+		names, err := e.repo.DeleteStale(tenant.WithTenant(ctx, owner), before)
+		if err != nil {
+			return evicted, errors.Wrapf(err, "failed to delete stale metrics of tenant %s", owner)
+		}
+
+		if len(names) > 0 {
+			evicted[owner] = names
+			e.log.Info().Str("tenant", owner.String()).Int("count", len(names)).Msg("evicted stale metrics")
+		}
+	}
+
+	return evicted, nil
+}
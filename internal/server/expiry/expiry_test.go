@@ -0,0 +1,78 @@
+package expiry_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/npavlov/go-metrics-service/internal/domain"
+	"github.com/npavlov/go-metrics-service/internal/server/db"
+	"github.com/npavlov/go-metrics-service/internal/server/expiry"
+	"github.com/npavlov/go-metrics-service/internal/server/storage"
+	testutils "github.com/npavlov/go-metrics-service/internal/test_utils"
+)
+
+const ttl = 50 * time.Millisecond
+
+func gauge(name domain.MetricName, value float64) *db.Metric {
+	return db.NewMetric(name, domain.Gauge, nil, &value)
+}
+
+func TestRepository_MarksStale(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	repo := expiry.NewRepository(storage.NewMemStorage(testutils.GetTLogger()), ttl)
+
+	require.NoError(t, repo.Create(ctx, gauge("old", 1)))
+	time.Sleep(2 * ttl)
+	require.NoError(t, repo.Create(ctx, gauge("fresh", 2)))
+
+	metric, found := repo.Get(ctx, "old")
+	require.True(t, found)
+	assert.True(t, metric.Stale)
+
+	metric, found = repo.Get(ctx, "fresh")
+	require.True(t, found)
+	assert.False(t, metric.Stale)
+
+	metrics, err := repo.GetMany(ctx, []domain.MetricName{"old", "fresh"})
+	require.NoError(t, err)
+	assert.True(t, metrics["old"].Stale)
+	assert.False(t, metrics["fresh"].Stale)
+
+	all := repo.GetAll(ctx)
+	assert.True(t, all["old"].Stale)
+	assert.False(t, all["fresh"].Stale)
+
+	// the applied series of a write is fresh again
+	applied, err := repo.ApplyDeltas(ctx, []db.Metric{*gauge("old", 3)})
+	require.NoError(t, err)
+	assert.False(t, applied[0].Stale)
+
+	metric, _ = repo.Get(ctx, "old")
+	assert.False(t, metric.Stale)
+}
+
+func TestEvictor_Evict(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	repo := storage.NewMemStorage(testutils.GetTLogger())
+	evictor := expiry.NewEvictor(repo, ttl, testutils.GetTLogger())
+
+	require.NoError(t, repo.Create(ctx, gauge("old", 1)))
+	time.Sleep(2 * ttl)
+	require.NoError(t, repo.Create(ctx, gauge("fresh", 2)))
+
+	evicted, err := evictor.Evict(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, map[domain.Tenant][]domain.MetricName{domain.DefaultTenant: {"old"}}, evicted)
+
+	all := repo.GetAll(ctx)
+	assert.Len(t, all, 1)
+	assert.Contains(t, all, domain.MetricName("fresh"))
+}
@@ -0,0 +1,199 @@
+package grpc
+
+import (
+	"context"
+	"strings"
+
+	"github.com/rs/zerolog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/npavlov/go-metrics-service/gen/go/proto/metrics/v1"
+	"github.com/npavlov/go-metrics-service/internal/server/apikey"
+	"github.com/npavlov/go-metrics-service/internal/server/policy"
+	"github.com/npavlov/go-metrics-service/internal/server/replay"
+	"github.com/npavlov/go-metrics-service/internal/utils"
+)
+
+// methodScopes are the scopes the methods require, the methods not listed require the admin scope.
+//
+//nolint:gochecknoglobals
+var methodScopes = map[string]apikey.Scope{
+	pb.MetricService_SetMetrics_FullMethodName:    apikey.ScopeWrite,
+	pb.MetricService_SetMetric_FullMethodName:     apikey.ScopeWrite,
+	pb.MetricService_StreamMetrics_FullMethodName: apikey.ScopeWrite,
+	pb.MetricService_GetMetric_FullMethodName:     apikey.ScopeRead,
+	pb.MetricService_GetMetrics_FullMethodName:    apikey.ScopeRead,
+	pb.MetricService_ListMetrics_FullMethodName:   apikey.ScopeRead,
+	pb.MetricService_WatchMetrics_FullMethodName:  apikey.ScopeRead,
+	pb.MetricService_DeleteMetrics_FullMethodName: apikey.ScopeAdmin,
+}
+
+// KeyInterceptor authenticates the requests naming their key in the X-Key-ID metadata and checks the scope
+// of the key for the method. The requests without a key ID pass only while the shared key is configured,
+// SigInterceptor then checks them.
+func KeyInterceptor(
+	keys *apikey.Registry,
+	sharedKey bool,
+	guard *replay.Guard,
+	log *zerolog.Logger,
+) grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		keyID := firstValue(md, apikey.Header)
+		if keyID == "" {
+			if !sharedKey {
+				return nil, status.Error(codes.Unauthenticated, "key id is required")
+			}
+
+			return handler(ctx, req)
+		}
+
+		ctx, key, err := openKey(ctx, keys, keyID, info.FullMethod, log)
+		if err != nil {
+			return nil, err
+		}
+
+		timestamp, nonce := firstValue(md, utils.TimestampHeader), firstValue(md, utils.NonceHeader)
+
+		payload, err := signedMessage(req, info.FullMethod, timestamp, nonce, guard, log)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := key.Verify(payload, firstValue(md, "HashSHA256")); err != nil {
+			log.Warn().Err(err).Msg("key rejected")
+
+			return nil, status.Error(codes.Unauthenticated, err.Error())
+		}
+
+		if err := guard.Check(timestamp, nonce); err != nil {
+			log.Warn().Err(err).Msg("replayed request")
+
+			return nil, status.Error(codes.Unauthenticated, err.Error())
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// KeyStreamInterceptor authenticates the streams naming their key in the X-Key-ID metadata.
+// Stream metadata is sent once, so every message carries its signature made with the secret of the key,
+// the key is checked again for every message to end the streams of expired keys.
+// The messages are signed like the ones of SigStreamInterceptor.
+func KeyStreamInterceptor(
+	keys *apikey.Registry,
+	sharedKey bool,
+	guard *replay.Guard,
+	log *zerolog.Logger,
+) grpc.StreamServerInterceptor {
+	return func(
+		srv interface{},
+		stream grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		md, _ := metadata.FromIncomingContext(stream.Context())
+		keyID := firstValue(md, apikey.Header)
+		if keyID == "" {
+			if !sharedKey {
+				return status.Error(codes.Unauthenticated, "key id is required")
+			}
+
+			return handler(srv, stream)
+		}
+
+		ctx, _, err := openKey(stream.Context(), keys, keyID, info.FullMethod, log)
+		if err != nil {
+			return err
+		}
+
+		timestamp, nonce := firstValue(md, utils.TimestampHeader), firstValue(md, utils.NonceHeader)
+		received := uint64(0)
+
+		return handler(srv, &recvStream{
+			ServerStream: &contextStream{ServerStream: stream, ctx: ctx},
+			afterRecv: func(msg interface{}) error {
+				request, signature, err := takeSignature(msg, log)
+				if err != nil {
+					return err
+				}
+
+				payload, err := signedMessage(request, info.FullMethod, timestamp,
+					utils.StreamNonce(nonce, received), guard, log)
+				if err != nil {
+					return err
+				}
+
+				if _, _, err := keys.Authenticate(keyID, payload, signature, policy.SourceFromContext(ctx)); err != nil {
+					log.Warn().Err(err).Msg("key rejected")
+
+					return status.Error(codes.Unauthenticated, err.Error())
+				}
+
+				if received == 0 {
+					if err := guard.Check(timestamp, nonce); err != nil {
+						log.Warn().Err(err).Msg("replayed stream")
+
+						return status.Error(codes.Unauthenticated, err.Error())
+					}
+				}
+				received++
+
+				return nil
+			},
+		})
+	}
+}
+
+// openKey looks the key up, checks its scope for the method and returns the context carrying the key
+// and the tenant of the key.
+func openKey(
+	ctx context.Context,
+	keys *apikey.Registry,
+	keyID, method string,
+	log *zerolog.Logger,
+) (context.Context, *apikey.Key, error) {
+	source := policy.SourceFromContext(ctx)
+
+	key, err := keys.Lookup(keyID, source)
+	if err != nil {
+		log.Warn().Err(err).Str("source", source).Msg("key rejected")
+
+		return nil, nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+
+	scope, found := methodScopes[method]
+	if !found {
+		scope = apikey.ScopeAdmin
+	}
+
+	if !key.Allows(scope) {
+		return nil, nil, status.Error(codes.PermissionDenied, apikey.ErrScopeDenied.Error())
+	}
+
+	ctx, err = key.Resolve(ctx)
+	if err != nil {
+		log.Warn().Err(err).Msg("tenant rejected")
+
+		return nil, nil, status.Error(codes.PermissionDenied, err.Error())
+	}
+
+	return apikey.WithKey(ctx, key), key, nil
+}
+
+// firstValue returns the first trimmed value of the metadata key, empty when it is missing.
+func firstValue(md metadata.MD, key string) string {
+	if values := md.Get(key); len(values) > 0 {
+		return strings.TrimSpace(values[0])
+	}
+
+	return ""
+}
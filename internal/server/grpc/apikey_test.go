@@ -0,0 +1,119 @@
+package grpc_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/npavlov/go-metrics-service/gen/go/proto/metrics/v1"
+	"github.com/npavlov/go-metrics-service/internal/domain"
+	"github.com/npavlov/go-metrics-service/internal/server/apikey"
+	sgrpc "github.com/npavlov/go-metrics-service/internal/server/grpc"
+	"github.com/npavlov/go-metrics-service/internal/server/tenant"
+	testutils "github.com/npavlov/go-metrics-service/internal/test_utils"
+	"github.com/npavlov/go-metrics-service/internal/utils"
+)
+
+func TestKeyInterceptor(t *testing.T) {
+	t.Parallel()
+
+	logger := testutils.GetTLogger()
+	path := filepath.Join(t.TempDir(), "keys.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"keys": [
+		{"id": "writer", "secret": "writer-secret", "scopes": ["write"], "tenant": "team-a"}
+	]}`), 0o600))
+	keys, err := apikey.NewRegistry(path, time.Minute, logger)
+	require.NoError(t, err)
+
+	interceptor := sgrpc.KeyInterceptor(keys, false, nil, logger)
+
+	req := &pb.SetMetricRequest{
+		Metric: &pb.Metric{Id: "test_metric", Mtype: pb.Metric_TYPE_COUNTER, Delta: int64Ptr(1)},
+	}
+	message, err := utils.MarshalProtoMessage(req)
+	require.NoError(t, err)
+
+	var seen domain.Tenant
+	handler := func(ctx context.Context, _ interface{}) (interface{}, error) {
+		seen = tenant.FromContext(ctx)
+
+		return "mockResponse", nil
+	}
+
+	call := func(method, keyID, secret string) error {
+		ctx := metadata.NewIncomingContext(context.Background(),
+			metadata.Pairs(apikey.Header, keyID, "HashSHA256", utils.CalculateHash(secret, message)))
+		_, err := interceptor(ctx, req, &grpc.UnaryServerInfo{Server: nil, FullMethod: method}, handler)
+
+		return err
+	}
+
+	require.NoError(t, call(pb.MetricService_SetMetric_FullMethodName, "writer", "writer-secret"))
+	assert.Equal(t, domain.Tenant("team-a"), seen)
+
+	assert.Equal(t, codes.Unauthenticated,
+		status.Code(call(pb.MetricService_SetMetric_FullMethodName, "writer", "other-secret")))
+	assert.Equal(t, codes.PermissionDenied,
+		status.Code(call(pb.MetricService_DeleteMetrics_FullMethodName, "writer", "writer-secret")))
+	assert.Equal(t, codes.Unauthenticated,
+		status.Code(call(pb.MetricService_SetMetric_FullMethodName, "", "writer-secret")))
+}
+
+func TestKeyInterceptorUnboundKey(t *testing.T) {
+	t.Parallel()
+
+	logger := testutils.GetTLogger()
+	path := filepath.Join(t.TempDir(), "keys.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"keys": [
+		{"id": "team-a", "secret": "team-a-secret", "scopes": ["write"], "tenant": "team-a"},
+		{"id": "writer", "secret": "writer-secret", "scopes": ["write"]},
+		{"id": "ops", "secret": "ops-secret", "scopes": ["admin"]}
+	]}`), 0o600))
+	keys, err := apikey.NewRegistry(path, time.Minute, logger)
+	require.NoError(t, err)
+
+	interceptor := sgrpc.KeyInterceptor(keys, false, nil, logger)
+
+	req := &pb.SetMetricRequest{
+		Metric: &pb.Metric{Id: "test_metric", Mtype: pb.Metric_TYPE_COUNTER, Delta: int64Ptr(1)},
+	}
+	message, err := utils.MarshalProtoMessage(req)
+	require.NoError(t, err)
+
+	var seen domain.Tenant
+	handler := func(ctx context.Context, _ interface{}) (interface{}, error) {
+		seen = tenant.FromContext(ctx)
+
+		return "mockResponse", nil
+	}
+
+	call := func(owner domain.Tenant, keyID, secret string) error {
+		ctx := metadata.NewIncomingContext(context.Background(),
+			metadata.Pairs(apikey.Header, keyID, "HashSHA256", utils.CalculateHash(secret, message)))
+		if owner != "" {
+			ctx = tenant.WithTenant(ctx, owner)
+		}
+		info := &grpc.UnaryServerInfo{Server: nil, FullMethod: pb.MetricService_SetMetric_FullMethodName}
+		_, err := interceptor(ctx, req, info, handler)
+
+		return err
+	}
+
+	assert.Equal(t, codes.PermissionDenied, status.Code(call("team-a", "writer", "writer-secret")),
+		"an unbound key cannot write to another tenant")
+
+	require.NoError(t, call("", "writer", "writer-secret"))
+	assert.Equal(t, domain.DefaultTenant, seen)
+
+	require.NoError(t, call("team-a", "ops", "ops-secret"))
+	assert.Equal(t, domain.Tenant("team-a"), seen)
+}
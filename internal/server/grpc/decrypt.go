@@ -9,66 +9,108 @@ import (
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/protobuf/proto"
 
-	pb "github.com/npavlov/go-metrics-service/gen/go/proto/metrics/v1"
 	"github.com/npavlov/go-metrics-service/pkg/crypto"
 )
 
-// DecryptInterceptor checks if the request signature is valid.
-//
-//nolint:cyclop
+// encryptedRequest is implemented by every request message with an encrypted_message field.
+type encryptedRequest interface {
+	proto.Message
+	GetEncryptedMessage() []byte
+}
+
+// DecryptInterceptor decrypts the request payload when a crypto key is configured.
 func DecryptInterceptor(decryption *crypto.Decryption, log *zerolog.Logger) grpc.UnaryServerInterceptor {
 	return func(
 		ctx context.Context,
 		req interface{},
-		_ *grpc.UnaryServerInfo,
+		info *grpc.UnaryServerInfo,
 		handler grpc.UnaryHandler,
 	) (interface{}, error) {
 		if decryption == nil {
 			return handler(ctx, req)
 		}
 
-		md, ok := metadata.FromIncomingContext(ctx)
+		if err := checkEncryptionHeader(ctx, log); err != nil {
+			return nil, err
+		}
+
+		// Every encryptable request carries its payload in the encrypted_message field
+		request, ok := req.(encryptedRequest)
 		if !ok {
-			log.Error().Msg("missing metadata in request")
+			log.Error().Msg("invalid request type")
 
-			return nil, errors.New("missing metadata")
+			return nil, errors.New("invalid request type")
 		}
 
-		encryptionMds := md.Get("x-encrypted")
-		if len(encryptionMds) == 0 || encryptionMds[0] != "true" {
-			log.Error().Msg("missing or invalid encryption header")
-
-			return nil, errors.New("missing or invalid encryption header")
+		if err := decryptRequest(decryption, request, info.FullMethod); err != nil {
+			return nil, err
 		}
 
-		// Handle different request types using a type switch
-		switch request := req.(type) {
-		case *pb.SetMetricRequest:
-			decrypt, err := decryption.Decrypt(request.GetEncryptedMessage())
-			if err != nil {
-				return nil, errors.Wrap(err, "failed to decrypt request")
-			}
-			if err := proto.Unmarshal(decrypt, request); err != nil {
-				return nil, errors.Wrap(err, "failed to unmarshal request")
-			}
-
-			return handler(ctx, request)
-
-		case *pb.SetMetricsRequest:
-			decrypt, err := decryption.Decrypt(request.GetEncryptedMessage())
-			if err != nil {
-				return nil, errors.Wrap(err, "failed to decrypt request")
-			}
-			if err := proto.Unmarshal(decrypt, request); err != nil {
-				return nil, errors.Wrap(err, "failed to unmarshal request")
-			}
-
-			return handler(ctx, request)
-
-		default:
-			log.Error().Msg("invalid request type")
+		return handler(ctx, request)
+	}
+}
 
-			return nil, errors.New("invalid request type")
+// DecryptStreamInterceptor decrypts every message received on a stream when a crypto key is configured.
+func DecryptStreamInterceptor(decryption *crypto.Decryption, log *zerolog.Logger) grpc.StreamServerInterceptor {
+	return func(
+		srv interface{},
+		stream grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		if decryption == nil {
+			return handler(srv, stream)
+		}
+
+		if err := checkEncryptionHeader(stream.Context(), log); err != nil {
+			return err
 		}
+
+		return handler(srv, &recvStream{
+			ServerStream: stream,
+			afterRecv: func(msg interface{}) error {
+				request, ok := msg.(encryptedRequest)
+				if !ok {
+					log.Error().Msg("invalid request type")
+
+					return errors.New("invalid request type")
+				}
+
+				return decryptRequest(decryption, request, info.FullMethod)
+			},
+		})
+	}
+}
+
+func checkEncryptionHeader(ctx context.Context, log *zerolog.Logger) error {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		log.Error().Msg("missing metadata in request")
+
+		return errors.New("missing metadata")
+	}
+
+	encryptionMds := md.Get("x-encrypted")
+	if len(encryptionMds) == 0 || encryptionMds[0] != "true" {
+		log.Error().Msg("missing or invalid encryption header")
+
+		return errors.New("missing or invalid encryption header")
+	}
+
+	return nil
+}
+
+// decryptRequest replaces the request content with the decrypted encrypted_message,
+// the envelope is bound to the full method of the request.
+func decryptRequest(decryption *crypto.Decryption, request encryptedRequest, method string) error {
+	decrypt, err := decryption.Decrypt(request.GetEncryptedMessage(), method)
+	if err != nil {
+		return errors.Wrap(err, "failed to decrypt request")
+	}
+
+	if err := proto.Unmarshal(decrypt, request); err != nil {
+		return errors.Wrap(err, "failed to unmarshal request")
 	}
+
+	return nil
 }
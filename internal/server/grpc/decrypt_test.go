@@ -35,7 +35,7 @@ func TestDecryptInterceptor(t *testing.T) {
 	}
 	message, err := utils.MarshalProtoMessage(req)
 	require.NoError(t, err)
-	encryptedData, err := encryption.Encrypt(message)
+	encryptedData, err := encryption.Encrypt(message, unaryInfo.FullMethod)
 	require.NoError(t, err)
 	newReq := &pb.SetMetricRequest{
 		EncryptedMessage: encryptedData,
@@ -44,7 +44,7 @@ func TestDecryptInterceptor(t *testing.T) {
 	md := metadata.Pairs("x-encrypted", "true")
 	ctx := metadata.NewIncomingContext(context.Background(), md)
 
-	resp, err := interceptor(ctx, newReq, nil, mockHandler)
+	resp, err := interceptor(ctx, newReq, unaryInfo, mockHandler)
 
 	require.NoError(t, err)
 	assert.Equal(t, "mockResponse", resp)
@@ -78,7 +78,7 @@ func TestDecryptInterceptorSetMetrics(t *testing.T) {
 	}
 	message, err := utils.MarshalProtoMessage(req)
 	require.NoError(t, err)
-	encryptedData, err := encryption.Encrypt(message)
+	encryptedData, err := encryption.Encrypt(message, unaryInfo.FullMethod)
 	require.NoError(t, err)
 	newReq := &pb.SetMetricsRequest{
 		EncryptedMessage: encryptedData,
@@ -87,7 +87,7 @@ func TestDecryptInterceptorSetMetrics(t *testing.T) {
 	md := metadata.Pairs("x-encrypted", "true")
 	ctx := metadata.NewIncomingContext(context.Background(), md)
 
-	resp, err := interceptor(ctx, newReq, nil, mockHandler)
+	resp, err := interceptor(ctx, newReq, unaryInfo, mockHandler)
 
 	require.NoError(t, err)
 	assert.Equal(t, "mockResponse", resp)
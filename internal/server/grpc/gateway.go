@@ -0,0 +1,86 @@
+package grpc
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+
+	"github.com/npavlov/go-metrics-service/internal/server/clientip"
+	"github.com/npavlov/go-metrics-service/internal/tlsconfig"
+)
+
+// ClientIdentityHeader - the gRPC metadata key the gateway forwards the identity of the client certificate
+// of its caller with, the server trusts it from the gateway only.
+const ClientIdentityHeader = "X-Client-Identity"
+
+// gatewayMetadata returns the metadata the gateway forwards with a request, the address of its caller
+// and the identity of the client certificate of the caller.
+func gatewayMetadata(_ context.Context, request *http.Request) metadata.MD {
+	host, _, err := net.SplitHostPort(request.RemoteAddr)
+	if err != nil {
+		host = request.RemoteAddr
+	}
+
+	md := metadata.Pairs(clientip.RealIPHeader, host)
+	if identity := tlsconfig.Identity(request.TLS); identity != "" {
+		md.Set(ClientIdentityHeader, identity)
+	}
+
+	return md
+}
+
+// gatewayHeaderMatcher forwards the headers runtime.DefaultHeaderMatcher does,
+// except the ones naming the metadata set by gatewayMetadata.
+func gatewayHeaderMatcher(key string) (string, bool) {
+	name, ok := runtime.DefaultHeaderMatcher(key)
+	if !ok || strings.EqualFold(name, clientip.RealIPHeader) || strings.EqualFold(name, ClientIdentityHeader) {
+		return "", false
+	}
+
+	return name, true
+}
+
+// fromGateway reports whether the peer is the gateway, its metadata then names the caller of the gateway.
+// The gateway is the peer presenting its client certificate, without one it is the loopback peer
+// it dials the server from in the same process.
+func fromGateway(ctx context.Context, gateway string) bool {
+	if gateway != "" {
+		return peerIdentity(ctx) == gateway
+	}
+
+	return loopbackPeer(ctx)
+}
+
+// clientIdentity returns the identity of the verified client certificate of the caller,
+// the one forwarded by the gateway presenting its client certificate for its requests.
+func clientIdentity(ctx context.Context, gateway string) string {
+	if gateway == "" || !fromGateway(ctx, gateway) {
+		return peerIdentity(ctx)
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	return firstValue(md, ClientIdentityHeader)
+}
+
+// loopbackPeer reports whether the peer connects from a loopback address.
+func loopbackPeer(ctx context.Context) bool {
+	client, ok := peer.FromContext(ctx)
+	if !ok || client.Addr == nil {
+		return false
+	}
+
+	host, _, err := net.SplitHostPort(client.Addr.String())
+	if err != nil {
+		return false
+	}
+
+	ip := net.ParseIP(host)
+
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,171 @@
+package grpc_test
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	gogrpc "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/npavlov/go-metrics-service/gen/go/proto/metrics/v1"
+	"github.com/npavlov/go-metrics-service/internal/domain"
+	"github.com/npavlov/go-metrics-service/internal/server/config"
+	"github.com/npavlov/go-metrics-service/internal/server/db"
+	"github.com/npavlov/go-metrics-service/internal/server/grpc"
+	"github.com/npavlov/go-metrics-service/internal/server/replay"
+	"github.com/npavlov/go-metrics-service/internal/server/storage"
+	testutils "github.com/npavlov/go-metrics-service/internal/test_utils"
+	"github.com/npavlov/go-metrics-service/internal/tlsconfig"
+	"github.com/npavlov/go-metrics-service/internal/utils"
+)
+
+func freeAddress(t *testing.T) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	return fmt.Sprintf("localhost:%d", listener.Addr().(*net.TCPAddr).Port) //nolint:forcetypeassert
+}
+
+func TestGatewayMutualTLS(t *testing.T) {
+	t.Parallel()
+
+	ca := testutils.NewAuthority(t)
+	serverCert, serverKey := ca.Issue(t, "localhost", x509.ExtKeyUsageServerAuth)
+	gatewayCert, gatewayKey := ca.Issue(t, "gateway", x509.ExtKeyUsageClientAuth)
+	agentCert, agentKey := ca.Issue(t, "agent", x509.ExtKeyUsageClientAuth)
+
+	keyFile := filepath.Join(t.TempDir(), "keys.json")
+	require.NoError(t, os.WriteFile(keyFile, []byte(`{"keys": [
+		{"id": "reader", "secret": "reader-secret", "scopes": ["read"]},
+		{"id": "office", "secret": "office-secret", "scopes": ["read"], "subnet": "10.0.0.0/8"}
+	]}`), 0o600))
+
+	//nolint:exhaustruct
+	cfg := &config.Config{
+		GRPCAddress:    freeAddress(t),
+		GRPCGateway:    freeAddress(t),
+		KeyFile:        keyFile,
+		KeyReloadDur:   time.Minute,
+		TLSCert:        serverCert,
+		TLSKey:         serverKey,
+		TLSClientCA:    ca.Path("ca.pem"),
+		TLSClientNames: []string{"agent", "gateway"},
+		TLSCA:          ca.Path("ca.pem"),
+		GatewayTLSCert: gatewayCert,
+		GatewayTLSKey:  gatewayKey,
+	}
+
+	logger := testutils.GetTLogger()
+	memStorage := storage.NewMemStorage(logger)
+	value := 1.5
+	require.NoError(t, memStorage.Update(context.Background(), db.NewMetric("cpu", domain.Gauge, nil, &value)))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	grpc.NewGRPCServer(memStorage, cfg, logger).Start(ctx)
+
+	clientTLS, err := tlsconfig.NewClient(ca.Path("ca.pem"), agentCert, agentKey, "localhost")
+	require.NoError(t, err)
+	//nolint:exhaustruct
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: clientTLS}, Timeout: time.Second}
+
+	payload, err := utils.MarshalProtoMessage(&pb.GetMetricRequest{Id: "cpu"})
+	require.NoError(t, err)
+
+	get := func(keyID, secret, realIP string) (int, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://"+cfg.GRPCGateway+"/v1/metric/cpu", nil)
+		require.NoError(t, err)
+		req.Header.Set("Grpc-Metadata-X-Key-ID", keyID)
+		req.Header.Set("Grpc-Metadata-HashSHA256", utils.CalculateHash(secret, payload))
+		if realIP != "" {
+			req.Header.Set("Grpc-Metadata-X-Real-IP", realIP)
+		}
+
+		response, err := client.Do(req)
+		if err != nil {
+			return 0, err //nolint:wrapcheck
+		}
+		defer response.Body.Close()
+
+		return response.StatusCode, nil
+	}
+
+	// the gateway dials the server with its own client certificate
+	require.Eventually(t, func() bool {
+		code, err := get("reader", "reader-secret", "")
+
+		return err == nil && code == http.StatusOK
+	}, 5*time.Second, 50*time.Millisecond)
+
+	// the key is checked against the address of the caller of the gateway, the callers cannot claim another one
+	code, err := get("office", "office-secret", "10.1.1.1")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, code)
+}
+
+func TestServerSharesReplayGuard(t *testing.T) {
+	t.Parallel()
+
+	//nolint:exhaustruct
+	cfg := &config.Config{
+		GRPCAddress: freeAddress(t),
+		GRPCGateway: freeAddress(t),
+		Key:         "shared",
+	}
+
+	logger := testutils.GetTLogger()
+	memStorage := storage.NewMemStorage(logger)
+	value := 1.5
+	require.NoError(t, memStorage.Update(context.Background(), db.NewMetric("cpu", domain.Gauge, nil, &value)))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	guard := replay.NewGuard(time.Minute, 100)
+	grpc.NewGRPCServerWithKeys(memStorage, cfg, nil, guard, logger).Start(ctx)
+
+	conn, err := gogrpc.NewClient(cfg.GRPCAddress, gogrpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = conn.Close()
+	})
+	client := pb.NewMetricServiceClient(conn)
+
+	req := &pb.GetMetricRequest{Id: "cpu"}
+	message, err := utils.MarshalProtoMessage(req)
+	require.NoError(t, err)
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	get := func(nonce string) error {
+		signature := utils.CalculateHash(cfg.Key, utils.SignedPayload(http.MethodPost,
+			pb.MetricService_GetMetric_FullMethodName, timestamp, nonce, message))
+		callCtx := metadata.NewOutgoingContext(ctx, metadata.Pairs(
+			"HashSHA256", signature, utils.TimestampHeader, timestamp, utils.NonceHeader, nonce))
+		_, err := client.GetMetric(callCtx, req)
+
+		return err //nolint:wrapcheck
+	}
+
+	require.Eventually(t, func() bool {
+		return get("first") == nil
+	}, 5*time.Second, 50*time.Millisecond)
+
+	// a nonce accepted by an HTTP router sharing the guard is rejected by the gRPC server
+	require.NoError(t, guard.Check(timestamp, "http"))
+	assert.Equal(t, codes.Unauthenticated, status.Code(get("http")))
+}
@@ -39,21 +39,7 @@ func LoggingServerInterceptor(logger *zerolog.Logger) grpc.UnaryServerIntercepto
 			Dur("duration", duration)
 
 		// Add status code and error details if there's an error
-		if err != nil {
-			st, ok := status.FromError(err)
-			if ok {
-				logEvent = logEvent.
-					Int("status", int(st.Code())).
-					Str("error", st.Message())
-			} else {
-				logEvent = logEvent.
-					Int("status", int(codes.Unknown)).
-					Str("error", err.Error())
-			}
-		} else {
-			logEvent = logEvent.
-				Int("status", int(codes.OK))
-		}
+		logEvent = withStatus(logEvent, err)
 
 		// Log the final message
 		logEvent.Msg("gRPC Request completed")
@@ -61,3 +47,47 @@ func LoggingServerInterceptor(logger *zerolog.Logger) grpc.UnaryServerIntercepto
 		return resp, err
 	}
 }
+
+// LoggingStreamServerInterceptor logs opened and completed streams.
+func LoggingStreamServerInterceptor(logger *zerolog.Logger) grpc.StreamServerInterceptor {
+	return func(
+		srv interface{},
+		stream grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		start := time.Now()
+
+		logger.Info().
+			Str("method", info.FullMethod).
+			Msg("gRPC Stream opened")
+
+		err := handler(srv, stream)
+
+		logEvent := logger.Info().
+			Str("method", info.FullMethod).
+			Dur("duration", time.Since(start))
+
+		withStatus(logEvent, err).Msg("gRPC Stream completed")
+
+		return err
+	}
+}
+
+// withStatus adds the gRPC status code and error details to the log event.
+func withStatus(logEvent *zerolog.Event, err error) *zerolog.Event {
+	if err == nil {
+		return logEvent.Int("status", int(codes.OK))
+	}
+
+	st, ok := status.FromError(err)
+	if ok {
+		return logEvent.
+			Int("status", int(st.Code())).
+			Str("error", st.Message())
+	}
+
+	return logEvent.
+		Int("status", int(codes.Unknown)).
+		Str("error", err.Error())
+}
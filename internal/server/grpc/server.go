@@ -2,8 +2,13 @@ package grpc
 
 import (
 	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"io"
 	"net"
 	"net/http"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/bufbuild/protovalidate-go"
@@ -11,17 +16,30 @@ import (
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
 
 	pb "github.com/npavlov/go-metrics-service/gen/go/proto/metrics/v1"
 	"github.com/npavlov/go-metrics-service/internal/domain"
 	"github.com/npavlov/go-metrics-service/internal/model"
+	"github.com/npavlov/go-metrics-service/internal/server/apikey"
+	"github.com/npavlov/go-metrics-service/internal/server/clientip"
 	"github.com/npavlov/go-metrics-service/internal/server/config"
 	"github.com/npavlov/go-metrics-service/internal/server/db"
+	"github.com/npavlov/go-metrics-service/internal/server/hub"
+	"github.com/npavlov/go-metrics-service/internal/server/policy"
+	"github.com/npavlov/go-metrics-service/internal/server/replay"
+	"github.com/npavlov/go-metrics-service/internal/server/tenant"
+	"github.com/npavlov/go-metrics-service/internal/tlsconfig"
 	"github.com/npavlov/go-metrics-service/internal/utils"
 	"github.com/npavlov/go-metrics-service/pkg/crypto"
 )
 
+// defaultPageSize is used by ListMetrics when the request does not set a page size.
+const defaultPageSize = 100
+
 type Server struct {
 	pb.UnimplementedMetricServiceServer
 	repo      model.Repository // Repository for accessing metric data.
@@ -29,9 +47,29 @@ type Server struct {
 	cfg       *config.Config
 	gServer   *grpc.Server
 	validator protovalidate.Validator
+	hub       *hub.Hub
+	tls       *tls.Config
 }
 
+// NewGRPCServer creates the server, the key registry and the replay guard are created from the config.
 func NewGRPCServer(repo model.Repository, cfg *config.Config, logger *zerolog.Logger) *Server {
+	keys, err := apikey.NewRegistry(cfg.KeyFile, cfg.KeyReloadDur, logger)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("invalid key file")
+	}
+
+	return NewGRPCServerWithKeys(repo, cfg, keys, replay.NewGuard(cfg.SignatureSkewDur, cfg.NonceCacheSize), logger)
+}
+
+// NewGRPCServerWithKeys creates the server using the given key registry and replay guard, the HTTP routers
+// of the server share them, so a nonce accepted by one protocol is rejected by the others.
+func NewGRPCServerWithKeys(
+	repo model.Repository,
+	cfg *config.Config,
+	keys *apikey.Registry,
+	guard *replay.Guard,
+	logger *zerolog.Logger,
+) *Server {
 	var decryption *crypto.Decryption
 
 	if key := cfg.CryptoKey; key != "" {
@@ -39,6 +77,7 @@ func NewGRPCServer(repo model.Repository, cfg *config.Config, logger *zerolog.Lo
 		if decryption, err = crypto.NewDecryption(key); err != nil {
 			logger.Fatal().Err(err).Msg("failed to create decryption")
 		}
+		decryption.Legacy = cfg.CryptoLegacy
 	}
 
 	validator, err := protovalidate.New()
@@ -46,21 +85,84 @@ func NewGRPCServer(repo model.Repository, cfg *config.Config, logger *zerolog.Lo
 		logger.Fatal().Err(err).Msg("failed to create validator")
 	}
 
+	tenantKeys, err := tenant.ParseKeys(cfg.TenantKeys)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("invalid tenant keys")
+	}
+
+	resolver, err := clientip.NewResolver(cfg.TrustedProxies)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("invalid trusted proxies")
+	}
+
+	filter, err := clientip.NewFilter(strings.Split(cfg.TrustedSubnet, ","), cfg.DeniedSubnets)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("invalid subnets")
+	}
+
+	if cfg.TLSClientCA != "" && cfg.GatewayTLSCert == "" {
+		logger.Fatal().Msg("gateway client certificate is required with mutual TLS")
+	}
+
+	gateway, err := tlsconfig.CertificateIdentity(cfg.GatewayTLSCert)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("invalid gateway certificate")
+	}
+
+	unary := []grpc.UnaryServerInterceptor{
+		LoggingServerInterceptor(logger), // Logs all requests/responses
+		SourceInterceptor(resolver, gateway),
+		TenantInterceptor(logger),
+		SubnetInterceptor(filter, gateway, logger),
+		DecryptInterceptor(decryption, logger),
+	}
+	stream := []grpc.StreamServerInterceptor{
+		LoggingStreamServerInterceptor(logger),
+		SourceStreamInterceptor(resolver, gateway),
+		TenantStreamInterceptor(logger),
+		SubnetStreamInterceptor(filter, gateway, logger),
+		DecryptStreamInterceptor(decryption, logger),
+	}
+
+	if keys != nil {
+		unary = append(unary, KeyInterceptor(keys, cfg.Key != "", guard, logger))
+		stream = append(stream, KeyStreamInterceptor(keys, cfg.Key != "", guard, logger))
+	}
+
+	// with a key registry the shared key is optional
+	if keys == nil || cfg.Key != "" {
+		unary = append(unary, SigInterceptor(cfg.Key, tenantKeys, guard, logger))
+		stream = append(stream, SigStreamInterceptor(cfg.Key, tenantKeys, guard, logger))
+	}
+
+	tlsConfig, err := tlsconfig.NewServer(cfg.TLSCert, cfg.TLSKey, cfg.TLSClientCA, cfg.TLSClientNames)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("invalid tls config")
+	}
+
+	options := []grpc.ServerOption{grpc.ChainUnaryInterceptor(unary...), grpc.ChainStreamInterceptor(stream...)}
+	if tlsConfig != nil {
+		options = append(options, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+
 	//nolint:exhaustruct
 	return &Server{
-		repo:   repo,
-		logger: logger,
-		cfg:    cfg,
-		gServer: grpc.NewServer(grpc.ChainUnaryInterceptor(
-			LoggingServerInterceptor(logger), // Logs all requests/responses
-			SubnetInterceptor(cfg.TrustedSubnet, logger),
-			DecryptInterceptor(decryption, logger),
-			SigInterceptor(cfg.Key, logger),
-		)),
+		repo:      repo,
+		logger:    logger,
+		cfg:       cfg,
+		gServer:   grpc.NewServer(options...),
 		validator: validator,
+		tls:       tlsConfig,
 	}
 }
 
+// WithHub enables WatchMetrics using the given change hub.
+func (gs *Server) WithHub(changeHub *hub.Hub) *Server {
+	gs.hub = changeHub
+
+	return gs
+}
+
 func (gs *Server) Start(ctx context.Context) {
 	// Start gRPC-server in goroutine
 	go func() {
@@ -79,8 +181,11 @@ func (gs *Server) Start(ctx context.Context) {
 
 	// Start gRPC-Gateway in another goroutine
 	go func() {
-		mux := runtime.NewServeMux()
-		opts := []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+		mux := runtime.NewServeMux(
+			runtime.WithMetadata(gatewayMetadata),
+			runtime.WithIncomingHeaderMatcher(gatewayHeaderMatcher),
+		)
+		opts := []grpc.DialOption{grpc.WithTransportCredentials(gs.gatewayCredentials())}
 
 		// Register gRPC-Gateway handlers
 		err := pb.RegisterMetricServiceHandlerFromEndpoint(ctx, mux, gs.cfg.GRPCAddress, opts)
@@ -94,10 +199,16 @@ func (gs *Server) Start(ctx context.Context) {
 			ReadTimeout:  1 * time.Second,
 			WriteTimeout: 1 * time.Second,
 			Handler:      mux,
+			TLSConfig:    gs.tls,
+		}
+
+		listen := server.ListenAndServe
+		if gs.tls != nil {
+			listen = func() error { return server.ListenAndServeTLS("", "") } //nolint:wrapcheck
 		}
 
 		gs.logger.Info().Str("address", gs.cfg.GRPCGateway).Msg("starting gRPC-Gateway")
-		if err := server.ListenAndServe(); err != nil {
+		if err := listen(); err != nil {
 			gs.logger.Fatal().Err(err).Msg("failed to start gRPC-Gateway")
 		}
 	}()
@@ -109,6 +220,26 @@ func (gs *Server) Start(ctx context.Context) {
 	}()
 }
 
+// gatewayCredentials returns the credentials the gateway dials the gRPC server with. Over TLS the gateway verifies
+// the server certificate with the CA of the config and presents its own client certificate.
+func (gs *Server) gatewayCredentials() credentials.TransportCredentials {
+	if gs.tls == nil {
+		return insecure.NewCredentials()
+	}
+
+	host, _, err := net.SplitHostPort(gs.cfg.GRPCAddress)
+	if err != nil || host == "" {
+		host = "localhost"
+	}
+
+	tlsConfig, err := tlsconfig.NewClient(gs.cfg.TLSCA, gs.cfg.GatewayTLSCert, gs.cfg.GatewayTLSKey, host)
+	if err != nil {
+		gs.logger.Fatal().Err(err).Msg("invalid gateway tls config")
+	}
+
+	return credentials.NewTLS(tlsConfig)
+}
+
 func (gs *Server) SetMetrics(
 	ctx context.Context,
 	in *pb.SetMetricsRequest,
@@ -117,58 +248,88 @@ func (gs *Server) SetMetrics(
 		return nil, errors.Wrap(err, "error validating input")
 	}
 
-	newMetrics := make([]*db.Metric, 0, len(in.GetItems()))
-
-	for _, metric := range in.GetItems() {
-		newMetrics = append(newMetrics, utils.FromGModelToDBModel(metric))
+	newDBMetrics, err := gs.applyMetrics(ctx, in.GetItems())
+	if err != nil {
+		return nil, err
 	}
 
-	// Collect metric IDs for database retrieval
-	metricIDs := make([]domain.MetricName, len(in.GetItems()))
-	for i, metric := range in.GetItems() {
-		metricIDs[i] = domain.MetricName(metric.GetId())
+	newGRPcMetrics := make([]*pb.Metric, 0, len(newDBMetrics))
+	for _, metric := range newDBMetrics {
+		newGRPcMetrics = append(newGRPcMetrics, utils.FromDBModelToGModel(&metric))
 	}
 
-	// Fetch old metrics for updating existing ones
-	oldMetrics, err := gs.repo.GetMany(ctx, metricIDs)
-	if err != nil {
-		gs.logger.Error().Err(err).Msg("error getting old metrics")
+	return &pb.SetMetricsResponse{
+		Status: true,
+		Items:  newGRPcMetrics,
+	}, nil
+}
 
-		return nil, errors.Wrap(err, "error getting old metrics")
-	}
+// StreamMetrics applies every received batch as SetMetrics does and
+// responds with the latest state of all touched metrics once the client closes the stream.
+func (gs *Server) StreamMetrics(stream grpc.ClientStreamingServer[pb.SetMetricsRequest, pb.SetMetricsResponse]) error {
+	touched := make(map[domain.MetricName]db.Metric)
 
-	// Prepare new metrics by updating existing ones or creating new entries
-	for _, metric := range newMetrics {
-		if oldMetric, found := oldMetrics[metric.ID]; found {
-			oldMetric.SetValue(metric.Delta, metric.Value)
-			oldMetrics[metric.ID] = oldMetric
-		} else {
-			oldMetrics[metric.ID] = *metric
+	for {
+		in, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
 		}
-	}
 
-	// Prepare the newMetrics slice with the updated oldMetrics
-	newDBMetrics := make([]db.Metric, 0, len(oldMetrics))
+		if err != nil {
+			return errors.Wrap(err, "error receiving metrics")
+		}
 
-	// Add all metrics from oldMetrics to newMetrics
-	for _, oldMetric := range oldMetrics {
-		newDBMetrics = append(newDBMetrics, oldMetric)
-	}
+		if err := gs.validator.Validate(in); err != nil {
+			return errors.Wrap(err, "error validating input")
+		}
 
-	// Update all metrics in the repository
-	if err = gs.repo.UpdateMany(ctx, &newDBMetrics); err != nil {
-		return nil, errors.Wrap(err, "error updating old metrics")
+		newDBMetrics, err := gs.applyMetrics(stream.Context(), in.GetItems())
+		if err != nil {
+			return err
+		}
+
+		for _, metric := range newDBMetrics {
+			touched[metric.SeriesID()] = metric
+		}
 	}
 
-	newGRPcMetrics := make([]*pb.Metric, 0, len(newDBMetrics))
-	for _, metric := range newDBMetrics {
-		newGRPcMetrics = append(newGRPcMetrics, utils.FromDBModelToGModel(&metric))
+	items := make([]*pb.Metric, 0, len(touched))
+	for _, metric := range touched {
+		items = append(items, utils.FromDBModelToGModel(&metric))
 	}
 
-	return &pb.SetMetricsResponse{
+	err := stream.SendAndClose(&pb.SetMetricsResponse{
 		Status: true,
-		Items:  newGRPcMetrics,
-	}, nil
+		Items:  items,
+	})
+
+	return errors.Wrap(err, "error sending response")
+}
+
+// applyMetrics merges incoming metrics into the stored ones and returns the result.
+func (gs *Server) applyMetrics(ctx context.Context, items []*pb.Metric) ([]db.Metric, error) {
+	newMetrics := make([]db.Metric, 0, len(items))
+
+	for _, metric := range items {
+		newMetric := utils.FromGModelToDBModel(metric)
+		if err := newMetric.Labels.Validate(); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "metric %s: %v", metric.GetId(), err)
+		}
+		if err := newMetric.ValidateDistribution(); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "metric %s: %v", metric.GetId(), err)
+		}
+
+		newMetrics = append(newMetrics, *newMetric)
+	}
+
+	newDBMetrics, err := gs.repo.ApplyDeltas(ctx, newMetrics)
+	if err != nil {
+		gs.logger.Error().Err(err).Msg("error applying metrics")
+
+		return nil, writeError(err, "error applying metrics")
+	}
+
+	return newDBMetrics, nil
 }
 
 func (gs *Server) SetMetric(
@@ -181,36 +342,241 @@ func (gs *Server) SetMetric(
 		return nil, errors.Wrap(err, "error validating input")
 	}
 
-	existingMetric, found := gs.repo.Get(ctx, domain.MetricName(newMetric.GetId()))
+	dbMetric := utils.FromGModelToDBModel(newMetric)
+	if err := dbMetric.Labels.Validate(); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "metric %s: %v", newMetric.GetId(), err)
+	}
+	if err := dbMetric.ValidateDistribution(); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "metric %s: %v", newMetric.GetId(), err)
+	}
+
+	applied, err := gs.repo.ApplyDeltas(ctx, []db.Metric{*dbMetric})
+	if err != nil {
+		return nil, writeError(err, "error applying metric")
+	}
+
+	return &pb.SetMetricResponse{
+		Status: true,
+		Metric: utils.FromDBModelToGModel(&applied[0]),
+	}, nil
+}
+
+func (gs *Server) DeleteMetrics(
+	ctx context.Context,
+	in *pb.DeleteMetricsRequest,
+) (*pb.DeleteMetricsResponse, error) {
+	if err := gs.validator.Validate(in); err != nil {
+		return nil, errors.Wrap(err, "error validating input")
+	}
+
+	metricIDs := make([]domain.MetricName, len(in.GetIds()))
+	for i, id := range in.GetIds() {
+		metricIDs[i] = domain.MetricName(id)
+	}
 
-	if found {
-		delta := newMetric.GetDelta()
-		val := newMetric.GetValue()
+	deleted, err := gs.repo.DeleteMany(ctx, metricIDs)
+	if err != nil {
+		gs.logger.Error().Err(err).Msg("error deleting metrics")
 
-		existingMetric.SetValue(&delta, &val)
+		return nil, errors.Wrap(err, "error deleting metrics")
+	}
 
-		err := gs.repo.Update(ctx, existingMetric)
-		if err != nil {
-			return nil, errors.Wrap(err, "error updating existingMetric")
-		}
+	ids := make([]string, len(deleted))
+	for i, id := range deleted {
+		ids[i] = string(id)
+	}
+
+	return &pb.DeleteMetricsResponse{
+		Status: true,
+		Ids:    ids,
+	}, nil
+}
+
+func (gs *Server) GetMetric(
+	ctx context.Context,
+	in *pb.GetMetricRequest,
+) (*pb.GetMetricResponse, error) {
+	if err := gs.validator.Validate(in); err != nil {
+		return nil, errors.Wrap(err, "error validating input")
+	}
+
+	metric, found := gs.repo.Get(ctx, domain.MetricName(in.GetId()))
+	if !found {
+		return nil, status.Errorf(codes.NotFound, "metric %s not found", in.GetId())
+	}
 
-		grpcModel := utils.FromDBModelToGModel(existingMetric)
+	return &pb.GetMetricResponse{
+		Status: true,
+		Metric: utils.FromDBModelToGModel(metric),
+	}, nil
+}
 
-		return &pb.SetMetricResponse{
-			Status: true,
-			Metric: grpcModel,
-		}, nil
+func (gs *Server) GetMetrics(
+	ctx context.Context,
+	in *pb.GetMetricsRequest,
+) (*pb.GetMetricsResponse, error) {
+	if err := gs.validator.Validate(in); err != nil {
+		return nil, errors.Wrap(err, "error validating input")
 	}
 
-	dbMetric := utils.FromGModelToDBModel(newMetric)
+	metricIDs := make([]domain.MetricName, len(in.GetIds()))
+	for i, id := range in.GetIds() {
+		metricIDs[i] = domain.MetricName(id)
+	}
 
-	err := gs.repo.Create(ctx, dbMetric)
+	metrics, err := gs.repo.GetMany(ctx, metricIDs)
 	if err != nil {
-		return nil, errors.Wrap(err, "error creating newMetric")
+		gs.logger.Error().Err(err).Msg("error getting metrics")
+
+		return nil, errors.Wrap(err, "error getting metrics")
 	}
 
-	return &pb.SetMetricResponse{
+	// Keep the order of the requested ids, unknown and repeated ids are skipped
+	items := make([]*pb.Metric, 0, len(metrics))
+	for _, id := range metricIDs {
+		if metric, found := metrics[id]; found {
+			items = append(items, utils.FromDBModelToGModel(&metric))
+			delete(metrics, id)
+		}
+	}
+
+	return &pb.GetMetricsResponse{
 		Status: true,
-		Metric: newMetric,
+		Items:  items,
 	}, nil
 }
+
+// ListMetrics returns metrics ordered by name, one page at a time.
+// The page token is the opaque encoding of the last name of the previous page.
+func (gs *Server) ListMetrics(
+	ctx context.Context,
+	in *pb.ListMetricsRequest,
+) (*pb.ListMetricsResponse, error) {
+	if err := gs.validator.Validate(in); err != nil {
+		return nil, errors.Wrap(err, "error validating input")
+	}
+
+	after, err := decodePageToken(in.GetPageToken())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid page token")
+	}
+
+	pageSize := int(in.GetPageSize())
+	if pageSize == 0 {
+		pageSize = defaultPageSize
+	}
+
+	metrics := gs.repo.GetAll(ctx)
+
+	names := make([]domain.MetricName, 0, len(metrics))
+	for name, metric := range metrics {
+		if after != "" && name <= after {
+			continue
+		}
+
+		if !strings.HasPrefix(string(name), in.GetPrefix()) {
+			continue
+		}
+
+		if in.GetMtype() != pb.Metric_TYPE_UNSPECIFIED &&
+			utils.FromDBModelToGModel(metric).GetMtype() != in.GetMtype() {
+			continue
+		}
+
+		names = append(names, name)
+	}
+
+	sort.Slice(names, func(i, j int) bool {
+		return names[i] < names[j]
+	})
+
+	nextPageToken := ""
+	if len(names) > pageSize {
+		names = names[:pageSize]
+		nextPageToken = encodePageToken(names[pageSize-1])
+	}
+
+	items := make([]*pb.Metric, 0, len(names))
+	for _, name := range names {
+		items = append(items, utils.FromDBModelToGModel(metrics[name]))
+	}
+
+	return &pb.ListMetricsResponse{
+		Status:        true,
+		Items:         items,
+		NextPageToken: nextPageToken,
+	}, nil
+}
+
+// writeError wraps the error of a failed write, rejections by the series policy get their own status code.
+func writeError(err error, message string) error {
+	switch {
+	case errors.Is(err, policy.ErrInvalidName):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, policy.ErrDenied):
+		return status.Error(codes.PermissionDenied, err.Error())
+	case errors.Is(err, policy.ErrSeriesLimit), errors.Is(err, policy.ErrSourceLimit):
+		return status.Error(codes.ResourceExhausted, err.Error())
+	}
+
+	return errors.Wrap(err, message)
+}
+
+func encodePageToken(name domain.MetricName) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(name))
+}
+
+func decodePageToken(token string) (domain.MetricName, error) {
+	name, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return "", errors.Wrap(err, "error decoding page token")
+	}
+
+	return domain.MetricName(name), nil
+}
+
+// WatchMetrics streams changes of the requested metrics until the client cancels the call.
+func (gs *Server) WatchMetrics(
+	in *pb.WatchMetricsRequest,
+	stream grpc.ServerStreamingServer[pb.WatchMetricsResponse],
+) error {
+	if err := gs.validator.Validate(in); err != nil {
+		return errors.Wrap(err, "error validating input")
+	}
+
+	if gs.hub == nil {
+		return status.Error(codes.Unavailable, "change notifications are not enabled")
+	}
+
+	names := make([]domain.MetricName, len(in.GetIds()))
+	for i, id := range in.GetIds() {
+		names[i] = domain.MetricName(id)
+	}
+
+	subscription := gs.hub.Subscribe(tenant.FromContext(stream.Context()), names)
+	defer gs.hub.Unsubscribe(subscription)
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case event, ok := <-subscription.Events():
+			if !ok {
+				return nil
+			}
+
+			eventType := pb.WatchMetricsResponse_EVENT_TYPE_UPDATE
+			if event.Type == hub.EventDelete {
+				eventType = pb.WatchMetricsResponse_EVENT_TYPE_DELETE
+			}
+
+			err := stream.Send(&pb.WatchMetricsResponse{
+				Type:   eventType,
+				Metric: utils.FromDBModelToGModel(&event.Metric),
+			})
+			if err != nil {
+				return errors.Wrap(err, "error sending metric event")
+			}
+		}
+	}
+}
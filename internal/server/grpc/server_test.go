@@ -2,14 +2,26 @@ package grpc_test
 
 import (
 	"context"
+	"net"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	gogrpc "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
 
 	pb "github.com/npavlov/go-metrics-service/gen/go/proto/metrics/v1"
+	"github.com/npavlov/go-metrics-service/internal/domain"
 	"github.com/npavlov/go-metrics-service/internal/server/config"
+	"github.com/npavlov/go-metrics-service/internal/server/db"
 	"github.com/npavlov/go-metrics-service/internal/server/grpc"
+	"github.com/npavlov/go-metrics-service/internal/server/hub"
+	"github.com/npavlov/go-metrics-service/internal/server/policy"
 	"github.com/npavlov/go-metrics-service/internal/server/storage"
 	testutils "github.com/npavlov/go-metrics-service/internal/test_utils"
 )
@@ -37,7 +49,34 @@ func TestSetMetric(t *testing.T) {
 	resp, err := server.SetMetric(context.Background(), req)
 	require.NoError(t, err)
 	assert.True(t, resp.GetStatus())
-	assert.Equal(t, req.GetMetric(), resp.GetMetric())
+	assert.True(t, proto.Equal(req.GetMetric(), resp.GetMetric()))
+
+	// the counter is incremented by the storage
+	resp, err = server.SetMetric(context.Background(), req)
+	require.NoError(t, err)
+	assert.Equal(t, int64(200), resp.GetMetric().GetDelta())
+}
+
+func TestSetMetricsRejectedByPolicy(t *testing.T) {
+	t.Parallel()
+
+	logger := testutils.GetTLogger()
+	//nolint:exhaustruct
+	cfg := &config.Config{Key: "test-policy-secret", MaxSeries: 1}
+	seriesPolicy, err := policy.NewPolicy(cfg, logger)
+	require.NoError(t, err)
+
+	repo, err := policy.NewRepository(context.Background(), storage.NewMemStorage(logger), seriesPolicy)
+	require.NoError(t, err)
+	server := grpc.NewGRPCServer(repo, cfg, logger)
+
+	_, err = server.SetMetrics(context.Background(), &pb.SetMetricsRequest{
+		Items: []*pb.Metric{
+			{Id: "first", Mtype: pb.Metric_TYPE_COUNTER, Delta: int64Ptr(1)},
+			{Id: "second", Mtype: pb.Metric_TYPE_COUNTER, Delta: int64Ptr(1)},
+		},
+	})
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
 }
 
 // Test SetMetrics.
@@ -85,3 +124,277 @@ func TestSetMetrics(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, int64(200), resp2.GetMetric().GetDelta())
 }
+
+// Test DeleteMetrics.
+func TestDeleteMetrics(t *testing.T) {
+	t.Parallel()
+
+	logger := testutils.GetTLogger()
+	cfg := &config.Config{
+		Key: "test-delete-secret",
+	}
+	memStorage := storage.NewMemStorage(logger)
+	server := grpc.NewGRPCServer(memStorage, cfg, logger)
+
+	_, err := server.SetMetric(context.Background(), &pb.SetMetricRequest{
+		Metric: &pb.Metric{
+			Id:    "test_metric",
+			Mtype: pb.Metric_TYPE_GAUGE,
+			Value: float64Ptr(42.2),
+		},
+	})
+	require.NoError(t, err)
+
+	resp, err := server.DeleteMetrics(context.Background(), &pb.DeleteMetricsRequest{
+		Ids: []string{"test_metric", "unknown"},
+	})
+	require.NoError(t, err)
+	assert.True(t, resp.GetStatus())
+	assert.Equal(t, []string{"test_metric"}, resp.GetIds())
+
+	_, found := memStorage.Get(context.Background(), "test_metric")
+	assert.False(t, found)
+
+	_, err = server.DeleteMetrics(context.Background(), &pb.DeleteMetricsRequest{})
+	require.Error(t, err)
+}
+
+// Test GetMetric and GetMetrics.
+func TestGetMetrics(t *testing.T) {
+	t.Parallel()
+
+	logger := testutils.GetTLogger()
+	cfg := &config.Config{
+		Key: "test-get-secret",
+	}
+	memStorage := storage.NewMemStorage(logger)
+	server := grpc.NewGRPCServer(memStorage, cfg, logger)
+
+	_, err := server.SetMetrics(context.Background(), &pb.SetMetricsRequest{
+		Items: []*pb.Metric{
+			{Id: "test_metric", Mtype: pb.Metric_TYPE_COUNTER, Delta: int64Ptr(100)},
+			{Id: "test_metric2", Mtype: pb.Metric_TYPE_GAUGE, Value: float64Ptr(42.2)},
+		},
+	})
+	require.NoError(t, err)
+
+	resp, err := server.GetMetric(context.Background(), &pb.GetMetricRequest{Id: "test_metric"})
+	require.NoError(t, err)
+	assert.True(t, resp.GetStatus())
+	assert.Equal(t, int64(100), resp.GetMetric().GetDelta())
+
+	_, err = server.GetMetric(context.Background(), &pb.GetMetricRequest{Id: "unknown"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	resp2, err := server.GetMetrics(context.Background(), &pb.GetMetricsRequest{
+		Ids: []string{"test_metric2", "unknown", "test_metric"},
+	})
+	require.NoError(t, err)
+	require.Len(t, resp2.GetItems(), 2)
+	assert.Equal(t, "test_metric2", resp2.GetItems()[0].GetId())
+	assert.Equal(t, "test_metric", resp2.GetItems()[1].GetId())
+}
+
+// Test ListMetrics.
+func TestListMetrics(t *testing.T) {
+	t.Parallel()
+
+	logger := testutils.GetTLogger()
+	cfg := &config.Config{
+		Key: "test-list-secret",
+	}
+	memStorage := storage.NewMemStorage(logger)
+	server := grpc.NewGRPCServer(memStorage, cfg, logger)
+
+	_, err := server.SetMetrics(context.Background(), &pb.SetMetricsRequest{
+		Items: []*pb.Metric{
+			{Id: "a_counter", Mtype: pb.Metric_TYPE_COUNTER, Delta: int64Ptr(1)},
+			{Id: "b_gauge", Mtype: pb.Metric_TYPE_GAUGE, Value: float64Ptr(2)},
+			{Id: "b_counter", Mtype: pb.Metric_TYPE_COUNTER, Delta: int64Ptr(3)},
+			{Id: "c_gauge", Mtype: pb.Metric_TYPE_GAUGE, Value: float64Ptr(4)},
+		},
+	})
+	require.NoError(t, err)
+
+	ids := func(items []*pb.Metric) []string {
+		result := make([]string, 0, len(items))
+		for _, item := range items {
+			result = append(result, item.GetId())
+		}
+
+		return result
+	}
+
+	page1, err := server.ListMetrics(context.Background(), &pb.ListMetricsRequest{PageSize: 3})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a_counter", "b_counter", "b_gauge"}, ids(page1.GetItems()))
+	assert.NotEmpty(t, page1.GetNextPageToken())
+
+	page2, err := server.ListMetrics(context.Background(), &pb.ListMetricsRequest{
+		PageSize:  3,
+		PageToken: page1.GetNextPageToken(),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"c_gauge"}, ids(page2.GetItems()))
+	assert.Empty(t, page2.GetNextPageToken())
+
+	filtered, err := server.ListMetrics(context.Background(), &pb.ListMetricsRequest{
+		Mtype:  pb.Metric_TYPE_GAUGE,
+		Prefix: "b_",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"b_gauge"}, ids(filtered.GetItems()))
+
+	_, err = server.ListMetrics(context.Background(), &pb.ListMetricsRequest{PageToken: "!!"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+// Test WatchMetrics.
+func TestWatchMetrics(t *testing.T) {
+	t.Parallel()
+
+	logger := testutils.GetTLogger()
+	cfg := &config.Config{
+		Key: "test-watch-secret",
+	}
+	changeHub := hub.NewHub(logger)
+	memStorage := storage.NewMemStorage(logger).WithHub(changeHub)
+
+	listener := bufconn.Listen(1024 * 1024)
+	server := gogrpc.NewServer()
+	pb.RegisterMetricServiceServer(server, grpc.NewGRPCServer(memStorage, cfg, logger).WithHub(changeHub))
+
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	t.Cleanup(server.Stop)
+
+	conn, err := gogrpc.NewClient("passthrough:///bufnet",
+		gogrpc.WithContextDialer(func(_ context.Context, _ string) (net.Conn, error) {
+			return listener.Dial()
+		}),
+		gogrpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = conn.Close()
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream, err := pb.NewMetricServiceClient(conn).WatchMetrics(ctx, &pb.WatchMetricsRequest{
+		Ids: []string{"test_metric"},
+	})
+	require.NoError(t, err)
+
+	// The subscription is registered asynchronously, keep writing until the first event arrives
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(10 * time.Millisecond)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				_ = memStorage.Create(ctx, db.NewMetric("other_metric", domain.Gauge, nil, float64Ptr(1)))
+				_ = memStorage.Create(ctx, db.NewMetric("test_metric", domain.Gauge, nil, float64Ptr(42.2)))
+			}
+		}
+	}()
+
+	event, err := stream.Recv()
+	close(done)
+	require.NoError(t, err)
+	assert.Equal(t, pb.WatchMetricsResponse_EVENT_TYPE_UPDATE, event.GetType())
+	assert.Equal(t, "test_metric", event.GetMetric().GetId())
+
+	_, err = memStorage.Delete(ctx, "test_metric", domain.Gauge)
+	require.NoError(t, err)
+
+	for {
+		event, err = stream.Recv()
+		require.NoError(t, err)
+
+		if event.GetType() == pb.WatchMetricsResponse_EVENT_TYPE_DELETE {
+			break
+		}
+	}
+	assert.Equal(t, "test_metric", event.GetMetric().GetId())
+}
+
+// Test WatchMetrics for the deletion of a labeled series.
+func TestWatchMetricsLabeledDelete(t *testing.T) {
+	t.Parallel()
+
+	logger := testutils.GetTLogger()
+	cfg := &config.Config{
+		Key: "test-watch-secret",
+	}
+	changeHub := hub.NewHub(logger)
+	memStorage := storage.NewMemStorage(logger).WithHub(changeHub)
+
+	listener := bufconn.Listen(1024 * 1024)
+	server := gogrpc.NewServer()
+	pb.RegisterMetricServiceServer(server, grpc.NewGRPCServer(memStorage, cfg, logger).WithHub(changeHub))
+
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	t.Cleanup(server.Stop)
+
+	conn, err := gogrpc.NewClient("passthrough:///bufnet",
+		gogrpc.WithContextDialer(func(_ context.Context, _ string) (net.Conn, error) {
+			return listener.Dial()
+		}),
+		gogrpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = conn.Close()
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream, err := pb.NewMetricServiceClient(conn).WatchMetrics(ctx, &pb.WatchMetricsRequest{
+		Ids: []string{"cpu"},
+	})
+	require.NoError(t, err)
+
+	labels := domain.Labels{"core": "0"}
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(10 * time.Millisecond)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				_ = memStorage.Create(ctx, db.NewMetric("cpu", domain.Gauge, nil, float64Ptr(0.5)).WithLabels(labels))
+			}
+		}
+	}()
+
+	event, err := stream.Recv()
+	close(done)
+	require.NoError(t, err)
+	assert.Equal(t, pb.WatchMetricsResponse_EVENT_TYPE_UPDATE, event.GetType())
+
+	// the subscription by the base name receives the deletion of the series
+	_, err = memStorage.DeleteMany(ctx, []domain.MetricName{domain.SeriesID("cpu", labels)})
+	require.NoError(t, err)
+
+	for {
+		event, err = stream.Recv()
+		require.NoError(t, err)
+
+		if event.GetType() == pb.WatchMetricsResponse_EVENT_TYPE_DELETE {
+			break
+		}
+	}
+	assert.Equal(t, "cpu", event.GetMetric().GetId())
+	assert.Equal(t, map[string]string(labels), event.GetMetric().GetLabels())
+}
@@ -6,34 +6,50 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"hash"
+	"net/http"
 	"sync"
 
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
 
+	"github.com/npavlov/go-metrics-service/internal/domain"
+	"github.com/npavlov/go-metrics-service/internal/server/apikey"
+	"github.com/npavlov/go-metrics-service/internal/server/replay"
+	"github.com/npavlov/go-metrics-service/internal/server/tenant"
 	"github.com/npavlov/go-metrics-service/internal/utils"
 )
 
-// SigInterceptor checks if the request signature is valid.
-func SigInterceptor(signKey string, log *zerolog.Logger) grpc.UnaryServerInterceptor {
-	if signKey == "" {
-		log.Fatal().Msg("signKey must be provided for signature verification")
-	}
+// signatureField is the field of streamed request messages that carries their signature.
+const signatureField = "signature"
 
-	hPool := &sync.Pool{
-		New: func() interface{} {
-			return hmac.New(sha256.New, []byte(signKey))
-		},
-	}
+// SigInterceptor checks if the request signature is valid.
+// A request signed with the key of a tenant belongs to that tenant, a request to a tenant that has a key
+// must be signed with it, see tenant.Keys.Resolve. The signature covers the method, the timestamp
+// and the nonce of the request, the guard rejects replayed requests.
+func SigInterceptor(
+	signKey string,
+	keys tenant.Keys,
+	guard *replay.Guard,
+	log *zerolog.Logger,
+) grpc.UnaryServerInterceptor {
+	hPool := newHMACPool(signKey, log)
 
 	return func(
 		ctx context.Context,
 		req interface{},
-		_ *grpc.UnaryServerInfo,
+		info *grpc.UnaryServerInfo,
 		handler grpc.UnaryHandler,
 	) (interface{}, error) {
+		// the request is signed with a key of the registry, see KeyInterceptor
+		if _, ok := apikey.FromContext(ctx); ok {
+			return handler(ctx, req)
+		}
+
 		md, ok := metadata.FromIncomingContext(ctx)
 		if !ok {
 			log.Error().Msg("missing metadata in request")
@@ -48,34 +64,204 @@ func SigInterceptor(signKey string, log *zerolog.Logger) grpc.UnaryServerInterce
 			return nil, errors.New("missing HashSHA256 header")
 		}
 
-		expectedSignature := signatures[0]
+		timestamp, nonce := firstValue(md, utils.TimestampHeader), firstValue(md, utils.NonceHeader)
 
-		// Serialize the request payload
-		payload, err := utils.MarshalProtoMessage(req)
+		payload, err := signedMessage(req, info.FullMethod, timestamp, nonce, guard, log)
 		if err != nil {
-			log.Error().Err(err).Msg("failed to marshal request")
+			return nil, err
+		}
 
-			return nil, errors.New("failed to marshal request")
+		signedBy, err := verifySignature(hPool, keys, signatures[0], payload, log)
+		if err != nil {
+			return nil, err
 		}
 
-		// Compute HMAC signature
-		hmacWriter, ok := hPool.Get().(hash.Hash)
-		if !ok {
-			log.Error().Msg("failed to get HMAC instance")
+		if err := guard.Check(timestamp, nonce); err != nil {
+			log.Warn().Err(err).Msg("replayed request")
 
-			return nil, errors.New("internal server error")
+			return nil, status.Error(codes.Unauthenticated, err.Error())
 		}
-		defer hPool.Put(hmacWriter)
 
-		hmacWriter.Reset()
-		hmacWriter.Write(payload)
-		computedSignature := hex.EncodeToString(hmacWriter.Sum(nil))
+		ctx, err = keys.Resolve(ctx, signedBy)
+		if err != nil {
+			log.Warn().Err(err).Msg("tenant rejected")
 
-		// Compare the expected vs computed signature
-		if computedSignature != expectedSignature {
-			return nil, errors.New("invalid signature")
+			return nil, status.Error(codes.PermissionDenied, err.Error())
 		}
 
 		return handler(ctx, req)
 	}
 }
+
+// SigStreamInterceptor checks the signature of every message received on a stream.
+// Stream metadata is sent once, so each message carries its own signature field.
+// The tenant of a stream is named by its metadata, every message must be signed for that tenant.
+// The timestamp and the nonce of a stream are sent in its metadata, every message is signed with the nonce
+// followed by its sequence number, see utils.StreamNonce.
+func SigStreamInterceptor(
+	signKey string,
+	keys tenant.Keys,
+	guard *replay.Guard,
+	log *zerolog.Logger,
+) grpc.StreamServerInterceptor {
+	hPool := newHMACPool(signKey, log)
+
+	return func(
+		srv interface{},
+		stream grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		// the stream is signed with a key of the registry, see KeyStreamInterceptor
+		if _, ok := apikey.FromContext(stream.Context()); ok {
+			return handler(srv, stream)
+		}
+
+		// the context of the stream is fixed, a message signed for another tenant is rejected
+		named := tenant.WithTenant(stream.Context(), tenant.FromContext(stream.Context()))
+		md, _ := metadata.FromIncomingContext(stream.Context())
+		timestamp, nonce := firstValue(md, utils.TimestampHeader), firstValue(md, utils.NonceHeader)
+		received := uint64(0)
+
+		return handler(srv, &recvStream{
+			ServerStream: stream,
+			afterRecv: func(msg interface{}) error {
+				request, signature, err := takeSignature(msg, log)
+				if err != nil {
+					return err
+				}
+
+				payload, err := signedMessage(request, info.FullMethod, timestamp,
+					utils.StreamNonce(nonce, received), guard, log)
+				if err != nil {
+					return err
+				}
+
+				signedBy, err := verifySignature(hPool, keys, signature, payload, log)
+				if err != nil {
+					return err
+				}
+
+				// the nonce of the stream is remembered once, the sequence numbers protect the later messages
+				if received == 0 {
+					if err := guard.Check(timestamp, nonce); err != nil {
+						log.Warn().Err(err).Msg("replayed stream")
+
+						return status.Error(codes.Unauthenticated, err.Error())
+					}
+				}
+				received++
+
+				if _, err := keys.Resolve(named, signedBy); err != nil {
+					log.Warn().Err(err).Msg("tenant rejected")
+
+					return status.Error(codes.PermissionDenied, err.Error())
+				}
+
+				return nil
+			},
+		})
+	}
+}
+
+// takeSignature removes the signature field from a streamed message and returns it,
+// the signature is calculated over the message without the signature itself.
+func takeSignature(msg interface{}, log *zerolog.Logger) (proto.Message, string, error) {
+	request, ok := msg.(proto.Message)
+	if !ok {
+		log.Error().Msg("invalid request type")
+
+		return nil, "", errors.New("invalid request type")
+	}
+
+	field := request.ProtoReflect().Descriptor().Fields().ByName(signatureField)
+	if field == nil {
+		log.Error().Msg("request does not support message signatures")
+
+		return nil, "", errors.New("invalid request type")
+	}
+
+	signature := request.ProtoReflect().Get(field).String()
+	if signature == "" {
+		log.Error().Msg("missing message signature")
+
+		return nil, "", errors.New("missing message signature")
+	}
+
+	request.ProtoReflect().Clear(field)
+
+	return request, signature, nil
+}
+
+func newHMACPool(signKey string, log *zerolog.Logger) *sync.Pool {
+	if signKey == "" {
+		log.Fatal().Msg("signKey must be provided for signature verification")
+	}
+
+	return &sync.Pool{
+		New: func() interface{} {
+			return hmac.New(sha256.New, []byte(signKey))
+		},
+	}
+}
+
+// signedMessage returns the material a message is signed over, see utils.SignedPayload.
+// A message without a timestamp is signed over its content only, it is accepted while the replay protection
+// is disabled.
+func signedMessage(
+	msg interface{},
+	method, timestamp, nonce string,
+	guard *replay.Guard,
+	log *zerolog.Logger,
+) ([]byte, error) {
+	payload, err := utils.MarshalProtoMessage(msg)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to marshal request")
+
+		return nil, errors.New("failed to marshal request")
+	}
+
+	if timestamp == "" {
+		if guard.Enabled() {
+			return nil, status.Error(codes.Unauthenticated, replay.ErrMissing.Error())
+		}
+
+		return payload, nil
+	}
+
+	return utils.SignedPayload(http.MethodPost, method, timestamp, nonce, payload), nil
+}
+
+// verifySignature checks the signature against the tenant keys and the key of the server,
+// returns the tenant whose key signed the request, empty for the key of the server.
+func verifySignature(
+	hPool *sync.Pool,
+	keys tenant.Keys,
+	expectedSignature string,
+	payload []byte,
+	log *zerolog.Logger,
+) (domain.Tenant, error) {
+	if owner, _, matched := keys.Match(payload, expectedSignature); matched {
+		return owner, nil
+	}
+
+	// Compute HMAC signature
+	hmacWriter, ok := hPool.Get().(hash.Hash)
+	if !ok {
+		log.Error().Msg("failed to get HMAC instance")
+
+		return "", errors.New("internal server error")
+	}
+	defer hPool.Put(hmacWriter)
+
+	hmacWriter.Reset()
+	hmacWriter.Write(payload)
+	computedSignature := hex.EncodeToString(hmacWriter.Sum(nil))
+
+	// Compare the expected vs computed signature
+	if computedSignature != expectedSignature {
+		return "", errors.New("invalid signature")
+	}
+
+	return "", nil
+}
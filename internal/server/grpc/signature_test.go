@@ -5,25 +5,35 @@ import (
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/hex"
+	"net/http"
+	"strconv"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	gogrpc "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 
 	pb "github.com/npavlov/go-metrics-service/gen/go/proto/metrics/v1"
 	"github.com/npavlov/go-metrics-service/internal/server/grpc"
+	"github.com/npavlov/go-metrics-service/internal/server/replay"
 	testutils "github.com/npavlov/go-metrics-service/internal/test_utils"
 	"github.com/npavlov/go-metrics-service/internal/utils"
 )
 
+//nolint:gochecknoglobals
+var unaryInfo = &gogrpc.UnaryServerInfo{Server: nil, FullMethod: pb.MetricService_SetMetric_FullMethodName}
+
 func TestSigInterceptor(t *testing.T) {
 	t.Parallel()
 
 	logger := testutils.GetTLogger()
 	signKey := "test-secret"
 
-	interceptor := grpc.SigInterceptor(signKey, logger)
+	interceptor := grpc.SigInterceptor(signKey, nil, nil, logger)
 
 	// Create request
 	req := &pb.SetMetricRequest{
@@ -42,8 +52,45 @@ func TestSigInterceptor(t *testing.T) {
 	md := metadata.Pairs("HashSHA256", expectedSignature)
 	ctx := metadata.NewIncomingContext(context.Background(), md)
 
-	resp, err := interceptor(ctx, req, nil, mockHandler)
+	resp, err := interceptor(ctx, req, unaryInfo, mockHandler)
 
 	require.NoError(t, err)
 	assert.Equal(t, "mockResponse", resp)
 }
+
+func TestSigInterceptorReplay(t *testing.T) {
+	t.Parallel()
+
+	logger := testutils.GetTLogger()
+	signKey := "test-secret"
+	interceptor := grpc.SigInterceptor(signKey, nil, replay.NewGuard(time.Minute, 100), logger)
+
+	req := &pb.SetMetricRequest{
+		Metric: &pb.Metric{Id: "test_metric", Mtype: pb.Metric_TYPE_COUNTER, Delta: int64Ptr(1)},
+	}
+	message, err := utils.MarshalProtoMessage(req)
+	require.NoError(t, err)
+
+	call := func(method string, signedAt time.Time, nonce string) error {
+		timestamp := strconv.FormatInt(signedAt.Unix(), 10)
+		signature := utils.CalculateHash(signKey, utils.SignedPayload(http.MethodPost, method, timestamp, nonce, message))
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+			"HashSHA256", signature, utils.TimestampHeader, timestamp, utils.NonceHeader, nonce))
+		_, err := interceptor(ctx, req, unaryInfo, mockHandler)
+
+		return err
+	}
+
+	require.NoError(t, call(unaryInfo.FullMethod, time.Now(), "first"))
+	assert.Equal(t, codes.Unauthenticated, status.Code(call(unaryInfo.FullMethod, time.Now(), "first")))
+	assert.Equal(t, codes.Unauthenticated, status.Code(call(unaryInfo.FullMethod, time.Now().Add(-time.Hour), "second")))
+
+	// a signature made for another method does not verify
+	require.Error(t, call(pb.MetricService_DeleteMetrics_FullMethodName, time.Now(), "third"))
+
+	// the body only signatures of older agents are rejected while the replay protection is enabled
+	ctx := metadata.NewIncomingContext(context.Background(),
+		metadata.Pairs("HashSHA256", utils.CalculateHash(signKey, message)))
+	_, err = interceptor(ctx, req, unaryInfo, mockHandler)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
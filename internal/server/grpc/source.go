@@ -0,0 +1,70 @@
+package grpc
+
+import (
+	"context"
+	"net"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+
+	"github.com/npavlov/go-metrics-service/internal/server/clientip"
+	"github.com/npavlov/go-metrics-service/internal/server/policy"
+)
+
+// contextStream wraps a server stream to replace its context.
+type contextStream struct {
+	grpc.ServerStream
+	//nolint:containedctx
+	ctx context.Context
+}
+
+func (s *contextStream) Context() context.Context {
+	return s.ctx
+}
+
+// SourceInterceptor stores the client address in the request context, the series policy limits the series per source
+// and the subnet filter checks it. gateway is the identity of the client certificate of the gateway, empty when it
+// does not present one, the address of its caller is the one it forwards, see fromGateway.
+func SourceInterceptor(resolver *clientip.Resolver, gateway string) grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req interface{},
+		_ *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		return handler(withSource(ctx, resolver, gateway), req)
+	}
+}
+
+// SourceStreamInterceptor stores the client address in the stream context.
+func SourceStreamInterceptor(resolver *clientip.Resolver, gateway string) grpc.StreamServerInterceptor {
+	return func(
+		srv interface{},
+		stream grpc.ServerStream,
+		_ *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		return handler(srv, &contextStream{ServerStream: stream, ctx: withSource(stream.Context(), resolver, gateway)})
+	}
+}
+
+// withSource resolves the client address from the peer address, the forwarded metadata is honored for the trusted
+// proxies of the resolver only, e.g. the gateway appends the address of its client to X-Forwarded-For.
+// The requests of the gateway are resolved from the X-Real-IP address it sets.
+func withSource(ctx context.Context, resolver *clientip.Resolver, gateway string) context.Context {
+	client, ok := peer.FromContext(ctx)
+	if !ok || client.Addr == nil {
+		return ctx
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	if realIP := firstValue(md, clientip.RealIPHeader); realIP != "" && fromGateway(ctx, gateway) {
+		return policy.WithSource(ctx, resolver.Resolve(net.JoinHostPort(realIP, "0"),
+			md.Get(clientip.ForwardedForHeader), ""))
+	}
+
+	return policy.WithSource(ctx, resolver.Resolve(client.Addr.String(),
+		md.Get(clientip.ForwardedForHeader), firstValue(md, clientip.RealIPHeader)))
+}
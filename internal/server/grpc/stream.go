@@ -0,0 +1,25 @@
+package grpc
+
+import (
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+)
+
+// recvStream wraps a server stream and processes every received message before the handler sees it.
+type recvStream struct {
+	grpc.ServerStream
+	afterRecv func(msg interface{}) error
+}
+
+func (s *recvStream) RecvMsg(msg interface{}) error {
+	if err := s.ServerStream.RecvMsg(msg); err != nil {
+		//nolint:wrapcheck
+		return err
+	}
+
+	if err := s.afterRecv(msg); err != nil {
+		return errors.Wrap(err, "failed to process received message")
+	}
+
+	return nil
+}
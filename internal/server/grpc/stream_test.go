@@ -0,0 +1,166 @@
+package grpc_test
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	gogrpc "google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+
+	pb "github.com/npavlov/go-metrics-service/gen/go/proto/metrics/v1"
+	"github.com/npavlov/go-metrics-service/internal/server/clientip"
+	"github.com/npavlov/go-metrics-service/internal/server/grpc"
+	"github.com/npavlov/go-metrics-service/internal/server/policy"
+	testutils "github.com/npavlov/go-metrics-service/internal/test_utils"
+	"github.com/npavlov/go-metrics-service/internal/utils"
+	"github.com/npavlov/go-metrics-service/pkg/crypto"
+)
+
+//nolint:gochecknoglobals
+var streamInfo = &gogrpc.StreamServerInfo{
+	FullMethod:     pb.MetricService_StreamMetrics_FullMethodName,
+	IsClientStream: true,
+	IsServerStream: false,
+}
+
+// mockServerStream replays the queued messages to the handler.
+type mockServerStream struct {
+	gogrpc.ServerStream
+	ctx      context.Context
+	messages []proto.Message
+}
+
+func (m *mockServerStream) Context() context.Context {
+	return m.ctx
+}
+
+func (m *mockServerStream) RecvMsg(msg interface{}) error {
+	if len(m.messages) == 0 {
+		return io.EOF
+	}
+
+	next := m.messages[0]
+	m.messages = m.messages[1:]
+
+	//nolint:forcetypeassert
+	proto.Merge(msg.(proto.Message), next)
+
+	return nil
+}
+
+func signedStreamRequest(t *testing.T, signKey string, encryption *crypto.Encryption) *pb.SetMetricsRequest {
+	t.Helper()
+
+	req := &pb.SetMetricsRequest{
+		Items: []*pb.Metric{
+			{Id: "test_metric", Mtype: pb.Metric_TYPE_COUNTER, Delta: int64Ptr(100)},
+		},
+	}
+
+	payload, err := utils.MarshalProtoMessage(req)
+	require.NoError(t, err)
+	req.Signature = utils.CalculateHash(signKey, payload)
+
+	if encryption == nil {
+		return req
+	}
+
+	message, err := utils.MarshalProtoMessage(req)
+	require.NoError(t, err)
+	encryptedData, err := encryption.Encrypt(message, streamInfo.FullMethod)
+	require.NoError(t, err)
+
+	return &pb.SetMetricsRequest{EncryptedMessage: encryptedData}
+}
+
+func TestStreamInterceptors(t *testing.T) {
+	t.Parallel()
+
+	logger := testutils.GetTLogger()
+	signKey := "test-stream-secret"
+	encryption, _ := crypto.NewEncryption("testdata/test_public.key")
+	decryption, _ := crypto.NewDecryption("testdata/test_private.key")
+
+	decrypt := grpc.DecryptStreamInterceptor(decryption, logger)
+	sig := grpc.SigStreamInterceptor(signKey, nil, nil, logger)
+
+	stream := &mockServerStream{
+		ctx: metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-encrypted", "true")),
+		messages: []proto.Message{
+			signedStreamRequest(t, signKey, encryption),
+			signedStreamRequest(t, signKey, encryption),
+		},
+	}
+
+	received := 0
+	handler := func(_ interface{}, stream gogrpc.ServerStream) error {
+		for {
+			req := &pb.SetMetricsRequest{}
+			if err := stream.RecvMsg(req); err != nil {
+				return err
+			}
+
+			assert.Equal(t, "test_metric", req.GetItems()[0].GetId())
+			received++
+		}
+	}
+
+	err := decrypt(nil, stream, streamInfo, func(srv interface{}, stream gogrpc.ServerStream) error {
+		return sig(srv, stream, streamInfo, handler)
+	})
+
+	require.ErrorIs(t, err, io.EOF)
+	assert.Equal(t, 2, received)
+}
+
+func TestSigStreamInterceptorInvalidSignature(t *testing.T) {
+	t.Parallel()
+
+	logger := testutils.GetTLogger()
+	sig := grpc.SigStreamInterceptor("test-stream-secret", nil, nil, logger)
+
+	stream := &mockServerStream{
+		ctx: context.Background(),
+		messages: []proto.Message{
+			signedStreamRequest(t, "another-secret", nil),
+		},
+	}
+
+	err := sig(nil, stream, streamInfo, func(_ interface{}, stream gogrpc.ServerStream) error {
+		return stream.RecvMsg(&pb.SetMetricsRequest{})
+	})
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid signature")
+}
+
+func TestSubnetStreamInterceptor(t *testing.T) {
+	t.Parallel()
+
+	logger := testutils.GetTLogger()
+	filter, err := clientip.NewFilter([]string{"192.168.1.0/24"}, nil)
+	require.NoError(t, err)
+	interceptor := grpc.SubnetStreamInterceptor(filter, "", logger)
+
+	allowed := &mockServerStream{
+		ctx: policy.WithSource(context.Background(), "192.168.1.10"),
+	}
+	err = interceptor(nil, allowed, nil, func(_ interface{}, _ gogrpc.ServerStream) error {
+		return nil
+	})
+	require.NoError(t, err)
+
+	// the X-Real-IP metadata of the client is not its address
+	denied := &mockServerStream{
+		ctx: metadata.NewIncomingContext(policy.WithSource(context.Background(), "10.0.0.1"),
+			metadata.Pairs("X-Real-IP", "192.168.1.10")),
+	}
+	err = interceptor(nil, denied, nil, func(_ interface{}, _ gogrpc.ServerStream) error {
+		return nil
+	})
+	require.Error(t, err)
+}
@@ -2,59 +2,79 @@ package grpc
 
 import (
 	"context"
-	"net"
-	"strings"
 
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+
+	"github.com/npavlov/go-metrics-service/internal/server/clientip"
+	"github.com/npavlov/go-metrics-service/internal/server/policy"
+	"github.com/npavlov/go-metrics-service/internal/tlsconfig"
 )
 
-// SubnetInterceptor verifies if the request is from a trusted subnet.
-func SubnetInterceptor(subnet string, log *zerolog.Logger) grpc.UnaryServerInterceptor {
+// SubnetInterceptor verifies the client address resolved by SourceInterceptor against the subnet filter.
+// gateway is the identity of the client certificate of the gateway, empty when it does not present one.
+func SubnetInterceptor(filter *clientip.Filter, gateway string, log *zerolog.Logger) grpc.UnaryServerInterceptor {
 	return func(
 		ctx context.Context,
 		req interface{},
 		_ *grpc.UnaryServerInfo,
 		handler grpc.UnaryHandler,
 	) (interface{}, error) {
-		if subnet == "" {
-			return handler(ctx, req)
+		if err := checkSubnet(ctx, filter, gateway, log); err != nil {
+			return nil, err
 		}
 
-		md, ok := metadata.FromIncomingContext(ctx)
-		if !ok {
-			log.Error().Msg("missing metadata in request")
+		return handler(ctx, req)
+	}
+}
 
-			return nil, errors.New("missing metadata")
+// SubnetStreamInterceptor verifies the client address of the stream against the subnet filter.
+func SubnetStreamInterceptor(filter *clientip.Filter, gateway string, log *zerolog.Logger) grpc.StreamServerInterceptor {
+	return func(
+		srv interface{},
+		stream grpc.ServerStream,
+		_ *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		if err := checkSubnet(stream.Context(), filter, gateway, log); err != nil {
+			return err
 		}
 
-		ipStr := md.Get("X-Real-IP")
-		if len(ipStr) == 0 {
-			log.Error().Msg("X-Real-IP header is missing")
-
-			return nil, errors.New("X-Real-IP header is required")
-		}
+		return handler(srv, stream)
+	}
+}
 
-		ip := net.ParseIP(strings.TrimSpace(ipStr[0]))
-		if ip == nil {
-			log.Error().Str("ip", ipStr[0]).Msg("invalid IP address format")
+// checkSubnet verifies the client address against the filter, clients with a verified TLS certificate pass.
+// The requests of the gateway are checked for its caller.
+func checkSubnet(ctx context.Context, filter *clientip.Filter, gateway string, log *zerolog.Logger) error {
+	if filter == nil || clientIdentity(ctx, gateway) != "" {
+		return nil
+	}
 
-			return nil, errors.New("invalid IP address format")
-		}
+	source := policy.SourceFromContext(ctx)
+	if !filter.Allows(source) {
+		log.Warn().Str("ip", source).Msg("unauthorized access attempt")
 
-		_, trustedNet, err := net.ParseCIDR(subnet)
-		if err != nil {
-			log.Fatal().Err(err).Msg("invalid subnet configuration")
-		}
+		return errors.New("unauthorized access")
+	}
 
-		if !trustedNet.Contains(ip) {
-			log.Warn().Str("ip", ip.String()).Msg("unauthorized access attempt")
+	return nil
+}
 
-			return nil, errors.New("unauthorized access")
-		}
+// peerIdentity returns the identity of the verified TLS client certificate of the peer, empty without one.
+func peerIdentity(ctx context.Context) string {
+	client, ok := peer.FromContext(ctx)
+	if !ok {
+		return ""
+	}
 
-		return handler(ctx, req)
+	info, ok := client.AuthInfo.(credentials.TLSInfo)
+	if !ok {
+		return ""
 	}
+
+	return tlsconfig.Identity(&info.State)
 }
@@ -2,48 +2,142 @@ package grpc_test
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
 
+	"github.com/npavlov/go-metrics-service/internal/server/clientip"
 	"github.com/npavlov/go-metrics-service/internal/server/grpc"
 	testutils "github.com/npavlov/go-metrics-service/internal/test_utils"
 )
 
-func TestSubnetInterceptor(t *testing.T) {
-	t.Parallel()
+// call resolves the source of the peer and its metadata, then checks it against the subnets.
+// The peer presents a verified client certificate of the identity unless it is empty.
+func call(t *testing.T, filter *clientip.Filter, address, identity string, md metadata.MD) (interface{}, error) {
+	t.Helper()
+
+	return callVia(t, filter, []string{"127.0.0.1"}, "gateway", address, identity, md)
+}
+
+// callVia is call trusting the proxies and the gateway of the identity, empty for a gateway
+// without a client certificate.
+func callVia(
+	t *testing.T,
+	filter *clientip.Filter,
+	proxies []string,
+	gateway, address, identity string,
+	md metadata.MD,
+) (interface{}, error) {
+	t.Helper()
 
 	logger := testutils.GetTLogger()
-	subnet := "192.168.1.0/24"
+	resolver, err := clientip.NewResolver(proxies)
+	require.NoError(t, err)
+
+	source := grpc.SourceInterceptor(resolver, gateway)
+	subnet := grpc.SubnetInterceptor(filter, gateway, logger)
 
-	interceptor := grpc.SubnetInterceptor(subnet, logger)
+	//nolint:exhaustruct
+	client := &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP(address), Port: 5000}}
+	if identity != "" {
+		//nolint:exhaustruct
+		client.AuthInfo = credentials.TLSInfo{State: tls.ConnectionState{
+			VerifiedChains: [][]*x509.Certificate{{{Subject: pkix.Name{CommonName: identity}}}},
+		}}
+	}
+	ctx := metadata.NewIncomingContext(peer.NewContext(context.Background(), client), md)
 
-	md := metadata.Pairs("X-Real-IP", "192.168.1.10")
-	ctx := metadata.NewIncomingContext(context.Background(), md)
+	return source(ctx, "testRequest", nil, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return subnet(ctx, req, nil, mockHandler)
+	})
+}
 
-	resp, err := interceptor(ctx, "testRequest", nil, mockHandler)
+func TestSubnetInterceptor(t *testing.T) {
+	t.Parallel()
 
+	filter, err := clientip.NewFilter([]string{"192.168.1.0/24", "2001:db8::/32"}, []string{"192.168.1.66"})
+	require.NoError(t, err)
+
+	resp, err := call(t, filter, "192.168.1.10", "", metadata.MD{})
 	require.NoError(t, err)
 	assert.Equal(t, "mockResponse", resp)
+
+	_, err = call(t, filter, "2001:db8::1", "", metadata.MD{})
+	require.NoError(t, err)
+
+	// the gateway appends the address of its client
+	_, err = call(t, filter, "127.0.0.1", "", metadata.Pairs("X-Forwarded-For", "192.168.1.10"))
+	require.NoError(t, err)
 }
 
 // Unauthorized access test.
 func TestSubnetInterceptorUnauthorized(t *testing.T) {
 	t.Parallel()
 
-	logger := testutils.GetTLogger()
-	subnet := "192.168.1.0/24"
+	filter, err := clientip.NewFilter([]string{"192.168.1.0/24"}, []string{"192.168.1.66"})
+	require.NoError(t, err)
 
-	interceptor := grpc.SubnetInterceptor(subnet, logger)
+	for address, md := range map[string]metadata.MD{
+		"10.10.10.10":  metadata.Pairs("X-Real-IP", "192.168.1.10"),
+		"192.168.1.66": metadata.MD{},
+		"127.0.0.1":    metadata.Pairs("X-Forwarded-For", "10.10.10.10"),
+	} {
+		resp, err := call(t, filter, address, "", md)
+		require.Error(t, err, address)
+		assert.Nil(t, resp)
+		assert.Contains(t, err.Error(), "unauthorized access")
+	}
+}
 
-	md := metadata.Pairs("X-Real-IP", "10.10.10.10")
-	ctx := metadata.NewIncomingContext(context.Background(), md)
+func TestSubnetInterceptorGateway(t *testing.T) {
+	t.Parallel()
+
+	filter, err := clientip.NewFilter([]string{"192.168.1.0/24"}, nil)
+	require.NoError(t, err)
+
+	// a client certificate replaces the subnet check
+	_, err = call(t, filter, "10.10.10.10", "agent", metadata.MD{})
+	require.NoError(t, err)
+
+	// the gateway is checked for the address and the certificate of its caller
+	_, err = call(t, filter, "10.10.10.10", "gateway", metadata.Pairs("X-Real-IP", "192.168.1.10"))
+	require.NoError(t, err)
+	_, err = call(t, filter, "10.10.10.10", "gateway", metadata.Pairs("X-Real-IP", "10.10.10.11"))
+	require.Error(t, err)
+	_, err = call(t, filter, "10.10.10.10", "gateway",
+		metadata.Pairs("X-Real-IP", "10.10.10.11", grpc.ClientIdentityHeader, "agent"))
+	require.NoError(t, err)
 
-	resp, err := interceptor(ctx, "testRequest", nil, mockHandler)
+	// other clients cannot forward an identity
+	_, err = call(t, filter, "10.10.10.10", "", metadata.Pairs(grpc.ClientIdentityHeader, "agent"))
+	require.Error(t, err)
+}
 
+func TestSubnetInterceptorLocalGateway(t *testing.T) {
+	t.Parallel()
+
+	filter, err := clientip.NewFilter([]string{"192.168.1.0/24"}, nil)
+	require.NoError(t, err)
+
+	// without a client certificate the gateway dials the server from the loopback address
+	_, err = callVia(t, filter, nil, "", "127.0.0.1", "", metadata.Pairs("X-Real-IP", "192.168.1.10"))
+	require.NoError(t, err, "the address of the caller of the gateway is checked")
+
+	_, err = callVia(t, filter, nil, "", "127.0.0.1", "", metadata.Pairs("X-Real-IP", "10.10.10.10"))
 	require.Error(t, err)
-	assert.Nil(t, resp)
-	assert.Contains(t, err.Error(), "unauthorized access")
+
+	_, err = callVia(t, filter, nil, "", "10.10.10.10", "", metadata.Pairs("X-Real-IP", "192.168.1.10"))
+	require.Error(t, err, "a remote peer cannot claim the address of a caller")
+
+	_, err = callVia(t, filter, nil, "", "127.0.0.1", "",
+		metadata.Pairs("X-Real-IP", "10.10.10.10", grpc.ClientIdentityHeader, "agent"))
+	require.Error(t, err, "the identity is forwarded by a gateway presenting its client certificate only")
 }
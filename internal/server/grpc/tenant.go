@@ -0,0 +1,71 @@
+package grpc
+
+import (
+	"context"
+	"strings"
+
+	"github.com/rs/zerolog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/npavlov/go-metrics-service/internal/domain"
+	"github.com/npavlov/go-metrics-service/internal/server/tenant"
+)
+
+// TenantInterceptor stores the tenant named by the X-Tenant metadata in the request context,
+// a request without it belongs to the default tenant.
+func TenantInterceptor(log *zerolog.Logger) grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req interface{},
+		_ *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		ctx, err := withTenant(ctx, log)
+		if err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// TenantStreamInterceptor stores the tenant named by the X-Tenant metadata in the stream context.
+func TenantStreamInterceptor(log *zerolog.Logger) grpc.StreamServerInterceptor {
+	return func(
+		srv interface{},
+		stream grpc.ServerStream,
+		_ *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		ctx, err := withTenant(stream.Context(), log)
+		if err != nil {
+			return err
+		}
+
+		return handler(srv, &contextStream{ServerStream: stream, ctx: ctx})
+	}
+}
+
+func withTenant(ctx context.Context, log *zerolog.Logger) (context.Context, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ctx, nil
+	}
+
+	values := md.Get(tenant.Header)
+	if len(values) == 0 || strings.TrimSpace(values[0]) == "" {
+		return ctx, nil
+	}
+
+	owner := domain.Tenant(strings.TrimSpace(values[0]))
+	if err := owner.Validate(); err != nil {
+		log.Warn().Err(err).Msg("invalid tenant")
+
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	return tenant.WithTenant(ctx, owner), nil
+}
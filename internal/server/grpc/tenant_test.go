@@ -0,0 +1,77 @@
+package grpc_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/npavlov/go-metrics-service/gen/go/proto/metrics/v1"
+	"github.com/npavlov/go-metrics-service/internal/domain"
+	"github.com/npavlov/go-metrics-service/internal/server/grpc"
+	"github.com/npavlov/go-metrics-service/internal/server/tenant"
+	testutils "github.com/npavlov/go-metrics-service/internal/test_utils"
+	"github.com/npavlov/go-metrics-service/internal/utils"
+)
+
+func TestTenantInterceptor(t *testing.T) {
+	t.Parallel()
+
+	interceptor := grpc.TenantInterceptor(testutils.GetTLogger())
+
+	var seen domain.Tenant
+	handler := func(ctx context.Context, _ interface{}) (interface{}, error) {
+		seen = tenant.FromContext(ctx)
+
+		return "mockResponse", nil
+	}
+
+	_, err := interceptor(context.Background(), nil, nil, handler)
+	require.NoError(t, err)
+	assert.Equal(t, domain.DefaultTenant, seen)
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(tenant.Header, "team-a"))
+	_, err = interceptor(ctx, nil, nil, handler)
+	require.NoError(t, err)
+	assert.Equal(t, domain.Tenant("team-a"), seen)
+
+	ctx = metadata.NewIncomingContext(context.Background(), metadata.Pairs(tenant.Header, "team a"))
+	_, err = interceptor(ctx, nil, nil, handler)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestSigInterceptorTenantKeys(t *testing.T) {
+	t.Parallel()
+
+	logger := testutils.GetTLogger()
+	interceptor := grpc.SigInterceptor("server-key", tenant.Keys{"team-a": "secret-a"}, nil, logger)
+
+	req := &pb.SetMetricRequest{
+		Metric: &pb.Metric{Id: "test_metric", Mtype: pb.Metric_TYPE_COUNTER, Delta: int64Ptr(1)},
+	}
+	message, err := utils.MarshalProtoMessage(req)
+	require.NoError(t, err)
+
+	var seen domain.Tenant
+	handler := func(ctx context.Context, _ interface{}) (interface{}, error) {
+		seen = tenant.FromContext(ctx)
+
+		return "mockResponse", nil
+	}
+
+	ctx := metadata.NewIncomingContext(context.Background(),
+		metadata.Pairs("HashSHA256", utils.CalculateHash("secret-a", message)))
+	_, err = interceptor(ctx, req, unaryInfo, handler)
+	require.NoError(t, err)
+	assert.Equal(t, domain.Tenant("team-a"), seen)
+
+	// the server key cannot write to a tenant that has a key
+	ctx = metadata.NewIncomingContext(context.Background(),
+		metadata.Pairs("HashSHA256", utils.CalculateHash("server-key", message)))
+	_, err = interceptor(tenant.WithTenant(ctx, "team-a"), req, unaryInfo, handler)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/npavlov/go-metrics-service/internal/domain"
+)
+
+// Delete handles HTTP requests to remove a specific metric by its type and name.
+// It responds with 404 when no metric of the given type exists under that name.
+func (mh *MetricHandler) Delete(response http.ResponseWriter, request *http.Request) {
+	metricType := domain.MetricType(chi.URLParam(request, "metricType"))
+	metricName := domain.MetricName(chi.URLParam(request, "metricName"))
+
+	deleted, err := mh.repo.Delete(request.Context(), metricName, metricType)
+	if err != nil {
+		mh.logger.Error().Err(err).Msg("error deleting metric")
+		http.Error(response, "Failed to delete metric", http.StatusInternalServerError)
+
+		return
+	}
+
+	if !deleted {
+		mh.logger.Error().Msgf("Delete: Failed to find model %s of type %s", metricName, metricType)
+		http.Error(response, "Failed to retrieve model from memory", http.StatusNotFound)
+
+		return
+	}
+
+	response.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,88 @@
+package handlers_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/npavlov/go-metrics-service/internal/domain"
+	"github.com/npavlov/go-metrics-service/internal/server/config"
+	"github.com/npavlov/go-metrics-service/internal/server/db"
+	"github.com/npavlov/go-metrics-service/internal/server/handlers"
+	"github.com/npavlov/go-metrics-service/internal/server/router"
+	"github.com/npavlov/go-metrics-service/internal/server/storage"
+	testutils "github.com/npavlov/go-metrics-service/internal/test_utils"
+)
+
+func TestDeleteHandler(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		request    string
+		data       *db.Metric
+		statusCode int
+		remains    bool
+	}{
+		{
+			name:       "Delete gauge",
+			request:    "/value/gauge/CPUutilization3",
+			data:       db.NewMetric("CPUutilization3", domain.Gauge, nil, float64Ptr(12.5)),
+			statusCode: http.StatusOK,
+			remains:    false,
+		},
+		{
+			name:       "Delete counter",
+			request:    "/value/counter/PollCount",
+			data:       db.NewMetric("PollCount", domain.Counter, int64Ptr(10), nil),
+			statusCode: http.StatusOK,
+			remains:    false,
+		},
+		{
+			name:       "Type mismatch",
+			request:    "/value/counter/HeapAlloc",
+			data:       db.NewMetric("HeapAlloc", domain.Gauge, nil, float64Ptr(1)),
+			statusCode: http.StatusNotFound,
+			remains:    true,
+		},
+		{
+			name:       "Non existing metric",
+			request:    "/value/gauge/Unknown",
+			data:       nil,
+			statusCode: http.StatusNotFound,
+			remains:    false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			log := testutils.GetTLogger()
+			memStorage := storage.NewMemStorage(log)
+			cfg := config.NewConfigBuilder(log).Build()
+			mHandlers := handlers.NewMetricsHandler(memStorage, log)
+			var cRouter router.Router = router.NewCustomRouter(cfg, log)
+			cRouter.SetRouter(mHandlers, nil)
+
+			if tt.data != nil {
+				require.NoError(t, memStorage.Create(context.Background(), tt.data))
+			}
+
+			req := httptest.NewRequest(http.MethodDelete, tt.request, nil)
+			rec := httptest.NewRecorder()
+			cRouter.GetRouter().ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.statusCode, rec.Code)
+
+			if tt.data != nil {
+				_, found := memStorage.Get(context.Background(), tt.data.ID)
+				assert.Equal(t, tt.remains, found)
+			}
+		})
+	}
+}
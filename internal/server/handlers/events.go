@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/npavlov/go-metrics-service/internal/domain"
+	"github.com/npavlov/go-metrics-service/internal/server/tenant"
+)
+
+// EventStreamContentType is the content type of Server-Sent-Events responses.
+const EventStreamContentType = "text/event-stream"
+
+// keepAliveInterval is the interval of comments sent to keep idle event streams open through proxies.
+const keepAliveInterval = 15 * time.Second
+
+// Events streams metric changes as Server-Sent-Events until the client disconnects.
+//
+// Parameters:
+//   - response: The HTTP response writer.
+//   - request: The HTTP request, repeated "name" query parameters limit the stream to these metrics.
+//
+// Behavior:
+//   - Every change is sent as an event named "update" or "delete" with the JSON encoded metric as data.
+//   - Responds with 503 when the server runs without the change hub.
+func (mh *MetricHandler) Events(response http.ResponseWriter, request *http.Request) {
+	if mh.hub == nil {
+		http.Error(response, "Event stream is not enabled", http.StatusServiceUnavailable)
+
+		return
+	}
+
+	controller := http.NewResponseController(response)
+
+	// The stream outlives the write timeout of the server
+	if err := controller.SetWriteDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		mh.logger.Error().Err(err).Msg("Failed to reset write deadline")
+	}
+
+	queryNames := request.URL.Query()["name"]
+	names := make([]domain.MetricName, len(queryNames))
+	for i, name := range queryNames {
+		names[i] = domain.MetricName(name)
+	}
+
+	subscription := mh.hub.Subscribe(tenant.FromContext(request.Context()), names)
+	defer mh.hub.Unsubscribe(subscription)
+
+	response.Header().Set("Cache-Control", "no-cache")
+	response.Header().Set("Connection", "keep-alive")
+	response.WriteHeader(http.StatusOK)
+
+	if err := controller.Flush(); err != nil {
+		mh.logger.Error().Err(err).Msg("Event stream is not supported by the response writer")
+
+		return
+	}
+
+	keepAlive := time.NewTicker(keepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-request.Context().Done():
+			return
+		case <-keepAlive.C:
+			if _, err := response.Write([]byte(": keep-alive\n\n")); err != nil {
+				return
+			}
+		case event, ok := <-subscription.Events():
+			if !ok {
+				return
+			}
+
+			data, err := mh.json.Marshal(event.Metric)
+			if err != nil {
+				mh.logger.Error().Err(err).Msg("Failed to encode metric event")
+
+				continue
+			}
+
+			if _, err := response.Write([]byte("event: " + string(event.Type) + "\ndata: " + string(data) + "\n\n")); err != nil {
+				return
+			}
+		}
+
+		if err := controller.Flush(); err != nil {
+			return
+		}
+	}
+}
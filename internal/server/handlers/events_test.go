@@ -0,0 +1,85 @@
+package handlers_test
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/npavlov/go-metrics-service/internal/domain"
+	"github.com/npavlov/go-metrics-service/internal/server/config"
+	"github.com/npavlov/go-metrics-service/internal/server/db"
+	"github.com/npavlov/go-metrics-service/internal/server/handlers"
+	"github.com/npavlov/go-metrics-service/internal/server/hub"
+	"github.com/npavlov/go-metrics-service/internal/server/router"
+	"github.com/npavlov/go-metrics-service/internal/server/storage"
+	testutils "github.com/npavlov/go-metrics-service/internal/test_utils"
+)
+
+func TestEventsHandler(t *testing.T) {
+	t.Parallel()
+
+	log := testutils.GetTLogger()
+	changeHub := hub.NewHub(log)
+	memStorage := storage.NewMemStorage(log).WithHub(changeHub)
+	mHandlers := handlers.NewMetricsHandler(memStorage, log).WithHub(changeHub)
+	cfg := config.NewConfigBuilder(log).Build()
+	var cRouter router.Router = router.NewCustomRouter(cfg, log)
+	cRouter.SetRouter(mHandlers, nil)
+
+	server := httptest.NewServer(cRouter.GetRouter())
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/events?name=PollCount", nil)
+	require.NoError(t, err)
+	req.Header.Set("Accept", handlers.EventStreamContentType)
+	req.Header.Set("Accept-Encoding", "gzip")
+
+	resp, err := server.Client().Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, handlers.EventStreamContentType, resp.Header.Get("Content-Type"))
+	assert.Empty(t, resp.Header.Get("Content-Encoding"))
+
+	// Wait past the router timeout to check the stream is not cut
+	time.Sleep(600 * time.Millisecond)
+
+	_ = memStorage.Create(context.Background(), db.NewMetric("Alloc", domain.Gauge, nil, float64Ptr(1)))
+	_ = memStorage.Create(context.Background(), db.NewMetric("PollCount", domain.Counter, int64Ptr(5), nil))
+
+	reader := bufio.NewReader(resp.Body)
+
+	eventLine, err := reader.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "event: update\n", eventLine)
+
+	dataLine, err := reader.ReadString('\n')
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(dataLine, "data: "))
+	assert.Contains(t, dataLine, `"id":"PollCount"`)
+	assert.Contains(t, dataLine, `"delta":5`)
+}
+
+func TestEventsHandlerWithoutHub(t *testing.T) {
+	t.Parallel()
+
+	log := testutils.GetTLogger()
+	mHandlers := handlers.NewMetricsHandler(storage.NewMemStorage(log), log)
+
+	req := httptest.NewRequest(http.MethodGet, "/events", nil)
+	w := httptest.NewRecorder()
+	mHandlers.Events(w, req)
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+}
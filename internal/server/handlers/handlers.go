@@ -1,10 +1,16 @@
 package handlers
 
 import (
+	"net/http"
+
 	jsoniter "github.com/json-iterator/go"
+	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
 
 	"github.com/npavlov/go-metrics-service/internal/model"
+	"github.com/npavlov/go-metrics-service/internal/server/hub"
+	"github.com/npavlov/go-metrics-service/internal/server/ingest"
+	"github.com/npavlov/go-metrics-service/internal/server/policy"
 	"github.com/npavlov/go-metrics-service/internal/validators"
 	"github.com/npavlov/go-metrics-service/web"
 )
@@ -16,6 +22,9 @@ type MetricHandler struct {
 	repo        model.Repository      // Repository for accessing metric data.
 	embedReader *web.EmbedReader      // Reader for embedded templates.
 	json        jsoniter.API          // JSON API for encoding/decoding JSON data.
+	hub         *hub.Hub              // Hub of metric changes for event streams.
+	policy      *policy.Policy        // Series policy whose rejections are exported with the metrics.
+	otlp        ingest.OTLPOptions    // How the resource attributes of OTLP metrics are kept.
 }
 
 // NewMetricsHandler creates and initializes a new instance of MetricHandler.
@@ -33,5 +42,44 @@ func NewMetricsHandler(repo model.Repository, l *zerolog.Logger) *MetricHandler
 		repo:        repo,
 		embedReader: web.NewEmbedReader(),
 		json:        jsoniter.ConfigCompatibleWithStandardLibrary,
+		hub:         nil,
+		policy:      nil,
+		otlp:        ingest.OTLPOptions{ResourceLabels: nil, ServicePrefix: false},
+	}
+}
+
+// WithHub enables the event stream using the given change hub.
+func (mh *MetricHandler) WithHub(changeHub *hub.Hub) *MetricHandler {
+	mh.hub = changeHub
+
+	return mh
+}
+
+// WithPolicy exports the rejection counters of the series policy with the Prometheus metrics.
+func (mh *MetricHandler) WithPolicy(seriesPolicy *policy.Policy) *MetricHandler {
+	mh.policy = seriesPolicy
+
+	return mh
+}
+
+// WithOTLP sets how the resource attributes of the OTLP metrics are kept.
+func (mh *MetricHandler) WithOTLP(options ingest.OTLPOptions) *MetricHandler {
+	mh.otlp = options
+
+	return mh
+}
+
+// respondWriteError responds to a failed write with the given status and message,
+// rejections by the series policy are reported to the client with their own status.
+func (mh *MetricHandler) respondWriteError(response http.ResponseWriter, err error, status int, message string) {
+	switch {
+	case errors.Is(err, policy.ErrInvalidName):
+		status, message = http.StatusBadRequest, err.Error()
+	case errors.Is(err, policy.ErrDenied):
+		status, message = http.StatusForbidden, err.Error()
+	case errors.Is(err, policy.ErrSeriesLimit), errors.Is(err, policy.ErrSourceLimit):
+		status, message = http.StatusTooManyRequests, err.Error()
 	}
+
+	http.Error(response, message, status)
 }
@@ -53,7 +53,7 @@ func (mh *HealthHandler) Ping(response http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	if err := mh.database.DB.Ping(req.Context()); err != nil {
+	if err := mh.database.Ping(req.Context()); err != nil {
 		mh.logger.Error().Err(err).Msg("No connection to database")
 		http.Error(response, "Failed to connect to database: "+err.Error(), http.StatusInternalServerError)
 
@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/npavlov/go-metrics-service/internal/server/ingest"
+)
+
+// maxLineProtocolSize - the largest decompressed line protocol body accepted, in bytes.
+const maxLineProtocolSize = 32 << 20
+
+// InfluxWrite handles the InfluxDB line protocol writes of Telegraf and the Influx clients,
+// gzip bodies are decompressed by the router. The precision and database parameters are ignored,
+// see ingest.FromLineProtocol for the mapping of the fields.
+func (mh *MetricHandler) InfluxWrite(response http.ResponseWriter, request *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(request.Body, maxLineProtocolSize+1))
+	if err != nil {
+		mh.logger.Error().Err(err).Msg("error reading line protocol")
+		http.Error(response, "Failed to read body", http.StatusBadRequest)
+
+		return
+	}
+
+	if len(body) > maxLineProtocolSize {
+		http.Error(response, "Request body is too large", http.StatusRequestEntityTooLarge)
+
+		return
+	}
+
+	metrics, err := ingest.FromLineProtocol(body)
+	if err != nil {
+		mh.logger.Error().Err(err).Msg("error converting line protocol")
+		http.Error(response, err.Error(), http.StatusBadRequest)
+
+		return
+	}
+
+	if len(metrics) > 0 {
+		if err := mh.repo.UpdateMany(request.Context(), &metrics); err != nil {
+			mh.logger.Error().Err(err).Msg("error updating metrics")
+			mh.respondWriteError(response, err, http.StatusInternalServerError, "Failed to update metrics")
+
+			return
+		}
+	}
+
+	response.WriteHeader(http.StatusNoContent)
+}
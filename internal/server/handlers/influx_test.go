@@ -0,0 +1,68 @@
+package handlers_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/npavlov/go-metrics-service/internal/domain"
+	"github.com/npavlov/go-metrics-service/internal/server/config"
+	"github.com/npavlov/go-metrics-service/internal/server/handlers"
+	"github.com/npavlov/go-metrics-service/internal/server/router"
+	"github.com/npavlov/go-metrics-service/internal/server/storage"
+	testutils "github.com/npavlov/go-metrics-service/internal/test_utils"
+)
+
+func TestMetricHandler_InfluxWrite(t *testing.T) {
+	t.Parallel()
+
+	log := testutils.GetTLogger()
+	memStorage := storage.NewMemStorage(log)
+	cfg := config.NewConfigBuilder(log).Build()
+	var cRouter router.Router = router.NewCustomRouter(cfg, log)
+	cRouter.SetRouter(handlers.NewMetricsHandler(memStorage, log), nil)
+
+	send := func(body []byte, encoding string) int {
+		request := httptest.NewRequest(http.MethodPost, "/write?db=telegraf&precision=ns", bytes.NewReader(body))
+		request.Header.Set("Content-Type", "text/plain; charset=utf-8")
+		if encoding != "" {
+			request.Header.Set("Content-Encoding", encoding)
+		}
+		recorder := httptest.NewRecorder()
+
+		cRouter.GetRouter().ServeHTTP(recorder, request)
+
+		return recorder.Code
+	}
+
+	assert.Equal(t, http.StatusNoContent, send([]byte("mem,host=db1 used_percent=42.5,total=8192i"), ""))
+
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	_, err := writer.Write([]byte("mem,host=db1 used_percent=40\nswap,host=db1 in=3i 1700000000000000000\n"))
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+	assert.Equal(t, http.StatusNoContent, send(compressed.Bytes(), "gzip"))
+
+	used, found := memStorage.Get(context.Background(), `mem_used_percent{host="db1"}`)
+	require.True(t, found)
+	assert.Equal(t, domain.Gauge, used.MType)
+	assert.InDelta(t, 40, *used.Value, 0)
+
+	total, found := memStorage.Get(context.Background(), `mem_total{host="db1"}`)
+	require.True(t, found)
+	assert.Equal(t, domain.Counter, total.MType)
+	assert.Equal(t, int64(8192), *total.Delta)
+
+	swap, found := memStorage.Get(context.Background(), `swap_in{host="db1"}`)
+	require.True(t, found)
+	assert.Equal(t, int64(3), *swap.Delta)
+
+	assert.Equal(t, http.StatusBadRequest, send([]byte("mem used_percent=high"), ""))
+}
@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"io"
+	"mime"
+	"net/http"
+
+	"github.com/pkg/errors"
+	colpb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/npavlov/go-metrics-service/internal/server/ingest"
+)
+
+// The content types of the OTLP/HTTP encodings.
+const (
+	OTLPProtobufContentType = "application/x-protobuf"
+	OTLPJSONContentType     = "application/json"
+)
+
+// maxOTLPSize - the largest decompressed OTLP request accepted, in bytes.
+const maxOTLPSize = 32 << 20
+
+var errOTLPSize = errors.New("otlp request is too large")
+
+// OTLPMetrics handles the OTLP/HTTP metric exports of the OpenTelemetry SDKs and collectors
+// in the binary protobuf or the JSON encoding, gzip bodies are decompressed by the router.
+// The response is encoded like the request, see ingest.FromOTLP for the mapping of the metrics.
+func (mh *MetricHandler) OTLPMetrics(response http.ResponseWriter, request *http.Request) {
+	contentType, _, _ := mime.ParseMediaType(request.Header.Get("Content-Type"))
+	if contentType != OTLPProtobufContentType && contentType != OTLPJSONContentType {
+		http.Error(response, "Unsupported content type", http.StatusUnsupportedMediaType)
+
+		return
+	}
+
+	exportRequest, err := readOTLP(request.Body, contentType)
+	if err != nil {
+		mh.logger.Error().Err(err).Msg("error reading otlp request")
+		status := http.StatusBadRequest
+		if errors.Is(err, errOTLPSize) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		http.Error(response, err.Error(), status)
+
+		return
+	}
+
+	batch, err := ingest.FromOTLP(exportRequest, mh.otlp)
+	if err != nil {
+		mh.logger.Error().Err(err).Msg("error converting otlp request")
+		http.Error(response, err.Error(), http.StatusBadRequest)
+
+		return
+	}
+
+	if err := mh.repo.ApplyBatch(request.Context(), batch); err != nil {
+		mh.logger.Error().Err(err).Msg("error updating metrics")
+		mh.respondWriteError(response, err, http.StatusInternalServerError, "Failed to update metrics")
+
+		return
+	}
+
+	//nolint:exhaustruct
+	exportResponse := &colpb.ExportMetricsServiceResponse{}
+
+	var body []byte
+	if contentType == OTLPJSONContentType {
+		body, err = protojson.Marshal(exportResponse)
+	} else {
+		body, err = proto.Marshal(exportResponse)
+	}
+
+	if err != nil {
+		mh.logger.Error().Err(err).Msg("error encoding otlp response")
+		http.Error(response, "Failed to encode response", http.StatusInternalServerError)
+
+		return
+	}
+
+	response.Header().Set("Content-Type", contentType)
+	response.WriteHeader(http.StatusOK)
+
+	if _, err := response.Write(body); err != nil {
+		mh.logger.Error().Err(err).Msg("error writing otlp response")
+	}
+}
+
+func readOTLP(body io.Reader, contentType string) (*colpb.ExportMetricsServiceRequest, error) {
+	data, err := io.ReadAll(io.LimitReader(body, maxOTLPSize+1))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read body")
+	}
+
+	if len(data) > maxOTLPSize {
+		return nil, errOTLPSize
+	}
+
+	//nolint:exhaustruct
+	exportRequest := &colpb.ExportMetricsServiceRequest{}
+
+	if contentType == OTLPJSONContentType {
+		//nolint:exhaustruct
+		err = protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal(data, exportRequest)
+	} else {
+		err = proto.Unmarshal(data, exportRequest)
+	}
+
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal export request")
+	}
+
+	return exportRequest, nil
+}
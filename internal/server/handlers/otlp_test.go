@@ -0,0 +1,118 @@
+package handlers_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	colpb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/npavlov/go-metrics-service/internal/domain"
+	"github.com/npavlov/go-metrics-service/internal/server/config"
+	"github.com/npavlov/go-metrics-service/internal/server/db"
+	"github.com/npavlov/go-metrics-service/internal/server/handlers"
+	"github.com/npavlov/go-metrics-service/internal/server/ingest"
+	"github.com/npavlov/go-metrics-service/internal/server/router"
+	"github.com/npavlov/go-metrics-service/internal/server/storage"
+	testutils "github.com/npavlov/go-metrics-service/internal/test_utils"
+)
+
+const otlpJSON = `{
+  "resourceMetrics": [{
+    "resource": {"attributes": [{"key": "service.name", "value": {"stringValue": "checkout"}}]},
+    "scopeMetrics": [{
+      "metrics": [
+        {"name": "queue.size", "gauge": {"dataPoints": [{"asDouble": 3.5, "timeUnixNano": "1"}]}},
+        {"name": "connections", "sum": {"aggregationTemporality": 1, "isMonotonic": false,
+          "dataPoints": [{"asInt": "-2"}]}}
+      ]
+    }]
+  }]
+}`
+
+func TestMetricHandler_OTLPMetrics(t *testing.T) {
+	t.Parallel()
+
+	log := testutils.GetTLogger()
+	memStorage := storage.NewMemStorage(log)
+	cfg := config.NewConfigBuilder(log).Build()
+	cRouter := router.NewCustomRouter(cfg, log)
+	cRouter.SetOTLPRouter(handlers.NewMetricsHandler(memStorage, log).
+		WithOTLP(ingest.OTLPOptions{ResourceLabels: nil, ServicePrefix: false}))
+
+	send := func(body []byte, contentType string, compress bool) *httptest.ResponseRecorder {
+		if compress {
+			var compressed bytes.Buffer
+			writer := gzip.NewWriter(&compressed)
+			_, err := writer.Write(body)
+			require.NoError(t, err)
+			require.NoError(t, writer.Close())
+			body = compressed.Bytes()
+		}
+
+		request := httptest.NewRequest(http.MethodPost, "/v1/metrics", bytes.NewReader(body))
+		request.Header.Set("Content-Type", contentType)
+		if compress {
+			request.Header.Set("Content-Encoding", "gzip")
+		}
+		recorder := httptest.NewRecorder()
+
+		cRouter.GetRouter().ServeHTTP(recorder, request)
+
+		return recorder
+	}
+
+	//nolint:exhaustruct
+	payload, err := proto.Marshal(&colpb.ExportMetricsServiceRequest{ResourceMetrics: []*metricspb.ResourceMetrics{{
+		ScopeMetrics: []*metricspb.ScopeMetrics{{Metrics: []*metricspb.Metric{{
+			Name: "jobs.done",
+			Data: &metricspb.Metric_Sum{Sum: &metricspb.Sum{
+				AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA,
+				IsMonotonic:            true,
+				DataPoints: []*metricspb.NumberDataPoint{
+					{Value: &metricspb.NumberDataPoint_AsInt{AsInt: 4}},
+				},
+			}},
+		}}}},
+	}}})
+	require.NoError(t, err)
+
+	// delta counters are added up
+	for _, compress := range []bool{false, true} {
+		recorder := send(payload, handlers.OTLPProtobufContentType, compress)
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Equal(t, handlers.OTLPProtobufContentType, recorder.Header().Get("Content-Type"))
+	}
+
+	jobs, found := memStorage.Get(context.Background(), "jobs_done")
+	require.True(t, found)
+	assert.Equal(t, domain.Counter, jobs.MType)
+	assert.Equal(t, int64(8), *jobs.Delta)
+
+	// delta up down counters change the stored gauge
+	value := 10.0
+	require.NoError(t, memStorage.Create(context.Background(),
+		db.NewMetric("connections", domain.Gauge, nil, &value).WithLabels(domain.Labels{"service_name": "checkout"})))
+
+	recorder := send([]byte(otlpJSON), "application/json; charset=utf-8", false)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.JSONEq(t, "{}", recorder.Body.String())
+
+	queue, found := memStorage.Get(context.Background(), `queue_size{service_name="checkout"}`)
+	require.True(t, found)
+	assert.InDelta(t, 3.5, *queue.Value, 0)
+
+	connections, found := memStorage.Get(context.Background(), `connections{service_name="checkout"}`)
+	require.True(t, found)
+	assert.InDelta(t, 8, *connections.Value, 0)
+
+	assert.Equal(t, http.StatusUnsupportedMediaType, send(payload, "text/plain", false).Code)
+	assert.Equal(t, http.StatusBadRequest, send([]byte("{"), handlers.OTLPJSONContentType, false).Code)
+}
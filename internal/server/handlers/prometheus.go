@@ -0,0 +1,236 @@
+package handlers
+
+import (
+	"bufio"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/npavlov/go-metrics-service/internal/domain"
+	"github.com/npavlov/go-metrics-service/internal/server/db"
+)
+
+// PrometheusContentType is the content type of the Prometheus text exposition format.
+const PrometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Prometheus renders every stored metric in the Prometheus text exposition format.
+//
+// Parameters:
+//   - response: The HTTP response writer.
+//   - request: The HTTP request.
+//
+// Behavior:
+//   - Counters, gauges, histograms and summaries become families of the same type.
+//   - Metric names are sanitized to match [a-zA-Z_:][a-zA-Z0-9_:]*.
+//   - Series sharing a name are grouped into one family, their labels are written in braces.
+//   - Families are sorted by name, names colliding after sanitization are reported once.
+//   - The rejection counters of the series policy follow as the metrics_policy_rejections_total family.
+func (mh *MetricHandler) Prometheus(response http.ResponseWriter, request *http.Request) {
+	metrics := mh.repo.GetAll(request.Context())
+
+	series := make([]*db.Metric, 0, len(metrics))
+	for _, metric := range metrics {
+		series = append(series, metric)
+	}
+
+	sort.Slice(series, func(i, j int) bool {
+		if series[i].ID != series[j].ID {
+			return series[i].ID < series[j].ID
+		}
+
+		return series[i].Labels.String() < series[j].Labels.String()
+	})
+
+	writer := bufio.NewWriter(response)
+	// families maps a sanitized family name to the metric name it was first written for
+	families := make(map[string]domain.MetricName, len(series))
+
+	for _, metric := range series {
+		family, ok := prometheusFamily(metric)
+		if !ok {
+			continue
+		}
+
+		promName := SanitizeMetricName(string(metric.ID))
+		if owner, exists := families[promName]; exists && owner != metric.ID {
+			mh.logger.Warn().Str("metric", string(metric.ID)).Str("name", promName).Msg("duplicate metric name after sanitizing")
+
+			continue
+		} else if !exists {
+			families[promName] = metric.ID
+
+			_, _ = writer.WriteString("# HELP " + promName + " " + escapeHelp(string(metric.MType)+" metric "+string(metric.ID)) + "\n")
+			_, _ = writer.WriteString("# TYPE " + promName + " " + family + "\n")
+		}
+
+		for _, line := range prometheusSamples(promName, metric) {
+			_, _ = writer.WriteString(line + "\n")
+		}
+	}
+
+	if mh.policy != nil {
+		mh.writePolicyRejections(writer, families)
+	}
+
+	if err := writer.Flush(); err != nil {
+		mh.logger.Error().Err(err).Msg("Failed to write metrics")
+	}
+}
+
+// policyRejectionsFamily is the family of the rejection counters of the series policy.
+const policyRejectionsFamily = "metrics_policy_rejections_total"
+
+// writePolicyRejections writes the rejection counters of the series policy labeled by reason.
+func (mh *MetricHandler) writePolicyRejections(writer *bufio.Writer, families map[string]domain.MetricName) {
+	if _, exists := families[policyRejectionsFamily]; exists {
+		mh.logger.Warn().Str("name", policyRejectionsFamily).Msg("duplicate metric name after sanitizing")
+
+		return
+	}
+
+	_, _ = writer.WriteString("# HELP " + policyRejectionsFamily + " writes rejected by the series policy\n")
+	_, _ = writer.WriteString("# TYPE " + policyRejectionsFamily + " counter\n")
+
+	rejections := mh.policy.Rejections()
+	for _, reason := range mh.policy.Reasons() {
+		_, _ = writer.WriteString(policyRejectionsFamily + prometheusLabels(domain.Labels{"reason": string(reason)}) +
+			" " + strconv.FormatUint(rejections[reason], 10) + "\n")
+	}
+}
+
+// prometheusLabels renders the labels of a series with sanitized names, empty for no labels.
+func prometheusLabels(labels domain.Labels) string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	sanitized := make(domain.Labels, len(labels))
+	for name, value := range labels {
+		sanitized[SanitizeMetricName(strings.ReplaceAll(name, ":", "_"))] = value
+	}
+
+	return sanitized.String()
+}
+
+// SanitizeMetricName converts an arbitrary metric name into a valid Prometheus metric name.
+func SanitizeMetricName(name string) string {
+	if name == "" {
+		return "_"
+	}
+
+	var builder strings.Builder
+
+	builder.Grow(len(name))
+
+	for i, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '_', r == ':':
+			builder.WriteRune(r)
+		case r >= '0' && r <= '9':
+			if i == 0 {
+				builder.WriteRune('_')
+			}
+			builder.WriteRune(r)
+		default:
+			builder.WriteRune('_')
+		}
+	}
+
+	return builder.String()
+}
+
+// prometheusFamily returns the family type of the metric, false when the metric has no value.
+func prometheusFamily(metric *db.Metric) (string, bool) {
+	if !metric.HasValue() {
+		return "", false
+	}
+
+	switch metric.MType {
+	case domain.Counter:
+		return "counter", metric.Delta != nil
+	case domain.Gauge:
+		return "gauge", metric.Value != nil
+	case domain.Histogram:
+		return "histogram", true
+	case domain.Summary:
+		return "summary", true
+	}
+
+	return "", false
+}
+
+// prometheusSamples returns the sample lines of the metric, distributions take several lines:
+// cumulative buckets with the le label, sum and count for histograms, quantiles, sum and count for summaries.
+func prometheusSamples(promName string, metric *db.Metric) []string {
+	labels := prometheusLabels(metric.Labels)
+
+	switch metric.MType {
+	case domain.Counter:
+		return []string{promName + labels + " " + strconv.FormatInt(*metric.Delta, 10)}
+	case domain.Gauge:
+		return []string{promName + labels + " " + formatFloat(*metric.Value)}
+	case domain.Histogram:
+		histogram := metric.Histogram
+		cumulative := histogram.Cumulative()
+		lines := make([]string, 0, len(cumulative)+2)
+
+		for i, count := range cumulative {
+			bound := "+Inf"
+			if i < len(histogram.Bounds) {
+				bound = formatFloat(histogram.Bounds[i])
+			}
+
+			lines = append(lines, promName+"_bucket"+prometheusLabels(withLabel(metric.Labels, "le", bound))+
+				" "+strconv.FormatUint(count, 10))
+		}
+
+		return append(lines,
+			promName+"_sum"+labels+" "+formatFloat(histogram.Sum),
+			promName+"_count"+labels+" "+strconv.FormatUint(histogram.Count, 10))
+	case domain.Summary:
+		summary := metric.Summary
+		lines := make([]string, 0, len(summary.Quantiles)+2)
+
+		for _, quantile := range summary.Quantiles {
+			lines = append(lines, promName+prometheusLabels(withLabel(metric.Labels, "quantile", formatFloat(quantile.Quantile)))+
+				" "+formatFloat(quantile.Value))
+		}
+
+		return append(lines,
+			promName+"_sum"+labels+" "+formatFloat(summary.Sum),
+			promName+"_count"+labels+" "+strconv.FormatUint(summary.Count, 10))
+	}
+
+	return nil
+}
+
+// withLabel returns a copy of the labels with one more label.
+func withLabel(labels domain.Labels, name, value string) domain.Labels {
+	result := make(domain.Labels, len(labels)+1)
+	for labelName, labelValue := range labels {
+		result[labelName] = labelValue
+	}
+
+	result[name] = value
+
+	return result
+}
+
+// formatFloat formats a sample value, infinities are written as +Inf and -Inf.
+func formatFloat(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	}
+
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// escapeHelp escapes backslashes and line feeds as required for HELP lines.
+func escapeHelp(help string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help)
+}
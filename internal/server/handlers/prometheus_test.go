@@ -0,0 +1,183 @@
+package handlers_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/npavlov/go-metrics-service/internal/domain"
+	"github.com/npavlov/go-metrics-service/internal/server/config"
+	"github.com/npavlov/go-metrics-service/internal/server/db"
+	"github.com/npavlov/go-metrics-service/internal/server/handlers"
+	"github.com/npavlov/go-metrics-service/internal/server/policy"
+	"github.com/npavlov/go-metrics-service/internal/server/router"
+	"github.com/npavlov/go-metrics-service/internal/server/storage"
+	testutils "github.com/npavlov/go-metrics-service/internal/test_utils"
+)
+
+func TestPrometheusHandler(t *testing.T) {
+	t.Parallel()
+
+	log := testutils.GetTLogger()
+	memStorage := storage.NewMemStorage(log)
+	cfg := config.NewConfigBuilder(log).Build()
+	mHandlers := handlers.NewMetricsHandler(memStorage, log)
+	var cRouter router.Router = router.NewCustomRouter(cfg, log)
+	cRouter.SetRouter(mHandlers, nil)
+
+	metrics := []db.Metric{
+		*db.NewMetric("HeapAlloc", domain.Gauge, nil, float64Ptr(123.45)),
+		*db.NewMetric("PollCount", domain.Counter, int64Ptr(7), nil),
+		*db.NewMetric("cpu.usage-0", domain.Gauge, nil, float64Ptr(0.5)),
+	}
+
+	for _, v := range metrics {
+		err := memStorage.Update(context.Background(), &v)
+		require.NoError(t, err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	rec := httptest.NewRecorder()
+	cRouter.GetRouter().ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, handlers.PrometheusContentType, rec.Header().Get("Content-Type"))
+	assert.Equal(t, "# HELP HeapAlloc gauge metric HeapAlloc\n"+
+		"# TYPE HeapAlloc gauge\n"+
+		"HeapAlloc 123.45\n"+
+		"# HELP PollCount counter metric PollCount\n"+
+		"# TYPE PollCount counter\n"+
+		"PollCount 7\n"+
+		"# HELP cpu_usage_0 gauge metric cpu.usage-0\n"+
+		"# TYPE cpu_usage_0 gauge\n"+
+		"cpu_usage_0 0.5\n", rec.Body.String())
+}
+
+func TestSanitizeMetricName(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{"HeapAlloc", "HeapAlloc"},
+		{"CPUutilization1", "CPUutilization1"},
+		{"1metric", "_1metric"},
+		{"http.requests-total", "http_requests_total"},
+		{"ns:metric", "ns:metric"},
+		{"", "_"},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, handlers.SanitizeMetricName(tt.name))
+	}
+}
+
+func TestPrometheusHandlerLabels(t *testing.T) {
+	t.Parallel()
+
+	log := testutils.GetTLogger()
+	memStorage := storage.NewMemStorage(log)
+	mHandlers := handlers.NewMetricsHandler(memStorage, log)
+
+	metrics := []db.Metric{
+		*db.NewMetric("CPUutilization", domain.Gauge, nil, float64Ptr(20)).
+			WithLabels(domain.Labels{"cpu": "1", "host": "a"}),
+		*db.NewMetric("CPUutilization", domain.Gauge, nil, float64Ptr(10)).
+			WithLabels(domain.Labels{"cpu": "0", "host": "a"}),
+	}
+
+	for _, v := range metrics {
+		err := memStorage.Update(context.Background(), &v)
+		require.NoError(t, err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	rec := httptest.NewRecorder()
+	mHandlers.Prometheus(rec, req)
+
+	assert.Equal(t, "# HELP CPUutilization gauge metric CPUutilization\n"+
+		"# TYPE CPUutilization gauge\n"+
+		`CPUutilization{cpu="0",host="a"} 10`+"\n"+
+		`CPUutilization{cpu="1",host="a"} 20`+"\n", rec.Body.String())
+}
+
+func TestPrometheusHandlerDistributions(t *testing.T) {
+	t.Parallel()
+
+	log := testutils.GetTLogger()
+	memStorage := storage.NewMemStorage(log)
+	mHandlers := handlers.NewMetricsHandler(memStorage, log)
+
+	histogram := domain.NewHistogram([]float64{0.1, 1})
+	histogram.Observe(0.05)
+	histogram.Observe(0.5)
+	histogram.Observe(2)
+
+	err := memStorage.UpdateMany(context.Background(), &[]db.Metric{
+		*db.NewHistogramMetric("latency", histogram).WithLabels(domain.Labels{"host": "a"}),
+		*db.NewSummaryMetric("pause", domain.NewSummary([]float64{0.5, 0.99}, []float64{1, 2, 3})),
+	})
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	rec := httptest.NewRecorder()
+	mHandlers.Prometheus(rec, req)
+
+	assert.Equal(t, "# HELP latency histogram metric latency\n"+
+		"# TYPE latency histogram\n"+
+		`latency_bucket{host="a",le="0.1"} 1`+"\n"+
+		`latency_bucket{host="a",le="1"} 2`+"\n"+
+		`latency_bucket{host="a",le="+Inf"} 3`+"\n"+
+		`latency_sum{host="a"} 2.55`+"\n"+
+		`latency_count{host="a"} 3`+"\n"+
+		"# HELP pause summary metric pause\n"+
+		"# TYPE pause summary\n"+
+		`pause{quantile="0.5"} 2`+"\n"+
+		`pause{quantile="0.99"} 3`+"\n"+
+		"pause_sum 6\n"+
+		"pause_count 3\n", rec.Body.String())
+}
+
+func TestPrometheusHandlerPolicyRejections(t *testing.T) {
+	t.Parallel()
+
+	log := testutils.GetTLogger()
+	cfg := config.NewConfigBuilder(log).Build()
+	cfg.MaxSeries = 1
+
+	seriesPolicy, err := policy.NewPolicy(cfg, log)
+	require.NoError(t, err)
+
+	repo, err := policy.NewRepository(context.Background(), storage.NewMemStorage(log), seriesPolicy)
+	require.NoError(t, err)
+	mHandlers := handlers.NewMetricsHandler(repo, log).WithPolicy(seriesPolicy)
+	var cRouter router.Router = router.NewCustomRouter(cfg, log)
+	cRouter.SetRouter(mHandlers, nil)
+
+	for _, update := range []struct {
+		name   string
+		status int
+	}{{"first", http.StatusOK}, {"second", http.StatusTooManyRequests}} {
+		req := httptest.NewRequest(http.MethodPost, "/update/counter/"+update.name+"/1", nil)
+		req.Header.Set("Content-Type", "application/text")
+		rec := httptest.NewRecorder()
+		cRouter.GetRouter().ServeHTTP(rec, req)
+		assert.Equal(t, update.status, rec.Code, update.name)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	rec := httptest.NewRecorder()
+	cRouter.GetRouter().ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "# TYPE metrics_policy_rejections_total counter\n"+
+		"metrics_policy_rejections_total{reason=\"denied\"} 0\n"+
+		"metrics_policy_rejections_total{reason=\"invalid_name\"} 0\n"+
+		"metrics_policy_rejections_total{reason=\"series_limit\"} 1\n"+
+		"metrics_policy_rejections_total{reason=\"source_limit\"} 0\n")
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/klauspost/compress/s2"
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/proto"
+
+	pb "github.com/npavlov/go-metrics-service/gen/go/proto/prometheus/v1"
+	"github.com/npavlov/go-metrics-service/internal/server/ingest"
+)
+
+// maxRemoteWriteSize - the largest decompressed remote_write request accepted, in bytes.
+const maxRemoteWriteSize = 32 << 20
+
+var errRemoteWriteSize = errors.New("remote write request is too large")
+
+// RemoteWrite handles the Prometheus remote_write requests, snappy compressed WriteRequest protobufs.
+// The latest sample of every series is stored, see ingest.FromRemoteWrite.
+func (mh *MetricHandler) RemoteWrite(response http.ResponseWriter, request *http.Request) {
+	writeRequest, err := readRemoteWrite(request.Body)
+	if err != nil {
+		mh.logger.Error().Err(err).Msg("error reading remote write request")
+		http.Error(response, err.Error(), http.StatusBadRequest)
+
+		return
+	}
+
+	metrics, err := ingest.FromRemoteWrite(writeRequest)
+	if err != nil {
+		mh.logger.Error().Err(err).Msg("error converting remote write request")
+		http.Error(response, err.Error(), http.StatusBadRequest)
+
+		return
+	}
+
+	if len(metrics) > 0 {
+		if err := mh.repo.UpdateMany(request.Context(), &metrics); err != nil {
+			mh.logger.Error().Err(err).Msg("error updating metrics")
+			mh.respondWriteError(response, err, http.StatusInternalServerError, "Failed to update metrics")
+
+			return
+		}
+	}
+
+	response.WriteHeader(http.StatusNoContent)
+}
+
+func readRemoteWrite(body io.Reader) (*pb.WriteRequest, error) {
+	compressed, err := io.ReadAll(io.LimitReader(body, maxRemoteWriteSize))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read body")
+	}
+
+	size, err := s2.DecodedLen(compressed)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode snappy body")
+	}
+
+	if size > maxRemoteWriteSize {
+		return nil, errRemoteWriteSize
+	}
+
+	decoded, err := s2.Decode(nil, compressed)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode snappy body")
+	}
+
+	//nolint:exhaustruct
+	writeRequest := &pb.WriteRequest{}
+	if err := proto.Unmarshal(decoded, writeRequest); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal write request")
+	}
+
+	return writeRequest, nil
+}
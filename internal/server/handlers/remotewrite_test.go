@@ -0,0 +1,76 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/klauspost/compress/s2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+
+	pb "github.com/npavlov/go-metrics-service/gen/go/proto/prometheus/v1"
+	"github.com/npavlov/go-metrics-service/internal/domain"
+	"github.com/npavlov/go-metrics-service/internal/server/config"
+	"github.com/npavlov/go-metrics-service/internal/server/handlers"
+	"github.com/npavlov/go-metrics-service/internal/server/router"
+	"github.com/npavlov/go-metrics-service/internal/server/storage"
+	testutils "github.com/npavlov/go-metrics-service/internal/test_utils"
+)
+
+func TestMetricHandler_RemoteWrite(t *testing.T) {
+	t.Parallel()
+
+	log := testutils.GetTLogger()
+	memStorage := storage.NewMemStorage(log)
+	cfg := config.NewConfigBuilder(log).Build()
+	var cRouter router.Router = router.NewCustomRouter(cfg, log)
+	cRouter.SetRouter(handlers.NewMetricsHandler(memStorage, log), nil)
+
+	payload, err := proto.Marshal(&pb.WriteRequest{
+		Timeseries: []*pb.TimeSeries{
+			{
+				Labels:  []*pb.Label{{Name: "__name__", Value: "http_requests_total"}, {Name: "code", Value: "200"}},
+				Samples: []*pb.Sample{{Value: 42, Timestamp: 1000}},
+			},
+			{
+				Labels:  []*pb.Label{{Name: "__name__", Value: "queue_size"}},
+				Samples: []*pb.Sample{{Value: 3.5, Timestamp: 1000}},
+			},
+		},
+		Metadata: nil,
+	})
+	require.NoError(t, err)
+
+	send := func(body []byte) int {
+		request := httptest.NewRequest(http.MethodPost, "/api/v1/write", bytes.NewReader(body))
+		request.Header.Set("Content-Encoding", "snappy")
+		request.Header.Set("Content-Type", "application/x-protobuf")
+		recorder := httptest.NewRecorder()
+
+		cRouter.GetRouter().ServeHTTP(recorder, request)
+
+		return recorder.Code
+	}
+
+	assert.Equal(t, http.StatusNoContent, send(s2.EncodeSnappy(nil, payload)))
+
+	counter, found := memStorage.Get(context.Background(), `http_requests_total{code="200"}`)
+	require.True(t, found)
+	assert.Equal(t, domain.Counter, counter.MType)
+	assert.Equal(t, int64(42), *counter.Delta)
+
+	gauge, found := memStorage.Get(context.Background(), "queue_size")
+	require.True(t, found)
+	assert.InDelta(t, 3.5, *gauge.Value, 0)
+
+	// cumulative counters are stored as is
+	assert.Equal(t, http.StatusNoContent, send(s2.EncodeSnappy(nil, payload)))
+	counter, _ = memStorage.Get(context.Background(), `http_requests_total{code="200"}`)
+	assert.Equal(t, int64(42), *counter.Delta)
+
+	assert.Equal(t, http.StatusBadRequest, send(payload))
+}
@@ -40,9 +40,9 @@ func (mh *MetricHandler) RetrieveModel(response http.ResponseWriter, request *ht
 	}
 
 	// Prepare the updated metric to be returned
-	responseMetric, found := mh.repo.Get(request.Context(), metric.ID)
+	responseMetric, found := mh.repo.Get(request.Context(), metric.SeriesID())
 	if !found {
-		mh.logger.Error().Msgf("Failed to retrieve model from memory %s", metric.ID)
+		mh.logger.Error().Msgf("Failed to retrieve model from memory %s", metric.SeriesID())
 		http.Error(response, "Failed to retrieve model from memory", http.StatusNotFound)
 
 		return
@@ -97,8 +97,10 @@ func testUpdateModel(t *testing.T, server *httptest.Server, request *db.Metric,
 	assert.Equal(t, expectedCode, statusCode)
 
 	if expectedCode == http.StatusOK {
-		assert.Equal(t, request, res)
 		require.NoError(t, err)
+		require.NotNil(t, res.UpdatedAt)
+		res.UpdatedAt = nil
+		assert.Equal(t, request, res)
 	} else {
 		require.Error(t, err)
 	}
@@ -118,6 +120,8 @@ func testRetrieveModel(t *testing.T, server *httptest.Server, request *db.Metric
 
 	if expectedCode == http.StatusOK {
 		require.NoError(t, err)
+		require.NotNil(t, res.UpdatedAt)
+		res.UpdatedAt = nil
 		assert.Equal(t, expectedResponse, res)
 	} else {
 		require.Error(t, err)
@@ -28,7 +28,7 @@ func (mh *MetricHandler) Update(response http.ResponseWriter, request *http.Requ
 	_, err = mh.updateAndReturn(request, newMetric)
 	if err != nil {
 		mh.logger.Error().Err(err).Msg("error updating metric")
-		http.Error(response, err.Error(), http.StatusBadRequest)
+		mh.respondWriteError(response, err, http.StatusBadRequest, err.Error())
 
 		return
 	}
@@ -50,7 +50,7 @@ func (mh *MetricHandler) UpdateModel(response http.ResponseWriter, request *http
 	metric, err := mh.updateAndReturn(request, newMetric)
 	if err != nil {
 		mh.logger.Error().Err(err).Msg("error updating metric")
-		http.Error(response, err.Error(), http.StatusBadRequest)
+		mh.respondWriteError(response, err, http.StatusBadRequest, err.Error())
 
 		return
 	}
@@ -63,30 +63,15 @@ func (mh *MetricHandler) UpdateModel(response http.ResponseWriter, request *http
 	}
 }
 
-// updateAndReturn is a helper function to update or create a metric in the repository.
-// It retrieves an existing metric or creates a new one, updates its value, and returns the updated metric.
+// updateAndReturn is a helper function to apply a metric to the repository.
+// The metric is merged into its stored series atomically, the resulting metric is returned.
 func (mh *MetricHandler) updateAndReturn(request *http.Request, newMetric *db.Metric) (*db.Metric, error) {
-	existingMetric, found := mh.repo.Get(request.Context(), newMetric.ID)
-
-	if found {
-		existingMetric.SetValue(newMetric.Delta, newMetric.Value)
-
-		err := mh.repo.Update(request.Context(), existingMetric)
-		if err != nil {
-			mh.logger.Error().Err(err).Msg("error updating existingMetric")
-
-			return nil, errors.Wrap(err, "error updating existingMetric")
-		}
-
-		return existingMetric, nil
-	}
-
-	err := mh.repo.Create(request.Context(), newMetric)
+	applied, err := mh.repo.ApplyDeltas(request.Context(), []db.Metric{*newMetric})
 	if err != nil {
-		mh.logger.Error().Err(err).Msg("error creating Metric")
+		mh.logger.Error().Err(err).Msg("error applying Metric")
 
-		return nil, errors.Wrap(err, "error creating new Metric")
+		return nil, errors.Wrap(err, "error applying Metric")
 	}
 
-	return newMetric, nil
+	return &applied[0], nil
 }
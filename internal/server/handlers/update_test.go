@@ -72,6 +72,14 @@ func TestUpdateHandler(t *testing.T) {
 				result:     nil,
 			},
 		},
+		{
+			name:    "Histogram from a single value",
+			request: "/update/histogram/PauseNs/2324.43",
+			want: want{
+				statusCode: http.StatusBadRequest,
+				result:     nil,
+			},
+		},
 		{
 			name:    "With unknown metric type",
 			request: "/update/unknown/MSpanInuse/2324.43",
@@ -3,12 +3,11 @@ package handlers
 import (
 	"net/http"
 
-	"github.com/npavlov/go-metrics-service/internal/domain"
 	"github.com/npavlov/go-metrics-service/internal/server/db"
 )
 
 // UpdateModels handles HTTP requests to update multiple metrics in a single operation.
-// It validates the input, updates existing metrics, creates new ones, and returns the updated metrics as JSON.
+// It validates the input, applies the metrics to the stored ones, and returns the updated metrics as JSON.
 func (mh *MetricHandler) UpdateModels(response http.ResponseWriter, request *http.Request) {
 	// Parse and validate metrics from the request body
 	metrics, err := mh.validator.ManyFromBody(request.Body)
@@ -19,43 +18,16 @@ func (mh *MetricHandler) UpdateModels(response http.ResponseWriter, request *htt
 		return
 	}
 
-	// Collect metric IDs for database retrieval
-	metricIDs := make([]domain.MetricName, len(metrics))
+	newMetrics := make([]db.Metric, len(metrics))
 	for i, metric := range metrics {
-		metricIDs[i] = metric.ID
+		newMetrics[i] = *metric
 	}
 
-	// Fetch old metrics for updating existing ones
-	oldMetrics, err := mh.repo.GetMany(request.Context(), metricIDs)
+	// Merge the metrics into the stored ones, counters are incremented by the repository
+	newMetrics, err = mh.repo.ApplyDeltas(request.Context(), newMetrics)
 	if err != nil {
-		mh.logger.Error().Err(err).Msg("error getting old metrics")
-		http.Error(response, err.Error(), http.StatusInternalServerError)
-
-		return
-	}
-
-	// Prepare new metrics by updating existing ones or creating new entries
-	for _, metric := range metrics {
-		if oldMetric, found := oldMetrics[metric.ID]; found {
-			oldMetric.SetValue(metric.Delta, metric.Value)
-			oldMetrics[metric.ID] = oldMetric
-		} else {
-			oldMetrics[metric.ID] = *metric
-		}
-	}
-
-	// Prepare the newMetrics slice with the updated oldMetrics
-	newMetrics := make([]db.Metric, 0, len(oldMetrics))
-
-	// Add all metrics from oldMetrics to newMetrics
-	for _, oldMetric := range oldMetrics {
-		newMetrics = append(newMetrics, oldMetric)
-	}
-
-	// Update all metrics in the repository
-	if err = mh.repo.UpdateMany(request.Context(), &newMetrics); err != nil {
 		mh.logger.Error().Err(err).Msg("error updating metrics")
-		http.Error(response, "Failed to update metrics", http.StatusInternalServerError)
+		mh.respondWriteError(response, err, http.StatusInternalServerError, "Failed to update metrics")
 
 		return
 	}
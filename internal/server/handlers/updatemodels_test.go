@@ -89,6 +89,32 @@ func TestMetricHandler_UpdateModels(t *testing.T) {
 				*db.NewMetric("new_counter", domain.Counter, int64Ptr(100), nil), // Updated Delta
 			},
 		},
+		{
+			name: "Valid metrics - Histograms are merged",
+			inputBody: []db.Metric{
+				*db.NewHistogramMetric("new_histogram", &domain.HistogramData{
+					Bounds: []float64{1}, Counts: []uint64{1, 0}, Sum: 0.5, Count: 1,
+				}),
+				*db.NewHistogramMetric("new_histogram", &domain.HistogramData{
+					Bounds: []float64{1}, Counts: []uint64{1, 1}, Sum: 2.5, Count: 2,
+				}),
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody: []db.Metric{
+				*db.NewHistogramMetric("new_histogram", &domain.HistogramData{
+					Bounds: []float64{1}, Counts: []uint64{2, 1}, Sum: 3, Count: 3,
+				}),
+			},
+		},
+		{
+			name: "Invalid histogram in input",
+			inputBody: []map[string]interface{}{
+				{"id": "bad_histogram", "type": "histogram", "histogram": map[string]interface{}{
+					"bounds": []float64{1}, "counts": []int{1}, "sum": 1, "count": 1,
+				}},
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
 	}
 
 	for _, tt := range tests {
@@ -119,6 +145,12 @@ func TestMetricHandler_UpdateModels(t *testing.T) {
 				var respMetrics []db.Metric
 				err := json.NewDecoder(rec.Body).Decode(&respMetrics)
 				require.NoError(t, err)
+
+				// the stored series carry the time of the write
+				for i := range respMetrics {
+					require.NotNil(t, respMetrics[i].UpdatedAt)
+					respMetrics[i].UpdatedAt = nil
+				}
 				assert.ElementsMatch(t, tt.expectedBody, respMetrics)
 			}
 		})
@@ -0,0 +1,148 @@
+package hub
+
+import (
+	"sync"
+
+	"github.com/rs/zerolog"
+
+	"github.com/npavlov/go-metrics-service/internal/domain"
+	"github.com/npavlov/go-metrics-service/internal/server/db"
+)
+
+// subscriberBuffer is the number of events kept for a subscriber that is not reading fast enough.
+const subscriberBuffer = 64
+
+type EventType string
+
+const (
+	EventUpdate EventType = "update"
+	EventDelete EventType = "delete"
+)
+
+// Event - a change of a single metric, deletions carry only the metric ID.
+type Event struct {
+	Type   EventType `json:"type"`
+	Metric db.Metric `json:"metric"`
+}
+
+// Subscription receives the events of its tenant matching its name filter until it is unsubscribed.
+type Subscription struct {
+	events chan Event
+	tenant domain.Tenant
+	names  map[domain.MetricName]struct{}
+}
+
+// Events returns the channel of the subscription, it is closed on unsubscribe.
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+func (s *Subscription) matches(tenant domain.Tenant, metric *db.Metric) bool {
+	if tenant != s.tenant {
+		return false
+	}
+
+	if len(s.names) == 0 {
+		return true
+	}
+
+	// a subscription by name receives every series of the metric
+	if _, ok := s.names[metric.ID]; ok {
+		return true
+	}
+
+	_, ok := s.names[metric.SeriesID()]
+
+	return ok
+}
+
+// Hub fans out metric changes published by storages to subscribers.
+// Publishing never blocks writers: events are dropped for subscribers with a full buffer.
+type Hub struct {
+	mu          *sync.RWMutex
+	subscribers map[*Subscription]struct{}
+	l           *zerolog.Logger
+}
+
+// NewHub - constructor for Hub.
+func NewHub(l *zerolog.Logger) *Hub {
+	return &Hub{
+		mu:          &sync.RWMutex{},
+		subscribers: make(map[*Subscription]struct{}),
+		l:           l,
+	}
+}
+
+// Subscribe registers a subscriber for the given metric names of the tenant,
+// all metrics of the tenant are watched when names is empty.
+func (h *Hub) Subscribe(tenant domain.Tenant, names []domain.MetricName) *Subscription {
+	sub := &Subscription{
+		events: make(chan Event, subscriberBuffer),
+		tenant: tenant,
+		names:  make(map[domain.MetricName]struct{}, len(names)),
+	}
+
+	for _, name := range names {
+		sub.names[name] = struct{}{}
+	}
+
+	h.mu.Lock()
+	h.subscribers[sub] = struct{}{}
+	h.mu.Unlock()
+
+	return sub
+}
+
+// Unsubscribe removes the subscriber and closes its channel.
+func (h *Hub) Unsubscribe(sub *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.subscribers[sub]; !ok {
+		return
+	}
+
+	delete(h.subscribers, sub)
+	close(sub.events)
+}
+
+// PublishUpdates notifies subscribers of the tenant about updated metrics, it is a no-op on a nil hub.
+func (h *Hub) PublishUpdates(tenant domain.Tenant, metrics ...db.Metric) {
+	if h == nil {
+		return
+	}
+
+	for _, metric := range metrics {
+		h.publish(tenant, Event{Type: EventUpdate, Metric: metric})
+	}
+}
+
+// PublishDeletes notifies subscribers of the tenant about deleted series, it is a no-op on a nil hub.
+// The events carry the name and the labels of the series like the updates do.
+func (h *Hub) PublishDeletes(tenant domain.Tenant, seriesIDs ...domain.MetricName) {
+	if h == nil {
+		return
+	}
+
+	for _, seriesID := range seriesIDs {
+		name, labels := domain.ParseSeriesID(seriesID)
+		h.publish(tenant, Event{Type: EventDelete, Metric: *db.NewMetric(name, "", nil, nil).WithLabels(labels)})
+	}
+}
+
+func (h *Hub) publish(tenant domain.Tenant, event Event) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for sub := range h.subscribers {
+		if !sub.matches(tenant, &event.Metric) {
+			continue
+		}
+
+		select {
+		case sub.events <- event:
+		default:
+			h.l.Warn().Str("metric", string(event.Metric.ID)).Msg("subscriber is too slow, dropping event")
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package hub_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/npavlov/go-metrics-service/internal/domain"
+	"github.com/npavlov/go-metrics-service/internal/server/db"
+	"github.com/npavlov/go-metrics-service/internal/server/hub"
+	testutils "github.com/npavlov/go-metrics-service/internal/test_utils"
+)
+
+func TestHubPublish(t *testing.T) {
+	t.Parallel()
+
+	changeHub := hub.NewHub(testutils.GetTLogger())
+
+	all := changeHub.Subscribe(domain.DefaultTenant, nil)
+	filtered := changeHub.Subscribe(domain.DefaultTenant, []domain.MetricName{"PollCount"})
+
+	value := 1.5
+	delta := int64(3)
+	changeHub.PublishUpdates(domain.DefaultTenant,
+		*db.NewMetric("Alloc", domain.Gauge, nil, &value),
+		*db.NewMetric("PollCount", domain.Counter, &delta, nil),
+	)
+	changeHub.PublishDeletes(domain.DefaultTenant, "PollCount")
+
+	require.Len(t, all.Events(), 3)
+	require.Len(t, filtered.Events(), 2)
+
+	event := <-filtered.Events()
+	assert.Equal(t, hub.EventUpdate, event.Type)
+	assert.Equal(t, domain.MetricName("PollCount"), event.Metric.ID)
+	assert.Equal(t, delta, *event.Metric.Delta)
+
+	event = <-filtered.Events()
+	assert.Equal(t, hub.EventDelete, event.Type)
+	assert.Equal(t, domain.MetricName("PollCount"), event.Metric.ID)
+
+	changeHub.Unsubscribe(filtered)
+	_, ok := <-filtered.Events()
+	assert.False(t, ok)
+
+	// Unsubscribing twice is safe
+	changeHub.Unsubscribe(filtered)
+}
+
+func TestHubIsolatesTenants(t *testing.T) {
+	t.Parallel()
+
+	changeHub := hub.NewHub(testutils.GetTLogger())
+
+	own := changeHub.Subscribe("team-a", nil)
+	other := changeHub.Subscribe("team-b", nil)
+
+	changeHub.PublishDeletes("team-a", "Alloc")
+
+	require.Len(t, own.Events(), 1)
+	assert.Empty(t, other.Events())
+}
+
+func TestHubDropsEventsForSlowSubscribers(t *testing.T) {
+	t.Parallel()
+
+	changeHub := hub.NewHub(testutils.GetTLogger())
+	sub := changeHub.Subscribe(domain.DefaultTenant, nil)
+
+	for range 1000 {
+		changeHub.PublishDeletes(domain.DefaultTenant, "Alloc")
+	}
+
+	assert.Equal(t, cap(sub.Events()), len(sub.Events()))
+}
+
+func TestNilHub(t *testing.T) {
+	t.Parallel()
+
+	var changeHub *hub.Hub
+
+	assert.NotPanics(t, func() {
+		changeHub.PublishUpdates(domain.DefaultTenant, *db.NewMetric("Alloc", domain.Gauge, nil, nil))
+		changeHub.PublishDeletes(domain.DefaultTenant, "Alloc")
+	})
+}
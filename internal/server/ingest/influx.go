@@ -0,0 +1,201 @@
+package ingest
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/npavlov/go-metrics-service/internal/domain"
+	"github.com/npavlov/go-metrics-service/internal/server/db"
+)
+
+// ErrInvalidLine is returned for a line that is not valid InfluxDB line protocol.
+var ErrInvalidLine = errors.New("invalid line protocol")
+
+//nolint:gochecknoglobals
+var lineUnescaper = strings.NewReplacer(`\,`, ",", `\=`, "=", `\ `, " ", `\"`, `"`, `\\`, `\`)
+
+// FromLineProtocol converts InfluxDB line protocol, measurement[,tag=value...] field=value[,field=value...] [timestamp],
+// into metrics named measurement_field with the tags as labels, the tag keys are sanitized to the label syntax,
+// e.g. host-name is host_name. Integer fields, the ones with the i or u suffix,
+// are counters stored as is, float fields are gauges, string and boolean fields are skipped.
+// The timestamps are validated but not stored, the last line of a series wins.
+func FromLineProtocol(body []byte) ([]db.Metric, error) {
+	metrics := make([]db.Metric, 0)
+	positions := make(map[domain.MetricName]int)
+
+	for index, line := range strings.Split(string(body), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		parsed, err := parseLine(line)
+		if err != nil {
+			return nil, errors.Wrapf(err, "line %d", index+1)
+		}
+
+		for _, metric := range parsed {
+			id := metric.SeriesID()
+			if position, found := positions[id]; found {
+				metrics[position] = metric
+
+				continue
+			}
+			positions[id] = len(metrics)
+			metrics = append(metrics, metric)
+		}
+	}
+
+	return metrics, nil
+}
+
+func parseLine(line string) ([]db.Metric, error) {
+	key, rest, found := cutUnescaped(line, ' ', false)
+	if !found {
+		return nil, errors.Wrap(ErrInvalidLine, "no fields")
+	}
+
+	fields, timestamp, _ := cutUnescaped(strings.TrimLeft(rest, " "), ' ', true)
+	if timestamp = strings.TrimSpace(timestamp); timestamp != "" {
+		if _, err := strconv.ParseInt(timestamp, 10, 64); err != nil {
+			return nil, errors.Wrapf(ErrInvalidLine, "invalid timestamp %q", timestamp)
+		}
+	}
+
+	measurement, labels, err := parseKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	metrics := make([]db.Metric, 0)
+
+	for _, field := range splitUnescaped(fields, ',', true) {
+		name, value, found := cutUnescaped(field, '=', false)
+		if !found || name == "" || value == "" {
+			return nil, errors.Wrapf(ErrInvalidLine, "invalid field %q", field)
+		}
+
+		metric, numeric, err := fieldMetric(domain.MetricName(measurement+"_"+lineUnescaper.Replace(name)), value)
+		if err != nil {
+			return nil, err
+		}
+
+		if numeric {
+			metrics = append(metrics, *metric.WithLabels(labels))
+		}
+	}
+
+	return metrics, nil
+}
+
+// parseKey parses the measurement and the tags of a line.
+func parseKey(key string) (string, domain.Labels, error) {
+	parts := splitUnescaped(key, ',', false)
+
+	measurement := lineUnescaper.Replace(parts[0])
+	if measurement == "" {
+		return "", nil, errors.Wrap(ErrInvalidLine, "no measurement")
+	}
+
+	labels := make(domain.Labels, len(parts)-1)
+
+	for _, tag := range parts[1:] {
+		name, value, found := cutUnescaped(tag, '=', false)
+		if !found || name == "" || value == "" {
+			return "", nil, errors.Wrapf(ErrInvalidLine, "invalid tag %q", tag)
+		}
+		labels[sanitizeName(lineUnescaper.Replace(name))] = lineUnescaper.Replace(value)
+	}
+
+	if err := labels.Validate(); err != nil {
+		return "", nil, errors.Wrapf(ErrInvalidSeries, "%s: %v", measurement, err)
+	}
+
+	if len(labels) == 0 {
+		labels = nil
+	}
+
+	return measurement, labels, nil
+}
+
+// fieldMetric converts a field value into a metric, it reports false for the string and boolean fields.
+func fieldMetric(name domain.MetricName, value string) (*db.Metric, bool, error) {
+	switch {
+	case strings.HasPrefix(value, `"`):
+		if len(value) < 2 || !strings.HasSuffix(value, `"`) { //nolint:mnd
+			return nil, false, errors.Wrapf(ErrInvalidLine, "unterminated string field %s", name)
+		}
+
+		return nil, false, nil
+	case isBool(value):
+		return nil, false, nil
+	case strings.HasSuffix(value, "i"):
+		delta, err := strconv.ParseInt(strings.TrimSuffix(value, "i"), 10, 64)
+		if err != nil {
+			return nil, false, errors.Wrapf(ErrInvalidLine, "invalid integer field %s", name)
+		}
+
+		return db.NewMetric(name, domain.Counter, &delta, nil), true, nil
+	case strings.HasSuffix(value, "u"):
+		unsigned, err := strconv.ParseUint(strings.TrimSuffix(value, "u"), 10, 64)
+		if err != nil || unsigned > math.MaxInt64 {
+			return nil, false, errors.Wrapf(ErrInvalidLine, "invalid unsigned field %s", name)
+		}
+		delta := int64(unsigned)
+
+		return db.NewMetric(name, domain.Counter, &delta, nil), true, nil
+	}
+
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsNaN(parsed) || math.IsInf(parsed, 0) {
+		return nil, false, errors.Wrapf(ErrInvalidLine, "invalid float field %s", name)
+	}
+
+	return db.NewMetric(name, domain.Gauge, nil, &parsed), true, nil
+}
+
+func isBool(value string) bool {
+	switch value {
+	case "t", "T", "true", "True", "TRUE", "f", "F", "false", "False", "FALSE":
+		return true
+	}
+
+	return false
+}
+
+// cutUnescaped cuts the text around the first separator not escaped with a backslash,
+// separators within double quotes are skipped when quoted is set.
+func cutUnescaped(text string, separator byte, quoted bool) (string, string, bool) {
+	inQuotes := false
+
+	for index := 0; index < len(text); index++ {
+		switch char := text[index]; {
+		case char == '\\':
+			index++
+		case quoted && char == '"':
+			inQuotes = !inQuotes
+		case char == separator && !inQuotes:
+			return text[:index], text[index+1:], true
+		}
+	}
+
+	return text, "", false
+}
+
+// splitUnescaped splits the text at the separators not escaped with a backslash, see cutUnescaped.
+func splitUnescaped(text string, separator byte, quoted bool) []string {
+	parts := make([]string, 0)
+
+	for {
+		part, rest, found := cutUnescaped(text, separator, quoted)
+		parts = append(parts, part)
+
+		if !found {
+			return parts
+		}
+		text = rest
+	}
+}
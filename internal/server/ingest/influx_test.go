@@ -0,0 +1,82 @@
+package ingest_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/npavlov/go-metrics-service/internal/domain"
+	"github.com/npavlov/go-metrics-service/internal/server/db"
+	"github.com/npavlov/go-metrics-service/internal/server/ingest"
+)
+
+func TestFromLineProtocol(t *testing.T) {
+	t.Parallel()
+
+	body := `# telegraf output
+cpu,host=db1,cpu=cpu0 usage_idle=97.5,usage_user=1.25 1700000000000000000
+net,host=db1 bytes_recv=1024i,packets=7u,up=true,name="eth0 main, \"primary\"" 1700000000000000000
+
+disk_io,host=db1,path=/var/lib\ data reads=3i
+cpu,host=db1,cpu=cpu0 usage_idle=90
+`
+
+	metrics, err := ingest.FromLineProtocol([]byte(body))
+	require.NoError(t, err)
+
+	series := make(map[domain.MetricName]db.Metric, len(metrics))
+	for _, metric := range metrics {
+		series[metric.SeriesID()] = metric
+	}
+
+	assert.Len(t, metrics, 5)
+
+	idle := series[`cpu_usage_idle{cpu="cpu0",host="db1"}`]
+	assert.Equal(t, domain.Gauge, idle.MType)
+	assert.InDelta(t, 90, *idle.Value, 0, "the last line of a series wins")
+	assert.InDelta(t, 1.25, *series[`cpu_usage_user{cpu="cpu0",host="db1"}`].Value, 0)
+
+	received := series[`net_bytes_recv{host="db1"}`]
+	assert.Equal(t, domain.Counter, received.MType)
+	assert.Equal(t, int64(1024), *received.Delta)
+	assert.Equal(t, int64(7), *series[`net_packets{host="db1"}`].Delta)
+
+	reads := series[`disk_io_reads{host="db1",path="/var/lib data"}`]
+	assert.Equal(t, domain.Counter, reads.MType)
+	assert.Equal(t, int64(3), *reads.Delta)
+}
+
+func TestFromLineProtocol_Invalid(t *testing.T) {
+	t.Parallel()
+
+	for _, line := range []string{
+		"cpu",
+		"cpu ",
+		",host=db1 value=1",
+		"cpu,host value=1",
+		"cpu value",
+		"cpu value=one",
+		"cpu value=1x",
+		"cpu value=1.5i",
+		`cpu value="open`,
+		"cpu value=1 yesterday",
+	} {
+		_, err := ingest.FromLineProtocol([]byte(line))
+		require.ErrorIs(t, err, ingest.ErrInvalidLine, line)
+	}
+
+	_, err := ingest.FromLineProtocol([]byte("cpu,host=" + strings.Repeat("x", domain.MaxLabelsLength) + " value=1"))
+	require.ErrorIs(t, err, ingest.ErrInvalidSeries)
+}
+
+func TestFromLineProtocol_TagKeys(t *testing.T) {
+	t.Parallel()
+
+	// the tag keys outside of the label syntax are sanitized instead of rejecting the write
+	metrics, err := ingest.FromLineProtocol([]byte(`cpu,host-name=db1,k8s.pod=api,1zone=a value=1`))
+	require.NoError(t, err)
+	require.Len(t, metrics, 1)
+	assert.Equal(t, domain.MetricName(`cpu_value{_1zone="a",host_name="db1",k8s_pod="api"}`), metrics[0].SeriesID())
+}
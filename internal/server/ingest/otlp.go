@@ -0,0 +1,321 @@
+package ingest
+
+import (
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	colpb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+
+	"github.com/npavlov/go-metrics-service/internal/domain"
+	"github.com/npavlov/go-metrics-service/internal/model"
+	"github.com/npavlov/go-metrics-service/internal/server/db"
+)
+
+// The resource attributes naming the service, see the OpenTelemetry semantic conventions.
+const (
+	serviceNameAttribute      = "service.name"
+	serviceNamespaceAttribute = "service.namespace"
+)
+
+// OTLPOptions - how the resource attributes of the OTLP metrics are kept.
+type OTLPOptions struct {
+	// ResourceLabels - the resource attributes kept as labels, every attribute is kept when empty.
+	ResourceLabels []string
+	// ServicePrefix - prefix the metric names with the service namespace and name instead of labeling them.
+	ServicePrefix bool
+}
+
+// FromOTLP converts the metrics of an OTLP export request into metrics of the repository.
+// Monotonic sums are counters, other sums and gauges are gauges, histograms and summaries keep their type.
+// The names are sanitized to the label syntax, the attributes of a data point and the kept resource attributes
+// become labels, scalar attributes only. Of the points of a series the latest one is kept unless it is a delta,
+// exponential histograms and the points without a recorded value are skipped.
+// Gauges, cumulative sums, cumulative histograms and summaries are the values of the batch, delta monotonic sums
+// and delta histograms its deltas, delta sums that are not monotonic its changes.
+func FromOTLP(request *colpb.ExportMetricsServiceRequest, options OTLPOptions) (*model.Batch, error) {
+	batch := &model.Batch{Values: nil, Deltas: nil, Changes: nil}
+	latest := make(map[domain.MetricName]latestValue)
+
+	for _, resourceMetrics := range request.GetResourceMetrics() {
+		prefix, resourceLabels := resourceLabels(resourceMetrics.GetResource().GetAttributes(), options)
+
+		for _, scopeMetrics := range resourceMetrics.GetScopeMetrics() {
+			for _, metric := range scopeMetrics.GetMetrics() {
+				if metric.GetName() == "" {
+					return nil, errors.Wrap(ErrInvalidSeries, "metric without a name")
+				}
+
+				converter := &otlpConverter{
+					batch:  batch,
+					latest: latest,
+					name:   domain.MetricName(prefix + sanitizeName(metric.GetName())),
+					labels: resourceLabels,
+				}
+				converter.convert(metric)
+			}
+		}
+	}
+
+	return batch, nil
+}
+
+// latestValue - the position of a value in the batch and the time of its point.
+type latestValue struct {
+	position int
+	time     uint64
+}
+
+type otlpConverter struct {
+	batch  *model.Batch
+	latest map[domain.MetricName]latestValue
+	name   domain.MetricName
+	labels domain.Labels
+}
+
+func (c *otlpConverter) convert(metric *metricspb.Metric) {
+	switch data := metric.GetData().(type) {
+	case *metricspb.Metric_Gauge:
+		for _, point := range data.Gauge.GetDataPoints() {
+			if value, ok := numberValue(point); ok {
+				c.addValue(db.NewMetric(c.name, domain.Gauge, nil, &value), point.GetAttributes(), point.GetTimeUnixNano())
+			}
+		}
+	case *metricspb.Metric_Sum:
+		c.convertSum(data.Sum)
+	case *metricspb.Metric_Histogram:
+		delta := data.Histogram.GetAggregationTemporality() == metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA
+
+		for _, point := range data.Histogram.GetDataPoints() {
+			histogram, ok := histogramValue(point)
+			if !ok {
+				continue
+			}
+
+			converted := db.NewHistogramMetric(c.name, histogram)
+			if delta {
+				c.batch.Deltas = append(c.batch.Deltas, *converted.WithLabels(c.pointLabels(point.GetAttributes())))
+			} else {
+				c.addValue(converted, point.GetAttributes(), point.GetTimeUnixNano())
+			}
+		}
+	case *metricspb.Metric_Summary:
+		for _, point := range data.Summary.GetDataPoints() {
+			if summary, ok := summaryValue(point); ok {
+				c.addValue(db.NewSummaryMetric(c.name, summary), point.GetAttributes(), point.GetTimeUnixNano())
+			}
+		}
+	}
+}
+
+func (c *otlpConverter) convertSum(sum *metricspb.Sum) {
+	delta := sum.GetAggregationTemporality() == metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA
+
+	for _, point := range sum.GetDataPoints() {
+		value, ok := numberValue(point)
+		if !ok {
+			continue
+		}
+
+		switch {
+		case !sum.GetIsMonotonic() && delta:
+			converted := db.NewMetric(c.name, domain.Gauge, nil, &value)
+			c.batch.Changes = append(c.batch.Changes, *converted.WithLabels(c.pointLabels(point.GetAttributes())))
+		case !sum.GetIsMonotonic():
+			c.addValue(db.NewMetric(c.name, domain.Gauge, nil, &value), point.GetAttributes(), point.GetTimeUnixNano())
+		case delta:
+			counter := int64(math.Round(value))
+			converted := db.NewMetric(c.name, domain.Counter, &counter, nil)
+			c.batch.Deltas = append(c.batch.Deltas, *converted.WithLabels(c.pointLabels(point.GetAttributes())))
+		default:
+			// cumulative counters are stored as is like the ones of Prometheus
+			counter := int64(math.Round(value))
+			c.addValue(db.NewMetric(c.name, domain.Counter, &counter, nil), point.GetAttributes(), point.GetTimeUnixNano())
+		}
+	}
+}
+
+// addValue adds the value to the batch unless a later point of its series is there already.
+func (c *otlpConverter) addValue(metric *db.Metric, attributes []*commonpb.KeyValue, time uint64) {
+	metric.WithLabels(c.pointLabels(attributes))
+	id := metric.SeriesID()
+
+	if previous, found := c.latest[id]; found {
+		if time >= previous.time {
+			c.batch.Values[previous.position] = *metric
+			c.latest[id] = latestValue{position: previous.position, time: time}
+		}
+
+		return
+	}
+
+	c.latest[id] = latestValue{position: len(c.batch.Values), time: time}
+	c.batch.Values = append(c.batch.Values, *metric)
+}
+
+// pointLabels merges the attributes of a data point into the resource labels, the point attributes win.
+func (c *otlpConverter) pointLabels(attributes []*commonpb.KeyValue) domain.Labels {
+	labels := make(domain.Labels, len(c.labels)+len(attributes))
+	for name, value := range c.labels {
+		labels[name] = value
+	}
+
+	addAttributes(labels, attributes)
+
+	if len(labels) == 0 {
+		return nil
+	}
+
+	return labels
+}
+
+// resourceLabels returns the name prefix and the labels of the resource attributes.
+func resourceLabels(attributes []*commonpb.KeyValue, options OTLPOptions) (string, domain.Labels) {
+	kept := make([]*commonpb.KeyValue, 0, len(attributes))
+	prefix := ""
+
+	for _, attribute := range attributes {
+		key := attribute.GetKey()
+
+		if options.ServicePrefix && (key == serviceNameAttribute || key == serviceNamespaceAttribute) {
+			continue
+		}
+
+		if len(options.ResourceLabels) == 0 || slices.Contains(options.ResourceLabels, key) {
+			kept = append(kept, attribute)
+		}
+	}
+
+	if options.ServicePrefix {
+		for _, key := range []string{serviceNamespaceAttribute, serviceNameAttribute} {
+			if value, ok := attributeValue(findAttribute(attributes, key)); ok && value != "" {
+				prefix += sanitizeName(value) + "_"
+			}
+		}
+	}
+
+	labels := make(domain.Labels, len(kept))
+	addAttributes(labels, kept)
+
+	return prefix, labels
+}
+
+func findAttribute(attributes []*commonpb.KeyValue, key string) *commonpb.AnyValue {
+	for _, attribute := range attributes {
+		if attribute.GetKey() == key {
+			return attribute.GetValue()
+		}
+	}
+
+	return nil
+}
+
+// addAttributes adds the scalar attributes to the labels with the sanitized names.
+func addAttributes(labels domain.Labels, attributes []*commonpb.KeyValue) {
+	for _, attribute := range attributes {
+		if value, ok := attributeValue(attribute.GetValue()); ok && attribute.GetKey() != "" {
+			labels[sanitizeName(attribute.GetKey())] = value
+		}
+	}
+}
+
+func attributeValue(value *commonpb.AnyValue) (string, bool) {
+	switch typed := value.GetValue().(type) {
+	case *commonpb.AnyValue_StringValue:
+		return typed.StringValue, true
+	case *commonpb.AnyValue_BoolValue:
+		return strconv.FormatBool(typed.BoolValue), true
+	case *commonpb.AnyValue_IntValue:
+		return strconv.FormatInt(typed.IntValue, 10), true
+	case *commonpb.AnyValue_DoubleValue:
+		return strconv.FormatFloat(typed.DoubleValue, 'g', -1, 64), true
+	}
+
+	return "", false
+}
+
+func numberValue(point *metricspb.NumberDataPoint) (float64, bool) {
+	if noRecordedValue(point.GetFlags()) {
+		return 0, false
+	}
+
+	var value float64
+
+	switch typed := point.GetValue().(type) {
+	case *metricspb.NumberDataPoint_AsDouble:
+		value = typed.AsDouble
+	case *metricspb.NumberDataPoint_AsInt:
+		value = float64(typed.AsInt)
+	default:
+		return 0, false
+	}
+
+	return value, !math.IsNaN(value) && !math.IsInf(value, 0)
+}
+
+func histogramValue(point *metricspb.HistogramDataPoint) (*domain.HistogramData, bool) {
+	if noRecordedValue(point.GetFlags()) {
+		return nil, false
+	}
+
+	histogram := &domain.HistogramData{
+		Bounds: slices.Clone(point.GetExplicitBounds()),
+		Counts: slices.Clone(point.GetBucketCounts()),
+		Sum:    point.GetSum(),
+		Count:  point.GetCount(),
+	}
+
+	// a point may carry the count and the sum only
+	if len(histogram.Counts) == 0 {
+		histogram.Bounds = nil
+		histogram.Counts = []uint64{histogram.Count}
+	}
+
+	return histogram, histogram.Validate() == nil
+}
+
+func summaryValue(point *metricspb.SummaryDataPoint) (*domain.SummaryData, bool) {
+	if noRecordedValue(point.GetFlags()) {
+		return nil, false
+	}
+
+	summary := &domain.SummaryData{
+		Quantiles: make([]domain.Quantile, 0, len(point.GetQuantileValues())),
+		Sum:       point.GetSum(),
+		Count:     point.GetCount(),
+	}
+
+	for _, quantile := range point.GetQuantileValues() {
+		summary.Quantiles = append(summary.Quantiles, domain.Quantile{
+			Quantile: quantile.GetQuantile(),
+			Value:    quantile.GetValue(),
+		})
+	}
+
+	return summary, true
+}
+
+func noRecordedValue(flags uint32) bool {
+	return flags&uint32(metricspb.DataPointFlags_DATA_POINT_FLAGS_NO_RECORDED_VALUE_MASK) != 0
+}
+
+// sanitizeName replaces the characters not allowed in label names, e.g. http.server.duration is http_server_duration.
+func sanitizeName(name string) string {
+	sanitized := strings.Map(func(char rune) rune {
+		if char == '_' || (char >= 'a' && char <= 'z') || (char >= 'A' && char <= 'Z') || (char >= '0' && char <= '9') {
+			return char
+		}
+
+		return '_'
+	}, name)
+
+	if sanitized != "" && sanitized[0] >= '0' && sanitized[0] <= '9' {
+		sanitized = "_" + sanitized
+	}
+
+	return sanitized
+}
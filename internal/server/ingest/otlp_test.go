@@ -0,0 +1,151 @@
+package ingest_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	colpb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+
+	"github.com/npavlov/go-metrics-service/internal/domain"
+	"github.com/npavlov/go-metrics-service/internal/server/db"
+	"github.com/npavlov/go-metrics-service/internal/server/ingest"
+)
+
+func attribute(key, value string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{Key: key, Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: value}}}
+}
+
+func doublePoint(value float64, time uint64, attributes ...*commonpb.KeyValue) *metricspb.NumberDataPoint {
+	//nolint:exhaustruct
+	return &metricspb.NumberDataPoint{
+		Attributes:   attributes,
+		TimeUnixNano: time,
+		Value:        &metricspb.NumberDataPoint_AsDouble{AsDouble: value},
+	}
+}
+
+func intPoint(value int64, attributes ...*commonpb.KeyValue) *metricspb.NumberDataPoint {
+	//nolint:exhaustruct
+	return &metricspb.NumberDataPoint{
+		Attributes:   attributes,
+		TimeUnixNano: 1,
+		Value:        &metricspb.NumberDataPoint_AsInt{AsInt: value},
+	}
+}
+
+func sum(name string, monotonic bool, temporality metricspb.AggregationTemporality,
+	points ...*metricspb.NumberDataPoint,
+) *metricspb.Metric {
+	//nolint:exhaustruct
+	return &metricspb.Metric{Name: name, Data: &metricspb.Metric_Sum{Sum: &metricspb.Sum{
+		DataPoints:             points,
+		AggregationTemporality: temporality,
+		IsMonotonic:            monotonic,
+	}}}
+}
+
+func exportRequest(resource []*commonpb.KeyValue, metrics ...*metricspb.Metric) *colpb.ExportMetricsServiceRequest {
+	//nolint:exhaustruct
+	return &colpb.ExportMetricsServiceRequest{ResourceMetrics: []*metricspb.ResourceMetrics{{
+		Resource:     &resourcepb.Resource{Attributes: resource},
+		ScopeMetrics: []*metricspb.ScopeMetrics{{Metrics: metrics}},
+	}}}
+}
+
+func bySeries(metrics []db.Metric) map[domain.MetricName]db.Metric {
+	series := make(map[domain.MetricName]db.Metric, len(metrics))
+	for _, metric := range metrics {
+		series[metric.SeriesID()] = metric
+	}
+
+	return series
+}
+
+func TestFromOTLP(t *testing.T) {
+	t.Parallel()
+
+	cumulative := metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE
+	delta := metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA
+	noValue := doublePoint(1, 3)
+	noValue.Flags = uint32(metricspb.DataPointFlags_DATA_POINT_FLAGS_NO_RECORDED_VALUE_MASK)
+
+	request := exportRequest(
+		[]*commonpb.KeyValue{attribute("service.name", "checkout"), attribute("process.pid", "42")},
+		//nolint:exhaustruct
+		&metricspb.Metric{Name: "memory.usage", Data: &metricspb.Metric_Gauge{Gauge: &metricspb.Gauge{
+			DataPoints: []*metricspb.NumberDataPoint{doublePoint(20, 2), doublePoint(10, 1), doublePoint(math.NaN(), 3), noValue},
+		}}},
+		sum("http.requests", true, cumulative, intPoint(41, attribute("http.method", "GET"))),
+		sum("jobs.done", true, delta, intPoint(2), intPoint(3)),
+		sum("queue.size", false, cumulative, intPoint(7)),
+		sum("connections", false, delta, intPoint(-1)),
+		//nolint:exhaustruct
+		&metricspb.Metric{Name: "latency", Data: &metricspb.Metric_Histogram{Histogram: &metricspb.Histogram{
+			AggregationTemporality: cumulative,
+			DataPoints: []*metricspb.HistogramDataPoint{{
+				Count:          3,
+				Sum:            proto64(1.5),
+				BucketCounts:   []uint64{1, 2, 0},
+				ExplicitBounds: []float64{0.1, 1},
+			}},
+		}}},
+	)
+
+	batch, err := ingest.FromOTLP(request, ingest.OTLPOptions{ResourceLabels: []string{"service.name"}, ServicePrefix: false})
+	require.NoError(t, err)
+
+	values := bySeries(batch.Values)
+	assert.Len(t, batch.Values, 4)
+
+	memory := values[`memory_usage{service_name="checkout"}`]
+	assert.Equal(t, domain.Gauge, memory.MType)
+	assert.InDelta(t, 20, *memory.Value, 0, "the latest point wins")
+
+	requests := values[`http_requests{http_method="GET",service_name="checkout"}`]
+	assert.Equal(t, domain.Counter, requests.MType)
+	assert.Equal(t, int64(41), *requests.Delta)
+
+	assert.Equal(t, domain.Gauge, values[`queue_size{service_name="checkout"}`].MType)
+
+	latency := values[`latency{service_name="checkout"}`]
+	assert.Equal(t, domain.Histogram, latency.MType)
+	assert.Equal(t, []uint64{1, 2, 0}, latency.Histogram.Counts)
+
+	require.Len(t, batch.Deltas, 2)
+	assert.Equal(t, domain.Counter, batch.Deltas[0].MType)
+	assert.Equal(t, int64(2), *batch.Deltas[0].Delta)
+
+	require.Len(t, batch.Changes, 1)
+	assert.InDelta(t, -1, *batch.Changes[0].Value, 0)
+}
+
+func TestFromOTLP_ServicePrefix(t *testing.T) {
+	t.Parallel()
+
+	request := exportRequest(
+		[]*commonpb.KeyValue{
+			attribute("service.namespace", "shop"),
+			attribute("service.name", "checkout-api"),
+			attribute("host.name", "web1"),
+		},
+		sum("orders", true, metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE, intPoint(5)),
+	)
+
+	batch, err := ingest.FromOTLP(request, ingest.OTLPOptions{ResourceLabels: nil, ServicePrefix: true})
+	require.NoError(t, err)
+	require.Len(t, batch.Values, 1)
+	assert.Equal(t, domain.MetricName(`shop_checkout_api_orders{host_name="web1"}`), batch.Values[0].SeriesID())
+
+	//nolint:exhaustruct
+	_, err = ingest.FromOTLP(exportRequest(nil, &metricspb.Metric{}), ingest.OTLPOptions{})
+	require.ErrorIs(t, err, ingest.ErrInvalidSeries)
+}
+
+func proto64(value float64) *float64 {
+	return &value
+}
@@ -0,0 +1,132 @@
+// Package ingest converts the payloads of third party metric protocols into metrics of the repository.
+package ingest
+
+import (
+	"math"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	pb "github.com/npavlov/go-metrics-service/gen/go/proto/prometheus/v1"
+	"github.com/npavlov/go-metrics-service/internal/domain"
+	"github.com/npavlov/go-metrics-service/internal/server/db"
+)
+
+// nameLabel - the Prometheus label carrying the metric name.
+const nameLabel = "__name__"
+
+// ErrInvalidSeries is returned for a series without a name or with an invalid label.
+var ErrInvalidSeries = errors.New("invalid series")
+
+// FromRemoteWrite converts the series of a Prometheus remote_write request into metrics, one per series
+// with the value of its latest sample. The type of a series comes from the metadata of its family,
+// the series of counters, histogram buckets and counts are counters, the series named with the _total suffix
+// are counters when the family has no metadata, every other series is a gauge.
+// Prometheus counters are cumulative, they are rounded to the counter value and stored as is.
+// Samples that are not finite, e.g. the staleness markers, are skipped.
+func FromRemoteWrite(request *pb.WriteRequest) ([]db.Metric, error) {
+	types := make(map[string]pb.MetricMetadata_MetricType, len(request.GetMetadata()))
+	for _, metadata := range request.GetMetadata() {
+		types[metadata.GetMetricFamilyName()] = metadata.GetType()
+	}
+
+	metrics := make([]db.Metric, 0, len(request.GetTimeseries()))
+
+	for _, series := range request.GetTimeseries() {
+		sample, found := latestSample(series.GetSamples())
+		if !found {
+			continue
+		}
+
+		name, labels, err := seriesLabels(series.GetLabels())
+		if err != nil {
+			return nil, err
+		}
+
+		var metric *db.Metric
+		if isCounter(name, types) {
+			delta := int64(math.Round(sample.GetValue()))
+			metric = db.NewMetric(domain.MetricName(name), domain.Counter, &delta, nil)
+		} else {
+			value := sample.GetValue()
+			metric = db.NewMetric(domain.MetricName(name), domain.Gauge, nil, &value)
+		}
+
+		metrics = append(metrics, *metric.WithLabels(labels))
+	}
+
+	return metrics, nil
+}
+
+// latestSample returns the finite sample with the latest timestamp.
+func latestSample(samples []*pb.Sample) (*pb.Sample, bool) {
+	var latest *pb.Sample
+
+	for _, sample := range samples {
+		if math.IsNaN(sample.GetValue()) || math.IsInf(sample.GetValue(), 0) {
+			continue
+		}
+
+		if latest == nil || sample.GetTimestamp() >= latest.GetTimestamp() {
+			latest = sample
+		}
+	}
+
+	return latest, latest != nil
+}
+
+func seriesLabels(pairs []*pb.Label) (string, domain.Labels, error) {
+	name := ""
+	labels := make(domain.Labels, len(pairs))
+
+	for _, label := range pairs {
+		if label.GetName() == nameLabel {
+			name = label.GetValue()
+
+			continue
+		}
+		labels[label.GetName()] = label.GetValue()
+	}
+
+	if name == "" {
+		return "", nil, errors.Wrap(ErrInvalidSeries, "series without a name")
+	}
+
+	if err := labels.Validate(); err != nil {
+		return "", nil, errors.Wrapf(ErrInvalidSeries, "%s: %v", name, err)
+	}
+
+	if len(labels) == 0 {
+		labels = nil
+	}
+
+	return name, labels, nil
+}
+
+// isCounter decides the type of the series from the metadata of its family, from its suffix otherwise.
+func isCounter(name string, types map[string]pb.MetricMetadata_MetricType) bool {
+	if metricType, found := types[name]; found {
+		return metricType == pb.MetricMetadata_METRIC_TYPE_COUNTER
+	}
+
+	for _, suffix := range []string{"_bucket", "_count"} {
+		if family, found := strings.CutSuffix(name, suffix); found {
+			switch types[family] { //nolint:exhaustive
+			case pb.MetricMetadata_METRIC_TYPE_HISTOGRAM, pb.MetricMetadata_METRIC_TYPE_SUMMARY:
+				return true
+			}
+		}
+	}
+
+	family, found := strings.CutSuffix(name, "_total")
+	if !found {
+		return false
+	}
+
+	// the client libraries name the family of a counter without the suffix
+	if metricType, known := types[family]; known {
+		return metricType == pb.MetricMetadata_METRIC_TYPE_COUNTER
+	}
+
+	return true
+}
@@ -0,0 +1,82 @@
+package ingest_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	pb "github.com/npavlov/go-metrics-service/gen/go/proto/prometheus/v1"
+	"github.com/npavlov/go-metrics-service/internal/domain"
+	"github.com/npavlov/go-metrics-service/internal/server/db"
+	"github.com/npavlov/go-metrics-service/internal/server/ingest"
+)
+
+func series(name string, value float64, labels ...string) *pb.TimeSeries {
+	pairs := []*pb.Label{{Name: "__name__", Value: name}}
+	for i := 0; i+1 < len(labels); i += 2 {
+		pairs = append(pairs, &pb.Label{Name: labels[i], Value: labels[i+1]})
+	}
+
+	return &pb.TimeSeries{Labels: pairs, Samples: []*pb.Sample{{Value: value, Timestamp: 1000}}}
+}
+
+func TestFromRemoteWrite(t *testing.T) {
+	t.Parallel()
+
+	stale := series("stale_gauge", math.NaN())
+	latest := series("requests_total", 5, "code", "200")
+	latest.Samples = append(latest.Samples, &pb.Sample{Value: 7.4, Timestamp: 2000}, &pb.Sample{Value: 3, Timestamp: 1500})
+
+	request := &pb.WriteRequest{
+		Timeseries: []*pb.TimeSeries{
+			latest,
+			series("temperature", 21.5, "room", "kitchen"),
+			series("errors_total", 2),
+			series("up_total", 1),
+			series("latency_bucket", 4, "le", "0.5"),
+			series("latency_count", 9),
+			series("latency_sum", 1.25),
+			series("processed", 11),
+			stale,
+		},
+		Metadata: []*pb.MetricMetadata{
+			{Type: pb.MetricMetadata_METRIC_TYPE_HISTOGRAM, MetricFamilyName: "latency"},
+			{Type: pb.MetricMetadata_METRIC_TYPE_COUNTER, MetricFamilyName: "processed"},
+			{Type: pb.MetricMetadata_METRIC_TYPE_GAUGE, MetricFamilyName: "up"},
+			{Type: pb.MetricMetadata_METRIC_TYPE_COUNTER, MetricFamilyName: "errors"},
+		},
+	}
+
+	metrics, err := ingest.FromRemoteWrite(request)
+	require.NoError(t, err)
+
+	types := make(map[domain.MetricName]db.Metric, len(metrics))
+	for _, metric := range metrics {
+		types[metric.SeriesID()] = metric
+	}
+
+	assert.Len(t, metrics, 8)
+	assert.Equal(t, domain.Counter, types[`requests_total{code="200"}`].MType)
+	assert.Equal(t, int64(7), *types[`requests_total{code="200"}`].Delta)
+	assert.Equal(t, domain.Gauge, types[`temperature{room="kitchen"}`].MType)
+	assert.InDelta(t, 21.5, *types[`temperature{room="kitchen"}`].Value, 0)
+	assert.Equal(t, domain.Counter, types["errors_total"].MType)
+	assert.Equal(t, domain.Gauge, types["up_total"].MType)
+	assert.Equal(t, domain.Counter, types[`latency_bucket{le="0.5"}`].MType)
+	assert.Equal(t, domain.Counter, types["latency_count"].MType)
+	assert.Equal(t, domain.Gauge, types["latency_sum"].MType)
+	assert.Equal(t, domain.Counter, types["processed"].MType)
+}
+
+func TestFromRemoteWrite_Invalid(t *testing.T) {
+	t.Parallel()
+
+	unnamed := &pb.TimeSeries{Samples: []*pb.Sample{{Value: 1, Timestamp: 1}}}
+	_, err := ingest.FromRemoteWrite(&pb.WriteRequest{Timeseries: []*pb.TimeSeries{unnamed}})
+	require.ErrorIs(t, err, ingest.ErrInvalidSeries)
+
+	_, err = ingest.FromRemoteWrite(&pb.WriteRequest{Timeseries: []*pb.TimeSeries{series("gauge", 1, "bad-label", "x")}})
+	require.ErrorIs(t, err, ingest.ErrInvalidSeries)
+}
@@ -0,0 +1,117 @@
+package middlewares
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/npavlov/go-metrics-service/internal/server/apikey"
+	"github.com/npavlov/go-metrics-service/internal/server/policy"
+	"github.com/npavlov/go-metrics-service/internal/server/replay"
+	"github.com/npavlov/go-metrics-service/internal/server/tenant"
+)
+
+// KeyMiddleware - the net/http middleware function to authenticate the requests naming their key in the X-Key-ID
+// header. The HashSHA256 header must carry the HMAC of the request made with the secret of the key,
+// see utils.SignedPayload, the key is then stored in the request context and the shared key is not checked.
+func KeyMiddleware(keys *apikey.Registry, guard *replay.Guard, log *zerolog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+			keyID := request.Header.Get(apikey.Header)
+			if keyID == "" {
+				next.ServeHTTP(response, request)
+
+				return
+			}
+
+			bodyBytes, err := io.ReadAll(request.Body)
+			if err != nil {
+				log.Warn().Msg("failed to read request body")
+			}
+			if err := request.Body.Close(); err != nil {
+				response.WriteHeader(http.StatusBadRequest)
+
+				return
+			}
+			request.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
+
+			payload, err := signedPayload(request, bodyBytes, guard)
+			if err != nil {
+				log.Warn().Err(err).Msg("replay check failed")
+				http.Error(response, err.Error(), http.StatusUnauthorized)
+
+				return
+			}
+
+			source := policy.SourceFromContext(request.Context())
+			key, signature, err := keys.Authenticate(keyID, payload, request.Header.Get("HashSHA256"), source)
+			if err != nil {
+				log.Warn().Err(err).Str("source", source).Msg("key rejected")
+				http.Error(response, err.Error(), http.StatusUnauthorized)
+
+				return
+			}
+
+			if err := checkReplay(request, guard); err != nil {
+				log.Warn().Err(err).Msg("replayed request")
+				http.Error(response, err.Error(), http.StatusUnauthorized)
+
+				return
+			}
+
+			response.Header().Add("HashSHA256", signature)
+
+			ctx, err := key.Resolve(request.Context())
+			if err != nil {
+				log.Warn().Err(err).Msg("tenant rejected")
+				http.Error(response, err.Error(), http.StatusForbidden)
+
+				return
+			}
+
+			next.ServeHTTP(response, request.WithContext(apikey.WithKey(ctx, key)))
+		})
+	}
+}
+
+// ScopeMiddleware - the net/http middleware function to check the scope of the key the request is authenticated with.
+// Without a key registry every request passes, the requests without a key ID pass only while the shared key is
+// configured and SignatureMiddleware verified their signature. A request without a key ID naming a tenant
+// the keys are bound to must be signed with the key of that tenant.
+func ScopeMiddleware(keys *apikey.Registry, scope apikey.Scope, sharedKey bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+			if keys == nil {
+				next.ServeHTTP(response, request)
+
+				return
+			}
+
+			key, ok := apikey.FromContext(request.Context())
+			signedBy, verified := verifiedSigner(request)
+			if !ok && (!sharedKey || !verified) {
+				http.Error(response, "key id or signature is required", http.StatusUnauthorized)
+
+				return
+			}
+
+			if owner := tenant.FromContext(request.Context()); !ok && signedBy != owner && keys.Protects(owner) {
+				http.Error(response, errors.Wrapf(tenant.ErrForbidden, "%s requires its key", owner).Error(),
+					http.StatusForbidden)
+
+				return
+			}
+
+			if ok && !key.Allows(scope) {
+				http.Error(response, apikey.ErrScopeDenied.Error(), http.StatusForbidden)
+
+				return
+			}
+
+			next.ServeHTTP(response, request)
+		})
+	}
+}
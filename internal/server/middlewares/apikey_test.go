@@ -0,0 +1,146 @@
+package middlewares_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/npavlov/go-metrics-service/internal/domain"
+	"github.com/npavlov/go-metrics-service/internal/server/apikey"
+	"github.com/npavlov/go-metrics-service/internal/server/middlewares"
+	"github.com/npavlov/go-metrics-service/internal/server/tenant"
+	testutils "github.com/npavlov/go-metrics-service/internal/test_utils"
+	"github.com/npavlov/go-metrics-service/internal/utils"
+)
+
+func newRegistry(t *testing.T) *apikey.Registry {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "keys.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"keys": [
+		{"id": "writer", "secret": "writer-secret", "scopes": ["write"], "subnet": "10.0.0.0/8"},
+		{"id": "team-a", "secret": "team-secret", "scopes": ["read", "write"], "tenant": "team-a"}
+	]}`), 0o600))
+
+	registry, err := apikey.NewRegistry(path, time.Minute, testutils.GetTLogger())
+	require.NoError(t, err)
+
+	return registry
+}
+
+func TestKeyMiddleware(t *testing.T) {
+	t.Parallel()
+
+	logger := testutils.GetTLogger()
+	keys := newRegistry(t)
+	payload := []byte(`{"data":"test"}`)
+
+	var seen domain.Tenant
+	handler := middlewares.SourceMiddleware(nil)(middlewares.TenantMiddleware(logger)(
+		middlewares.KeyMiddleware(keys, nil, logger)(
+			middlewares.ScopeMiddleware(keys, apikey.ScopeWrite, false)(
+				http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+					seen = tenant.FromContext(request.Context())
+					writer.WriteHeader(http.StatusOK)
+				})))))
+
+	send := func(keyID, secret, source, name string) int {
+		req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(payload))
+		req.RemoteAddr = source + ":1234"
+		req.Header.Set(tenant.Header, name)
+		req.Header.Set(apikey.Header, keyID)
+		req.Header.Set("HashSHA256", utils.CalculateHash(secret, payload))
+		rr := httptest.NewRecorder()
+
+		handler.ServeHTTP(rr, req)
+
+		return rr.Code
+	}
+
+	assert.Equal(t, http.StatusOK, send("writer", "writer-secret", "10.0.0.1", ""))
+	assert.Equal(t, domain.DefaultTenant, seen)
+
+	// the tenant of the key is applied
+	assert.Equal(t, http.StatusOK, send("team-a", "team-secret", "192.168.0.1", ""))
+	assert.Equal(t, domain.Tenant("team-a"), seen)
+
+	assert.Equal(t, http.StatusUnauthorized, send("writer", "writer-secret", "192.168.0.1", ""))
+	assert.Equal(t, http.StatusUnauthorized, send("writer", "team-secret", "10.0.0.1", ""))
+	assert.Equal(t, http.StatusForbidden, send("team-a", "team-secret", "10.0.0.1", "team-b"))
+
+	// without the shared key every request must name its key
+	assert.Equal(t, http.StatusUnauthorized, send("", "writer-secret", "10.0.0.1", ""))
+}
+
+func TestScopeMiddleware(t *testing.T) {
+	t.Parallel()
+
+	keys := newRegistry(t)
+	next := http.HandlerFunc(func(writer http.ResponseWriter, _ *http.Request) {
+		writer.WriteHeader(http.StatusOK)
+	})
+
+	writer, err := keys.Lookup("writer", "10.0.0.1")
+	require.NoError(t, err)
+
+	for _, testCase := range []struct {
+		keys      *apikey.Registry
+		key       *apikey.Key
+		scope     apikey.Scope
+		sharedKey bool
+		expected  int
+	}{
+		{keys: nil, key: nil, scope: apikey.ScopeAdmin, sharedKey: false, expected: http.StatusOK},
+		{keys: keys, key: nil, scope: apikey.ScopeAdmin, sharedKey: true, expected: http.StatusUnauthorized},
+		{keys: keys, key: nil, scope: apikey.ScopeRead, sharedKey: false, expected: http.StatusUnauthorized},
+		{keys: keys, key: writer, scope: apikey.ScopeWrite, sharedKey: false, expected: http.StatusOK},
+		{keys: keys, key: writer, scope: apikey.ScopeAdmin, sharedKey: true, expected: http.StatusForbidden},
+	} {
+		req := httptest.NewRequest(http.MethodDelete, "/", nil)
+		if testCase.key != nil {
+			req = req.WithContext(apikey.WithKey(req.Context(), testCase.key))
+		}
+		rr := httptest.NewRecorder()
+
+		middlewares.ScopeMiddleware(testCase.keys, testCase.scope, testCase.sharedKey)(next).ServeHTTP(rr, req)
+
+		assert.Equal(t, testCase.expected, rr.Code)
+	}
+}
+
+func TestScopeMiddlewareSharedKey(t *testing.T) {
+	t.Parallel()
+
+	logger := testutils.GetTLogger()
+	handler := middlewares.SignatureMiddleware("shared", nil, nil, logger)(
+		middlewares.ScopeMiddleware(newRegistry(t), apikey.ScopeAdmin, true)(
+			http.HandlerFunc(func(writer http.ResponseWriter, _ *http.Request) {
+				writer.WriteHeader(http.StatusOK)
+			})))
+
+	send := func(method, signature string) int {
+		req := httptest.NewRequest(method, "/", nil)
+		if signature != "" {
+			req.Header.Set("HashSHA256", signature)
+		}
+		rr := httptest.NewRecorder()
+
+		handler.ServeHTTP(rr, req)
+
+		return rr.Code
+	}
+
+	// the requests without a key ID pass with a signature made with the shared key only
+	assert.Equal(t, http.StatusOK, send(http.MethodDelete, utils.CalculateHash("shared", nil)))
+	assert.Equal(t, http.StatusOK, send(http.MethodGet, utils.CalculateHash("shared", nil)))
+	assert.Equal(t, http.StatusUnauthorized, send(http.MethodDelete, ""))
+	assert.Equal(t, http.StatusUnauthorized, send(http.MethodGet, ""))
+	assert.Equal(t, http.StatusBadRequest, send(http.MethodGet, utils.CalculateHash("other", nil)))
+}
@@ -12,8 +12,8 @@ import (
 // BrotliMiddleware compresses the response using Brotli if the client supports it.
 func BrotliMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
-		// Check if the client accepts Brotli encoding
-		if !strings.Contains(request.Header.Get("Accept-Encoding"), "br") {
+		// Check if the client accepts Brotli encoding, event streams are sent uncompressed to be flushed per event
+		if !strings.Contains(request.Header.Get("Accept-Encoding"), "br") || helpers.IsEventStream(request) {
 			next.ServeHTTP(response, request)
 
 			return
@@ -10,7 +10,8 @@ import (
 	"github.com/npavlov/go-metrics-service/pkg/crypto"
 )
 
-// DecryptMiddleware - the net/http middleware function to sign http content.
+// DecryptMiddleware - the net/http middleware function to decrypt http content,
+// the envelope is bound to the path of the request.
 func DecryptMiddleware(decryption *crypto.Decryption, log *zerolog.Logger) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
@@ -29,10 +30,12 @@ func DecryptMiddleware(decryption *crypto.Decryption, log *zerolog.Logger) func(
 				log.Error().Err(err).Msg("failed to close body")
 				response.WriteHeader(http.StatusInternalServerError)
 			}
-			data, err := decryption.Decrypt(bodyBytes)
+			data, err := decryption.Decrypt(bodyBytes, request.URL.Path)
 			if err != nil {
 				log.Error().Err(err).Msg("failed to decrypt body")
 				response.WriteHeader(http.StatusBadRequest)
+
+				return
 			}
 
 			request.Body = io.NopCloser(bytes.NewBuffer(data))
@@ -47,10 +47,10 @@ func TestDecryptMiddleware(t *testing.T) {
 		t.Parallel()
 
 		payload := "encrypted data"
-		encryptedPayload, err := encryption.Encrypt([]byte(payload))
+		encryptedPayload, err := encryption.Encrypt([]byte(payload), "/update/")
 		require.NoError(t, err)
 
-		req := httptest.NewRequest(http.MethodPost, "http://example.com", bytes.NewBuffer(encryptedPayload))
+		req := httptest.NewRequest(http.MethodPost, "http://example.com/update/", bytes.NewBuffer(encryptedPayload))
 		rec := httptest.NewRecorder()
 		req.Header.Set("X-Encrypted", "true")
 
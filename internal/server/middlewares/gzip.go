@@ -19,11 +19,11 @@ func GzipMiddleware(next http.Handler) http.Handler {
 	}
 
 	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
-		// Check if the client accepts Gzip encoding and doesn't prefer Brotli
+		// Check if the client accepts Gzip encoding and doesn't prefer Brotli, event streams are sent uncompressed to be flushed per event
 		encoding := request.Header.Get("Accept-Encoding")
 		supportsGzip := strings.Contains(encoding, "gzip")
 		supportsBrotli := strings.Contains(encoding, "br")
-		if !supportsGzip || supportsBrotli {
+		if !supportsGzip || supportsBrotli || helpers.IsEventStream(request) {
 			next.ServeHTTP(response, request)
 
 			return
@@ -0,0 +1,11 @@
+package helpers
+
+import (
+	"net/http"
+	"strings"
+)
+
+// IsEventStream reports whether the client requests a long-lived Server-Sent-Events response.
+func IsEventStream(request *http.Request) bool {
+	return strings.Contains(request.Header.Get("Accept"), "text/event-stream")
+}
@@ -2,6 +2,7 @@ package middlewares
 
 import (
 	"bytes"
+	"context"
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/hex"
@@ -11,10 +12,27 @@ import (
 	"sync"
 
 	"github.com/rs/zerolog"
+
+	"github.com/npavlov/go-metrics-service/internal/domain"
+	"github.com/npavlov/go-metrics-service/internal/server/apikey"
+	"github.com/npavlov/go-metrics-service/internal/server/replay"
+	"github.com/npavlov/go-metrics-service/internal/server/tenant"
+	"github.com/npavlov/go-metrics-service/internal/utils"
 )
 
+type verifiedContext struct{}
+
 // SignatureMiddleware - the net/http middleware function to sign http content.
-func SignatureMiddleware(signKey string, log *zerolog.Logger) func(http.Handler) http.Handler {
+// A request signed with the key of a tenant belongs to that tenant, a request to a tenant that has a key
+// must be signed with it, see tenant.Keys.Resolve. The signature covers the method, the path, the timestamp
+// and the nonce of the request, the guard rejects replayed requests. The shared key is checked for the signed
+// requests of every method, ScopeMiddleware passes the requests with a verified signature.
+func SignatureMiddleware(
+	signKey string,
+	keys tenant.Keys,
+	guard *replay.Guard,
+	log *zerolog.Logger,
+) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		hPool := &sync.Pool{
 			New: func() interface{} {
@@ -23,8 +41,19 @@ func SignatureMiddleware(signKey string, log *zerolog.Logger) func(http.Handler)
 		}
 
 		return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+			// the request is signed with a key of the registry, see KeyMiddleware
+			if _, ok := apikey.FromContext(request.Context()); ok {
+				next.ServeHTTP(response, request)
+
+				return
+			}
+
+			var signedBy domain.Tenant
+
+			verified := false
 			hashSum := request.Header.Get("HashSHA256")
-			if request.Method == http.MethodPost && hashSum != "" && signKey != "" {
+			checkKey := signKey != ""
+			if hashSum != "" && (checkKey || len(keys) > 0) {
 				bodyBytes, err := io.ReadAll(request.Body)
 				if err != nil {
 					log.Warn().Msg("failed to read request body")
@@ -36,30 +65,96 @@ func SignatureMiddleware(signKey string, log *zerolog.Logger) func(http.Handler)
 				}
 				request.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
 
-				hmacWriter, ok := hPool.Get().(hash.Hash)
-				if !ok {
-					response.WriteHeader(http.StatusInternalServerError)
+				payload, err := signedPayload(request, bodyBytes, guard)
+				if err != nil {
+					log.Warn().Err(err).Msg("replay check failed")
+					http.Error(response, err.Error(), http.StatusUnauthorized)
 
 					return
 				}
-				hmacWriter.Reset()
-				hmacWriter.Write(bodyBytes)
-				signature := hex.EncodeToString(hmacWriter.Sum(nil))
 
-				defer hPool.Put(hmacWriter)
+				verified = true
+				if owner, signature, matched := keys.Match(payload, hashSum); matched {
+					signedBy = owner
+					response.Header().Add("HashSHA256", signature)
+				} else if checkKey {
+					hmacWriter, ok := hPool.Get().(hash.Hash)
+					if !ok {
+						response.WriteHeader(http.StatusInternalServerError)
 
-				response.Header().Add("HashSHA256", signature)
+						return
+					}
+					hmacWriter.Reset()
+					hmacWriter.Write(payload)
+					signature := hex.EncodeToString(hmacWriter.Sum(nil))
 
-				if signature != hashSum {
-					log.Error().Msg("invalid signature")
+					defer hPool.Put(hmacWriter)
 
-					response.WriteHeader(http.StatusBadRequest)
+					response.Header().Add("HashSHA256", signature)
 
-					return
+					if signature != hashSum {
+						log.Error().Msg("invalid signature")
+
+						response.WriteHeader(http.StatusBadRequest)
+
+						return
+					}
+				} else {
+					verified = false
 				}
+
+				if verified {
+					if err := checkReplay(request, guard); err != nil {
+						log.Warn().Err(err).Msg("replayed request")
+						http.Error(response, err.Error(), http.StatusUnauthorized)
+
+						return
+					}
+				}
+			}
+
+			ctx, err := keys.Resolve(request.Context(), signedBy)
+			if err != nil {
+				log.Warn().Err(err).Msg("tenant rejected")
+				http.Error(response, err.Error(), http.StatusForbidden)
+
+				return
+			}
+
+			if verified {
+				ctx = context.WithValue(ctx, verifiedContext{}, signedBy)
 			}
 
-			next.ServeHTTP(response, request)
+			next.ServeHTTP(response, request.WithContext(ctx))
 		})
 	}
 }
+
+// verifiedSigner returns the tenant whose key signed the request, empty for the shared key,
+// false when SignatureMiddleware did not verify the signature of the request.
+func verifiedSigner(request *http.Request) (domain.Tenant, bool) {
+	signedBy, verified := request.Context().Value(verifiedContext{}).(domain.Tenant)
+
+	return signedBy, verified
+}
+
+// signedPayload returns the material the request is signed over, see utils.SignedPayload.
+// A request without a timestamp is signed over its body only, it is accepted while the replay protection is disabled.
+func signedPayload(request *http.Request, body []byte, guard *replay.Guard) ([]byte, error) {
+	timestamp := request.Header.Get(utils.TimestampHeader)
+	if timestamp == "" {
+		if guard.Enabled() {
+			return nil, replay.ErrMissing
+		}
+
+		return body, nil
+	}
+
+	return utils.SignedPayload(request.Method, request.URL.Path, timestamp, request.Header.Get(utils.NonceHeader), body), nil
+}
+
+// checkReplay remembers the nonce of a request with a verified signature, see replay.Guard.
+func checkReplay(request *http.Request, guard *replay.Guard) error {
+	//nolint:wrapcheck
+	return guard.Check(request.Header.Get(utils.TimestampHeader), request.Header.Get(utils.NonceHeader))
+}
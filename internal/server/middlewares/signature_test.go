@@ -8,13 +8,17 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"testing"
+	"time"
 
 	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/assert"
 
 	"github.com/npavlov/go-metrics-service/internal/server/middlewares"
+	"github.com/npavlov/go-metrics-service/internal/server/replay"
 	testutils "github.com/npavlov/go-metrics-service/internal/test_utils"
+	"github.com/npavlov/go-metrics-service/internal/utils"
 )
 
 func TestSignatureMiddleware(t *testing.T) {
@@ -23,7 +27,7 @@ func TestSignatureMiddleware(t *testing.T) {
 	logger := testutils.GetTLogger()
 	signKey := "test_secret_key"
 
-	middleware := middlewares.SignatureMiddleware(signKey, logger)
+	middleware := middlewares.SignatureMiddleware(signKey, nil, nil, logger)
 
 	// Helper to calculate valid HMAC signature for a payload
 	calculateSignature := func(payload []byte, key string) string {
@@ -144,7 +148,7 @@ func BenchmarkSignatureMiddleware(b *testing.B) {
 	expectedSignature := hex.EncodeToString(h.Sum(nil))
 
 	// Middleware to test
-	middleware := middlewares.SignatureMiddleware(signKey, &logger)
+	middleware := middlewares.SignatureMiddleware(signKey, nil, nil, &logger)
 
 	// Handler to test
 	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
@@ -170,3 +174,43 @@ func BenchmarkSignatureMiddleware(b *testing.B) {
 		testHandler.ServeHTTP(recorder, request)
 	}
 }
+
+func TestSignatureMiddlewareReplay(t *testing.T) {
+	t.Parallel()
+
+	logger := testutils.GetTLogger()
+	signKey := "test_secret_key"
+	payload := []byte(`{"data":"test"}`)
+
+	handler := middlewares.SignatureMiddleware(signKey, nil, replay.NewGuard(time.Minute, 100), logger)(
+		http.HandlerFunc(func(writer http.ResponseWriter, _ *http.Request) {
+			writer.WriteHeader(http.StatusOK)
+		}))
+
+	send := func(path, signedPath, nonce string, signedAt time.Time) int {
+		timestamp := strconv.FormatInt(signedAt.Unix(), 10)
+		req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(payload))
+		req.Header.Set("HashSHA256", utils.CalculateHash(signKey,
+			utils.SignedPayload(http.MethodPost, signedPath, timestamp, nonce, payload)))
+		req.Header.Set(utils.TimestampHeader, timestamp)
+		req.Header.Set(utils.NonceHeader, nonce)
+		rr := httptest.NewRecorder()
+
+		handler.ServeHTTP(rr, req)
+
+		return rr.Code
+	}
+
+	assert.Equal(t, http.StatusOK, send("/updates/", "/updates/", "first", time.Now()))
+	assert.Equal(t, http.StatusUnauthorized, send("/updates/", "/updates/", "first", time.Now()))
+	assert.Equal(t, http.StatusUnauthorized, send("/updates/", "/updates/", "second", time.Now().Add(-time.Hour)))
+	// a body signed for one route cannot be sent to another one
+	assert.Equal(t, http.StatusBadRequest, send("/update/", "/updates/", "third", time.Now()))
+
+	// the body only signatures of older agents are rejected while the replay protection is enabled
+	req := httptest.NewRequest(http.MethodPost, "/updates/", bytes.NewReader(payload))
+	req.Header.Set("HashSHA256", utils.CalculateHash(signKey, payload))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+}
@@ -0,0 +1,22 @@
+package middlewares
+
+import (
+	"net/http"
+
+	"github.com/npavlov/go-metrics-service/internal/server/clientip"
+	"github.com/npavlov/go-metrics-service/internal/server/policy"
+)
+
+// SourceMiddleware - the net/http middleware function to store the client address in the request context,
+// the series policy limits the series per source and the subnet filter checks it. The forwarded headers
+// are honored for the trusted proxies of the resolver only.
+func SourceMiddleware(resolver *clientip.Resolver) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+			source := resolver.Resolve(request.RemoteAddr,
+				request.Header.Values(clientip.ForwardedForHeader), request.Header.Get(clientip.RealIPHeader))
+
+			next.ServeHTTP(response, request.WithContext(policy.WithSource(request.Context(), source)))
+		})
+	}
+}
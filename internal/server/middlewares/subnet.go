@@ -1,38 +1,29 @@
 package middlewares
 
 import (
-	"net"
 	"net/http"
 
 	"github.com/rs/zerolog"
+
+	"github.com/npavlov/go-metrics-service/internal/server/clientip"
+	"github.com/npavlov/go-metrics-service/internal/server/policy"
+	"github.com/npavlov/go-metrics-service/internal/tlsconfig"
 )
 
-// SubnetMiddleware - the net/http middleware function to verify is message received from trusted subnet.
-func SubnetMiddleware(subnet string, log *zerolog.Logger) func(http.Handler) http.Handler {
+// SubnetMiddleware - the net/http middleware function to verify the client address resolved by SourceMiddleware
+// against the subnet filter. The requests of clients with a verified TLS certificate pass.
+func SubnetMiddleware(filter *clientip.Filter, log *zerolog.Logger) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
-			if subnet == "" {
+			if tlsconfig.Identity(request.TLS) != "" {
 				next.ServeHTTP(response, request)
-			}
-
-			ipStr := request.Header.Get("X-Real-IP")
-
-			if ipStr == "" {
-				response.WriteHeader(http.StatusForbidden)
-
-				return
-			}
-
-			_, trustedNet, err := net.ParseCIDR(subnet)
-			if err != nil {
-				log.Error().Err(err).Str("subnet", subnet).Msg("invalid subnet")
-				response.WriteHeader(http.StatusInternalServerError)
 
 				return
 			}
 
-			ip := net.ParseIP(ipStr)
-			if !trustedNet.Contains(ip) {
+			source := policy.SourceFromContext(request.Context())
+			if !filter.Allows(source) {
+				log.Warn().Str("ip", source).Msg("unauthorized access attempt")
 				response.WriteHeader(http.StatusForbidden)
 
 				return
@@ -1,12 +1,17 @@
 package middlewares_test
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
+	"github.com/npavlov/go-metrics-service/internal/server/clientip"
 	"github.com/npavlov/go-metrics-service/internal/server/middlewares"
 	testutils "github.com/npavlov/go-metrics-service/internal/test_utils"
 )
@@ -16,37 +21,80 @@ func TestSubnetMiddleware(t *testing.T) {
 
 	logger := testutils.GetTLogger()
 
+	resolver, err := clientip.NewResolver([]string{"10.0.0.0/8"})
+	require.NoError(t, err)
+	filter, err := clientip.NewFilter([]string{"192.168.1.0/24", "2001:db8::/32"}, []string{"192.168.1.66"})
+	require.NoError(t, err)
+
 	// Create a handler that just returns OK
-	handler := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
-		w.WriteHeader(http.StatusOK)
-	})
+	handler := middlewares.SourceMiddleware(resolver)(middlewares.SubnetMiddleware(filter, logger)(
+		http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		})))
 	tests := []struct {
 		name           string
+		remoteAddr     string
 		ipHeader       string
+		forwardedFor   string
 		expectedStatus int
-		subnet         string
 	}{
-		{"Allowed IP", "192.168.1.100", http.StatusOK, "192.168.1.0/24"},
-		{"Forbidden IP", "10.0.0.1", http.StatusForbidden, "192.168.1.0/24"},
-		{"Missing IP Header", "", http.StatusForbidden, "192.168.1.0/24"},
-		{"Broken subnet", "192.168.1.100", http.StatusInternalServerError, "111"},
+		{"Allowed IP", "192.168.1.100:5000", "", "", http.StatusOK},
+		{"Allowed IPv6", "[2001:db8::1]:5000", "", "", http.StatusOK},
+		{"Forbidden IP", "172.16.0.1:5000", "", "", http.StatusForbidden},
+		{"Denied IP", "192.168.1.66:5000", "", "", http.StatusForbidden},
+		{"Spoofed IP Header", "172.16.0.1:5000", "192.168.1.100", "", http.StatusForbidden},
+		{"IP Header of a proxy", "10.1.1.1:5000", "192.168.1.100", "", http.StatusOK},
+		{"Forwarded by proxies", "10.1.1.1:5000", "", "172.16.0.1, 192.168.1.100, 10.2.2.2", http.StatusOK},
+		{"Spoofed forwarded address", "10.1.1.1:5000", "", "192.168.1.100, 172.16.0.1", http.StatusForbidden},
+		{"Missing IP Header of a proxy", "10.1.1.1:5000", "", "", http.StatusForbidden},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			t.Parallel()
 
-			middleware := middlewares.SubnetMiddleware(tt.subnet, logger)
-
 			req := httptest.NewRequest(http.MethodGet, "http://example.com", nil)
+			req.RemoteAddr = tt.remoteAddr
 			if tt.ipHeader != "" {
 				req.Header.Set("X-Real-IP", tt.ipHeader)
 			}
+			if tt.forwardedFor != "" {
+				req.Header.Set("X-Forwarded-For", tt.forwardedFor)
+			}
 
 			recorder := httptest.NewRecorder()
-			middleware(handler).ServeHTTP(recorder, req)
+			handler.ServeHTTP(recorder, req)
 
 			assert.Equal(t, tt.expectedStatus, recorder.Code)
 		})
 	}
 }
+
+func TestSubnetMiddlewareClientCertificate(t *testing.T) {
+	t.Parallel()
+
+	filter, err := clientip.NewFilter([]string{"192.168.1.0/24"}, nil)
+	require.NoError(t, err)
+
+	middleware := middlewares.SubnetMiddleware(filter, testutils.GetTLogger())
+	handler := middleware(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	// a verified client certificate replaces the X-Real-IP check
+	req := httptest.NewRequest(http.MethodGet, "https://example.com", nil)
+	//nolint:exhaustruct
+	req.TLS = &tls.ConnectionState{
+		VerifiedChains: [][]*x509.Certificate{{{Subject: pkix.Name{CommonName: "agent"}}}},
+	}
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	//nolint:exhaustruct
+	req.TLS = &tls.ConnectionState{}
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+}
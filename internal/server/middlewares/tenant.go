@@ -0,0 +1,37 @@
+package middlewares
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/rs/zerolog"
+
+	"github.com/npavlov/go-metrics-service/internal/domain"
+	"github.com/npavlov/go-metrics-service/internal/server/tenant"
+)
+
+// TenantMiddleware - the net/http middleware function to store the tenant named by the X-Tenant header
+// in the request context, a request without the header belongs to the default tenant. The tenant is bound
+// to the key or the signature of the request by KeyMiddleware, SignatureMiddleware and ScopeMiddleware.
+func TenantMiddleware(log *zerolog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+			name := strings.TrimSpace(request.Header.Get(tenant.Header))
+			if name == "" {
+				next.ServeHTTP(response, request)
+
+				return
+			}
+
+			owner := domain.Tenant(name)
+			if err := owner.Validate(); err != nil {
+				log.Warn().Err(err).Msg("invalid tenant")
+				http.Error(response, err.Error(), http.StatusBadRequest)
+
+				return
+			}
+
+			next.ServeHTTP(response, request.WithContext(tenant.WithTenant(request.Context(), owner)))
+		})
+	}
+}
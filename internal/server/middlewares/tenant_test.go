@@ -0,0 +1,87 @@
+package middlewares_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/npavlov/go-metrics-service/internal/domain"
+	"github.com/npavlov/go-metrics-service/internal/server/middlewares"
+	"github.com/npavlov/go-metrics-service/internal/server/tenant"
+	testutils "github.com/npavlov/go-metrics-service/internal/test_utils"
+	"github.com/npavlov/go-metrics-service/internal/utils"
+)
+
+func TestTenantMiddleware(t *testing.T) {
+	t.Parallel()
+
+	var seen domain.Tenant
+	handler := middlewares.TenantMiddleware(testutils.GetTLogger())(
+		http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			seen = tenant.FromContext(request.Context())
+			writer.WriteHeader(http.StatusOK)
+		}))
+
+	for name, expected := range map[string]domain.Tenant{"": domain.DefaultTenant, "team-a": "team-a"} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(tenant.Header, name)
+		rr := httptest.NewRecorder()
+
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, expected, seen)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(tenant.Header, "team a")
+	rr := httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+func TestSignatureMiddlewareTenantKeys(t *testing.T) {
+	t.Parallel()
+
+	logger := testutils.GetTLogger()
+	keys := tenant.Keys{"team-a": "secret-a"}
+	payload := []byte(`{"data":"test"}`)
+
+	var seen domain.Tenant
+	handler := middlewares.TenantMiddleware(logger)(middlewares.SignatureMiddleware("server-key", keys, nil, logger)(
+		http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			seen = tenant.FromContext(request.Context())
+			writer.WriteHeader(http.StatusOK)
+		})))
+
+	send := func(name, key string) int {
+		req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(payload))
+		req.Header.Set(tenant.Header, name)
+		if key != "" {
+			req.Header.Set("HashSHA256", utils.CalculateHash(key, payload))
+		}
+		rr := httptest.NewRecorder()
+
+		handler.ServeHTTP(rr, req)
+
+		return rr.Code
+	}
+
+	// the key of a tenant selects the tenant even without the header
+	assert.Equal(t, http.StatusOK, send("", "secret-a"))
+	assert.Equal(t, domain.Tenant("team-a"), seen)
+
+	// the server key keeps working for the tenants without keys
+	assert.Equal(t, http.StatusOK, send("team-b", "server-key"))
+	assert.Equal(t, domain.Tenant("team-b"), seen)
+
+	// a tenant with a key cannot be reached with another key or without a signature
+	assert.Equal(t, http.StatusForbidden, send("team-a", "server-key"))
+	assert.Equal(t, http.StatusForbidden, send("team-a", ""))
+	assert.Equal(t, http.StatusForbidden, send("team-b", "secret-a"))
+}
@@ -4,11 +4,20 @@ import (
 	"context"
 	"net/http"
 	"time"
+
+	"github.com/npavlov/go-metrics-service/internal/server/middlewares/helpers"
 )
 
 func TimeoutMiddleware(timeout time.Duration) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Event streams stay open until the client disconnects
+			if helpers.IsEventStream(r) {
+				next.ServeHTTP(w, r)
+
+				return
+			}
+
 			ctx, cancel := context.WithTimeout(r.Context(), timeout)
 			defer cancel()
 
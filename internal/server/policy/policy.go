@@ -0,0 +1,249 @@
+// Package policy guards the repository against unbounded growth of the stored series.
+//
+// The policy checks the names of written metrics against a pattern and allow and deny lists,
+// and limits the number of series in total and per source, the client address the series came from.
+// A series is known by its tenant and series ID, the limits span all tenants.
+package policy
+
+import (
+	"path"
+	"regexp"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/npavlov/go-metrics-service/internal/domain"
+	"github.com/npavlov/go-metrics-service/internal/server/config"
+	"github.com/npavlov/go-metrics-service/internal/server/db"
+)
+
+var (
+	// ErrInvalidName is returned for a metric name that does not match the name pattern.
+	ErrInvalidName = errors.New("metric name does not match the naming policy")
+	// ErrDenied is returned for a metric name that is not allowed or denied explicitly.
+	ErrDenied = errors.New("metric name is denied by the policy")
+	// ErrSeriesLimit is returned when a new series would exceed the total series limit.
+	ErrSeriesLimit = errors.New("series limit reached")
+	// ErrSourceLimit is returned when a new series would exceed the series limit of its source.
+	ErrSourceLimit = errors.New("series limit of the source reached")
+)
+
+// Reason - the reason of a rejection, used as the label of the rejection counters.
+type Reason string
+
+const (
+	ReasonInvalidName Reason = "invalid_name"
+	ReasonDenied      Reason = "denied"
+	ReasonSeriesLimit Reason = "series_limit"
+	ReasonSourceLimit Reason = "source_limit"
+)
+
+// seriesKey - a series of a tenant.
+type seriesKey struct {
+	tenant domain.Tenant
+	id     domain.MetricName
+}
+
+// Policy decides which writes may reach the repository.
+type Policy struct {
+	mu sync.Mutex
+	// series maps every known series to the source that created it, empty for the stored ones and unknown sources
+	series       map[seriesKey]string
+	perSource    map[string]int
+	maxSeries    int
+	maxPerSource int
+	pattern      *regexp.Regexp
+	allow        []string
+	deny         []string
+	rejections   map[Reason]*atomic.Uint64
+	log          *zerolog.Logger
+}
+
+// NewPolicy creates the policy configured by the server config, a zero limit and an empty list disable the check.
+func NewPolicy(cfg *config.Config, log *zerolog.Logger) (*Policy, error) {
+	var pattern *regexp.Regexp
+
+	if cfg.MetricNamePattern != "" {
+		var err error
+		if pattern, err = regexp.Compile(cfg.MetricNamePattern); err != nil {
+			return nil, errors.Wrap(err, "invalid metric name pattern")
+		}
+	}
+
+	for _, glob := range append(append([]string{}, cfg.MetricAllow...), cfg.MetricDeny...) {
+		if _, err := path.Match(glob, ""); err != nil {
+			return nil, errors.Wrapf(err, "invalid metric name glob %q", glob)
+		}
+	}
+
+	return &Policy{
+		mu:           sync.Mutex{},
+		series:       make(map[seriesKey]string),
+		perSource:    make(map[string]int),
+		maxSeries:    cfg.MaxSeries,
+		maxPerSource: cfg.MaxSeriesPerSource,
+		pattern:      pattern,
+		allow:        cfg.MetricAllow,
+		deny:         cfg.MetricDeny,
+		rejections: map[Reason]*atomic.Uint64{
+			ReasonInvalidName: {},
+			ReasonDenied:      {},
+			ReasonSeriesLimit: {},
+			ReasonSourceLimit: {},
+		},
+		log: log,
+	}, nil
+}
+
+// Seed registers the series of the tenant already stored, they count against the total limit only.
+func (p *Policy) Seed(tenant domain.Tenant, names ...domain.MetricName) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, name := range names {
+		key := seriesKey{tenant: tenant, id: name}
+		if _, known := p.series[key]; !known {
+			p.series[key] = ""
+		}
+	}
+}
+
+// Admit checks the metrics written by the source for the tenant, either all of them are admitted or none.
+// The new series are reserved for the source and returned, so they can be released when the write fails.
+func (p *Policy) Admit(tenant domain.Tenant, source string, metrics []db.Metric) ([]domain.MetricName, error) {
+	for _, metric := range metrics {
+		if err := p.checkName(metric.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	reserved := make([]domain.MetricName, 0)
+	for _, metric := range metrics {
+		seriesID := metric.SeriesID()
+		key := seriesKey{tenant: tenant, id: seriesID}
+		if _, known := p.series[key]; known {
+			continue
+		}
+
+		if p.maxSeries > 0 && len(p.series) >= p.maxSeries {
+			p.release(tenant, reserved...)
+
+			return nil, p.reject(ReasonSeriesLimit, errors.Wrapf(ErrSeriesLimit, "metric %s: %d series", seriesID, p.maxSeries))
+		}
+
+		if source != "" && p.maxPerSource > 0 && p.perSource[source] >= p.maxPerSource {
+			p.release(tenant, reserved...)
+
+			return nil, p.reject(ReasonSourceLimit,
+				errors.Wrapf(ErrSourceLimit, "metric %s: %d series from %s", seriesID, p.maxPerSource, source))
+		}
+
+		p.series[key] = source
+		if source != "" {
+			p.perSource[source]++
+		}
+		reserved = append(reserved, seriesID)
+	}
+
+	return reserved, nil
+}
+
+// Forget releases the series of the tenant, they no longer count against the limits.
+func (p *Policy) Forget(tenant domain.Tenant, names ...domain.MetricName) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.release(tenant, names...)
+}
+
+// Rejections returns the number of rejected writes by reason.
+func (p *Policy) Rejections() map[Reason]uint64 {
+	rejections := make(map[Reason]uint64, len(p.rejections))
+	for reason, counter := range p.rejections {
+		rejections[reason] = counter.Load()
+	}
+
+	return rejections
+}
+
+// Reasons returns the reasons of the rejection counters, sorted.
+func (p *Policy) Reasons() []Reason {
+	reasons := make([]Reason, 0, len(p.rejections))
+	for reason := range p.rejections {
+		reasons = append(reasons, reason)
+	}
+
+	sort.Slice(reasons, func(i, j int) bool {
+		return reasons[i] < reasons[j]
+	})
+
+	return reasons
+}
+
+// checkName checks the length of the name, then the name against the pattern and the allow and deny lists.
+func (p *Policy) checkName(name domain.MetricName) error {
+	if len(name) > domain.MaxNameLength {
+		return p.reject(ReasonInvalidName, errors.Wrapf(ErrInvalidName,
+			"metric name is %d bytes long, at most %d are allowed", len(name), domain.MaxNameLength))
+	}
+
+	if p.pattern != nil && !p.pattern.MatchString(string(name)) {
+		return p.reject(ReasonInvalidName, errors.Wrapf(ErrInvalidName, "metric %s", name))
+	}
+
+	if len(p.allow) > 0 && !matchAny(p.allow, string(name)) {
+		return p.reject(ReasonDenied, errors.Wrapf(ErrDenied, "metric %s is not allowed", name))
+	}
+
+	if matchAny(p.deny, string(name)) {
+		return p.reject(ReasonDenied, errors.Wrapf(ErrDenied, "metric %s", name))
+	}
+
+	return nil
+}
+
+// release forgets the series of the tenant, must be called under the lock.
+func (p *Policy) release(tenant domain.Tenant, names ...domain.MetricName) {
+	for _, name := range names {
+		key := seriesKey{tenant: tenant, id: name}
+		source, known := p.series[key]
+		if !known {
+			continue
+		}
+
+		delete(p.series, key)
+
+		if source == "" {
+			continue
+		}
+
+		if p.perSource[source]--; p.perSource[source] <= 0 {
+			delete(p.perSource, source)
+		}
+	}
+}
+
+// reject counts and logs the rejection.
+func (p *Policy) reject(reason Reason, err error) error {
+	p.rejections[reason].Add(1)
+	p.log.Warn().Err(err).Str("reason", string(reason)).Msg("write rejected by policy")
+
+	return err
+}
+
+// matchAny reports whether the name matches one of the globs, see path.Match.
+func matchAny(globs []string, name string) bool {
+	for _, glob := range globs {
+		if matched, _ := path.Match(glob, name); matched {
+			return true
+		}
+	}
+
+	return false
+}
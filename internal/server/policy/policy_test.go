@@ -0,0 +1,156 @@
+package policy_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/npavlov/go-metrics-service/internal/domain"
+	"github.com/npavlov/go-metrics-service/internal/server/config"
+	"github.com/npavlov/go-metrics-service/internal/server/db"
+	"github.com/npavlov/go-metrics-service/internal/server/policy"
+	"github.com/npavlov/go-metrics-service/internal/server/storage"
+	testutils "github.com/npavlov/go-metrics-service/internal/test_utils"
+)
+
+func gauge(name domain.MetricName) db.Metric {
+	value := 1.0
+
+	return *db.NewMetric(name, domain.Gauge, nil, &value)
+}
+
+func newPolicy(t *testing.T, cfg *config.Config) *policy.Policy {
+	t.Helper()
+
+	seriesPolicy, err := policy.NewPolicy(cfg, testutils.GetTLogger())
+	require.NoError(t, err)
+
+	return seriesPolicy
+}
+
+func TestPolicy_Names(t *testing.T) {
+	t.Parallel()
+
+	//nolint:exhaustruct
+	seriesPolicy := newPolicy(t, &config.Config{
+		MetricNamePattern: `^[a-zA-Z_][a-zA-Z0-9_]{0,31}$`,
+		MetricAllow:       []string{"go_*", "Heap*"},
+		MetricDeny:        []string{"go_debug_*"},
+	})
+
+	_, err := seriesPolicy.Admit(domain.DefaultTenant, "10.0.0.1", []db.Metric{gauge("go_goroutines"), gauge("HeapAlloc")})
+	require.NoError(t, err)
+
+	_, err = seriesPolicy.Admit(domain.DefaultTenant, "10.0.0.1", []db.Metric{gauge("request_3f2a-11ef")})
+	require.ErrorIs(t, err, policy.ErrInvalidName)
+
+	_, err = seriesPolicy.Admit(domain.DefaultTenant, "10.0.0.1", []db.Metric{gauge("PollCount")})
+	require.ErrorIs(t, err, policy.ErrDenied)
+
+	_, err = seriesPolicy.Admit(domain.DefaultTenant, "10.0.0.1", []db.Metric{gauge("go_debug_gc")})
+	require.ErrorIs(t, err, policy.ErrDenied)
+
+	rejections := seriesPolicy.Rejections()
+	assert.Equal(t, uint64(1), rejections[policy.ReasonInvalidName])
+	assert.Equal(t, uint64(2), rejections[policy.ReasonDenied])
+	assert.Equal(t, uint64(0), rejections[policy.ReasonSeriesLimit])
+
+	// the length of the names is capped without a naming policy too
+	//nolint:exhaustruct
+	unconfigured := newPolicy(t, &config.Config{})
+	_, err = unconfigured.Admit(domain.DefaultTenant, "", []db.Metric{gauge(domain.MetricName(strings.Repeat("a", 256)))})
+	require.ErrorIs(t, err, policy.ErrInvalidName)
+	_, err = unconfigured.Admit(domain.DefaultTenant, "", []db.Metric{gauge(domain.MetricName(strings.Repeat("a", 255)))})
+	require.NoError(t, err)
+}
+
+func TestPolicy_Limits(t *testing.T) {
+	t.Parallel()
+
+	//nolint:exhaustruct
+	seriesPolicy := newPolicy(t, &config.Config{MaxSeries: 4, MaxSeriesPerSource: 2})
+	seriesPolicy.Seed(domain.DefaultTenant, "stored")
+
+	_, err := seriesPolicy.Admit(domain.DefaultTenant, "10.0.0.1", []db.Metric{gauge("a"), gauge("b"), gauge("a")})
+	require.NoError(t, err)
+
+	// known series are always admitted
+	_, err = seriesPolicy.Admit(domain.DefaultTenant, "10.0.0.1", []db.Metric{gauge("a"), gauge("stored")})
+	require.NoError(t, err)
+
+	_, err = seriesPolicy.Admit(domain.DefaultTenant, "10.0.0.1", []db.Metric{gauge("c")})
+	require.ErrorIs(t, err, policy.ErrSourceLimit)
+
+	_, err = seriesPolicy.Admit(domain.DefaultTenant, "10.0.0.2", []db.Metric{gauge("c"), gauge("d")})
+	require.ErrorIs(t, err, policy.ErrSeriesLimit)
+
+	// nothing of a rejected write is reserved
+	seriesPolicy.Forget(domain.DefaultTenant, "a")
+	reserved, err := seriesPolicy.Admit(domain.DefaultTenant, "10.0.0.1", []db.Metric{gauge("c")})
+	require.NoError(t, err)
+	assert.Equal(t, []domain.MetricName{"c"}, reserved)
+
+	rejections := seriesPolicy.Rejections()
+	assert.Equal(t, uint64(1), rejections[policy.ReasonSourceLimit])
+	assert.Equal(t, uint64(1), rejections[policy.ReasonSeriesLimit])
+}
+
+func TestNewPolicy_Invalid(t *testing.T) {
+	t.Parallel()
+
+	//nolint:exhaustruct
+	_, err := policy.NewPolicy(&config.Config{MetricNamePattern: "("}, testutils.GetTLogger())
+	require.Error(t, err)
+
+	//nolint:exhaustruct
+	_, err = policy.NewPolicy(&config.Config{MetricDeny: []string{"["}}, testutils.GetTLogger())
+	require.Error(t, err)
+}
+
+func TestRepository(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	memStorage := storage.NewMemStorage(testutils.GetTLogger())
+	stored := gauge("stored")
+	require.NoError(t, memStorage.Create(ctx, &stored))
+
+	//nolint:exhaustruct
+	seriesPolicy := newPolicy(t, &config.Config{MaxSeries: 3, MaxSeriesPerSource: 1})
+	repo, err := policy.NewRepository(ctx, memStorage, seriesPolicy)
+	require.NoError(t, err)
+
+	firstCtx := policy.WithSource(ctx, "10.0.0.1")
+	secondCtx := policy.WithSource(ctx, "10.0.0.2")
+	assert.Equal(t, "10.0.0.1", policy.SourceFromContext(firstCtx))
+
+	_, err = repo.ApplyDeltas(firstCtx, []db.Metric{gauge("first")})
+	require.NoError(t, err)
+
+	_, err = repo.ApplyDeltas(firstCtx, []db.Metric{gauge("second")})
+	require.ErrorIs(t, err, policy.ErrSourceLimit)
+
+	// a failed write releases its series
+	counter := int64(1)
+	_, err = repo.ApplyDeltas(secondCtx, []db.Metric{gauge("second"), *db.NewMetric("stored", domain.Counter, &counter, nil)})
+	require.Error(t, err)
+	_, err = repo.ApplyDeltas(secondCtx, []db.Metric{gauge("second")})
+	require.NoError(t, err)
+
+	_, err = repo.ApplyDeltas(policy.WithSource(ctx, "10.0.0.3"), []db.Metric{gauge("third")})
+	require.ErrorIs(t, err, policy.ErrSeriesLimit)
+
+	_, found := memStorage.Get(ctx, "third")
+	assert.False(t, found)
+
+	// deleting frees the series for new ones
+	deleted, err := repo.Delete(ctx, "first", domain.Gauge)
+	require.NoError(t, err)
+	assert.True(t, deleted)
+
+	_, err = repo.ApplyDeltas(policy.WithSource(ctx, "10.0.0.3"), []db.Metric{gauge("third")})
+	require.NoError(t, err)
+}
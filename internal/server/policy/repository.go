@@ -0,0 +1,146 @@
+package policy
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/npavlov/go-metrics-service/internal/domain"
+	"github.com/npavlov/go-metrics-service/internal/model"
+	"github.com/npavlov/go-metrics-service/internal/server/db"
+	"github.com/npavlov/go-metrics-service/internal/server/tenant"
+)
+
+type sourceKey struct{}
+
+// WithSource returns a context carrying the source of the request, the address of the client.
+func WithSource(ctx context.Context, source string) context.Context {
+	return context.WithValue(ctx, sourceKey{}, source)
+}
+
+// SourceFromContext returns the source of the request, empty when it is unknown.
+func SourceFromContext(ctx context.Context) string {
+	source, _ := ctx.Value(sourceKey{}).(string)
+
+	return source
+}
+
+// Repository admits every write through the policy before it reaches the wrapped repository.
+type Repository struct {
+	model.Repository
+	policy *Policy
+}
+
+// NewRepository wraps the repository, the stored series of every tenant are registered with the policy.
+func NewRepository(ctx context.Context, repo model.Repository, policy *Policy) (*Repository, error) {
+	tenants, err := repo.Tenants(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list tenants")
+	}
+
+	for _, owner := range tenants {
+		stored := repo.GetAll(tenant.WithTenant(ctx, owner))
+
+		names := make([]domain.MetricName, 0, len(stored))
+		for name := range stored {
+			names = append(names, name)
+		}
+
+		policy.Seed(owner, names...)
+	}
+
+	return &Repository{
+		Repository: repo,
+		policy:     policy,
+	}, nil
+}
+
+// Create admits the metric and stores it.
+func (r *Repository) Create(ctx context.Context, metric *db.Metric) error {
+	return r.admit(ctx, []db.Metric{*metric}, func() error {
+		return r.Repository.Create(ctx, metric)
+	})
+}
+
+// Update admits the metric and stores it.
+func (r *Repository) Update(ctx context.Context, metric *db.Metric) error {
+	return r.admit(ctx, []db.Metric{*metric}, func() error {
+		return r.Repository.Update(ctx, metric)
+	})
+}
+
+// UpdateMany admits the metrics and stores them.
+func (r *Repository) UpdateMany(ctx context.Context, metrics *[]db.Metric) error {
+	return r.admit(ctx, *metrics, func() error {
+		return r.Repository.UpdateMany(ctx, metrics)
+	})
+}
+
+// ApplyDeltas admits the metrics and applies them.
+func (r *Repository) ApplyDeltas(ctx context.Context, metrics []db.Metric) ([]db.Metric, error) {
+	var applied []db.Metric
+
+	err := r.admit(ctx, metrics, func() error {
+		var err error
+		applied, err = r.Repository.ApplyDeltas(ctx, metrics)
+
+		return err
+	})
+
+	return applied, err
+}
+
+// ApplyBatch admits the metrics of the batch and applies them.
+func (r *Repository) ApplyBatch(ctx context.Context, batch *model.Batch) error {
+	metrics := make([]db.Metric, 0, batch.Size())
+	metrics = append(append(append(metrics, batch.Values...), batch.Deltas...), batch.Changes...)
+
+	return r.admit(ctx, metrics, func() error {
+		return r.Repository.ApplyBatch(ctx, batch)
+	})
+}
+
+// Delete removes the metric and releases its series.
+func (r *Repository) Delete(ctx context.Context, name domain.MetricName, mType domain.MetricType) (bool, error) {
+	deleted, err := r.Repository.Delete(ctx, name, mType)
+	if deleted {
+		r.policy.Forget(tenant.FromContext(ctx), name)
+	}
+
+	return deleted, err
+}
+
+// DeleteMany removes the metrics and releases their series.
+func (r *Repository) DeleteMany(ctx context.Context, names []domain.MetricName) ([]domain.MetricName, error) {
+	deleted, err := r.Repository.DeleteMany(ctx, names)
+	r.policy.Forget(tenant.FromContext(ctx), deleted...)
+
+	return deleted, err
+}
+
+// DeleteStale removes the stale metrics and releases their series.
+func (r *Repository) DeleteStale(ctx context.Context, before time.Time) ([]domain.MetricName, error) {
+	deleted, err := r.Repository.DeleteStale(ctx, before)
+	r.policy.Forget(tenant.FromContext(ctx), deleted...)
+
+	return deleted, err
+}
+
+// admit runs the write once the metrics are admitted, the reserved series are released when it fails.
+func (r *Repository) admit(ctx context.Context, metrics []db.Metric, write func() error) error {
+	owner := tenant.FromContext(ctx)
+
+	reserved, err := r.policy.Admit(owner, SourceFromContext(ctx), metrics)
+	if err != nil {
+		return err
+	}
+
+	if err := write(); err != nil {
+		r.policy.Forget(owner, reserved...)
+
+		return err
+	}
+
+	return nil
+}
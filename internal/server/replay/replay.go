@@ -0,0 +1,132 @@
+// Package replay rejects replayed signed requests.
+//
+// A signed request carries the unix time it was signed at and a random nonce, see utils.SignedPayload.
+// The Guard accepts the requests signed within the allowed skew of the server clock and remembers their nonces,
+// a nonce seen again within the skew window is rejected.
+package replay
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// maxNonceLength bounds the memory a remembered nonce takes.
+const maxNonceLength = 64
+
+var (
+	// ErrMissing is returned for a signed request without a timestamp or a nonce.
+	ErrMissing = errors.New("signed request requires a timestamp and a nonce")
+	// ErrStale is returned for a request signed outside of the allowed skew of the server clock.
+	ErrStale = errors.New("request timestamp is outside of the allowed skew")
+	// ErrReplayed is returned for a nonce that was already used.
+	ErrReplayed = errors.New("request nonce was already used")
+)
+
+type entry struct {
+	nonce     string
+	timestamp int64
+}
+
+// Guard - the bounded cache of the nonces seen within the skew window.
+//
+// When the cache is full the oldest nonce is dropped and the requests signed not later than it are rejected,
+// a dropped nonce then cannot be replayed.
+type Guard struct {
+	skew int64
+	size int
+
+	mu    sync.Mutex
+	seen  map[string]struct{}
+	order []entry
+	head  int
+	floor int64
+}
+
+// NewGuard creates the guard accepting the requests signed within the skew and remembering up to size nonces.
+// The guard is nil for a non positive skew, the replay protection is then disabled.
+func NewGuard(skew time.Duration, size int) *Guard {
+	if skew <= 0 {
+		return nil
+	}
+
+	return &Guard{
+		skew:  int64(skew / time.Second),
+		size:  max(size, 1),
+		mu:    sync.Mutex{},
+		seen:  make(map[string]struct{}),
+		order: make([]entry, 0),
+		head:  0,
+		floor: 0,
+	}
+}
+
+// Enabled reports whether the guard checks the requests, a nil guard accepts any request.
+func (g *Guard) Enabled() bool {
+	return g != nil
+}
+
+// Check accepts a request signed at the unix timestamp with the nonce and remembers the nonce.
+// It must be called after the signature of the request is verified.
+func (g *Guard) Check(timestamp, nonce string) error {
+	if g == nil {
+		return nil
+	}
+
+	if timestamp == "" || nonce == "" || len(nonce) > maxNonceLength {
+		return ErrMissing
+	}
+
+	signedAt, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errors.Wrap(ErrMissing, "invalid timestamp")
+	}
+
+	now := time.Now().Unix()
+	if signedAt < now-g.skew || signedAt > now+g.skew {
+		return errors.Wrapf(ErrStale, "signed at %d, now %d", signedAt, now)
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.prune(now)
+
+	if signedAt <= g.floor {
+		return errors.Wrap(ErrReplayed, "the nonces of that time are no longer remembered")
+	}
+
+	if _, found := g.seen[nonce]; found {
+		return errors.Wrap(ErrReplayed, nonce)
+	}
+
+	if len(g.seen) >= g.size {
+		g.floor = max(g.floor, g.order[g.head].timestamp)
+		g.drop()
+	}
+
+	g.seen[nonce] = struct{}{}
+	g.order = append(g.order, entry{nonce: nonce, timestamp: signedAt})
+
+	return nil
+}
+
+// prune drops the oldest nonces signed before the skew window, the window rejects their requests anyway.
+func (g *Guard) prune(now int64) {
+	for g.head < len(g.order) && g.order[g.head].timestamp < now-g.skew {
+		g.drop()
+	}
+
+	// compact the queue once most of it is dropped
+	if g.head > len(g.order)/2 {
+		g.order = append(g.order[:0], g.order[g.head:]...)
+		g.head = 0
+	}
+}
+
+func (g *Guard) drop() {
+	delete(g.seen, g.order[g.head].nonce)
+	g.head++
+}
@@ -0,0 +1,60 @@
+package replay_test
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/npavlov/go-metrics-service/internal/server/replay"
+)
+
+func unix(at time.Time) string {
+	return strconv.FormatInt(at.Unix(), 10)
+}
+
+func TestGuard_Check(t *testing.T) {
+	t.Parallel()
+
+	guard := replay.NewGuard(time.Minute, 10)
+	require.True(t, guard.Enabled())
+
+	now := time.Now()
+	require.NoError(t, guard.Check(unix(now), "first"))
+	require.ErrorIs(t, guard.Check(unix(now), "first"), replay.ErrReplayed)
+	require.NoError(t, guard.Check(unix(now.Add(-30*time.Second)), "second"))
+
+	require.ErrorIs(t, guard.Check(unix(now.Add(-2*time.Minute)), "third"), replay.ErrStale)
+	require.ErrorIs(t, guard.Check(unix(now.Add(2*time.Minute)), "third"), replay.ErrStale)
+
+	require.ErrorIs(t, guard.Check("", "third"), replay.ErrMissing)
+	require.ErrorIs(t, guard.Check(unix(now), ""), replay.ErrMissing)
+	require.ErrorIs(t, guard.Check("yesterday", "third"), replay.ErrMissing)
+}
+
+func TestGuard_Bounded(t *testing.T) {
+	t.Parallel()
+
+	guard := replay.NewGuard(time.Minute, 2)
+	now := time.Now()
+
+	require.NoError(t, guard.Check(unix(now.Add(-10*time.Second)), "first"))
+	require.NoError(t, guard.Check(unix(now), "second"))
+	// the first nonce is dropped, the requests signed not later than it are rejected
+	require.NoError(t, guard.Check(unix(now), "third"))
+
+	require.ErrorIs(t, guard.Check(unix(now.Add(-10*time.Second)), "first"), replay.ErrReplayed)
+	require.ErrorIs(t, guard.Check(unix(now), "second"), replay.ErrReplayed)
+	require.NoError(t, guard.Check(unix(now.Add(time.Second)), "fourth"))
+}
+
+func TestGuard_Disabled(t *testing.T) {
+	t.Parallel()
+
+	guard := replay.NewGuard(0, 10)
+	assert.Nil(t, guard)
+	assert.False(t, guard.Enabled())
+	require.NoError(t, guard.Check("", ""))
+}
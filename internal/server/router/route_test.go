@@ -1,21 +1,31 @@
 package router_test
 
 import (
+	"context"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
 	"testing"
+	"time"
 
 	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/npavlov/go-metrics-service/internal/domain"
+	"github.com/npavlov/go-metrics-service/internal/server/db"
+	"github.com/npavlov/go-metrics-service/internal/server/replay"
 	"github.com/npavlov/go-metrics-service/internal/server/storage"
+	"github.com/npavlov/go-metrics-service/internal/server/tenant"
 
 	testutils "github.com/npavlov/go-metrics-service/internal/test_utils"
 
 	"github.com/npavlov/go-metrics-service/internal/server/config"
 	"github.com/npavlov/go-metrics-service/internal/server/handlers"
 	"github.com/npavlov/go-metrics-service/internal/server/router"
+	"github.com/npavlov/go-metrics-service/internal/utils"
 )
 
 func TestNewCustomRouter(t *testing.T) {
@@ -39,7 +49,7 @@ func TestNewCustomRouterWithCryptoKey(t *testing.T) {
 	assert.NotNil(t, customRouter)
 	customRouter.SetRouter(mh, hh)
 	r := customRouter.GetRouter()
-	assert.Len(t, r.Middlewares(), 8)
+	assert.Len(t, r.Middlewares(), 10)
 }
 
 func TestNewCustomRouterWithBrokenCryptoKey(t *testing.T) {
@@ -53,7 +63,7 @@ func TestNewCustomRouterWithBrokenCryptoKey(t *testing.T) {
 	assert.NotNil(t, customRouter)
 	customRouter.SetRouter(mh, hh)
 	mux := customRouter.GetRouter()
-	assert.Len(t, mux.Middlewares(), 7)
+	assert.Len(t, mux.Middlewares(), 9)
 }
 
 func TestSetRouter(t *testing.T) {
@@ -99,6 +109,8 @@ func TestRoutes(t *testing.T) {
 	}{
 		{"Root Route", "GET", "/", http.StatusOK},
 		{"Ping Route", "GET", "/ping", http.StatusOK},
+		{"Prometheus Route", "GET", "/metrics", http.StatusOK},
+		{"Events Route Without Hub", "GET", "/events", http.StatusServiceUnavailable},
 		{"Update Metric", "POST", "/update/gauge/cpu/100", http.StatusOK},
 	}
 
@@ -113,3 +125,144 @@ func TestRoutes(t *testing.T) {
 		})
 	}
 }
+
+func TestRoutesWithKeys(t *testing.T) {
+	t.Parallel()
+
+	keyFile := filepath.Join(t.TempDir(), "keys.json")
+	require.NoError(t, os.WriteFile(keyFile, []byte(`{"keys": [
+		{"id": "reader", "secret": "reader-secret", "scopes": ["read"]}
+	]}`), 0o600))
+
+	//nolint:exhaustruct
+	cfg := &config.Config{Key: "shared", KeyFile: keyFile}
+	logger := testutils.GetTLogger()
+	customRouter := router.NewCustomRouter(cfg, logger)
+	memStorage := storage.NewMemStorage(logger)
+	customRouter.SetRouter(handlers.NewMetricsHandler(memStorage, logger), handlers.NewHealthHandler(nil, logger))
+	mux := customRouter.GetRouter()
+
+	tests := []struct {
+		name       string
+		method     string
+		keyID      string
+		signature  string
+		statusCode int
+	}{
+		{"Unsigned Delete", http.MethodDelete, "", "", http.StatusUnauthorized},
+		{"Unsigned Read", http.MethodGet, "", "", http.StatusUnauthorized},
+		{"Read Key Delete", http.MethodDelete, "reader", utils.CalculateHash("reader-secret", nil), http.StatusForbidden},
+		{"Read Key Read", http.MethodGet, "reader", utils.CalculateHash("reader-secret", nil), http.StatusNotFound},
+		{"Shared Key Delete", http.MethodDelete, "", utils.CalculateHash("shared", nil), http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			req := httptest.NewRequest(tt.method, "/value/gauge/cpu", nil)
+			if tt.keyID != "" {
+				req.Header.Set("X-Key-ID", tt.keyID)
+			}
+			if tt.signature != "" {
+				req.Header.Set("HashSHA256", tt.signature)
+			}
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, req)
+			assert.Equal(t, tt.statusCode, w.Code)
+		})
+	}
+}
+
+func TestRoutesCrossTenantRead(t *testing.T) {
+	t.Parallel()
+
+	keyFile := filepath.Join(t.TempDir(), "keys.json")
+	require.NoError(t, os.WriteFile(keyFile, []byte(`{"keys": [
+		{"id": "team-a", "secret": "team-a-secret", "scopes": ["read"], "tenant": "team-a"},
+		{"id": "team-b", "secret": "team-b-secret", "scopes": ["read"], "tenant": "team-b"},
+		{"id": "reader", "secret": "reader-secret", "scopes": ["read", "write"]},
+		{"id": "ops", "secret": "ops-secret", "scopes": ["admin"]}
+	]}`), 0o600))
+
+	//nolint:exhaustruct
+	cfg := &config.Config{Key: "shared", KeyFile: keyFile}
+	logger := testutils.GetTLogger()
+	customRouter := router.NewCustomRouter(cfg, logger)
+	memStorage := storage.NewMemStorage(logger)
+	value := 42.0
+	require.NoError(t, memStorage.Update(tenant.WithTenant(context.Background(), "team-a"),
+		db.NewMetric("cpu", domain.Gauge, nil, &value)))
+	customRouter.SetRouter(handlers.NewMetricsHandler(memStorage, logger), handlers.NewHealthHandler(nil, logger))
+	mux := customRouter.GetRouter()
+
+	tests := []struct {
+		name       string
+		tenant     string
+		keyID      string
+		signature  string
+		statusCode int
+	}{
+		{"Own Key", "team-a", "team-a", utils.CalculateHash("team-a-secret", nil), http.StatusOK},
+		{"Own Key Without Header", "", "team-a", utils.CalculateHash("team-a-secret", nil), http.StatusOK},
+		{"Other Key", "team-a", "team-b", utils.CalculateHash("team-b-secret", nil), http.StatusForbidden},
+		{"Shared Key", "team-a", "", utils.CalculateHash("shared", nil), http.StatusForbidden},
+		{"Unsigned", "team-a", "", "", http.StatusUnauthorized},
+		{"Other Tenant Data", "", "team-b", utils.CalculateHash("team-b-secret", nil), http.StatusNotFound},
+		{"Unbound Key", "team-a", "reader", utils.CalculateHash("reader-secret", nil), http.StatusForbidden},
+		{"Unbound Key Default Tenant", "", "reader", utils.CalculateHash("reader-secret", nil), http.StatusNotFound},
+		{"Admin Key", "team-a", "ops", utils.CalculateHash("ops-secret", nil), http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			req := httptest.NewRequest(http.MethodGet, "/value/gauge/cpu", nil)
+			if tt.tenant != "" {
+				req.Header.Set(tenant.Header, tt.tenant)
+			}
+			if tt.keyID != "" {
+				req.Header.Set("X-Key-ID", tt.keyID)
+			}
+			if tt.signature != "" {
+				req.Header.Set("HashSHA256", tt.signature)
+			}
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, req)
+			assert.Equal(t, tt.statusCode, w.Code)
+		})
+	}
+}
+
+func TestRoutersShareReplayGuard(t *testing.T) {
+	t.Parallel()
+
+	//nolint:exhaustruct
+	cfg := &config.Config{Key: "shared"}
+	logger := testutils.GetTLogger()
+	guard := replay.NewGuard(time.Minute, 100)
+	memStorage := storage.NewMemStorage(logger)
+
+	mainRouter := router.NewCustomRouterWithKeys(cfg, nil, guard, logger)
+	mainRouter.SetRouter(handlers.NewMetricsHandler(memStorage, logger), handlers.NewHealthHandler(nil, logger))
+	otlpRouter := router.NewCustomRouterWithKeys(cfg, nil, guard, logger)
+	otlpRouter.SetOTLPRouter(handlers.NewMetricsHandler(memStorage, logger))
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	send := func(mux http.Handler, method, path string) int {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set(utils.TimestampHeader, timestamp)
+		req.Header.Set(utils.NonceHeader, "nonce-1")
+		req.Header.Set("HashSHA256",
+			utils.CalculateHash("shared", utils.SignedPayload(method, path, timestamp, "nonce-1", nil)))
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusNotFound, send(mainRouter.GetRouter(), http.MethodGet, "/value/gauge/cpu"))
+	assert.Equal(t, http.StatusUnauthorized, send(otlpRouter.GetRouter(), http.MethodPost, "/v1/metrics"),
+		"the nonce was used on the other router")
+}
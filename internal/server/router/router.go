@@ -1,15 +1,21 @@
 package router
 
 import (
+	"net/http"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/rs/zerolog"
 
+	"github.com/npavlov/go-metrics-service/internal/server/apikey"
+	"github.com/npavlov/go-metrics-service/internal/server/clientip"
 	"github.com/npavlov/go-metrics-service/internal/server/config"
 	"github.com/npavlov/go-metrics-service/internal/server/handlers"
 	"github.com/npavlov/go-metrics-service/internal/server/middlewares"
+	"github.com/npavlov/go-metrics-service/internal/server/replay"
+	"github.com/npavlov/go-metrics-service/internal/server/tenant"
 	"github.com/npavlov/go-metrics-service/pkg/crypto"
 )
 
@@ -27,15 +33,56 @@ type CustomRouter struct {
 	logger     *zerolog.Logger
 	cfg        *config.Config
 	decryption *crypto.Decryption
+	tenantKeys tenant.Keys
+	keys       *apikey.Registry
+	guard      *replay.Guard
+	resolver   *clientip.Resolver
+	filter     *clientip.Filter
 }
 
-// NewCustomRouter - constructor for CustomRouter.
+// NewCustomRouter - constructor for CustomRouter, the key registry and the replay guard are created from the config.
 func NewCustomRouter(cfg *config.Config, log *zerolog.Logger) *CustomRouter {
+	keys, err := apikey.NewRegistry(cfg.KeyFile, cfg.KeyReloadDur, log)
+	if err != nil {
+		log.Fatal().Err(err).Msg("invalid key file")
+	}
+
+	return NewCustomRouterWithKeys(cfg, keys, replay.NewGuard(cfg.SignatureSkewDur, cfg.NonceCacheSize), log)
+}
+
+// NewCustomRouterWithKeys - constructor for CustomRouter using the given key registry and replay guard.
+// The routers of one server share them, so a nonce accepted by one router is rejected by the others.
+func NewCustomRouterWithKeys(
+	cfg *config.Config,
+	keys *apikey.Registry,
+	guard *replay.Guard,
+	log *zerolog.Logger,
+) *CustomRouter {
+	tenantKeys, err := tenant.ParseKeys(cfg.TenantKeys)
+	if err != nil {
+		log.Fatal().Err(err).Msg("invalid tenant keys")
+	}
+
+	resolver, err := clientip.NewResolver(cfg.TrustedProxies)
+	if err != nil {
+		log.Fatal().Err(err).Msg("invalid trusted proxies")
+	}
+
+	filter, err := clientip.NewFilter(strings.Split(cfg.TrustedSubnet, ","), cfg.DeniedSubnets)
+	if err != nil {
+		log.Fatal().Err(err).Msg("invalid subnets")
+	}
+
 	router := &CustomRouter{
 		router:     chi.NewRouter(),
 		logger:     log,
 		cfg:        cfg,
 		decryption: nil,
+		tenantKeys: tenantKeys,
+		keys:       keys,
+		guard:      guard,
+		resolver:   resolver,
+		filter:     filter,
 	}
 
 	if cfg.CryptoKey == "" {
@@ -47,6 +94,7 @@ func NewCustomRouter(cfg *config.Config, log *zerolog.Logger) *CustomRouter {
 		log.Fatal().Err(err).Msg("could not create decryption")
 	}
 
+	decryption.Legacy = cfg.CryptoLegacy
 	router.decryption = decryption
 
 	return router
@@ -54,44 +102,50 @@ func NewCustomRouter(cfg *config.Config, log *zerolog.Logger) *CustomRouter {
 
 // SetRouter Embedding middleware setup in the constructor.
 func (cr *CustomRouter) SetRouter(mh *handlers.MetricHandler, hh *handlers.HealthHandler) {
-	cr.router.Use(middlewares.LoggingMiddleware(cr.logger))
-	cr.router.Use(middlewares.TimeoutMiddleware(defaultTimeout))
-	cr.router.Use(middleware.Recoverer)
-	cr.router.Use(middlewares.GzipMiddleware)
-	cr.router.Use(middlewares.BrotliMiddleware)
-	if cr.cfg.TrustedSubnet != "" {
-		cr.router.Use(middlewares.SubnetMiddleware(cr.cfg.TrustedSubnet, cr.logger))
-	}
-	if cr.decryption != nil {
-		cr.router.Use(middlewares.DecryptMiddleware(cr.decryption, cr.logger))
-	}
-	cr.router.Use(middlewares.GzipDecompressionMiddleware)
-	cr.router.Use(middlewares.SignatureMiddleware(cr.cfg.Key, cr.logger))
+	cr.useMiddlewares()
 
 	cr.router.Route("/", func(router chi.Router) {
 		router.Route("/", func(router chi.Router) {
-			router.With(middlewares.ContentMiddleware("text/html")).
+			router.With(cr.scope(apikey.ScopeRead), middlewares.ContentMiddleware("text/html")).
 				Get("/", mh.Render)
 		})
 		router.Route("/update", func(router chi.Router) {
-			router.With(middlewares.ContentMiddleware("application/json")).
+			router.With(cr.scope(apikey.ScopeWrite), middlewares.ContentMiddleware("application/json")).
 				Post("/", mh.UpdateModel)
 		})
 		router.Route("/updates", func(router chi.Router) {
-			router.With(middlewares.ContentMiddleware("application/json")).
+			router.With(cr.scope(apikey.ScopeWrite), middlewares.ContentMiddleware("application/json")).
 				Post("/", mh.UpdateModels)
 		})
 		router.Route("/update/{metricType}/{metricName}/{value}", func(router chi.Router) {
-			router.With(middlewares.ContentMiddleware("application/text")).
+			router.With(cr.scope(apikey.ScopeWrite), middlewares.ContentMiddleware("application/text")).
 				Post("/", mh.Update)
 		})
+		router.Route("/api/v1/write", func(router chi.Router) {
+			router.With(cr.scope(apikey.ScopeWrite)).
+				Post("/", mh.RemoteWrite)
+		})
+		router.Route("/write", func(router chi.Router) {
+			router.With(cr.scope(apikey.ScopeWrite)).
+				Post("/", mh.InfluxWrite)
+		})
 		router.Route("/value", func(router chi.Router) {
-			router.With(middlewares.ContentMiddleware("application/json")).
+			router.With(cr.scope(apikey.ScopeRead), middlewares.ContentMiddleware("application/json")).
 				Post("/", mh.RetrieveModel)
 		})
 		router.Route("/value/{metricType}/{metricName}", func(router chi.Router) {
-			router.With(middlewares.ContentMiddleware("application/text")).
+			router.With(cr.scope(apikey.ScopeRead), middlewares.ContentMiddleware("application/text")).
 				Get("/", mh.Retrieve)
+			router.With(cr.scope(apikey.ScopeAdmin), middlewares.ContentMiddleware("application/text")).
+				Delete("/", mh.Delete)
+		})
+		router.Route("/metrics", func(router chi.Router) {
+			router.With(cr.scope(apikey.ScopeRead), middlewares.ContentMiddleware(handlers.PrometheusContentType)).
+				Get("/", mh.Prometheus)
+		})
+		router.Route("/events", func(router chi.Router) {
+			router.With(cr.scope(apikey.ScopeRead), middlewares.ContentMiddleware(handlers.EventStreamContentType)).
+				Get("/", mh.Events)
 		})
 		router.Route("/ping", func(router chi.Router) {
 			router.With(middlewares.ContentMiddleware("application/text")).
@@ -100,6 +154,43 @@ func (cr *CustomRouter) SetRouter(mh *handlers.MetricHandler, hh *handlers.Healt
 	})
 }
 
+// SetOTLPRouter serves the OTLP/HTTP metric exports on the router, the middlewares are the ones of SetRouter.
+func (cr *CustomRouter) SetOTLPRouter(mh *handlers.MetricHandler) {
+	cr.useMiddlewares()
+
+	cr.router.Route("/v1/metrics", func(router chi.Router) {
+		router.With(cr.scope(apikey.ScopeWrite)).
+			Post("/", mh.OTLPMetrics)
+	})
+}
+
+// useMiddlewares adds the logging, client, compression and authentication middlewares to the router.
+func (cr *CustomRouter) useMiddlewares() {
+	cr.router.Use(middlewares.LoggingMiddleware(cr.logger))
+	cr.router.Use(middlewares.TimeoutMiddleware(defaultTimeout))
+	cr.router.Use(middleware.Recoverer)
+	cr.router.Use(middlewares.SourceMiddleware(cr.resolver))
+	cr.router.Use(middlewares.TenantMiddleware(cr.logger))
+	cr.router.Use(middlewares.GzipMiddleware)
+	cr.router.Use(middlewares.BrotliMiddleware)
+	if cr.filter != nil {
+		cr.router.Use(middlewares.SubnetMiddleware(cr.filter, cr.logger))
+	}
+	if cr.decryption != nil {
+		cr.router.Use(middlewares.DecryptMiddleware(cr.decryption, cr.logger))
+	}
+	cr.router.Use(middlewares.GzipDecompressionMiddleware)
+	if cr.keys != nil {
+		cr.router.Use(middlewares.KeyMiddleware(cr.keys, cr.guard, cr.logger))
+	}
+	cr.router.Use(middlewares.SignatureMiddleware(cr.cfg.Key, cr.tenantKeys, cr.guard, cr.logger))
+}
+
+// scope returns the middleware checking the scope of the API key of a request.
+func (cr *CustomRouter) scope(scope apikey.Scope) func(http.Handler) http.Handler {
+	return middlewares.ScopeMiddleware(cr.keys, scope, cr.cfg.Key != "")
+}
+
 func (cr *CustomRouter) GetRouter() *chi.Mux {
 	return cr.router
 }
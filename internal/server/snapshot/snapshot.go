@@ -1,10 +1,16 @@
 package snapshot
 
 import (
-	"io/fs"
+	"bytes"
+	"compress/gzip"
+	"hash/crc32"
+	"io"
 	"os"
+	"path/filepath"
+	"strconv"
 
 	jsoniter "github.com/json-iterator/go"
+	"github.com/klauspost/compress/zstd"
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
 
@@ -12,58 +18,345 @@ import (
 	"github.com/npavlov/go-metrics-service/internal/server/db"
 )
 
+// Compression - the algorithm the snapshot payload is compressed with.
+type Compression string
+
+const (
+	CompressionNone Compression = "none"
+	CompressionGzip Compression = "gzip"
+	CompressionZstd Compression = "zstd"
+)
+
+const (
+	// FormatVersion - the version of the snapshot format written by Save, the version 2 keeps the metrics by tenant.
+	FormatVersion = 2
+	// flatVersion - the version 1 kept the metrics of a single namespace, they belong to domain.DefaultTenant.
+	flatVersion = 1
+	// magic starts the header line, snapshots written before the header are plain JSON.
+	magic    = "METRICS-SNAPSHOT "
+	filePerm = 0o600
+)
+
+var (
+	ErrUnknownCompression = errors.New("unknown snapshot compression")
+	ErrUnknownVersion     = errors.New("unknown snapshot format version")
+	ErrCorrupt            = errors.New("snapshot is corrupt")
+)
+
+// State - the metrics of every tenant by series ID.
+type State map[domain.Tenant]map[domain.MetricName]db.Metric
+
 type Snapshot interface {
-	Save(state map[domain.MetricName]db.Metric) error
-	Restore() (map[domain.MetricName]db.Metric, error)
+	Save(state State) error
+	Restore() (State, error)
+}
+
+// ParseCompression validates the configured compression, empty means none.
+func ParseCompression(name string) (Compression, error) {
+	switch compression := Compression(name); compression {
+	case "":
+		return CompressionNone, nil
+	case CompressionNone, CompressionGzip, CompressionZstd:
+		return compression, nil
+	}
+
+	return CompressionNone, errors.Wrap(ErrUnknownCompression, name)
+}
+
+// header - the first line of a snapshot file, the checksum covers the payload stored on disk.
+type header struct {
+	Version     int         `json:"version"`
+	Compression Compression `json:"compression"`
+	Checksum    uint32      `json:"checksum"`
+	Size        int         `json:"size"`
 }
 
 // MemSnapshot encapsulates saving and restoring state of MemStorage.
 type MemSnapshot struct {
-	filePath string
-	l        *zerolog.Logger
-	json     jsoniter.API
+	filePath    string
+	l           *zerolog.Logger
+	json        jsoniter.API
+	compression Compression
+	keep        int
 }
 
 // NewMemSnapshot creates a new Memento with the given file path and logger.
 func NewMemSnapshot(filePath string, l *zerolog.Logger) *MemSnapshot {
 	return &MemSnapshot{
-		filePath: filePath,
-		l:        l,
-		json:     jsoniter.ConfigCompatibleWithStandardLibrary,
+		filePath:    filePath,
+		l:           l,
+		json:        jsoniter.ConfigCompatibleWithStandardLibrary,
+		compression: CompressionNone,
+		keep:        0,
 	}
 }
 
+// WithCompression compresses the saved snapshots with the given algorithm.
+func (m *MemSnapshot) WithCompression(compression Compression) *MemSnapshot {
+	m.compression = compression
+
+	return m
+}
+
+// WithRetention keeps the given number of previous snapshots as <file>.1 (newest) to <file>.N (oldest).
+func (m *MemSnapshot) WithRetention(keep int) *MemSnapshot {
+	m.keep = max(keep, 0)
+
+	return m
+}
+
 // Save stores the state of the metrics to the configured file.
-func (m *MemSnapshot) Save(state map[domain.MetricName]db.Metric) error {
-	file, err := m.json.MarshalIndent(state, "", "  ")
+// The snapshot is written to a temporary file, synced and renamed over the previous one,
+// so a crash leaves either the old or the new snapshot in place, never a partial one.
+func (m *MemSnapshot) Save(state State) error {
+	data, err := m.json.Marshal(state)
 	if err != nil {
 		return errors.Wrap(err, "failed to marshal output")
 	}
 
-	err = os.WriteFile(m.filePath, file, fs.ModePerm)
+	payload, err := compress(m.compression, data)
 	if err != nil {
-		return errors.Wrap(err, "failed to save output")
+		return err
 	}
 
-	return nil
-}
+	head, err := m.json.Marshal(header{
+		Version:     FormatVersion,
+		Compression: m.compression,
+		Checksum:    crc32.ChecksumIEEE(payload),
+		Size:        len(payload),
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal header")
+	}
 
-// Restore loads the state from the file into the provided map.
-func (m *MemSnapshot) Restore() (map[domain.MetricName]db.Metric, error) {
-	file, err := os.ReadFile(m.filePath)
+	tmpPath, err := m.writeTemp(append([]byte(magic+string(head)+"\n"), payload...))
 	if err != nil {
-		m.l.Error().Err(err).Msg("failed to load output")
+		return err
+	}
 
-		return nil, errors.Wrap(err, "failed to load output")
+	m.rotate()
+
+	if err := os.Rename(tmpPath, m.filePath); err != nil {
+		_ = os.Remove(tmpPath)
+
+		return errors.Wrap(err, "failed to replace snapshot")
+	}
+
+	return syncDir(filepath.Dir(m.filePath))
+}
+
+// Restore loads the newest snapshot that is intact, falling back to the previous ones.
+func (m *MemSnapshot) Restore() (State, error) {
+	var firstErr error
+
+	for i := range m.keep + 1 {
+		path := m.path(i)
+
+		state, err := m.load(path)
+		if err == nil {
+			if i > 0 {
+				m.l.Warn().Str("file", path).Msg("restored previous snapshot, the newer ones are broken")
+			}
+
+			return state, nil
+		}
+
+		if firstErr == nil {
+			firstErr = err
+		}
+
+		if !errors.Is(err, os.ErrNotExist) {
+			m.l.Error().Err(err).Str("file", path).Msg("failed to load snapshot")
+		}
 	}
 
-	newStorage := make(map[domain.MetricName]db.Metric)
-	err = m.json.Unmarshal(file, &newStorage)
+	return nil, firstErr
+}
+
+// load reads and verifies a single snapshot file.
+// The snapshots of a single namespace, the legacy ones and the version 1, are restored as domain.DefaultTenant.
+func (m *MemSnapshot) load(path string) (State, error) {
+	file, err := os.ReadFile(path)
 	if err != nil {
-		m.l.Error().Err(err).Msg("failed to unmarshal output")
+		return nil, errors.Wrap(err, "failed to load output")
+	}
 
+	data, version := file, flatVersion
+	if bytes.HasPrefix(file, []byte(magic)) {
+		data, version, err = m.decode(file[len(magic):])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if version == flatVersion {
+		metrics := make(map[domain.MetricName]db.Metric)
+		if err := m.json.Unmarshal(data, &metrics); err != nil {
+			return nil, errors.Wrap(err, "failed to unmarshal output")
+		}
+
+		return State{domain.DefaultTenant: metrics}, nil
+	}
+
+	state := make(State)
+	if err := m.json.Unmarshal(data, &state); err != nil {
 		return nil, errors.Wrap(err, "failed to unmarshal output")
 	}
 
-	return newStorage, nil
+	return state, nil
+}
+
+// decode checks the header and the payload that follows it, returns the uncompressed JSON and its format version.
+func (m *MemSnapshot) decode(file []byte) ([]byte, int, error) {
+	line, payload, found := bytes.Cut(file, []byte("\n"))
+	if !found {
+		return nil, 0, errors.Wrap(ErrCorrupt, "no header")
+	}
+
+	var head header
+	if err := m.json.Unmarshal(line, &head); err != nil {
+		return nil, 0, errors.Wrap(ErrCorrupt, "invalid header")
+	}
+
+	if head.Version != FormatVersion && head.Version != flatVersion {
+		return nil, 0, errors.Wrap(ErrUnknownVersion, strconv.Itoa(head.Version))
+	}
+
+	if len(payload) != head.Size || crc32.ChecksumIEEE(payload) != head.Checksum {
+		return nil, 0, errors.Wrap(ErrCorrupt, "checksum mismatch")
+	}
+
+	data, err := decompress(head.Compression, payload)
+
+	return data, head.Version, err
+}
+
+// writeTemp writes the snapshot next to the target file and syncs it, returns the temporary path.
+func (m *MemSnapshot) writeTemp(content []byte) (string, error) {
+	tmp, err := os.CreateTemp(filepath.Dir(m.filePath), filepath.Base(m.filePath)+".tmp-*")
+	if err != nil {
+		return "", errors.Wrap(err, "failed to create temp snapshot")
+	}
+
+	_, err = tmp.Write(content)
+	if err == nil {
+		err = tmp.Chmod(filePerm)
+	}
+
+	if err == nil {
+		err = tmp.Sync()
+	}
+
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+
+		return "", errors.Wrap(err, "failed to write temp snapshot")
+	}
+
+	return tmp.Name(), nil
+}
+
+// rotate shifts the previous snapshots by one, the oldest one is dropped.
+func (m *MemSnapshot) rotate() {
+	if m.keep == 0 {
+		return
+	}
+
+	for i := m.keep; i > 0; i-- {
+		err := os.Rename(m.path(i-1), m.path(i))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			m.l.Warn().Err(err).Str("file", m.path(i-1)).Msg("failed to rotate snapshot")
+		}
+	}
+}
+
+// path returns the file of the snapshot with the given age, 0 is the newest one.
+func (m *MemSnapshot) path(age int) string {
+	if age == 0 {
+		return m.filePath
+	}
+
+	return m.filePath + "." + strconv.Itoa(age)
+}
+
+func compress(compression Compression, data []byte) ([]byte, error) {
+	var buffer bytes.Buffer
+
+	var writer io.WriteCloser
+
+	switch compression {
+	case CompressionNone:
+		return data, nil
+	case CompressionGzip:
+		writer = gzip.NewWriter(&buffer)
+	case CompressionZstd:
+		encoder, err := zstd.NewWriter(&buffer)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create zstd writer")
+		}
+		writer = encoder
+	default:
+		return nil, errors.Wrap(ErrUnknownCompression, string(compression))
+	}
+
+	if _, err := writer.Write(data); err != nil {
+		return nil, errors.Wrap(err, "failed to compress snapshot")
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, errors.Wrap(err, "failed to compress snapshot")
+	}
+
+	return buffer.Bytes(), nil
+}
+
+func decompress(compression Compression, payload []byte) ([]byte, error) {
+	var reader io.Reader
+
+	switch compression {
+	case CompressionNone:
+		return payload, nil
+	case CompressionGzip:
+		gzipReader, err := gzip.NewReader(bytes.NewReader(payload))
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read gzip snapshot")
+		}
+		defer func() { _ = gzipReader.Close() }()
+		reader = gzipReader
+	case CompressionZstd:
+		decoder, err := zstd.NewReader(bytes.NewReader(payload))
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read zstd snapshot")
+		}
+		defer decoder.Close()
+		reader = decoder
+	default:
+		return nil, errors.Wrap(ErrUnknownCompression, string(compression))
+	}
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decompress snapshot")
+	}
+
+	return data, nil
+}
+
+// syncDir makes the rename durable.
+func syncDir(dir string) error {
+	handle, err := os.Open(dir)
+	if err != nil {
+		return errors.Wrap(err, "failed to open snapshot dir")
+	}
+	defer func() { _ = handle.Close() }()
+
+	if err := handle.Sync(); err != nil {
+		return errors.Wrap(err, "failed to sync snapshot dir")
+	}
+
+	return nil
 }
@@ -0,0 +1,126 @@
+package snapshot_test
+
+import (
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/npavlov/go-metrics-service/internal/domain"
+	"github.com/npavlov/go-metrics-service/internal/server/db"
+	"github.com/npavlov/go-metrics-service/internal/server/snapshot"
+	testutils "github.com/npavlov/go-metrics-service/internal/test_utils"
+)
+
+func state(delta int64) snapshot.State {
+	counter := db.NewMetric("counter", domain.Counter, &delta, nil)
+
+	return snapshot.State{"team-a": {counter.SeriesID(): *counter}}
+}
+
+func TestMemSnapshot_SaveRestore(t *testing.T) {
+	t.Parallel()
+
+	for _, compression := range []snapshot.Compression{
+		snapshot.CompressionNone, snapshot.CompressionGzip, snapshot.CompressionZstd,
+	} {
+		t.Run(string(compression), func(t *testing.T) {
+			t.Parallel()
+
+			path := filepath.Join(t.TempDir(), "metrics.json")
+			memSnapshot := snapshot.NewMemSnapshot(path, testutils.GetTLogger()).WithCompression(compression)
+
+			require.NoError(t, memSnapshot.Save(state(10)))
+
+			restored, err := memSnapshot.Restore()
+			require.NoError(t, err)
+			assert.Equal(t, int64(10), *restored["team-a"]["counter"].Delta)
+
+			// no temporary files are left behind
+			entries, err := os.ReadDir(filepath.Dir(path))
+			require.NoError(t, err)
+			assert.Len(t, entries, 1)
+		})
+	}
+}
+
+func TestMemSnapshot_RestoreLegacy(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "metrics.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"counter": {"id": "counter", "type": "counter", "delta": 4}}`), 0o600))
+
+	restored, err := snapshot.NewMemSnapshot(path, testutils.GetTLogger()).Restore()
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), *restored[domain.DefaultTenant]["counter"].Delta)
+}
+
+func TestMemSnapshot_RestoreVersion1(t *testing.T) {
+	t.Parallel()
+
+	payload := []byte(`{"counter": {"id": "counter", "type": "counter", "delta": 5}}`)
+	header := fmt.Sprintf(`METRICS-SNAPSHOT {"version":1,"compression":"none","checksum":%d,"size":%d}`,
+		crc32.ChecksumIEEE(payload), len(payload))
+
+	path := filepath.Join(t.TempDir(), "metrics.json")
+	require.NoError(t, os.WriteFile(path, append([]byte(header+"\n"), payload...), 0o600))
+
+	restored, err := snapshot.NewMemSnapshot(path, testutils.GetTLogger()).Restore()
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), *restored[domain.DefaultTenant]["counter"].Delta)
+}
+
+func TestMemSnapshot_RestoreFallsBack(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "metrics.json")
+	memSnapshot := snapshot.NewMemSnapshot(path, testutils.GetTLogger()).
+		WithCompression(snapshot.CompressionGzip).
+		WithRetention(2)
+
+	for delta := range int64(4) {
+		require.NoError(t, memSnapshot.Save(state(delta)))
+	}
+
+	// the oldest snapshot is dropped
+	assert.FileExists(t, path+".2")
+	assert.NoFileExists(t, path+".3")
+
+	// flip a byte of the newest snapshot
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	content[len(content)-1] ^= 0xff
+	require.NoError(t, os.WriteFile(path, content, 0o600))
+
+	restored, err := memSnapshot.Restore()
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), *restored["team-a"]["counter"].Delta)
+
+	require.NoError(t, os.Remove(path+".1"))
+	restored, err = memSnapshot.Restore()
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), *restored["team-a"]["counter"].Delta)
+
+	require.NoError(t, os.Remove(path+".2"))
+	_, err = memSnapshot.Restore()
+	require.ErrorIs(t, err, snapshot.ErrCorrupt)
+}
+
+func TestParseCompression(t *testing.T) {
+	t.Parallel()
+
+	compression, err := snapshot.ParseCompression("")
+	require.NoError(t, err)
+	assert.Equal(t, snapshot.CompressionNone, compression)
+
+	compression, err = snapshot.ParseCompression("zstd")
+	require.NoError(t, err)
+	assert.Equal(t, snapshot.CompressionZstd, compression)
+
+	_, err = snapshot.ParseCompression("lz4")
+	require.ErrorIs(t, err, snapshot.ErrUnknownCompression)
+}
@@ -0,0 +1,341 @@
+package statsd
+
+import (
+	"context"
+	"math"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/npavlov/go-metrics-service/internal/domain"
+	"github.com/npavlov/go-metrics-service/internal/model"
+	"github.com/npavlov/go-metrics-service/internal/server/db"
+	"github.com/npavlov/go-metrics-service/internal/server/policy"
+	"github.com/npavlov/go-metrics-service/internal/server/storage"
+)
+
+// series - the name and the labels of an aggregated series.
+type series struct {
+	name   domain.MetricName
+	labels domain.Labels
+}
+
+// counter - the increment of a counter in the current interval. The fraction left over by a sampled increment
+// is carried into the next interval, an entry not incremented for a whole interval is dropped.
+type counter struct {
+	series
+
+	value   float64
+	touched bool
+}
+
+// gauge - the change of a gauge in the current interval, relative to the stored value unless an absolute value
+// was received.
+type gauge struct {
+	series
+
+	value    float64
+	absolute bool
+}
+
+// interval - the series of a flush interval, the counters hold the increments written as deltas.
+type interval struct {
+	deltas map[domain.MetricName]*counter
+	gauges map[domain.MetricName]*gauge
+	timers map[domain.MetricName][]float64
+	sets   map[domain.MetricName]map[string]struct{}
+	names  map[domain.MetricName]series
+}
+
+// batch returns the write of the interval, the timers report the quantiles.
+func (i *interval) batch(quantiles []float64) *model.Batch {
+	batch := &model.Batch{Values: nil, Deltas: nil, Changes: nil}
+
+	for _, entry := range i.deltas {
+		delta := int64(entry.value)
+		batch.Deltas = append(batch.Deltas, *db.NewMetric(entry.name, domain.Counter, &delta, nil).WithLabels(entry.labels))
+	}
+
+	for _, entry := range i.gauges {
+		value := entry.value
+		metric := *db.NewMetric(entry.name, domain.Gauge, nil, &value).WithLabels(entry.labels)
+		if entry.absolute {
+			batch.Values = append(batch.Values, metric)
+		} else {
+			batch.Changes = append(batch.Changes, metric)
+		}
+	}
+
+	for key, values := range i.timers {
+		current := i.names[key]
+		summary := domain.NewSummary(quantiles, values)
+		batch.Values = append(batch.Values, *db.NewSummaryMetric(current.name, summary).WithLabels(current.labels))
+	}
+
+	for key, members := range i.sets {
+		current := i.names[key]
+		count := float64(len(members))
+		batch.Values = append(batch.Values, *db.NewMetric(current.name, domain.Gauge, nil, &count).WithLabels(current.labels))
+	}
+
+	return batch
+}
+
+// keys returns the IDs of the series of the interval.
+func (i *interval) keys() []domain.MetricName {
+	keys := make([]domain.MetricName, 0, len(i.deltas)+len(i.gauges)+len(i.timers)+len(i.sets))
+	for key := range i.deltas {
+		keys = append(keys, key)
+	}
+	for key := range i.gauges {
+		keys = append(keys, key)
+	}
+	for key := range i.timers {
+		keys = append(keys, key)
+	}
+	for key := range i.sets {
+		keys = append(keys, key)
+	}
+
+	return keys
+}
+
+// only returns the interval of the series.
+func (i *interval) only(key domain.MetricName) *interval {
+	single := &interval{
+		deltas: make(map[domain.MetricName]*counter, 1),
+		gauges: make(map[domain.MetricName]*gauge, 1),
+		timers: make(map[domain.MetricName][]float64, 1),
+		sets:   make(map[domain.MetricName]map[string]struct{}, 1),
+		names:  make(map[domain.MetricName]series, 1),
+	}
+
+	if entry, found := i.deltas[key]; found {
+		single.deltas[key] = entry
+	}
+	if entry, found := i.gauges[key]; found {
+		single.gauges[key] = entry
+	}
+	if values, found := i.timers[key]; found {
+		single.timers[key] = values
+	}
+	if members, found := i.sets[key]; found {
+		single.sets[key] = members
+	}
+	if current, found := i.names[key]; found {
+		single.names[key] = current
+	}
+
+	return single
+}
+
+// drop removes the series from the interval.
+func (i *interval) drop(key domain.MetricName) {
+	delete(i.deltas, key)
+	delete(i.gauges, key)
+	delete(i.timers, key)
+	delete(i.sets, key)
+	delete(i.names, key)
+}
+
+// Aggregator aggregates the samples of a flush interval. Counters sum the increments, gauges keep the last value,
+// timers and histograms become summaries of the interval and sets become gauges of their unique value count.
+// Each flush writes one Repository.ApplyBatch: counter increments are merged as deltas and relative gauge changes
+// are added to the stored values, so concurrent writers are not overwritten and a deleted series
+// only comes back with a new sample.
+type Aggregator struct {
+	repo      model.Repository
+	quantiles []float64
+	log       *zerolog.Logger
+
+	mu       sync.Mutex
+	counters map[domain.MetricName]*counter
+	gauges   map[domain.MetricName]*gauge
+	timers   map[domain.MetricName][]float64
+	sets     map[domain.MetricName]map[string]struct{}
+	names    map[domain.MetricName]series
+}
+
+// NewAggregator creates the aggregator writing to the repository, the summaries of timers report the quantiles.
+func NewAggregator(repo model.Repository, quantiles []float64, log *zerolog.Logger) *Aggregator {
+	return &Aggregator{
+		repo:      repo,
+		quantiles: quantiles,
+		log:       log,
+		mu:        sync.Mutex{},
+		counters:  make(map[domain.MetricName]*counter),
+		gauges:    make(map[domain.MetricName]*gauge),
+		timers:    make(map[domain.MetricName][]float64),
+		sets:      make(map[domain.MetricName]map[string]struct{}),
+		names:     make(map[domain.MetricName]series),
+	}
+}
+
+// Add aggregates the sample into its series.
+func (a *Aggregator) Add(sample Sample) {
+	key := domain.SeriesID(sample.Name, sample.Labels)
+	current := series{name: sample.Name, labels: sample.Labels}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	switch sample.Type {
+	case TypeCounter:
+		entry, found := a.counters[key]
+		if !found {
+			entry = &counter{series: current, value: 0, touched: false}
+			a.counters[key] = entry
+		}
+		entry.value += sample.Value / sample.Rate
+		entry.touched = true
+	case TypeGauge:
+		entry, found := a.gauges[key]
+		if !found {
+			entry = &gauge{series: current, value: 0, absolute: false}
+			a.gauges[key] = entry
+		}
+		if sample.Relative {
+			entry.value += sample.Value
+		} else {
+			entry.value, entry.absolute = sample.Value, true
+		}
+	case TypeTimer, TypeHistogram:
+		a.names[key] = current
+		a.timers[key] = append(a.timers[key], sample.Value)
+	case TypeSet:
+		a.names[key] = current
+		if a.sets[key] == nil {
+			a.sets[key] = make(map[string]struct{})
+		}
+		a.sets[key][sample.Member] = struct{}{}
+	}
+}
+
+// Flush writes the series changed since the last flush and starts a new interval. A series rejected by the series
+// policy or by the type of its stored series is dropped, the other series of the interval are still written.
+// When the write fails the interval is merged back into the aggregator and written by the next flush.
+func (a *Aggregator) Flush(ctx context.Context) error {
+	flushed := a.collect()
+
+	if err := a.write(ctx, flushed); err != nil {
+		a.restore(flushed)
+
+		return errors.Wrap(err, "failed to write statsd metrics")
+	}
+
+	return nil
+}
+
+// write writes the interval, on failure the interval keeps the series that were not written.
+func (a *Aggregator) write(ctx context.Context, flushed *interval) error {
+	batch := flushed.batch(a.quantiles)
+	if batch.Size() == 0 {
+		return nil
+	}
+
+	err := a.repo.ApplyBatch(ctx, batch)
+	if err == nil || !rejected(err) {
+		return err
+	}
+
+	// a rejected series fails the whole batch, the series are written one by one to drop only the rejected ones
+	for _, key := range flushed.keys() {
+		if err := a.repo.ApplyBatch(ctx, flushed.only(key).batch(a.quantiles)); err != nil {
+			if !rejected(err) {
+				return err
+			}
+
+			a.log.Warn().Err(err).Str("series", string(key)).Msg("dropped rejected statsd series")
+		}
+
+		flushed.drop(key)
+	}
+
+	return nil
+}
+
+// collect takes the interval to flush out of the aggregator.
+func (a *Aggregator) collect() *interval {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	flushed := &interval{
+		deltas: make(map[domain.MetricName]*counter),
+		gauges: a.gauges,
+		timers: a.timers,
+		sets:   a.sets,
+		names:  a.names,
+	}
+
+	for key, entry := range a.counters {
+		if !entry.touched {
+			delete(a.counters, key)
+
+			continue
+		}
+
+		delta := math.Round(entry.value)
+		entry.value -= delta
+		entry.touched = false
+		if delta != 0 {
+			flushed.deltas[key] = &counter{series: entry.series, value: delta, touched: true}
+		}
+	}
+
+	a.gauges = make(map[domain.MetricName]*gauge)
+	a.timers = make(map[domain.MetricName][]float64)
+	a.sets = make(map[domain.MetricName]map[string]struct{})
+	a.names = make(map[domain.MetricName]series)
+
+	return flushed
+}
+
+// restore merges the interval that was not written into the samples aggregated since it was collected.
+func (a *Aggregator) restore(flushed *interval) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for key, delta := range flushed.deltas {
+		entry, found := a.counters[key]
+		if !found {
+			entry = &counter{series: delta.series, value: 0, touched: false}
+			a.counters[key] = entry
+		}
+		entry.value += delta.value
+		entry.touched = true
+	}
+
+	for key, older := range flushed.gauges {
+		newer, found := a.gauges[key]
+		switch {
+		case !found:
+			a.gauges[key] = older
+		case !newer.absolute:
+			newer.value += older.value
+			newer.absolute = older.absolute
+		}
+	}
+
+	for key, values := range flushed.timers {
+		a.names[key] = flushed.names[key]
+		a.timers[key] = append(values, a.timers[key]...)
+	}
+
+	for key, members := range flushed.sets {
+		a.names[key] = flushed.names[key]
+		if a.sets[key] == nil {
+			a.sets[key] = make(map[string]struct{}, len(members))
+		}
+		for member := range members {
+			a.sets[key][member] = struct{}{}
+		}
+	}
+}
+
+// rejected reports whether the write failed on one of its series rather than on the storage.
+func rejected(err error) bool {
+	return errors.Is(err, policy.ErrInvalidName) || errors.Is(err, policy.ErrDenied) ||
+		errors.Is(err, policy.ErrSeriesLimit) || errors.Is(err, policy.ErrSourceLimit) ||
+		errors.Is(err, storage.ErrTypeMismatch)
+}
@@ -0,0 +1,228 @@
+package statsd_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/npavlov/go-metrics-service/internal/domain"
+	"github.com/npavlov/go-metrics-service/internal/model"
+	"github.com/npavlov/go-metrics-service/internal/server/db"
+	"github.com/npavlov/go-metrics-service/internal/server/statsd"
+	"github.com/npavlov/go-metrics-service/internal/server/storage"
+	testutils "github.com/npavlov/go-metrics-service/internal/test_utils"
+)
+
+func add(t *testing.T, aggregator *statsd.Aggregator, lines ...string) {
+	t.Helper()
+
+	for _, line := range lines {
+		sample, err := statsd.Parse(line)
+		require.NoError(t, err)
+		aggregator.Add(sample)
+	}
+}
+
+func TestAggregator_Flush(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	repo := storage.NewMemStorage(testutils.GetTLogger())
+	aggregator := statsd.NewAggregator(repo, []float64{0.5, 1}, testutils.GetTLogger())
+
+	add(t, aggregator,
+		"requests:1|c", "requests:2|c", "requests:1|c|@0.5",
+		"temperature:20|g", "temperature:21.5|g",
+		"latency:10|ms", "latency:30|ms", "latency:20|ms",
+		"users:alice|s", "users:bob|s", "users:alice|s",
+		"hits:1|c|#route:home",
+	)
+	require.NoError(t, aggregator.Flush(ctx))
+
+	requests, found := repo.Get(ctx, "requests")
+	require.True(t, found)
+	assert.Equal(t, int64(5), *requests.Delta)
+
+	temperature, found := repo.Get(ctx, "temperature")
+	require.True(t, found)
+	assert.InDelta(t, 21.5, *temperature.Value, 0)
+
+	latency, found := repo.Get(ctx, "latency")
+	require.True(t, found)
+	assert.Equal(t, domain.Summary, latency.MType)
+	assert.Equal(t, uint64(3), latency.Summary.Count)
+	assert.InDelta(t, 60, latency.Summary.Sum, 0)
+	assert.Equal(t, []domain.Quantile{{Quantile: 0.5, Value: 20}, {Quantile: 1, Value: 30}}, latency.Summary.Quantiles)
+
+	users, found := repo.Get(ctx, "users")
+	require.True(t, found)
+	assert.InDelta(t, 2, *users.Value, 0)
+
+	hits, found := repo.Get(ctx, domain.SeriesID("hits", domain.Labels{"route": "home"}))
+	require.True(t, found)
+	assert.Equal(t, domain.Labels{"route": "home"}, hits.Labels)
+	assert.Equal(t, int64(1), *hits.Delta)
+
+	// counters keep counting across intervals, the set starts over
+	add(t, aggregator, "requests:3|c", "users:carol|s")
+	require.NoError(t, aggregator.Flush(ctx))
+
+	requests, _ = repo.Get(ctx, "requests")
+	assert.Equal(t, int64(8), *requests.Delta)
+
+	users, _ = repo.Get(ctx, "users")
+	assert.InDelta(t, 1, *users.Value, 0)
+
+	latency, _ = repo.Get(ctx, "latency")
+	assert.Equal(t, uint64(3), latency.Summary.Count, "a timer without samples is not rewritten")
+}
+
+func TestAggregator_ContinuesStoredValues(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	repo := storage.NewMemStorage(testutils.GetTLogger())
+
+	delta := int64(10)
+	value := 5.0
+	require.NoError(t, repo.UpdateMany(ctx, &[]db.Metric{
+		*db.NewMetric("requests", domain.Counter, &delta, nil),
+		*db.NewMetric("queue", domain.Gauge, nil, &value),
+	}))
+
+	aggregator := statsd.NewAggregator(repo, []float64{0.5}, testutils.GetTLogger())
+	add(t, aggregator, "requests:2|c", "queue:+3|g", "queue:-1|g")
+	require.NoError(t, aggregator.Flush(ctx))
+
+	requests, _ := repo.Get(ctx, "requests")
+	assert.Equal(t, int64(12), *requests.Delta)
+
+	queue, _ := repo.Get(ctx, "queue")
+	assert.InDelta(t, 7, *queue.Value, 0)
+
+	// an absolute value replaces the gauge, later relative changes apply to it
+	add(t, aggregator, "queue:1|g", "queue:+1|g")
+	require.NoError(t, aggregator.Flush(ctx))
+
+	queue, _ = repo.Get(ctx, "queue")
+	assert.InDelta(t, 2, *queue.Value, 0)
+}
+
+func TestAggregator_MergesIntoStoredSeries(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	repo := storage.NewMemStorage(testutils.GetTLogger())
+	aggregator := statsd.NewAggregator(repo, []float64{0.5}, testutils.GetTLogger())
+
+	add(t, aggregator, "requests:2|c", "queue:+3|g", "sampled:1|c|@0.8")
+	require.NoError(t, aggregator.Flush(ctx))
+
+	// another client writes the same series between the flushes
+	delta := int64(10)
+	value := 1.0
+	_, err := repo.ApplyDeltas(ctx, []db.Metric{*db.NewMetric("requests", domain.Counter, &delta, nil)})
+	require.NoError(t, err)
+	require.NoError(t, repo.Update(ctx, db.NewMetric("queue", domain.Gauge, nil, &value)))
+
+	add(t, aggregator, "requests:1|c", "queue:+1|g")
+	require.NoError(t, aggregator.Flush(ctx))
+
+	requests, _ := repo.Get(ctx, "requests")
+	assert.Equal(t, int64(13), *requests.Delta)
+
+	queue, _ := repo.Get(ctx, "queue")
+	assert.InDelta(t, 2, *queue.Value, 0)
+
+	sampled, _ := repo.Get(ctx, "sampled")
+	assert.Equal(t, int64(1), *sampled.Delta, "the fraction of 1.25 is not written")
+
+	// series deleted or evicted are not written again without new samples
+	_, err = repo.DeleteMany(ctx, []domain.MetricName{"requests", "queue", "sampled"})
+	require.NoError(t, err)
+	require.NoError(t, aggregator.Flush(ctx))
+	require.NoError(t, aggregator.Flush(ctx))
+
+	assert.Empty(t, repo.GetAll(ctx))
+}
+
+func TestAggregator_DropsRejectedSeries(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	repo := storage.NewMemStorage(testutils.GetTLogger())
+	value := 1.0
+	require.NoError(t, repo.Update(ctx, db.NewMetric("requests", domain.Gauge, nil, &value)))
+
+	aggregator := statsd.NewAggregator(repo, []float64{0.5}, testutils.GetTLogger())
+	add(t, aggregator, "requests:1|c", "hits:2|c", "queue:+3|g", "latency:10|ms")
+	require.NoError(t, aggregator.Flush(ctx), "the series clashing with a stored gauge is dropped")
+
+	requests, _ := repo.Get(ctx, "requests")
+	assert.Equal(t, domain.Gauge, requests.MType)
+
+	hits, _ := repo.Get(ctx, "hits")
+	assert.Equal(t, int64(2), *hits.Delta)
+
+	queue, _ := repo.Get(ctx, "queue")
+	assert.InDelta(t, 3, *queue.Value, 0)
+
+	latency, _ := repo.Get(ctx, "latency")
+	assert.Equal(t, uint64(1), latency.Summary.Count)
+
+	// the dropped increment is not retried
+	add(t, aggregator, "hits:1|c")
+	require.NoError(t, aggregator.Flush(ctx))
+
+	hits, _ = repo.Get(ctx, "hits")
+	assert.Equal(t, int64(3), *hits.Delta)
+}
+
+// failingRepository fails the writes while failing is set.
+type failingRepository struct {
+	model.Repository
+
+	failing bool
+}
+
+func (r *failingRepository) ApplyBatch(ctx context.Context, batch *model.Batch) error {
+	if r.failing {
+		return errors.New("storage is down")
+	}
+
+	return r.Repository.ApplyBatch(ctx, batch) //nolint:wrapcheck
+}
+
+func TestAggregator_RestoresFailedInterval(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	repo := &failingRepository{Repository: storage.NewMemStorage(testutils.GetTLogger()), failing: true}
+	aggregator := statsd.NewAggregator(repo, []float64{1}, testutils.GetTLogger())
+
+	add(t, aggregator, "requests:2|c", "queue:5|g", "depth:+1|g", "latency:10|ms", "users:alice|s")
+	require.Error(t, aggregator.Flush(ctx))
+
+	repo.failing = false
+	add(t, aggregator, "requests:1|c", "queue:+1|g", "depth:+2|g", "latency:30|ms", "users:bob|s")
+	require.NoError(t, aggregator.Flush(ctx))
+
+	requests, _ := repo.Get(ctx, "requests")
+	assert.Equal(t, int64(3), *requests.Delta)
+
+	queue, _ := repo.Get(ctx, "queue")
+	assert.InDelta(t, 6, *queue.Value, 0)
+
+	depth, _ := repo.Get(ctx, "depth")
+	assert.InDelta(t, 3, *depth.Value, 0)
+
+	latency, _ := repo.Get(ctx, "latency")
+	assert.Equal(t, uint64(2), latency.Summary.Count)
+	assert.InDelta(t, 40, latency.Summary.Sum, 0)
+
+	users, _ := repo.Get(ctx, "users")
+	assert.InDelta(t, 2, *users.Value, 0)
+}
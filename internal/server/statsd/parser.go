@@ -0,0 +1,130 @@
+// Package statsd receives the StatsD metrics of legacy applications over UDP and TCP, aggregates them
+// per flush interval and writes them to the repository.
+package statsd
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/npavlov/go-metrics-service/internal/domain"
+)
+
+// Type - the StatsD type of a sample.
+type Type string
+
+const (
+	// TypeCounter increments a counter by the value divided by the sample rate.
+	TypeCounter Type = "c"
+	// TypeGauge sets a gauge, a signed value changes it relatively.
+	TypeGauge Type = "g"
+	// TypeTimer observes a duration in milliseconds.
+	TypeTimer Type = "ms"
+	// TypeHistogram observes a value like a timer.
+	TypeHistogram Type = "h"
+	// TypeSet counts the unique values within a flush interval.
+	TypeSet Type = "s"
+)
+
+// ErrInvalidLine is returned for a line that is not a StatsD sample.
+var ErrInvalidLine = errors.New("invalid statsd line")
+
+// Sample - a parsed StatsD line.
+type Sample struct {
+	Name   domain.MetricName
+	Labels domain.Labels
+	Type   Type
+	Value  float64
+	// Member - the raw value of a set sample.
+	Member string
+	// Relative - the gauge value is a signed change of the current value.
+	Relative bool
+	// Rate - the sample rate of a counter, 1 when not sent.
+	Rate float64
+}
+
+// Parse parses a line in the name:value|type[|@rate][|#tag:value,...] form, the tags are the labels of the series.
+func Parse(line string) (Sample, error) {
+	//nolint:exhaustruct
+	sample := Sample{Rate: 1}
+
+	name, rest, found := strings.Cut(strings.TrimSpace(line), ":")
+	if !found || name == "" {
+		return sample, errors.Wrap(ErrInvalidLine, line)
+	}
+	sample.Name = domain.MetricName(name)
+
+	fields := strings.Split(rest, "|")
+	if len(fields) < 2 { //nolint:mnd
+		return sample, errors.Wrap(ErrInvalidLine, line)
+	}
+	value := fields[0]
+	sample.Type = Type(fields[1])
+
+	for _, field := range fields[2:] {
+		switch {
+		case strings.HasPrefix(field, "@"):
+			rate, err := strconv.ParseFloat(field[1:], 64)
+			if err != nil || rate <= 0 || rate > 1 {
+				return sample, errors.Wrapf(ErrInvalidLine, "invalid sample rate: %s", line)
+			}
+			sample.Rate = rate
+		case strings.HasPrefix(field, "#"):
+			labels, err := parseTags(field[1:])
+			if err != nil {
+				return sample, errors.Wrapf(ErrInvalidLine, "%s: %v", line, err)
+			}
+			sample.Labels = labels
+		default:
+			return sample, errors.Wrap(ErrInvalidLine, line)
+		}
+	}
+
+	switch sample.Type {
+	case TypeSet:
+		if value == "" {
+			return sample, errors.Wrap(ErrInvalidLine, line)
+		}
+		sample.Member = value
+
+		return sample, nil
+	case TypeGauge:
+		sample.Relative = strings.HasPrefix(value, "+") || strings.HasPrefix(value, "-")
+	case TypeCounter, TypeTimer, TypeHistogram:
+	default:
+		return sample, errors.Wrapf(ErrInvalidLine, "unknown type: %s", line)
+	}
+
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsNaN(parsed) || math.IsInf(parsed, 0) {
+		return sample, errors.Wrapf(ErrInvalidLine, "invalid value: %s", line)
+	}
+	sample.Value = parsed
+
+	return sample, nil
+}
+
+// parseTags parses the comma separated tags of a line, a tag without a value is a label with an empty value.
+func parseTags(tags string) (domain.Labels, error) {
+	labels := make(domain.Labels)
+
+	for _, tag := range strings.Split(tags, ",") {
+		if tag == "" {
+			continue
+		}
+		name, value, _ := strings.Cut(tag, ":")
+		labels[name] = value
+	}
+
+	if err := labels.Validate(); err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	if len(labels) == 0 {
+		return nil, nil
+	}
+
+	return labels, nil
+}
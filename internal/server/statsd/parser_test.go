@@ -0,0 +1,90 @@
+package statsd_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/npavlov/go-metrics-service/internal/domain"
+	"github.com/npavlov/go-metrics-service/internal/server/statsd"
+)
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		line string
+		want statsd.Sample
+	}{
+		{
+			name: "counter",
+			line: "requests:1|c",
+			want: statsd.Sample{Name: "requests", Labels: nil, Type: statsd.TypeCounter, Value: 1, Member: "", Relative: false, Rate: 1},
+		},
+		{
+			name: "sampled counter",
+			line: "requests:2|c|@0.5",
+			want: statsd.Sample{Name: "requests", Labels: nil, Type: statsd.TypeCounter, Value: 2, Member: "", Relative: false, Rate: 0.5},
+		},
+		{
+			name: "gauge",
+			line: "temperature:3.2|g",
+			want: statsd.Sample{Name: "temperature", Labels: nil, Type: statsd.TypeGauge, Value: 3.2, Member: "", Relative: false, Rate: 1},
+		},
+		{
+			name: "relative gauge",
+			line: "queue:-4|g",
+			want: statsd.Sample{Name: "queue", Labels: nil, Type: statsd.TypeGauge, Value: -4, Member: "", Relative: true, Rate: 1},
+		},
+		{
+			name: "timer with tags",
+			line: "latency:12|ms|#route:home,method:get",
+			want: statsd.Sample{
+				Name:     "latency",
+				Labels:   domain.Labels{"route": "home", "method": "get"},
+				Type:     statsd.TypeTimer,
+				Value:    12,
+				Member:   "",
+				Relative: false,
+				Rate:     1,
+			},
+		},
+		{
+			name: "set",
+			line: "users:alice|s",
+			want: statsd.Sample{Name: "users", Labels: nil, Type: statsd.TypeSet, Value: 0, Member: "alice", Relative: false, Rate: 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			sample, err := statsd.Parse(tt.line)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, sample)
+		})
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	t.Parallel()
+
+	for _, line := range []string{
+		"requests",
+		":1|c",
+		"requests:1",
+		"requests:one|c",
+		"requests:1|x",
+		"requests:1|c|@0",
+		"requests:1|c|@2",
+		"requests:1|c|extra",
+		"requests:NaN|g",
+		"users:|s",
+	} {
+		_, err := statsd.Parse(line)
+		require.ErrorIs(t, err, statsd.ErrInvalidLine, line)
+	}
+}
@@ -0,0 +1,212 @@
+package statsd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	pkgerrors "github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/npavlov/go-metrics-service/internal/model"
+)
+
+const (
+	// maxPacketSize - the largest UDP datagram read, a datagram may carry several newline separated lines.
+	maxPacketSize = 64 * 1024
+	// maxLineSize - the longest line read from a TCP connection.
+	maxLineSize = 64 * 1024
+)
+
+//nolint:gochecknoglobals
+var defaultQuantiles = []float64{0.5, 0.9, 0.99}
+
+// Server listens for StatsD lines on the UDP and TCP ports of the same address.
+type Server struct {
+	address    string
+	interval   time.Duration
+	aggregator *Aggregator
+	log        *zerolog.Logger
+	wg         sync.WaitGroup
+
+	mu    sync.Mutex
+	conns map[net.Conn]struct{}
+}
+
+// NewServer creates the StatsD server aggregating the samples received on the address
+// and writing them to the repository every flush interval.
+func NewServer(address string, interval time.Duration, repo model.Repository, log *zerolog.Logger) *Server {
+	return &Server{
+		address:    address,
+		interval:   interval,
+		aggregator: NewAggregator(repo, defaultQuantiles, log),
+		log:        log,
+		wg:         sync.WaitGroup{},
+		mu:         sync.Mutex{},
+		conns:      make(map[net.Conn]struct{}),
+	}
+}
+
+// Start binds the UDP and TCP listeners and serves them until the context is canceled,
+// the samples of the last interval are flushed on shutdown.
+func (s *Server) Start(ctx context.Context) error {
+	packets, err := net.ListenPacket("udp", s.address)
+	if err != nil {
+		return pkgerrors.Wrap(err, "failed to listen on udp")
+	}
+
+	listener, err := net.Listen("tcp", s.address)
+	if err != nil {
+		_ = packets.Close()
+
+		return pkgerrors.Wrap(err, "failed to listen on tcp")
+	}
+
+	s.log.Info().Str("statsd_address", s.address).Dur("flush_interval", s.interval).Msg("StatsD server started")
+
+	s.wg.Add(2)
+	go s.servePackets(packets)
+	go s.serveConnections(listener)
+
+	go func() {
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				_ = packets.Close()
+				_ = listener.Close()
+				s.closeConnections()
+				s.wg.Wait()
+
+				// The context is canceled already, the last interval is written without it.
+				s.flush(context.WithoutCancel(ctx))
+				s.log.Info().Msg("StatsD server shut down")
+
+				return
+			case <-ticker.C:
+				s.flush(ctx)
+			}
+		}
+	}()
+
+	return nil
+}
+
+func (s *Server) flush(ctx context.Context) {
+	if err := s.aggregator.Flush(ctx); err != nil {
+		s.log.Error().Err(err).Msg("failed to flush statsd metrics")
+	}
+}
+
+func (s *Server) servePackets(packets net.PacketConn) {
+	defer s.wg.Done()
+
+	buffer := make([]byte, maxPacketSize)
+	for {
+		size, _, err := packets.ReadFrom(buffer)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				s.log.Error().Err(err).Msg("failed to read statsd packet")
+			}
+
+			return
+		}
+
+		for _, line := range bytes.Split(buffer[:size], []byte("\n")) {
+			s.handle(string(line))
+		}
+	}
+}
+
+func (s *Server) serveConnections(listener net.Listener) {
+	defer s.wg.Done()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				s.log.Error().Err(err).Msg("failed to accept statsd connection")
+			}
+
+			return
+		}
+
+		if !s.track(conn) {
+			_ = conn.Close()
+
+			return
+		}
+
+		s.wg.Add(1)
+		go s.serveConnection(conn)
+	}
+}
+
+func (s *Server) serveConnection(conn net.Conn) {
+	defer s.wg.Done()
+	defer s.untrack(conn)
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), maxLineSize)
+
+	for scanner.Scan() {
+		s.handle(scanner.Text())
+	}
+
+	if err := scanner.Err(); err != nil && !errors.Is(err, net.ErrClosed) {
+		s.log.Error().Err(err).Msg("failed to read statsd connection")
+	}
+}
+
+// track registers the connection to close on shutdown, it fails once the server is shutting down.
+func (s *Server) track(conn net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conns == nil {
+		return false
+	}
+	s.conns[conn] = struct{}{}
+
+	return true
+}
+
+func (s *Server) untrack(conn net.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_ = conn.Close()
+	delete(s.conns, conn)
+}
+
+func (s *Server) closeConnections() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for conn := range s.conns {
+		_ = conn.Close()
+	}
+	s.conns = nil
+}
+
+func (s *Server) handle(line string) {
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+
+	sample, err := Parse(line)
+	if err != nil {
+		s.log.Warn().Err(err).Str("line", line).Msg("skipping invalid statsd line")
+
+		return
+	}
+
+	s.aggregator.Add(sample)
+}
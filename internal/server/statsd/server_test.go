@@ -0,0 +1,70 @@
+package statsd_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/npavlov/go-metrics-service/internal/server/statsd"
+	"github.com/npavlov/go-metrics-service/internal/server/storage"
+	testutils "github.com/npavlov/go-metrics-service/internal/test_utils"
+)
+
+func freeAddress(t *testing.T) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	address := listener.Addr().String()
+	require.NoError(t, listener.Close())
+
+	return address
+}
+
+func TestServer(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	repo := storage.NewMemStorage(testutils.GetTLogger())
+	address := freeAddress(t)
+	require.NoError(t, statsd.NewServer(address, 20*time.Millisecond, repo, testutils.GetTLogger()).Start(ctx))
+
+	udp, err := net.Dial("udp", address)
+	require.NoError(t, err)
+	defer udp.Close()
+
+	_, err = udp.Write([]byte("udp_requests:1|c\nudp_requests:2|c\ninvalid\n"))
+	require.NoError(t, err)
+
+	tcp, err := net.Dial("tcp", address)
+	require.NoError(t, err)
+	defer tcp.Close()
+
+	_, err = tcp.Write([]byte("tcp_gauge:4|g\ntcp_gauge:+1|g\n"))
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		requests, found := repo.Get(ctx, "udp_requests")
+		gauge, gaugeFound := repo.Get(ctx, "tcp_gauge")
+
+		return found && *requests.Delta == 3 && gaugeFound && *gauge.Value == 5
+	}, time.Second, 10*time.Millisecond)
+
+	// the samples of the last interval are flushed on shutdown, the open connection does not block it
+	_, err = tcp.Write([]byte("tcp_gauge:7|g\n"))
+	require.NoError(t, err)
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+
+	assert.Eventually(t, func() bool {
+		gauge, _ := repo.Get(context.Background(), "tcp_gauge")
+
+		return *gauge.Value == 7
+	}, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,274 @@
+package storage
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/pkg/errors"
+
+	"github.com/npavlov/go-metrics-service/internal/domain"
+	"github.com/npavlov/go-metrics-service/internal/server/db"
+)
+
+// bulkUpdate holds the series of a set-based write of a tenant, one entry per series sorted by ID.
+// The series are sorted, so concurrent batches lock the rows in the same order and cannot deadlock.
+type bulkUpdate struct {
+	tenant         string
+	series         []db.Metric
+	counterSamples db.BulkInsertCounterSamplesParams
+	gaugeSamples   db.BulkInsertGaugeSamplesParams
+	// increment adds the counters to the stored ones instead of replacing them
+	increment bool
+	// add adds the gauges to the stored ones instead of replacing them
+	add bool
+}
+
+// newBulkUpdate splits the metrics into series.
+// The last write of a series wins, as an upsert cannot touch the same row twice, every write keeps its sample.
+func newBulkUpdate(tenant domain.Tenant, metrics []db.Metric) (*bulkUpdate, error) {
+	return newBulk(tenant, metrics, false)
+}
+
+// newBulkDeltas splits the metrics into series, the writes of a series are merged, see db.Metric.Merge.
+// The counters are added to the stored ones, a counter keeps one sample of its new total per batch.
+func newBulkDeltas(tenant domain.Tenant, metrics []db.Metric) (*bulkUpdate, error) {
+	return newBulk(tenant, metrics, true)
+}
+
+// newBulkChanges splits the gauge changes into series, the changes of a series are summed.
+// The gauges are added to the stored ones, a gauge keeps one sample of its new value per batch.
+func newBulkChanges(tenant domain.Tenant, metrics []db.Metric) (*bulkUpdate, error) {
+	//nolint:exhaustruct
+	bulk := &bulkUpdate{tenant: tenant.String(), add: true}
+
+	latest := make(map[domain.MetricName]*db.Metric, len(metrics))
+	for _, metric := range metrics {
+		seriesID := metric.SeriesID()
+		if metric.MType != domain.Gauge || metric.Value == nil {
+			return nil, errors.Errorf(errNotGauge, seriesID)
+		}
+
+		if existing, found := latest[seriesID]; found {
+			*existing.Value += *metric.Value
+		} else {
+			latest[seriesID] = metric.Clone()
+		}
+	}
+
+	bulk.setSeries(latest)
+
+	return bulk, nil
+}
+
+func newBulk(tenant domain.Tenant, metrics []db.Metric, increment bool) (*bulkUpdate, error) {
+	//nolint:exhaustruct
+	bulk := &bulkUpdate{tenant: tenant.String(), increment: increment}
+
+	latest := make(map[domain.MetricName]*db.Metric, len(metrics))
+	for _, metric := range metrics {
+		if !metric.HasValue() {
+			return nil, errors.New(errNoValue)
+		}
+
+		seriesID := metric.SeriesID()
+		if existing, found := latest[seriesID]; found && increment {
+			if existing.MType != metric.MType {
+				return nil, errors.Wrapf(ErrTypeMismatch, "%s is a %s", seriesID, existing.MType)
+			}
+
+			existing.Merge(&metric)
+		} else {
+			latest[seriesID] = metric.Clone()
+		}
+
+		switch metric.MType {
+		case domain.Counter:
+			if !increment {
+				bulk.counterSamples.Ids = append(bulk.counterSamples.Ids, string(seriesID))
+				bulk.counterSamples.Deltas = append(bulk.counterSamples.Deltas, *metric.Delta)
+			}
+		case domain.Gauge:
+			bulk.gaugeSamples.Ids = append(bulk.gaugeSamples.Ids, string(seriesID))
+			bulk.gaugeSamples.Vals = append(bulk.gaugeSamples.Vals, *metric.Value)
+		case domain.Histogram, domain.Summary:
+		}
+	}
+
+	bulk.setSeries(latest)
+
+	return bulk, nil
+}
+
+// setSeries sets the series of the write sorted by ID.
+func (b *bulkUpdate) setSeries(latest map[domain.MetricName]*db.Metric) {
+	b.series = make([]db.Metric, 0, len(latest))
+	for _, metric := range latest {
+		b.series = append(b.series, *metric)
+	}
+	slices.SortFunc(b.series, func(a, b db.Metric) int {
+		return strings.Compare(string(a.SeriesID()), string(b.SeriesID()))
+	})
+}
+
+// ids returns the IDs of the series.
+func (b *bulkUpdate) ids() []string {
+	ids := make([]string, len(b.series))
+	for i, metric := range b.series {
+		ids[i] = string(metric.SeriesID())
+	}
+
+	return ids
+}
+
+// distributionIDs returns the IDs of the histogram and summary series.
+func (b *bulkUpdate) distributionIDs() []string {
+	ids := make([]string, 0)
+	for _, metric := range b.series {
+		if metric.MType.IsDistribution() {
+			ids = append(ids, string(metric.SeriesID()))
+		}
+	}
+
+	return ids
+}
+
+// mergeStored merges the series into the stored histograms and summaries.
+func (b *bulkUpdate) mergeStored(rows []db.LockDistributionsRow) {
+	for _, row := range rows {
+		i, found := slices.BinarySearchFunc(b.series, row.ID, func(metric db.Metric, id domain.MetricName) int {
+			return strings.Compare(string(metric.SeriesID()), string(id))
+		})
+		if !found {
+			continue
+		}
+
+		stored := b.series[i].Clone()
+		stored.Histogram = row.Histogram
+		stored.Summary = row.Summary
+		stored.Merge(&b.series[i])
+		b.series[i] = *stored
+	}
+}
+
+// batch queues all statements of the write.
+func (b *bulkUpdate) batch() (*pgx.Batch, error) {
+	//nolint:exhaustruct
+	batch := &pgx.Batch{}
+
+	if err := b.queueSeries(batch); err != nil {
+		return nil, err
+	}
+
+	if err := b.queueValues(batch); err != nil {
+		return nil, err
+	}
+
+	return batch, nil
+}
+
+// queueSeries queues the series and their labels, they go first as the other tables reference them.
+func (b *bulkUpdate) queueSeries(batch *pgx.Batch) error {
+	json := jsoniter.ConfigCompatibleWithStandardLibrary
+
+	//nolint:exhaustruct
+	metrics, labels := db.BulkInsertMtrMetricsParams{}, db.BulkInsertMetricLabelsParams{}
+	for _, metric := range b.series {
+		id := string(metric.SeriesID())
+		metrics.Ids = append(metrics.Ids, id)
+		metrics.Types = append(metrics.Types, string(metric.MType))
+
+		if len(metric.Labels) > 0 {
+			encoded, err := json.Marshal(metric.Labels)
+			if err != nil {
+				return errors.Wrap(err, "failed to marshal labels")
+			}
+
+			labels.Ids = append(labels.Ids, id)
+			labels.Names = append(labels.Names, string(metric.ID))
+			labels.Labels = append(labels.Labels, string(encoded))
+		}
+	}
+
+	batch.Queue(db.BulkInsertMtrMetrics, b.tenant, metrics.Ids, metrics.Types)
+
+	if len(labels.Ids) > 0 {
+		batch.Queue(db.BulkInsertMetricLabels, b.tenant, labels.Ids, labels.Names, labels.Labels)
+	}
+
+	return nil
+}
+
+// queueValues queues the statements of the values and samples that have rows.
+func (b *bulkUpdate) queueValues(batch *pgx.Batch) error {
+	json := jsoniter.ConfigCompatibleWithStandardLibrary
+
+	//nolint:exhaustruct
+	counters, gauges := db.BulkUpsertCounterMetricsParams{}, db.BulkUpsertGaugeMetricsParams{}
+	//nolint:exhaustruct
+	histograms, summaries := db.BulkUpsertHistogramMetricsParams{}, db.BulkUpsertSummaryMetricsParams{}
+
+	for _, metric := range b.series {
+		id := string(metric.SeriesID())
+
+		switch metric.MType {
+		case domain.Counter:
+			counters.Ids = append(counters.Ids, id)
+			counters.Deltas = append(counters.Deltas, *metric.Delta)
+		case domain.Gauge:
+			gauges.Ids = append(gauges.Ids, id)
+			gauges.Vals = append(gauges.Vals, *metric.Value)
+		case domain.Histogram:
+			histogram, err := json.Marshal(metric.Histogram)
+			if err != nil {
+				return errors.Wrap(err, "failed to marshal histogram")
+			}
+
+			histograms.Ids = append(histograms.Ids, id)
+			histograms.Histograms = append(histograms.Histograms, string(histogram))
+		case domain.Summary:
+			summary, err := json.Marshal(metric.Summary)
+			if err != nil {
+				return errors.Wrap(err, "failed to marshal summary")
+			}
+
+			summaries.Ids = append(summaries.Ids, id)
+			summaries.Summaries = append(summaries.Summaries, string(summary))
+		}
+	}
+
+	if len(counters.Ids) > 0 {
+		if b.increment {
+			batch.Queue(db.BulkIncrementCounterMetrics, b.tenant, counters.Ids, counters.Deltas)
+			batch.Queue(db.BulkInsertCounterTotals, b.tenant, counters.Ids)
+		} else {
+			batch.Queue(db.BulkUpsertCounterMetrics, b.tenant, counters.Ids, counters.Deltas)
+			batch.Queue(db.BulkInsertCounterSamples, b.tenant, b.counterSamples.Ids, b.counterSamples.Deltas)
+		}
+
+		batch.Queue(db.TrimCounterSamples, b.tenant, int32(maxSamples), counters.Ids)
+	}
+
+	if len(gauges.Ids) > 0 {
+		if b.add {
+			batch.Queue(db.BulkIncrementGaugeMetrics, b.tenant, gauges.Ids, gauges.Vals)
+			batch.Queue(db.BulkInsertGaugeTotals, b.tenant, gauges.Ids)
+		} else {
+			batch.Queue(db.BulkUpsertGaugeMetrics, b.tenant, gauges.Ids, gauges.Vals)
+			batch.Queue(db.BulkInsertGaugeSamples, b.tenant, b.gaugeSamples.Ids, b.gaugeSamples.Vals)
+		}
+
+		batch.Queue(db.TrimGaugeSamples, b.tenant, int32(maxSamples), gauges.Ids)
+	}
+
+	if len(histograms.Ids) > 0 {
+		batch.Queue(db.BulkUpsertHistogramMetrics, b.tenant, histograms.Ids, histograms.Histograms)
+	}
+
+	if len(summaries.Ids) > 0 {
+		batch.Queue(db.BulkUpsertSummaryMetrics, b.tenant, summaries.Ids, summaries.Summaries)
+	}
+
+	return nil
+}
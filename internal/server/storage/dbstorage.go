@@ -5,15 +5,18 @@ import (
 	"time"
 
 	"github.com/cenkalti/backoff/v4"
-	"github.com/jackc/pgconn"
 	"github.com/jackc/pgerrcode"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
 
 	"github.com/npavlov/go-metrics-service/internal/domain"
+	"github.com/npavlov/go-metrics-service/internal/model"
 	"github.com/npavlov/go-metrics-service/internal/server/db"
 	"github.com/npavlov/go-metrics-service/internal/server/dbmanager"
+	"github.com/npavlov/go-metrics-service/internal/server/hub"
+	"github.com/npavlov/go-metrics-service/internal/server/tenant"
 )
 
 const maxRetries = 3
@@ -22,6 +25,7 @@ type DBStorage struct {
 	Queries *db.Queries
 	log     *zerolog.Logger
 	dbCon   dbmanager.PgxPool
+	hub     *hub.Hub
 }
 
 // NewDBStorage initializes a new DBStorage instance.
@@ -30,9 +34,17 @@ func NewDBStorage(dbCon dbmanager.PgxPool, log *zerolog.Logger) *DBStorage {
 		dbCon:   dbCon,
 		Queries: db.New(dbCon),
 		log:     log,
+		hub:     nil,
 	}
 }
 
+// WithHub publishes every successful write to the given change hub.
+func (ds *DBStorage) WithHub(changeHub *hub.Hub) *DBStorage {
+	ds.hub = changeHub
+
+	return ds
+}
+
 type OperationFunc func() error
 
 // retryOperation executes a database operation with retry logic.
@@ -80,7 +92,7 @@ func (ds *DBStorage) GetAll(ctx context.Context) map[domain.MetricName]*db.Metri
 	var metrics map[domain.MetricName]*db.Metric
 
 	err := ds.retryOperation(ctx, func() error {
-		results, err := ds.Queries.GetAllMetrics(ctx)
+		results, err := ds.Queries.GetAllMetrics(ctx, tenant.FromContext(ctx))
 		if err != nil {
 			ds.log.Error().Err(err).Msg("error getting metrics")
 
@@ -90,7 +102,7 @@ func (ds *DBStorage) GetAll(ctx context.Context) map[domain.MetricName]*db.Metri
 		metrics = make(map[domain.MetricName]*db.Metric, len(results))
 
 		for _, m := range results {
-			metrics[m.ID] = db.NewMetric(m.ID, m.MType, m.Delta, m.Value)
+			metrics[m.ID] = fromRow(m.ID, m.Name, m.Labels, m.MType, m.UpdatedAt, m.Delta, m.Value, m.Histogram, m.Summary)
 		}
 
 		return nil
@@ -109,13 +121,18 @@ func (ds *DBStorage) Get(ctx context.Context, name domain.MetricName) (*db.Metri
 	var metric db.Metric
 
 	err := ds.retryOperation(ctx, func() error {
-		result, err := ds.Queries.GetUnifiedMetric(ctx, name)
+		result, err := ds.Queries.GetUnifiedMetric(ctx, db.GetUnifiedMetricParams{
+			Tenant: tenant.FromContext(ctx),
+			ID:     name,
+		})
 		if err != nil {
 			ds.log.Error().Err(err).Msg("failed to retrieve metric")
 
 			return errors.Wrap(err, "failed to retrieve metric")
 		}
-		metric.FromFields(result.ID, result.MType, result.Delta, result.Value)
+		metric = *fromRow(
+			result.ID, result.Name, result.Labels, result.MType, result.UpdatedAt, result.Delta, result.Value, result.Histogram, result.Summary,
+		)
 
 		return nil
 	})
@@ -140,7 +157,10 @@ func (ds *DBStorage) GetMany(ctx context.Context, names []domain.MetricName) (ma
 	metrics := make(map[domain.MetricName]db.Metric)
 
 	err := ds.retryOperation(ctx, func() error {
-		results, err := ds.Queries.GetManyMetrics(ctx, nameStrings)
+		results, err := ds.Queries.GetManyMetrics(ctx, db.GetManyMetricsParams{
+			Tenant: tenant.FromContext(ctx),
+			Ids:    nameStrings,
+		})
 		if err != nil {
 			ds.log.Error().Err(err).Msg("error getting multiple metrics")
 
@@ -148,7 +168,7 @@ func (ds *DBStorage) GetMany(ctx context.Context, names []domain.MetricName) (ma
 		}
 
 		for _, m := range results {
-			metrics[m.ID] = *db.NewMetric(m.ID, m.MType, m.Delta, m.Value)
+			metrics[m.ID] = *fromRow(m.ID, m.Name, m.Labels, m.MType, m.UpdatedAt, m.Delta, m.Value, m.Histogram, m.Summary)
 		}
 
 		return nil
@@ -162,46 +182,91 @@ func (ds *DBStorage) GetMany(ctx context.Context, names []domain.MetricName) (ma
 
 // Update modifies an existing metric in the database with retry logic.
 func (ds *DBStorage) Update(ctx context.Context, metric *db.Metric) error {
-	if metric.Delta == nil && metric.Value == nil {
+	if !metric.HasValue() {
 		return errors.New(errNoValue)
 	}
 
+	owner := tenant.FromContext(ctx)
+
 	err := ds.retryOperation(ctx, func() error {
-		switch metric.MType {
-		case domain.Gauge:
-			err := ds.Queries.UpdateGaugeMetric(ctx, db.UpdateGaugeMetricParams{
-				Value:    metric.Value,
-				MetricID: metric.ID,
-			})
-			if err != nil {
-				ds.log.Error().Err(err).Msg("error updating metric")
+		return WithTx(ctx, ds.dbCon, func(ctx context.Context, tx pgx.Tx) error {
+			query := ds.Queries.WithTx(tx)
 
-				return errors.Wrap(err, "error updating metric")
+			switch metric.MType {
+			case domain.Gauge:
+				err := query.UpdateGaugeMetric(ctx, db.UpdateGaugeMetricParams{
+					Tenant:   owner,
+					Value:    metric.Value,
+					MetricID: metric.SeriesID(),
+				})
+				if err != nil {
+					ds.log.Error().Err(err).Msg("error updating metric")
+
+					return errors.Wrap(err, "error updating metric")
+				}
+			case domain.Counter:
+				err := query.UpdateCounterMetric(ctx, db.UpdateCounterMetricParams{
+					Tenant:   owner,
+					Delta:    metric.Delta,
+					MetricID: metric.SeriesID(),
+				})
+				if err != nil {
+					ds.log.Error().Err(err).Msg("error updating metric")
+
+					return errors.Wrap(err, "error updating metric")
+				}
+			case domain.Histogram:
+				err := query.UpdateHistogramMetric(ctx, db.UpdateHistogramMetricParams{
+					Tenant:    owner,
+					Histogram: metric.Histogram,
+					MetricID:  metric.SeriesID(),
+				})
+				if err != nil {
+					ds.log.Error().Err(err).Msg("error updating metric")
+
+					return errors.Wrap(err, "error updating metric")
+				}
+			case domain.Summary:
+				err := query.UpdateSummaryMetric(ctx, db.UpdateSummaryMetricParams{
+					Tenant:   owner,
+					Summary:  metric.Summary,
+					MetricID: metric.SeriesID(),
+				})
+				if err != nil {
+					ds.log.Error().Err(err).Msg("error updating metric")
+
+					return errors.Wrap(err, "error updating metric")
+				}
 			}
-		case domain.Counter:
-			err := ds.Queries.UpdateCounterMetric(ctx, db.UpdateCounterMetricParams{
-				Delta:    metric.Delta,
-				MetricID: metric.ID,
+
+			err := query.TouchMtrMetric(ctx, db.TouchMtrMetricParams{
+				Tenant: owner,
+				ID:     metric.SeriesID(),
 			})
 			if err != nil {
 				ds.log.Error().Err(err).Msg("error updating metric")
 
 				return errors.Wrap(err, "error updating metric")
 			}
-		}
 
-		return nil
+			return ds.insertSample(ctx, query, owner, metric)
+		})
 	})
+	if err == nil {
+		ds.hub.PublishUpdates(owner, *metric)
+	}
 
 	return err
 }
 
 // Create inserts a new metric into the database with retry logic.
 func (ds *DBStorage) Create(ctx context.Context, metric *db.Metric) error {
-	if metric.Delta == nil && metric.Value == nil {
+	if !metric.HasValue() {
 		return errors.New(errNoValue)
 	}
 
+	owner := tenant.FromContext(ctx)
+
 	//nolint:exhaustruct
 	err := ds.retryOperation(ctx, func() error {
 		tx, err := ds.dbCon.BeginTx(ctx, pgx.TxOptions{})
@@ -220,19 +285,24 @@ func (ds *DBStorage) Create(ctx context.Context, metric *db.Metric) error {
 
 		query := ds.Queries.WithTx(tx)
 		err = query.InsertMtrMetric(ctx, db.InsertMtrMetricParams{
-			MType: metric.MType,
-			ID:    metric.ID,
+			Tenant: owner,
+			MType:  metric.MType,
+			ID:     metric.SeriesID(),
 		})
 		if err != nil {
 			ds.log.Error().Err(err).Msg("failed to insert metric")
 
 			return errors.Wrap(err, "failed to insert metric")
 		}
+		if err = ds.insertLabels(ctx, query, owner, metric); err != nil {
+			return err
+		}
 		switch metric.MType {
 		case domain.Gauge:
 			err := query.InsertGaugeMetric(ctx, db.InsertGaugeMetricParams{
+				Tenant:   owner,
 				Value:    metric.Value,
-				MetricID: metric.ID,
+				MetricID: metric.SeriesID(),
 			})
 			if err != nil {
 				ds.log.Error().Err(err).Msg("error insert metric")
@@ -241,8 +311,31 @@ func (ds *DBStorage) Create(ctx context.Context, metric *db.Metric) error {
 			}
 		case domain.Counter:
 			err := query.InsertCounterMetric(ctx, db.InsertCounterMetricParams{
+				Tenant:   owner,
 				Delta:    metric.Delta,
-				MetricID: metric.ID,
+				MetricID: metric.SeriesID(),
+			})
+			if err != nil {
+				ds.log.Error().Err(err).Msg("error insert metric")
+
+				return errors.Wrap(err, "error insert metric")
+			}
+		case domain.Histogram:
+			err := query.InsertHistogramMetric(ctx, db.InsertHistogramMetricParams{
+				Tenant:    owner,
+				Histogram: metric.Histogram,
+				MetricID:  metric.SeriesID(),
+			})
+			if err != nil {
+				ds.log.Error().Err(err).Msg("error insert metric")
+
+				return errors.Wrap(err, "error insert metric")
+			}
+		case domain.Summary:
+			err := query.InsertSummaryMetric(ctx, db.InsertSummaryMetricParams{
+				Tenant:   owner,
+				Summary:  metric.Summary,
+				MetricID: metric.SeriesID(),
 			})
 			if err != nil {
 				ds.log.Error().Err(err).Msg("error insert metric")
@@ -251,70 +344,515 @@ func (ds *DBStorage) Create(ctx context.Context, metric *db.Metric) error {
 			}
 		}
 
-		return nil
+		return ds.insertSample(ctx, query, owner, metric)
 	})
+	if err == nil {
+		ds.hub.PublishUpdates(owner, *metric)
+	}
 
 	return err
 }
 
 // UpdateMany updates multiple metrics in the database with retry logic.
+// Every table is written by one set-based statement, the statements are sent in a single batch.
 func (ds *DBStorage) UpdateMany(ctx context.Context, metrics *[]db.Metric) error {
-	return ds.retryOperation(ctx, func() error {
+	if len(*metrics) == 0 {
+		return nil
+	}
+
+	owner := tenant.FromContext(ctx)
+
+	bulk, err := newBulkUpdate(owner, *metrics)
+	if err != nil {
+		return err
+	}
+
+	// every attempt sends a batch of its own, a sent batch is not reused
+	err = ds.retryOperation(ctx, func() error {
 		err := WithTx(ctx, ds.dbCon, func(ctx context.Context, tx pgx.Tx) error {
-			query := ds.Queries.WithTx(tx)
+			return sendBulk(ctx, tx, bulk)
+		})
+		if err != nil {
+			ds.log.Error().Err(err).Msg("error in UpdateMany")
 
-			key1, key2 := KeyNameAsHash64("update_many")
-			err := AcquireBlockingLock(ctx, tx, key1, key2, ds.log)
-			if err != nil {
-				ds.log.Error().Err(err).Msg("failed to acquire lock")
+			return errors.Wrap(err, "error in UpdateMany")
+		}
+
+		return nil
+	})
+	if err == nil {
+		ds.hub.PublishUpdates(owner, *metrics...)
+	}
+
+	return err
+}
 
-				return errors.Wrap(err, "failed to acquire lock")
+// ApplyDeltas merges the metrics into the stored series in one transaction and returns the resulting series.
+// Counters are incremented by the database itself, the series of histograms and summaries are locked
+// while they are merged, so concurrent writers never lose each other's updates.
+func (ds *DBStorage) ApplyDeltas(ctx context.Context, metrics []db.Metric) ([]db.Metric, error) {
+	if len(metrics) == 0 {
+		return []db.Metric{}, nil
+	}
+
+	// the input is validated before the first attempt, the stored distributions are merged on every attempt
+	owner := tenant.FromContext(ctx)
+	if _, err := newBulkDeltas(owner, metrics); err != nil {
+		return nil, err
+	}
+
+	var applied []db.Metric
+
+	err := ds.retryOperation(ctx, func() error {
+		err := WithTx(ctx, ds.dbCon, func(ctx context.Context, tx pgx.Tx) error {
+			var err error
+			applied, err = ds.applyDeltas(ctx, tx, owner, metrics)
+
+			return err
+		})
+		if err != nil {
+			ds.log.Error().Err(err).Msg("error in ApplyDeltas")
+
+			return errors.Wrap(err, "error in ApplyDeltas")
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ds.hub.PublishUpdates(owner, applied...)
+
+	return applied, nil
+}
+
+// applyDeltas writes the series, merges the stored distributions and returns the stored result.
+func (ds *DBStorage) applyDeltas(
+	ctx context.Context,
+	tx pgx.Tx,
+	owner domain.Tenant,
+	metrics []db.Metric,
+) ([]db.Metric, error) {
+	bulk, err := newBulkDeltas(owner, metrics)
+	if err != nil {
+		return nil, err
+	}
+
+	//nolint:exhaustruct
+	batch := &pgx.Batch{}
+	if err := bulk.queueSeries(batch); err != nil {
+		return nil, err
+	}
+
+	if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+		return nil, errors.Wrap(err, "error inserting series")
+	}
+
+	query := ds.Queries.WithTx(tx)
+
+	if ids := bulk.distributionIDs(); len(ids) > 0 {
+		stored, err := query.LockDistributions(ctx, db.LockDistributionsParams{Tenant: owner, Ids: ids})
+		if err != nil {
+			return nil, errors.Wrap(err, "error locking distributions")
+		}
+
+		bulk.mergeStored(stored)
+	}
+
+	//nolint:exhaustruct
+	batch = &pgx.Batch{}
+	if err := bulk.queueValues(batch); err != nil {
+		return nil, err
+	}
+
+	if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+		return nil, errors.Wrap(err, "error applying values")
+	}
+
+	return getApplied(ctx, query, owner, bulk.ids())
+}
+
+// ApplyBatch writes the values, merges the deltas and adds the changes of the batch in one transaction.
+// The gauges are changed by the database itself, as the counters of ApplyDeltas are.
+func (ds *DBStorage) ApplyBatch(ctx context.Context, batch *model.Batch) error {
+	if batch.Size() == 0 {
+		return nil
+	}
+
+	owner := tenant.FromContext(ctx)
+
+	values, err := newBulkUpdate(owner, batch.Values)
+	if err != nil {
+		return err
+	}
+
+	if _, err := newBulkDeltas(owner, batch.Deltas); err != nil {
+		return err
+	}
+
+	changes, err := newBulkChanges(owner, batch.Changes)
+	if err != nil {
+		return err
+	}
+
+	var applied []db.Metric
+
+	err = ds.retryOperation(ctx, func() error {
+		err := WithTx(ctx, ds.dbCon, func(ctx context.Context, tx pgx.Tx) error {
+			applied = make([]db.Metric, 0, batch.Size())
+
+			if len(batch.Values) > 0 {
+				if err := sendBulk(ctx, tx, values); err != nil {
+					return err
+				}
+				applied = append(applied, batch.Values...)
 			}
 
-			for _, metric := range *metrics {
-				err := query.UpsertMtrMetric(ctx, db.UpsertMtrMetricParams{
-					ID:    metric.ID,
-					MType: metric.MType,
-				})
+			if len(batch.Deltas) > 0 {
+				merged, err := ds.applyDeltas(ctx, tx, owner, batch.Deltas)
 				if err != nil {
-					ds.log.Error().Err(err).Msg("error in UpsertMetric during UpdateMany")
+					return err
+				}
+				applied = append(applied, merged...)
+			}
 
-					return errors.Wrap(err, "error in UpsertMetric during UpdateMany")
+			if len(batch.Changes) > 0 {
+				if err := sendBulk(ctx, tx, changes); err != nil {
+					return err
 				}
-				switch metric.MType {
-				case domain.Gauge:
-					err := query.UpsertGaugeMetric(ctx, db.UpsertGaugeMetricParams{
-						Value:    metric.Value,
-						MetricID: metric.ID,
-					})
-					if err != nil {
-						ds.log.Error().Err(err).Msg("error insert metric")
-
-						return errors.Wrap(err, "error insert metric")
-					}
-				case domain.Counter:
-					err := query.UpsertCounterMetric(ctx, db.UpsertCounterMetricParams{
-						Delta:    metric.Delta,
-						MetricID: metric.ID,
-					})
-					if err != nil {
-						ds.log.Error().Err(err).Msg("error insert metric")
-
-						return errors.Wrap(err, "error insert metric")
-					}
+
+				changed, err := getApplied(ctx, ds.Queries.WithTx(tx), owner, changes.ids())
+				if err != nil {
+					return err
 				}
+				applied = append(applied, changed...)
 			}
 
 			return nil
 		})
 		if err != nil {
-			ds.log.Error().Err(err).Msg("error in UpdateMany")
+			ds.log.Error().Err(err).Msg("error in ApplyBatch")
 
-			return errors.Wrap(err, "error in UpdateMany")
+			return errors.Wrap(err, "error in ApplyBatch")
 		}
 
 		return nil
 	})
+	if err != nil {
+		return err
+	}
+
+	ds.hub.PublishUpdates(owner, applied...)
+
+	return nil
+}
+
+// sendBulk sends all statements of the write in one batch.
+func sendBulk(ctx context.Context, tx pgx.Tx, bulk *bulkUpdate) error {
+	batch, err := bulk.batch()
+	if err != nil {
+		return err
+	}
+
+	return errors.Wrap(tx.SendBatch(ctx, batch).Close(), "error sending batch")
+}
+
+// getApplied returns the stored series of the IDs.
+func getApplied(ctx context.Context, query *db.Queries, owner domain.Tenant, ids []string) ([]db.Metric, error) {
+	results, err := query.GetManyMetrics(ctx, db.GetManyMetricsParams{Tenant: owner, Ids: ids})
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting applied metrics")
+	}
+
+	applied := make([]db.Metric, 0, len(results))
+	for _, m := range results {
+		applied = append(applied, *fromRow(m.ID, m.Name, m.Labels, m.MType, m.UpdatedAt, m.Delta, m.Value, m.Histogram, m.Summary))
+	}
+
+	return applied, nil
+}
+
+// GetRange retrieves the samples of a metric of the given type accepted within [from, to], oldest first.
+func (ds *DBStorage) GetRange(
+	ctx context.Context,
+	name domain.MetricName,
+	mType domain.MetricType,
+	from, to time.Time,
+) ([]db.Sample, error) {
+	samples := make([]db.Sample, 0)
+	owner := tenant.FromContext(ctx)
+
+	err := ds.retryOperation(ctx, func() error {
+		metric, err := ds.Queries.GetUnifiedMetric(ctx, db.GetUnifiedMetricParams{Tenant: owner, ID: name})
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			ds.log.Error().Err(err).Msg("failed to retrieve metric")
+
+			return errors.Wrap(err, "failed to retrieve metric")
+		}
+		if metric.MType != mType {
+			return nil
+		}
+
+		switch metric.MType {
+		case domain.Gauge:
+			results, err := ds.Queries.GetGaugeRange(ctx, db.GetGaugeRangeParams{
+				Tenant:   owner,
+				MetricID: name,
+				FromTime: from,
+				ToTime:   to,
+			})
+			if err != nil {
+				ds.log.Error().Err(err).Msg("error getting gauge samples")
+
+				return errors.Wrap(err, "error getting gauge samples")
+			}
+
+			for _, result := range results {
+				samples = append(samples, db.Sample{Delta: nil, Value: result.Value, Timestamp: result.CreatedAt})
+			}
+		case domain.Counter:
+			results, err := ds.Queries.GetCounterRange(ctx, db.GetCounterRangeParams{
+				Tenant:   owner,
+				MetricID: name,
+				FromTime: from,
+				ToTime:   to,
+			})
+			if err != nil {
+				ds.log.Error().Err(err).Msg("error getting counter samples")
+
+				return errors.Wrap(err, "error getting counter samples")
+			}
+
+			for _, result := range results {
+				samples = append(samples, db.Sample{Delta: result.Delta, Value: nil, Timestamp: result.CreatedAt})
+			}
+		case domain.Histogram, domain.Summary:
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to retrieve samples after retries")
+	}
+
+	return samples, nil
+}
+
+// Delete removes a metric of the given type with retry logic, its values and samples are removed by cascade.
+func (ds *DBStorage) Delete(ctx context.Context, name domain.MetricName, mType domain.MetricType) (bool, error) {
+	var deleted int64
+	owner := tenant.FromContext(ctx)
+
+	err := ds.retryOperation(ctx, func() error {
+		var err error
+
+		deleted, err = ds.Queries.DeleteMetric(ctx, db.DeleteMetricParams{Tenant: owner, ID: name, MType: mType})
+		if err != nil {
+			ds.log.Error().Err(err).Msg("error deleting metric")
+
+			return errors.Wrap(err, "error deleting metric")
+		}
+
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	if deleted > 0 {
+		ds.hub.PublishDeletes(owner, name)
+	}
+
+	return deleted > 0, nil
+}
+
+// DeleteMany removes multiple metrics with retry logic, returns the names that existed.
+func (ds *DBStorage) DeleteMany(ctx context.Context, names []domain.MetricName) ([]domain.MetricName, error) {
+	if len(names) == 0 {
+		return []domain.MetricName{}, nil
+	}
+
+	nameStrings := make([]string, len(names))
+	for i, name := range names {
+		nameStrings[i] = string(name)
+	}
+
+	var deleted []domain.MetricName
+	owner := tenant.FromContext(ctx)
+
+	err := ds.retryOperation(ctx, func() error {
+		var err error
+
+		deleted, err = ds.Queries.DeleteManyMetrics(ctx, db.DeleteManyMetricsParams{Tenant: owner, Ids: nameStrings})
+		if err != nil {
+			ds.log.Error().Err(err).Msg("error deleting multiple metrics")
+
+			return errors.Wrap(err, "error deleting multiple metrics")
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if deleted == nil {
+		deleted = []domain.MetricName{}
+	}
+
+	ds.hub.PublishDeletes(owner, deleted...)
+
+	return deleted, nil
+}
+
+// DeleteStale removes the metrics last updated before the given time with retry logic, returns the removed names.
+func (ds *DBStorage) DeleteStale(ctx context.Context, before time.Time) ([]domain.MetricName, error) {
+	var deleted []domain.MetricName
+	owner := tenant.FromContext(ctx)
+
+	err := ds.retryOperation(ctx, func() error {
+		var err error
+
+		deleted, err = ds.Queries.DeleteStaleMetrics(ctx, db.DeleteStaleMetricsParams{Tenant: owner, Before: &before})
+		if err != nil {
+			ds.log.Error().Err(err).Msg("error deleting stale metrics")
+
+			return errors.Wrap(err, "error deleting stale metrics")
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if deleted == nil {
+		deleted = []domain.MetricName{}
+	}
+
+	ds.hub.PublishDeletes(owner, deleted...)
+
+	return deleted, nil
+}
+
+// Tenants returns the tenants that have metrics, sorted.
+func (ds *DBStorage) Tenants(ctx context.Context) ([]domain.Tenant, error) {
+	var tenants []domain.Tenant
+
+	err := ds.retryOperation(ctx, func() error {
+		var err error
+
+		tenants, err = ds.Queries.GetTenants(ctx)
+		if err != nil {
+			ds.log.Error().Err(err).Msg("error getting tenants")
+
+			return errors.Wrap(err, "error getting tenants")
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if tenants == nil {
+		tenants = []domain.Tenant{}
+	}
+
+	return tenants, nil
+}
+
+// insertLabels stores the name and labels of a labeled series, the series ID alone is enough otherwise.
+func (ds *DBStorage) insertLabels(ctx context.Context, query *db.Queries, owner domain.Tenant, metric *db.Metric) error {
+	if len(metric.Labels) == 0 {
+		return nil
+	}
+
+	err := query.InsertMetricLabels(ctx, db.InsertMetricLabelsParams{
+		Tenant:   owner,
+		MetricID: metric.SeriesID(),
+		Name:     &metric.ID,
+		Labels:   metric.Labels,
+	})
+	if err != nil {
+		ds.log.Error().Err(err).Msg("error inserting metric labels")
+
+		return errors.Wrap(err, "error inserting metric labels")
+	}
+
+	return nil
+}
+
+// fromRow builds a metric from a stored row, the name of a series without labels is its ID.
+func fromRow(
+	seriesID domain.MetricName,
+	name *domain.MetricName,
+	labels domain.Labels,
+	mType domain.MetricType,
+	updatedAt *time.Time,
+	delta *int64,
+	value *float64,
+	histogram *domain.HistogramData,
+	summary *domain.SummaryData,
+) *db.Metric {
+	metricName := seriesID
+	if name != nil {
+		metricName = *name
+	}
+
+	metric := db.NewMetric(metricName, mType, delta, value).WithLabels(labels)
+	metric.UpdatedAt = updatedAt
+	metric.Histogram = histogram
+	metric.Summary = summary
+
+	return metric
+}
+
+// insertSample appends the value of the metric to its history table, distributions have no history.
+func (ds *DBStorage) insertSample(ctx context.Context, query *db.Queries, owner domain.Tenant, metric *db.Metric) error {
+	var err error
+
+	switch metric.MType {
+	case domain.Gauge:
+		err = query.InsertGaugeSample(ctx, db.InsertGaugeSampleParams{
+			Tenant:   owner,
+			MetricID: metric.SeriesID(),
+			Value:    metric.Value,
+		})
+		if err == nil {
+			err = query.TrimGaugeSamples(ctx, db.TrimGaugeSamplesParams{
+				Tenant: owner,
+				Keep:   maxSamples,
+				Ids:    []string{string(metric.SeriesID())},
+			})
+		}
+	case domain.Counter:
+		err = query.InsertCounterSample(ctx, db.InsertCounterSampleParams{
+			Tenant:   owner,
+			MetricID: metric.SeriesID(),
+			Delta:    metric.Delta,
+		})
+		if err == nil {
+			err = query.TrimCounterSamples(ctx, db.TrimCounterSamplesParams{
+				Tenant: owner,
+				Keep:   maxSamples,
+				Ids:    []string{string(metric.SeriesID())},
+			})
+		}
+	case domain.Histogram, domain.Summary:
+	}
+
+	if err != nil {
+		ds.log.Error().Err(err).Msg("error inserting sample")
+
+		return errors.Wrap(err, "error inserting sample")
+	}
+
+	return nil
 }
 
 // Ping checks the database connection with retry logic.
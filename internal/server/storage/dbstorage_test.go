@@ -3,16 +3,22 @@ package storage_test
 import (
 	"context"
 	"errors"
+	"strconv"
 	"testing"
+	"time"
 
+	"github.com/jackc/pgerrcode"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/pashagolub/pgxmock/v4"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	"github.com/npavlov/go-metrics-service/internal/domain"
+	"github.com/npavlov/go-metrics-service/internal/model"
 	"github.com/npavlov/go-metrics-service/internal/server/db"
 	"github.com/npavlov/go-metrics-service/internal/server/storage"
+	"github.com/npavlov/go-metrics-service/internal/server/tenant"
 	testutils "github.com/npavlov/go-metrics-service/internal/test_utils"
 )
 
@@ -27,11 +33,11 @@ func TestDBStorage_GetAll(t *testing.T) {
 	ctx := context.Background()
 
 	// Mocking expected rows for the GetAll query
-	rows := pgxmock.NewRows([]string{"id", "type", "delta", "value"}).
-		AddRow(domain.MetricName("metric1"), domain.MetricType("counter"), int64Ptr(10), nil).
-		AddRow(domain.MetricName("metric2"), domain.MetricType("gauge"), nil, float64Ptr(3.14))
+	rows := pgxmock.NewRows([]string{"id", "type", "updated_at", "delta", "value", "histogram", "summary", "name", "labels"}).
+		AddRow(domain.MetricName("metric1"), domain.MetricType("counter"), nil, int64Ptr(10), nil, nil, nil, nil, nil).
+		AddRow(domain.MetricName("metric2"), domain.MetricType("gauge"), nil, nil, float64Ptr(3.14), nil, nil, nil, nil)
 
-	mock.ExpectQuery(`SELECT .* FROM mtr_metrics`).WillReturnRows(rows)
+	mock.ExpectQuery(`SELECT .* FROM mtr_metrics`).WithArgs(domain.DefaultTenant).WillReturnRows(rows)
 
 	metrics := dbStorage.GetAll(ctx)
 
@@ -50,18 +56,21 @@ func TestDBStorage_Get(t *testing.T) {
 	ctx := context.Background()
 	name := domain.MetricName("metric1")
 
+	updatedAt := time.Now()
+
 	// Mocking expected rows for the Get query
-	row := pgxmock.NewRows([]string{"id", "type", "delta", "value"}).
-		AddRow(domain.MetricName("metric1"), domain.MetricType("counter"), int64Ptr(10), nil)
+	row := pgxmock.NewRows([]string{"id", "type", "updated_at", "delta", "value", "histogram", "summary", "name", "labels"}).
+		AddRow(domain.MetricName("metric1"), domain.MetricType("counter"), &updatedAt, int64Ptr(10), nil, nil, nil, nil, nil)
 
 	mock.ExpectQuery("SELECT .* FROM mtr_metrics").
-		WithArgs(name).
+		WithArgs(domain.DefaultTenant, name).
 		WillReturnRows(row)
 
 	metric, found := dbStorage.Get(ctx, name)
 	require.True(t, found)
 	assert.Equal(t, domain.MetricName("metric1"), metric.ID)
 	assert.Equal(t, int64(10), *metric.Delta)
+	assert.Equal(t, &updatedAt, metric.UpdatedAt)
 }
 
 func TestDBStorage_GetNotFound(t *testing.T) {
@@ -75,7 +84,7 @@ func TestDBStorage_GetNotFound(t *testing.T) {
 
 	// Expect no rows in result
 	mock.ExpectQuery("SELECT .* FROM mtr_metrics").
-		WithArgs(name).
+		WithArgs(domain.DefaultTenant, name).
 		WillReturnError(pgx.ErrNoRows)
 
 	metric, found := dbStorage.Get(ctx, name)
@@ -93,9 +102,20 @@ func TestDBStorage_Update(t *testing.T) {
 	metric := db.NewMetric("metric1", domain.Gauge, nil, float64Ptr(200))
 
 	// Mocking an update operation
+	mock.ExpectBegin()
 	mock.ExpectExec("UPDATE gauge_metrics SET").
-		WithArgs(metric.ID, metric.Value).
+		WithArgs(domain.DefaultTenant, metric.ID, metric.Value).
 		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectExec("UPDATE mtr_metrics SET updated_at").
+		WithArgs(domain.DefaultTenant, metric.ID).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectExec("INSERT INTO gauge_samples").
+		WithArgs(domain.DefaultTenant, metric.ID, metric.Value).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mock.ExpectExec("DELETE FROM gauge_samples").
+		WithArgs(domain.DefaultTenant, pgxmock.AnyArg(), []string{string(metric.ID)}).
+		WillReturnResult(pgxmock.NewResult("DELETE", 0))
+	mock.ExpectCommit()
 
 	err := dbStorage.Update(ctx, metric)
 	require.NoError(t, err)
@@ -103,9 +123,20 @@ func TestDBStorage_Update(t *testing.T) {
 	metric2 := db.NewMetric("metric2", domain.Counter, int64Ptr(100), nil)
 
 	// Mocking an update operation
+	mock.ExpectBegin()
 	mock.ExpectExec("UPDATE counter_metrics SET").
-		WithArgs(metric2.ID, metric2.Delta).
+		WithArgs(domain.DefaultTenant, metric2.ID, metric2.Delta).
 		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectExec("UPDATE mtr_metrics SET updated_at").
+		WithArgs(domain.DefaultTenant, metric2.ID).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectExec("INSERT INTO counter_samples").
+		WithArgs(domain.DefaultTenant, metric2.ID, metric2.Delta).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mock.ExpectExec("DELETE FROM counter_samples").
+		WithArgs(domain.DefaultTenant, pgxmock.AnyArg(), []string{string(metric2.ID)}).
+		WillReturnResult(pgxmock.NewResult("DELETE", 0))
+	mock.ExpectCommit()
 
 	err = dbStorage.Update(ctx, metric2)
 	assert.NoError(t, err)
@@ -124,11 +155,17 @@ func TestDBStorage_CreateGauge(t *testing.T) {
 	mock.ExpectBegin()
 
 	mock.ExpectExec("INSERT INTO mtr_metrics").
-		WithArgs(metric.ID, metric.MType).
+		WithArgs(domain.DefaultTenant, metric.ID, metric.MType).
 		WillReturnResult(pgxmock.NewResult("INSERT", 1))
 	mock.ExpectExec("INSERT INTO gauge_metrics").
-		WithArgs(metric.ID, metric.Value).
+		WithArgs(domain.DefaultTenant, metric.ID, metric.Value).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mock.ExpectExec("INSERT INTO gauge_samples").
+		WithArgs(domain.DefaultTenant, metric.ID, metric.Value).
 		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mock.ExpectExec("DELETE FROM gauge_samples").
+		WithArgs(domain.DefaultTenant, pgxmock.AnyArg(), []string{string(metric.ID)}).
+		WillReturnResult(pgxmock.NewResult("DELETE", 0))
 
 	mock.ExpectCommit()
 
@@ -136,6 +173,96 @@ func TestDBStorage_CreateGauge(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestDBStorage_CreateLabeled(t *testing.T) {
+	t.Parallel()
+
+	dbStorage, mock := testutils.SetupDBStorage(t)
+	defer mock.Close()
+
+	ctx := context.Background()
+	metric := db.NewMetric("CPUutilization", domain.Gauge, nil, float64Ptr(10)).
+		WithLabels(domain.Labels{"cpu": "0"})
+	seriesID := domain.MetricName(`CPUutilization{cpu="0"}`)
+
+	mock.ExpectBegin()
+
+	mock.ExpectExec("INSERT INTO mtr_metrics").
+		WithArgs(domain.DefaultTenant, seriesID, metric.MType).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mock.ExpectExec("INSERT INTO metric_labels").
+		WithArgs(domain.DefaultTenant, seriesID, &metric.ID, metric.Labels).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mock.ExpectExec("INSERT INTO gauge_metrics").
+		WithArgs(domain.DefaultTenant, seriesID, metric.Value).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mock.ExpectExec("INSERT INTO gauge_samples").
+		WithArgs(domain.DefaultTenant, seriesID, metric.Value).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mock.ExpectExec("DELETE FROM gauge_samples").
+		WithArgs(domain.DefaultTenant, pgxmock.AnyArg(), []string{string(seriesID)}).
+		WillReturnResult(pgxmock.NewResult("DELETE", 0))
+
+	mock.ExpectCommit()
+
+	err := dbStorage.Create(ctx, metric)
+	require.NoError(t, err)
+
+	// The stored series is read back with its name and labels
+	name := domain.MetricName("CPUutilization")
+	mock.ExpectQuery("SELECT .* FROM mtr_metrics").
+		WithArgs(domain.DefaultTenant, seriesID).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "type", "updated_at", "delta", "value", "histogram", "summary", "name", "labels"}).
+			AddRow(seriesID, domain.Gauge, nil, nil, float64Ptr(10), nil, nil, &name, domain.Labels{"cpu": "0"}))
+
+	stored, found := dbStorage.Get(ctx, seriesID)
+	require.True(t, found)
+	assert.Equal(t, name, stored.ID)
+	assert.Equal(t, domain.Labels{"cpu": "0"}, stored.Labels)
+	assert.Equal(t, seriesID, stored.SeriesID())
+}
+
+func TestDBStorage_CreateHistogram(t *testing.T) {
+	t.Parallel()
+
+	dbStorage, mock := testutils.SetupDBStorage(t)
+	defer mock.Close()
+
+	ctx := context.Background()
+	histogram := domain.NewHistogram([]float64{1})
+	histogram.Observe(0.5)
+	metric := db.NewHistogramMetric("PauseNs", histogram)
+
+	// Distributions have no samples
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO mtr_metrics").
+		WithArgs(domain.DefaultTenant, metric.ID, metric.MType).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mock.ExpectExec("INSERT INTO histogram_metrics").
+		WithArgs(domain.DefaultTenant, metric.ID, metric.Histogram).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mock.ExpectCommit()
+
+	err := dbStorage.Create(ctx, metric)
+	require.NoError(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+
+	// Update of a summary replaces the stored one
+	summary := db.NewSummaryMetric("ReportLatency", domain.NewSummary([]float64{0.5}, []float64{1}))
+
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE summary_metrics SET").
+		WithArgs(domain.DefaultTenant, summary.ID, summary.Summary).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectExec("UPDATE mtr_metrics SET updated_at").
+		WithArgs(domain.DefaultTenant, summary.ID).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectCommit()
+
+	err = dbStorage.Update(ctx, summary)
+	require.NoError(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
 func TestDBStorage_CreateCounter(t *testing.T) {
 	t.Parallel()
 
@@ -149,11 +276,17 @@ func TestDBStorage_CreateCounter(t *testing.T) {
 	mock.ExpectBegin()
 
 	mock.ExpectExec("INSERT INTO mtr_metrics").
-		WithArgs(metric.ID, metric.MType).
+		WithArgs(domain.DefaultTenant, metric.ID, metric.MType).
 		WillReturnResult(pgxmock.NewResult("INSERT", 1))
 	mock.ExpectExec("INSERT INTO counter_metrics").
-		WithArgs(metric.ID, metric.Delta).
+		WithArgs(domain.DefaultTenant, metric.ID, metric.Delta).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mock.ExpectExec("INSERT INTO counter_samples").
+		WithArgs(domain.DefaultTenant, metric.ID, metric.Delta).
 		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mock.ExpectExec("DELETE FROM counter_samples").
+		WithArgs(domain.DefaultTenant, pgxmock.AnyArg(), []string{string(metric.ID)}).
+		WillReturnResult(pgxmock.NewResult("DELETE", 0))
 
 	mock.ExpectCommit()
 
@@ -169,37 +302,243 @@ func TestDBStorage_UpdateMany(t *testing.T) {
 
 	ctx := context.Background()
 	metrics := []db.Metric{
-		*db.NewMetric("metric1", domain.Gauge, nil, float64Ptr(10.5)),
-		*db.NewMetric("metric2", domain.Gauge, int64Ptr(5), nil),
+		*db.NewMetric("metric2", domain.Gauge, nil, float64Ptr(1)),
+		*db.NewMetric("metric1", domain.Counter, int64Ptr(5), nil).WithLabels(domain.Labels{"host": "a"}),
+		*db.NewMetric("metric2", domain.Gauge, nil, float64Ptr(10.5)),
 	}
+	labeledID := string(metrics[1].SeriesID())
 
-	// Mocking a transaction with upserts
+	// Mocking a transaction with one batch of set-based statements, the last write of a series wins
 	mock.ExpectBegin()
+	batch := mock.ExpectBatch()
+	batch.ExpectExec("INSERT INTO mtr_metrics").
+		WithArgs("default", []string{labeledID, "metric2"}, []string{"counter", "gauge"}).
+		WillReturnResult(pgxmock.NewResult("INSERT", 2))
+	batch.ExpectExec("INSERT INTO metric_labels").
+		WithArgs("default", []string{labeledID}, []string{"metric1"}, []string{`{"host":"a"}`}).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	batch.ExpectExec("INSERT INTO counter_metrics").
+		WithArgs("default", []string{labeledID}, []int64{5}).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	batch.ExpectExec("INSERT INTO counter_samples").
+		WithArgs("default", []string{labeledID}, []int64{5}).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	batch.ExpectExec("DELETE FROM counter_samples").
+		WithArgs("default", pgxmock.AnyArg(), []string{labeledID}).
+		WillReturnResult(pgxmock.NewResult("DELETE", 0))
+	batch.ExpectExec("INSERT INTO gauge_metrics").
+		WithArgs("default", []string{"metric2"}, []float64{10.5}).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	// every write keeps its sample
+	batch.ExpectExec("INSERT INTO gauge_samples").
+		WithArgs("default", []string{"metric2", "metric2"}, []float64{1, 10.5}).
+		WillReturnResult(pgxmock.NewResult("INSERT", 2))
+	batch.ExpectExec("DELETE FROM gauge_samples").
+		WithArgs("default", pgxmock.AnyArg(), []string{"metric2"}).
+		WillReturnResult(pgxmock.NewResult("DELETE", 0))
+	mock.ExpectCommit()
 
-	key1, key2 := storage.KeyNameAsHash64("update_many")
+	err := dbStorage.UpdateMany(ctx, &metrics)
+	require.NoError(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
 
-	mock.ExpectExec("SELECT pg_advisory_xact_lock").WithArgs(key1, key2).
-		WillReturnResult(pgxmock.NewResult("SELECT", 0))
+func TestDBStorage_UpdateManyRetry(t *testing.T) {
+	t.Parallel()
+
+	dbStorage, mock := testutils.SetupDBStorage(t)
+	defer mock.Close()
 
-	for _, metric := range metrics {
-		mock.ExpectExec("INSERT INTO mtr_metrics").
-			WithArgs(metric.ID, metric.MType).
+	metrics := []db.Metric{*db.NewMetric("metric1", domain.Gauge, nil, float64Ptr(1))}
+	expectWrite := func(err error) {
+		mock.ExpectBegin()
+		batch := mock.ExpectBatch()
+		batch.ExpectExec("INSERT INTO mtr_metrics").
+			WithArgs("default", []string{"metric1"}, []string{"gauge"}).
 			WillReturnResult(pgxmock.NewResult("INSERT", 1))
-		switch metric.MType {
-		case domain.Counter:
-			mock.ExpectExec("INSERT INTO counter_metrics").
-				WithArgs(metric.ID, metric.Delta).
-				WillReturnResult(pgxmock.NewResult("INSERT", 1))
-		case domain.Gauge:
-			mock.ExpectExec("INSERT INTO gauge_metrics").
-				WithArgs(metric.ID, metric.Value).
-				WillReturnResult(pgxmock.NewResult("INSERT", 1))
+		batch.ExpectExec("INSERT INTO gauge_metrics").
+			WithArgs("default", []string{"metric1"}, []float64{1}).
+			WillReturnResult(pgxmock.NewResult("INSERT", 1))
+		batch.ExpectExec("INSERT INTO gauge_samples").
+			WithArgs("default", []string{"metric1"}, []float64{1}).
+			WillReturnResult(pgxmock.NewResult("INSERT", 1))
+		if err != nil {
+			batch.ExpectExec("DELETE FROM gauge_samples").
+				WithArgs("default", pgxmock.AnyArg(), []string{"metric1"}).
+				WillReturnError(err)
+			mock.ExpectRollback()
+
+			return
 		}
+		batch.ExpectExec("DELETE FROM gauge_samples").
+			WithArgs("default", pgxmock.AnyArg(), []string{"metric1"}).
+			WillReturnResult(pgxmock.NewResult("DELETE", 0))
+		mock.ExpectCommit()
+	}
+
+	// the failed attempt is sent again in full on a new transaction
+	//nolint:exhaustruct
+	expectWrite(&pgconn.PgError{Code: pgerrcode.ConnectionFailure})
+	expectWrite(nil)
+
+	err := dbStorage.UpdateMany(context.Background(), &metrics)
+	require.NoError(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDBStorage_UpdateManyDistributions(t *testing.T) {
+	t.Parallel()
+
+	dbStorage, mock := testutils.SetupDBStorage(t)
+	defer mock.Close()
+
+	histogram := domain.NewHistogram([]float64{1})
+	histogram.Observe(0.5)
+	metrics := []db.Metric{
+		*db.NewHistogramMetric("latency", histogram),
+		*db.NewSummaryMetric("duration", domain.NewSummary([]float64{0.5}, []float64{2})),
 	}
+
+	mock.ExpectBegin()
+	batch := mock.ExpectBatch()
+	batch.ExpectExec("INSERT INTO mtr_metrics").
+		WithArgs("default", []string{"duration", "latency"}, []string{"summary", "histogram"}).
+		WillReturnResult(pgxmock.NewResult("INSERT", 2))
+	batch.ExpectExec("INSERT INTO histogram_metrics").
+		WithArgs("default", []string{"latency"}, []string{`{"bounds":[1],"counts":[1,0],"sum":0.5,"count":1}`}).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	batch.ExpectExec("INSERT INTO summary_metrics").
+		WithArgs("default", []string{"duration"}, []string{`{"quantiles":[{"quantile":0.5,"value":2}],"sum":2,"count":1}`}).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
 	mock.ExpectCommit()
 
-	err := dbStorage.UpdateMany(ctx, &metrics)
-	assert.NoError(t, err)
+	require.NoError(t, dbStorage.UpdateMany(context.Background(), &metrics))
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDBStorage_ApplyDeltas(t *testing.T) {
+	t.Parallel()
+
+	dbStorage, mock := testutils.SetupDBStorage(t)
+	defer mock.Close()
+
+	stored := domain.NewHistogram([]float64{1})
+	stored.Observe(0.5)
+	received := domain.NewHistogram([]float64{1})
+	received.Observe(2)
+	metrics := []db.Metric{
+		*db.NewMetric("counter", domain.Counter, int64Ptr(2), nil),
+		*db.NewHistogramMetric("latency", received),
+		*db.NewMetric("counter", domain.Counter, int64Ptr(3), nil),
+	}
+
+	mock.ExpectBegin()
+	batch := mock.ExpectBatch()
+	batch.ExpectExec("INSERT INTO mtr_metrics").
+		WithArgs("default", []string{"counter", "latency"}, []string{"counter", "histogram"}).
+		WillReturnResult(pgxmock.NewResult("INSERT", 2))
+	// the distributions are locked and merged with the stored ones
+	mock.ExpectQuery("SELECT .* FROM mtr_metrics .* FOR UPDATE").
+		WithArgs(domain.DefaultTenant, []string{"latency"}).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "histogram", "summary"}).
+			AddRow(domain.MetricName("latency"), stored, nil))
+	// the counter is incremented by the database with the sum of its deltas
+	batch = mock.ExpectBatch()
+	batch.ExpectExec("INSERT INTO counter_metrics .* counter_metrics.delta \\+ EXCLUDED.delta").
+		WithArgs("default", []string{"counter"}, []int64{5}).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	batch.ExpectExec("INSERT INTO counter_samples").
+		WithArgs("default", []string{"counter"}).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	batch.ExpectExec("DELETE FROM counter_samples").
+		WithArgs("default", pgxmock.AnyArg(), []string{"counter"}).
+		WillReturnResult(pgxmock.NewResult("DELETE", 0))
+	batch.ExpectExec("INSERT INTO histogram_metrics").
+		WithArgs("default", []string{"latency"}, []string{`{"bounds":[1],"counts":[1,1],"sum":2.5,"count":2}`}).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mock.ExpectQuery("SELECT .* FROM mtr_metrics").
+		WithArgs(domain.DefaultTenant, []string{"counter", "latency"}).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "type", "updated_at", "delta", "value", "histogram", "summary", "name", "labels"}).
+			AddRow(domain.MetricName("counter"), domain.Counter, nil, int64Ptr(15), nil, nil, nil, nil, nil))
+	mock.ExpectCommit()
+
+	applied, err := dbStorage.ApplyDeltas(context.Background(), metrics)
+	require.NoError(t, err)
+	require.Len(t, applied, 1)
+	assert.Equal(t, int64(15), *applied[0].Delta)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDBStorage_ApplyBatch(t *testing.T) {
+	t.Parallel()
+
+	dbStorage, mock := testutils.SetupDBStorage(t)
+	defer mock.Close()
+
+	mock.ExpectBegin()
+	batch := mock.ExpectBatch()
+	batch.ExpectExec("INSERT INTO mtr_metrics").
+		WithArgs("default", []string{"temperature"}, []string{"gauge"}).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	batch.ExpectExec("INSERT INTO gauge_metrics").
+		WithArgs("default", []string{"temperature"}, []float64{21}).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	batch.ExpectExec("INSERT INTO gauge_samples").
+		WithArgs("default", []string{"temperature"}, []float64{21}).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	batch.ExpectExec("DELETE FROM gauge_samples").
+		WithArgs("default", pgxmock.AnyArg(), []string{"temperature"}).
+		WillReturnResult(pgxmock.NewResult("DELETE", 0))
+	// the changes of a gauge are summed and added by the database
+	batch = mock.ExpectBatch()
+	batch.ExpectExec("INSERT INTO mtr_metrics").
+		WithArgs("default", []string{"queue"}, []string{"gauge"}).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	batch.ExpectExec("INSERT INTO gauge_metrics .* gauge_metrics.value \\+ EXCLUDED.value").
+		WithArgs("default", []string{"queue"}, []float64{1.5}).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	batch.ExpectExec("INSERT INTO gauge_samples").
+		WithArgs("default", []string{"queue"}).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	batch.ExpectExec("DELETE FROM gauge_samples").
+		WithArgs("default", pgxmock.AnyArg(), []string{"queue"}).
+		WillReturnResult(pgxmock.NewResult("DELETE", 0))
+	mock.ExpectQuery("SELECT .* FROM mtr_metrics").
+		WithArgs(domain.DefaultTenant, []string{"queue"}).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "type", "updated_at", "delta", "value", "histogram", "summary", "name", "labels"}).
+			AddRow(domain.MetricName("queue"), domain.Gauge, nil, nil, float64Ptr(5.5), nil, nil, nil, nil))
+	mock.ExpectCommit()
+
+	err := dbStorage.ApplyBatch(context.Background(), &model.Batch{
+		Values: []db.Metric{*db.NewMetric("temperature", domain.Gauge, nil, float64Ptr(21))},
+		Deltas: nil,
+		Changes: []db.Metric{
+			*db.NewMetric("queue", domain.Gauge, nil, float64Ptr(2)),
+			*db.NewMetric("queue", domain.Gauge, nil, float64Ptr(-0.5)),
+		},
+	})
+	require.NoError(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+
+	// a change must be a gauge
+	err = dbStorage.ApplyBatch(context.Background(), &model.Batch{
+		Values:  nil,
+		Deltas:  nil,
+		Changes: []db.Metric{*db.NewMetric("requests", domain.Counter, int64Ptr(1), nil)},
+	})
+	require.Error(t, err)
+}
+
+func TestDBStorage_UpdateManyNoValue(t *testing.T) {
+	t.Parallel()
+
+	dbStorage, mock := testutils.SetupDBStorage(t)
+	defer mock.Close()
+
+	metrics := []db.Metric{*db.NewMetric("metric1", domain.Counter, nil, float64Ptr(1))}
+
+	require.Error(t, dbStorage.UpdateMany(context.Background(), &metrics))
+	require.NoError(t, mock.ExpectationsWereMet())
 }
 
 func TestDBStorage_Ping(t *testing.T) {
@@ -227,11 +566,11 @@ func TestDBStorage_GetMany_Success(t *testing.T) {
 	names := []domain.MetricName{"metric1", "metric2"}
 
 	// Mock expected rows for the successful retrieval
-	rows := pgxmock.NewRows([]string{"id", "type", "delta", "value"}).
-		AddRow(domain.MetricName("metric1"), domain.MetricType("counter"), int64Ptr(10), nil).
-		AddRow(domain.MetricName("metric2"), domain.MetricType("gauge"), nil, float64Ptr(3.14))
+	rows := pgxmock.NewRows([]string{"id", "type", "updated_at", "delta", "value", "histogram", "summary", "name", "labels"}).
+		AddRow(domain.MetricName("metric1"), domain.MetricType("counter"), nil, int64Ptr(10), nil, nil, nil, nil, nil).
+		AddRow(domain.MetricName("metric2"), domain.MetricType("gauge"), nil, nil, float64Ptr(3.14), nil, nil, nil, nil)
 	mock.ExpectQuery("SELECT .* FROM mtr_metrics").
-		WithArgs([]string{"metric1", "metric2"}).
+		WithArgs(domain.DefaultTenant, []string{"metric1", "metric2"}).
 		WillReturnRows(rows)
 
 	metrics, err := dbStorage.GetMany(ctx, names)
@@ -252,8 +591,8 @@ func TestDBStorage_GetMany_NoMetricsFound(t *testing.T) {
 
 	// Mock expected empty result set for unknown metrics
 	mock.ExpectQuery("SELECT .* FROM mtr_metrics").
-		WithArgs([]string{"unknown_metric1", "unknown_metric2"}).
-		WillReturnRows(pgxmock.NewRows([]string{"id", "type", "delta", "value"}))
+		WithArgs(domain.DefaultTenant, []string{"unknown_metric1", "unknown_metric2"}).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "type", "updated_at", "delta", "value", "histogram", "summary", "name", "labels"}))
 
 	metrics, err := dbStorage.GetMany(ctx, names)
 	require.NoError(t, err)
@@ -270,10 +609,10 @@ func TestDBStorage_GetMany_PartialMetricsFound(t *testing.T) {
 	names := []domain.MetricName{"metric1", "unknown_metric"}
 
 	// Mock expected rows where only one metric is found
-	rows := pgxmock.NewRows([]string{"id", "type", "delta", "value"}).
-		AddRow(domain.MetricName("metric1"), domain.MetricType("counter"), int64Ptr(10), nil)
+	rows := pgxmock.NewRows([]string{"id", "type", "updated_at", "delta", "value", "histogram", "summary", "name", "labels"}).
+		AddRow(domain.MetricName("metric1"), domain.MetricType("counter"), nil, int64Ptr(10), nil, nil, nil, nil, nil)
 	mock.ExpectQuery("SELECT .* FROM mtr_metrics").
-		WithArgs([]string{"metric1", "unknown_metric"}).
+		WithArgs(domain.DefaultTenant, []string{"metric1", "unknown_metric"}).
 		WillReturnRows(rows)
 
 	metrics, err := dbStorage.GetMany(ctx, names)
@@ -293,7 +632,7 @@ func TestDBStorage_GetMany_DBError(t *testing.T) {
 
 	// Mock an error from the database
 	mock.ExpectQuery("SELECT .* FROM mtr_metrics").
-		WithArgs("metric_error").
+		WithArgs(domain.DefaultTenant, "metric_error").
 		WillReturnError(errPingError)
 
 	metrics, err := dbStorage.GetMany(ctx, names)
@@ -301,6 +640,155 @@ func TestDBStorage_GetMany_DBError(t *testing.T) {
 	assert.Nil(t, metrics)
 }
 
+func TestDBStorage_GetRange(t *testing.T) {
+	t.Parallel()
+
+	dbStorage, mock := testutils.SetupDBStorage(t)
+	defer mock.Close()
+
+	ctx := context.Background()
+	name := domain.MetricName("HeapAlloc")
+	from := time.Now().Add(-time.Hour)
+	to := time.Now()
+
+	mock.ExpectQuery("SELECT .* FROM mtr_metrics").
+		WithArgs(domain.DefaultTenant, name).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "type", "updated_at", "delta", "value", "histogram", "summary", "name", "labels"}).
+			AddRow(name, domain.Gauge, nil, nil, float64Ptr(3.5), nil, nil, nil, nil))
+	mock.ExpectQuery("SELECT .* FROM gauge_samples").
+		WithArgs(domain.DefaultTenant, name, from, to).
+		WillReturnRows(pgxmock.NewRows([]string{"metric_id", "value", "created_at"}).
+			AddRow(name, float64Ptr(1.5), from.Add(time.Minute)).
+			AddRow(name, float64Ptr(3.5), from.Add(2*time.Minute)))
+
+	samples, err := dbStorage.GetRange(ctx, name, domain.Gauge, from, to)
+	require.NoError(t, err)
+	require.Len(t, samples, 2)
+	assert.InDelta(t, 1.5, *samples[0].Value, 0.0001)
+	assert.Equal(t, from.Add(2*time.Minute), samples[1].Timestamp)
+	assert.Nil(t, samples[1].Delta)
+}
+
+func TestDBStorage_GetRangeUnknownMetric(t *testing.T) {
+	t.Parallel()
+
+	dbStorage, mock := testutils.SetupDBStorage(t)
+	defer mock.Close()
+
+	name := domain.MetricName("unknown_metric")
+
+	mock.ExpectQuery("SELECT .* FROM mtr_metrics").
+		WithArgs(domain.DefaultTenant, name).
+		WillReturnError(pgx.ErrNoRows)
+
+	samples, err := dbStorage.GetRange(context.Background(), name, domain.Gauge, time.Time{}, time.Now())
+	require.NoError(t, err)
+	assert.Empty(t, samples)
+}
+
+func TestDBStorage_GetRangeOtherType(t *testing.T) {
+	t.Parallel()
+
+	dbStorage, mock := testutils.SetupDBStorage(t)
+	defer mock.Close()
+
+	name := domain.MetricName("HeapAlloc")
+
+	// the samples of a gauge are not read for a counter
+	mock.ExpectQuery("SELECT .* FROM mtr_metrics").
+		WithArgs(domain.DefaultTenant, name).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "type", "updated_at", "delta", "value", "histogram", "summary", "name", "labels"}).
+			AddRow(name, domain.Gauge, nil, nil, float64Ptr(3.5), nil, nil, nil, nil))
+
+	samples, err := dbStorage.GetRange(context.Background(), name, domain.Counter, time.Time{}, time.Now())
+	require.NoError(t, err)
+	assert.Empty(t, samples)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDBStorage_Delete(t *testing.T) {
+	t.Parallel()
+
+	dbStorage, mock := testutils.SetupDBStorage(t)
+	defer mock.Close()
+
+	ctx := context.Background()
+
+	mock.ExpectExec("DELETE FROM mtr_metrics").
+		WithArgs(domain.DefaultTenant, domain.MetricName("metric1"), domain.Gauge).
+		WillReturnResult(pgxmock.NewResult("DELETE", 1))
+
+	deleted, err := dbStorage.Delete(ctx, "metric1", domain.Gauge)
+	require.NoError(t, err)
+	assert.True(t, deleted)
+
+	mock.ExpectExec("DELETE FROM mtr_metrics").
+		WithArgs(domain.DefaultTenant, domain.MetricName("unknown"), domain.Gauge).
+		WillReturnResult(pgxmock.NewResult("DELETE", 0))
+
+	deleted, err = dbStorage.Delete(ctx, "unknown", domain.Gauge)
+	require.NoError(t, err)
+	assert.False(t, deleted)
+}
+
+func TestDBStorage_DeleteMany(t *testing.T) {
+	t.Parallel()
+
+	dbStorage, mock := testutils.SetupDBStorage(t)
+	defer mock.Close()
+
+	mock.ExpectQuery("DELETE FROM mtr_metrics").
+		WithArgs(domain.DefaultTenant, []string{"metric1", "unknown"}).
+		WillReturnRows(pgxmock.NewRows([]string{"id"}).AddRow(domain.MetricName("metric1")))
+
+	names, err := dbStorage.DeleteMany(context.Background(), []domain.MetricName{"metric1", "unknown"})
+	require.NoError(t, err)
+	assert.Equal(t, []domain.MetricName{"metric1"}, names)
+}
+
+func TestDBStorage_DeleteStale(t *testing.T) {
+	t.Parallel()
+
+	dbStorage, mock := testutils.SetupDBStorage(t)
+	defer mock.Close()
+
+	before := time.Now().Add(-time.Hour)
+
+	mock.ExpectQuery("DELETE FROM mtr_metrics WHERE tenant = \\$1 AND updated_at").
+		WithArgs(domain.DefaultTenant, &before).
+		WillReturnRows(pgxmock.NewRows([]string{"id"}).AddRow(domain.MetricName("metric1")))
+
+	names, err := dbStorage.DeleteStale(context.Background(), before)
+	require.NoError(t, err)
+	assert.Equal(t, []domain.MetricName{"metric1"}, names)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDBStorage_Tenants(t *testing.T) {
+	t.Parallel()
+
+	dbStorage, mock := testutils.SetupDBStorage(t)
+	defer mock.Close()
+
+	ctx := tenant.WithTenant(context.Background(), "team-a")
+
+	mock.ExpectQuery("SELECT DISTINCT tenant FROM mtr_metrics").
+		WillReturnRows(pgxmock.NewRows([]string{"tenant"}).AddRow(domain.DefaultTenant).AddRow(domain.Tenant("team-a")))
+	mock.ExpectQuery("DELETE FROM mtr_metrics WHERE tenant = \\$1 AND id = ANY").
+		WithArgs(domain.Tenant("team-a"), []string{"metric1"}).
+		WillReturnRows(pgxmock.NewRows([]string{"id"}))
+
+	tenants, err := dbStorage.Tenants(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []domain.Tenant{domain.DefaultTenant, "team-a"}, tenants)
+
+	// the queries are scoped to the tenant of the context
+	names, err := dbStorage.DeleteMany(ctx, []domain.MetricName{"metric1"})
+	require.NoError(t, err)
+	assert.Empty(t, names)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
 func BenchmarkGetAll(b *testing.B) {
 	mockDB, err := pgxmock.NewPool()
 	if err != nil {
@@ -311,19 +799,19 @@ func BenchmarkGetAll(b *testing.B) {
 	dbStorage := storage.NewDBStorage(mockDB, log)
 
 	// Mocking expected rows for the GetAll query
-	rows := pgxmock.NewRows([]string{"id", "type", "delta", "value"}).
-		AddRow(domain.MetricName("metric1"), domain.MetricType("counter"), int64Ptr(10), nil).
-		AddRow(domain.MetricName("metric2"), domain.MetricType("gauge"), nil, float64Ptr(3.14)).
-		AddRow(domain.MetricName("metric3"), domain.MetricType("gauge"), nil, float64Ptr(6.77777)).
-		AddRow(domain.MetricName("metric4"), domain.MetricType("counter"), int64Ptr(10), nil).
-		AddRow(domain.MetricName("metric5"), domain.MetricType("gauge"), nil, float64Ptr(3.14)).
-		AddRow(domain.MetricName("metric6"), domain.MetricType("gauge"), nil, float64Ptr(6.77777)).
-		AddRow(domain.MetricName("metric7"), domain.MetricType("counter"), int64Ptr(10), nil).
-		AddRow(domain.MetricName("metric8"), domain.MetricType("gauge"), nil, float64Ptr(3.14)).
-		AddRow(domain.MetricName("metric9"), domain.MetricType("gauge"), nil, float64Ptr(6.77777)).
-		AddRow(domain.MetricName("metric10"), domain.MetricType("counter"), int64Ptr(10), nil).
-		AddRow(domain.MetricName("metric11"), domain.MetricType("gauge"), nil, float64Ptr(3.14)).
-		AddRow(domain.MetricName("metric12"), domain.MetricType("gauge"), nil, float64Ptr(6.77777))
+	rows := pgxmock.NewRows([]string{"id", "type", "updated_at", "delta", "value", "histogram", "summary", "name", "labels"}).
+		AddRow(domain.MetricName("metric1"), domain.MetricType("counter"), nil, int64Ptr(10), nil, nil, nil, nil, nil).
+		AddRow(domain.MetricName("metric2"), domain.MetricType("gauge"), nil, nil, float64Ptr(3.14), nil, nil, nil, nil).
+		AddRow(domain.MetricName("metric3"), domain.MetricType("gauge"), nil, nil, float64Ptr(6.77777), nil, nil, nil, nil).
+		AddRow(domain.MetricName("metric4"), domain.MetricType("counter"), nil, int64Ptr(10), nil, nil, nil, nil, nil).
+		AddRow(domain.MetricName("metric5"), domain.MetricType("gauge"), nil, nil, float64Ptr(3.14), nil, nil, nil, nil).
+		AddRow(domain.MetricName("metric6"), domain.MetricType("gauge"), nil, nil, float64Ptr(6.77777), nil, nil, nil, nil).
+		AddRow(domain.MetricName("metric7"), domain.MetricType("counter"), nil, int64Ptr(10), nil, nil, nil, nil, nil).
+		AddRow(domain.MetricName("metric8"), domain.MetricType("gauge"), nil, nil, float64Ptr(3.14), nil, nil, nil, nil).
+		AddRow(domain.MetricName("metric9"), domain.MetricType("gauge"), nil, nil, float64Ptr(6.77777), nil, nil, nil, nil).
+		AddRow(domain.MetricName("metric10"), domain.MetricType("counter"), nil, int64Ptr(10), nil, nil, nil, nil, nil).
+		AddRow(domain.MetricName("metric11"), domain.MetricType("gauge"), nil, nil, float64Ptr(3.14), nil, nil, nil, nil).
+		AddRow(domain.MetricName("metric12"), domain.MetricType("gauge"), nil, nil, float64Ptr(6.77777), nil, nil, nil, nil)
 
 	b.ResetTimer()
 	for range b.N {
@@ -332,6 +820,39 @@ func BenchmarkGetAll(b *testing.B) {
 	}
 }
 
+func BenchmarkUpdateMany(b *testing.B) {
+	mockDB, err := pgxmock.NewPool()
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	dbStorage := storage.NewDBStorage(mockDB, testutils.GetTLogger())
+
+	// a typical agent batch of 200 metrics
+	metrics := make([]db.Metric, 0, 200)
+	for i := range 100 {
+		metrics = append(metrics,
+			*db.NewMetric(domain.MetricName("gauge"+strconv.Itoa(i)), domain.Gauge, nil, float64Ptr(float64(i))),
+			*db.NewMetric(domain.MetricName("counter"+strconv.Itoa(i)), domain.Counter, int64Ptr(int64(i)), nil))
+	}
+
+	b.ResetTimer()
+	for range b.N {
+		mockDB.ExpectBegin()
+		batch := mockDB.ExpectBatch()
+		for _, table := range []string{"mtr_metrics", "counter_metrics", "counter_samples", "gauge_metrics", "gauge_samples"} {
+			batch.ExpectExec("INSERT INTO "+table).
+				WithArgs("default", pgxmock.AnyArg(), pgxmock.AnyArg()).
+				WillReturnResult(pgxmock.NewResult("INSERT", 100))
+		}
+		mockDB.ExpectCommit()
+
+		if err := dbStorage.UpdateMany(context.Background(), &metrics); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
 // Helper function to create float64 pointers.
 func float64Ptr(v float64) *float64 {
 	return &v
@@ -0,0 +1,557 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/npavlov/go-metrics-service/internal/domain"
+	"github.com/npavlov/go-metrics-service/internal/model"
+	"github.com/npavlov/go-metrics-service/internal/server/db"
+	"github.com/npavlov/go-metrics-service/internal/server/db/sqlitedb"
+	"github.com/npavlov/go-metrics-service/internal/server/hub"
+	"github.com/npavlov/go-metrics-service/internal/server/tenant"
+)
+
+// SQLiteStorage keeps the metrics in an embedded SQLite database, the tables mirror the PostgreSQL schema.
+type SQLiteStorage struct {
+	Queries *sqlitedb.Queries
+	log     *zerolog.Logger
+	dbCon   *sql.DB
+	hub     *hub.Hub
+}
+
+// NewSQLiteStorage initializes a new SQLiteStorage instance.
+func NewSQLiteStorage(dbCon *sql.DB, log *zerolog.Logger) *SQLiteStorage {
+	return &SQLiteStorage{
+		dbCon:   dbCon,
+		Queries: sqlitedb.New(dbCon),
+		log:     log,
+		hub:     nil,
+	}
+}
+
+// WithHub publishes every successful write to the given change hub.
+func (ss *SQLiteStorage) WithHub(changeHub *hub.Hub) *SQLiteStorage {
+	ss.hub = changeHub
+
+	return ss
+}
+
+// GetAll retrieves all metrics from the database.
+func (ss *SQLiteStorage) GetAll(ctx context.Context) map[domain.MetricName]*db.Metric {
+	results, err := ss.Queries.GetAllMetrics(ctx, tenant.FromContext(ctx))
+	if err != nil {
+		ss.log.Error().Err(err).Msg("error getting metrics")
+
+		return nil
+	}
+
+	metrics := make(map[domain.MetricName]*db.Metric, len(results))
+	for _, m := range results {
+		metrics[m.ID] = fromRow(m.ID, m.Name, m.Labels, m.MType, unixTime(m.UpdatedAt), m.Delta, m.Value, m.Histogram, m.Summary)
+	}
+
+	return metrics
+}
+
+// Get retrieves a single metric by its name.
+func (ss *SQLiteStorage) Get(ctx context.Context, name domain.MetricName) (*db.Metric, bool) {
+	result, err := ss.Queries.GetUnifiedMetric(ctx, sqlitedb.GetUnifiedMetricParams{
+		Tenant: tenant.FromContext(ctx),
+		ID:     name,
+	})
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			ss.log.Error().Err(err).Msg("failed to retrieve metric")
+		}
+
+		return nil, false
+	}
+
+	return fromRow(
+		result.ID, result.Name, result.Labels, result.MType, unixTime(result.UpdatedAt), result.Delta, result.Value, result.Histogram, result.Summary,
+	), true
+}
+
+// GetMany retrieves multiple metrics based on their names.
+func (ss *SQLiteStorage) GetMany(ctx context.Context, names []domain.MetricName) (map[domain.MetricName]db.Metric, error) {
+	metrics := make(map[domain.MetricName]db.Metric)
+	if len(names) == 0 {
+		return metrics, nil
+	}
+
+	results, err := ss.Queries.GetManyMetrics(ctx, sqlitedb.GetManyMetricsParams{
+		Tenant: tenant.FromContext(ctx),
+		Ids:    names,
+	})
+	if err != nil {
+		ss.log.Error().Err(err).Msg("error getting multiple metrics")
+
+		return nil, errors.Wrap(err, "error getting multiple metrics")
+	}
+
+	for _, m := range results {
+		metrics[m.ID] = *fromRow(m.ID, m.Name, m.Labels, m.MType, unixTime(m.UpdatedAt), m.Delta, m.Value, m.Histogram, m.Summary)
+	}
+
+	return metrics, nil
+}
+
+// Update stores the new value of a metric.
+func (ss *SQLiteStorage) Update(ctx context.Context, metric *db.Metric) error {
+	return ss.Create(ctx, metric)
+}
+
+// Create inserts a new metric into the database, an existing metric takes the new value.
+func (ss *SQLiteStorage) Create(ctx context.Context, metric *db.Metric) error {
+	if !metric.HasValue() {
+		return errors.New(errNoValue)
+	}
+
+	owner := tenant.FromContext(ctx)
+
+	err := ss.withTx(ctx, func(query *sqlitedb.Queries) error {
+		return ss.upsert(ctx, query, owner, metric, time.Now())
+	})
+	if err != nil {
+		return err
+	}
+
+	ss.hub.PublishUpdates(owner, *metric)
+
+	return nil
+}
+
+// UpdateMany stores multiple metrics in one transaction.
+func (ss *SQLiteStorage) UpdateMany(ctx context.Context, metrics *[]db.Metric) error {
+	now := time.Now()
+	owner := tenant.FromContext(ctx)
+
+	err := ss.withTx(ctx, func(query *sqlitedb.Queries) error {
+		for _, metric := range *metrics {
+			if err := ss.upsert(ctx, query, owner, &metric, now); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		ss.log.Error().Err(err).Msg("error in UpdateMany")
+
+		return err
+	}
+
+	ss.hub.PublishUpdates(owner, *metrics...)
+
+	return nil
+}
+
+// ApplyDeltas merges the metrics into the stored series in one transaction and returns the resulting series.
+// The single connection of the database runs one transaction at a time, so reading and merging is atomic.
+func (ss *SQLiteStorage) ApplyDeltas(ctx context.Context, metrics []db.Metric) ([]db.Metric, error) {
+	for _, metric := range metrics {
+		if !metric.HasValue() {
+			return nil, errors.New(errNoValue)
+		}
+	}
+
+	owner := tenant.FromContext(ctx)
+
+	var applied []db.Metric
+
+	err := ss.withTx(ctx, func(query *sqlitedb.Queries) error {
+		write := ss.stage(ctx, query, owner, len(metrics))
+		for _, metric := range metrics {
+			if err := write.merge(&metric); err != nil {
+				return err
+			}
+		}
+
+		var err error
+		applied, err = ss.storeStaged(ctx, query, owner, write)
+
+		return err
+	})
+	if err != nil {
+		ss.log.Error().Err(err).Msg("error in ApplyDeltas")
+
+		return nil, err
+	}
+
+	ss.hub.PublishUpdates(owner, applied...)
+
+	return applied, nil
+}
+
+// ApplyBatch writes the values, merges the deltas and adds the changes of the batch in one transaction,
+// see ApplyDeltas for its atomicity.
+func (ss *SQLiteStorage) ApplyBatch(ctx context.Context, batch *model.Batch) error {
+	if batch.Size() == 0 {
+		return nil
+	}
+
+	for _, metrics := range [][]db.Metric{batch.Values, batch.Deltas} {
+		for _, metric := range metrics {
+			if !metric.HasValue() {
+				return errors.New(errNoValue)
+			}
+		}
+	}
+
+	owner := tenant.FromContext(ctx)
+
+	var applied []db.Metric
+
+	err := ss.withTx(ctx, func(query *sqlitedb.Queries) error {
+		write := ss.stage(ctx, query, owner, batch.Size())
+		for _, metric := range batch.Values {
+			write.replace(&metric)
+		}
+
+		for _, metric := range batch.Deltas {
+			if err := write.merge(&metric); err != nil {
+				return err
+			}
+		}
+
+		for _, metric := range batch.Changes {
+			if err := write.add(&metric); err != nil {
+				return err
+			}
+		}
+
+		var err error
+		applied, err = ss.storeStaged(ctx, query, owner, write)
+
+		return err
+	})
+	if err != nil {
+		ss.log.Error().Err(err).Msg("error in ApplyBatch")
+
+		return err
+	}
+
+	ss.hub.PublishUpdates(owner, applied...)
+
+	return nil
+}
+
+// stage starts a write merged into the series of the tenant stored in the transaction.
+func (ss *SQLiteStorage) stage(
+	ctx context.Context,
+	query *sqlitedb.Queries,
+	owner domain.Tenant,
+	size int,
+) *stagedWrite {
+	return newStagedWrite(func(seriesID domain.MetricName) (*db.Metric, error) {
+		stored, err := query.GetUnifiedMetric(ctx, sqlitedb.GetUnifiedMetricParams{Tenant: owner, ID: seriesID})
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil //nolint:nilnil
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to retrieve metric")
+		}
+
+		return fromRow(
+			stored.ID, stored.Name, stored.Labels, stored.MType, unixTime(stored.UpdatedAt), stored.Delta, stored.Value, stored.Histogram, stored.Summary,
+		), nil
+	}, size)
+}
+
+// storeStaged stores the series of the write in the transaction and returns them.
+func (ss *SQLiteStorage) storeStaged(
+	ctx context.Context,
+	query *sqlitedb.Queries,
+	owner domain.Tenant,
+	write *stagedWrite,
+) ([]db.Metric, error) {
+	now := time.Now()
+	series := write.series()
+	applied := make([]db.Metric, 0, len(series))
+	for _, metric := range series {
+		if err := ss.upsert(ctx, query, owner, metric, now); err != nil {
+			return nil, err
+		}
+
+		metric.Touch(now)
+		applied = append(applied, *metric)
+	}
+
+	return applied, nil
+}
+
+// GetRange retrieves the samples of a metric of the given type accepted within [from, to], oldest first.
+func (ss *SQLiteStorage) GetRange(
+	ctx context.Context,
+	name domain.MetricName,
+	mType domain.MetricType,
+	from, to time.Time,
+) ([]db.Sample, error) {
+	samples := make([]db.Sample, 0)
+	owner := tenant.FromContext(ctx)
+
+	metric, err := ss.Queries.GetUnifiedMetric(ctx, sqlitedb.GetUnifiedMetricParams{Tenant: owner, ID: name})
+	if errors.Is(err, sql.ErrNoRows) {
+		return samples, nil
+	}
+	if err != nil {
+		ss.log.Error().Err(err).Msg("failed to retrieve metric")
+
+		return nil, errors.Wrap(err, "failed to retrieve metric")
+	}
+	if metric.MType != mType {
+		return samples, nil
+	}
+
+	switch metric.MType {
+	case domain.Gauge:
+		results, err := ss.Queries.GetGaugeRange(ctx, sqlitedb.GetGaugeRangeParams{
+			Tenant:   owner,
+			MetricID: name,
+			FromTime: from.UnixNano(),
+			ToTime:   to.UnixNano(),
+		})
+		if err != nil {
+			ss.log.Error().Err(err).Msg("error getting gauge samples")
+
+			return nil, errors.Wrap(err, "error getting gauge samples")
+		}
+
+		for _, result := range results {
+			samples = append(samples, db.Sample{Delta: nil, Value: result.Value, Timestamp: time.Unix(0, result.CreatedAt)})
+		}
+	case domain.Counter:
+		results, err := ss.Queries.GetCounterRange(ctx, sqlitedb.GetCounterRangeParams{
+			Tenant:   owner,
+			MetricID: name,
+			FromTime: from.UnixNano(),
+			ToTime:   to.UnixNano(),
+		})
+		if err != nil {
+			ss.log.Error().Err(err).Msg("error getting counter samples")
+
+			return nil, errors.Wrap(err, "error getting counter samples")
+		}
+
+		for _, result := range results {
+			samples = append(samples, db.Sample{Delta: result.Delta, Value: nil, Timestamp: time.Unix(0, result.CreatedAt)})
+		}
+	case domain.Histogram, domain.Summary:
+	}
+
+	return samples, nil
+}
+
+// Delete removes a metric of the given type, its values and samples are removed by cascade.
+func (ss *SQLiteStorage) Delete(ctx context.Context, name domain.MetricName, mType domain.MetricType) (bool, error) {
+	owner := tenant.FromContext(ctx)
+
+	deleted, err := ss.Queries.DeleteMetric(ctx, sqlitedb.DeleteMetricParams{Tenant: owner, ID: name, MType: mType})
+	if err != nil {
+		ss.log.Error().Err(err).Msg("error deleting metric")
+
+		return false, errors.Wrap(err, "error deleting metric")
+	}
+
+	if deleted > 0 {
+		ss.hub.PublishDeletes(owner, name)
+	}
+
+	return deleted > 0, nil
+}
+
+// DeleteMany removes multiple metrics, returns the names that existed.
+func (ss *SQLiteStorage) DeleteMany(ctx context.Context, names []domain.MetricName) ([]domain.MetricName, error) {
+	if len(names) == 0 {
+		return []domain.MetricName{}, nil
+	}
+
+	owner := tenant.FromContext(ctx)
+
+	deleted, err := ss.Queries.DeleteManyMetrics(ctx, sqlitedb.DeleteManyMetricsParams{Tenant: owner, Ids: names})
+	if err != nil {
+		ss.log.Error().Err(err).Msg("error deleting multiple metrics")
+
+		return nil, errors.Wrap(err, "error deleting multiple metrics")
+	}
+
+	if deleted == nil {
+		deleted = []domain.MetricName{}
+	}
+
+	ss.hub.PublishDeletes(owner, deleted...)
+
+	return deleted, nil
+}
+
+// DeleteStale removes the metrics last updated before the given time, returns the removed names.
+func (ss *SQLiteStorage) DeleteStale(ctx context.Context, before time.Time) ([]domain.MetricName, error) {
+	owner := tenant.FromContext(ctx)
+
+	deleted, err := ss.Queries.DeleteStaleMetrics(ctx, sqlitedb.DeleteStaleMetricsParams{
+		Tenant: owner,
+		Before: before.UnixNano(),
+	})
+	if err != nil {
+		ss.log.Error().Err(err).Msg("error deleting stale metrics")
+
+		return nil, errors.Wrap(err, "error deleting stale metrics")
+	}
+
+	if deleted == nil {
+		deleted = []domain.MetricName{}
+	}
+
+	ss.hub.PublishDeletes(owner, deleted...)
+
+	return deleted, nil
+}
+
+// Tenants returns the tenants that have metrics, sorted.
+func (ss *SQLiteStorage) Tenants(ctx context.Context) ([]domain.Tenant, error) {
+	tenants, err := ss.Queries.GetTenants(ctx)
+	if err != nil {
+		ss.log.Error().Err(err).Msg("error getting tenants")
+
+		return nil, errors.Wrap(err, "error getting tenants")
+	}
+
+	if tenants == nil {
+		tenants = []domain.Tenant{}
+	}
+
+	return tenants, nil
+}
+
+// Ping checks the database connection.
+func (ss *SQLiteStorage) Ping(ctx context.Context) error {
+	return errors.Wrap(ss.dbCon.PingContext(ctx), "failed to ping db")
+}
+
+// withTx runs the function in a transaction, the transaction is rolled back when it fails.
+func (ss *SQLiteStorage) withTx(ctx context.Context, fn func(query *sqlitedb.Queries) error) error {
+	tx, err := ss.dbCon.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "failed to start transaction")
+	}
+
+	if err := fn(ss.Queries.WithTx(tx)); err != nil {
+		_ = tx.Rollback()
+
+		return err
+	}
+
+	return errors.Wrap(tx.Commit(), "failed to commit transaction")
+}
+
+// upsert stores the series of the tenant, its labels, its value and a sample of the value.
+func (ss *SQLiteStorage) upsert(
+	ctx context.Context,
+	query *sqlitedb.Queries,
+	owner domain.Tenant,
+	metric *db.Metric,
+	now time.Time,
+) error {
+	err := query.InsertMtrMetric(ctx, sqlitedb.InsertMtrMetricParams{
+		Tenant:    owner,
+		ID:        metric.SeriesID(),
+		MType:     metric.MType,
+		UpdatedAt: now.UnixNano(),
+	})
+	if err != nil {
+		ss.log.Error().Err(err).Msg("failed to insert metric")
+
+		return errors.Wrap(err, "failed to insert metric")
+	}
+
+	if len(metric.Labels) > 0 {
+		err = query.InsertMetricLabels(ctx, sqlitedb.InsertMetricLabelsParams{
+			Tenant:   owner,
+			MetricID: metric.SeriesID(),
+			Name:     &metric.ID,
+			Labels:   metric.Labels,
+		})
+		if err != nil {
+			ss.log.Error().Err(err).Msg("error inserting metric labels")
+
+			return errors.Wrap(err, "error inserting metric labels")
+		}
+	}
+
+	switch metric.MType {
+	case domain.Gauge:
+		err = query.UpsertGaugeMetric(ctx, sqlitedb.UpsertGaugeMetricParams{
+			Tenant:   owner,
+			MetricID: metric.SeriesID(),
+			Value:    metric.Value,
+		})
+		if err == nil {
+			err = query.InsertGaugeSample(ctx, sqlitedb.InsertGaugeSampleParams{
+				Tenant:    owner,
+				MetricID:  metric.SeriesID(),
+				Value:     metric.Value,
+				CreatedAt: now.UnixNano(),
+			})
+		}
+		if err == nil {
+			err = query.TrimGaugeSamples(ctx, sqlitedb.TrimGaugeSamplesParams{
+				Tenant:   owner,
+				MetricID: metric.SeriesID(),
+				Keep:     maxSamples,
+			})
+		}
+	case domain.Counter:
+		err = query.UpsertCounterMetric(ctx, sqlitedb.UpsertCounterMetricParams{
+			Tenant:   owner,
+			MetricID: metric.SeriesID(),
+			Delta:    metric.Delta,
+		})
+		if err == nil {
+			err = query.InsertCounterSample(ctx, sqlitedb.InsertCounterSampleParams{
+				Tenant:    owner,
+				MetricID:  metric.SeriesID(),
+				Delta:     metric.Delta,
+				CreatedAt: now.UnixNano(),
+			})
+		}
+		if err == nil {
+			err = query.TrimCounterSamples(ctx, sqlitedb.TrimCounterSamplesParams{
+				Tenant:   owner,
+				MetricID: metric.SeriesID(),
+				Keep:     maxSamples,
+			})
+		}
+	case domain.Histogram:
+		err = query.UpsertHistogramMetric(ctx, sqlitedb.UpsertHistogramMetricParams{
+			Tenant:    owner,
+			MetricID:  metric.SeriesID(),
+			Histogram: metric.Histogram,
+		})
+	case domain.Summary:
+		err = query.UpsertSummaryMetric(ctx, sqlitedb.UpsertSummaryMetricParams{
+			Tenant:   owner,
+			MetricID: metric.SeriesID(),
+			Summary:  metric.Summary,
+		})
+	}
+
+	if err != nil {
+		ss.log.Error().Err(err).Msg("error upserting metric")
+
+		return errors.Wrap(err, "error upserting metric")
+	}
+
+	return nil
+}
+
+// unixTime converts the unix nanoseconds of a stored time.
+func unixTime(nanos int64) *time.Time {
+	stored := time.Unix(0, nanos)
+
+	return &stored
+}
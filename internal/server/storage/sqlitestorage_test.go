@@ -0,0 +1,300 @@
+package storage_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/npavlov/go-metrics-service/internal/domain"
+	"github.com/npavlov/go-metrics-service/internal/model"
+	"github.com/npavlov/go-metrics-service/internal/server/db"
+	"github.com/npavlov/go-metrics-service/internal/server/db/sqlitedb"
+	"github.com/npavlov/go-metrics-service/internal/server/dbmanager"
+	"github.com/npavlov/go-metrics-service/internal/server/storage"
+	"github.com/npavlov/go-metrics-service/internal/server/tenant"
+	testutils "github.com/npavlov/go-metrics-service/internal/test_utils"
+)
+
+func setupSQLiteStorage(t *testing.T) *storage.SQLiteStorage {
+	t.Helper()
+
+	log := testutils.GetTLogger()
+	dsn := dbmanager.SQLiteScheme + filepath.Join(t.TempDir(), "metrics.db")
+
+	manager := dbmanager.NewDBManager(dsn, log).
+		WithMigrations("../../../migrations/sqlite").
+		Connect(context.Background()).
+		ApplyMigrations()
+	t.Cleanup(manager.Close)
+
+	require.True(t, manager.IsConnected)
+	require.True(t, manager.IsSQLite())
+	require.NoError(t, manager.Ping(context.Background()))
+
+	return storage.NewSQLiteStorage(manager.SQLite, log)
+}
+
+func TestSQLiteStorage_CreateGetUpdate(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	sqliteStorage := setupSQLiteStorage(t)
+
+	counter := db.NewMetric("requests", domain.Counter, int64Ptr(5), nil).WithLabels(domain.Labels{"host": "a"})
+	require.NoError(t, sqliteStorage.Create(ctx, counter))
+
+	metric, found := sqliteStorage.Get(ctx, counter.SeriesID())
+	require.True(t, found)
+	assert.Equal(t, domain.MetricName("requests"), metric.ID)
+	assert.Equal(t, domain.Labels{"host": "a"}, metric.Labels)
+	assert.Equal(t, int64(5), *metric.Delta)
+
+	counter.Delta = int64Ptr(8)
+	require.NoError(t, sqliteStorage.Update(ctx, counter))
+
+	metric, found = sqliteStorage.Get(ctx, counter.SeriesID())
+	require.True(t, found)
+	assert.Equal(t, int64(8), *metric.Delta)
+
+	_, found = sqliteStorage.Get(ctx, "missing")
+	assert.False(t, found)
+
+	// the type of a series is fixed
+	require.Error(t, sqliteStorage.Update(ctx, db.NewMetric(counter.SeriesID(), domain.Gauge, nil, float64Ptr(1))))
+	require.Error(t, sqliteStorage.Create(ctx, db.NewMetric("empty", domain.Gauge, nil, nil)))
+}
+
+func TestSQLiteStorage_UpdateManyGetMany(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	sqliteStorage := setupSQLiteStorage(t)
+
+	histogram := domain.NewHistogram([]float64{1, 5})
+	histogram.Observe(3)
+
+	require.NoError(t, sqliteStorage.UpdateMany(ctx, &[]db.Metric{
+		*db.NewMetric("gauge", domain.Gauge, nil, float64Ptr(1.5)),
+		*db.NewMetric("counter", domain.Counter, int64Ptr(2), nil),
+		*db.NewHistogramMetric("latency", histogram),
+		*db.NewSummaryMetric("duration", domain.NewSummary([]float64{0.5}, []float64{1, 2, 3})),
+	}))
+
+	all := sqliteStorage.GetAll(ctx)
+	require.Len(t, all, 4)
+	assert.Equal(t, histogram, all["latency"].Histogram)
+	assert.InDelta(t, 2.0, all["duration"].Summary.Quantiles[0].Value, 0.0001)
+
+	metrics, err := sqliteStorage.GetMany(ctx, []domain.MetricName{"gauge", "counter", "missing"})
+	require.NoError(t, err)
+	require.Len(t, metrics, 2)
+	assert.InDelta(t, 1.5, *metrics["gauge"].Value, 0.0001)
+	assert.Equal(t, int64(2), *metrics["counter"].Delta)
+}
+
+func TestSQLiteStorage_ApplyDeltas(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	sqliteStorage := setupSQLiteStorage(t)
+
+	summary := domain.NewSummary([]float64{0.5}, []float64{1, 2, 3})
+	for range 2 {
+		_, err := sqliteStorage.ApplyDeltas(ctx, []db.Metric{
+			*db.NewMetric("counter", domain.Counter, int64Ptr(2), nil),
+			*db.NewMetric("counter", domain.Counter, int64Ptr(3), nil),
+			*db.NewSummaryMetric("duration", summary),
+		})
+		require.NoError(t, err)
+	}
+
+	all := sqliteStorage.GetAll(ctx)
+	assert.Equal(t, int64(10), *all["counter"].Delta)
+	assert.Equal(t, uint64(6), all["duration"].Summary.Count)
+
+	_, err := sqliteStorage.ApplyDeltas(ctx, []db.Metric{*db.NewMetric("counter", domain.Gauge, nil, float64Ptr(1))})
+	require.Error(t, err)
+}
+
+func TestSQLiteStorage_ApplyBatch(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	sqliteStorage := setupSQLiteStorage(t)
+
+	for range 2 {
+		require.NoError(t, sqliteStorage.ApplyBatch(ctx, &model.Batch{
+			Values:  []db.Metric{*db.NewMetric("temperature", domain.Gauge, nil, float64Ptr(21))},
+			Deltas:  []db.Metric{*db.NewMetric("requests", domain.Counter, int64Ptr(2), nil)},
+			Changes: []db.Metric{*db.NewMetric("queue", domain.Gauge, nil, float64Ptr(1.5))},
+		}))
+	}
+
+	all := sqliteStorage.GetAll(ctx)
+	assert.InDelta(t, 21.0, *all["temperature"].Value, 0.0001)
+	assert.Equal(t, int64(4), *all["requests"].Delta)
+	assert.InDelta(t, 3.0, *all["queue"].Value, 0.0001)
+
+	// nothing is applied when a change does not match its series
+	err := sqliteStorage.ApplyBatch(ctx, &model.Batch{
+		Values:  []db.Metric{*db.NewMetric("temperature", domain.Gauge, nil, float64Ptr(30))},
+		Deltas:  nil,
+		Changes: []db.Metric{*db.NewMetric("requests", domain.Gauge, nil, float64Ptr(1))},
+	})
+	require.Error(t, err)
+
+	metric, _ := sqliteStorage.Get(ctx, "temperature")
+	assert.InDelta(t, 21.0, *metric.Value, 0.0001)
+}
+
+func TestSQLiteStorage_GetRange(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	sqliteStorage := setupSQLiteStorage(t)
+
+	from := time.Now()
+	require.NoError(t, sqliteStorage.Create(ctx, db.NewMetric("gauge", domain.Gauge, nil, float64Ptr(1))))
+	require.NoError(t, sqliteStorage.Update(ctx, db.NewMetric("gauge", domain.Gauge, nil, float64Ptr(2))))
+
+	samples, err := sqliteStorage.GetRange(ctx, "gauge", domain.Gauge, from, time.Now())
+	require.NoError(t, err)
+	require.Len(t, samples, 2)
+	assert.InDelta(t, 1.0, *samples[0].Value, 0.0001)
+	assert.InDelta(t, 2.0, *samples[1].Value, 0.0001)
+
+	samples, err = sqliteStorage.GetRange(ctx, "gauge", domain.Gauge, time.Now(), time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.Empty(t, samples)
+
+	samples, err = sqliteStorage.GetRange(ctx, "missing", domain.Gauge, from, time.Now())
+	require.NoError(t, err)
+	assert.Empty(t, samples)
+
+	// the series must have the requested type
+	samples, err = sqliteStorage.GetRange(ctx, "gauge", domain.Counter, from, time.Now())
+	require.NoError(t, err)
+	assert.Empty(t, samples)
+}
+
+func TestSQLiteStorage_TrimSamples(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	sqliteStorage := setupSQLiteStorage(t)
+
+	for _, value := range []float64{1, 2, 3} {
+		require.NoError(t, sqliteStorage.Update(ctx, db.NewMetric("gauge", domain.Gauge, nil, float64Ptr(value))))
+	}
+
+	// the newest samples are kept
+	require.NoError(t, sqliteStorage.Queries.TrimGaugeSamples(ctx, sqlitedb.TrimGaugeSamplesParams{
+		Tenant:   domain.DefaultTenant,
+		MetricID: "gauge",
+		Keep:     2,
+	}))
+
+	samples, err := sqliteStorage.GetRange(ctx, "gauge", domain.Gauge, time.Time{}, time.Now())
+	require.NoError(t, err)
+	require.Len(t, samples, 2)
+	assert.InDelta(t, 2.0, *samples[0].Value, 0.0001)
+	assert.InDelta(t, 3.0, *samples[1].Value, 0.0001)
+}
+
+func TestSQLiteStorage_Delete(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	sqliteStorage := setupSQLiteStorage(t)
+
+	require.NoError(t, sqliteStorage.UpdateMany(ctx, &[]db.Metric{
+		*db.NewMetric("first", domain.Gauge, nil, float64Ptr(1)),
+		*db.NewMetric("second", domain.Counter, int64Ptr(1), nil),
+		*db.NewMetric("third", domain.Counter, int64Ptr(1), nil),
+	}))
+
+	deleted, err := sqliteStorage.Delete(ctx, "first", domain.Gauge)
+	require.NoError(t, err)
+	assert.True(t, deleted)
+
+	deleted, err = sqliteStorage.Delete(ctx, "first", domain.Gauge)
+	require.NoError(t, err)
+	assert.False(t, deleted)
+
+	// a series of another type is kept
+	deleted, err = sqliteStorage.Delete(ctx, "second", domain.Gauge)
+	require.NoError(t, err)
+	assert.False(t, deleted)
+
+	names, err := sqliteStorage.DeleteMany(ctx, []domain.MetricName{"second", "third", "missing"})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []domain.MetricName{"second", "third"}, names)
+	assert.Empty(t, sqliteStorage.GetAll(ctx))
+
+	// samples are removed together with the series
+	samples, err := sqliteStorage.GetRange(ctx, "second", domain.Counter, time.Time{}, time.Now())
+	require.NoError(t, err)
+	assert.Empty(t, samples)
+}
+
+func TestSQLiteStorage_DeleteStale(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	sqliteStorage := setupSQLiteStorage(t)
+
+	require.NoError(t, sqliteStorage.Create(ctx, db.NewMetric("old", domain.Gauge, nil, float64Ptr(1))))
+	cutoff := time.Now()
+	require.NoError(t, sqliteStorage.Create(ctx, db.NewMetric("fresh", domain.Counter, int64Ptr(1), nil)))
+
+	metric, found := sqliteStorage.Get(ctx, "fresh")
+	require.True(t, found)
+	require.NotNil(t, metric.UpdatedAt)
+	assert.False(t, metric.UpdatedAt.Before(cutoff))
+
+	names, err := sqliteStorage.DeleteStale(ctx, cutoff)
+	require.NoError(t, err)
+	assert.Equal(t, []domain.MetricName{"old"}, names)
+
+	all := sqliteStorage.GetAll(ctx)
+	require.Len(t, all, 1)
+	assert.Contains(t, all, domain.MetricName("fresh"))
+}
+
+func TestSQLiteStorage_Tenants(t *testing.T) {
+	t.Parallel()
+
+	sqliteStorage := setupSQLiteStorage(t)
+	teamA := tenant.WithTenant(context.Background(), "team-a")
+	teamB := tenant.WithTenant(context.Background(), "team-b")
+
+	require.NoError(t, sqliteStorage.UpdateMany(teamA, &[]db.Metric{
+		*db.NewMetric("shared", domain.Counter, int64Ptr(1), nil),
+	}))
+	require.NoError(t, sqliteStorage.UpdateMany(teamB, &[]db.Metric{
+		*db.NewMetric("shared", domain.Gauge, nil, float64Ptr(2)),
+	}))
+
+	// the same name is a separate series in every tenant
+	metric, found := sqliteStorage.Get(teamA, "shared")
+	require.True(t, found)
+	assert.Equal(t, domain.Counter, metric.MType)
+	metric, found = sqliteStorage.Get(teamB, "shared")
+	require.True(t, found)
+	assert.Equal(t, domain.Gauge, metric.MType)
+	assert.Empty(t, sqliteStorage.GetAll(context.Background()))
+
+	tenants, err := sqliteStorage.Tenants(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []domain.Tenant{"team-a", "team-b"}, tenants)
+
+	deleted, err := sqliteStorage.Delete(teamA, "shared", domain.Counter)
+	require.NoError(t, err)
+	assert.True(t, deleted)
+	_, found = sqliteStorage.Get(teamB, "shared")
+	assert.True(t, found)
+}
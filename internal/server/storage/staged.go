@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"github.com/pkg/errors"
+
+	"github.com/npavlov/go-metrics-service/internal/domain"
+	"github.com/npavlov/go-metrics-service/internal/server/db"
+)
+
+// stagedWrite merges the metrics of a write into their stored series before any of them is stored,
+// so a write failing on one of its metrics applies nothing. The series are kept in the order of the write.
+type stagedWrite struct {
+	// lookup returns a copy of the stored series, nil when it does not exist
+	lookup func(seriesID domain.MetricName) (*db.Metric, error)
+	merged map[domain.MetricName]*db.Metric
+	order  []domain.MetricName
+}
+
+func newStagedWrite(lookup func(seriesID domain.MetricName) (*db.Metric, error), size int) *stagedWrite {
+	return &stagedWrite{
+		lookup: lookup,
+		merged: make(map[domain.MetricName]*db.Metric, size),
+		order:  make([]domain.MetricName, 0, size),
+	}
+}
+
+// replace replaces the series with the metric, see Repository.UpdateMany.
+func (w *stagedWrite) replace(metric *db.Metric) {
+	w.set(metric.SeriesID(), metric.Clone())
+}
+
+// merge merges the metric into its series, see db.Metric.Merge.
+func (w *stagedWrite) merge(metric *db.Metric) error {
+	current, err := w.current(metric)
+	if current == nil || err != nil {
+		return err
+	}
+
+	current.Merge(metric)
+
+	return nil
+}
+
+// add adds the gauge value of the metric to its series.
+func (w *stagedWrite) add(metric *db.Metric) error {
+	if metric.MType != domain.Gauge || metric.Value == nil {
+		return errors.Errorf(errNotGauge, metric.SeriesID())
+	}
+
+	current, err := w.current(metric)
+	if current == nil || err != nil {
+		return err
+	}
+
+	value := *metric.Value
+	if current.Value != nil {
+		value += *current.Value
+	}
+	current.SetValue(nil, &value)
+
+	return nil
+}
+
+// series returns the merged series in the order of the write.
+func (w *stagedWrite) series() []*db.Metric {
+	series := make([]*db.Metric, 0, len(w.order))
+	for _, seriesID := range w.order {
+		series = append(series, w.merged[seriesID])
+	}
+
+	return series
+}
+
+// current returns the series of the metric merged so far, a new series is set to the metric and nil is returned.
+func (w *stagedWrite) current(metric *db.Metric) (*db.Metric, error) {
+	seriesID := metric.SeriesID()
+
+	current, found := w.merged[seriesID]
+	if !found {
+		stored, err := w.lookup(seriesID)
+		if err != nil {
+			return nil, err
+		}
+
+		if stored == nil {
+			w.set(seriesID, metric.Clone())
+
+			return nil, nil //nolint:nilnil
+		}
+
+		current = stored
+		w.set(seriesID, current)
+	}
+
+	if current.MType != metric.MType {
+		return nil, errors.Wrapf(ErrTypeMismatch, "%s is a %s", seriesID, current.MType)
+	}
+
+	return current, nil
+}
+
+func (w *stagedWrite) set(seriesID domain.MetricName, metric *db.Metric) {
+	if _, found := w.merged[seriesID]; !found {
+		w.order = append(w.order, seriesID)
+	}
+
+	w.merged[seriesID] = metric
+}
@@ -2,6 +2,7 @@ package storage
 
 import (
 	"context"
+	"slices"
 	"sync"
 	"time"
 
@@ -9,36 +10,63 @@ import (
 	"github.com/rs/zerolog"
 
 	"github.com/npavlov/go-metrics-service/internal/domain"
+	"github.com/npavlov/go-metrics-service/internal/model"
 	"github.com/npavlov/go-metrics-service/internal/server/config"
 	"github.com/npavlov/go-metrics-service/internal/server/db"
+	"github.com/npavlov/go-metrics-service/internal/server/hub"
 	"github.com/npavlov/go-metrics-service/internal/server/snapshot"
+	"github.com/npavlov/go-metrics-service/internal/server/tenant"
+	"github.com/npavlov/go-metrics-service/internal/server/wal"
 )
 
 const (
 	errNoValue = "no value provided"
+	// errNotGauge is reported for a change of a batch without a gauge value.
+	errNotGauge = "change of metric %s is not a gauge"
+	// maxSamples caps the in-memory history kept per metric, the oldest samples are dropped first.
+	maxSamples = 10000
+	// walSuffix is appended to the snapshot file name to get the WAL file name.
+	walSuffix = ".wal"
 )
 
+// ErrTypeMismatch is returned for a write that does not match the type of the stored series.
+var ErrTypeMismatch = errors.New("metric type does not match the stored series")
+
+// MemStorage keeps the series of every tenant in memory, a series is addressed by its tenant and series ID.
 type MemStorage struct {
 	mu       *sync.RWMutex
-	metrics  map[domain.MetricName]db.Metric
+	metrics  snapshot.State
+	samples  map[domain.Tenant]map[domain.MetricName][]db.Sample
 	cfg      *config.Config
 	l        *zerolog.Logger
 	snapshot snapshot.Snapshot
+	wal      *wal.WAL
+	hub      *hub.Hub
 }
 
 // NewMemStorage - constructor for MemStorage.
 func NewMemStorage(l *zerolog.Logger) *MemStorage {
 	ms := &MemStorage{
-		metrics:  make(map[domain.MetricName]db.Metric),
+		metrics:  make(snapshot.State),
+		samples:  make(map[domain.Tenant]map[domain.MetricName][]db.Sample),
 		mu:       &sync.RWMutex{},
 		l:        l,
 		cfg:      nil,
 		snapshot: nil,
+		wal:      nil,
+		hub:      nil,
 	}
 
 	return ms
 }
 
+// WithHub publishes every write to the given change hub.
+func (ms *MemStorage) WithHub(changeHub *hub.Hub) *MemStorage {
+	ms.hub = changeHub
+
+	return ms
+}
+
 func (ms *MemStorage) WithBackup(ctx context.Context, cfg *config.Config) *MemStorage {
 	// no file  provided
 	if len(cfg.File) == 0 {
@@ -47,10 +75,21 @@ func (ms *MemStorage) WithBackup(ctx context.Context, cfg *config.Config) *MemSt
 		return ms
 	}
 
-	memSnapshot := snapshot.NewMemSnapshot(cfg.File, ms.l)
+	compression, err := snapshot.ParseCompression(cfg.SnapshotCompression)
+	if err != nil {
+		ms.l.Error().Err(err).Msg("writing uncompressed snapshots")
+	}
+
+	memSnapshot := snapshot.NewMemSnapshot(cfg.File, ms.l).
+		WithCompression(compression).
+		WithRetention(cfg.SnapshotKeep)
 	ms.snapshot = memSnapshot
 	ms.cfg = cfg
 
+	if cfg.UseWAL {
+		ms.openWAL(cfg.File + walSuffix)
+	}
+
 	if cfg.RestoreStorage {
 		metrics, err := memSnapshot.Restore()
 		if err != nil {
@@ -60,6 +99,14 @@ func (ms *MemStorage) WithBackup(ctx context.Context, cfg *config.Config) *MemSt
 			ms.metrics = metrics
 			ms.l.Info().Msg("Metrics restored successfully")
 		}
+
+		ms.replayWAL()
+		ms.touchRestored(time.Now())
+	} else if ms.wal != nil {
+		// the log of the previous session must not be replayed onto the next snapshot
+		if err := ms.wal.Truncate(); err != nil {
+			ms.l.Error().Err(err).Msg("failed to truncate wal")
+		}
 	}
 
 	ms.StartBackup(ctx)
@@ -68,59 +115,134 @@ func (ms *MemStorage) WithBackup(ctx context.Context, cfg *config.Config) *MemSt
 	return ms
 }
 
+// openWAL opens the write-ahead log, the storage falls back to the snapshot only when it cannot be opened.
+func (ms *MemStorage) openWAL(path string) {
+	writeLog, err := wal.Open(path, ms.l)
+	if err != nil {
+		ms.l.Error().Err(err).Msg("failed to open wal, running with snapshot only")
+
+		return
+	}
+
+	ms.wal = writeLog
+}
+
+// replayWAL applies the writes logged after the latest snapshot.
+func (ms *MemStorage) replayWAL() {
+	if ms.wal == nil {
+		return
+	}
+
+	count, err := ms.wal.Replay(func(record wal.Record) {
+		switch record.Op {
+		case wal.OpPut:
+			series := ms.tenantSeries(record.TenantOf())
+			for _, metric := range record.Metrics {
+				series[metric.SeriesID()] = metric
+			}
+		case wal.OpDelete:
+			for _, name := range record.Names {
+				ms.remove(record.TenantOf(), name)
+			}
+		}
+	})
+	if err != nil {
+		ms.l.Error().Err(err).Msg("failed to replay wal")
+	}
+
+	ms.l.Info().Int("records", count).Msg("WAL replayed")
+}
+
+// touchRestored counts the restored metrics without the time of their last write as written now,
+// the snapshots taken before the time was tracked do not carry it.
+func (ms *MemStorage) touchRestored(now time.Time) {
+	for _, series := range ms.metrics {
+		for name, metric := range series {
+			if metric.UpdatedAt == nil {
+				metric.Touch(now)
+				series[name] = metric
+			}
+		}
+	}
+}
+
 func (ms *MemStorage) StartBackup(ctx context.Context) {
 	if ms.cfg.StoreInterval > 0 {
 		go func() {
+			ticker := time.NewTicker(ms.cfg.StoreIntervalDur)
+			defer ticker.Stop()
+
 			for {
 				select {
 				case <-ctx.Done():
 					ms.l.Info().Msg("Stopping storage backup")
 					ms.mu.RLock()
-					_ = ms.snapshot.Save(ms.metrics)
+					_ = ms.checkpoint()
 					ms.mu.RUnlock()
 
 					return
-				default:
+				case <-ticker.C:
 					ms.mu.RLock()
-					err := ms.snapshot.Save(ms.metrics)
+					err := ms.checkpoint()
 					ms.mu.RUnlock()
 					if err != nil {
 						ms.l.Error().Err(err).Msg("Error saving file")
 						panic(err)
 					}
-					time.Sleep(ms.cfg.StoreIntervalDur)
 				}
 			}
 		}()
 	}
 }
 
-func (ms *MemStorage) GetAll(_ context.Context) map[domain.MetricName]*db.Metric {
+// Close takes the final snapshot and closes the WAL once its tail is on disk, the writes after it are not logged.
+func (ms *MemStorage) Close() error {
+	if ms.snapshot == nil {
+		return nil
+	}
+
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	err := ms.checkpoint()
+	if ms.wal != nil {
+		// the records stay durable in the log when the snapshot failed
+		if closeErr := ms.wal.Close(); err == nil {
+			err = closeErr
+		}
+	}
+
+	return err
+}
+
+// GetAll - retrieves all metrics of the tenant of the request.
+func (ms *MemStorage) GetAll(ctx context.Context) map[domain.MetricName]*db.Metric {
 	ms.mu.RLock()
 	defer ms.mu.RUnlock()
 
-	return cloneMap(ms.metrics)
+	return cloneMap(ms.metrics[tenant.FromContext(ctx)])
 }
 
 // Get - retrieves the value of a Metric.
-func (ms *MemStorage) Get(_ context.Context, name domain.MetricName) (*db.Metric, bool) {
+func (ms *MemStorage) Get(ctx context.Context, name domain.MetricName) (*db.Metric, bool) {
 	ms.mu.RLock()
 	defer ms.mu.RUnlock()
-	value, exists := ms.metrics[name]
+	value, exists := ms.metrics[tenant.FromContext(ctx)][name]
 
-	return &value, exists
+	return value.Clone(), exists
 }
 
 // GetMany retrieves multiple metrics by their names.
-func (ms *MemStorage) GetMany(_ context.Context, names []domain.MetricName) (map[domain.MetricName]db.Metric, error) {
+func (ms *MemStorage) GetMany(ctx context.Context, names []domain.MetricName) (map[domain.MetricName]db.Metric, error) {
 	ms.mu.RLock()
 	defer ms.mu.RUnlock()
 
+	series := ms.metrics[tenant.FromContext(ctx)]
 	results := make(map[domain.MetricName]db.Metric)
 	for _, name := range names {
-		metric, exists := ms.metrics[name]
+		metric, exists := series[name]
 		if exists {
-			results[metric.ID] = metric
+			results[name] = *metric.Clone()
 		}
 	}
 
@@ -131,42 +253,291 @@ func (ms *MemStorage) GetMany(_ context.Context, names []domain.MetricName) (map
 func cloneMap(original map[domain.MetricName]db.Metric) map[domain.MetricName]*db.Metric {
 	cloned := make(map[domain.MetricName]*db.Metric, len(original))
 	for key, value := range original {
-		cloned[key] = db.NewMetric(value.ID, value.MType, value.Delta, value.Value)
+		cloned[key] = value.Clone()
 	}
 
 	return cloned
 }
 
-func (ms *MemStorage) Update(_ context.Context, metric *db.Metric) error {
-	ms.mu.Lock()
-	defer ms.mu.Unlock()
+func (ms *MemStorage) Update(ctx context.Context, metric *db.Metric) error {
+	return ms.Create(ctx, metric)
+}
 
-	if metric.Delta == nil && metric.Value == nil {
+func (ms *MemStorage) Create(ctx context.Context, metric *db.Metric) error {
+	if !metric.HasValue() {
 		return errors.New(errNoValue)
 	}
 
-	ms.metrics[metric.ID] = *metric
+	owner := tenant.FromContext(ctx)
 
-	if ms.cfg != nil && ms.cfg.StoreInterval == 0 {
-		err := ms.snapshot.Save(ms.metrics)
-		if err != nil {
-			return errors.Wrap(err, "failed to save metrics")
+	ms.mu.Lock()
+	stored := ms.store(owner, metric, time.Now())
+	ms.hub.PublishUpdates(owner, stored)
+	commit := ms.logWrite(wal.Put(owner, stored))
+	ms.mu.Unlock()
+
+	return commit()
+}
+
+func (ms *MemStorage) UpdateMany(ctx context.Context, metrics *[]db.Metric) error {
+	owner := tenant.FromContext(ctx)
+
+	ms.mu.Lock()
+	now := time.Now()
+	stored := make([]db.Metric, 0, len(*metrics))
+	for _, metric := range *metrics {
+		stored = append(stored, ms.store(owner, &metric, now))
+	}
+	ms.hub.PublishUpdates(owner, stored...)
+	commit := ms.logWrite(wal.Put(owner, stored...))
+	ms.mu.Unlock()
+
+	return commit()
+}
+
+// ApplyDeltas merges the metrics into the stored series under the lock and returns the resulting series,
+// see db.Metric.Merge. Nothing is applied when one of the metrics does not match its stored series.
+func (ms *MemStorage) ApplyDeltas(ctx context.Context, metrics []db.Metric) ([]db.Metric, error) {
+	for _, metric := range metrics {
+		if !metric.HasValue() {
+			return nil, errors.New(errNoValue)
 		}
 	}
 
-	return nil
+	owner := tenant.FromContext(ctx)
+
+	ms.mu.Lock()
+	write := ms.stage(owner, len(metrics))
+	for _, metric := range metrics {
+		if err := write.merge(&metric); err != nil {
+			ms.mu.Unlock()
+
+			return nil, err
+		}
+	}
+
+	applied, commit := ms.storeStaged(owner, write)
+	ms.mu.Unlock()
+
+	return applied, commit()
 }
 
-func (ms *MemStorage) Create(_ context.Context, metric *db.Metric) error {
+// ApplyBatch writes the values, merges the deltas and adds the changes of the batch under the lock,
+// see UpdateMany and ApplyDeltas. Nothing is applied when one of the metrics does not match its stored series.
+func (ms *MemStorage) ApplyBatch(ctx context.Context, batch *model.Batch) error {
+	if batch.Size() == 0 {
+		return nil
+	}
+
+	for _, metrics := range [][]db.Metric{batch.Values, batch.Deltas} {
+		for _, metric := range metrics {
+			if !metric.HasValue() {
+				return errors.New(errNoValue)
+			}
+		}
+	}
+
+	owner := tenant.FromContext(ctx)
+
 	ms.mu.Lock()
-	defer ms.mu.Unlock()
+	write := ms.stage(owner, batch.Size())
+	for _, metric := range batch.Values {
+		write.replace(&metric)
+	}
 
-	if metric.Delta == nil && metric.Value == nil {
-		return errors.New(errNoValue)
+	for _, metric := range batch.Deltas {
+		if err := write.merge(&metric); err != nil {
+			ms.mu.Unlock()
+
+			return err
+		}
 	}
 
-	ms.metrics[metric.ID] = *metric
+	for _, metric := range batch.Changes {
+		if err := write.add(&metric); err != nil {
+			ms.mu.Unlock()
+
+			return err
+		}
+	}
 
+	_, commit := ms.storeStaged(owner, write)
+	ms.mu.Unlock()
+
+	return commit()
+}
+
+// stage starts a write merged into the stored series of the tenant, it must be called under the lock.
+func (ms *MemStorage) stage(owner domain.Tenant, size int) *stagedWrite {
+	series := ms.metrics[owner]
+
+	return newStagedWrite(func(seriesID domain.MetricName) (*db.Metric, error) {
+		stored, exists := series[seriesID]
+		if !exists {
+			return nil, nil //nolint:nilnil
+		}
+
+		return stored.Clone(), nil
+	}, size)
+}
+
+// storeStaged stores the series of the write and returns them, it must be called under the lock.
+// The returned commit must be called after the lock is released, see logWrite.
+func (ms *MemStorage) storeStaged(owner domain.Tenant, write *stagedWrite) ([]db.Metric, func() error) {
+	now := time.Now()
+	series := write.series()
+	applied := make([]db.Metric, 0, len(series))
+	for _, metric := range series {
+		applied = append(applied, ms.store(owner, metric, now))
+	}
+	ms.hub.PublishUpdates(owner, applied...)
+
+	return applied, ms.logWrite(wal.Put(owner, applied...))
+}
+
+// Delete removes a metric of the given type together with its history, reports whether the metric existed.
+// The type is checked under the same lock, a metric retyped concurrently is kept.
+func (ms *MemStorage) Delete(ctx context.Context, name domain.MetricName, mType domain.MetricType) (bool, error) {
+	owner := tenant.FromContext(ctx)
+
+	ms.mu.Lock()
+	deleted := make([]domain.MetricName, 0, 1)
+	if metric, exists := ms.metrics[owner][name]; exists && metric.MType == mType && ms.remove(owner, name) {
+		deleted = append(deleted, name)
+	}
+
+	return len(deleted) > 0, ms.logDeletes(owner, deleted)
+}
+
+// DeleteMany removes multiple metrics together with their history, returns the names that existed.
+func (ms *MemStorage) DeleteMany(ctx context.Context, names []domain.MetricName) ([]domain.MetricName, error) {
+	owner := tenant.FromContext(ctx)
+
+	ms.mu.Lock()
+	deleted := make([]domain.MetricName, 0, len(names))
+	for _, name := range names {
+		if ms.remove(owner, name) {
+			deleted = append(deleted, name)
+		}
+	}
+
+	return deleted, ms.logDeletes(owner, deleted)
+}
+
+// DeleteStale removes the metrics last updated before the given time together with their history,
+// returns the removed names.
+func (ms *MemStorage) DeleteStale(ctx context.Context, before time.Time) ([]domain.MetricName, error) {
+	owner := tenant.FromContext(ctx)
+
+	ms.mu.Lock()
+	deleted := make([]domain.MetricName, 0)
+	for name, metric := range ms.metrics[owner] {
+		if metric.IsStale(before) && ms.remove(owner, name) {
+			deleted = append(deleted, name)
+		}
+	}
+
+	return deleted, ms.logDeletes(owner, deleted)
+}
+
+// Tenants returns the tenants that have metrics, sorted.
+func (ms *MemStorage) Tenants(_ context.Context) ([]domain.Tenant, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	tenants := make([]domain.Tenant, 0, len(ms.metrics))
+	for owner := range ms.metrics {
+		tenants = append(tenants, owner)
+	}
+
+	slices.Sort(tenants)
+
+	return tenants, nil
+}
+
+// logDeletes publishes and logs the removed metrics, must be called under the write lock, it releases the lock.
+func (ms *MemStorage) logDeletes(owner domain.Tenant, deleted []domain.MetricName) error {
+	if len(deleted) == 0 {
+		ms.mu.Unlock()
+
+		return nil
+	}
+
+	ms.hub.PublishDeletes(owner, deleted...)
+	commit := ms.logWrite(wal.Delete(owner, deleted...))
+	ms.mu.Unlock()
+
+	return commit()
+}
+
+// store saves a copy of the metric written at the given time and returns it, must be called under the write lock.
+func (ms *MemStorage) store(owner domain.Tenant, metric *db.Metric, now time.Time) db.Metric {
+	stored := metric.Clone()
+	stored.Touch(now)
+	ms.tenantSeries(owner)[stored.SeriesID()] = *stored
+	ms.addSample(owner, stored, now)
+
+	return *stored.Clone()
+}
+
+// tenantSeries returns the series of the tenant for a write, must be called under the write lock.
+func (ms *MemStorage) tenantSeries(owner domain.Tenant) map[domain.MetricName]db.Metric {
+	series, exists := ms.metrics[owner]
+	if !exists {
+		series = make(map[domain.MetricName]db.Metric)
+		ms.metrics[owner] = series
+	}
+
+	return series
+}
+
+// remove deletes the series of the tenant with its history, reports whether the series existed.
+// A tenant without series is dropped, must be called under the write lock.
+func (ms *MemStorage) remove(owner domain.Tenant, name domain.MetricName) bool {
+	series := ms.metrics[owner]
+	if _, exists := series[name]; !exists {
+		return false
+	}
+
+	delete(series, name)
+	delete(ms.samples[owner], name)
+
+	if len(series) == 0 {
+		delete(ms.metrics, owner)
+		delete(ms.samples, owner)
+	}
+
+	return true
+}
+
+// logWrite records the change, must be called under the write lock.
+// The returned commit waits until the change is durable, it is called once the lock is released,
+// so writers waiting at the same time share one WAL fsync.
+// Without the WAL the snapshot is rewritten right away when synchronous backup is configured.
+func (ms *MemStorage) logWrite(record wal.Record) func() error {
+	if ms.wal == nil {
+		err := ms.syncSave()
+
+		return func() error { return err }
+	}
+
+	seq, err := ms.wal.Write(record)
+
+	return func() error {
+		if err != nil {
+			return errors.Wrap(err, "failed to log metrics")
+		}
+
+		if err := ms.wal.Sync(seq); err != nil {
+			return errors.Wrap(err, "failed to log metrics")
+		}
+
+		return ms.compact()
+	}
+}
+
+// syncSave writes the snapshot right away when synchronous backup is configured, must be called under the lock.
+func (ms *MemStorage) syncSave() error {
 	if ms.cfg != nil && ms.cfg.StoreInterval == 0 {
 		err := ms.snapshot.Save(ms.metrics)
 		if err != nil {
@@ -177,13 +548,91 @@ func (ms *MemStorage) Create(_ context.Context, metric *db.Metric) error {
 	return nil
 }
 
-func (ms *MemStorage) UpdateMany(_ context.Context, metrics *[]db.Metric) error {
+// compact saves the snapshot once the WAL outgrows its limit in synchronous mode,
+// the backup loop takes the snapshots on the store interval otherwise.
+func (ms *MemStorage) compact() error {
+	if ms.cfg.StoreInterval > 0 || ms.wal.Size() <= ms.cfg.WALMaxSize {
+		return nil
+	}
+
 	ms.mu.Lock()
 	defer ms.mu.Unlock()
 
-	for _, metric := range *metrics {
-		ms.metrics[metric.ID] = metric
+	// another writer may have compacted the log meanwhile
+	if ms.wal.Size() <= ms.cfg.WALMaxSize {
+		return nil
+	}
+
+	return ms.checkpoint()
+}
+
+// checkpoint saves the snapshot and truncates the WAL, its records are part of the snapshot now.
+// Must be called under the lock, the read lock is enough as the WAL is written under the write lock only.
+func (ms *MemStorage) checkpoint() error {
+	if err := ms.snapshot.Save(ms.metrics); err != nil {
+		return errors.Wrap(err, "failed to save metrics")
+	}
+
+	if ms.wal == nil {
+		return nil
+	}
+
+	// the log is closed on shutdown once its records are in the snapshot
+	if err := ms.wal.Truncate(); err != nil && !errors.Is(err, wal.ErrClosed) {
+		return errors.Wrap(err, "failed to truncate wal")
 	}
 
 	return nil
 }
+
+// GetRange returns the samples of a metric of the given type accepted within [from, to], oldest first.
+func (ms *MemStorage) GetRange(
+	ctx context.Context,
+	name domain.MetricName,
+	mType domain.MetricType,
+	from, to time.Time,
+) ([]db.Sample, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	owner := tenant.FromContext(ctx)
+	result := make([]db.Sample, 0)
+	if metric, exists := ms.metrics[owner][name]; !exists || metric.MType != mType {
+		return result, nil
+	}
+
+	for _, sample := range ms.samples[owner][name] {
+		if sample.Timestamp.Before(from) || sample.Timestamp.After(to) {
+			continue
+		}
+		result = append(result, sample)
+	}
+
+	return result, nil
+}
+
+// addSample appends the value of the metric to its history, must be called under the write lock.
+// The history is kept for counters and gauges only.
+func (ms *MemStorage) addSample(owner domain.Tenant, metric *db.Metric, timestamp time.Time) {
+	if metric.MType.IsDistribution() {
+		return
+	}
+
+	samples, exists := ms.samples[owner]
+	if !exists {
+		samples = make(map[domain.MetricName][]db.Sample)
+		ms.samples[owner] = samples
+	}
+
+	history := append(samples[metric.SeriesID()], db.Sample{
+		Delta:     metric.Delta,
+		Value:     metric.Value,
+		Timestamp: timestamp,
+	})
+
+	if len(history) > maxSamples {
+		history = history[len(history)-maxSamples:]
+	}
+
+	samples[metric.SeriesID()] = history
+}
@@ -8,15 +8,18 @@ import (
 	"testing"
 	"time"
 
-	jsoniter "github.com/json-iterator/go"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	"github.com/npavlov/go-metrics-service/internal/server/db"
+	"github.com/npavlov/go-metrics-service/internal/server/hub"
+	"github.com/npavlov/go-metrics-service/internal/server/snapshot"
 
 	"github.com/npavlov/go-metrics-service/internal/domain"
+	"github.com/npavlov/go-metrics-service/internal/model"
 	"github.com/npavlov/go-metrics-service/internal/server/config"
 	"github.com/npavlov/go-metrics-service/internal/server/storage"
+	"github.com/npavlov/go-metrics-service/internal/server/tenant"
 	testutils "github.com/npavlov/go-metrics-service/internal/test_utils"
 )
 
@@ -89,8 +92,6 @@ func TestMemStorageBackupAndRestore(t *testing.T) {
 		StoreInterval:  0,
 		RestoreStorage: false,
 	}
-	json := jsoniter.ConfigCompatibleWithStandardLibrary
-
 	// Create metrics to be backed up
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -108,15 +109,11 @@ func TestMemStorageBackupAndRestore(t *testing.T) {
 	require.NoError(t, err)
 
 	// Load from file and verify
-	fileContent, err := os.ReadFile(tmpFile)
-	require.NoError(t, err)
-
-	var restoredData map[domain.MetricName]db.Metric
-	err = json.Unmarshal(fileContent, &restoredData)
+	restoredData, err := snapshot.NewMemSnapshot(tmpFile, testutils.GetTLogger()).Restore()
 	require.NoError(t, err)
 
-	assert.Equal(t, int64(30), *restoredData[("backup_counter")].Delta)
-	assert.InDelta(t, float64(42.42), *restoredData[("backup_gauge")].Value, 0.0001)
+	assert.Equal(t, int64(30), *restoredData[domain.DefaultTenant]["backup_counter"].Delta)
+	assert.InDelta(t, float64(42.42), *restoredData[domain.DefaultTenant]["backup_gauge"].Value, 0.0001)
 
 	cfgRestore := &config.Config{
 		File:           tmpFile,
@@ -150,6 +147,113 @@ func TestMemStorageConcurrentUpdate(t *testing.T) {
 	assert.Equal(t, delta, *retrievedMetric.Delta)
 }
 
+func TestMemStorageConcurrentApplyDeltas(t *testing.T) {
+	t.Parallel()
+
+	memStorage := storage.NewMemStorage(testutils.GetTLogger())
+
+	var wg sync.WaitGroup
+	for range 100 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := memStorage.ApplyDeltas(context.Background(), []db.Metric{
+				*db.NewMetric("concurrent_counter", domain.Counter, int64Ptr(1), nil),
+				*db.NewMetric("concurrent_counter", domain.Counter, int64Ptr(2), nil),
+			})
+			assert.NoError(t, err)
+		}()
+	}
+
+	wg.Wait()
+	retrievedMetric, exists := memStorage.Get(context.Background(), "concurrent_counter")
+	assert.True(t, exists)
+	assert.Equal(t, int64(300), *retrievedMetric.Delta)
+}
+
+func TestMemStorageApplyDeltas(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	memStorage := storage.NewMemStorage(testutils.GetTLogger())
+
+	histogram := domain.NewHistogram([]float64{1})
+	histogram.Observe(0.5)
+
+	applied, err := memStorage.ApplyDeltas(ctx, []db.Metric{
+		*db.NewMetric("counter", domain.Counter, int64Ptr(5), nil),
+		*db.NewMetric("gauge", domain.Gauge, nil, float64Ptr(1.5)),
+		*db.NewHistogramMetric("latency", histogram),
+	})
+	require.NoError(t, err)
+	require.Len(t, applied, 3)
+
+	applied, err = memStorage.ApplyDeltas(ctx, []db.Metric{
+		*db.NewMetric("counter", domain.Counter, int64Ptr(2), nil),
+		*db.NewMetric("gauge", domain.Gauge, nil, float64Ptr(3)),
+		*db.NewHistogramMetric("latency", histogram),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), *applied[0].Delta)
+	assert.InDelta(t, 3.0, *applied[1].Value, 0.0001)
+	assert.Equal(t, uint64(2), applied[2].Histogram.Count)
+
+	// nothing is applied when a metric does not match its series
+	_, err = memStorage.ApplyDeltas(ctx, []db.Metric{
+		*db.NewMetric("counter", domain.Counter, int64Ptr(1), nil),
+		*db.NewMetric("gauge", domain.Counter, int64Ptr(1), nil),
+	})
+	require.Error(t, err)
+
+	metric, _ := memStorage.Get(ctx, "counter")
+	assert.Equal(t, int64(7), *metric.Delta)
+
+	_, err = memStorage.ApplyDeltas(ctx, []db.Metric{*db.NewMetric("empty", domain.Gauge, nil, nil)})
+	require.Error(t, err)
+}
+
+func TestMemStorageApplyBatch(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	memStorage := storage.NewMemStorage(testutils.GetTLogger())
+	require.NoError(t, memStorage.UpdateMany(ctx, &[]db.Metric{
+		*db.NewMetric("requests", domain.Counter, int64Ptr(10), nil),
+		*db.NewMetric("queue", domain.Gauge, nil, float64Ptr(4)),
+	}))
+
+	var wg sync.WaitGroup
+	for range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, memStorage.ApplyBatch(ctx, &model.Batch{
+				Values:  []db.Metric{*db.NewMetric("temperature", domain.Gauge, nil, float64Ptr(21))},
+				Deltas:  []db.Metric{*db.NewMetric("requests", domain.Counter, int64Ptr(1), nil)},
+				Changes: []db.Metric{*db.NewMetric("queue", domain.Gauge, nil, float64Ptr(-0.5))},
+			}))
+		}()
+	}
+	wg.Wait()
+
+	metrics := memStorage.GetAll(ctx)
+	assert.InDelta(t, 21.0, *metrics["temperature"].Value, 0.0001)
+	assert.Equal(t, int64(60), *metrics["requests"].Delta)
+	// the concurrent changes do not overwrite each other
+	assert.InDelta(t, -21.0, *metrics["queue"].Value, 0.0001)
+
+	// nothing is applied when a change does not match its series
+	err := memStorage.ApplyBatch(ctx, &model.Batch{
+		Values:  []db.Metric{*db.NewMetric("temperature", domain.Gauge, nil, float64Ptr(30))},
+		Deltas:  nil,
+		Changes: []db.Metric{*db.NewMetric("requests", domain.Gauge, nil, float64Ptr(1))},
+	})
+	require.Error(t, err)
+
+	metric, _ := memStorage.Get(ctx, "temperature")
+	assert.InDelta(t, 21.0, *metric.Value, 0.0001)
+}
+
 func TestMemStorageUpdateWithNoValue(t *testing.T) {
 	t.Parallel()
 
@@ -198,8 +302,6 @@ func TestMemStorageStartBackup(t *testing.T) {
 		StoreIntervalDur: 1 * time.Second,
 	}
 
-	json := jsoniter.ConfigCompatibleWithStandardLibrary
-
 	ctx, cancel := context.WithCancel(context.Background())
 	memStorage := storage.NewMemStorage(testutils.GetTLogger()).WithBackup(ctx, cfg)
 
@@ -213,16 +315,14 @@ func TestMemStorageStartBackup(t *testing.T) {
 	time.Sleep(2 * time.Second)
 
 	cancel()
+	// let the final checkpoint finish before the directory is removed
+	time.Sleep(100 * time.Millisecond)
 
 	// Verify the backup file exists and has the expected metric data
-	fileContent, err := os.ReadFile(tmpFile)
+	restoredData, err := snapshot.NewMemSnapshot(tmpFile, testutils.GetTLogger()).Restore()
 	require.NoError(t, err)
 
-	var restoredData map[domain.MetricName]db.Metric
-	err = json.Unmarshal(fileContent, &restoredData)
-	require.NoError(t, err)
-
-	assert.Equal(t, int64(200), *restoredData["backup_counter_metric"].Delta)
+	assert.Equal(t, int64(200), *restoredData[domain.DefaultTenant]["backup_counter_metric"].Delta)
 }
 
 func TestMemStorageGetMany(t *testing.T) {
@@ -269,6 +369,149 @@ func TestMemStorageUpdateMany(t *testing.T) {
 	assert.Equal(t, int64(400), *allMetrics["update_metric2"].Delta)
 }
 
+func TestMemStorageLabeledSeries(t *testing.T) {
+	t.Parallel()
+
+	memStorage := storage.NewMemStorage(testutils.GetTLogger())
+
+	cpu0 := db.NewMetric("CPUutilization", domain.Gauge, nil, float64Ptr(10)).WithLabels(domain.Labels{"cpu": "0"})
+	cpu1 := db.NewMetric("CPUutilization", domain.Gauge, nil, float64Ptr(20)).WithLabels(domain.Labels{"cpu": "1"})
+
+	err := memStorage.UpdateMany(context.Background(), &[]db.Metric{*cpu0, *cpu1})
+	require.NoError(t, err)
+
+	// Series sharing a name are stored separately
+	all := memStorage.GetAll(context.Background())
+	assert.Len(t, all, 2)
+
+	metric, found := memStorage.Get(context.Background(), `CPUutilization{cpu="1"}`)
+	require.True(t, found)
+	assert.Equal(t, domain.MetricName("CPUutilization"), metric.ID)
+	assert.Equal(t, domain.Labels{"cpu": "1"}, metric.Labels)
+	assert.InDelta(t, 20, *metric.Value, 0.0001)
+
+	_, found = memStorage.Get(context.Background(), "CPUutilization")
+	assert.False(t, found)
+}
+
+func TestMemStorageGetRange(t *testing.T) {
+	t.Parallel()
+
+	memStorage := storage.NewMemStorage(testutils.GetTLogger())
+	from := time.Now()
+
+	_ = memStorage.Create(context.Background(), db.NewMetric("HeapAlloc", domain.Gauge, nil, float64Ptr(1.5)))
+	_ = memStorage.Update(context.Background(), db.NewMetric("HeapAlloc", domain.Gauge, nil, float64Ptr(2.5)))
+	_ = memStorage.UpdateMany(context.Background(), &[]db.Metric{
+		*db.NewMetric("HeapAlloc", domain.Gauge, nil, float64Ptr(3.5)),
+	})
+
+	samples, err := memStorage.GetRange(context.Background(), "HeapAlloc", domain.Gauge, from, time.Now())
+	require.NoError(t, err)
+	require.Len(t, samples, 3)
+	assert.InDelta(t, 1.5, *samples[0].Value, 0.0001)
+	assert.InDelta(t, 3.5, *samples[2].Value, 0.0001)
+
+	// Samples outside the window are skipped
+	samples, err = memStorage.GetRange(context.Background(), "HeapAlloc", domain.Gauge, time.Now().Add(time.Hour), time.Now().Add(2*time.Hour))
+	require.NoError(t, err)
+	assert.Empty(t, samples)
+
+	samples, err = memStorage.GetRange(context.Background(), "unknown", domain.Gauge, from, time.Now())
+	require.NoError(t, err)
+	assert.Empty(t, samples)
+
+	// the series must have the requested type
+	samples, err = memStorage.GetRange(context.Background(), "HeapAlloc", domain.Counter, from, time.Now())
+	require.NoError(t, err)
+	assert.Empty(t, samples)
+}
+
+func TestMemStorageDelete(t *testing.T) {
+	t.Parallel()
+
+	memStorage := storage.NewMemStorage(testutils.GetTLogger())
+
+	_ = memStorage.Create(context.Background(), db.NewMetric("CPUutilization1", domain.Gauge, nil, float64Ptr(1)))
+	_ = memStorage.Create(context.Background(), db.NewMetric("CPUutilization2", domain.Gauge, nil, float64Ptr(2)))
+	_ = memStorage.Create(context.Background(), db.NewMetric("CPUutilization3", domain.Gauge, nil, float64Ptr(3)))
+
+	deleted, err := memStorage.Delete(context.Background(), "CPUutilization1", domain.Gauge)
+	require.NoError(t, err)
+	assert.True(t, deleted)
+
+	deleted, err = memStorage.Delete(context.Background(), "CPUutilization1", domain.Gauge)
+	require.NoError(t, err)
+	assert.False(t, deleted)
+
+	// a series of another type is kept
+	deleted, err = memStorage.Delete(context.Background(), "CPUutilization2", domain.Counter)
+	require.NoError(t, err)
+	assert.False(t, deleted)
+	_, found := memStorage.Get(context.Background(), "CPUutilization2")
+	assert.True(t, found)
+
+	samples, err := memStorage.GetRange(context.Background(), "CPUutilization1", domain.Gauge, time.Time{}, time.Now())
+	require.NoError(t, err)
+	assert.Empty(t, samples)
+
+	names, err := memStorage.DeleteMany(context.Background(), []domain.MetricName{"CPUutilization2", "unknown"})
+	require.NoError(t, err)
+	assert.Equal(t, []domain.MetricName{"CPUutilization2"}, names)
+
+	allMetrics := memStorage.GetAll(context.Background())
+	assert.Len(t, allMetrics, 1)
+	assert.Contains(t, allMetrics, domain.MetricName("CPUutilization3"))
+}
+
+func TestMemStorageDeleteStale(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	memStorage := storage.NewMemStorage(testutils.GetTLogger())
+
+	require.NoError(t, memStorage.Create(ctx, db.NewMetric("Old", domain.Gauge, nil, float64Ptr(1))))
+	cutoff := time.Now()
+	require.NoError(t, memStorage.Create(ctx, db.NewMetric("Fresh", domain.Gauge, nil, float64Ptr(2))))
+
+	metric, found := memStorage.Get(ctx, "Old")
+	require.True(t, found)
+	require.NotNil(t, metric.UpdatedAt)
+	assert.True(t, metric.UpdatedAt.Before(cutoff))
+
+	names, err := memStorage.DeleteStale(ctx, cutoff)
+	require.NoError(t, err)
+	assert.Equal(t, []domain.MetricName{"Old"}, names)
+
+	// a write keeps the series fresh
+	_, err = memStorage.ApplyDeltas(ctx, []db.Metric{*db.NewMetric("Fresh", domain.Gauge, nil, float64Ptr(3))})
+	require.NoError(t, err)
+
+	names, err = memStorage.DeleteStale(ctx, cutoff)
+	require.NoError(t, err)
+	assert.Empty(t, names)
+	assert.Len(t, memStorage.GetAll(ctx), 1)
+}
+
+func TestMemStoragePublishesChanges(t *testing.T) {
+	t.Parallel()
+
+	changeHub := hub.NewHub(testutils.GetTLogger())
+	subscription := changeHub.Subscribe(domain.DefaultTenant, nil)
+	memStorage := storage.NewMemStorage(testutils.GetTLogger()).WithHub(changeHub)
+
+	_ = memStorage.Create(context.Background(), db.NewMetric("Alloc", domain.Gauge, nil, float64Ptr(1)))
+	_ = memStorage.UpdateMany(context.Background(), &[]db.Metric{
+		*db.NewMetric("PollCount", domain.Counter, int64Ptr(1), nil),
+	})
+	_, _ = memStorage.Delete(context.Background(), "Alloc", domain.Gauge)
+
+	require.Len(t, subscription.Events(), 3)
+	assert.Equal(t, domain.MetricName("Alloc"), (<-subscription.Events()).Metric.ID)
+	assert.Equal(t, domain.MetricName("PollCount"), (<-subscription.Events()).Metric.ID)
+	assert.Equal(t, hub.EventDelete, (<-subscription.Events()).Type)
+}
+
 func TestMemStorageConcurrentBackup(t *testing.T) {
 	t.Parallel()
 
@@ -284,8 +527,6 @@ func TestMemStorageConcurrentBackup(t *testing.T) {
 		StoreIntervalDur: 1 * time.Second,
 	}
 
-	json := jsoniter.ConfigCompatibleWithStandardLibrary
-
 	ctx, cancel := context.WithCancel(context.Background())
 
 	memStorage := storage.NewMemStorage(testutils.GetTLogger()).WithBackup(ctx, cfg)
@@ -301,15 +542,149 @@ func TestMemStorageConcurrentBackup(t *testing.T) {
 	time.Sleep(3 * time.Second)
 
 	cancel()
+	// let the final checkpoint finish before the directory is removed
+	time.Sleep(100 * time.Millisecond)
 
-	// Check that the backup file exists
-	fileContent, err := os.ReadFile(tmpFile)
+	// Check that the backup file exists and has the latest data
+	restoredData, err := snapshot.NewMemSnapshot(tmpFile, testutils.GetTLogger()).Restore()
 	require.NoError(t, err)
 
-	// Verify the file has the latest data
-	var restoredData map[domain.MetricName]db.Metric
-	err = json.Unmarshal(fileContent, &restoredData)
+	assert.Equal(t, delta, *restoredData[domain.DefaultTenant]["concurrent_backup_metric"].Delta)
+}
+
+func TestMemStorageWALReplay(t *testing.T) {
+	t.Parallel()
+
+	tmpFile := filepath.Join(t.TempDir(), "test_metrics.json")
+	cfg := &config.Config{
+		File:           tmpFile,
+		StoreInterval:  0,
+		RestoreStorage: true,
+		UseWAL:         true,
+		WALMaxSize:     1 << 20,
+	}
+
+	memStorage := storage.NewMemStorage(testutils.GetTLogger()).WithBackup(context.Background(), cfg)
+	require.NoError(t, memStorage.Create(context.Background(), db.NewMetric("wal_counter", domain.Counter, int64Ptr(3), nil)))
+	require.NoError(t, memStorage.UpdateMany(context.Background(), &[]db.Metric{
+		*db.NewMetric("wal_gauge", domain.Gauge, nil, float64Ptr(1.5)),
+		*db.NewMetric("wal_deleted", domain.Gauge, nil, float64Ptr(2)),
+	}))
+	_, err := memStorage.Delete(context.Background(), "wal_deleted", domain.Gauge)
 	require.NoError(t, err)
 
-	assert.Equal(t, delta, *restoredData["concurrent_backup_metric"].Delta)
+	// writes below the WAL limit do not rewrite the snapshot
+	_, err = os.Stat(tmpFile)
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	// a restart without a snapshot gets the state from the WAL
+	restored := storage.NewMemStorage(testutils.GetTLogger()).WithBackup(context.Background(), cfg)
+	metrics := restored.GetAll(context.Background())
+	require.Len(t, metrics, 2)
+	assert.Equal(t, int64(3), *metrics["wal_counter"].Delta)
+	assert.InDelta(t, 1.5, *metrics["wal_gauge"].Value, 0.0001)
+}
+
+func TestMemStorageWALCompaction(t *testing.T) {
+	t.Parallel()
+
+	tmpFile := filepath.Join(t.TempDir(), "test_metrics.json")
+	cfg := &config.Config{
+		File:           tmpFile,
+		StoreInterval:  0,
+		RestoreStorage: true,
+		UseWAL:         true,
+		WALMaxSize:     1,
+	}
+
+	memStorage := storage.NewMemStorage(testutils.GetTLogger()).WithBackup(context.Background(), cfg)
+	require.NoError(t, memStorage.Update(context.Background(), db.NewMetric("wal_counter", domain.Counter, int64Ptr(7), nil)))
+
+	// the WAL outgrew its limit, the snapshot took over its records
+	walInfo, err := os.Stat(tmpFile + ".wal")
+	require.NoError(t, err)
+	assert.Zero(t, walInfo.Size())
+
+	restored := storage.NewMemStorage(testutils.GetTLogger()).WithBackup(context.Background(), cfg)
+	metric, found := restored.Get(context.Background(), "wal_counter")
+	require.True(t, found)
+	assert.Equal(t, int64(7), *metric.Delta)
+}
+
+func TestMemStorageClose(t *testing.T) {
+	t.Parallel()
+
+	tmpFile := filepath.Join(t.TempDir(), "test_metrics.json")
+	cfg := &config.Config{
+		File:           tmpFile,
+		StoreInterval:  0,
+		RestoreStorage: true,
+		UseWAL:         true,
+		WALMaxSize:     1 << 20,
+	}
+
+	memStorage := storage.NewMemStorage(testutils.GetTLogger()).WithBackup(context.Background(), cfg)
+	require.NoError(t, memStorage.Update(context.Background(), db.NewMetric("closed_counter", domain.Counter, int64Ptr(4), nil)))
+	require.NoError(t, memStorage.Close())
+
+	// the final checkpoint took the WAL records into the snapshot
+	restoredData, err := snapshot.NewMemSnapshot(tmpFile, testutils.GetTLogger()).Restore()
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), *restoredData[domain.DefaultTenant]["closed_counter"].Delta)
+
+	walInfo, err := os.Stat(tmpFile + ".wal")
+	require.NoError(t, err)
+	assert.Zero(t, walInfo.Size())
+}
+
+func TestMemStorageTenants(t *testing.T) {
+	t.Parallel()
+
+	tmpFile := filepath.Join(t.TempDir(), "test_metrics.json")
+	//nolint:exhaustruct
+	cfg := &config.Config{
+		File:           tmpFile,
+		StoreInterval:  0,
+		RestoreStorage: true,
+		UseWAL:         true,
+		WALMaxSize:     1 << 20,
+	}
+
+	ctx := context.Background()
+	teamA := tenant.WithTenant(ctx, "team-a")
+	teamB := tenant.WithTenant(ctx, "team-b")
+
+	memStorage := storage.NewMemStorage(testutils.GetTLogger()).WithBackup(ctx, cfg)
+	require.NoError(t, memStorage.Create(teamA, db.NewMetric("requests", domain.Counter, int64Ptr(1), nil)))
+	require.NoError(t, memStorage.Create(teamB, db.NewMetric("requests", domain.Counter, int64Ptr(2), nil)))
+	require.NoError(t, memStorage.Create(teamB, db.NewMetric("errors", domain.Counter, int64Ptr(3), nil)))
+
+	// every tenant reads its own series only
+	assert.Empty(t, memStorage.GetAll(ctx))
+	assert.Len(t, memStorage.GetAll(teamA), 1)
+	metric, found := memStorage.Get(teamA, "requests")
+	require.True(t, found)
+	assert.Equal(t, int64(1), *metric.Delta)
+	_, found = memStorage.Get(teamA, "errors")
+	assert.False(t, found)
+
+	tenants, err := memStorage.Tenants(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []domain.Tenant{"team-a", "team-b"}, tenants)
+
+	// deleting a series of one tenant keeps the series of the same name of the other tenant
+	deleted, err := memStorage.Delete(teamA, "requests", domain.Counter)
+	require.NoError(t, err)
+	assert.True(t, deleted)
+
+	tenants, err = memStorage.Tenants(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []domain.Tenant{"team-b"}, tenants)
+
+	// the WAL keeps the tenant of every write
+	restored := storage.NewMemStorage(testutils.GetTLogger()).WithBackup(ctx, cfg)
+	assert.Empty(t, restored.GetAll(teamA))
+	metrics := restored.GetAll(teamB)
+	require.Len(t, metrics, 2)
+	assert.Equal(t, int64(2), *metrics["requests"].Delta)
 }
@@ -0,0 +1,108 @@
+// Package tenant carries the tenant of a request through its context and resolves tenants from signing keys.
+//
+// A request names its tenant in the X-Tenant header or gRPC metadata, a request signed with the key
+// of a tenant belongs to that tenant. The requests that do not name a tenant belong to domain.DefaultTenant.
+// Only the tenants with a key are isolated, an unsigned request may name any tenant without one.
+package tenant
+
+import (
+	"context"
+	"crypto/hmac"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/npavlov/go-metrics-service/internal/domain"
+	"github.com/npavlov/go-metrics-service/internal/utils"
+)
+
+// Header - the HTTP header and the gRPC metadata key naming the tenant of a request.
+const Header = "X-Tenant"
+
+var (
+	// ErrInvalidKey is returned for a tenant key not in the tenant:key form.
+	ErrInvalidKey = errors.New("tenant key must be in the tenant:key form")
+	// ErrForbidden is returned when a request names a tenant other than the one of its signing key,
+	// or does not sign a request to a tenant that has a key.
+	ErrForbidden = errors.New("request is not allowed for the tenant")
+)
+
+type tenantKey struct{}
+
+// WithTenant returns a context carrying the tenant of the request.
+func WithTenant(ctx context.Context, tenant domain.Tenant) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// Lookup returns the tenant named by the request, false when the request does not name one.
+func Lookup(ctx context.Context) (domain.Tenant, bool) {
+	tenant, ok := ctx.Value(tenantKey{}).(domain.Tenant)
+
+	return tenant, ok
+}
+
+// FromContext returns the tenant of the request, domain.DefaultTenant when the request does not name one.
+func FromContext(ctx context.Context) domain.Tenant {
+	if tenant, ok := Lookup(ctx); ok {
+		return tenant
+	}
+
+	return domain.DefaultTenant
+}
+
+// Keys - the signing keys of the tenants, a request signed with one of them belongs to its tenant.
+type Keys map[domain.Tenant]string
+
+// ParseKeys parses the tenant keys in the tenant:key form.
+func ParseKeys(pairs []string) (Keys, error) {
+	keys := make(Keys, len(pairs))
+
+	for _, pair := range pairs {
+		name, key, found := strings.Cut(pair, ":")
+		tenant := domain.Tenant(strings.TrimSpace(name))
+		if !found || key == "" {
+			return nil, errors.Wrap(ErrInvalidKey, string(tenant))
+		}
+
+		if err := tenant.Validate(); err != nil {
+			return nil, errors.Wrap(err, "invalid tenant key")
+		}
+
+		keys[tenant] = key
+	}
+
+	return keys, nil
+}
+
+// Match returns the tenant whose key produced the signature of the payload, see utils.CalculateHash.
+func (k Keys) Match(payload []byte, signature string) (domain.Tenant, string, bool) {
+	for tenant, key := range k {
+		expected := utils.CalculateHash(key, payload)
+		if hmac.Equal([]byte(expected), []byte(signature)) {
+			return tenant, expected, true
+		}
+	}
+
+	return "", "", false
+}
+
+// Resolve checks the tenant named by the request against the tenant of its signing key and returns the context
+// carrying the tenant of the request. signedBy is empty when the request is not signed with a tenant key,
+// such a request is rejected for a tenant with a key and accepted for any other tenant.
+func (k Keys) Resolve(ctx context.Context, signedBy domain.Tenant) (context.Context, error) {
+	named, ok := Lookup(ctx)
+
+	if signedBy != "" {
+		if ok && named != signedBy {
+			return nil, errors.Wrapf(ErrForbidden, "%s signed by the key of %s", named, signedBy)
+		}
+
+		return WithTenant(ctx, signedBy), nil
+	}
+
+	if _, protected := k[FromContext(ctx)]; protected {
+		return nil, errors.Wrapf(ErrForbidden, "%s requires signed requests", FromContext(ctx))
+	}
+
+	return ctx, nil
+}
@@ -0,0 +1,81 @@
+package tenant_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/npavlov/go-metrics-service/internal/domain"
+	"github.com/npavlov/go-metrics-service/internal/server/tenant"
+	"github.com/npavlov/go-metrics-service/internal/utils"
+)
+
+func TestFromContext(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	assert.Equal(t, domain.DefaultTenant, tenant.FromContext(ctx))
+
+	_, ok := tenant.Lookup(ctx)
+	assert.False(t, ok)
+
+	named, ok := tenant.Lookup(tenant.WithTenant(ctx, "team-a"))
+	assert.True(t, ok)
+	assert.Equal(t, domain.Tenant("team-a"), named)
+}
+
+func TestParseKeys(t *testing.T) {
+	t.Parallel()
+
+	keys, err := tenant.ParseKeys([]string{"team-a:secret-a", " team-b :secret:b"})
+	require.NoError(t, err)
+	assert.Equal(t, tenant.Keys{"team-a": "secret-a", "team-b": "secret:b"}, keys)
+
+	_, err = tenant.ParseKeys([]string{"team-a"})
+	require.ErrorIs(t, err, tenant.ErrInvalidKey)
+
+	_, err = tenant.ParseKeys([]string{"team a:secret"})
+	require.ErrorIs(t, err, domain.ErrInvalidTenant)
+}
+
+func TestKeys_Match(t *testing.T) {
+	t.Parallel()
+
+	keys := tenant.Keys{"team-a": "secret-a", "team-b": "secret-b"}
+	payload := []byte(`{"id":"metric"}`)
+
+	owner, signature, matched := keys.Match(payload, utils.CalculateHash("secret-b", payload))
+	assert.True(t, matched)
+	assert.Equal(t, domain.Tenant("team-b"), owner)
+	assert.Equal(t, utils.CalculateHash("secret-b", payload), signature)
+
+	_, _, matched = keys.Match(payload, utils.CalculateHash("other", payload))
+	assert.False(t, matched)
+}
+
+func TestKeys_Resolve(t *testing.T) {
+	t.Parallel()
+
+	keys := tenant.Keys{"team-a": "secret-a"}
+	ctx := context.Background()
+
+	// the signing key decides the tenant of the request
+	resolved, err := keys.Resolve(ctx, "team-a")
+	require.NoError(t, err)
+	assert.Equal(t, domain.Tenant("team-a"), tenant.FromContext(resolved))
+
+	// a request cannot name a tenant other than the one of its key
+	_, err = keys.Resolve(tenant.WithTenant(ctx, "team-b"), "team-a")
+	require.ErrorIs(t, err, tenant.ErrForbidden)
+
+	// a tenant with a key accepts signed requests only
+	_, err = keys.Resolve(tenant.WithTenant(ctx, "team-a"), "")
+	require.ErrorIs(t, err, tenant.ErrForbidden)
+
+	// tenants without a key keep the named tenant
+	resolved, err = keys.Resolve(tenant.WithTenant(ctx, "team-b"), "")
+	require.NoError(t, err)
+	assert.Equal(t, domain.Tenant("team-b"), tenant.FromContext(resolved))
+}
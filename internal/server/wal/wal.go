@@ -0,0 +1,312 @@
+package wal
+
+import (
+	"bufio"
+	"bytes"
+	"hash/crc32"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/npavlov/go-metrics-service/internal/domain"
+	"github.com/npavlov/go-metrics-service/internal/server/db"
+)
+
+// Op - the kind of change recorded in the log.
+type Op string
+
+const (
+	// OpPut stores the full state of the metrics.
+	OpPut Op = "put"
+	// OpDelete removes the metrics with the given names.
+	OpDelete Op = "delete"
+)
+
+const filePerm = 0o600
+
+// ErrClosed is returned for a write to a closed log.
+var ErrClosed = errors.New("wal is closed")
+
+// Record - a single change of the metrics of a tenant.
+// The records logged before the tenants were introduced have no tenant, they belong to domain.DefaultTenant.
+type Record struct {
+	Op      Op                  `json:"op"`
+	Tenant  domain.Tenant       `json:"tenant,omitempty"`
+	Metrics []db.Metric         `json:"metrics,omitempty"`
+	Names   []domain.MetricName `json:"names,omitempty"`
+}
+
+// Put - a record storing the state of the metrics of the tenant.
+func Put(tenant domain.Tenant, metrics ...db.Metric) Record {
+	return Record{Op: OpPut, Tenant: tenant, Metrics: metrics, Names: nil}
+}
+
+// Delete - a record removing the metrics of the tenant.
+func Delete(tenant domain.Tenant, names ...domain.MetricName) Record {
+	return Record{Op: OpDelete, Tenant: tenant, Metrics: nil, Names: names}
+}
+
+// TenantOf returns the tenant of the record.
+func (r *Record) TenantOf() domain.Tenant {
+	if r.Tenant == "" {
+		return domain.DefaultTenant
+	}
+
+	return r.Tenant
+}
+
+// WAL - an append-only log of storage changes, one "<crc32> <json>" line per record.
+// Write buffers records in order, Sync makes them durable: writers waiting at the same time share one fsync.
+type WAL struct {
+	mu      *sync.Mutex
+	synced  *sync.Cond
+	file    *os.File
+	writer  *bufio.Writer
+	json    jsoniter.API
+	l       *zerolog.Logger
+	size    int64
+	written uint64
+	durable uint64
+	syncing bool
+	closed  bool
+}
+
+// Open opens the log at the given path, creating it when missing.
+func Open(path string, l *zerolog.Logger) (*WAL, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, filePerm)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open wal")
+	}
+
+	mu := &sync.Mutex{}
+
+	return &WAL{
+		mu:      mu,
+		synced:  sync.NewCond(mu),
+		file:    file,
+		writer:  bufio.NewWriter(file),
+		json:    jsoniter.ConfigCompatibleWithStandardLibrary,
+		l:       l,
+		size:    0,
+		written: 0,
+		durable: 0,
+		syncing: false,
+		closed:  false,
+	}, nil
+}
+
+// Replay calls apply for every record in the log, oldest first.
+// A torn or corrupt tail left by a crash is cut off, new records are appended after the last valid one.
+func (w *WAL) Replay(apply func(record Record)) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if _, err := w.file.Seek(0, io.SeekStart); err != nil {
+		return 0, errors.Wrap(err, "failed to seek wal")
+	}
+
+	reader := bufio.NewReader(w.file)
+
+	var (
+		offset int64
+		count  int
+	)
+
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) && len(line) == 0 {
+			break
+		}
+
+		record, ok := w.decode(line)
+		if err != nil || !ok {
+			w.l.Warn().Int64("offset", offset).Msg("wal has a corrupt tail, dropping it")
+
+			break
+		}
+
+		apply(record)
+
+		offset += int64(len(line))
+		count++
+	}
+
+	if err := w.file.Truncate(offset); err != nil {
+		return count, errors.Wrap(err, "failed to cut wal tail")
+	}
+
+	if _, err := w.file.Seek(offset, io.SeekStart); err != nil {
+		return count, errors.Wrap(err, "failed to seek wal")
+	}
+
+	w.size = offset
+
+	return count, nil
+}
+
+// Write buffers the record and returns its sequence number for Sync, must be called in the order of the changes.
+func (w *WAL) Write(record Record) (uint64, error) {
+	data, err := w.json.Marshal(record)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to marshal wal record")
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return 0, ErrClosed
+	}
+
+	line := strconv.FormatUint(uint64(crc32.ChecksumIEEE(data)), 16) + " " + string(data) + "\n"
+
+	if _, err := w.writer.WriteString(line); err != nil {
+		return 0, errors.Wrap(err, "failed to write wal record")
+	}
+
+	w.size += int64(len(line))
+	w.written++
+
+	return w.written, nil
+}
+
+// Sync waits until the record with the given sequence number is on disk.
+// One of the waiting writers flushes and fsyncs the log for everybody written so far.
+func (w *WAL) Sync(seq uint64) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for w.durable < seq {
+		if w.syncing {
+			w.synced.Wait()
+
+			continue
+		}
+
+		if w.closed {
+			return ErrClosed
+		}
+
+		w.syncing = true
+		target := w.written
+
+		err := w.writer.Flush()
+		if err == nil {
+			w.mu.Unlock()
+			err = w.file.Sync()
+			w.mu.Lock()
+		}
+
+		w.syncing = false
+		w.synced.Broadcast()
+
+		if err != nil {
+			return errors.Wrap(err, "failed to sync wal")
+		}
+
+		w.durable = max(w.durable, target)
+	}
+
+	return nil
+}
+
+// Truncate drops every record, must be called once the records are stored durably elsewhere, e.g. in a snapshot.
+func (w *WAL) Truncate() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for w.syncing {
+		w.synced.Wait()
+	}
+
+	if w.closed {
+		return ErrClosed
+	}
+
+	w.writer.Reset(w.file)
+
+	if err := w.file.Truncate(0); err != nil {
+		return errors.Wrap(err, "failed to truncate wal")
+	}
+
+	if _, err := w.file.Seek(0, io.SeekStart); err != nil {
+		return errors.Wrap(err, "failed to seek wal")
+	}
+
+	if err := w.file.Sync(); err != nil {
+		return errors.Wrap(err, "failed to sync wal")
+	}
+
+	w.size = 0
+	w.durable = w.written
+	w.synced.Broadcast()
+
+	return nil
+}
+
+// Size returns the size of the log in bytes, including the buffered records.
+func (w *WAL) Size() int64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.size
+}
+
+// Close flushes and fsyncs the buffered records and closes the log, the writers waiting in Sync are released.
+func (w *WAL) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for w.syncing {
+		w.synced.Wait()
+	}
+
+	if w.closed {
+		return nil
+	}
+
+	err := w.writer.Flush()
+	if err == nil {
+		err = w.file.Sync()
+	}
+
+	if closeErr := w.file.Close(); err == nil {
+		err = closeErr
+	}
+
+	w.closed = true
+	if err == nil {
+		w.durable = w.written
+	}
+	w.synced.Broadcast()
+
+	return errors.Wrap(err, "failed to close wal")
+}
+
+// decode parses a "<crc32> <json>" line, false when the line is torn or its checksum does not match.
+func (w *WAL) decode(line []byte) (Record, bool) {
+	var record Record
+
+	line = bytes.TrimSuffix(line, []byte("\n"))
+
+	checksum, data, found := bytes.Cut(line, []byte(" "))
+	if !found {
+		return record, false
+	}
+
+	expected, err := strconv.ParseUint(string(checksum), 16, 32)
+	if err != nil || uint32(expected) != crc32.ChecksumIEEE(data) {
+		return record, false
+	}
+
+	if err := w.json.Unmarshal(data, &record); err != nil {
+		return record, false
+	}
+
+	return record, true
+}
@@ -0,0 +1,160 @@
+package wal_test
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/npavlov/go-metrics-service/internal/domain"
+	"github.com/npavlov/go-metrics-service/internal/server/db"
+	"github.com/npavlov/go-metrics-service/internal/server/wal"
+	testutils "github.com/npavlov/go-metrics-service/internal/test_utils"
+)
+
+func int64Ptr(i int64) *int64 {
+	return &i
+}
+
+func replayAll(t *testing.T, writeLog *wal.WAL) []wal.Record {
+	t.Helper()
+
+	records := make([]wal.Record, 0)
+	count, err := writeLog.Replay(func(record wal.Record) {
+		records = append(records, record)
+	})
+	require.NoError(t, err)
+	assert.Len(t, records, count)
+
+	return records
+}
+
+func TestWAL_WriteSyncReplay(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "metrics.wal")
+	writeLog, err := wal.Open(path, testutils.GetTLogger())
+	require.NoError(t, err)
+
+	counter := db.NewMetric("counter", domain.Counter, int64Ptr(5), nil).WithLabels(domain.Labels{"host": "a"})
+	seq, err := writeLog.Write(wal.Put("team-a", *counter))
+	require.NoError(t, err)
+	_, err = writeLog.Write(wal.Delete(domain.DefaultTenant, "gauge"))
+	require.NoError(t, err)
+	require.NoError(t, writeLog.Sync(seq))
+	require.NoError(t, writeLog.Close())
+
+	reopened, err := wal.Open(path, testutils.GetTLogger())
+	require.NoError(t, err)
+	defer func() { _ = reopened.Close() }()
+
+	records := replayAll(t, reopened)
+	require.Len(t, records, 2)
+	assert.Equal(t, wal.OpPut, records[0].Op)
+	assert.Equal(t, counter.SeriesID(), records[0].Metrics[0].SeriesID())
+	assert.Equal(t, int64(5), *records[0].Metrics[0].Delta)
+	assert.Equal(t, domain.Tenant("team-a"), records[0].TenantOf())
+	assert.Equal(t, wal.Delete(domain.DefaultTenant, "gauge"), records[1])
+}
+
+func TestWAL_ReplayDropsTornTail(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "metrics.wal")
+	writeLog, err := wal.Open(path, testutils.GetTLogger())
+	require.NoError(t, err)
+
+	seq, err := writeLog.Write(wal.Delete(domain.DefaultTenant, "first"))
+	require.NoError(t, err)
+	require.NoError(t, writeLog.Sync(seq))
+	require.NoError(t, writeLog.Close())
+
+	// a crash in the middle of a write leaves a partial record behind
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o600)
+	require.NoError(t, err)
+	_, err = file.WriteString(`1234abcd {"op":"del`)
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	reopened, err := wal.Open(path, testutils.GetTLogger())
+	require.NoError(t, err)
+	defer func() { _ = reopened.Close() }()
+
+	assert.Equal(t, []wal.Record{wal.Delete(domain.DefaultTenant, "first")}, replayAll(t, reopened))
+
+	// new records follow the last valid one
+	seq, err = reopened.Write(wal.Delete(domain.DefaultTenant, "second"))
+	require.NoError(t, err)
+	require.NoError(t, reopened.Sync(seq))
+	assert.Equal(t, []wal.Record{wal.Delete(domain.DefaultTenant, "first"), wal.Delete(domain.DefaultTenant, "second")}, replayAll(t, reopened))
+}
+
+func TestWAL_Truncate(t *testing.T) {
+	t.Parallel()
+
+	writeLog, err := wal.Open(filepath.Join(t.TempDir(), "metrics.wal"), testutils.GetTLogger())
+	require.NoError(t, err)
+	defer func() { _ = writeLog.Close() }()
+
+	seq, err := writeLog.Write(wal.Delete(domain.DefaultTenant, "metric"))
+	require.NoError(t, err)
+	assert.Positive(t, writeLog.Size())
+
+	require.NoError(t, writeLog.Truncate())
+	// records truncated before their sync are stored elsewhere already
+	require.NoError(t, writeLog.Sync(seq))
+	assert.Zero(t, writeLog.Size())
+	assert.Empty(t, replayAll(t, writeLog))
+}
+
+func TestWAL_ConcurrentSync(t *testing.T) {
+	t.Parallel()
+
+	writeLog, err := wal.Open(filepath.Join(t.TempDir(), "metrics.wal"), testutils.GetTLogger())
+	require.NoError(t, err)
+	defer func() { _ = writeLog.Close() }()
+
+	var wg sync.WaitGroup
+	for range 50 {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			seq, err := writeLog.Write(wal.Delete(domain.DefaultTenant, "metric"))
+			assert.NoError(t, err)
+			assert.NoError(t, writeLog.Sync(seq))
+		}()
+	}
+	wg.Wait()
+
+	assert.Len(t, replayAll(t, writeLog), 50)
+}
+
+func TestWAL_Close(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "metrics.wal")
+	writeLog, err := wal.Open(path, testutils.GetTLogger())
+	require.NoError(t, err)
+
+	seq, err := writeLog.Write(wal.Delete(domain.DefaultTenant, "metric"))
+	require.NoError(t, err)
+	require.NoError(t, writeLog.Close())
+	require.NoError(t, writeLog.Close())
+
+	// the records buffered before the close are on disk
+	require.NoError(t, writeLog.Sync(seq))
+	_, err = writeLog.Write(wal.Delete(domain.DefaultTenant, "other"))
+	require.ErrorIs(t, err, wal.ErrClosed)
+	require.ErrorIs(t, writeLog.Truncate(), wal.ErrClosed)
+
+	reopened, err := wal.Open(path, testutils.GetTLogger())
+	require.NoError(t, err)
+	defer func() { _ = reopened.Close() }()
+
+	assert.Equal(t, []wal.Record{wal.Delete(domain.DefaultTenant, "metric")}, replayAll(t, reopened))
+}
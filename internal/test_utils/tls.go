@@ -0,0 +1,95 @@
+package testutils
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Authority - a test CA issuing the certificates of the TLS tests, the files are written to a temporary directory.
+type Authority struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	dir  string
+}
+
+// NewAuthority creates the CA and writes its certificate to ca.pem.
+func NewAuthority(t *testing.T) *Authority {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	//nolint:exhaustruct
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	ca := &Authority{cert: cert, key: key, dir: t.TempDir()}
+	writePEM(t, ca.Path("ca.pem"), "CERTIFICATE", der)
+
+	return ca
+}
+
+// Path returns the path of the file of the CA.
+func (ca *Authority) Path(name string) string {
+	return filepath.Join(ca.dir, name)
+}
+
+// Issue writes the certificate and the key of the name, it returns their paths.
+func (ca *Authority) Issue(t *testing.T, name string, usage x509.ExtKeyUsage) (string, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	//nolint:exhaustruct
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	writePEM(t, ca.Path(name+".pem"), "CERTIFICATE", der)
+	writePEM(t, ca.Path(name+".key"), "EC PRIVATE KEY", keyDER)
+
+	return ca.Path(name + ".pem"), ca.Path(name + ".key")
+}
+
+func writePEM(t *testing.T, path, kind string, der []byte) {
+	t.Helper()
+
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: kind, Headers: nil, Bytes: der}), 0o600))
+}
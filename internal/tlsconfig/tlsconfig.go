@@ -0,0 +1,166 @@
+// Package tlsconfig builds the TLS configurations of the servers and the agents from PEM files.
+//
+// A server configured with a client CA requires mutual TLS, the verified client certificate is then the identity
+// of the client and replaces the trusted subnet check of the X-Real-IP address the client claims.
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"slices"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrNoCertificates is returned for a CA file without PEM certificates.
+	ErrNoCertificates = errors.New("no certificates in CA file")
+	// ErrClientDenied is returned for a client certificate whose name is not allowed.
+	ErrClientDenied = errors.New("client certificate is not allowed")
+)
+
+// NewServer returns the TLS configuration of a server, nil without a certificate.
+// With a client CA the clients must present a certificate signed by it, with client names the common name
+// or a DNS name of the certificate must be one of them.
+func NewServer(certFile, keyFile, clientCA string, clientNames []string) (*tls.Config, error) {
+	if certFile == "" {
+		return nil, nil //nolint:nilnil
+	}
+
+	certificate, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load server certificate")
+	}
+
+	//nolint:exhaustruct
+	config := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{certificate},
+	}
+
+	if clientCA == "" {
+		return config, nil
+	}
+
+	pool, err := loadPool(clientCA)
+	if err != nil {
+		return nil, err
+	}
+
+	config.ClientCAs = pool
+	config.ClientAuth = tls.RequireAndVerifyClientCert
+
+	if len(clientNames) > 0 {
+		config.VerifyConnection = func(state tls.ConnectionState) error {
+			if !slices.ContainsFunc(names(&state), func(name string) bool {
+				return slices.Contains(clientNames, name)
+			}) {
+				return errors.Wrap(ErrClientDenied, Identity(&state))
+			}
+
+			return nil
+		}
+	}
+
+	return config, nil
+}
+
+// NewClient returns the TLS configuration of a client. The server certificate is verified with the CA,
+// the system roots are used without one. The certificate is presented to the servers requiring mutual TLS.
+func NewClient(caFile, certFile, keyFile, serverName string) (*tls.Config, error) {
+	//nolint:exhaustruct
+	config := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: serverName,
+	}
+
+	if caFile != "" {
+		pool, err := loadPool(caFile)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = pool
+	}
+
+	if certFile != "" {
+		certificate, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to load client certificate")
+		}
+		config.Certificates = []tls.Certificate{certificate}
+	}
+
+	return config, nil
+}
+
+// Identity returns the first name of the verified client certificate of the connection, its common name
+// or its first DNS name, empty for connections without one.
+func Identity(state *tls.ConnectionState) string {
+	for _, name := range names(state) {
+		if name != "" {
+			return name
+		}
+	}
+
+	return ""
+}
+
+// CertificateIdentity returns the identity of the PEM certificate as Identity returns it for the connections
+// presenting it, empty without a file.
+func CertificateIdentity(certFile string) (string, error) {
+	if certFile == "" {
+		return "", nil
+	}
+
+	data, err := os.ReadFile(certFile)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to read certificate")
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return "", errors.Wrap(ErrNoCertificates, certFile)
+	}
+
+	certificate, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to parse certificate")
+	}
+
+	for _, name := range certificateNames(certificate) {
+		if name != "" {
+			return name, nil
+		}
+	}
+
+	return "", nil
+}
+
+// names returns the common name and the DNS names of the verified client certificate.
+func names(state *tls.ConnectionState) []string {
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return nil
+	}
+
+	return certificateNames(state.VerifiedChains[0][0])
+}
+
+func certificateNames(certificate *x509.Certificate) []string {
+	return append([]string{certificate.Subject.CommonName}, certificate.DNSNames...)
+}
+
+func loadPool(caFile string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read CA file")
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, errors.Wrap(ErrNoCertificates, caFile)
+	}
+
+	return pool, nil
+}
@@ -0,0 +1,114 @@
+package tlsconfig_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	testutils "github.com/npavlov/go-metrics-service/internal/test_utils"
+	"github.com/npavlov/go-metrics-service/internal/tlsconfig"
+)
+
+// handshake requests the server over TLS and returns the identity the server sees.
+func handshake(t *testing.T, server, client *tls.Config) (string, error) {
+	t.Helper()
+
+	listener := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, tlsconfig.Identity(r.TLS))
+	}))
+	listener.TLS = server
+	listener.StartTLS()
+	defer listener.Close()
+
+	//nolint:exhaustruct
+	httpClient := &http.Client{Transport: &http.Transport{TLSClientConfig: client}}
+
+	response, err := httpClient.Get(listener.URL) //nolint:noctx
+	if err != nil {
+		return "", err //nolint:wrapcheck
+	}
+	defer response.Body.Close()
+
+	identity, err := io.ReadAll(response.Body)
+
+	return string(identity), err //nolint:wrapcheck
+}
+
+func TestMutualTLS(t *testing.T) {
+	t.Parallel()
+
+	ca := testutils.NewAuthority(t)
+	serverCert, serverKey := ca.Issue(t, "localhost", x509.ExtKeyUsageServerAuth)
+	agentCert, agentKey := ca.Issue(t, "agent", x509.ExtKeyUsageClientAuth)
+	otherCert, otherKey := ca.Issue(t, "other", x509.ExtKeyUsageClientAuth)
+
+	server, err := tlsconfig.NewServer(serverCert, serverKey, ca.Path("ca.pem"), []string{"agent"})
+	require.NoError(t, err)
+
+	client, err := tlsconfig.NewClient(ca.Path("ca.pem"), agentCert, agentKey, "localhost")
+	require.NoError(t, err)
+
+	identity, err := handshake(t, server, client)
+	require.NoError(t, err)
+	assert.Equal(t, "agent", identity)
+
+	// a certificate of the CA with a name not allowed is rejected
+	other, err := tlsconfig.NewClient(ca.Path("ca.pem"), otherCert, otherKey, "localhost")
+	require.NoError(t, err)
+	_, err = handshake(t, server, other)
+	require.Error(t, err)
+
+	// mutual TLS requires a client certificate
+	anonymous, err := tlsconfig.NewClient(ca.Path("ca.pem"), "", "", "localhost")
+	require.NoError(t, err)
+	_, err = handshake(t, server, anonymous)
+	require.Error(t, err)
+}
+
+func TestServerTLS(t *testing.T) {
+	t.Parallel()
+
+	ca := testutils.NewAuthority(t)
+	serverCert, serverKey := ca.Issue(t, "localhost", x509.ExtKeyUsageServerAuth)
+
+	server, err := tlsconfig.NewServer("", "", "", nil)
+	require.NoError(t, err)
+	assert.Nil(t, server)
+
+	server, err = tlsconfig.NewServer(serverCert, serverKey, "", nil)
+	require.NoError(t, err)
+
+	client, err := tlsconfig.NewClient(ca.Path("ca.pem"), "", "", "localhost")
+	require.NoError(t, err)
+
+	identity, err := handshake(t, server, client)
+	require.NoError(t, err)
+	assert.Empty(t, identity)
+
+	_, err = tlsconfig.NewServer(serverCert, serverKey, serverKey, nil)
+	require.ErrorIs(t, err, tlsconfig.ErrNoCertificates)
+}
+
+func TestCertificateIdentity(t *testing.T) {
+	t.Parallel()
+
+	ca := testutils.NewAuthority(t)
+	gatewayCert, gatewayKey := ca.Issue(t, "gateway", x509.ExtKeyUsageClientAuth)
+
+	identity, err := tlsconfig.CertificateIdentity(gatewayCert)
+	require.NoError(t, err)
+	assert.Equal(t, "gateway", identity)
+
+	identity, err = tlsconfig.CertificateIdentity("")
+	require.NoError(t, err)
+	assert.Empty(t, identity)
+
+	_, err = tlsconfig.CertificateIdentity(gatewayKey)
+	require.ErrorIs(t, err, tlsconfig.ErrNoCertificates)
+}
@@ -15,17 +15,26 @@ func FromGModelToDBModel(metric *pb.Metric) *db.Metric {
 	case pb.Metric_TYPE_GAUGE:
 		val := metric.GetValue()
 		newMetric = db.NewMetric(domain.MetricName(metric.GetId()), domain.Gauge, nil, &val)
+	case pb.Metric_TYPE_HISTOGRAM:
+		newMetric = db.NewHistogramMetric(domain.MetricName(metric.GetId()), fromGHistogram(metric.GetHistogram()))
+	case pb.Metric_TYPE_SUMMARY:
+		newMetric = db.NewSummaryMetric(domain.MetricName(metric.GetId()), fromGSummary(metric.GetSummary()))
 	case pb.Metric_TYPE_UNSPECIFIED:
 		return nil
 	}
 
+	if len(metric.GetLabels()) > 0 {
+		newMetric.Labels = domain.Labels(metric.GetLabels())
+	}
+
 	return newMetric
 }
 
 func FromDBModelToGModel(metric *db.Metric) *pb.Metric {
 	//nolint:exhaustruct
 	newMetric := &pb.Metric{
-		Id: string(metric.ID),
+		Id:     string(metric.ID),
+		Labels: metric.Labels,
 	}
 
 	switch metric.MType {
@@ -35,7 +44,68 @@ func FromDBModelToGModel(metric *db.Metric) *pb.Metric {
 	case domain.Gauge:
 		newMetric.Value = metric.Value
 		newMetric.Mtype = pb.Metric_TYPE_GAUGE
+	case domain.Histogram:
+		newMetric.Mtype = pb.Metric_TYPE_HISTOGRAM
+		if metric.Histogram != nil {
+			//nolint:exhaustruct
+			newMetric.Distribution = &pb.Metric_Histogram{Histogram: &pb.Histogram{
+				Bounds: metric.Histogram.Bounds,
+				Counts: metric.Histogram.Counts,
+				Sum:    metric.Histogram.Sum,
+				Count:  metric.Histogram.Count,
+			}}
+		}
+	case domain.Summary:
+		newMetric.Mtype = pb.Metric_TYPE_SUMMARY
+		if metric.Summary != nil {
+			newMetric.Distribution = &pb.Metric_Summary{Summary: toGSummary(metric.Summary)}
+		}
 	}
 
 	return newMetric
 }
+
+func fromGHistogram(histogram *pb.Histogram) *domain.HistogramData {
+	if histogram == nil {
+		return nil
+	}
+
+	return &domain.HistogramData{
+		Bounds: histogram.GetBounds(),
+		Counts: histogram.GetCounts(),
+		Sum:    histogram.GetSum(),
+		Count:  histogram.GetCount(),
+	}
+}
+
+func fromGSummary(summary *pb.Summary) *domain.SummaryData {
+	if summary == nil {
+		return nil
+	}
+
+	quantiles := make([]domain.Quantile, len(summary.GetQuantiles()))
+	for i, quantile := range summary.GetQuantiles() {
+		quantiles[i] = domain.Quantile{Quantile: quantile.GetQuantile(), Value: quantile.GetValue()}
+	}
+
+	return &domain.SummaryData{
+		Quantiles: quantiles,
+		Sum:       summary.GetSum(),
+		Count:     summary.GetCount(),
+	}
+}
+
+func toGSummary(summary *domain.SummaryData) *pb.Summary {
+	quantiles := make([]*pb.Quantile, len(summary.Quantiles))
+	for i, quantile := range summary.Quantiles {
+		//nolint:exhaustruct
+		quantiles[i] = &pb.Quantile{Quantile: quantile.Quantile, Value: quantile.Value}
+	}
+
+	//nolint:exhaustruct
+	return &pb.Summary{
+		Quantiles: quantiles,
+		Sum:       summary.Sum,
+		Count:     summary.Count,
+	}
+}
@@ -26,15 +26,17 @@ func TestFromGModelToDBModel(t *testing.T) {
 	assert.Equal(t, int64(42), *dbMetric.Delta)
 
 	metricGauge := &pb.Metric{
-		Id:    "gauge_metric",
-		Mtype: pb.Metric_TYPE_GAUGE,
-		Value: float64Ptr(3.14),
+		Id:     "gauge_metric",
+		Mtype:  pb.Metric_TYPE_GAUGE,
+		Value:  float64Ptr(3.14),
+		Labels: map[string]string{"cpu": "0"},
 	}
 
 	dbMetric = utils.FromGModelToDBModel(metricGauge)
 	assert.NotNil(t, dbMetric)
 	assert.Equal(t, domain.Gauge, dbMetric.MType)
 	assert.InDelta(t, 3.14, *dbMetric.Value, 0.001)
+	assert.Equal(t, domain.Labels{"cpu": "0"}, dbMetric.Labels)
 }
 
 func TestFromDBModelToGModel(t *testing.T) {
@@ -47,12 +49,32 @@ func TestFromDBModelToGModel(t *testing.T) {
 	assert.Equal(t, pb.Metric_TYPE_COUNTER, gMetric.GetMtype())
 	assert.Equal(t, int64(42), gMetric.GetDelta())
 
-	dbMetricGauge := db.NewMetric("counter_metric", domain.Gauge, nil, float64Ptr(3.14))
+	dbMetricGauge := db.NewMetric("counter_metric", domain.Gauge, nil, float64Ptr(3.14)).
+		WithLabels(domain.Labels{"cpu": "0"})
 
 	gMetric = utils.FromDBModelToGModel(dbMetricGauge)
 	assert.NotNil(t, gMetric)
 	assert.Equal(t, pb.Metric_TYPE_GAUGE, gMetric.GetMtype())
 	assert.InDelta(t, 3.14, gMetric.GetValue(), 0.001)
+	assert.Equal(t, map[string]string{"cpu": "0"}, gMetric.GetLabels())
+}
+
+func TestDistributionRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	histogram := db.NewHistogramMetric("PauseNs", &domain.HistogramData{
+		Bounds: []float64{1, 2}, Counts: []uint64{1, 0, 2}, Sum: 7, Count: 3,
+	})
+	gMetric := utils.FromDBModelToGModel(histogram)
+	assert.Equal(t, pb.Metric_TYPE_HISTOGRAM, gMetric.GetMtype())
+	assert.Equal(t, []uint64{1, 0, 2}, gMetric.GetHistogram().GetCounts())
+	assert.Equal(t, histogram, utils.FromGModelToDBModel(gMetric))
+
+	summary := db.NewSummaryMetric("ReportLatency", domain.NewSummary([]float64{0.5}, []float64{1, 3}))
+	gMetric = utils.FromDBModelToGModel(summary)
+	assert.Equal(t, pb.Metric_TYPE_SUMMARY, gMetric.GetMtype())
+	assert.InDelta(t, 1, gMetric.GetSummary().GetQuantiles()[0].GetValue(), 0.001)
+	assert.Equal(t, summary, utils.FromGModelToDBModel(gMetric))
 }
 
 // Helper function to create float64 pointer.
@@ -1,14 +1,58 @@
 package utils
 
 import (
+	"bytes"
 	"crypto/hmac"
+	"crypto/rand"
 	"crypto/sha256"
 	"encoding/hex"
+	"strconv"
 )
 
+const (
+	// TimestampHeader - the HTTP header and the gRPC metadata key carrying the unix time a request was signed at.
+	TimestampHeader = "X-Timestamp"
+	// NonceHeader - the HTTP header and the gRPC metadata key carrying the random nonce of a request.
+	NonceHeader = "X-Nonce"
+)
+
+// nonceSize is the number of random bytes of a nonce.
+const nonceSize = 16
+
 func CalculateHash(key string, payload []byte) string {
 	h := hmac.New(sha256.New, []byte(key))
 	h.Write(payload)
 
 	return hex.EncodeToString(h.Sum(nil))
 }
+
+// SignedPayload returns the material a request is signed over: the method, the path, the timestamp and the nonce
+// on separate lines followed by the body, so a captured body cannot be replayed later or against another route.
+// gRPC calls are signed with the POST method and the full method name as the path.
+func SignedPayload(method, path, timestamp, nonce string, body []byte) []byte {
+	var buf bytes.Buffer
+
+	buf.Grow(len(method) + len(path) + len(timestamp) + len(nonce) + len(body) + 4) //nolint:mnd
+	for _, line := range []string{method, path, timestamp, nonce} {
+		buf.WriteString(line)
+		buf.WriteByte('\n')
+	}
+	buf.Write(body)
+
+	return buf.Bytes()
+}
+
+// NewNonce returns a random hex nonce.
+func NewNonce() string {
+	nonce := make([]byte, nonceSize)
+	// crypto/rand does not fail on the supported platforms
+	_, _ = rand.Read(nonce)
+
+	return hex.EncodeToString(nonce)
+}
+
+// StreamNonce returns the nonce a message of a stream is signed with, the nonce of the stream
+// followed by the sequence number of the message, so messages cannot be replayed within the stream.
+func StreamNonce(nonce string, seq uint64) string {
+	return nonce + "." + strconv.FormatUint(seq, 10)
+}
@@ -23,3 +23,14 @@ func TestCalculateHash(t *testing.T) {
 	actualHash := utils.CalculateHash(key, payload)
 	assert.Equal(t, expectedHash, actualHash)
 }
+
+func TestSignedPayload(t *testing.T) {
+	t.Parallel()
+
+	payload := utils.SignedPayload("POST", "/updates/", "1700000000", "abc", []byte(`{"id":"a"}`))
+	assert.Equal(t, "POST\n/updates/\n1700000000\nabc\n{\"id\":\"a\"}", string(payload))
+
+	assert.Equal(t, "abc.3", utils.StreamNonce("abc", 3))
+	assert.Len(t, utils.NewNonce(), 32)
+	assert.NotEqual(t, utils.NewNonce(), utils.NewNonce())
+}
@@ -66,5 +66,5 @@ func ReplaceValues[T any](source T, target T) {
 
 // isZeroValue verifies whether the field is empty or not.
 func isZeroValue(v reflect.Value) bool {
-	return v.Interface() == reflect.Zero(v.Type()).Interface()
+	return v.IsZero()
 }
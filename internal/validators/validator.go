@@ -50,6 +50,15 @@ func (v *MValidatorImpl) FromVars(mName domain.MetricName, mType domain.MetricTy
 			MetricID: "",
 			Delta:    nil,
 		},
+		HistogramMetric: db.HistogramMetric{
+			MetricID:  "",
+			Histogram: nil,
+		},
+		SummaryMetric: db.SummaryMetric{
+			MetricID: "",
+			Summary:  nil,
+		},
+		Labels: nil,
 	}
 	// Retrieving variables
 	if len(mName) == 0 {
@@ -59,6 +68,10 @@ func (v *MValidatorImpl) FromVars(mName domain.MetricName, mType domain.MetricTy
 	if len(mType) == 0 {
 		return nil, errors.New("failed to retrieve mType path param")
 	}
+
+	if mType.IsDistribution() {
+		return nil, fmt.Errorf("metric type %s cannot be set from a single value, send it as JSON", mType)
+	}
 	// Assigning values
 	metric.ID = mName
 
@@ -114,6 +127,15 @@ func (v *MValidatorImpl) FromBody(body io.ReadCloser) (*db.Metric, error) {
 			MetricID: "",
 			Delta:    nil,
 		},
+		HistogramMetric: db.HistogramMetric{
+			MetricID:  "",
+			Histogram: nil,
+		},
+		SummaryMetric: db.SummaryMetric{
+			MetricID: "",
+			Summary:  nil,
+		},
+		Labels: nil,
 	}
 
 	err := v.json.NewDecoder(body).Decode(metric)
@@ -121,16 +143,8 @@ func (v *MValidatorImpl) FromBody(body io.ReadCloser) (*db.Metric, error) {
 		return nil, errors.Wrap(err, "failed to parse metric json")
 	}
 
-	if metric.MType != domain.Counter && metric.MType != domain.Gauge {
-		return nil, fmt.Errorf("failed to validate metric type: %s", metric.MType)
-	}
-
-	if metric.MType == domain.Counter {
-		metric.Value = nil
-	}
-
-	if metric.MType == domain.Gauge {
-		metric.Delta = nil
+	if err := validateBody(metric); err != nil {
+		return nil, err
 	}
 
 	return metric, nil
@@ -146,20 +160,47 @@ func (v *MValidatorImpl) ManyFromBody(body io.ReadCloser) ([]*db.Metric, error)
 	}
 
 	for _, metric := range metrics {
-		if metric.MType != domain.Counter && metric.MType != domain.Gauge {
-			return nil, fmt.Errorf("failed to validate metric type: %s", metric.MType)
+		if err := validateBody(metric); err != nil {
+			return nil, err
 		}
+	}
 
-		if metric.MType == domain.Counter {
-			metric.Value = nil
-		}
+	return metrics, nil
+}
 
-		if metric.MType == domain.Gauge {
-			metric.Delta = nil
-		}
+// validateBody checks the type, the labels and the distribution of a decoded metric,
+// the fields not belonging to its type are dropped.
+func validateBody(metric *db.Metric) error {
+	switch metric.MType {
+	case domain.Counter:
+		metric.Value = nil
+		metric.Histogram = nil
+		metric.Summary = nil
+	case domain.Gauge:
+		metric.Delta = nil
+		metric.Histogram = nil
+		metric.Summary = nil
+	case domain.Histogram:
+		metric.Delta = nil
+		metric.Value = nil
+		metric.Summary = nil
+	case domain.Summary:
+		metric.Delta = nil
+		metric.Value = nil
+		metric.Histogram = nil
+	default:
+		return fmt.Errorf("failed to validate metric type: %s", metric.MType)
 	}
 
-	return metrics, nil
+	if err := metric.Labels.Validate(); err != nil {
+		return errors.Wrap(err, "failed to validate metric labels")
+	}
+
+	if err := metric.ValidateDistribution(); err != nil {
+		return errors.Wrap(err, "failed to validate metric distribution")
+	}
+
+	return nil
 }
 
 func (v *MValidatorImpl) ValidateStructure(metric *db.Metric) error {
@@ -3,6 +3,7 @@ package validators_test
 import (
 	"bytes"
 	"io"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -122,6 +123,41 @@ func TestMValidatorImpl_FromBody(t *testing.T) {
 			body:    `{"id":"test_metric","type":"invalid","delta":123}`,
 			wantErr: true,
 		},
+		{
+			name: "Valid labeled metric",
+			body: `{"id":"CPUutilization","type":"gauge","value":1.5,"labels":{"cpu":"0"}}`,
+			want: db.NewMetric("CPUutilization", domain.Gauge, nil, float64Ptr(1.5)).
+				WithLabels(domain.Labels{"cpu": "0"}),
+			wantErr: false,
+		},
+		{
+			name: "Valid histogram metric",
+			body: `{"id":"PauseNs","type":"histogram","value":1,"histogram":{"bounds":[1],"counts":[2,1],"sum":4,"count":3}}`,
+			want: db.NewHistogramMetric("PauseNs", &domain.HistogramData{
+				Bounds: []float64{1}, Counts: []uint64{2, 1}, Sum: 4, Count: 3,
+			}),
+			wantErr: false,
+		},
+		{
+			name:    "Histogram buckets not matching count",
+			body:    `{"id":"PauseNs","type":"histogram","histogram":{"bounds":[1],"counts":[2,1],"sum":4,"count":5}}`,
+			wantErr: true,
+		},
+		{
+			name:    "Summary with invalid quantile",
+			body:    `{"id":"Latency","type":"summary","summary":{"quantiles":[{"quantile":2,"value":1}],"sum":1,"count":1}}`,
+			wantErr: true,
+		},
+		{
+			name:    "Invalid label name",
+			body:    `{"id":"CPUutilization","type":"gauge","value":1.5,"labels":{"cpu-id":"0"}}`,
+			wantErr: true,
+		},
+		{
+			name:    "Labels too long",
+			body:    `{"id":"CPUutilization","type":"gauge","value":1.5,"labels":{"path":"` + strings.Repeat("a", domain.MaxLabelsLength) + `"}}`,
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
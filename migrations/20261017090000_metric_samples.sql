@@ -0,0 +1,29 @@
+-- +goose Up
+-- create "counter_samples" table
+CREATE TABLE "counter_samples" (
+  "metric_id" character varying(255) NOT NULL,
+  "delta" bigint NOT NULL,
+  "created_at" timestamptz NOT NULL DEFAULT now(),
+  CONSTRAINT "fk_counter_sample_metric" FOREIGN KEY ("metric_id") REFERENCES "mtr_metrics" ("id") ON UPDATE NO ACTION ON DELETE CASCADE
+);
+-- create index "counter_samples_metric_id_created_at_idx" to table: "counter_samples"
+CREATE INDEX "counter_samples_metric_id_created_at_idx" ON "counter_samples" ("metric_id", "created_at");
+-- create "gauge_samples" table
+CREATE TABLE "gauge_samples" (
+  "metric_id" character varying(255) NOT NULL,
+  "value" double precision NOT NULL,
+  "created_at" timestamptz NOT NULL DEFAULT now(),
+  CONSTRAINT "fk_gauge_sample_metric" FOREIGN KEY ("metric_id") REFERENCES "mtr_metrics" ("id") ON UPDATE NO ACTION ON DELETE CASCADE
+);
+-- create index "gauge_samples_metric_id_created_at_idx" to table: "gauge_samples"
+CREATE INDEX "gauge_samples_metric_id_created_at_idx" ON "gauge_samples" ("metric_id", "created_at");
+
+-- +goose Down
+-- reverse: create index "gauge_samples_metric_id_created_at_idx" to table: "gauge_samples"
+DROP INDEX "gauge_samples_metric_id_created_at_idx";
+-- reverse: create "gauge_samples" table
+DROP TABLE "gauge_samples";
+-- reverse: create index "counter_samples_metric_id_created_at_idx" to table: "counter_samples"
+DROP INDEX "counter_samples_metric_id_created_at_idx";
+-- reverse: create "counter_samples" table
+DROP TABLE "counter_samples";
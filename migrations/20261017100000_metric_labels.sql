@@ -0,0 +1,37 @@
+-- +goose Up
+-- modify "mtr_metrics" table
+ALTER TABLE "mtr_metrics" ALTER COLUMN "id" TYPE text;
+-- modify "counter_metrics" table
+ALTER TABLE "counter_metrics" ALTER COLUMN "metric_id" TYPE text;
+-- modify "gauge_metrics" table
+ALTER TABLE "gauge_metrics" ALTER COLUMN "metric_id" TYPE text;
+-- modify "counter_samples" table
+ALTER TABLE "counter_samples" ALTER COLUMN "metric_id" TYPE text;
+-- modify "gauge_samples" table
+ALTER TABLE "gauge_samples" ALTER COLUMN "metric_id" TYPE text;
+-- create "metric_labels" table
+CREATE TABLE "metric_labels" (
+  "metric_id" text NOT NULL,
+  "name" text NOT NULL,
+  "labels" jsonb NOT NULL DEFAULT '{}',
+  PRIMARY KEY ("metric_id"),
+  CONSTRAINT "fk_metric_labels_metric" FOREIGN KEY ("metric_id") REFERENCES "mtr_metrics" ("id") ON UPDATE NO ACTION ON DELETE CASCADE
+);
+-- create index "metric_labels_name_idx" to table: "metric_labels"
+CREATE INDEX "metric_labels_name_idx" ON "metric_labels" ("name");
+
+-- +goose Down
+-- reverse: create index "metric_labels_name_idx" to table: "metric_labels"
+DROP INDEX "metric_labels_name_idx";
+-- reverse: create "metric_labels" table
+DROP TABLE "metric_labels";
+-- reverse: modify "gauge_samples" table
+ALTER TABLE "gauge_samples" ALTER COLUMN "metric_id" TYPE character varying(255);
+-- reverse: modify "counter_samples" table
+ALTER TABLE "counter_samples" ALTER COLUMN "metric_id" TYPE character varying(255);
+-- reverse: modify "gauge_metrics" table
+ALTER TABLE "gauge_metrics" ALTER COLUMN "metric_id" TYPE character varying(255);
+-- reverse: modify "counter_metrics" table
+ALTER TABLE "counter_metrics" ALTER COLUMN "metric_id" TYPE character varying(255);
+-- reverse: modify "mtr_metrics" table
+ALTER TABLE "mtr_metrics" ALTER COLUMN "id" TYPE character varying(255);
@@ -0,0 +1,25 @@
+-- +goose Up
+-- modify "metric_type" enum
+ALTER TYPE "metric_type" ADD VALUE 'histogram';
+ALTER TYPE "metric_type" ADD VALUE 'summary';
+-- create "histogram_metrics" table
+CREATE TABLE "histogram_metrics" (
+  "metric_id" text NOT NULL,
+  "histogram" jsonb NOT NULL,
+  PRIMARY KEY ("metric_id"),
+  CONSTRAINT "fk_metric" FOREIGN KEY ("metric_id") REFERENCES "mtr_metrics" ("id") ON UPDATE NO ACTION ON DELETE CASCADE
+);
+-- create "summary_metrics" table
+CREATE TABLE "summary_metrics" (
+  "metric_id" text NOT NULL,
+  "summary" jsonb NOT NULL,
+  PRIMARY KEY ("metric_id"),
+  CONSTRAINT "fk_metric" FOREIGN KEY ("metric_id") REFERENCES "mtr_metrics" ("id") ON UPDATE NO ACTION ON DELETE CASCADE
+);
+
+-- +goose Down
+-- reverse: create "summary_metrics" table
+DROP TABLE "summary_metrics";
+-- reverse: create "histogram_metrics" table
+DROP TABLE "histogram_metrics";
+-- values of the "metric_type" enum cannot be dropped, the histogram and summary values are kept
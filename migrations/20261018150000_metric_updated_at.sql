@@ -0,0 +1,11 @@
+-- +goose Up
+-- modify "mtr_metrics" table
+ALTER TABLE "mtr_metrics" ADD COLUMN "updated_at" timestamptz NOT NULL DEFAULT now();
+-- create index "mtr_metrics_updated_at_idx" to table: "mtr_metrics"
+CREATE INDEX "mtr_metrics_updated_at_idx" ON "mtr_metrics" ("updated_at");
+
+-- +goose Down
+-- reverse: create index "mtr_metrics_updated_at_idx" to table: "mtr_metrics"
+DROP INDEX "mtr_metrics_updated_at_idx";
+-- reverse: modify "mtr_metrics" table
+ALTER TABLE "mtr_metrics" DROP COLUMN "updated_at";
@@ -0,0 +1,76 @@
+-- +goose Up
+-- modify "counter_metrics" table
+ALTER TABLE "counter_metrics" DROP CONSTRAINT "fk_metric", DROP CONSTRAINT "unique_counter_id", DROP CONSTRAINT "counter_metrics_pkey", ADD COLUMN "tenant" character varying(64) NOT NULL DEFAULT 'default';
+-- modify "gauge_metrics" table
+ALTER TABLE "gauge_metrics" DROP CONSTRAINT "fk_metric", DROP CONSTRAINT "unique_gauge_id", DROP CONSTRAINT "gauge_metrics_pkey", ADD COLUMN "tenant" character varying(64) NOT NULL DEFAULT 'default';
+-- modify "histogram_metrics" table
+ALTER TABLE "histogram_metrics" DROP CONSTRAINT "fk_metric", DROP CONSTRAINT "histogram_metrics_pkey", ADD COLUMN "tenant" character varying(64) NOT NULL DEFAULT 'default';
+-- modify "summary_metrics" table
+ALTER TABLE "summary_metrics" DROP CONSTRAINT "fk_metric", DROP CONSTRAINT "summary_metrics_pkey", ADD COLUMN "tenant" character varying(64) NOT NULL DEFAULT 'default';
+-- modify "metric_labels" table
+ALTER TABLE "metric_labels" DROP CONSTRAINT "fk_metric_labels_metric", DROP CONSTRAINT "metric_labels_pkey", ADD COLUMN "tenant" character varying(64) NOT NULL DEFAULT 'default';
+-- modify "counter_samples" table
+ALTER TABLE "counter_samples" DROP CONSTRAINT "fk_counter_sample_metric", ADD COLUMN "tenant" character varying(64) NOT NULL DEFAULT 'default';
+-- modify "gauge_samples" table
+ALTER TABLE "gauge_samples" DROP CONSTRAINT "fk_gauge_sample_metric", ADD COLUMN "tenant" character varying(64) NOT NULL DEFAULT 'default';
+-- drop index "mtr_metrics_id_idx" from table: "mtr_metrics"
+DROP INDEX "mtr_metrics_id_idx";
+-- drop index "mtr_metrics_updated_at_idx" from table: "mtr_metrics"
+DROP INDEX "mtr_metrics_updated_at_idx";
+-- modify "mtr_metrics" table
+ALTER TABLE "mtr_metrics" DROP CONSTRAINT "mtr_metrics_id_key", DROP CONSTRAINT "mtr_metrics_pkey", ADD COLUMN "tenant" character varying(64) NOT NULL DEFAULT 'default', ADD PRIMARY KEY ("tenant", "id", "type"), ADD CONSTRAINT "mtr_metrics_tenant_id_key" UNIQUE ("tenant", "id");
+-- create index "mtr_metrics_tenant_updated_at_idx" to table: "mtr_metrics"
+CREATE INDEX "mtr_metrics_tenant_updated_at_idx" ON "mtr_metrics" ("tenant", "updated_at");
+-- modify "counter_metrics" table
+ALTER TABLE "counter_metrics" ADD PRIMARY KEY ("tenant", "metric_id"), ADD CONSTRAINT "fk_metric" FOREIGN KEY ("tenant", "metric_id") REFERENCES "mtr_metrics" ("tenant", "id") ON UPDATE NO ACTION ON DELETE CASCADE;
+-- modify "gauge_metrics" table
+ALTER TABLE "gauge_metrics" ADD PRIMARY KEY ("tenant", "metric_id"), ADD CONSTRAINT "fk_metric" FOREIGN KEY ("tenant", "metric_id") REFERENCES "mtr_metrics" ("tenant", "id") ON UPDATE NO ACTION ON DELETE CASCADE;
+-- modify "histogram_metrics" table
+ALTER TABLE "histogram_metrics" ADD PRIMARY KEY ("tenant", "metric_id"), ADD CONSTRAINT "fk_metric" FOREIGN KEY ("tenant", "metric_id") REFERENCES "mtr_metrics" ("tenant", "id") ON UPDATE NO ACTION ON DELETE CASCADE;
+-- modify "summary_metrics" table
+ALTER TABLE "summary_metrics" ADD PRIMARY KEY ("tenant", "metric_id"), ADD CONSTRAINT "fk_metric" FOREIGN KEY ("tenant", "metric_id") REFERENCES "mtr_metrics" ("tenant", "id") ON UPDATE NO ACTION ON DELETE CASCADE;
+-- modify "metric_labels" table
+ALTER TABLE "metric_labels" ADD PRIMARY KEY ("tenant", "metric_id"), ADD CONSTRAINT "fk_metric_labels_metric" FOREIGN KEY ("tenant", "metric_id") REFERENCES "mtr_metrics" ("tenant", "id") ON UPDATE NO ACTION ON DELETE CASCADE;
+-- modify "counter_samples" table
+ALTER TABLE "counter_samples" ADD CONSTRAINT "fk_counter_sample_metric" FOREIGN KEY ("tenant", "metric_id") REFERENCES "mtr_metrics" ("tenant", "id") ON UPDATE NO ACTION ON DELETE CASCADE;
+-- modify "gauge_samples" table
+ALTER TABLE "gauge_samples" ADD CONSTRAINT "fk_gauge_sample_metric" FOREIGN KEY ("tenant", "metric_id") REFERENCES "mtr_metrics" ("tenant", "id") ON UPDATE NO ACTION ON DELETE CASCADE;
+-- drop index "counter_samples_metric_id_created_at_idx" from table: "counter_samples"
+DROP INDEX "counter_samples_metric_id_created_at_idx";
+-- create index "counter_samples_tenant_metric_id_created_at_idx" to table: "counter_samples"
+CREATE INDEX "counter_samples_tenant_metric_id_created_at_idx" ON "counter_samples" ("tenant", "metric_id", "created_at");
+-- drop index "gauge_samples_metric_id_created_at_idx" from table: "gauge_samples"
+DROP INDEX "gauge_samples_metric_id_created_at_idx";
+-- create index "gauge_samples_tenant_metric_id_created_at_idx" to table: "gauge_samples"
+CREATE INDEX "gauge_samples_tenant_metric_id_created_at_idx" ON "gauge_samples" ("tenant", "metric_id", "created_at");
+
+-- +goose Down
+-- the series of other tenants cannot be kept without the tenant in the keys, they are removed with their child rows
+DELETE FROM "mtr_metrics" WHERE "tenant" <> 'default';
+-- reverse: create index "gauge_samples_tenant_metric_id_created_at_idx" to table: "gauge_samples"
+DROP INDEX "gauge_samples_tenant_metric_id_created_at_idx";
+CREATE INDEX "gauge_samples_metric_id_created_at_idx" ON "gauge_samples" ("metric_id", "created_at");
+-- reverse: create index "counter_samples_tenant_metric_id_created_at_idx" to table: "counter_samples"
+DROP INDEX "counter_samples_tenant_metric_id_created_at_idx";
+CREATE INDEX "counter_samples_metric_id_created_at_idx" ON "counter_samples" ("metric_id", "created_at");
+-- reverse: modify the child tables
+ALTER TABLE "gauge_samples" DROP CONSTRAINT "fk_gauge_sample_metric", DROP COLUMN "tenant";
+ALTER TABLE "counter_samples" DROP CONSTRAINT "fk_counter_sample_metric", DROP COLUMN "tenant";
+ALTER TABLE "metric_labels" DROP CONSTRAINT "fk_metric_labels_metric", DROP CONSTRAINT "metric_labels_pkey", DROP COLUMN "tenant";
+ALTER TABLE "summary_metrics" DROP CONSTRAINT "fk_metric", DROP CONSTRAINT "summary_metrics_pkey", DROP COLUMN "tenant";
+ALTER TABLE "histogram_metrics" DROP CONSTRAINT "fk_metric", DROP CONSTRAINT "histogram_metrics_pkey", DROP COLUMN "tenant";
+ALTER TABLE "gauge_metrics" DROP CONSTRAINT "fk_metric", DROP CONSTRAINT "gauge_metrics_pkey", DROP COLUMN "tenant";
+ALTER TABLE "counter_metrics" DROP CONSTRAINT "fk_metric", DROP CONSTRAINT "counter_metrics_pkey", DROP COLUMN "tenant";
+-- reverse: modify "mtr_metrics" table
+DROP INDEX "mtr_metrics_tenant_updated_at_idx";
+ALTER TABLE "mtr_metrics" DROP CONSTRAINT "mtr_metrics_tenant_id_key", DROP CONSTRAINT "mtr_metrics_pkey", DROP COLUMN "tenant", ADD PRIMARY KEY ("id", "type"), ADD CONSTRAINT "mtr_metrics_id_key" UNIQUE ("id");
+CREATE INDEX "mtr_metrics_updated_at_idx" ON "mtr_metrics" ("updated_at");
+CREATE INDEX "mtr_metrics_id_idx" ON "mtr_metrics" ("id");
+-- reverse: restore the keys of the child tables
+ALTER TABLE "counter_metrics" ADD PRIMARY KEY ("metric_id"), ADD CONSTRAINT "unique_counter_id" UNIQUE ("metric_id"), ADD CONSTRAINT "fk_metric" FOREIGN KEY ("metric_id") REFERENCES "mtr_metrics" ("id") ON UPDATE NO ACTION ON DELETE CASCADE;
+ALTER TABLE "gauge_metrics" ADD PRIMARY KEY ("metric_id"), ADD CONSTRAINT "unique_gauge_id" UNIQUE ("metric_id"), ADD CONSTRAINT "fk_metric" FOREIGN KEY ("metric_id") REFERENCES "mtr_metrics" ("id") ON UPDATE NO ACTION ON DELETE CASCADE;
+ALTER TABLE "histogram_metrics" ADD PRIMARY KEY ("metric_id"), ADD CONSTRAINT "fk_metric" FOREIGN KEY ("metric_id") REFERENCES "mtr_metrics" ("id") ON UPDATE NO ACTION ON DELETE CASCADE;
+ALTER TABLE "summary_metrics" ADD PRIMARY KEY ("metric_id"), ADD CONSTRAINT "fk_metric" FOREIGN KEY ("metric_id") REFERENCES "mtr_metrics" ("id") ON UPDATE NO ACTION ON DELETE CASCADE;
+ALTER TABLE "metric_labels" ADD PRIMARY KEY ("metric_id"), ADD CONSTRAINT "fk_metric_labels_metric" FOREIGN KEY ("metric_id") REFERENCES "mtr_metrics" ("id") ON UPDATE NO ACTION ON DELETE CASCADE;
+ALTER TABLE "counter_samples" ADD CONSTRAINT "fk_counter_sample_metric" FOREIGN KEY ("metric_id") REFERENCES "mtr_metrics" ("id") ON UPDATE NO ACTION ON DELETE CASCADE;
+ALTER TABLE "gauge_samples" ADD CONSTRAINT "fk_gauge_sample_metric" FOREIGN KEY ("metric_id") REFERENCES "mtr_metrics" ("id") ON UPDATE NO ACTION ON DELETE CASCADE;
@@ -0,0 +1,74 @@
+-- +goose Up
+-- create mtr_metrics table
+CREATE TABLE mtr_metrics (
+  id text NOT NULL,
+  type text NOT NULL CHECK (type IN ('gauge', 'counter', 'histogram', 'summary')),
+  PRIMARY KEY (id, type),
+  CONSTRAINT mtr_metrics_id_key UNIQUE (id)
+);
+-- create counter_metrics table
+CREATE TABLE counter_metrics (
+  metric_id text NOT NULL,
+  delta integer NOT NULL,
+  PRIMARY KEY (metric_id),
+  CONSTRAINT fk_metric FOREIGN KEY (metric_id) REFERENCES mtr_metrics (id) ON DELETE CASCADE
+);
+-- create gauge_metrics table
+CREATE TABLE gauge_metrics (
+  metric_id text NOT NULL,
+  value real NOT NULL,
+  PRIMARY KEY (metric_id),
+  CONSTRAINT fk_metric FOREIGN KEY (metric_id) REFERENCES mtr_metrics (id) ON DELETE CASCADE
+);
+-- create histogram_metrics table
+CREATE TABLE histogram_metrics (
+  metric_id text NOT NULL,
+  histogram text NOT NULL,
+  PRIMARY KEY (metric_id),
+  CONSTRAINT fk_metric FOREIGN KEY (metric_id) REFERENCES mtr_metrics (id) ON DELETE CASCADE
+);
+-- create summary_metrics table
+CREATE TABLE summary_metrics (
+  metric_id text NOT NULL,
+  summary text NOT NULL,
+  PRIMARY KEY (metric_id),
+  CONSTRAINT fk_metric FOREIGN KEY (metric_id) REFERENCES mtr_metrics (id) ON DELETE CASCADE
+);
+-- create metric_labels table
+CREATE TABLE metric_labels (
+  metric_id text NOT NULL,
+  name text NOT NULL,
+  labels text NOT NULL DEFAULT '{}',
+  PRIMARY KEY (metric_id),
+  CONSTRAINT fk_metric_labels_metric FOREIGN KEY (metric_id) REFERENCES mtr_metrics (id) ON DELETE CASCADE
+);
+-- create index metric_labels_name_idx to table: metric_labels
+CREATE INDEX metric_labels_name_idx ON metric_labels (name);
+-- create counter_samples table, created_at holds unix nanoseconds
+CREATE TABLE counter_samples (
+  metric_id text NOT NULL,
+  delta integer NOT NULL,
+  created_at integer NOT NULL,
+  CONSTRAINT fk_counter_sample_metric FOREIGN KEY (metric_id) REFERENCES mtr_metrics (id) ON DELETE CASCADE
+);
+-- create index counter_samples_metric_id_created_at_idx to table: counter_samples
+CREATE INDEX counter_samples_metric_id_created_at_idx ON counter_samples (metric_id, created_at);
+-- create gauge_samples table, created_at holds unix nanoseconds
+CREATE TABLE gauge_samples (
+  metric_id text NOT NULL,
+  value real NOT NULL,
+  created_at integer NOT NULL,
+  CONSTRAINT fk_gauge_sample_metric FOREIGN KEY (metric_id) REFERENCES mtr_metrics (id) ON DELETE CASCADE
+);
+-- create index gauge_samples_metric_id_created_at_idx to table: gauge_samples
+CREATE INDEX gauge_samples_metric_id_created_at_idx ON gauge_samples (metric_id, created_at);
+
+-- +goose Down
+DROP TABLE gauge_samples;
+DROP TABLE counter_samples;
+DROP TABLE metric_labels;
+DROP TABLE summary_metrics;
+DROP TABLE histogram_metrics;
+DROP TABLE gauge_metrics;
+DROP TABLE counter_metrics;
+DROP TABLE mtr_metrics;
@@ -0,0 +1,11 @@
+-- +goose Up
+-- add updated_at to mtr_metrics, it holds unix nanoseconds of the last write of the series
+ALTER TABLE mtr_metrics ADD COLUMN updated_at integer NOT NULL DEFAULT 0;
+-- the stored series count as written by the migration
+UPDATE mtr_metrics SET updated_at = CAST(strftime('%s', 'now') AS integer) * 1000000000;
+-- create index mtr_metrics_updated_at_idx to table: mtr_metrics
+CREATE INDEX mtr_metrics_updated_at_idx ON mtr_metrics (updated_at);
+
+-- +goose Down
+DROP INDEX mtr_metrics_updated_at_idx;
+ALTER TABLE mtr_metrics DROP COLUMN updated_at;
@@ -0,0 +1,185 @@
+-- +goose Up
+-- SQLite cannot change the keys of a table, the tables are rebuilt with the tenant in their keys.
+-- The new tables reference mtr_metrics_new, renaming it rewrites the references of the child tables.
+-- create mtr_metrics_new table
+CREATE TABLE mtr_metrics_new (
+  tenant text NOT NULL DEFAULT 'default',
+  id text NOT NULL,
+  type text NOT NULL CHECK (type IN ('gauge', 'counter', 'histogram', 'summary')),
+  updated_at integer NOT NULL DEFAULT 0,
+  PRIMARY KEY (tenant, id, type),
+  CONSTRAINT mtr_metrics_tenant_id_key UNIQUE (tenant, id)
+);
+INSERT INTO mtr_metrics_new (tenant, id, type, updated_at) SELECT 'default', id, type, updated_at FROM mtr_metrics;
+-- create counter_metrics_new table
+CREATE TABLE counter_metrics_new (
+  tenant text NOT NULL DEFAULT 'default',
+  metric_id text NOT NULL,
+  delta integer NOT NULL,
+  PRIMARY KEY (tenant, metric_id),
+  CONSTRAINT fk_metric FOREIGN KEY (tenant, metric_id) REFERENCES mtr_metrics_new (tenant, id) ON DELETE CASCADE
+);
+INSERT INTO counter_metrics_new (tenant, metric_id, delta) SELECT 'default', metric_id, delta FROM counter_metrics;
+-- create gauge_metrics_new table
+CREATE TABLE gauge_metrics_new (
+  tenant text NOT NULL DEFAULT 'default',
+  metric_id text NOT NULL,
+  value real NOT NULL,
+  PRIMARY KEY (tenant, metric_id),
+  CONSTRAINT fk_metric FOREIGN KEY (tenant, metric_id) REFERENCES mtr_metrics_new (tenant, id) ON DELETE CASCADE
+);
+INSERT INTO gauge_metrics_new (tenant, metric_id, value) SELECT 'default', metric_id, value FROM gauge_metrics;
+-- create histogram_metrics_new table
+CREATE TABLE histogram_metrics_new (
+  tenant text NOT NULL DEFAULT 'default',
+  metric_id text NOT NULL,
+  histogram text NOT NULL,
+  PRIMARY KEY (tenant, metric_id),
+  CONSTRAINT fk_metric FOREIGN KEY (tenant, metric_id) REFERENCES mtr_metrics_new (tenant, id) ON DELETE CASCADE
+);
+INSERT INTO histogram_metrics_new (tenant, metric_id, histogram) SELECT 'default', metric_id, histogram FROM histogram_metrics;
+-- create summary_metrics_new table
+CREATE TABLE summary_metrics_new (
+  tenant text NOT NULL DEFAULT 'default',
+  metric_id text NOT NULL,
+  summary text NOT NULL,
+  PRIMARY KEY (tenant, metric_id),
+  CONSTRAINT fk_metric FOREIGN KEY (tenant, metric_id) REFERENCES mtr_metrics_new (tenant, id) ON DELETE CASCADE
+);
+INSERT INTO summary_metrics_new (tenant, metric_id, summary) SELECT 'default', metric_id, summary FROM summary_metrics;
+-- create metric_labels_new table
+CREATE TABLE metric_labels_new (
+  tenant text NOT NULL DEFAULT 'default',
+  metric_id text NOT NULL,
+  name text NOT NULL,
+  labels text NOT NULL DEFAULT '{}',
+  PRIMARY KEY (tenant, metric_id),
+  CONSTRAINT fk_metric_labels_metric FOREIGN KEY (tenant, metric_id) REFERENCES mtr_metrics_new (tenant, id) ON DELETE CASCADE
+);
+INSERT INTO metric_labels_new (tenant, metric_id, name, labels) SELECT 'default', metric_id, name, labels FROM metric_labels;
+-- create counter_samples_new table, created_at holds unix nanoseconds
+CREATE TABLE counter_samples_new (
+  tenant text NOT NULL DEFAULT 'default',
+  metric_id text NOT NULL,
+  delta integer NOT NULL,
+  created_at integer NOT NULL,
+  CONSTRAINT fk_counter_sample_metric FOREIGN KEY (tenant, metric_id) REFERENCES mtr_metrics_new (tenant, id) ON DELETE CASCADE
+);
+INSERT INTO counter_samples_new (tenant, metric_id, delta, created_at) SELECT 'default', metric_id, delta, created_at FROM counter_samples;
+-- create gauge_samples_new table, created_at holds unix nanoseconds
+CREATE TABLE gauge_samples_new (
+  tenant text NOT NULL DEFAULT 'default',
+  metric_id text NOT NULL,
+  value real NOT NULL,
+  created_at integer NOT NULL,
+  CONSTRAINT fk_gauge_sample_metric FOREIGN KEY (tenant, metric_id) REFERENCES mtr_metrics_new (tenant, id) ON DELETE CASCADE
+);
+INSERT INTO gauge_samples_new (tenant, metric_id, value, created_at) SELECT 'default', metric_id, value, created_at FROM gauge_samples;
+-- drop the old tables, the child tables go first, so dropping mtr_metrics cascades to nothing
+DROP TABLE gauge_samples;
+DROP TABLE counter_samples;
+DROP TABLE metric_labels;
+DROP TABLE summary_metrics;
+DROP TABLE histogram_metrics;
+DROP TABLE gauge_metrics;
+DROP TABLE counter_metrics;
+DROP TABLE mtr_metrics;
+-- rename the new tables
+ALTER TABLE mtr_metrics_new RENAME TO mtr_metrics;
+ALTER TABLE counter_metrics_new RENAME TO counter_metrics;
+ALTER TABLE gauge_metrics_new RENAME TO gauge_metrics;
+ALTER TABLE histogram_metrics_new RENAME TO histogram_metrics;
+ALTER TABLE summary_metrics_new RENAME TO summary_metrics;
+ALTER TABLE metric_labels_new RENAME TO metric_labels;
+ALTER TABLE counter_samples_new RENAME TO counter_samples;
+ALTER TABLE gauge_samples_new RENAME TO gauge_samples;
+-- create index mtr_metrics_tenant_updated_at_idx to table: mtr_metrics
+CREATE INDEX mtr_metrics_tenant_updated_at_idx ON mtr_metrics (tenant, updated_at);
+-- create index metric_labels_name_idx to table: metric_labels
+CREATE INDEX metric_labels_name_idx ON metric_labels (name);
+-- create index counter_samples_tenant_metric_id_created_at_idx to table: counter_samples
+CREATE INDEX counter_samples_tenant_metric_id_created_at_idx ON counter_samples (tenant, metric_id, created_at);
+-- create index gauge_samples_tenant_metric_id_created_at_idx to table: gauge_samples
+CREATE INDEX gauge_samples_tenant_metric_id_created_at_idx ON gauge_samples (tenant, metric_id, created_at);
+
+-- +goose Down
+-- the series of other tenants cannot be kept without the tenant in the keys, they are removed with their child rows
+DELETE FROM mtr_metrics WHERE tenant <> 'default';
+CREATE TABLE mtr_metrics_old (
+  id text NOT NULL,
+  type text NOT NULL CHECK (type IN ('gauge', 'counter', 'histogram', 'summary')),
+  updated_at integer NOT NULL DEFAULT 0,
+  PRIMARY KEY (id, type),
+  CONSTRAINT mtr_metrics_id_key UNIQUE (id)
+);
+INSERT INTO mtr_metrics_old (id, type, updated_at) SELECT id, type, updated_at FROM mtr_metrics;
+CREATE TABLE counter_metrics_old (
+  metric_id text NOT NULL,
+  delta integer NOT NULL,
+  PRIMARY KEY (metric_id),
+  CONSTRAINT fk_metric FOREIGN KEY (metric_id) REFERENCES mtr_metrics_old (id) ON DELETE CASCADE
+);
+INSERT INTO counter_metrics_old (metric_id, delta) SELECT metric_id, delta FROM counter_metrics;
+CREATE TABLE gauge_metrics_old (
+  metric_id text NOT NULL,
+  value real NOT NULL,
+  PRIMARY KEY (metric_id),
+  CONSTRAINT fk_metric FOREIGN KEY (metric_id) REFERENCES mtr_metrics_old (id) ON DELETE CASCADE
+);
+INSERT INTO gauge_metrics_old (metric_id, value) SELECT metric_id, value FROM gauge_metrics;
+CREATE TABLE histogram_metrics_old (
+  metric_id text NOT NULL,
+  histogram text NOT NULL,
+  PRIMARY KEY (metric_id),
+  CONSTRAINT fk_metric FOREIGN KEY (metric_id) REFERENCES mtr_metrics_old (id) ON DELETE CASCADE
+);
+INSERT INTO histogram_metrics_old (metric_id, histogram) SELECT metric_id, histogram FROM histogram_metrics;
+CREATE TABLE summary_metrics_old (
+  metric_id text NOT NULL,
+  summary text NOT NULL,
+  PRIMARY KEY (metric_id),
+  CONSTRAINT fk_metric FOREIGN KEY (metric_id) REFERENCES mtr_metrics_old (id) ON DELETE CASCADE
+);
+INSERT INTO summary_metrics_old (metric_id, summary) SELECT metric_id, summary FROM summary_metrics;
+CREATE TABLE metric_labels_old (
+  metric_id text NOT NULL,
+  name text NOT NULL,
+  labels text NOT NULL DEFAULT '{}',
+  PRIMARY KEY (metric_id),
+  CONSTRAINT fk_metric_labels_metric FOREIGN KEY (metric_id) REFERENCES mtr_metrics_old (id) ON DELETE CASCADE
+);
+INSERT INTO metric_labels_old (metric_id, name, labels) SELECT metric_id, name, labels FROM metric_labels;
+CREATE TABLE counter_samples_old (
+  metric_id text NOT NULL,
+  delta integer NOT NULL,
+  created_at integer NOT NULL,
+  CONSTRAINT fk_counter_sample_metric FOREIGN KEY (metric_id) REFERENCES mtr_metrics_old (id) ON DELETE CASCADE
+);
+INSERT INTO counter_samples_old (metric_id, delta, created_at) SELECT metric_id, delta, created_at FROM counter_samples;
+CREATE TABLE gauge_samples_old (
+  metric_id text NOT NULL,
+  value real NOT NULL,
+  created_at integer NOT NULL,
+  CONSTRAINT fk_gauge_sample_metric FOREIGN KEY (metric_id) REFERENCES mtr_metrics_old (id) ON DELETE CASCADE
+);
+INSERT INTO gauge_samples_old (metric_id, value, created_at) SELECT metric_id, value, created_at FROM gauge_samples;
+DROP TABLE gauge_samples;
+DROP TABLE counter_samples;
+DROP TABLE metric_labels;
+DROP TABLE summary_metrics;
+DROP TABLE histogram_metrics;
+DROP TABLE gauge_metrics;
+DROP TABLE counter_metrics;
+DROP TABLE mtr_metrics;
+ALTER TABLE mtr_metrics_old RENAME TO mtr_metrics;
+ALTER TABLE counter_metrics_old RENAME TO counter_metrics;
+ALTER TABLE gauge_metrics_old RENAME TO gauge_metrics;
+ALTER TABLE histogram_metrics_old RENAME TO histogram_metrics;
+ALTER TABLE summary_metrics_old RENAME TO summary_metrics;
+ALTER TABLE metric_labels_old RENAME TO metric_labels;
+ALTER TABLE counter_samples_old RENAME TO counter_samples;
+ALTER TABLE gauge_samples_old RENAME TO gauge_samples;
+CREATE INDEX mtr_metrics_updated_at_idx ON mtr_metrics (updated_at);
+CREATE INDEX metric_labels_name_idx ON metric_labels (name);
+CREATE INDEX counter_samples_metric_id_created_at_idx ON counter_samples (metric_id, created_at);
+CREATE INDEX gauge_samples_metric_id_created_at_idx ON gauge_samples (metric_id, created_at);
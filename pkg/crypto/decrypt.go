@@ -10,7 +10,8 @@ import (
 
 type Decryption struct {
 	PrivateKey *rsa.PrivateKey
-	Nonce      [12]byte
+	// Legacy accepts the messages of the legacy format next to the envelopes while the agents migrate.
+	Legacy bool
 }
 
 func NewDecryption(privateKeyPath string) (*Decryption, error) {
@@ -22,10 +23,36 @@ func NewDecryption(privateKeyPath string) (*Decryption, error) {
 		return nil, err
 	}
 
-	return &Decryption{PrivateKey: PrivateKey, Nonce: [12]byte{}}, nil
+	return &Decryption{PrivateKey: PrivateKey, Legacy: true}, nil
 }
 
-func (d *Decryption) Decrypt(encrypted []byte) ([]byte, error) {
+// Decrypt opens the envelope of a message sent to the route, see EnvelopeVersion.
+// The messages of the legacy format are accepted while Legacy is set, their route is not checked.
+func (d *Decryption) Decrypt(encrypted []byte, route string) ([]byte, error) {
+	if !isEnvelope(encrypted) {
+		if !d.Legacy {
+			return encrypted, ErrLegacyFormat
+		}
+
+		return d.decryptLegacy(encrypted)
+	}
+
+	decrypted, err := open(d.PrivateKey, encrypted, route)
+	if err == nil {
+		return decrypted, nil
+	}
+
+	if d.Legacy {
+		if legacy, legacyErr := d.decryptLegacy(encrypted); legacyErr == nil {
+			return legacy, nil
+		}
+	}
+
+	return encrypted, err
+}
+
+// decryptLegacy decrypts a message of the legacy format.
+func (d *Decryption) decryptLegacy(encrypted []byte) ([]byte, error) {
 	newKey, err := NewKey()
 	if err != nil {
 		return encrypted, err
@@ -46,7 +73,9 @@ func (d *Decryption) Decrypt(encrypted []byte) ([]byte, error) {
 		return encrypted, errors.Wrap(err, "failed to get aesgcm")
 	}
 
-	decrypted, err := aesgcm.Open(nil, d.Nonce[:], encrypted[EncryptedSessionKeySize:], nil)
+	var legacyNonce [nonceSize]byte
+
+	decrypted, err := aesgcm.Open(nil, legacyNonce[:], encrypted[EncryptedSessionKeySize:], nil)
 	if err != nil {
 		return decrypted, errors.Wrap(err, "failed to decrypt")
 	}
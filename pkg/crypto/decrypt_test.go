@@ -37,7 +37,7 @@ func TestDecryption_Decrypt(t *testing.T) {
 		t.Errorf("failed to close writer: %s", err)
 	}
 
-	encrypted, err := encryption.Encrypt(buf.Bytes())
+	encrypted, err := encryption.Encrypt(buf.Bytes(), "/updates/")
 	require.NoError(t, err)
 
 	reader, err := gzip.NewReader(&buf)
@@ -52,7 +52,7 @@ func TestDecryption_Decrypt(t *testing.T) {
 
 	type fields struct {
 		PrivateKey *rsa.PrivateKey
-		Nonce      [12]byte
+		Legacy     bool
 	}
 	type args struct {
 		encrypted []byte
@@ -80,9 +80,9 @@ func TestDecryption_Decrypt(t *testing.T) {
 
 			d := &crypto.Decryption{
 				PrivateKey: tt.fields.PrivateKey,
-				Nonce:      tt.fields.Nonce,
+				Legacy:     tt.fields.Legacy,
 			}
-			decrypted, err := d.Decrypt(tt.args.encrypted)
+			decrypted, err := d.Decrypt(tt.args.encrypted, "/updates/")
 			if (err != nil) != tt.wantErr {
 				t.Errorf("Decryption.Decrypt() error = %v, wantErr %v", err, tt.wantErr)
 
@@ -1,8 +1,6 @@
 package crypto
 
 import (
-	"crypto/aes"
-	"crypto/cipher"
 	"crypto/rsa"
 
 	"github.com/pkg/errors"
@@ -10,7 +8,6 @@ import (
 
 type Encryption struct {
 	PublicKey *rsa.PublicKey
-	Nonce     [12]byte
 }
 
 func NewEncryption(publicKeyPath string) (*Encryption, error) {
@@ -22,29 +19,16 @@ func NewEncryption(publicKeyPath string) (*Encryption, error) {
 		return nil, errors.Wrap(err, "failed to get public key")
 	}
 
-	return &Encryption{PublicKey: PublicKey, Nonce: [12]byte{}}, nil
+	return &Encryption{PublicKey: PublicKey}, nil
 }
 
-func (e *Encryption) Encrypt(payload []byte) ([]byte, error) {
-	key, err := NewKey()
-	if err != nil {
-		return payload, errors.Wrap(err, "failed to get new key")
-	}
-	aesblock, err := aes.NewCipher(key)
-	if err != nil {
-		return payload, errors.Wrap(err, "failed to get aes block")
-	}
-	aesgcm, err := cipher.NewGCM(aesblock)
-	if err != nil {
-		return payload, errors.Wrap(err, "failed to get aesgcm")
-	}
-	eKey, err := key.Encrypt(e.PublicKey)
+// Encrypt writes the envelope of the payload sent to the route, see EnvelopeVersion.
+// The route is the HTTP path or the full gRPC method the payload is sent to.
+func (e *Encryption) Encrypt(payload []byte, route string) ([]byte, error) {
+	encrypted, err := seal(e.PublicKey, payload, route)
 	if err != nil {
 		return payload, errors.Wrap(err, "failed to encrypt")
 	}
-	encrypted := make([]byte, 0, len(payload)+EncryptedSessionKeySize+len(key))
-	encrypted = append(encrypted, eKey...)
-	encrypted = append(encrypted, aesgcm.Seal(nil, e.Nonce[:], payload, nil)...)
 
 	return encrypted, nil
 }
@@ -25,7 +25,6 @@ func TestEncryption_Encrypt(t *testing.T) {
 
 	type fields struct {
 		PublicKey *rsa.PublicKey
-		Nonce     [12]byte
 	}
 	type args struct {
 		payload []byte
@@ -53,16 +52,15 @@ func TestEncryption_Encrypt(t *testing.T) {
 
 			e := &crypto.Encryption{
 				PublicKey: tt.fields.PublicKey,
-				Nonce:     tt.fields.Nonce,
 			}
-			encrypted, err := e.Encrypt(tt.args.payload)
+			encrypted, err := e.Encrypt(tt.args.payload, "/update/")
 			if (err != nil) != tt.wantErr {
 				t.Errorf("Encryption.Encrypt() error = %v, wantErr %v", err, tt.wantErr)
 
 				return
 			}
 
-			got, err := decryption.Decrypt(encrypted)
+			got, err := decryption.Decrypt(encrypted, "/update/")
 			if (err != nil) != tt.wantErr {
 				t.Errorf("Encryption.Encrypt() error = %v, wantErr %v", err, tt.wantErr)
 
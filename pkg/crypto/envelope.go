@@ -0,0 +1,138 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/binary"
+
+	"github.com/pkg/errors"
+)
+
+// EnvelopeVersion is the version of the envelope written by Encryption.
+//
+// The envelope is laid out as the magic, the version byte, the length of the wrapped session key as uint16,
+// the session key wrapped with RSA-OAEP SHA-256, the random AES-GCM nonce and the ciphertext.
+// The header and the route the message is sent to are the associated data of the ciphertext,
+// so an envelope cannot be replayed against another route.
+//
+// The legacy format of version 1 is the session key wrapped with PKCS#1 v1.5 followed by the ciphertext
+// sealed with a zero nonce, it has no header.
+const EnvelopeVersion byte = 2
+
+const (
+	nonceSize      = 12
+	keyLengthSize  = 2
+	envelopeHeader = len("MENV") + 1 + keyLengthSize
+)
+
+//nolint:gochecknoglobals
+var envelopeMagic = []byte("MENV")
+
+var (
+	// ErrMalformedEnvelope is returned for an envelope too short for its header.
+	ErrMalformedEnvelope = errors.New("malformed envelope")
+	// ErrUnsupportedVersion is returned for an envelope of an unknown version.
+	ErrUnsupportedVersion = errors.New("unsupported envelope version")
+	// ErrLegacyFormat is returned for a message of the legacy format when it is no longer accepted.
+	ErrLegacyFormat = errors.New("legacy encryption format is not accepted")
+)
+
+// seal writes the envelope of the payload sent to the route.
+func seal(public *rsa.PublicKey, payload []byte, route string) ([]byte, error) {
+	key, err := NewKey()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get new key")
+	}
+
+	wrapped, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, public, key, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to wrap session key")
+	}
+
+	nonce, err := GenerateRandom(nonceSize)
+	if err != nil {
+		return nil, err
+	}
+
+	aesgcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	envelope := make([]byte, 0, envelopeHeader+len(wrapped)+nonceSize+len(payload)+aesgcm.Overhead())
+	envelope = append(envelope, envelopeMagic...)
+	envelope = append(envelope, EnvelopeVersion)
+	envelope = binary.BigEndian.AppendUint16(envelope, uint16(len(wrapped))) //nolint:gosec
+	envelope = append(envelope, wrapped...)
+	envelope = append(envelope, nonce...)
+
+	return aesgcm.Seal(envelope, nonce, payload, associatedData(envelope, route)), nil
+}
+
+// open reads the envelope of a message sent to the route.
+func open(private *rsa.PrivateKey, envelope []byte, route string) ([]byte, error) {
+	if len(envelope) < envelopeHeader {
+		return nil, ErrMalformedEnvelope
+	}
+
+	if version := envelope[len(envelopeMagic)]; version != EnvelopeVersion {
+		return nil, errors.Wrapf(ErrUnsupportedVersion, "%d", version)
+	}
+
+	keyLength := int(binary.BigEndian.Uint16(envelope[len(envelopeMagic)+1:]))
+	headerLength := envelopeHeader + keyLength + nonceSize
+	if len(envelope) < headerLength {
+		return nil, ErrMalformedEnvelope
+	}
+
+	wrapped := envelope[envelopeHeader : envelopeHeader+keyLength]
+	key, err := rsa.DecryptOAEP(sha256.New(), nil, private, wrapped, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to unwrap session key")
+	}
+
+	aesgcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	header := envelope[:headerLength]
+	decrypted, err := aesgcm.Open(nil, header[headerLength-nonceSize:], envelope[headerLength:],
+		associatedData(header, route))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decrypt")
+	}
+
+	return decrypted, nil
+}
+
+// isEnvelope reports whether the message starts with the envelope magic, a legacy message may start with it
+// by chance, so it is also tried as a legacy message when the envelope does not open.
+func isEnvelope(message []byte) bool {
+	return bytes.HasPrefix(message, envelopeMagic)
+}
+
+func associatedData(header []byte, route string) []byte {
+	data := make([]byte, 0, len(header)+len(route))
+	data = append(data, header...)
+
+	return append(data, route...)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	aesblock, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get aes block")
+	}
+
+	aesgcm, err := cipher.NewGCM(aesblock)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get aesgcm")
+	}
+
+	return aesgcm, nil
+}
@@ -0,0 +1,95 @@
+package crypto_test
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/npavlov/go-metrics-service/pkg/crypto"
+)
+
+// legacyEncrypt writes a message of the legacy format the older agents send.
+func legacyEncrypt(t *testing.T, encryption *crypto.Encryption, payload []byte) []byte {
+	t.Helper()
+
+	key, err := crypto.NewKey()
+	require.NoError(t, err)
+
+	wrapped, err := key.Encrypt(encryption.PublicKey)
+	require.NoError(t, err)
+
+	aesblock, err := aes.NewCipher(key)
+	require.NoError(t, err)
+	aesgcm, err := cipher.NewGCM(aesblock)
+	require.NoError(t, err)
+
+	return aesgcm.Seal(wrapped, make([]byte, aesgcm.NonceSize()), payload, nil)
+}
+
+func TestEnvelope(t *testing.T) {
+	t.Parallel()
+
+	encryption, err := crypto.NewEncryption(filepath.Join("testdata", "test_public.key"))
+	require.NoError(t, err)
+	decryption, err := crypto.NewDecryption(filepath.Join("testdata", "test_private.key"))
+	require.NoError(t, err)
+
+	payload := []byte("some test message")
+
+	first, err := encryption.Encrypt(payload, "/update/")
+	require.NoError(t, err)
+	second, err := encryption.Encrypt(payload, "/update/")
+	require.NoError(t, err)
+
+	// every envelope has its own key and nonce
+	assert.Equal(t, []byte("MENV"), first[:4])
+	assert.Equal(t, crypto.EnvelopeVersion, first[4])
+	assert.NotEqual(t, first, second)
+
+	decrypted, err := decryption.Decrypt(first, "/update/")
+	require.NoError(t, err)
+	assert.Equal(t, payload, decrypted)
+
+	// the envelope is bound to its route
+	_, err = decryption.Decrypt(first, "/updates/")
+	require.Error(t, err)
+
+	tampered := append([]byte{}, first...)
+	tampered[4] = 3
+	_, err = decryption.Decrypt(tampered, "/update/")
+	require.ErrorIs(t, err, crypto.ErrUnsupportedVersion)
+
+	_, err = decryption.Decrypt(first[:10], "/update/")
+	require.ErrorIs(t, err, crypto.ErrMalformedEnvelope)
+}
+
+func TestEnvelope_Legacy(t *testing.T) {
+	t.Parallel()
+
+	encryption, err := crypto.NewEncryption(filepath.Join("testdata", "test_public.key"))
+	require.NoError(t, err)
+	decryption, err := crypto.NewDecryption(filepath.Join("testdata", "test_private.key"))
+	require.NoError(t, err)
+
+	payload := []byte("some test message")
+	legacy := legacyEncrypt(t, encryption, payload)
+
+	// the legacy format is accepted during the migration
+	decrypted, err := decryption.Decrypt(legacy, "/update/")
+	require.NoError(t, err)
+	assert.Equal(t, payload, decrypted)
+
+	strict := &crypto.Decryption{PrivateKey: decryption.PrivateKey, Legacy: false}
+	_, err = strict.Decrypt(legacy, "/update/")
+	require.ErrorIs(t, err, crypto.ErrLegacyFormat)
+
+	envelope, err := encryption.Encrypt(payload, "/update/")
+	require.NoError(t, err)
+	decrypted, err = strict.Decrypt(envelope, "/update/")
+	require.NoError(t, err)
+	assert.Equal(t, payload, decrypted)
+}
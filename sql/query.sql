@@ -1,74 +1,341 @@
 -- name: GetAllMetrics :many
 SELECT m.id,
        m.type,
+       m.updated_at,
        c.delta,
-       g.value
+       g.value,
+       h.histogram,
+       s.summary,
+       l.name,
+       l.labels
 FROM mtr_metrics AS m
-         LEFT JOIN counter_metrics AS c ON m.id = c.metric_id
-         LEFT JOIN gauge_metrics AS g ON m.id = g.metric_id;
+         LEFT JOIN counter_metrics AS c ON m.tenant = c.tenant AND m.id = c.metric_id
+         LEFT JOIN gauge_metrics AS g ON m.tenant = g.tenant AND m.id = g.metric_id
+         LEFT JOIN histogram_metrics AS h ON m.tenant = h.tenant AND m.id = h.metric_id
+         LEFT JOIN summary_metrics AS s ON m.tenant = s.tenant AND m.id = s.metric_id
+         LEFT JOIN metric_labels AS l ON m.tenant = l.tenant AND m.id = l.metric_id
+WHERE m.tenant = $1;
 
 -- name: GetUnifiedMetric :one
 SELECT m.id,
        m.type,
+       m.updated_at,
        c.delta,
-       g.value
+       g.value,
+       h.histogram,
+       s.summary,
+       l.name,
+       l.labels
 FROM mtr_metrics AS m
-         LEFT JOIN counter_metrics AS c ON m.id = c.metric_id
-         LEFT JOIN gauge_metrics AS g ON m.id = g.metric_id
-WHERE m.id = $1;
+         LEFT JOIN counter_metrics AS c ON m.tenant = c.tenant AND m.id = c.metric_id
+         LEFT JOIN gauge_metrics AS g ON m.tenant = g.tenant AND m.id = g.metric_id
+         LEFT JOIN histogram_metrics AS h ON m.tenant = h.tenant AND m.id = h.metric_id
+         LEFT JOIN summary_metrics AS s ON m.tenant = s.tenant AND m.id = s.metric_id
+         LEFT JOIN metric_labels AS l ON m.tenant = l.tenant AND m.id = l.metric_id
+WHERE m.tenant = $1
+  AND m.id = $2;
 
 -- name: GetManyMetrics :many
 SELECT m.id,
        m.type,
+       m.updated_at,
        c.delta,
-       g.value
+       g.value,
+       h.histogram,
+       s.summary,
+       l.name,
+       l.labels
 FROM mtr_metrics AS m
-         LEFT JOIN counter_metrics AS c ON m.id = c.metric_id
-         LEFT JOIN gauge_metrics AS g ON m.id = g.metric_id
-WHERE m.id = ANY($1::text[]);
+         LEFT JOIN counter_metrics AS c ON m.tenant = c.tenant AND m.id = c.metric_id
+         LEFT JOIN gauge_metrics AS g ON m.tenant = g.tenant AND m.id = g.metric_id
+         LEFT JOIN histogram_metrics AS h ON m.tenant = h.tenant AND m.id = h.metric_id
+         LEFT JOIN summary_metrics AS s ON m.tenant = s.tenant AND m.id = s.metric_id
+         LEFT JOIN metric_labels AS l ON m.tenant = l.tenant AND m.id = l.metric_id
+WHERE m.tenant = sqlc.arg(tenant)
+  AND m.id = ANY(sqlc.arg(ids)::text[]);
 
 -- name: InsertMtrMetric :exec
-INSERT INTO mtr_metrics (id, type)
-VALUES ($1, $2)
-ON CONFLICT (id, type) DO NOTHING;
+INSERT INTO mtr_metrics (tenant, id, type)
+VALUES ($1, $2, $3)
+ON CONFLICT (tenant, id, type) DO UPDATE
+    SET updated_at = now();
+
+-- name: TouchMtrMetric :exec
+UPDATE mtr_metrics
+SET updated_at = now()
+WHERE tenant = $1
+  AND id = $2;
+
+-- name: InsertMetricLabels :exec
+-- The labels of a series never change, they are part of its ID
+INSERT INTO metric_labels (tenant, metric_id, name, labels)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (tenant, metric_id) DO NOTHING;
 
 -- name: InsertCounterMetric :exec
-INSERT INTO counter_metrics (metric_id, delta)
-VALUES ($1, $2)
-ON CONFLICT (metric_id) DO NOTHING;
+INSERT INTO counter_metrics (tenant, metric_id, delta)
+VALUES ($1, $2, $3)
+ON CONFLICT (tenant, metric_id) DO NOTHING;
 
 -- name: InsertGaugeMetric :exec
-INSERT INTO gauge_metrics (metric_id, value)
-VALUES ($1, $2)
-ON CONFLICT (metric_id) DO NOTHING;
+INSERT INTO gauge_metrics (tenant, metric_id, value)
+VALUES ($1, $2, $3)
+ON CONFLICT (tenant, metric_id) DO NOTHING;
+
+-- name: InsertHistogramMetric :exec
+INSERT INTO histogram_metrics (tenant, metric_id, histogram)
+VALUES ($1, $2, $3)
+ON CONFLICT (tenant, metric_id) DO NOTHING;
+
+-- name: InsertSummaryMetric :exec
+INSERT INTO summary_metrics (tenant, metric_id, summary)
+VALUES ($1, $2, $3)
+ON CONFLICT (tenant, metric_id) DO NOTHING;
 
 -- name: UpdateCounterMetric :exec
 UPDATE counter_metrics
-SET delta = $2
-WHERE metric_id = $1;
+SET delta = $3
+WHERE tenant = $1
+  AND metric_id = $2;
 
 -- name: UpdateGaugeMetric :exec
 UPDATE gauge_metrics
-SET value = $2
-WHERE metric_id = $1;
+SET value = $3
+WHERE tenant = $1
+  AND metric_id = $2;
+
+-- name: UpdateHistogramMetric :exec
+UPDATE histogram_metrics
+SET histogram = $3
+WHERE tenant = $1
+  AND metric_id = $2;
+
+-- name: UpdateSummaryMetric :exec
+UPDATE summary_metrics
+SET summary = $3
+WHERE tenant = $1
+  AND metric_id = $2;
 
 -- name: UpsertMtrMetric :exec
--- Insert into mtr_metrics or update if conflict on (id, type)
-INSERT INTO mtr_metrics (id, type)
-VALUES ($1, $2)
-ON CONFLICT (id, type) DO UPDATE
+-- Insert into mtr_metrics or update if conflict on (tenant, id, type)
+INSERT INTO mtr_metrics (tenant, id, type)
+VALUES ($1, $2, $3)
+ON CONFLICT (tenant, id, type) DO UPDATE
     SET id = EXCLUDED.id, type = EXCLUDED.type;
 
 -- name: UpsertCounterMetric :exec
--- Insert into counter_metrics or update if conflict on (metric_id)
-INSERT INTO counter_metrics (metric_id, delta)
-VALUES ($1, $2)
-ON CONFLICT (metric_id) DO UPDATE
+-- Insert into counter_metrics or update if conflict on (tenant, metric_id)
+INSERT INTO counter_metrics (tenant, metric_id, delta)
+VALUES ($1, $2, $3)
+ON CONFLICT (tenant, metric_id) DO UPDATE
     SET delta = EXCLUDED.delta;
 
 -- name: UpsertGaugeMetric :exec
--- Insert into gauge_metrics or update if conflict on (metric_id)
-INSERT INTO gauge_metrics (metric_id, value)
-VALUES ($1, $2)
-ON CONFLICT (metric_id) DO UPDATE
-    SET value = EXCLUDED.value;
\ No newline at end of file
+-- Insert into gauge_metrics or update if conflict on (tenant, metric_id)
+INSERT INTO gauge_metrics (tenant, metric_id, value)
+VALUES ($1, $2, $3)
+ON CONFLICT (tenant, metric_id) DO UPDATE
+    SET value = EXCLUDED.value;
+
+-- name: UpsertHistogramMetric :exec
+-- Insert into histogram_metrics or update if conflict on (tenant, metric_id)
+INSERT INTO histogram_metrics (tenant, metric_id, histogram)
+VALUES ($1, $2, $3)
+ON CONFLICT (tenant, metric_id) DO UPDATE
+    SET histogram = EXCLUDED.histogram;
+
+-- name: UpsertSummaryMetric :exec
+-- Insert into summary_metrics or update if conflict on (tenant, metric_id)
+INSERT INTO summary_metrics (tenant, metric_id, summary)
+VALUES ($1, $2, $3)
+ON CONFLICT (tenant, metric_id) DO UPDATE
+    SET summary = EXCLUDED.summary;
+
+-- name: InsertCounterSample :exec
+INSERT INTO counter_samples (tenant, metric_id, delta)
+VALUES ($1, $2, $3);
+
+-- name: InsertGaugeSample :exec
+INSERT INTO gauge_samples (tenant, metric_id, value)
+VALUES ($1, $2, $3);
+
+-- name: GetCounterRange :many
+SELECT metric_id, delta, created_at
+FROM counter_samples
+WHERE tenant = $1
+  AND metric_id = $2
+  AND created_at BETWEEN sqlc.arg(from_time) AND sqlc.arg(to_time)
+ORDER BY created_at;
+
+-- name: GetGaugeRange :many
+SELECT metric_id, value, created_at
+FROM gauge_samples
+WHERE tenant = $1
+  AND metric_id = $2
+  AND created_at BETWEEN sqlc.arg(from_time) AND sqlc.arg(to_time)
+ORDER BY created_at;
+
+-- name: DeleteMetric :execrows
+-- Child rows in the value and sample tables are removed by ON DELETE CASCADE
+DELETE FROM mtr_metrics
+WHERE tenant = $1
+  AND id = $2
+  AND type = $3;
+
+-- name: DeleteManyMetrics :many
+DELETE FROM mtr_metrics
+WHERE tenant = sqlc.arg(tenant)
+  AND id = ANY(sqlc.arg(ids)::text[])
+RETURNING id;
+
+-- name: DeleteStaleMetrics :many
+-- Child rows in the value and sample tables are removed by ON DELETE CASCADE
+DELETE FROM mtr_metrics
+WHERE tenant = sqlc.arg(tenant)
+  AND updated_at < sqlc.arg(before)
+RETURNING id;
+
+-- name: GetTenants :many
+SELECT DISTINCT tenant
+FROM mtr_metrics
+ORDER BY tenant;
+
+-- name: BulkInsertMtrMetrics :exec
+-- The bulk queries take one array element per series and are sent together in a single batch,
+-- the series IDs are unique and sorted, so concurrent batches lock the rows in the same order.
+-- All series of a batch belong to the tenant given as a scalar
+INSERT INTO mtr_metrics (tenant, id, type)
+SELECT sqlc.arg(tenant)::text,
+       unnest(sqlc.arg(ids)::text[]),
+       unnest(sqlc.arg(types)::text[]::metric_type[])
+ON CONFLICT (tenant, id, type) DO UPDATE
+    SET updated_at = now();
+
+-- name: BulkInsertMetricLabels :exec
+INSERT INTO metric_labels (tenant, metric_id, name, labels)
+SELECT sqlc.arg(tenant)::text,
+       unnest(sqlc.arg(ids)::text[]),
+       unnest(sqlc.arg(names)::text[]),
+       unnest(sqlc.arg(labels)::text[]::jsonb[])
+ON CONFLICT (tenant, metric_id) DO NOTHING;
+
+-- name: BulkUpsertCounterMetrics :exec
+INSERT INTO counter_metrics (tenant, metric_id, delta)
+SELECT sqlc.arg(tenant)::text,
+       unnest(sqlc.arg(ids)::text[]),
+       unnest(sqlc.arg(deltas)::bigint[])
+ON CONFLICT (tenant, metric_id) DO UPDATE
+    SET delta = EXCLUDED.delta;
+
+-- name: BulkUpsertGaugeMetrics :exec
+INSERT INTO gauge_metrics (tenant, metric_id, value)
+SELECT sqlc.arg(tenant)::text,
+       unnest(sqlc.arg(ids)::text[]),
+       unnest(sqlc.arg(vals)::double precision[])
+ON CONFLICT (tenant, metric_id) DO UPDATE
+    SET value = EXCLUDED.value;
+
+-- name: BulkUpsertHistogramMetrics :exec
+INSERT INTO histogram_metrics (tenant, metric_id, histogram)
+SELECT sqlc.arg(tenant)::text,
+       unnest(sqlc.arg(ids)::text[]),
+       unnest(sqlc.arg(histograms)::text[]::jsonb[])
+ON CONFLICT (tenant, metric_id) DO UPDATE
+    SET histogram = EXCLUDED.histogram;
+
+-- name: BulkUpsertSummaryMetrics :exec
+INSERT INTO summary_metrics (tenant, metric_id, summary)
+SELECT sqlc.arg(tenant)::text,
+       unnest(sqlc.arg(ids)::text[]),
+       unnest(sqlc.arg(summaries)::text[]::jsonb[])
+ON CONFLICT (tenant, metric_id) DO UPDATE
+    SET summary = EXCLUDED.summary;
+
+-- name: BulkInsertCounterSamples :exec
+INSERT INTO counter_samples (tenant, metric_id, delta)
+SELECT sqlc.arg(tenant)::text,
+       unnest(sqlc.arg(ids)::text[]),
+       unnest(sqlc.arg(deltas)::bigint[]);
+
+-- name: BulkInsertGaugeSamples :exec
+INSERT INTO gauge_samples (tenant, metric_id, value)
+SELECT sqlc.arg(tenant)::text,
+       unnest(sqlc.arg(ids)::text[]),
+       unnest(sqlc.arg(vals)::double precision[]);
+
+-- name: BulkIncrementCounterMetrics :exec
+-- Adds the deltas to the stored counters, concurrent increments of a counter never overwrite each other
+INSERT INTO counter_metrics (tenant, metric_id, delta)
+SELECT sqlc.arg(tenant)::text,
+       unnest(sqlc.arg(ids)::text[]),
+       unnest(sqlc.arg(deltas)::bigint[])
+ON CONFLICT (tenant, metric_id) DO UPDATE
+    SET delta = counter_metrics.delta + EXCLUDED.delta;
+
+-- name: BulkIncrementGaugeMetrics :exec
+-- Adds the changes to the stored gauges, concurrent changes of a gauge never overwrite each other
+INSERT INTO gauge_metrics (tenant, metric_id, value)
+SELECT sqlc.arg(tenant)::text,
+       unnest(sqlc.arg(ids)::text[]),
+       unnest(sqlc.arg(vals)::double precision[])
+ON CONFLICT (tenant, metric_id) DO UPDATE
+    SET value = gauge_metrics.value + EXCLUDED.value;
+
+-- name: BulkInsertGaugeTotals :exec
+-- Records the changed values of the gauges as their samples
+INSERT INTO gauge_samples (tenant, metric_id, value)
+SELECT g.tenant, g.metric_id, g.value
+FROM gauge_metrics AS g
+WHERE g.tenant = sqlc.arg(tenant)
+  AND g.metric_id = ANY(sqlc.arg(ids)::text[]);
+
+-- name: BulkInsertCounterTotals :exec
+-- Records the incremented totals of the counters as their samples
+INSERT INTO counter_samples (tenant, metric_id, delta)
+SELECT c.tenant, c.metric_id, c.delta
+FROM counter_metrics AS c
+WHERE c.tenant = sqlc.arg(tenant)
+  AND c.metric_id = ANY(sqlc.arg(ids)::text[]);
+
+-- name: TrimCounterSamples :exec
+-- Keeps the newest samples of the counters up to the limit, the older ones are removed
+DELETE FROM counter_samples AS s
+USING (SELECT ids.metric_id,
+              (SELECT c.created_at
+               FROM counter_samples AS c
+               WHERE c.tenant = sqlc.arg(tenant)
+                 AND c.metric_id = ids.metric_id
+               ORDER BY c.created_at DESC
+               OFFSET sqlc.arg(keep)::int - 1 LIMIT 1) AS oldest
+       FROM unnest(sqlc.arg(ids)::text[]) AS ids(metric_id)) AS cut
+WHERE s.tenant = sqlc.arg(tenant)
+  AND s.metric_id = cut.metric_id
+  AND s.created_at < cut.oldest;
+
+-- name: TrimGaugeSamples :exec
+-- Keeps the newest samples of the gauges up to the limit, the older ones are removed
+DELETE FROM gauge_samples AS s
+USING (SELECT ids.metric_id,
+              (SELECT g.created_at
+               FROM gauge_samples AS g
+               WHERE g.tenant = sqlc.arg(tenant)
+                 AND g.metric_id = ids.metric_id
+               ORDER BY g.created_at DESC
+               OFFSET sqlc.arg(keep)::int - 1 LIMIT 1) AS oldest
+       FROM unnest(sqlc.arg(ids)::text[]) AS ids(metric_id)) AS cut
+WHERE s.tenant = sqlc.arg(tenant)
+  AND s.metric_id = cut.metric_id
+  AND s.created_at < cut.oldest;
+
+-- name: LockDistributions :many
+-- Locks the series, so concurrent writers merge their histograms and summaries one after another
+SELECT m.id,
+       h.histogram,
+       s.summary
+FROM mtr_metrics AS m
+         LEFT JOIN histogram_metrics AS h ON m.tenant = h.tenant AND m.id = h.metric_id
+         LEFT JOIN summary_metrics AS s ON m.tenant = s.tenant AND m.id = s.metric_id
+WHERE m.tenant = sqlc.arg(tenant)
+  AND m.id = ANY(sqlc.arg(ids)::text[])
+ORDER BY m.id
+FOR UPDATE OF m;
@@ -3,7 +3,7 @@ CREATE TYPE "metric_type" AS ENUM ('gauge', 'counter');
 
 -- Main metrics table to store only metadata (normalized structure)
 CREATE TABLE mtr_metrics (
-                                           "id" VARCHAR(255) NOT NULL,
+                                           "id" TEXT NOT NULL,
                                            "type" "metric_type" NOT NULL,
                                            PRIMARY KEY ("id", "type"),
                                            UNIQUE ("id")  -- Unique constraint added to allow foreign key referencing
@@ -11,7 +11,7 @@ CREATE TABLE mtr_metrics (
 
 -- Table for counter metrics, storing the delta value only
 CREATE TABLE counter_metrics (
-                                               "metric_id" VARCHAR(255) NOT NULL,
+                                               "metric_id" TEXT NOT NULL,
                                                "delta" BIGINT NOT NULL,
                                                PRIMARY KEY ("metric_id"),
                                                CONSTRAINT fk_metric FOREIGN KEY ("metric_id")
@@ -20,7 +20,7 @@ CREATE TABLE counter_metrics (
 
 -- Table for gauge metrics, storing the value only
 CREATE TABLE gauge_metrics (
-                                             "metric_id" VARCHAR(255) NOT NULL,
+                                             "metric_id" TEXT NOT NULL,
                                              "value" DOUBLE PRECISION NOT NULL,
                                              PRIMARY KEY ("metric_id"),
                                              CONSTRAINT fk_metric FOREIGN KEY ("metric_id")
@@ -32,4 +32,60 @@ CREATE INDEX mtr_metrics_id_idx ON mtr_metrics ("id");
 
 -- Optional: Add a unique constraint to enforce one entry per metric in either counter or gauge tables
 ALTER TABLE counter_metrics ADD CONSTRAINT unique_counter_id UNIQUE ("metric_id");
-ALTER TABLE gauge_metrics ADD CONSTRAINT unique_gauge_id UNIQUE ("metric_id");
\ No newline at end of file
+ALTER TABLE gauge_metrics ADD CONSTRAINT unique_gauge_id UNIQUE ("metric_id");
+
+-- Time-indexed history of every accepted counter value
+CREATE TABLE counter_samples (
+                                               "metric_id" TEXT NOT NULL,
+                                               "delta" BIGINT NOT NULL,
+                                               "created_at" TIMESTAMPTZ NOT NULL DEFAULT now(),
+                                               CONSTRAINT fk_counter_sample_metric FOREIGN KEY ("metric_id")
+                                                   REFERENCES mtr_metrics ("id") ON DELETE CASCADE
+);
+
+-- Time-indexed history of every accepted gauge value
+CREATE TABLE gauge_samples (
+                                             "metric_id" TEXT NOT NULL,
+                                             "value" DOUBLE PRECISION NOT NULL,
+                                             "created_at" TIMESTAMPTZ NOT NULL DEFAULT now(),
+                                             CONSTRAINT fk_gauge_sample_metric FOREIGN KEY ("metric_id")
+                                                 REFERENCES mtr_metrics ("id") ON DELETE CASCADE
+);
+
+CREATE INDEX counter_samples_metric_id_created_at_idx ON counter_samples ("metric_id", "created_at");
+CREATE INDEX gauge_samples_metric_id_created_at_idx ON gauge_samples ("metric_id", "created_at");
+
+-- Name and labels of labeled series, mtr_metrics.id holds the series ID (name followed by canonical labels),
+-- the IDs are text as the labels make them longer than a name
+CREATE TABLE metric_labels (
+                                             "metric_id" TEXT NOT NULL,
+                                             "name" TEXT NOT NULL,
+                                             "labels" JSONB NOT NULL DEFAULT '{}',
+                                             PRIMARY KEY ("metric_id"),
+                                             CONSTRAINT fk_metric_labels_metric FOREIGN KEY ("metric_id")
+                                                 REFERENCES mtr_metrics ("id") ON DELETE CASCADE
+);
+
+CREATE INDEX metric_labels_name_idx ON metric_labels ("name");
+
+-- Distribution metric types
+ALTER TYPE "metric_type" ADD VALUE 'histogram';
+ALTER TYPE "metric_type" ADD VALUE 'summary';
+
+-- Table for histogram metrics, storing bucket bounds, bucket counts, sum and count as JSON
+CREATE TABLE histogram_metrics (
+                                             "metric_id" TEXT NOT NULL,
+                                             "histogram" JSONB NOT NULL,
+                                             PRIMARY KEY ("metric_id"),
+                                             CONSTRAINT fk_metric FOREIGN KEY ("metric_id")
+                                                 REFERENCES mtr_metrics ("id") ON DELETE CASCADE
+);
+
+-- Table for summary metrics, storing quantiles, sum and count as JSON
+CREATE TABLE summary_metrics (
+                                           "metric_id" TEXT NOT NULL,
+                                           "summary" JSONB NOT NULL,
+                                           PRIMARY KEY ("metric_id"),
+                                           CONSTRAINT fk_metric FOREIGN KEY ("metric_id")
+                                               REFERENCES mtr_metrics ("id") ON DELETE CASCADE
+);
@@ -0,0 +1,167 @@
+-- name: GetAllMetrics :many
+SELECT m.id,
+       m.type,
+       m.updated_at,
+       c.delta,
+       g.value,
+       h.histogram,
+       s.summary,
+       l.name,
+       l.labels
+FROM mtr_metrics AS m
+         LEFT JOIN counter_metrics AS c ON m.tenant = c.tenant AND m.id = c.metric_id
+         LEFT JOIN gauge_metrics AS g ON m.tenant = g.tenant AND m.id = g.metric_id
+         LEFT JOIN histogram_metrics AS h ON m.tenant = h.tenant AND m.id = h.metric_id
+         LEFT JOIN summary_metrics AS s ON m.tenant = s.tenant AND m.id = s.metric_id
+         LEFT JOIN metric_labels AS l ON m.tenant = l.tenant AND m.id = l.metric_id
+WHERE m.tenant = sqlc.arg(tenant);
+
+-- name: GetUnifiedMetric :one
+SELECT m.id,
+       m.type,
+       m.updated_at,
+       c.delta,
+       g.value,
+       h.histogram,
+       s.summary,
+       l.name,
+       l.labels
+FROM mtr_metrics AS m
+         LEFT JOIN counter_metrics AS c ON m.tenant = c.tenant AND m.id = c.metric_id
+         LEFT JOIN gauge_metrics AS g ON m.tenant = g.tenant AND m.id = g.metric_id
+         LEFT JOIN histogram_metrics AS h ON m.tenant = h.tenant AND m.id = h.metric_id
+         LEFT JOIN summary_metrics AS s ON m.tenant = s.tenant AND m.id = s.metric_id
+         LEFT JOIN metric_labels AS l ON m.tenant = l.tenant AND m.id = l.metric_id
+WHERE m.tenant = sqlc.arg(tenant)
+  AND m.id = sqlc.arg(id);
+
+-- name: GetManyMetrics :many
+SELECT m.id,
+       m.type,
+       m.updated_at,
+       c.delta,
+       g.value,
+       h.histogram,
+       s.summary,
+       l.name,
+       l.labels
+FROM mtr_metrics AS m
+         LEFT JOIN counter_metrics AS c ON m.tenant = c.tenant AND m.id = c.metric_id
+         LEFT JOIN gauge_metrics AS g ON m.tenant = g.tenant AND m.id = g.metric_id
+         LEFT JOIN histogram_metrics AS h ON m.tenant = h.tenant AND m.id = h.metric_id
+         LEFT JOIN summary_metrics AS s ON m.tenant = s.tenant AND m.id = s.metric_id
+         LEFT JOIN metric_labels AS l ON m.tenant = l.tenant AND m.id = l.metric_id
+WHERE m.tenant = sqlc.arg(tenant)
+  AND m.id IN (sqlc.slice(ids));
+
+-- name: InsertMtrMetric :exec
+-- The type of a series is fixed, another type under the same ID violates mtr_metrics_tenant_id_key
+INSERT INTO mtr_metrics (tenant, id, type, updated_at)
+VALUES (sqlc.arg(tenant), sqlc.arg(id), sqlc.arg(type), sqlc.arg(updated_at))
+ON CONFLICT (tenant, id, type) DO UPDATE
+    SET updated_at = excluded.updated_at;
+
+-- name: InsertMetricLabels :exec
+-- The labels of a series never change, they are part of its ID
+INSERT INTO metric_labels (tenant, metric_id, name, labels)
+VALUES (sqlc.arg(tenant), sqlc.arg(metric_id), sqlc.arg(name), sqlc.arg(labels))
+ON CONFLICT (tenant, metric_id) DO NOTHING;
+
+-- name: UpsertCounterMetric :exec
+INSERT INTO counter_metrics (tenant, metric_id, delta)
+VALUES (sqlc.arg(tenant), sqlc.arg(metric_id), sqlc.arg(delta))
+ON CONFLICT (tenant, metric_id) DO UPDATE
+    SET delta = excluded.delta;
+
+-- name: UpsertGaugeMetric :exec
+INSERT INTO gauge_metrics (tenant, metric_id, value)
+VALUES (sqlc.arg(tenant), sqlc.arg(metric_id), sqlc.arg(value))
+ON CONFLICT (tenant, metric_id) DO UPDATE
+    SET value = excluded.value;
+
+-- name: UpsertHistogramMetric :exec
+INSERT INTO histogram_metrics (tenant, metric_id, histogram)
+VALUES (sqlc.arg(tenant), sqlc.arg(metric_id), sqlc.arg(histogram))
+ON CONFLICT (tenant, metric_id) DO UPDATE
+    SET histogram = excluded.histogram;
+
+-- name: UpsertSummaryMetric :exec
+INSERT INTO summary_metrics (tenant, metric_id, summary)
+VALUES (sqlc.arg(tenant), sqlc.arg(metric_id), sqlc.arg(summary))
+ON CONFLICT (tenant, metric_id) DO UPDATE
+    SET summary = excluded.summary;
+
+-- name: InsertCounterSample :exec
+INSERT INTO counter_samples (tenant, metric_id, delta, created_at)
+VALUES (sqlc.arg(tenant), sqlc.arg(metric_id), sqlc.arg(delta), sqlc.arg(created_at));
+
+-- name: InsertGaugeSample :exec
+INSERT INTO gauge_samples (tenant, metric_id, value, created_at)
+VALUES (sqlc.arg(tenant), sqlc.arg(metric_id), sqlc.arg(value), sqlc.arg(created_at));
+
+-- name: TrimCounterSamples :exec
+-- Keeps the newest samples of the counter up to the limit, the older ones are removed
+DELETE FROM counter_samples
+WHERE counter_samples.tenant = sqlc.arg(tenant)
+  AND counter_samples.metric_id = sqlc.arg(metric_id)
+  AND counter_samples.created_at < (SELECT c.created_at
+                    FROM counter_samples AS c
+                    WHERE c.tenant = sqlc.arg(tenant)
+                      AND c.metric_id = sqlc.arg(metric_id)
+                    ORDER BY c.created_at DESC
+                    LIMIT 1 OFFSET CAST(sqlc.arg(keep) AS INTEGER) - 1);
+
+-- name: TrimGaugeSamples :exec
+-- Keeps the newest samples of the gauge up to the limit, the older ones are removed
+DELETE FROM gauge_samples
+WHERE gauge_samples.tenant = sqlc.arg(tenant)
+  AND gauge_samples.metric_id = sqlc.arg(metric_id)
+  AND gauge_samples.created_at < (SELECT g.created_at
+                    FROM gauge_samples AS g
+                    WHERE g.tenant = sqlc.arg(tenant)
+                      AND g.metric_id = sqlc.arg(metric_id)
+                    ORDER BY g.created_at DESC
+                    LIMIT 1 OFFSET CAST(sqlc.arg(keep) AS INTEGER) - 1);
+
+-- name: GetCounterRange :many
+SELECT metric_id, delta, created_at
+FROM counter_samples
+WHERE tenant = sqlc.arg(tenant)
+  AND metric_id = sqlc.arg(metric_id)
+  AND created_at >= sqlc.arg(from_time)
+  AND created_at <= sqlc.arg(to_time)
+ORDER BY created_at;
+
+-- name: GetGaugeRange :many
+SELECT metric_id, value, created_at
+FROM gauge_samples
+WHERE tenant = sqlc.arg(tenant)
+  AND metric_id = sqlc.arg(metric_id)
+  AND created_at >= sqlc.arg(from_time)
+  AND created_at <= sqlc.arg(to_time)
+ORDER BY created_at;
+
+-- name: DeleteMetric :execrows
+-- Child rows in the value and sample tables are removed by ON DELETE CASCADE
+DELETE FROM mtr_metrics
+WHERE tenant = sqlc.arg(tenant)
+  AND id = sqlc.arg(id)
+  AND type = sqlc.arg(type);
+
+-- name: DeleteManyMetrics :many
+DELETE FROM mtr_metrics
+WHERE tenant = sqlc.arg(tenant)
+  AND id IN (sqlc.slice(ids))
+RETURNING id;
+
+-- name: DeleteStaleMetrics :many
+-- Child rows in the value and sample tables are removed by ON DELETE CASCADE
+DELETE FROM mtr_metrics
+WHERE tenant = sqlc.arg(tenant)
+  AND updated_at < sqlc.arg(before)
+RETURNING id;
+
+-- name: GetTenants :many
+SELECT DISTINCT tenant
+FROM mtr_metrics
+ORDER BY tenant;